@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lixiasky/Py2c/py2c"
+)
+
+// -batch：每个输入文件各自翻译为一个程序（与多模块翻译不同，文件之间不互相 import）。
+// 目录递归展开，通配符由 py2c 展开；输出目录中按输入的相对路径建立同样的子目录，
+// 最后写出清单（JSON）：每个文件生成的文件、诊断、改名与不能翻译的 import
+
+// manifestFile: 清单中的一个输入文件
+type manifestFile struct {
+	Input       string            `json:"input"`
+	Outputs     []string          `json:"outputs"`
+	Diagnostics []py2c.Diagnostic `json:"diagnostics"`
+	Renames     []py2c.Rename     `json:"renames,omitempty"`
+	Unresolved  []string          `json:"unresolved_imports"`
+	Coverage    *py2c.Coverage    `json:"coverage,omitempty"`
+	Error       string            `json:"error,omitempty"` // 没有翻译（读不了、AST 有错或 -fail-on-unsupported）时的原因
+}
+
+// manifest: -batch 写出的清单
+type manifest struct {
+	Translated int            `json:"translated"`
+	Failed     int            `json:"failed"`
+	Unresolved []string       `json:"unresolved_imports"` // 所有文件的 unresolved_imports
+	Coverage   py2c.Coverage  `json:"coverage"`           // 所有翻译了的文件的覆盖率
+	Files      []manifestFile `json:"files"`
+}
+
+// batchInput: 一个输入文件与它在输出目录中的相对路径
+type batchInput struct {
+	path, rel string
+}
+
+// batchInputs: 展开目录（递归，有 .py 时只取 .py，否则取 .json；跳过 . 开头的目录与 __pycache__）与通配符
+func batchInputs(args []string) ([]batchInput, error) {
+	inputs := []batchInput{}
+	for _, a := range args {
+		if st, err := os.Stat(a); err == nil && st.IsDir() {
+			found := map[string][]string{}
+			err := filepath.Walk(a, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.IsDir() {
+					if path != a && (strings.HasPrefix(info.Name(), ".") || info.Name() == "__pycache__") {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				ext := filepath.Ext(path)
+				found[ext] = append(found[ext], path)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			files := found[".py"]
+			if len(files) == 0 {
+				files = found[".json"]
+			}
+			for _, f := range files {
+				rel, _ := filepath.Rel(a, f)
+				inputs = append(inputs, batchInput{f, rel})
+			}
+			continue
+		}
+		matches := []string{a}
+		if _, err := os.Stat(a); err != nil && strings.ContainsAny(a, "*?[") {
+			// 引号中的通配符：shell 没有展开
+			if matches, err = filepath.Glob(a); err != nil {
+				return nil, fmt.Errorf("%s: %v", a, err)
+			}
+		}
+		for _, f := range matches {
+			rel := filepath.Clean(f)
+			if filepath.IsAbs(rel) || strings.HasPrefix(rel, "..") {
+				rel = filepath.Base(rel)
+			}
+			inputs = append(inputs, batchInput{f, rel})
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("no .py or AST files in %s", strings.Join(args, ", "))
+	}
+	seen := map[string]string{}
+	for _, in := range inputs {
+		out := strings.TrimSuffix(in.rel, filepath.Ext(in.rel))
+		if prev, ok := seen[out]; ok {
+			return nil, fmt.Errorf("%s and %s would both be translated to %s.c", prev, in.path, out)
+		}
+		seen[out] = in.path
+	}
+	return inputs, nil
+}
+
+// translateBatch: -batch 的翻译；返回退出码：有文件没能翻译、或 -strict 时有错误为 1
+func translateBatch(args []string) int {
+	inputs, err := batchInputs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	m := manifest{Files: []manifestFile{}, Coverage: py2c.Coverage{Percent: 100, ByNode: map[string]int{}, Dropped: []py2c.Diagnostic{}}}
+	unresolved := map[string]bool{}
+	all := []py2c.Diagnostic{}
+	for _, in := range inputs {
+		entry := translateBatchFile(in)
+		if entry.Error != "" {
+			m.Failed++
+			fmt.Fprintf(os.Stderr, "Error: %s: %s\n", in.path, entry.Error)
+		} else {
+			m.Translated++
+		}
+		for _, u := range entry.Unresolved {
+			unresolved[u] = true
+		}
+		all = append(all, entry.Diagnostics...)
+		if entry.Coverage != nil {
+			m.Coverage.Add(*entry.Coverage)
+		}
+		m.Files = append(m.Files, entry)
+	}
+	for u := range unresolved {
+		m.Unresolved = append(m.Unresolved, u)
+	}
+	sort.Strings(m.Unresolved)
+	if m.Unresolved == nil {
+		m.Unresolved = []string{}
+	}
+	strictFailed := printDiagnostics(all)
+	if err := writeCoverage(m.Coverage); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing coverage: %v\n", err)
+		return 1
+	}
+	path := optManifest
+	if path == "" {
+		path = filepath.Join(optOutput, "py2c-manifest.json")
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(path, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing manifest: %v\n", err)
+		return 1
+	}
+	logf(logInfo, "wrote %s: %d translated, %d failed", path, m.Translated, m.Failed)
+	if m.Failed > 0 || strictFailed {
+		return 1
+	}
+	return 0
+}
+
+// translateBatchFile: 翻译一个文件并写出结果；-o 给出输出目录时写在其中按 in.rel 建立的子目录里，否则写在输入旁边
+func translateBatchFile(in batchInput) manifestFile {
+	entry := manifestFile{Input: in.path, Outputs: []string{}, Diagnostics: []py2c.Diagnostic{}, Unresolved: []string{}}
+	fail := func(err error) manifestFile {
+		entry.Error = err.Error()
+		return entry
+	}
+	input, err := openInput(in.path)
+	if err != nil {
+		return fail(err)
+	}
+	data, err := ioutil.ReadAll(input)
+	input.Close()
+	if err != nil {
+		return fail(err)
+	}
+	opts.NameMap = nil
+	if err := loadNameMap(data); err != nil {
+		return fail(err)
+	}
+	cPath := strings.TrimSuffix(in.path, filepath.Ext(in.path)) + ".c"
+	if optOutput != "" {
+		cPath = filepath.Join(optOutput, strings.TrimSuffix(in.rel, filepath.Ext(in.rel))+".c")
+	}
+	opts.SourceFile, opts.CFile = py2c.SourceFileOf(in.path), cPath
+	out, diags, err := translateCached([]py2c.Module{{AST: data}}, func() (py2c.Output, []py2c.Diagnostic, error) {
+		return py2c.Translate(data, opts)
+	})
+	if diags != nil {
+		entry.Diagnostics = diags
+	}
+	if err == nil {
+		err = unsupportedFailure(diags)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	entry.Renames, entry.Coverage = out.Renames, &out.Coverage
+	if out.Unresolved != nil {
+		entry.Unresolved = out.Unresolved
+	}
+	if err := os.MkdirAll(filepath.Dir(cPath), 0755); err != nil {
+		return fail(err)
+	}
+	if err := writeOutput(cPath, out.C); err != nil {
+		return fail(err)
+	}
+	entry.Outputs = append(entry.Outputs, cPath)
+	if out.Sketch != "" {
+		ino := strings.TrimSuffix(cPath, ".c") + ".ino"
+		if err := ioutil.WriteFile(ino, []byte(out.Sketch), 0644); err != nil {
+			return fail(err)
+		}
+		entry.Outputs = append(entry.Outputs, ino)
+	}
+	for _, f := range entry.Outputs {
+		logf(logInfo, "wrote %s", f)
+	}
+	return entry
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/lixiasky/Py2c/py2c"
+)
+
+// -cache-dir：构建系统对没有改动的文件反复调用 py2c 时，直接取上次的翻译结果。
+// 键是 py2c 可执行文件、翻译选项与输入 AST JSON 的 SHA-256，值是翻译结果与诊断（JSON）；翻译失败的不缓存
+
+// cacheFormat: 缓存文件的格式，改变 cacheEntry 时加一
+const cacheFormat = 1
+
+// cacheEntry: 一个缓存文件的内容
+type cacheEntry struct {
+	Output      py2c.Output
+	Diagnostics []py2c.Diagnostic
+}
+
+var exeHash struct {
+	once sync.Once
+	sum  string
+	err  error
+}
+
+// translatorHash: 当前可执行文件的 SHA-256：重新构建的 py2c 不会用到旧版本的结果
+func translatorHash() (string, error) {
+	exeHash.once.Do(func() {
+		exe, err := os.Executable()
+		if err != nil {
+			exeHash.err = err
+			return
+		}
+		data, err := ioutil.ReadFile(exe)
+		if err != nil {
+			exeHash.err = err
+			return
+		}
+		sum := sha256.Sum256(data)
+		exeHash.sum = hex.EncodeToString(sum[:])
+	})
+	return exeHash.sum, exeHash.err
+}
+
+// cacheKey: 用 o 翻译 modules 的结果的键（单个输入时只有 AST）
+func cacheKey(o py2c.Options, modules []py2c.Module) (string, error) {
+	exe, err := translatorHash()
+	if err != nil {
+		return "", err
+	}
+	o.Trace = nil
+	options, err := json.Marshal(o)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "py2c cache %d\n%s\n%s\n", cacheFormat, exe, options)
+	for _, m := range modules {
+		// 带上长度：相邻的字段拼接后不会与另一组输入相同
+		fmt.Fprintf(h, "%q %q %d %d\n", m.Name, m.File, len(m.Source), len(m.AST))
+		h.Write([]byte(m.Source))
+		h.Write(m.AST)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// translateCached: 有 -cache-dir 时先按 modules 与 opts 查缓存，命中时不再翻译；
+// 否则调用 translate，成功的结果写入缓存。缓存读写失败只警告，照常翻译
+func translateCached(modules []py2c.Module, translate func() (py2c.Output, []py2c.Diagnostic, error)) (py2c.Output, []py2c.Diagnostic, error) {
+	if optCacheDir == "" {
+		return translate()
+	}
+	key, err := cacheKey(opts, modules)
+	if err != nil {
+		logf(logWarn, "-cache-dir: %v; translating without the cache", err)
+		return translate()
+	}
+	path := filepath.Join(optCacheDir, key+".json")
+	if data, err := ioutil.ReadFile(path); err == nil {
+		var entry cacheEntry
+		if err := json.Unmarshal(data, &entry); err == nil {
+			logf(logInfo, "reused the translation cached in %s", path)
+			return entry.Output, entry.Diagnostics, nil
+		}
+		logf(logWarn, "-cache-dir: %s is damaged; translating again", path)
+	}
+	out, diags, err := translate()
+	if err != nil {
+		return out, diags, err
+	}
+	if err := storeCache(path, cacheEntry{out, diags}); err != nil {
+		logf(logWarn, "-cache-dir: %v", err)
+	} else {
+		logf(logDebug, "cached the translation in %s", path)
+	}
+	return out, diags, nil
+}
+
+// storeCache: 先写临时文件再改名，同时运行的 py2c 不会读到写了一半的文件
+func storeCache(path string, entry cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/lixiasky/Py2c/py2c"
+)
+
+// py2c dump-script [-o file]：写出把 .py 文件转成 AST JSON 的 Python 脚本（py2c.DumpScript，即 py2ast.py），
+// 也就是 py2c 自己解析 .py 输入时运行的脚本。不能在 py2c 中直接运行 Python 的场合用它先转换，再翻译 JSON
+
+// runDumpScript: py2c dump-script；返回退出码
+func runDumpScript(args []string) int {
+	fs := flag.NewFlagSet("dump-script", flag.ContinueOnError)
+	output := fs.String("o", "-", "write the script to `file` (- for stdout); the file is made executable")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s dump-script [-o py2ast.py]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "then: python3 py2ast.py foo.py > foo.json && %s foo.json\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	if *output == "-" {
+		if _, err := os.Stdout.WriteString(py2c.DumpScript); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	if err := ioutil.WriteFile(*output, []byte(py2c.DumpScript), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: writing %s: %v\n", *output, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lixiasky/Py2c/py2c/golden"
+)
+
+// py2c test [options] <dir | sample>...：示例的回归测试（py2c/golden）。每个示例翻译、用 -cc 的编译器编译、运行，
+// 标准输出与旁边的 .out 文件比较，没有 .out 时与 -python 运行原程序的输出比较；-update 用 Python 的输出重写 .out
+
+// runGolden: py2c test；返回退出码：有示例失败或出错时为 1
+func runGolden(paths []string) int {
+	cfg := golden.Config{
+		Options: opts,
+		CC:      optCC,
+		CFlags:  strings.Fields(optCFlags),
+		Python:  optPython,
+		Update:  optUpdate,
+		Parse:   pythonAST,
+	}
+	samples, err := golden.Samples(paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	counts := map[golden.Status]int{}
+	for _, s := range samples {
+		r := golden.Run(s, cfg)
+		counts[r.Status]++
+		for _, d := range r.Diagnostics {
+			logf(logInfo, "%s:%d:%d: %s: %s", d.File, d.Line, d.Col, d.Severity, d.Message)
+		}
+		switch r.Status {
+		case golden.Pass:
+			fmt.Printf("PASS  %s\n", s)
+		case golden.Updated:
+			fmt.Printf("OK    %s (updated the .out file)\n", s)
+		case golden.Fail:
+			fmt.Printf("FAIL  %s: %s\n", s, r.Diff())
+		default:
+			fmt.Printf("ERROR %s: %s: %s\n", s, r.Stage, indentLines(r.Message))
+		}
+	}
+	parts := []string{fmt.Sprintf("%d passed", counts[golden.Pass]+counts[golden.Updated])}
+	if n := counts[golden.Fail]; n > 0 {
+		parts = append(parts, fmt.Sprintf("%d failed", n))
+	}
+	if n := counts[golden.Error]; n > 0 {
+		parts = append(parts, plural(n, "error"))
+	}
+	fmt.Printf("%s, of %s\n", strings.Join(parts, ", "), plural(len(samples), "sample"))
+	if counts[golden.Fail] > 0 || counts[golden.Error] > 0 {
+		return 1
+	}
+	return 0
+}
+
+// indentLines: 多行的消息（编译器的输出）从第二行起缩进
+func indentLines(s string) string {
+	return strings.ReplaceAll(strings.TrimRight(s, "\n"), "\n", "\n      ")
+}
+
+// runVerify: -verify：每个输入与 Python 原程序比较输出与退出码（golden.Verify）；返回退出码：有不同或出错时为 1
+func runVerify(inputs, progArgs []string) int {
+	cfg := golden.Config{
+		Options: opts,
+		CC:      optCC,
+		CFlags:  strings.Fields(optCFlags),
+		Python:  optPython,
+		Parse:   pythonAST,
+		Args:    progArgs,
+	}
+	status := 0
+	for _, in := range inputs {
+		r := golden.Verify(in, cfg)
+		for _, d := range r.Diagnostics {
+			logf(logInfo, "%s:%d:%d: %s: %s", d.File, d.Line, d.Col, d.Severity, d.Message)
+		}
+		fmt.Print(r.Report())
+		if r.Status != golden.Pass {
+			status = 1
+		}
+	}
+	return status
+}
@@ -0,0 +1,1144 @@
+// py2c: Python AST (JSON) to C code translator
+// py2c：Python AST（JSON）转C代码工具。翻译在 py2c 包中，这里只是命令行：读输入、写输出、编译运行
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lixiasky/Py2c/py2c"
+)
+
+// --- 命令行选项（翻译选项在 opts 中）---
+var opts = py2c.DefaultOptions()
+var optCallGraph = ""            // -emit-callgraph：把生成代码的调用图写到该文件（.json 为 JSON，否则 DOT）
+var optOutput = ""               // -o：输出文件（- 为标准输出），多个模块时为输出目录
+var optLogLevel = "warn"         // -log-level：stderr 上输出的诊断信息级别，-v 等于 debug
+var optDiagFormat = "text"       // -diag-format：翻译诊断（不支持的写法等）的输出格式，text 或 json
+var optStrict = false            // -strict：有代码没能翻译（成了注释）或使用前可能没有赋值的变量时以状态 1 退出
+var optFailUnsupported = false   // -fail-on-unsupported：有代码不能翻译时不写输出，列出这些节点后以状态 1 退出
+var optRun = false               // -run：编译生成的代码（放在临时目录）并运行
+var optCC = ""                   // -cc：C 编译器，默认 $CC，否则 cc、gcc、clang 中第一个能找到的；单独使用时编译出可执行文件
+var optCFlags = ""               // -cflags：传给 C 编译器的选项
+var optBuildFiles = "make,cmake" // -build-files：多模块翻译时生成的构建文件（make、cmake 或 none）
+var runDir = ""                  // -run 的临时目录，没有 -o 时生成的 C 代码也写在这里
+var optPython = ""               // -python：解析 .py 输入用的 Python 解释器，默认 python3，找不到时用 python
+var optClangFormat = ""          // -clang-format：写出的 .c/.h 经 clang-format 按这个风格重排
+var optSource = ""               // -source：AST JSON 输入对应的 Python 源文件，-comments 与 -annotate 从中取源码
+var optRenameMap = ""            // -rename-map：把改了名字的标识符（Python 名 -> C 名）写成 JSON
+var optCoverage = ""             // -coverage：翻译覆盖率写到该文件（.json 为 JSON，否则文字；- 为 stderr）
+var optIdentifiers = "escape"    // -identifiers：非 ASCII 名字的写法，escape、utf8 或 pinyin（pinyin 由 loadNameMap 转为 NameMap）
+var optNameMap = ""              // -name-map：Python 名 -> C 名的 JSON 文件
+var optStats = false             // -stats：翻译完后在 stderr 上输出读入的 AST 大小、用时与内存峰值
+var optOnly = ""                 // -only：只翻译这些顶层函数（逗号分隔），其他的只输出原型
+var optExclude = ""              // -exclude：这些顶层函数（逗号分隔）只输出原型
+var optExternMap = ""            // -extern-map：Python 函数名 -> 实现它的 C 函数名的 JSON 文件
+var optCallMap = ""              // -map：函数调用翻译成的 C 代码，YAML 或 JSON 文件（见 yaml.go）
+var optWatch = false             // -watch：输入改变时重新运行（去掉 -watch 的同一条命令）
+var optBatch = false             // -batch：每个输入文件各自翻译为一个程序，输出目录中保持输入的目录结构
+var optManifest = ""             // -manifest：-batch 的清单文件，默认为输出目录中的 py2c-manifest.json
+var optCacheDir = ""             // -cache-dir：翻译结果的缓存目录，键是可执行文件、选项与 AST 的哈希
+var optUpdate = false            // -update：py2c test 用 Python 的输出重写示例的 .out 文件
+var optVerify = false            // -verify：运行 Python 原程序与翻译后的程序，比较输出与退出码，不写输出
+
+// main: entry point, read AST JSON and output C code
+// main：主入口，读取AST JSON并输出C代码
+func main() {
+	// py2c dump-script：写出 py2ast.py，见 dumpscript.go
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "dump-script" {
+		os.Exit(runDumpScript(args[1:]))
+	}
+	// py2c test：示例的回归测试，见 golden.go
+	testCmd := len(args) > 0 && args[0] == "test"
+	if testCmd {
+		args = args[1:]
+	}
+	flag.BoolVar(&opts.StripDocs, "strip-docstrings", false, "drop docstrings instead of writing them as /** */ comments above the functions and structs")
+	flag.BoolVar(&opts.Comments, "comments", false, "copy the # comments of the Python source into the C code, above the statements they belong to (needs the source: a .py input, an AST from py2ast.py, or -source)")
+	flag.StringVar(&optSource, "source", "", "the Python `file` an AST JSON input was made from, for -comments and -annotate when the AST has no source text")
+	flag.BoolVar(&opts.Optimize, "O", false, "optimize: fold constant arithmetic, drop if/while branches that cannot run and code after return/raise/break/continue, remove unused static helpers")
+	flag.BoolVar(&opts.InlineGetters, "inline-getters", false, "replace calls to simple getter methods with direct field access")
+	flag.BoolVar(&opts.LICM, "licm", true, "hoist loop-invariant expressions out of range loops")
+	flag.BoolVar(&opts.Heap, "heap", false, "allocate every class instance with malloc and free it when its scope ends")
+	flag.StringVar(&optIdentifiers, "identifiers", "escape", "non-ASCII names (C89 identifiers are ASCII): escape (each character as _uXXXX), utf8 (keep them; most C99 compilers accept UTF-8 identifiers) or pinyin (Chinese characters as pinyin syllables, via the pypinyin package of -python)")
+	flag.StringVar(&optOnly, "only", "", "translate only these top-level functions (comma-separated Python names); the others become extern prototypes, to be provided by hand-written C")
+	flag.StringVar(&optExclude, "exclude", "", "top-level functions (comma-separated Python names) that become extern prototypes instead of being translated")
+	flag.BoolVar(&optWatch, "watch", false, "keep running: translate again (and with -cc or -run, build and run again) whenever an input file changes, listing the diagnostics that are new or fixed since the previous run")
+	flag.BoolVar(&optBatch, "batch", false, "translate every input file as a program of its own: directories are searched recursively and quoted glob patterns expanded; with -o DIR the outputs mirror the layout of the inputs under DIR. Also writes a manifest of the generated files, diagnostics and unresolved imports")
+	flag.StringVar(&optManifest, "manifest", "", "the JSON `file` of -batch (default: py2c-manifest.json in the output directory)")
+	flag.StringVar(&optCacheDir, "cache-dir", "", "keep the translations in `dir`, keyed by a hash of the AST JSON, the options and the py2c executable, and reuse them when the same input is translated again with the same options")
+	flag.BoolVar(&optVerify, "verify", false, "differential check: build each input in a temporary directory, run it and the Python original (arguments after -- go to both), and report where their output or exit status differ, with the Python line that printed the first different line")
+	flag.BoolVar(&optUpdate, "update", false, "with py2c test: write each sample's .out file from the output of the Python original instead of comparing with it")
+	flag.BoolVar(&optStats, "stats", false, "after translating, print the size of the AST JSON read, the time taken and the peak memory use to stderr")
+	flag.StringVar(&optCallMap, "map", "", "YAML or JSON `file` declaring the C code that calls to project functions translate to (c template, params, includes, returns), e.g. utils.log -> syslog(...); see the README")
+	flag.StringVar(&optExternMap, "extern-map", "", "JSON `file` mapping top-level Python functions to existing C functions that implement them, e.g. {\"crc16\": \"crc16_ccitt\"}; like @py2c.extern, calls go to the C function and the body is not translated")
+	flag.StringVar(&optNameMap, "name-map", "", "JSON `file` mapping Python names to the C names to use instead, e.g. {\"总数\": \"total\"}; takes precedence over -identifiers")
+	flag.StringVar(&optRenameMap, "rename-map", "", "write the identifiers renamed because they collide with C keywords, C library names or generated names to `file` (JSON: python, c, reason)")
+	flag.StringVar(&optCoverage, "coverage", "", "write a translation coverage report to `file` (- for stderr; JSON if it ends in .json): how many Python statements were translated, and which node types could not be and where")
+	flag.StringVar(&optCallGraph, "emit-callgraph", "", "write the call graph of the generated C to `file` (JSON if it ends in .json, DOT otherwise)")
+	flag.StringVar(&opts.Exceptions, "exceptions", "setjmp", "exception handling: setjmp (try/except via setjmp/longjmp), exit (raise prints the error and exits) or status (functions that can raise return an error code)")
+	flag.BoolVar(&opts.Annotate, "annotate", false, "precede the C code of each statement with the original Python statement as a comment")
+	flag.StringVar(&opts.LineMap, "line-map", "none", "map the C code back to the Python source: directive (#line before each statement, for compiler errors and debuggers), comment (/* file.py:line:col */) or none")
+	flag.BoolVar(&opts.Refcount, "refcount", false, "reference-count strings, lists and class instances (incref/decref at assignments, container inserts and scope exits)")
+	flag.BoolVar(&opts.OwnedStrings, "owned-strings", false, "allocate built strings (f-strings, concatenation, join, input) at their exact size and free them when the variable holding them is rebound or goes out of scope (always on with -refcount)")
+	flag.StringVar(&opts.Alloc, "alloc", "malloc", "memory for lists, objects and strings: malloc (each allocation on its own) or arena (carved from large blocks released once at exit; free does nothing), for scripts that run and exit")
+	flag.StringVar(&optOutput, "o", "", "write the C code to `file` (- for stdout; default: the input with a .c extension); with several modules, the output directory")
+	flag.StringVar(&optLogLevel, "log-level", "warn", "diagnostics printed to stderr: error, warn, info (also the files written) or debug (analysis traces)")
+	verbose := flag.Bool("v", false, "verbose: same as -log-level=debug")
+	flag.StringVar(&optDiagFormat, "diag-format", "text", "format of the translation diagnostics on stderr: text (file:line:col: severity: message, then a summary) or json")
+	flag.BoolVar(&opts.StubUnsupported, "stub-unsupported", false, "replace code that cannot be translated with a call that prints \"NOT IMPLEMENTED: <construct> at file.py:line\" and aborts, instead of a comment, so a partially ported program still compiles and fails where the missing code is reached")
+	flag.BoolVar(&optStrict, "strict", false, "exit with status 1 when some Python code could not be translated (it is left as a comment in the output) or a variable may be used before it is assigned; those warnings become errors")
+	flag.BoolVar(&optFailUnsupported, "fail-on-unsupported", false, "when some Python code cannot be translated, write nothing and exit with status 1 after listing the unsupported nodes")
+	flag.BoolVar(&optRun, "run", false, "compile the C code in a temporary directory and run it; program arguments follow --")
+	flag.StringVar(&optCC, "cc", "", "C `compiler` (default $CC, else cc, gcc or clang); without -run, builds an executable next to the C output")
+	flag.StringVar(&optCFlags, "cflags", "", "options for the C compiler, e.g. \"-O2 -std=c99\"")
+	flag.StringVar(&optBuildFiles, "build-files", "make,cmake", "build files written with several modules: make (Makefile), cmake (CMakeLists.txt), both separated by a comma, or none")
+	flag.StringVar(&optPython, "python", "", "Python interpreter that parses .py inputs (default python3, or python when there is no python3)")
+	flag.StringVar(&opts.Std, "std", "", "C dialect of the generated code: c89 (/* */ comments, declarations at the start of blocks), c99 or c11; default C99 plus the C11 keywords the runtime needs")
+	flag.BoolVar(&opts.Freestanding, "freestanding", false, "no C library: include no headers, print through an extern putstr(const char*) you provide, generate the math helpers; code that needs libc is reported")
+	flag.StringVar(&opts.Profile, "profile", "", "target platform: arduino (setup()/loop() instead of main, print over Serial, time.sleep as delay; also writes the .ino next to the C file)")
+	flag.IntVar(&opts.Style.IndentWidth, "indent", 4, "spaces per indentation level of the generated code")
+	flag.BoolVar(&opts.Style.UseTabs, "tabs", false, "indent the generated code with one tab per level")
+	flag.StringVar(&opts.Style.Braces, "braces", "attach", "brace placement: attach (same line), allman (every opening brace on its own line) or linux (only function bodies)")
+	flag.IntVar(&opts.Style.MaxLine, "max-line", 0, "break lines longer than this many columns after a comma (0: no limit)")
+	flag.StringVar(&optClangFormat, "clang-format", "", "pipe every written .c/.h through clang-format with this `style` (e.g. file, LLVM, Google); takes precedence over -indent, -tabs and -braces")
+	flag.StringVar(&opts.Header, "header", "", "also write the types, prototypes and extern declarations to `file`; the top-level code becomes NAME_module_init() instead of main")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <file.py | ast_json_file | ->   (- reads the AST JSON or ast.dump() text from stdin)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [options] <module.py | module.json>... | <dir>   (one .c/.h per module)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s -run [options] <input>... [-- program arguments]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s test [options] <dir | sample>...   (translate, build and run each sample, compare with its .out or Python)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s dump-script [-o py2ast.py]   (write the Python script that dumps a .py file as the AST JSON py2c reads)\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.CommandLine.Parse(args)
+	// -- 之后是 -run 运行程序时的参数
+	inputs, progArgs := flag.Args(), []string{}
+	for i, a := range inputs {
+		if a == "--" {
+			inputs, progArgs = inputs[:i], inputs[i+1:]
+			break
+		}
+	}
+	// 用法错误的退出码为 2（与 flag 包一致），翻译或写文件失败为 1
+	if len(inputs) < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if len(progArgs) > 0 && !optRun && !optVerify {
+		fmt.Fprintf(os.Stderr, "Error: arguments after -- are passed to the program and need -run or -verify\n")
+		os.Exit(2)
+	}
+	if compile := optRun || optCC != ""; compile && (optOutput == "-" || opts.Header != "") {
+		fmt.Fprintf(os.Stderr, "Error: -run and -cc build an executable, which needs a C file with main (not -o - or -header)\n")
+		os.Exit(2)
+	}
+	if logLevel = logLevelOf(optLogLevel); logLevel < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -log-level must be error, warn, info or debug, got %q\n", optLogLevel)
+		os.Exit(2)
+	}
+	if *verbose {
+		logLevel = logDebug
+	}
+	if logLevel >= logDebug {
+		opts.Trace = os.Stderr
+	}
+	if optDiagFormat != "text" && optDiagFormat != "json" {
+		fmt.Fprintf(os.Stderr, "Error: -diag-format must be text or json, got %q\n", optDiagFormat)
+		os.Exit(2)
+	}
+	if opts.Exceptions != "setjmp" && opts.Exceptions != "exit" && opts.Exceptions != "status" {
+		fmt.Fprintf(os.Stderr, "Error: -exceptions must be setjmp, exit or status, got %q\n", opts.Exceptions)
+		os.Exit(2)
+	}
+	if opts.Alloc != "malloc" && opts.Alloc != "arena" {
+		fmt.Fprintf(os.Stderr, "Error: -alloc must be malloc or arena, got %q\n", opts.Alloc)
+		os.Exit(2)
+	}
+	if opts.LineMap != "none" && opts.LineMap != "directive" && opts.LineMap != "comment" {
+		fmt.Fprintf(os.Stderr, "Error: -line-map must be directive, comment or none, got %q\n", opts.LineMap)
+		os.Exit(2)
+	}
+	if opts.Std != "" && opts.Std != "c89" && opts.Std != "c99" && opts.Std != "c11" {
+		fmt.Fprintf(os.Stderr, "Error: -std must be c89, c99 or c11, got %q\n", opts.Std)
+		os.Exit(2)
+	}
+	opts.Strict = optStrict
+	opts.Only, opts.Exclude = nameList(optOnly), nameList(optExclude)
+	if optCallMap != "" {
+		calls, err := loadCallMap(optCallMap)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -map: %v\n", err)
+			os.Exit(2)
+		}
+		opts.Calls = calls
+	}
+	if optExternMap != "" {
+		data, err := ioutil.ReadFile(optExternMap)
+		if err == nil {
+			err = json.Unmarshal(data, &opts.Externs)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -extern-map: %v (want a JSON object from Python function names to C function names)\n", err)
+			os.Exit(2)
+		}
+	}
+	switch optIdentifiers {
+	case "escape", "utf8":
+		opts.Identifiers = optIdentifiers
+	case "pinyin":
+		opts.Identifiers = "escape"
+	default:
+		fmt.Fprintf(os.Stderr, "Error: -identifiers must be escape, utf8 or pinyin, got %q\n", optIdentifiers)
+		os.Exit(2)
+	}
+	if opts.Identifiers == "utf8" && opts.Std == "c89" {
+		fmt.Fprintf(os.Stderr, "Error: -identifiers utf8 needs -std c99 or c11; C89 identifiers are ASCII only\n")
+		os.Exit(2)
+	}
+	if opts.Profile != "" && opts.Profile != "arduino" {
+		fmt.Fprintf(os.Stderr, "Error: -profile must be arduino, got %q\n", opts.Profile)
+		os.Exit(2)
+	}
+	if opts.Style.IndentWidth < 1 || opts.Style.IndentWidth > 16 {
+		fmt.Fprintf(os.Stderr, "Error: -indent must be between 1 and 16, got %d\n", opts.Style.IndentWidth)
+		os.Exit(2)
+	}
+	if opts.Style.Braces != "attach" && opts.Style.Braces != "allman" && opts.Style.Braces != "linux" {
+		fmt.Fprintf(os.Stderr, "Error: -braces must be attach, allman or linux, got %q\n", opts.Style.Braces)
+		os.Exit(2)
+	}
+	if opts.Style.MaxLine < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -max-line must not be negative, got %d\n", opts.Style.MaxLine)
+		os.Exit(2)
+	}
+	if optClangFormat != "" {
+		if _, err := exec.LookPath("clang-format"); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -clang-format: clang-format not found in PATH\n")
+			os.Exit(2)
+		}
+	}
+	if opts.Profile != "" && (optRun || optCC != "") {
+		fmt.Fprintf(os.Stderr, "Error: -run and -cc build for this machine; build an -profile %s sketch with its own toolchain\n", opts.Profile)
+		os.Exit(2)
+	}
+	for _, kind := range strings.Split(optBuildFiles, ",") {
+		switch k := strings.TrimSpace(kind); k {
+		case "make", "cmake":
+			opts.BuildFiles = append(opts.BuildFiles, k)
+		case "none":
+		default:
+			fmt.Fprintf(os.Stderr, "Error: -build-files must list make, cmake or none, got %q\n", kind)
+			os.Exit(2)
+		}
+	}
+	// -std 也是编译生成代码时的标准，除非 -cflags 中另有 -std=
+	if opts.Std != "" && !strings.Contains(optCFlags, "-std=") {
+		optCFlags = strings.TrimSpace(optCFlags + " -std=" + opts.Std)
+	}
+	// 构建文件中的 C 标准：-cflags 中的 -std= 优先
+	for _, f := range strings.Fields(optCFlags) {
+		if strings.HasPrefix(f, "-std=") {
+			opts.CStd = strings.TrimPrefix(f, "-std=")
+		}
+	}
+	if optCallGraph != "" {
+		opts.CallGraph = "dot"
+		if strings.HasSuffix(optCallGraph, ".json") {
+			opts.CallGraph = "json"
+		}
+	}
+	// - 是标准输入：py2ast.py 的 JSON 或 ast.dump() 的文本，只能是唯一的输入
+	for _, in := range inputs {
+		if in != "-" {
+			continue
+		}
+		if len(inputs) > 1 || testCmd || optVerify || optWatch || optBatch {
+			fmt.Fprintf(os.Stderr, "Error: - (the AST on stdin) must be the only input; it cannot be combined with py2c test, -verify, -watch or -batch\n")
+			os.Exit(2)
+		}
+		if optCC != "" && !optRun && optOutput == "" {
+			fmt.Fprintf(os.Stderr, "Error: -cc with the AST on stdin needs -o to name the C file\n")
+			os.Exit(2)
+		}
+	}
+	if optUpdate && !testCmd {
+		fmt.Fprintf(os.Stderr, "Error: -update needs py2c test\n")
+		os.Exit(2)
+	}
+	if testCmd {
+		if optBatch || optRun || optWatch || opts.Header != "" || optOutput != "" {
+			fmt.Fprintf(os.Stderr, "Error: py2c test builds and runs every sample itself; it cannot be combined with -batch, -run, -watch, -header or -o\n")
+			os.Exit(2)
+		}
+		os.Exit(runGolden(inputs))
+	}
+	if optVerify {
+		if testCmd || optBatch || optRun || optWatch || opts.Header != "" || optOutput != "" {
+			fmt.Fprintf(os.Stderr, "Error: -verify builds and runs every input in a temporary directory; it cannot be combined with py2c test, -batch, -run, -watch, -header or -o\n")
+			os.Exit(2)
+		}
+		os.Exit(runVerify(inputs, progArgs))
+	}
+	if optWatch {
+		watch(inputs, progArgs)
+	}
+	if optBatch {
+		if opts.Header != "" || optSource != "" || optRenameMap != "" || optCallGraph != "" || optRun || optCC != "" || optOutput == "-" {
+			fmt.Fprintf(os.Stderr, "Error: -batch writes one .c per input and a manifest; it cannot be combined with -header, -source, -rename-map, -emit-callgraph, -run, -cc or -o -\n")
+			os.Exit(2)
+		}
+		os.Exit(translateBatch(inputs))
+	}
+	if optManifest != "" {
+		fmt.Fprintf(os.Stderr, "Error: -manifest needs -batch\n")
+		os.Exit(2)
+	}
+	if optRun {
+		dir, err := ioutil.TempDir("", "py2c")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		runDir = dir
+	}
+	if st, err := os.Stat(inputs[0]); len(inputs) > 1 || err == nil && st.IsDir() {
+		// 多个模块：每个模块输出 .c/.h 文件
+		if opts.Header != "" {
+			fmt.Fprintf(os.Stderr, "Error: -header needs a single AST file; with several modules every module gets its own .h\n")
+			os.Exit(2)
+		}
+		if optSource != "" {
+			fmt.Fprintf(os.Stderr, "Error: -source needs a single AST file; with several modules give the .py files instead\n")
+			os.Exit(2)
+		}
+		if optOutput == "-" {
+			fmt.Fprintf(os.Stderr, "Error: several modules cannot be written to stdout; -o names the output directory\n")
+			os.Exit(2)
+		}
+		cfiles, exe, libs, err := translateModules(inputs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if optRun || optCC != "" {
+			os.Exit(buildAndRun(cfiles, exe, libs, progArgs))
+		}
+		return
+	}
+	input, err := openInput(inputs[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		os.Exit(1)
+	}
+	defer input.Close()
+	asts := [][]byte{}
+	if optIdentifiers == "pinyin" || optCacheDir != "" {
+		// 拼音要先从 AST 中找出非 ASCII 的名字，缓存的键要用整个 AST：读进内存，再从内存翻译
+		data, err := ioutil.ReadAll(input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+			os.Exit(1)
+		}
+		input, asts = ioutil.NopCloser(bytes.NewReader(data)), append(asts, data)
+	}
+	if err := loadNameMap(asts...); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if optSource != "" {
+		src, err := ioutil.ReadFile(optSource)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -source: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Source = string(src)
+	}
+	cPath := outputPath(inputs[0])
+	opts.SourceFile, opts.CFile = py2c.SourceFileOf(inputs[0]), cPath
+	if inputs[0] == "-" {
+		// 诊断中的文件名：-source 给出的源文件，否则是 <stdin>
+		opts.SourceFile = "<stdin>"
+		if optSource != "" {
+			opts.SourceFile = optSource
+		}
+	}
+	if cPath == "-" {
+		opts.CFile = "<stdout>"
+	}
+	stats := startStats()
+	var cached []py2c.Module
+	if optCacheDir != "" {
+		cached = []py2c.Module{{AST: asts[0]}}
+	}
+	out, diags, err := translateCached(cached, func() (py2c.Output, []py2c.Diagnostic, error) {
+		return py2c.TranslateReader(stats.reader(input), opts)
+	})
+	stats.report()
+	strictFailed := printDiagnostics(diags)
+	if err == nil {
+		err = unsupportedFailure(diags)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.Header != "" {
+		if err := writeOutput(opts.Header, out.Header); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing header: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := writeOutput(cPath, out.C); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		os.Exit(1)
+	}
+	if out.Sketch != "" {
+		// Arduino 草图：.ino 与 C 文件同名，放在同一个目录中
+		if cPath == "-" {
+			logf(logWarn, "the .ino of -profile %s is not written when the C code goes to stdout", opts.Profile)
+		} else {
+			ino := strings.TrimSuffix(cPath, filepath.Ext(cPath)) + ".ino"
+			if err := ioutil.WriteFile(ino, []byte(out.Sketch), 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing sketch: %v\n", err)
+				os.Exit(1)
+			}
+			logf(logInfo, "wrote %s", ino)
+		}
+	}
+	if err := writeRenames(out.Renames); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing rename map: %v\n", err)
+		os.Exit(1)
+	}
+	if err := writeCoverage(out.Coverage); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing coverage: %v\n", err)
+		os.Exit(1)
+	}
+	if optCallGraph != "" {
+		if err := ioutil.WriteFile(optCallGraph, []byte(out.CallGraph), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing call graph: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if strictFailed {
+		os.Exit(1)
+	}
+	if optRun || optCC != "" {
+		os.Exit(buildAndRun([]string{cPath}, strings.TrimSuffix(cPath, ".c"), linkFlags(out), progArgs))
+	}
+}
+
+// loadCallMap: -map 文件：JSON（以 { 开头）或 YAML，调用的全名 -> c、params、includes、returns
+func loadCallMap(path string) (map[string]py2c.CallMap, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if text := strings.TrimSpace(string(data)); !strings.HasPrefix(text, "{") {
+		v, err := parseYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	calls := map[string]py2c.CallMap{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&calls); err != nil {
+		return nil, fmt.Errorf("%s: %v (want a mapping from call names to c, params, includes and returns)", path, err)
+	}
+	return calls, nil
+}
+
+// nameList: 逗号分隔的名字，去掉空白与空项
+func nameList(s string) []string {
+	names := []string{}
+	for _, n := range strings.Split(s, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// translateModules: 读入各个模块一起翻译，写出每个模块的 .c/.h 与构建文件；返回 .c 文件、可执行文件名以及链接的库
+func translateModules(args []string) ([]string, string, []string, error) {
+	modules, paths, err := loadModules(args)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	asts := [][]byte{}
+	for _, m := range modules {
+		asts = append(asts, m.AST)
+	}
+	if err := loadNameMap(asts...); err != nil {
+		return nil, "", nil, err
+	}
+	// 主模块：命令行上的第一个文件；给出目录时由 py2c 找出唯一没有被其他模块 import 的模块
+	if st, err := os.Stat(args[0]); err != nil || !st.IsDir() {
+		opts.MainModule = modules[0].Name
+	}
+	dir := ""
+	if optOutput != "" {
+		dir = optOutput
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, "", nil, err
+		}
+	} else if runDir != "" {
+		dir = runDir
+	}
+	if dir == "" && opts.MainModule != "" {
+		dir = filepath.Dir(paths[opts.MainModule])
+	}
+	opts.OutputDir = dir
+	stats := startStats()
+	for _, m := range modules {
+		stats.add(len(m.AST))
+	}
+	out, diags, err := translateCached(modules, func() (py2c.Output, []py2c.Diagnostic, error) {
+		return py2c.TranslateModules(modules, opts)
+	})
+	stats.report()
+	strictFailed := printDiagnostics(diags)
+	if err == nil {
+		err = unsupportedFailure(diags)
+	}
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if dir == "" {
+		// 主模块由 py2c 决定时，输出到它所在的目录（#line 中的文件名已经按这个目录生成）
+		dir = filepath.Dir(paths[out.Main])
+	}
+	names := []string{}
+	for name := range out.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cfiles := []string{}
+	for _, name := range names {
+		if err := writeOutput(filepath.Join(dir, name), out.Files[name]); err != nil {
+			return nil, "", nil, err
+		}
+		logf(logInfo, "wrote %s", filepath.Join(dir, name))
+		if strings.HasSuffix(name, ".c") {
+			cfiles = append(cfiles, filepath.Join(dir, name))
+		}
+	}
+	if err := writeRenames(out.Renames); err != nil {
+		return nil, "", nil, fmt.Errorf("writing rename map: %v", err)
+	}
+	if err := writeCoverage(out.Coverage); err != nil {
+		return nil, "", nil, fmt.Errorf("writing coverage: %v", err)
+	}
+	if optCallGraph != "" {
+		if err := ioutil.WriteFile(optCallGraph, []byte(out.CallGraph), 0644); err != nil {
+			return nil, "", nil, fmt.Errorf("writing call graph: %v", err)
+		}
+	}
+	if strictFailed {
+		os.Exit(1)
+	}
+	return cfiles, filepath.Join(dir, out.Main), linkFlags(out), nil
+}
+
+// loadModules: 读取所有输入；目录展开为其中的 *.py（没有时为 *.json）。返回按输入顺序排列的模块，以及模块名 -> 输入文件
+func loadModules(args []string) ([]py2c.Module, map[string]string, error) {
+	files := []string{}
+	for _, a := range args {
+		if st, err := os.Stat(a); err == nil && st.IsDir() {
+			// 有 .py 源文件时直接翻译源文件，否则用其中的 AST JSON
+			matches, _ := filepath.Glob(filepath.Join(a, "*.py"))
+			if len(matches) == 0 {
+				matches, _ = filepath.Glob(filepath.Join(a, "*.json"))
+			}
+			sort.Strings(matches)
+			files = append(files, matches...)
+			continue
+		}
+		files = append(files, a)
+	}
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("no .py or AST files in %s", strings.Join(args, ", "))
+	}
+	modules := []py2c.Module{}
+	paths := map[string]string{}
+	for _, f := range files {
+		data, err := readInput(f)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", f, err)
+		}
+		name := py2c.ModuleName(f)
+		modules = append(modules, py2c.Module{Name: name, File: py2c.SourceFileOf(f), AST: data})
+		if paths[name] == "" {
+			paths[name] = f
+		}
+	}
+	return modules, paths, nil
+}
+
+// outputPath: -o 指定的文件，默认是输入文件换成 .c 扩展名（hello.py -> hello.c），-run 时在临时目录中；
+// 输入是标准输入（-）时默认写到标准输出
+func outputPath(input string) string {
+	if optOutput != "" {
+		return optOutput
+	}
+	if input == "-" {
+		if runDir != "" {
+			return filepath.Join(runDir, "stdin.c")
+		}
+		return "-"
+	}
+	if runDir != "" {
+		input = filepath.Join(runDir, filepath.Base(input))
+	}
+	return strings.TrimSuffix(input, filepath.Ext(input)) + ".c"
+}
+
+// buildAndRun: 编译 cfiles；-run 时在临时目录中生成可执行文件并运行，返回进程的退出码
+func buildAndRun(cfiles []string, exe string, libs []string, args []string) int {
+	if runDir != "" {
+		defer os.RemoveAll(runDir)
+		exe = filepath.Join(runDir, filepath.Base(exe))
+	}
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	if err := compileC(cfiles, exe, libs); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if !optRun {
+		return 0
+	}
+	// 程序的输入输出直接转发，退出码原样返回
+	cmd := exec.Command(exe, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if ee, ok := err.(*exec.ExitError); ok && ee.ExitCode() >= 0 {
+			return ee.ExitCode()
+		}
+		fmt.Fprintf(os.Stderr, "Error running %s: %v\n", exe, err)
+		return 1
+	}
+	return 0
+}
+
+// linkFlags: 链接 out 需要的库：用到 <math.h> 时 -lm，以及 ctypes 载入的库
+func linkFlags(out py2c.Output) []string {
+	libs := []string{}
+	if out.UsesMath {
+		libs = append(libs, "-lm")
+	}
+	for _, l := range out.Libraries {
+		if l != "m" || !out.UsesMath {
+			libs = append(libs, "-l"+l)
+		}
+	}
+	return libs
+}
+
+// compileC: 用 -cc 的编译器（默认 $CC，否则 cc、gcc、clang）编译，链接 libs（linkFlags）
+func compileC(cfiles []string, exe string, libs []string) error {
+	cc := optCC
+	if cc == "" {
+		cc = os.Getenv("CC")
+	}
+	for _, c := range []string{"cc", "gcc", "clang"} {
+		if cc != "" {
+			break
+		}
+		if _, err := exec.LookPath(c); err == nil {
+			cc = c
+		}
+	}
+	if cc == "" {
+		return fmt.Errorf("no C compiler found (cc, gcc or clang); choose one with -cc")
+	}
+	args := append(strings.Fields(optCFlags), "-o", exe)
+	args = append(args, cfiles...)
+	args = append(args, libs...)
+	logf(logInfo, "%s %s", cc, strings.Join(args, " "))
+	cmd := exec.Command(cc, args...)
+	// 编译器的诊断信息写到 stderr，不和程序的输出混在一起
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %v", cc, err)
+	}
+	return nil
+}
+
+// writeRenames: 改名的标识符在 info 级别列出，-rename-map 时写成 JSON
+func writeRenames(renames []py2c.Rename) error {
+	for _, r := range renames {
+		logf(logInfo, "renamed %s to %s (%s)", r.Python, r.C, r.Reason)
+	}
+	if optRenameMap == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(append([]py2c.Rename{}, renames...), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(optRenameMap, append(data, '\n'), 0644)
+}
+
+// writeCoverage: -coverage 时写出覆盖率：- 为 stderr 上的文字，.json 为 JSON，否则为文字
+func writeCoverage(c py2c.Coverage) error {
+	if optCoverage == "" {
+		return nil
+	}
+	var data []byte
+	if strings.HasSuffix(optCoverage, ".json") {
+		var err error
+		if data, err = json.MarshalIndent(c, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	} else {
+		data = []byte(coverageText(c))
+	}
+	if optCoverage == "-" {
+		_, err := os.Stderr.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(optCoverage, data, 0644)
+}
+
+// coverageText: 覆盖率的文字报告：总计、按次数排列的节点类型、每一处没有翻译的代码
+func coverageText(c py2c.Coverage) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "translation coverage: %d of %s translated (%.1f%%)\n", c.Translated, plural(c.Statements, "statement"), c.Percent)
+	if len(c.Dropped) == 0 {
+		return b.String()
+	}
+	nodes := []string{}
+	for n := range c.ByNode {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if c.ByNode[nodes[i]] != c.ByNode[nodes[j]] {
+			return c.ByNode[nodes[i]] > c.ByNode[nodes[j]]
+		}
+		return nodes[i] < nodes[j]
+	})
+	parts := []string{}
+	for _, n := range nodes {
+		parts = append(parts, fmt.Sprintf("%s %d", n, c.ByNode[n]))
+	}
+	fmt.Fprintf(&b, "not translated: %s\n", strings.Join(parts, ", "))
+	for _, d := range c.Dropped {
+		if d.Line > 0 {
+			fmt.Fprintf(&b, "  %s:%d:%d: %s\n", d.File, d.Line, d.Col, d.Message)
+		} else {
+			fmt.Fprintf(&b, "  %s: %s\n", d.File, d.Message)
+		}
+	}
+	return b.String()
+}
+
+// writeOutput: 写出生成的 C 代码，"-" 表示标准输出；有 -clang-format 时先经 clang-format 重排
+func writeOutput(path, src string) error {
+	if optClangFormat != "" {
+		formatted, err := clangFormat(path, src)
+		if err != nil {
+			return err
+		}
+		src = formatted
+	}
+	if path == "-" {
+		_, err := os.Stdout.WriteString(src)
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(src), 0644)
+}
+
+// clangFormat: 用 clang-format 按 -clang-format 的风格重排 src；path 决定 clang-format 按 C 还是头文件处理，
+// 以及 -clang-format file 时从哪个目录开始找 .clang-format
+func clangFormat(path, src string) (string, error) {
+	name := path
+	if path == "-" {
+		name = "stdout.c"
+	}
+	cmd := exec.Command("clang-format", "--style="+optClangFormat, "--assume-filename="+name)
+	cmd.Stdin = strings.NewReader(src)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	formatted, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("clang-format failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return string(formatted), nil
+}
+
+// --- 日志 ---
+// 诊断信息写到 stderr，低于 -log-level 的不输出
+const (
+	logError = iota
+	logWarn
+	logInfo
+	logDebug
+)
+
+var logLevel = logWarn
+var logLevelNames = []string{"error", "warn", "info", "debug"}
+
+// logLevelOf: 级别名对应的级别，未知的名字返回 -1
+func logLevelOf(name string) int {
+	for i, n := range logLevelNames {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// logf: 输出一条 level 级别的诊断信息
+func logf(level int, format string, args ...interface{}) {
+	if level > logLevel {
+		return
+	}
+	prefix := []string{"Error: ", "Warning: ", "", "[DEBUG] "}[level]
+	fmt.Fprintf(os.Stderr, prefix+format+"\n", args...)
+}
+
+// printDiagnostics: 输出翻译诊断（已按源码位置排序；json 时总是输出一个数组）；返回 -strict 是否要求失败
+func printDiagnostics(diags []py2c.Diagnostic) bool {
+	errors, warnings := 0, 0
+	for _, d := range diags {
+		if d.Severity == "error" {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+	if optDiagFormat == "json" {
+		if diags == nil {
+			diags = []py2c.Diagnostic{}
+		}
+		out, _ := json.MarshalIndent(diags, "", "  ")
+		fmt.Fprintf(os.Stderr, "%s\n", out)
+	} else {
+		for _, d := range diags {
+			if d.Severity == "warning" && logLevel < logWarn {
+				continue
+			}
+			if d.Line > 0 {
+				fmt.Fprintf(os.Stderr, "%s:%d:%d: %s: %s\n", d.File, d.Line, d.Col, d.Severity, d.Message)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: %s: %s\n", d.File, d.Severity, d.Message)
+			}
+		}
+		parts := []string{}
+		if errors > 0 {
+			note := " (untranslated code is left as comments in the output)"
+			if optFailUnsupported {
+				note = " (no output written)"
+			} else if opts.StubUnsupported {
+				note = " (untranslated code aborts with NOT IMPLEMENTED when it is reached)"
+			}
+			parts = append(parts, plural(errors, "error")+note)
+		}
+		if warnings > 0 && logLevel >= logWarn {
+			parts = append(parts, plural(warnings, "warning"))
+		}
+		if len(parts) > 0 {
+			fmt.Fprintf(os.Stderr, "%s\n", strings.Join(parts, ", "))
+		}
+	}
+	if optStrict && errors > 0 {
+		logf(logError, "-strict: %s", plural(errors, "error"))
+		return true
+	}
+	return false
+}
+
+// unsupportedFailure: -fail-on-unsupported 时，有不能翻译的代码则返回列出这些节点类型与位置的错误
+func unsupportedFailure(diags []py2c.Diagnostic) error {
+	if !optFailUnsupported {
+		return nil
+	}
+	types := []string{}
+	where := map[string][]string{}
+	for _, d := range diags {
+		if d.Severity != "error" {
+			continue
+		}
+		if where[d.Node] == nil {
+			types = append(types, d.Node)
+		}
+		where[d.Node] = append(where[d.Node], fmt.Sprintf("%s:%d:%d", d.File, d.Line, d.Col))
+	}
+	if len(types) == 0 {
+		return nil
+	}
+	list := []string{}
+	for _, t := range types {
+		list = append(list, fmt.Sprintf("%s (%s)", t, strings.Join(where[t], ", ")))
+	}
+	return fmt.Errorf("-fail-on-unsupported: nothing written, cannot translate %s", strings.Join(list, "; "))
+}
+
+// plural: "1 warning"、"2 warnings"
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// readInput: 读取 py2ast.py 输出的 AST JSON；.py 文件先交给 Python 解析
+func readInput(filename string) ([]byte, error) {
+	if strings.HasSuffix(filename, ".py") {
+		return pythonAST(filename)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %v", err)
+	}
+	return data, nil
+}
+
+// openInput: 打开 py2ast.py 输出的 AST JSON（或 ast.dump() 的文本），翻译时边读边解析；.py 文件先交给 Python 解析，- 是标准输入
+func openInput(filename string) (io.ReadCloser, error) {
+	if filename == "-" {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	if strings.HasSuffix(filename, ".py") {
+		data, err := pythonAST(filename)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %v", err)
+	}
+	return f, nil
+}
+
+// runStats: -stats 的统计：读入的字节数、开始的时间与定时采样的堆内存峰值
+type runStats struct {
+	start time.Time
+	input int64
+	peak  uint64 // 只由采样的 goroutine 写，done 关闭之后才读
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// startStats: -stats 时开始统计，否则返回 nil（方法对 nil 什么也不做）
+func startStats() *runStats {
+	if !optStats {
+		return nil
+	}
+	s := &runStats{start: time.Now(), stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		tick := time.NewTicker(10 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			if m.HeapInuse > s.peak {
+				s.peak = m.HeapInuse
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-tick.C:
+			}
+		}
+	}()
+	return s
+}
+
+// reader: 数出从 r 读入的字节
+func (s *runStats) reader(r io.Reader) io.Reader {
+	if s == nil {
+		return r
+	}
+	return &countingReader{r, &s.input}
+}
+
+func (s *runStats) add(n int) {
+	if s != nil {
+		s.input += int64(n)
+	}
+}
+
+// report: 停止采样，输出统计
+func (s *runStats) report() {
+	if s == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	fmt.Fprintf(os.Stderr, "stats: read %s of AST JSON, translated in %.2fs, peak heap %s (%s obtained from the OS)\n",
+		megabytes(uint64(s.input)), time.Since(s.start).Seconds(), megabytes(s.peak), megabytes(m.Sys))
+}
+
+// countingReader: 把读入的字节数加到 n
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// megabytes: 字节数写成 MB
+func megabytes(n uint64) string {
+	return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+}
+
+// pythonAST: 用 Python 的 ast 模块解析 .py 文件，返回与 py2ast.py 相同的 JSON
+func pythonAST(filename string) ([]byte, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return nil, fmt.Errorf("reading file: %v", err)
+	}
+	python := pythonInterpreter()
+	var stderr bytes.Buffer
+	cmd := exec.Command(python, "-c", py2c.DumpScript, "--compact", filename)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("parsing %s: %s", filename, msg)
+		}
+		return nil, fmt.Errorf("running %s to parse %s: %v (use -python to choose the interpreter)", python, filename, err)
+	}
+	return out, nil
+}
+
+// pythonInterpreter: -python 指定的解释器，默认 python3，找不到时用 python
+func pythonInterpreter() string {
+	if optPython != "" {
+		return optPython
+	}
+	if _, err := exec.LookPath("python3"); err != nil {
+		return "python"
+	}
+	return "python3"
+}
+
+// loadNameMap: -identifiers pinyin 时用 pypinyin 把 AST 中的非 ASCII 名字转为拼音，再加上 -name-map 文件中的名字（优先）
+func loadNameMap(asts ...[]byte) error {
+	names := map[string]string{}
+	if optIdentifiers == "pinyin" {
+		pinyin, err := pinyinNames(asts)
+		if err != nil {
+			return err
+		}
+		names = pinyin
+	}
+	if optNameMap != "" {
+		data, err := ioutil.ReadFile(optNameMap)
+		if err != nil {
+			return err
+		}
+		given := map[string]string{}
+		if err := json.Unmarshal(data, &given); err != nil {
+			return fmt.Errorf("%s: %v (want a JSON object from Python names to C names)", optNameMap, err)
+		}
+		for py, c := range given {
+			names[py] = c
+		}
+	}
+	if len(names) > 0 {
+		opts.NameMap = names
+	}
+	return nil
+}
+
+// pinyinNames: AST 中非 ASCII 的名字 -> 拼音（总数 -> zong_shu）；不能转成 C 名字的（其他文字）不在结果中，仍为 _uXXXX
+func pinyinNames(asts [][]byte) (map[string]string, error) {
+	found := map[string]bool{}
+	var visit func(node interface{})
+	visit = func(node interface{}) {
+		switch n := node.(type) {
+		case []interface{}:
+			for _, e := range n {
+				visit(e)
+			}
+		case map[string]interface{}:
+			for k, v := range n {
+				if s, ok := v.(string); ok && (k == "id" || k == "arg" || k == "name" || k == "attr") && strings.IndexFunc(s, func(r rune) bool { return r > 127 }) >= 0 {
+					found[s] = true
+				}
+				visit(v)
+			}
+		}
+	}
+	for _, data := range asts {
+		var root interface{}
+		if err := json.Unmarshal(data, &root); err != nil {
+			return nil, fmt.Errorf("invalid AST: %v", err)
+		}
+		visit(root)
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+	list := []string{}
+	for name := range found {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	in, _ := json.Marshal(list)
+	var stderr bytes.Buffer
+	cmd := exec.Command(pythonInterpreter(), "-c", pinyinScript)
+	cmd.Stdin, cmd.Stderr = bytes.NewReader(in), &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("-identifiers pinyin: %s", msg)
+		}
+		return nil, fmt.Errorf("-identifiers pinyin: running %s: %v (use -python to choose the interpreter)", pythonInterpreter(), err)
+	}
+	raw := map[string]string{}
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return nil, fmt.Errorf("-identifiers pinyin: %v", err)
+	}
+	names := map[string]string{}
+	for py, c := range raw {
+		c = strings.Trim(nonIdentChars.ReplaceAllString(strings.ToLower(c), "_"), "_")
+		if c != "" && (c[0] < '0' || c[0] > '9') {
+			names[py] = c
+		}
+	}
+	return names, nil
+}
+
+// nonIdentChars: 拼音结果中不能出现在 C 名字里的字符（连续的算一个）
+var nonIdentChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// pinyinScript: 从标准输入读名字列表，输出 名字 -> 以 _ 连接的拼音；非中文的部分原样保留
+const pinyinScript = `import json, sys
+try:
+    from pypinyin import lazy_pinyin
+except ImportError:
+    sys.exit("needs the pypinyin package (pip install pypinyin)")
+names = json.load(sys.stdin)
+print(json.dumps({n: "_".join(lazy_pinyin(n)) for n in names}))
+`
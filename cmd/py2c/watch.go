@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// -watch：输入改变时重新运行同一条命令（去掉 -watch），适合一个函数一个函数地移植。
+// 每次都在子进程中运行，翻译、-cc 编译与 -run 运行的程序都与单独运行时相同；
+// 诊断与上一次运行相比，列出新出现的与已经解决的（按文件、级别与内容，不按行号：编辑会让后面的行移动）
+
+// watchInterval: 检查输入文件的间隔
+const watchInterval = 300 * time.Millisecond
+
+// diagLineRe: -diag-format text 的一条诊断 file:line:col: severity: message
+var diagLineRe = regexp.MustCompile(`^(.+?):\d+:\d+: (error|warning): (.*)$`)
+
+// watch: 输入改变时重新运行，不会返回（Ctrl-C 结束）
+func watch(inputs, progArgs []string) {
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -watch: %v\n", err)
+		os.Exit(1)
+	}
+	// 子进程的参数：命令行上设置过的选项（-watch 除外），然后是输入与 -- 之后的程序参数
+	args := []string{}
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "watch" {
+			args = append(args, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+	args = append(args, inputs...)
+	if len(progArgs) > 0 {
+		args = append(append(args, "--"), progArgs...)
+	}
+	var last map[string]int
+	stamp := ""
+	for {
+		files := watchedFiles(inputs)
+		if s := fileStamps(files); s != stamp {
+			if stamp != "" {
+				// 编辑器保存时可能分几次写：等文件不再变化
+				for time.Sleep(watchInterval); fileStamps(files) != s; time.Sleep(watchInterval) {
+					s = fileStamps(files)
+				}
+			}
+			stamp = s
+			fmt.Fprintf(os.Stderr, "watch: [%s] translating %s\n", time.Now().Format("15:04:05"), strings.Join(inputs, " "))
+			last = watchRun(exe, args, last)
+			fmt.Fprintf(os.Stderr, "watch: waiting for changes to %d files (Ctrl-C to stop)\n", len(files))
+		}
+		time.Sleep(watchInterval)
+	}
+}
+
+// watchedFiles: 输入文件（目录为其中的 .py 与 .json），以及 -source、-name-map、-extern-map 与 -map 的文件；每次重新列出，目录中可以增删模块
+func watchedFiles(inputs []string) []string {
+	files := []string{}
+	for _, in := range inputs {
+		if st, err := os.Stat(in); err == nil && st.IsDir() {
+			for _, pattern := range []string{"*.py", "*.json"} {
+				matches, _ := filepath.Glob(filepath.Join(in, pattern))
+				files = append(files, matches...)
+			}
+			continue
+		}
+		files = append(files, in)
+	}
+	for _, f := range []string{optSource, optNameMap, optExternMap, optCallMap} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// fileStamps: 各文件的修改时间与大小，有文件改变时结果不同
+func fileStamps(files []string) string {
+	var b strings.Builder
+	for _, f := range files {
+		if st, err := os.Stat(f); err == nil {
+			fmt.Fprintf(&b, "%s %d %d\n", f, st.ModTime().UnixNano(), st.Size())
+		} else {
+			fmt.Fprintf(&b, "%s missing\n", f)
+		}
+	}
+	return b.String()
+}
+
+// watchRun: 运行一次，stderr 照常输出并从中收集诊断；与上一次（last，第一次为 nil）相比输出新出现与已解决的诊断数
+func watchRun(exe string, args []string, last map[string]int) map[string]int {
+	cmd := exec.Command(exe, args...)
+	cmd.Stdin, cmd.Stdout = os.Stdin, os.Stdout
+	stderr, err := cmd.StderrPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "watch: %v\n", err)
+		return last
+	}
+	diags := map[string]int{}
+	scanner := bufio.NewScanner(stderr)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fmt.Fprintln(os.Stderr, line)
+		if m := diagLineRe.FindStringSubmatch(line); m != nil {
+			diags[m[1]+": "+m[2]+": "+m[3]]++
+		}
+	}
+	status := "ok"
+	if err := cmd.Wait(); err != nil {
+		status = err.Error()
+	}
+	if last == nil {
+		fmt.Fprintf(os.Stderr, "watch: %s\n", status)
+		return diags
+	}
+	added, fixed := 0, []string{}
+	for d := range diags {
+		if n := diags[d] - last[d]; n > 0 {
+			added += n
+		}
+	}
+	for _, d := range sortedDiags(last) {
+		for n := last[d] - diags[d]; n > 0; n-- {
+			fixed = append(fixed, d)
+		}
+	}
+	for _, d := range fixed {
+		fmt.Fprintf(os.Stderr, "watch: fixed: %s\n", d)
+	}
+	fmt.Fprintf(os.Stderr, "watch: %s; %d new and %d fixed diagnostics since the last run\n", status, added, len(fixed))
+	return diags
+}
+
+// sortedDiags: 按内容排序的诊断
+func sortedDiags(diags map[string]int) []string {
+	keys := []string{}
+	for d := range diags {
+		keys = append(keys, d)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// -map 文件可以是 JSON，也可以是 YAML 的一个子集（不引入依赖）：缩进的映射与 - 列表、[a, b] 形式的列表、
+// 单引号与双引号字符串、# 注释。值都是字符串；不支持多行字符串（| 与 >）、{a: b} 形式的映射、锚点与多个文档
+
+// yamlLine: 去掉注释与缩进之后的一行
+type yamlLine struct {
+	no     int // 行号，从 1 开始
+	indent int
+	text   string
+}
+
+// yamlParser: 按缩进的递归下降解析
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// parseYAML: 解析为 map[string]interface{}、[]interface{} 与 string 组成的值
+func parseYAML(data []byte) (interface{}, error) {
+	p := &yamlParser{}
+	for i, l := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		text := yamlStripComment(l)
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.TrimSpace(trimmed) == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs cannot indent YAML", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{i + 1, len(text) - len(trimmed), strings.TrimRight(trimmed, " \t")})
+	}
+	if len(p.lines) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	v, err := p.block(p.lines[0].indent)
+	if err == nil && p.pos < len(p.lines) {
+		err = fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].no)
+	}
+	return v, err
+}
+
+// yamlStripComment: 去掉引号之外、行首或空白之后的 # 注释
+func yamlStripComment(l string) string {
+	var quote byte
+	for i := 0; i < len(l); i++ {
+		switch c := l[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '#' && (i == 0 || l[i-1] == ' ' || l[i-1] == '\t'):
+			return l[:i]
+		}
+	}
+	return l
+}
+
+// block: 从当前行开始、缩进为 indent 的映射或列表
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	if l := p.lines[p.pos]; l.text == "-" || strings.HasPrefix(l.text, "- ") {
+		return p.list(indent, false)
+	}
+	return p.mapping(indent)
+}
+
+// list: keyed 为列表与它的键缩进相同（key:\n- a），这时遇到下一个键就结束
+func (p *yamlParser) list(indent int, keyed bool) (interface{}, error) {
+	items := []interface{}{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		l := p.lines[p.pos]
+		if l.text != "-" && !strings.HasPrefix(l.text, "- ") {
+			if keyed {
+				break
+			}
+			return nil, fmt.Errorf("line %d: expected a list item (- ...)", l.no)
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		if rest == "" {
+			// - 之后的值在下面更深的缩进中
+			p.pos++
+			if p.pos >= len(p.lines) || p.lines[p.pos].indent <= indent {
+				items = append(items, "")
+				continue
+			}
+			v, err := p.block(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+			continue
+		}
+		if _, _, ok := yamlKey(rest); ok {
+			// - key: value 开始一个映射，其余的键与 key 对齐
+			p.lines[p.pos] = yamlLine{l.no, indent + len(l.text) - len(rest), rest}
+			v, err := p.mapping(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+			continue
+		}
+		v, err := yamlScalar(rest, l.no)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+		p.pos++
+	}
+	return items, nil
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	m := map[string]interface{}{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		l := p.lines[p.pos]
+		key, rest, ok := yamlKey(l.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", l.no)
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("line %d: %s is given twice", l.no, key)
+		}
+		p.pos++
+		if rest != "" {
+			v, err := yamlScalar(rest, l.no)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+			continue
+		}
+		if next := p.pos; next < len(p.lines) && p.lines[next].indent == indent && (p.lines[next].text == "-" || strings.HasPrefix(p.lines[next].text, "- ")) {
+			v, err := p.list(indent, true)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+			continue
+		}
+		if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+			v, err := p.block(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+			continue
+		}
+		m[key] = ""
+	}
+	return m, nil
+}
+
+// yamlKey: key: value 中的键与值（值可以为空）；键可以加引号
+func yamlKey(text string) (string, string, bool) {
+	if text[0] == '"' || text[0] == '\'' {
+		end := yamlQuoteEnd(text)
+		if end < 0 || end+1 >= len(text) || text[end+1] != ':' {
+			return "", "", false
+		}
+		key, err := yamlScalar(text[:end+1], 0)
+		if err != nil {
+			return "", "", false
+		}
+		return key.(string), strings.TrimSpace(text[end+2:]), true
+	}
+	if strings.HasSuffix(text, ":") && !strings.HasPrefix(text, "[") {
+		return strings.TrimSpace(text[:len(text)-1]), "", true
+	}
+	if i := strings.Index(text, ": "); i > 0 && !strings.HasPrefix(text, "[") {
+		return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+2:]), true
+	}
+	return "", "", false
+}
+
+// yamlQuoteEnd: text 开头的引号字符串的结尾引号的位置，没有结尾时为 -1
+func yamlQuoteEnd(text string) int {
+	q := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case q == '"' && text[i] == '\\':
+			i++
+		case text[i] == q && q == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++ // '' 是单引号
+		case text[i] == q:
+			return i
+		}
+	}
+	return -1
+}
+
+// yamlScalar: 一个值：引号字符串、[a, b] 列表或者原样的文字
+func yamlScalar(text string, no int) (interface{}, error) {
+	if text[0] == '"' || text[0] == '\'' {
+		if yamlQuoteEnd(text) < 0 {
+			return nil, fmt.Errorf("line %d: no closing quote in %s", no, text)
+		}
+	}
+	switch text[0] {
+	case '"':
+		if yamlQuoteEnd(text) != len(text)-1 {
+			return nil, fmt.Errorf("line %d: text after the closing quote", no)
+		}
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v in %s", no, err, text)
+		}
+		return s, nil
+	case '\'':
+		if yamlQuoteEnd(text) != len(text)-1 {
+			return nil, fmt.Errorf("line %d: text after the closing quote", no)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case '[':
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("line %d: a [ list must end on the same line", no)
+		}
+		items := []interface{}{}
+		for _, part := range yamlSplitFlow(text[1 : len(text)-1]) {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			v, err := yamlScalar(part, no)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	case '{', '|', '>', '&', '*':
+		return nil, fmt.Errorf("line %d: %q values are not supported; quote the text", no, text[0])
+	}
+	return text, nil
+}
+
+// yamlSplitFlow: 按引号与括号之外的逗号分开
+func yamlSplitFlow(text string) []string {
+	parts := []string{}
+	depth, start := 0, 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"', '\'':
+			if end := yamlQuoteEnd(text[i:]); end > 0 {
+				i += end
+			}
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, text[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, text[start:])
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	for _, c := range []struct {
+		name, src string
+		want      interface{}
+	}{
+		{"empty", "# nothing\n\n---\n", map[string]interface{}{}},
+		{"scalars", "a: 1\nb: x y\nc:\n", map[string]interface{}{"a": "1", "b": "x y", "c": ""}},
+		{"quoted colon and hash", "a: \"x: y # z\"\nb: 'it''s #1: ok'\n\"c: d\": e\n",
+			map[string]interface{}{"a": "x: y # z", "b": "it's #1: ok", "c: d": "e"}},
+		{"escapes", `a: "tab\tquote\" end"`, map[string]interface{}{"a": "tab\tquote\" end"}},
+		{"unquoted colon", "url: http://host:80/x\nk: a: b\n", map[string]interface{}{"url": "http://host:80/x", "k": "a: b"}},
+		{"comments", "# head\na: b # trailing\nc: d#e\n  # indented comment\nf: g\n",
+			map[string]interface{}{"a": "b", "c": "d#e", "f": "g"}},
+		{"flow list", "xs: [a, \"b, c\", 'd]', [e, f], ]\nys: []\n", map[string]interface{}{
+			"xs": []interface{}{"a", "b, c", "d]", []interface{}{"e", "f"}}, "ys": []interface{}{}}},
+		{"nested mappings", "math:\n  sqrt:\n    c: sqrt\n    header: math.h\n  pi: M_PI\nother: x\n", map[string]interface{}{
+			"math":  map[string]interface{}{"sqrt": map[string]interface{}{"c": "sqrt", "header": "math.h"}, "pi": "M_PI"},
+			"other": "x"}},
+		{"block list", "libs:\n  - m\n  - \"pthread\"\n  -\nx: y\n", map[string]interface{}{"libs": []interface{}{"m", "pthread", ""}, "x": "y"}},
+		{"list item after a mapping", "libs: m\n- z\n", nil},
+		{"list at key indent", "libs:\n- m\n- z\nn: 1\n", map[string]interface{}{"libs": []interface{}{"m", "z"}, "n": "1"}},
+		{"list of mappings", "- name: a\n  c: f\n- name: b\n-\n  - x\n", []interface{}{
+			map[string]interface{}{"name": "a", "c": "f"}, map[string]interface{}{"name": "b"}, []interface{}{"x"}}},
+		{"crlf", "a: b\r\nc: d\r\n", map[string]interface{}{"a": "b", "c": "d"}},
+	} {
+		got, err := parseYAML([]byte(c.src))
+		if c.want == nil {
+			if err == nil {
+				t.Errorf("%s: parsed as %v, want an error", c.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		} else if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %#v, want %#v", c.name, got, c.want)
+		}
+	}
+}
+
+// 错误信息带出错的行号
+func TestParseYAMLErrors(t *testing.T) {
+	for _, c := range []struct{ src, want string }{
+		{"a: b\n\tc: d\n", "line 2: tabs cannot indent YAML"},
+		{"a: b\na: c\n", "line 2: a is given twice"},
+		{"a: b\n    c: d\n", "line 2: unexpected indentation"},
+		{"a:\n  - x\n  y: z\n", "line 3: expected a list item (- ...)"},
+		{"a: b\njust text\n", "line 2: expected key: value"},
+		{"# c\na: \"open\n", `line 2: no closing quote in "open`},
+		{"a: [x, 'y]\n", `line 1: no closing quote in 'y`},
+		{"a: 'x' y\n", "line 1: text after the closing quote"},
+		{"a: [x, y\n", "line 1: a [ list must end on the same line"},
+		{"\na: {b: c}\n", `line 2: '{' values are not supported; quote the text`},
+		{"a: |\n  text\n", `line 1: '|' values are not supported; quote the text`},
+	} {
+		_, err := parseYAML([]byte(c.src))
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%q: error %v, want %q", c.src, err, c.want)
+		}
+	}
+}
+
+// -map 的 YAML 与同样内容的 JSON 读出来相同；YAML 的错误带文件名与行号
+func TestLoadCallMap(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, text string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	yml := write("calls.yaml", `# fast paths
+mylib.clamp:
+  c: "clamp_i({x}, {lo}, {hi})"   # a template with braces
+  params: [x, "lo=0", hi=100]
+  includes:
+    - '"mylib.h"'
+  returns: int
+`)
+	js := write("calls.json", `{"mylib.clamp": {"c": "clamp_i({x}, {lo}, {hi})", "params": ["x", "lo=0", "hi=100"], "includes": ["\"mylib.h\""], "returns": "int"}}`)
+	a, err := loadCallMap(yml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := loadCallMap(js)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("YAML %+v, JSON %+v", a, b)
+	}
+	bad := write("bad.yaml", "mylib.f:\n  c: f()\n  c: g()\n")
+	if _, err := loadCallMap(bad); err == nil || err.Error() != bad+": line 3: c is given twice" {
+		t.Errorf("error %v, want the file and line 3", err)
+	}
+	unknown := write("unknown.yaml", "mylib.f:\n  call: f()\n")
+	if _, err := loadCallMap(unknown); err == nil || !strings.Contains(err.Error(), "call") {
+		t.Errorf("unknown field: error %v", err)
+	}
+}
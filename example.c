@@ -2,39 +2,40 @@
 
 typedef struct {
     char* name;
-    double score;
+    int score;
 } Person;
+// impure: mutates self
 void Person___init__(Person* self, char* name) {
-        self->name = name;
-        self->score = 100;
+    self->name = name;
+    self->score = 100;
 }
+// impure: performs I/O (print)
 void Person_say(Person* self) {
-        printf("%s\n", self->name);
-
+    printf("%s\n", self->name);
 }
-double Person_best_score(Person* self) {
-        return self->score;
+// pure: no I/O or global writes
+int Person_best_score(Person* self) {
+    return self->score;
+}
+// pure: no I/O or global writes
+void add(int x, int y, int* result) {
+    *result = (x + y);
+}
+// impure: performs I/O (print)
+void greet(char* name) {
+    printf("%s %s\n", "Hello,", name);
 }
-    void add(double x, double y, double* result) {
-        *result = (x + y);
-    }
-    void greet(char* name) {
-        printf("%s %s\n", "Hello,", name);
-
-    }
 int main() {
-greet("World");
-    double a = 3;
-    double b = 4;
-    double c;
+    greet("World");
+    int a = 3;
+    int b = 4;
+    int c;
     add(a, b, &c);
-    printf("%f %f %f\n", a, b, c);
-;
+    printf("%d %d %d\n", a, b, c);
     Person p;
     Person___init__(&p, "Tom");
-Person_say(&p);
-    printf("%s %s\n", "Best score:", Person_best_score(&p));
-;
+    Person_say(&p);
+    printf("%s %d\n", "Best score:", Person_best_score(&p));
     for (int i = 0; i < 5; i++) {
         if (i == 2) {
             continue;
@@ -42,12 +43,10 @@ Person_say(&p);
         if (i == 4) {
             break;
         }
-        printf("%f\n", i);
-
+        printf("%d\n", i);
     }
     if (a > 1) {
         printf("%s\n", "a in range");
-
     }
     else {
         // pass
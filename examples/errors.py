@@ -0,0 +1,31 @@
+class InsufficientFunds(Exception):
+    pass
+
+
+def withdraw(balance: int, amount: int) -> int:
+    if amount > balance:
+        raise InsufficientFunds("balance too low")
+    return balance - amount
+
+
+def attempt(balance: int, amount: int) -> int:
+    try:
+        left = withdraw(balance, amount)
+        print("withdrew", amount, "left", left)
+        return left
+    except InsufficientFunds as e:
+        print("refused", amount, e)
+    return balance
+
+
+def main():
+    balance = attempt(100, 30)
+    balance = attempt(balance, 50)
+    balance = attempt(balance, 40)
+    try:
+        int("12x")
+    except ValueError:
+        print("not a number")
+
+
+main()
@@ -0,0 +1,45 @@
+class Point:
+    def __init__(self, x: int, y: int):
+        self.x = x
+        self.y = y
+
+    @classmethod
+    def make(cls, v: int):
+        return cls(v, v)
+
+    @classmethod
+    def pick(cls, v: int):
+        if v > 0:
+            return cls(v, 0)
+        return cls(0, v)
+
+    @staticmethod
+    def origin():
+        return Point(0, 0)
+
+    @staticmethod
+    def add(a, b):
+        s = Point(a.x + b.x, a.y + b.y)
+        return s
+
+    def norm1(self) -> int:
+        return abs(self.x) + abs(self.y)
+
+    def moved(self, d: int):
+        return Point(self.x + d, self.y - d)
+
+
+def main():
+    p = Point.make(3)
+    print(p.x, p.y, p.norm1())
+    o = Point.origin()
+    print(o.x, o.y, o.norm1())
+    print(Point.make(2).norm1(), Point.pick(-4).y, Point.pick(5).x)
+    s = Point.add(p, Point.make(4))
+    print(s.x, s.y)
+    print(p.moved(2).moved(1).norm1())
+    for q in [Point.make(1), Point.origin(), o.moved(7)]:
+        print(q.norm1())
+
+
+main()
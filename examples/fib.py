@@ -0,0 +1,16 @@
+def fib(n: int) -> int:
+    if n < 2:
+        return n
+    return fib(n - 1) + fib(n - 2)
+
+
+def main():
+    total = 0
+    for i in range(10):
+        f = fib(i)
+        total = total + f
+        print(i, f)
+    print("total:", int(total))
+
+
+main()
@@ -0,0 +1,27 @@
+class Shape:
+    def __init__(self, size: int):
+        self.size = size
+
+    def get_size(self):
+        return self.size
+
+
+class Big(Shape):
+    def get_size(self):
+        return self.size * 10
+
+
+class Plain(Shape):
+    pass
+
+
+def show(s: Shape):
+    print(s.get_size())
+
+
+show(Shape(2))
+show(Big(2))
+p = Plain(3)
+print(p.get_size())
+b = Big(4)
+print(b.get_size())
@@ -0,0 +1,48 @@
+class Item:
+    def __init__(self, name: str, n: int):
+        self.name = name
+        self.n = n
+
+
+def evens(k: int):
+    out = []
+    for i in range(k):
+        if i % 2 == 0:
+            out.append(i)
+    return out
+
+
+def words(s: str):
+    if s == "":
+        return []
+    return s.split()
+
+
+def shout(ws):
+    out = []
+    for w in ws:
+        out.append(w.upper())
+    return out
+
+
+def stock():
+    out = []
+    out.append(Item("nut", 3))
+    out.append(Item("bolt", 5))
+    return out
+
+
+def main():
+    e = evens(9)
+    print(len(e), e[1], e)
+    w = words("the quick brown fox")
+    print(len(w), w[2], len(words("")))
+    print(shout(w))
+    names = []
+    for it in stock():
+        print(it.name, it.n)
+        names.append(it.name)
+    print("+".join(names))
+
+
+main()
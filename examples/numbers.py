@@ -0,0 +1,37 @@
+from typing import NamedTuple
+
+
+class Point(NamedTuple):
+    x: int
+    y: int
+
+
+def add(a: int, b: int) -> int:
+    return a + b
+
+
+def main():
+    s = "hello"
+    print(str(42), str(-3) + "!")
+    print(int("17") + 1)
+    n = len(s)
+    print(n + 1, -n, n * 2 % 3)
+    print(add(2, 3) * 2)
+    p = Point(1, 2)
+    print(p.x + p.y)
+    print(f"{7}", f"[{n + 1}]", f"{n:3d}|")
+    print(7, 2 * 3, 7 - 10)
+    count = 0
+    for i in range(5):
+        count = count + i
+    print("count:", count, abs(-count), round(2.6))
+    half = 0
+    half = half + 0.5
+    if half > 0.25:
+        print("half")
+    evens = [0, 2]
+    evens.append(4)
+    print(evens, len(evens), str(len(evens)))
+
+
+main()
@@ -0,0 +1,31 @@
+class Shape:
+    def __init__(self, name: str):
+        self.name = name
+
+    def area(self) -> float:
+        return 0.0
+
+
+class Rect(Shape):
+    def __init__(self, w: float, h: float):
+        super().__init__("rect")
+        self.w = w
+        self.h = h
+
+    def area(self) -> float:
+        return self.w * self.h
+
+
+class Square(Rect):
+    def __init__(self, side: float):
+        super().__init__(side, side)
+        self.name = "square"
+
+
+def main():
+    shapes = [Rect(2.0, 3.5), Square(4.0)]
+    for s in shapes:
+        print(f"{s.name}: {s.area():.2f}")
+
+
+main()
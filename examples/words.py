@@ -0,0 +1,13 @@
+def main():
+    words = "the quick brown fox jumps over the lazy dog".split()
+    longest = ""
+    for w in words:
+        if len(w) > len(longest):
+            longest = w
+    print("words:", len(words))
+    print("longest:", longest.upper())
+    print("first o at", "".join(words).find("o"))
+    print("joined:", "+".join(words))
+
+
+main()
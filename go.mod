@@ -0,0 +1,3 @@
+module github.com/lixiasky/Py2c
+
+go 1.18
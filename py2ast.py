@@ -1,26 +1,61 @@
+#!/usr/bin/env python3
+"""Dump the AST of a Python source file as the JSON that py2c translates.
+
+Usage: python3 py2ast.py [--compact] <python_source_file> > ast.json
+
+Written by "py2c dump-script"; runs on Python 3.7 and newer.
+"""
 import ast
 import json
 import sys
+import tokenize
+
 
 def ast_to_dict(node):
     if isinstance(node, ast.AST):
         result = {'_type': node.__class__.__name__}
         for field in node._fields:
-            result[field] = ast_to_dict(getattr(node, field))
+            result[field] = ast_to_dict(getattr(node, field, None))
+        # lineno, col_offset, end_lineno, end_col_offset: line numbers in diagnostics, #line and -annotate
         for attr in node._attributes:
             result[attr] = ast_to_dict(getattr(node, attr, None))
         return result
     elif isinstance(node, list):
         return [ast_to_dict(x) for x in node]
+    elif isinstance(node, bytes):
+        # b'...' (e.g. ctypes c_char_p arguments): the same bytes as a string, a char* in C
+        return node.decode('latin-1')
+    elif node is Ellipsis:
+        # '...' (e.g. the body of @overload stubs) has no JSON equivalent
+        return {'_type': 'Ellipsis'}
     else:
         return node
 
-if __name__ == '__main__':
-    if len(sys.argv) != 2:
-        print(f'Usage: python {sys.argv[0]} <python_source_file>', file=sys.stderr)
-        sys.exit(1)
-    with open(sys.argv[1], 'r', encoding='utf-8') as f:
+
+def main(argv):
+    compact = '--compact' in argv[1:]
+    args = [a for a in argv[1:] if a != '--compact']
+    if len(args) != 1:
+        sys.stderr.write('Usage: python3 %s [--compact] <python_source_file>\n' % argv[0])
+        return 2
+    # the encoding declared in the file (# -*- coding: ... -*-), UTF-8 otherwise
+    with tokenize.open(args[0]) as f:
         source = f.read()
-    tree = ast.parse(source, filename=sys.argv[1], mode='exec', type_comments=True)
+    # type_comments needs Python 3.8; py2c reads the ASTs of Python 3.7 to 3.13
+    kwargs = {'type_comments': True} if sys.version_info >= (3, 8) else {}
+    try:
+        tree = ast.parse(source, filename=args[0], mode='exec', **kwargs)
+    except SyntaxError as e:
+        sys.stderr.write('%s:%s:%s: SyntaxError: %s\n' % (e.filename, e.lineno, e.offset, e.msg))
+        return 1
     ast_dict = ast_to_dict(tree)
-    json.dump(ast_dict, sys.stdout, indent=2, ensure_ascii=False) 
\ No newline at end of file
+    # the node spellings differ between versions (Num or Constant, Index ...): tell py2c which one wrote this
+    ast_dict['python_version'] = '%d.%d.%d' % sys.version_info[:3]
+    # source text for py2c -annotate and -comments
+    ast_dict['source'] = source
+    json.dump(ast_dict, sys.stdout, indent=None if compact else 2, ensure_ascii=False)
+    return 0
+
+
+if __name__ == '__main__':
+    sys.exit(main(sys.argv))
@@ -0,0 +1,16 @@
+"""Markers read by the py2c translator; at run time in Python they do nothing.
+
+    import py2c
+
+    @py2c.extern("crc16_ccitt", header="crc.h")
+    def crc16(data: str, n: int) -> int:
+        ...  # or a Python version, used when the script runs under Python
+"""
+
+
+def extern(name=None, header=None):
+    """The function is implemented in C by `name` (the same name by default), declared in `header`."""
+    if callable(name):
+        # bare @py2c.extern
+        return name
+    return lambda func: func
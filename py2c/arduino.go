@@ -0,0 +1,178 @@
+package py2c
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// -profile arduino：生成 Arduino 草图用的 C 代码。顶层代码放到 setup()，最后的 while True: 循环体成为 loop()，
+// print 经 Serial.print 输出，time.sleep 换成 delay()。Serial 是 C++ 对象，
+// 由一起输出的 .ino（Output.Sketch）提供给 C 代码调用的 py_serial_begin / py_serial_print。
+
+// arduinoBaud: Serial.begin 的波特率
+const arduinoBaud = 9600
+
+// arduinoPreamble: C 代码中的 Serial 输出：print 格式化到小缓冲区后交给 .ino 中的 Serial.print
+const arduinoPreamble = `#include <Arduino.h>
+#include <stdarg.h>
+// Serial is a C++ object: these two are defined in the sketch (.ino)
+void py_serial_begin(void);
+void py_serial_print(const char* s);
+// print(): formatted into a small buffer and written with Serial.print
+static int py_serial_printf(const char* fmt, ...) {
+    char buf[64];
+    va_list ap;
+    va_start(ap, fmt);
+    int n = vsnprintf(buf, sizeof(buf), fmt, ap);
+    va_end(ap);
+    py_serial_print(buf);
+    return n;
+}
+`
+
+// arduinoSketch: 与 C 文件放在同一个草图目录中的 .ino，%s 为 C 文件名
+const arduinoSketch = `// generated by py2c: the program (setup and loop) is in %s; this file connects its output to Serial
+#include <Arduino.h>
+
+extern "C" void py_serial_begin(void) {
+    Serial.begin(%d);
+}
+
+extern "C" void py_serial_print(const char* s) {
+    Serial.print(s);
+}
+`
+
+// arduinoEmitter: Arduino 的后端：AVR 没有线程局部存储，错误信息也写到 Serial；其余由 -std 的后端输出
+type arduinoEmitter struct {
+	emitter
+}
+
+func (e arduinoEmitter) emitUnit(src string) string {
+	src = strings.ReplaceAll(src, "_Thread_local ", "")
+	src = strings.ReplaceAll(src, "fprintf(stderr, ", "py_serial_printf(")
+	return e.emitter.emitUnit(src)
+}
+
+// arduinoLoop: 顶层代码最后的 while True:（没有 else，循环体中没有 break / continue）作为 loop()，
+// 返回其余的顶层语句与这个循环，没有时 loop 为 nil
+func arduinoLoop(body []interface{}) (setup []interface{}, loop ASTNode) {
+	if len(body) == 0 {
+		return body, nil
+	}
+	last, _ := body[len(body)-1].(map[string]interface{})
+	if last["_type"] != "While" || !isTrueConstant(last["test"]) {
+		return body, nil
+	}
+	if orelse, _ := last["orelse"].([]interface{}); len(orelse) > 0 || loopControl(last["body"]) {
+		return body, nil
+	}
+	return body[:len(body)-1], last
+}
+
+// isTrueConstant: True 或非零的整数常量
+func isTrueConstant(node interface{}) bool {
+	m, _ := node.(map[string]interface{})
+	if m["_type"] != "Constant" {
+		return false
+	}
+	switch v := m["value"].(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	}
+	return false
+}
+
+// loopControl: 循环体中有属于这个循环的 break 或 continue（不进入嵌套的循环与函数）
+func loopControl(node interface{}) bool {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			if loopControl(e) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		switch n["_type"] {
+		case "Break", "Continue":
+			return true
+		case "For", "AsyncFor", "While":
+			// 嵌套循环的 else 仍属于外层循环
+			return loopControl(n["orelse"])
+		case "FunctionDef", "AsyncFunctionDef", "ClassDef", "Lambda":
+			return false
+		}
+		for _, v := range n {
+			if loopControl(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hoistGlobals: setup() 中声明的顶层变量在 loop() 中也要可见：声明改为文件作用域的 static 变量，
+// setup() 中只留下赋值。只处理函数体第一层的声明（块中的声明出了块本来就不可见）
+func (g *generator) hoistGlobals(setup string) (globals, code string) {
+	names := make([]string, 0, len(g.symtab.vars))
+	for name, sym := range g.symtab.vars {
+		if !sym.expired && sym.storage != "temp" && sym.storage != "global" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	lines := strings.SplitAfter(setup, "\n")
+	for _, name := range names {
+		typ := g.symtab.vars[name].typ
+		decl := "    " + typ + " " + name
+		for i, line := range lines {
+			if line == decl+";\n" {
+				lines[i] = ""
+			} else if init := strings.TrimPrefix(line, decl+" = "); init != line {
+				if strings.HasPrefix(init, "{") {
+					// 初始化列表改为复合字面量
+					init = "(" + typ + ")" + init
+				}
+				lines[i] = "    " + name + " = " + init
+			} else {
+				continue
+			}
+			globals += fmt.Sprintf("static %s %s;\n", typ, name)
+			break
+		}
+	}
+	return globals, join(lines, "")
+}
+
+// arduinoOutput: setup() 与 loop() 组成的 C 文件；loop 为空时 loop() 也为空
+func (g *generator) arduinoOutput(setupBody, loopBody string, hasLoop bool) string {
+	globals := ""
+	if hasLoop {
+		globals, setupBody = g.hoistGlobals(setupBody)
+		if globals != "" {
+			globals = "// top-level variables, shared by setup() and loop()\n" + globals
+		}
+	}
+	src := g.preamble() + g.runtimeCode() + join(g.classStructs, "") + globals + join(g.funcDefs, "")
+	src += "void setup(void) {\n    py_serial_begin();\n" + setupBody + g.lineReset() + "}\n"
+	src += "void loop(void) {\n" + loopBody + g.lineReset() + "}\n"
+	if strings.Contains(src, "malloc(") {
+		g.diagStmt = nil
+		g.report(logWarn, nil, "the program allocates with malloc (lists, dicts or built strings); a microcontroller has only a few KB of RAM")
+	}
+	return src
+}
+
+// arduinoTimeCall: time.sleep(s) 为 delay() 毫秒，time.time() 为开机以来的秒数（millis()，没有日历时间）
+func (g *generator) arduinoTimeCall(qname string, node ASTNode, args []interface{}) string {
+	if qname == "time.time" {
+		return "(millis() / 1000.0)"
+	}
+	if len(args) != 1 {
+		return g.unsupportedExpr(node, "call: time.sleep expects one argument")
+	}
+	return fmt.Sprintf("delay((unsigned long)((%s) * 1000))", g.toC(args[0].(map[string]interface{}), 0))
+}
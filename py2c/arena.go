@@ -0,0 +1,150 @@
+package py2c
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// -alloc arena：运行后就退出的脚本不必逐个释放。生成的代码中 malloc / calloc / realloc / free 的调用
+// 改为 py_arena_ 函数：从 64 KB 的大块中依次切出，程序结束时（atexit）一起释放；free 什么也不做，
+// realloc 对最近一次分配原地增长（列表的追加大多如此），否则复制到新的位置。
+
+// allocCallRe: C 库的分配函数的调用
+var allocCallRe = regexp.MustCompile(`\b(malloc|calloc|realloc|free)\(`)
+
+// arenaRuntime: 分配器，放在用到它的代码之前（自己调用 C 库的 malloc / free）
+const arenaRuntime = `// -alloc arena: allocations are carved from large blocks that are all released at exit;
+// free does nothing and realloc grows the newest allocation in place
+#define PY_ARENA_BLOCK 4096
+typedef union PyArenaHead { size_t size; long double ld; void* p; } PyArenaHead;
+typedef struct PyArenaBlock {
+    struct PyArenaBlock* next;
+    size_t used, cap;
+    PyArenaHead* data;
+} PyArenaBlock;
+static PyArenaBlock* py_arena_top;
+static void* py_arena_last;
+static void py_arena_release(void) {
+    while (py_arena_top) {
+        PyArenaBlock* b = py_arena_top;
+        py_arena_top = b->next;
+        free(b->data);
+        free(b);
+    }
+}
+// each allocation is a header with its size followed by the data, in units of PyArenaHead;
+// sizes over half the address space fail like malloc, so the unit counts cannot overflow
+static void* py_arena_malloc(size_t size) {
+    size_t units;
+    PyArenaHead* h;
+    if (size > (size_t)-1 / 2) {
+        return NULL;
+    }
+    units = 1 + (size + sizeof(PyArenaHead) - 1) / sizeof(PyArenaHead);
+    if (!py_arena_top || py_arena_top->cap - py_arena_top->used < units) {
+        PyArenaBlock* b = (PyArenaBlock*)malloc(sizeof(PyArenaBlock));
+        if (!b) {
+            return NULL;
+        }
+        b->cap = units > PY_ARENA_BLOCK ? units : PY_ARENA_BLOCK;
+        if (!(b->data = (PyArenaHead*)malloc(b->cap * sizeof(PyArenaHead)))) {
+            free(b);
+            return NULL;
+        }
+        if (!py_arena_top) {
+            atexit(py_arena_release);
+        }
+        b->used = 0;
+        b->next = py_arena_top;
+        py_arena_top = b;
+    }
+    h = py_arena_top->data + py_arena_top->used;
+    py_arena_top->used += units;
+    h->size = size;
+    py_arena_last = h + 1;
+    return h + 1;
+}
+static void* py_arena_calloc(size_t n, size_t size) {
+    void* p;
+    if (size && n > (size_t)-1 / size) {
+        return NULL;
+    }
+    p = py_arena_malloc(n * size);
+    if (p) {
+        memset(p, 0, n * size);
+    }
+    return p;
+}
+static void* py_arena_realloc(void* p, size_t size) {
+    PyArenaHead* h;
+    void* q;
+    if (!p) {
+        return py_arena_malloc(size);
+    }
+    if (size > (size_t)-1 / 2) {
+        return NULL;
+    }
+    h = (PyArenaHead*)p - 1;
+    if (p == py_arena_last) {
+        size_t end = (size_t)(h - py_arena_top->data) + 1 + (size + sizeof(PyArenaHead) - 1) / sizeof(PyArenaHead);
+        if (end <= py_arena_top->cap) {
+            py_arena_top->used = end;
+            h->size = size;
+            return p;
+        }
+    }
+    q = py_arena_malloc(size);
+    if (q) {
+        memcpy(q, p, h->size < size ? h->size : size);
+    }
+    return q;
+}
+#define py_arena_free(p) ((void)(p))
+`
+
+// arenaCalls: 把 src 中（字符串与注释之外）分配函数的调用改为 py_arena_ 函数，返回是否有改动
+func arenaCalls(src string) (string, bool) {
+	lines := strings.SplitAfter(src, "\n")
+	inComment, changed := false, false
+	for i, line := range lines {
+		code := codeOnly(line, &inComment)
+		matches := allocCallRe.FindAllStringIndex(code, -1)
+		for k := len(matches) - 1; k >= 0; k-- {
+			line = line[:matches[k][0]] + "py_arena_" + line[matches[k][0]:]
+			changed = true
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, ""), changed
+}
+
+// arenaFiles: -alloc arena 时改写 files 中的分配调用；有改动时把分配器放到 runtime 文件的 #include 之后。
+// 分配器不加锁，启动线程的程序不能使用
+func (g *generator) arenaFiles(files map[string]string, runtime string) error {
+	if !g.optArena {
+		return nil
+	}
+	used := false
+	for name, src := range files {
+		src, changed := arenaCalls(src)
+		files[name], used = src, used || changed
+	}
+	if !used {
+		return nil
+	}
+	if g.includes["pthread.h"] {
+		return fmt.Errorf("Alloc arena is not thread-safe: the program starts threads")
+	}
+	code := arenaRuntime
+	if !g.includes["string.h"] {
+		code = "#include <string.h>\n" + code
+	}
+	src := files[runtime]
+	at := strings.Index(src, "\n\n") + 2
+	if at < 2 {
+		at = 0
+	}
+	files[runtime] = src[:at] + code + src[at:]
+	return nil
+}
@@ -0,0 +1,874 @@
+package py2c
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// argparse：一个 ArgumentParser 与它的 add_argument 翻译成用 getopt_long 解析命令行的函数，结果是结构体 PyArgs：
+//
+//	parser = argparse.ArgumentParser(description="...")
+//	parser.add_argument("path")
+//	parser.add_argument("-n", "--count", type=int, default=10)     typedef struct { char* path; int count; } PyArgs;
+//	args = parser.parse_args()                                    PyArgs args = py_args_parse(py_sys_argv, NULL);
+//	print(args.count)                                             printf("%d\n", args.count);
+//
+// 创建解析器与 add_argument 的语句去掉（与 ctypes.go 的 argtypes 一样），参数的类型是 type= 给出的 int、float 或 str，
+// store_true / store_false 是 int。-h / --help 的输出、用法行与错误消息（退出状态 2）按 argparse 在 80 列的终端中的格式；
+// 不能翻译的参数（nargs、action="append"、没有默认值的 int 选项等）报告为错误，不放进 PyArgs。
+// 程序中只翻译一个解析器
+
+// argParser: 程序中的 ArgumentParser
+type argParser struct {
+	name        string // 保存解析器的变量
+	prog        string // prog=，空为 sys.argv[0] 的文件名
+	description string
+	epilog      string
+	actions     []*argAction
+}
+
+// argAction: add_argument 登记的一个参数
+type argAction struct {
+	flags    []string // -n、--count；位置参数为空
+	dest     string   // args 的属性名
+	field    string   // PyArgs 的字段名
+	action   string   // store、store_true、store_false
+	pytype   string   // int、float、str
+	ctype    string   // int、double、char*
+	def      string   // 默认值的 C 表达式
+	defText  string   // str(默认值)，help 中的 %(default)s
+	help     string
+	metavar  string
+	choices  []string // choices= 的 C 字面量
+	required bool
+	val      string // getopt_long 返回的值：短选项的字符，只有长选项时为 256 起的编号
+}
+
+// argTypes: type= 的类型 -> C 类型
+var argTypes = map[string]string{"int": "int", "float": "double", "str": "char*"}
+
+// argHelpWidth: argparse 在 80 列的终端中的文本宽度（COLUMNS - 2）与帮助的起始列的上限
+const (
+	argHelpWidth    = 78
+	argHelpPosition = 24
+)
+
+// collectArgparse: 登记 ArgumentParser 与 add_argument，去掉这些语句（模块与函数中的都找）；不能翻译的参数报告错误。
+// 与 collectCtypes 一样在 checkUnbound 之后运行
+func (g *generator) collectArgparse(root ASTNode) {
+	root["body"] = g.argparseStmts(root["body"].([]interface{}))
+}
+
+// argparseStmts: 去掉 stmts 及其嵌套的语句块中登记了的语句
+func (g *generator) argparseStmts(stmts []interface{}) []interface{} {
+	kept := []interface{}{}
+	for _, s := range stmts {
+		m, _ := s.(map[string]interface{})
+		if m != nil && g.argparseStmt(m) {
+			continue
+		}
+		for _, key := range []string{"body", "orelse", "finalbody"} {
+			if list, ok := m[key].([]interface{}); ok && len(list) > 0 {
+				if m[key] = g.argparseStmts(list); len(m[key].([]interface{})) == 0 {
+					m[key] = []interface{}{map[string]interface{}{"_type": "Pass"}}
+				}
+			}
+		}
+		handlers, _ := m["handlers"].([]interface{})
+		for _, h := range handlers {
+			if hm, _ := h.(map[string]interface{}); hm != nil {
+				hm["body"] = g.argparseStmts(hm["body"].([]interface{}))
+			}
+		}
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+// argparseStmt: parser = argparse.ArgumentParser(...) 与 parser.add_argument(...) 登记后返回 true
+func (g *generator) argparseStmt(m map[string]interface{}) bool {
+	targets, _ := m["targets"].([]interface{})
+	target := toNode(targets, 0)
+	call, _ := m["value"].(map[string]interface{})
+	if call["_type"] != "Call" {
+		return false
+	}
+	if m["_type"] == "Assign" && len(targets) == 1 && target["_type"] == "Name" && g.importedName(call["func"]) == "argparse.ArgumentParser" {
+		if g.argParser != nil {
+			g.report(logError, call, "argparse: only one ArgumentParser per program is translated (the first is %s)", g.argParser.name)
+			return false
+		}
+		g.argParser = &argParser{name: target["id"].(string)}
+		keywords, _ := call["keywords"].([]interface{})
+		for _, k := range keywords {
+			km, _ := k.(map[string]interface{})
+			v, _ := km["value"].(map[string]interface{})
+			text, ok := v["value"].(string)
+			if km["arg"] != "prog" && km["arg"] != "description" && km["arg"] != "epilog" {
+				g.report(logError, v, "argparse: the keyword argument %v of ArgumentParser is not translated", km["arg"])
+				continue
+			} else if !ok || v["_type"] != "Constant" {
+				g.report(logError, v, "argparse: ArgumentParser(%v=) is not a string literal", km["arg"])
+				continue
+			}
+			switch km["arg"] {
+			case "prog":
+				g.argParser.prog = text
+			case "description":
+				g.argParser.description = text
+			case "epilog":
+				g.argParser.epilog = text
+			}
+		}
+		return true
+	}
+	fn, _ := call["func"].(map[string]interface{})
+	recv, _ := fn["value"].(map[string]interface{})
+	if m["_type"] != "Expr" || fn["_type"] != "Attribute" || fn["attr"] != "add_argument" || g.argParser == nil || recv["_type"] != "Name" || recv["id"] != g.argParser.name {
+		return false
+	}
+	a, why := g.argAction(call)
+	if why != "" {
+		g.report(logError, call, "argparse: %s.add_argument(%s): %s", g.argParser.name, argNames(call), why)
+		return true
+	}
+	for _, other := range g.argParser.actions {
+		if other.dest == a.dest {
+			g.report(logError, call, "argparse: %s.add_argument(%s): the destination %s is used twice", g.argParser.name, argNames(call), a.dest)
+			return true
+		}
+		for _, f := range other.flags {
+			if strings.Contains(" "+join(a.flags, " ")+" ", " "+f+" ") {
+				g.report(logError, call, "argparse: %s.add_argument(%s): the option %s is used twice", g.argParser.name, argNames(call), f)
+				return true
+			}
+		}
+	}
+	a.val = fmt.Sprint(256 + len(g.argParser.actions))
+	for _, f := range a.flags {
+		if len(f) == 2 {
+			a.val = "'" + f[1:] + "'"
+			break
+		}
+	}
+	g.argParser.actions = append(g.argParser.actions, a)
+	return true
+}
+
+// argNames: add_argument 的名字，用在诊断中（"-n", "--count"）
+func argNames(call map[string]interface{}) string {
+	args, _ := call["args"].([]interface{})
+	var names []string
+	for _, a := range args {
+		if s, ok := a.(map[string]interface{})["value"].(string); ok {
+			names = append(names, strconv.Quote(s))
+		}
+	}
+	return join(names, ", ")
+}
+
+// argAction: add_argument 的参数；不能翻译时返回原因
+func (g *generator) argAction(call map[string]interface{}) (*argAction, string) {
+	a := &argAction{action: "store", pytype: "str"}
+	args, _ := call["args"].([]interface{})
+	for _, n := range args {
+		s, ok := n.(map[string]interface{})["value"].(string)
+		switch {
+		case !ok:
+			return nil, "a name that is not a string literal"
+		case strings.HasPrefix(s, "--") && cIdent.MatchString(strings.ReplaceAll(s[2:], "-", "_")):
+			a.flags = append(a.flags, s)
+		case len(s) == 2 && s[0] == '-' && cIdent.MatchString("x"+s[1:]) && s != "-h":
+			a.flags = append(a.flags, s)
+		case s == "-h", s == "--help":
+			return nil, "-h and --help are the help option"
+		case strings.HasPrefix(s, "-"):
+			return nil, fmt.Sprintf("the option %s (options are -x or --name)", s)
+		case len(args) > 1:
+			return nil, "a positional argument with more than one name"
+		default:
+			a.dest = s
+		}
+	}
+	if len(args) == 0 {
+		return nil, "no name"
+	}
+	// dest：第一个长选项，没有时第一个短选项
+	for _, f := range a.flags {
+		if a.dest == "" || strings.HasPrefix(f, "--") && len(a.dest) == 1 {
+			a.dest = strings.ReplaceAll(strings.TrimLeft(f, "-"), "-", "_")
+		}
+	}
+	var def map[string]interface{}
+	keywords, _ := call["keywords"].([]interface{})
+	for _, k := range keywords {
+		km, _ := k.(map[string]interface{})
+		v, _ := km["value"].(map[string]interface{})
+		text, isStr := v["value"].(string)
+		isStr = isStr && v["_type"] == "Constant"
+		arg := fmt.Sprint(km["arg"])
+		switch {
+		case arg == "type":
+			id, _ := v["id"].(string)
+			if v["_type"] != "Name" || argTypes[id] == "" {
+				return nil, "type= other than int, float and str"
+			}
+			a.pytype = id
+		case arg == "action" && isStr && (text == "store" || text == "store_true" || text == "store_false"):
+			a.action = text
+		case arg == "action":
+			return nil, "action= other than store, store_true and store_false"
+		case arg == "default":
+			def = v
+		case arg == "required" && v["_type"] == "Constant" && (v["value"] == true || v["value"] == false):
+			a.required = v["value"] == true
+		case arg == "help" && isStr, arg == "dest" && isStr, arg == "metavar" && isStr:
+			*map[string]*string{"help": &a.help, "dest": &a.dest, "metavar": &a.metavar}[arg] = text
+		case arg == "choices" && (v["_type"] == "List" || v["_type"] == "Tuple"):
+			elts, _ := v["elts"].([]interface{})
+			for _, e := range elts {
+				a.choices = append(a.choices, g.toC(e.(map[string]interface{}), 0))
+			}
+		default:
+			return nil, "the keyword argument " + arg
+		}
+	}
+	if !cIdent.MatchString(a.dest) {
+		return nil, fmt.Sprintf("the destination %q is not an identifier", a.dest)
+	}
+	a.field = a.dest
+	if reservedC[a.field] {
+		a.field += "_"
+	}
+	if len(a.flags) == 0 && (a.action != "store" || a.required) {
+		return nil, "a positional argument with action= or required="
+	}
+	if a.action != "store" {
+		// store_true / store_false：默认值是相反的布尔值
+		a.pytype, a.ctype, a.def, a.defText = "bool", "int", "0", "False"
+		if a.action == "store_false" {
+			a.def, a.defText = "1", "True"
+		}
+		if def != nil {
+			b, ok := def["value"].(bool)
+			if def["_type"] != "Constant" || !ok {
+				return nil, "a default for " + a.action + " that is not True or False"
+			}
+			a.def, a.defText = map[bool]string{true: "1", false: "0"}[b], map[bool]string{true: "True", false: "False"}[b]
+		}
+		return a, ""
+	}
+	a.ctype = argTypes[a.pytype]
+	for _, c := range a.choices {
+		if (a.ctype == "char*") != strings.HasPrefix(c, "\"") || strings.HasPrefix(c, "/*") {
+			return nil, fmt.Sprintf("the choice %s is not a %s literal", c, a.pytype)
+		}
+	}
+	if def, why := argDefault(a, def); why != "" {
+		return nil, why
+	} else if len(a.flags) > 0 {
+		a.def = def
+	}
+	return a, ""
+}
+
+// argDefault: 选项的默认值的 C 表达式，同时设置 defText；Python 中没有默认值的选项是 None，只有字符串能表示
+func argDefault(a *argAction, def map[string]interface{}) (string, string) {
+	neg := ""
+	if def["_type"] == "UnaryOp" {
+		if op, _ := def["op"].(map[string]interface{}); op["_type"] == "USub" {
+			neg, def = "-", def["operand"].(map[string]interface{})
+		}
+	}
+	if def != nil && def["_type"] != "Constant" {
+		return "", "a default that is not a literal"
+	}
+	v := def["value"]
+	if v == nil {
+		a.defText = "None"
+		switch {
+		case a.ctype == "char*":
+			return "NULL", ""
+		case a.required || len(a.flags) == 0:
+			return "0", "" // 总是给出
+		}
+		return "", fmt.Sprintf("type=%s without a default (the value would be None)", a.pytype)
+	}
+	if s, ok := v.(string); ok && neg == "" {
+		// 字符串的默认值按 type= 转换
+		a.defText = s
+		switch a.ctype {
+		case "char*":
+			return "\"" + cEscape(s) + "\"", ""
+		case "int":
+			if n, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+				return strconv.Itoa(n), ""
+			}
+		case "double":
+			if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+				return strconv.FormatFloat(f, 'g', -1, 64), ""
+			}
+		}
+		return "", fmt.Sprintf("the default %q is not a valid %s", s, a.pytype)
+	}
+	num, ok := v.(json.Number)
+	isInt := ok && !strings.ContainsAny(string(num), ".eE")
+	if !ok || a.ctype == "char*" || a.ctype == "int" && !isInt {
+		return "", fmt.Sprintf("the default %v%v does not have type=%s", neg, v, a.pytype)
+	}
+	a.defText = neg + string(num)
+	return a.defText, ""
+}
+
+// --- 解析器的使用 ---
+
+// argparseType: parser.parse_args() 是 PyArgs，args.x 是参数的类型（类型推断在翻译之前，按解析器的变量名识别）
+func (g *generator) argparseType(m map[string]interface{}) string {
+	switch m["_type"] {
+	case "Call":
+		fn, _ := m["func"].(map[string]interface{})
+		if g.isArgParser(fn["value"]) && fn["attr"] == "parse_args" {
+			return "PyArgs"
+		}
+	case "Attribute":
+		if a := g.argField(m); a != nil {
+			return a.ctype
+		} else if g.argParser != nil && g.getType(m["value"]) == "PyArgs" {
+			return "double" // 没有的参数：和其他未知的名字一样
+		}
+	}
+	return ""
+}
+
+// isArgParser: node 是保存解析器的变量
+func (g *generator) isArgParser(node interface{}) bool {
+	m, _ := node.(map[string]interface{})
+	return g.argParser != nil && m["_type"] == "Name" && m["id"] == g.argParser.name
+}
+
+// argField: args.x 的参数，node 不是 PyArgs 的属性或者没有这个参数时为 nil
+func (g *generator) argField(node map[string]interface{}) *argAction {
+	if g.argParser == nil || g.getType(node["value"]) != "PyArgs" {
+		return nil
+	}
+	for _, a := range g.argParser.actions {
+		if a.dest == node["attr"] {
+			return a
+		}
+	}
+	return nil
+}
+
+// argsAttr: args.x 读 PyArgs 的字段
+func (g *generator) argsAttr(node ASTNode) (string, bool) {
+	if g.argParser == nil || g.getType(node["value"]) != "PyArgs" {
+		return "", false
+	}
+	a := g.argField(node)
+	if a == nil {
+		return g.unsupportedExpr(node, fmt.Sprintf("attribute %v (%s has no such argument)", node["attr"], g.argParser.name)), true
+	}
+	return g.toC(node["value"].(map[string]interface{}), 0) + "." + a.field, true
+}
+
+// handleArgParserCall: parser.parse_args([args]) / parser.print_help() / parser.print_usage() / parser.error(msg)
+func (g *generator) handleArgParserCall(fn, call map[string]interface{}) (string, bool) {
+	if !g.isArgParser(fn["value"]) {
+		return "", false
+	}
+	method, _ := fn["attr"].(string)
+	args, _ := call["args"].([]interface{})
+	if keywords, _ := call["keywords"].([]interface{}); len(keywords) > 0 {
+		return g.unsupportedExpr(call, fmt.Sprintf("call: %s.%s with keyword arguments", g.argParser.name, method)), true
+	}
+	switch {
+	case method == "parse_args" && len(args) <= 1:
+		g.argparseRuntime()
+		given := "NULL"
+		if len(args) == 1 {
+			if g.getType(args[0]) != g.listType("char*") {
+				return g.unsupportedExpr(call, fmt.Sprintf("call: %s.parse_args of something other than a list of strings", g.argParser.name)), true
+			}
+			given = g.toC(args[0].(map[string]interface{}), 0)
+		}
+		return fmt.Sprintf("py_args_parse(%s, %s)", g.sysArgv(), given), true
+	case (method == "print_help" || method == "print_usage") && len(args) == 0:
+		g.argparseRuntime()
+		return fmt.Sprintf("py_args_%s(stdout)", strings.TrimPrefix(method, "print_")), true
+	case method == "error" && len(args) == 1 && g.getType(args[0]) == "char*":
+		g.argparseRuntime()
+		return fmt.Sprintf("py_args_error(\"%%s\", %s, \"\")", g.toC(args[0].(map[string]interface{}), 0)), true
+	}
+	return g.unsupportedExpr(call, fmt.Sprintf("call: %s.%s with %d arguments", g.argParser.name, method, len(args))), true
+}
+
+// --- 帮助与用法 ---
+
+// name: 错误消息中参数的名字（-n/--count，位置参数为 metavar 或 dest）
+func (a *argAction) name() string {
+	if len(a.flags) > 0 {
+		return join(a.flags, "/")
+	}
+	if a.metavar != "" {
+		return a.metavar
+	}
+	return a.dest
+}
+
+// valueName: 用法与帮助中参数的值（COUNT、{a,b}）
+func (a *argAction) valueName() string {
+	switch {
+	case a.metavar != "":
+		return a.metavar
+	case len(a.choices) > 0:
+		var cs []string
+		for _, c := range a.choices {
+			if s, err := strconv.Unquote(c); err == nil {
+				c = s
+			}
+			cs = append(cs, c)
+		}
+		return "{" + join(cs, ",") + "}"
+	case len(a.flags) == 0:
+		return a.dest
+	}
+	return strings.ToUpper(a.dest)
+}
+
+// usage: 用法行中的写法（[-n COUNT]、path）
+func (a *argAction) usage() string {
+	if len(a.flags) == 0 {
+		return a.valueName()
+	}
+	u := a.flags[0]
+	if a.action == "store" {
+		u += " " + a.valueName()
+	}
+	if a.required {
+		return u
+	}
+	return "[" + u + "]"
+}
+
+// invocation: 帮助中参数的写法（-n COUNT, --count COUNT）
+func (a *argAction) invocation() string {
+	if len(a.flags) == 0 {
+		return a.valueName()
+	}
+	var parts []string
+	for _, f := range a.flags {
+		if a.action == "store" {
+			f += " " + a.valueName()
+		}
+		parts = append(parts, f)
+	}
+	return join(parts, ", ")
+}
+
+// wrapText: 与 argparse 一样把空白合并成一个空格，按单词折行
+func wrapText(text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, w := range strings.Fields(text) {
+		if line != "" && len(line)+1+len(w) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += w
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// helpText: --help 在用法行之后的部分：说明、位置参数、选项与 epilog
+func (p *argParser) helpText() string {
+	help := &argAction{flags: []string{"-h", "--help"}, action: "store_true", help: "show this help message and exit"}
+	var positionals, options []*argAction
+	options = append(options, help)
+	width := 0
+	for _, a := range append([]*argAction{help}, p.actions...) {
+		if len(a.invocation())+2 > width {
+			width = len(a.invocation()) + 2
+		}
+		if a != help && len(a.flags) == 0 {
+			positionals = append(positionals, a)
+		} else if a != help {
+			options = append(options, a)
+		}
+	}
+	helpPos := width + 2
+	if helpPos > argHelpPosition {
+		helpPos = argHelpPosition
+	}
+	textWidth := argHelpWidth - helpPos
+	if textWidth < 11 {
+		textWidth = 11
+	}
+	var b strings.Builder
+	if p.description != "" {
+		b.WriteString("\n" + join(wrapText(p.description, argHelpWidth), "\n") + "\n")
+	}
+	for _, section := range []struct {
+		title   string
+		actions []*argAction
+	}{{"positional arguments", positionals}, {"options", options}} {
+		if len(section.actions) == 0 {
+			continue
+		}
+		b.WriteString("\n" + section.title + ":\n")
+		for _, a := range section.actions {
+			inv := a.invocation()
+			text := strings.ReplaceAll(strings.ReplaceAll(a.help, "%(default)s", a.defText), "%%", "%")
+			lines := wrapText(text, textWidth)
+			switch {
+			case len(lines) == 0:
+				b.WriteString("  " + inv + "\n")
+				continue
+			case len(inv) <= helpPos-4:
+				b.WriteString(fmt.Sprintf("  %-*s  %s\n", helpPos-4, inv, lines[0]))
+			default:
+				b.WriteString(fmt.Sprintf("  %s\n%*s%s\n", inv, helpPos, "", lines[0]))
+			}
+			for _, l := range lines[1:] {
+				b.WriteString(fmt.Sprintf("%*s%s\n", helpPos, "", l))
+			}
+		}
+	}
+	if p.epilog != "" {
+		b.WriteString("\n" + join(wrapText(p.epilog, argHelpWidth), "\n") + "\n")
+	}
+	return b.String()
+}
+
+// --- 运行时 ---
+
+// argparseRuntime: PyArgs、用法与帮助、错误与类型转换以及 py_args_parse（放在 classStructs 中）
+func (g *generator) argparseRuntime() {
+	if g.copyFuncs["py_args"] {
+		return
+	}
+	g.copyFuncs["py_args"] = true
+	for _, h := range []string{"getopt.h", "stdio.h", "stdlib.h", "string.h"} {
+		g.includes[h] = true
+	}
+	p := g.argParser
+	lt := strings.TrimSuffix(g.listType("char*"), "*")
+	fields, opts, pos, optstring := "", "\"[-h]\", ", "", "+:h"
+	numbers := " || py_args_number(args[optind])" // 没有像负数的选项时 -3 是值（与 argparse 相同）
+	longopts := "        {\"help\", no_argument, NULL, 'h'},\n"
+	for _, a := range p.actions {
+		fields += fmt.Sprintf("    %s %s;\n", a.ctype, a.field)
+		if len(a.flags) == 0 {
+			pos += strconv.Quote(a.usage()) + ", "
+			continue
+		}
+		opts += strconv.Quote(a.usage()) + ", "
+		arg := "no_argument"
+		if a.action == "store" {
+			arg = "required_argument"
+		}
+		for _, f := range a.flags {
+			if strings.HasPrefix(f, "--") {
+				longopts += fmt.Sprintf("        {\"%s\", %s, NULL, %s},\n", f[2:], arg, a.val)
+			} else if optstring += f[1:]; arg == "required_argument" {
+				optstring += ":"
+			}
+			if len(f) == 2 && f[1] >= '0' && f[1] <= '9' {
+				numbers = ""
+			}
+		}
+	}
+	if fields == "" {
+		fields = "    int none; /* C has no empty structs */\n"
+	}
+	prog := "strrchr(argv->items[0], '/') ? strrchr(argv->items[0], '/') + 1 : argv->items[0]"
+	if p.prog != "" {
+		prog = "\"" + cEscape(p.prog) + "\""
+	}
+	help := ""
+	for _, l := range strings.SplitAfter(p.helpText(), "\n") {
+		if l != "" {
+			help += fmt.Sprintf("\n        \"%s\"", cEscape(l))
+		}
+	}
+	var parse strings.Builder
+	for _, a := range p.actions {
+		if a.required && len(a.flags) > 0 {
+			parse.WriteString(fmt.Sprintf("    int seen_%s = 0;\n", a.field))
+		}
+	}
+	parse.WriteString("    char extra[PY_ARGS_TEXT] = \"\";\n    char opt[3] = \"-?\";\n")
+	parse.WriteString("    char** args = (char**)malloc((n + 1) * sizeof(char*));\n    char** rest = (char**)malloc(n * sizeof(char*));\n    int nrest = 0, dashdash = 0;\n    memset(&a, 0, sizeof a);\n")
+	parse.WriteString(fmt.Sprintf("    py_args_prog = %s;\n", prog))
+	parse.WriteString("    args[0] = argv->items[0];\n    for (c = 1; c < n; c++) {\n        args[c] = given ? py_args_keep(given->items[c - 1]) : argv->items[c];\n    }\n    args[n] = NULL;\n")
+	for _, a := range p.actions {
+		if a.def != "" {
+			parse.WriteString(fmt.Sprintf("    a.%s = %s;\n", a.field, a.def))
+		}
+	}
+	// getopt_long 只解析选项（+：遇到别的参数停下）：位置参数、-- 之后的参数与负数按顺序放进 rest
+	parse.WriteString(fmt.Sprintf(`    optind = 1;
+    opterr = 0;
+    while (optind < n) {
+        if (!dashdash && strcmp(args[optind], "--") == 0) {
+            dashdash = 1;
+            optind++;
+            continue;
+        }
+        if (dashdash || args[optind][0] != '-' || args[optind][1] == '\0'%s) {
+            rest[nrest++] = args[optind++];
+            continue;
+        }
+        switch (c = getopt_long(n, args, "%s", longopts, NULL)) {
+`, numbers, optstring))
+	parse.WriteString("        case 'h':\n            py_args_help(stdout);\n            exit(0);\n")
+	names := ""
+	for _, a := range p.actions {
+		if len(a.flags) == 0 {
+			continue
+		}
+		labels := "case " + a.val + ":"
+		for _, f := range a.flags {
+			if len(f) == 2 && "'"+f[1:]+"'" != a.val {
+				labels += " case '" + f[1:] + "':"
+			}
+		}
+		names += fmt.Sprintf("    %s\n        return \"%s\";\n", labels, a.name())
+		parse.WriteString("        " + labels + "\n")
+		parse.WriteString(g.argStore(a, "optarg", "            "))
+		if a.required {
+			parse.WriteString(fmt.Sprintf("            seen_%s = 1;\n", a.field))
+		}
+		parse.WriteString("            break;\n")
+	}
+	parse.WriteString(`        case ':':
+            py_args_error("argument %s: expected one argument", py_args_option(optopt), "");
+            break;
+        default:
+            opt[1] = (char)optopt;
+            py_args_join(extra, " ", optopt ? opt : args[optind - 1]);
+        }
+    }
+`)
+	// 位置参数与必需的选项按 add_argument 的顺序检查
+	parse.WriteString("    c = 0;\n")
+	missing := false
+	for _, a := range p.actions {
+		switch {
+		case len(a.flags) == 0:
+			missing = true
+			parse.WriteString(fmt.Sprintf("    if (c < nrest) {\n%s        c++;\n    } else {\n        py_args_join(required, \", \", \"%s\");\n    }\n", g.argStore(a, "rest[c]", "        "), a.name()))
+		case a.required:
+			missing = true
+			parse.WriteString(fmt.Sprintf("    if (!seen_%s) {\n        py_args_join(required, \", \", \"%s\");\n    }\n", a.field, a.name()))
+		}
+	}
+	decl := ""
+	if missing {
+		decl = "    char required[PY_ARGS_TEXT] = \"\";\n"
+		parse.WriteString("    if (required[0]) {\n        py_args_error(\"the following arguments are required: %s\", required, \"\");\n    }\n")
+	}
+	parse.WriteString("    for (; c < nrest; c++) {\n        py_args_join(extra, \" \", rest[c]);\n    }\n")
+	parse.WriteString("    if (extra[0]) {\n        py_args_error(\"unrecognized arguments: %s\", extra, \"\");\n    }\n    free(args);\n    free(rest);\n    return a;\n")
+	g.classStructs = append(g.classStructs, fmt.Sprintf(`// argparse: the arguments of %[1]s, filled in by py_args_parse
+typedef struct {
+%[2]s} PyArgs;
+#define PY_ARGS_TEXT 256
+static const char* py_args_prog;
+// print parts separated by spaces, starting a new line indented by indent columns before a part that would pass
+// column 78; len is the length of the line so far minus one, as in argparse's usage formatter
+static void py_args_wrap(FILE* f, const char* const* parts, size_t len, size_t indent, int empty) {
+    for (; *parts; parts++) {
+        if (len + 1 + strlen(*parts) > %[3]d && !empty) {
+            fprintf(f, "\n%%*s", (int)indent, "");
+            len = indent - 1;
+            empty = 1;
+        }
+        fprintf(f, "%%s%%s", empty ? "" : " ", *parts);
+        len += strlen(*parts) + 1;
+        empty = 0;
+    }
+}
+// the usage line, wrapped like argparse's: the positionals go on their own line when it is too long
+static void py_args_usage(FILE* f) {
+    static const char* const opts[] = {%[4]sNULL};
+    static const char* const pos[] = {%[5]sNULL};
+    size_t len = strlen(py_args_prog), all = 0, i;
+    for (i = 0; opts[i]; i++) {
+        all += strlen(opts[i]) + 1;
+    }
+    for (i = 0; pos[i]; i++) {
+        all += strlen(pos[i]) + 1;
+    }
+    fprintf(f, "usage: %%s", py_args_prog);
+    if (7 + len + all <= %[3]d) {
+        py_args_wrap(f, opts, 0, 0, 0);
+        py_args_wrap(f, pos, 0, 0, 0);
+    } else if (7 + len <= %[3]d * 3 / 4) {
+        py_args_wrap(f, opts, 6 + len + 1, 7 + len + 1, 0);
+        if (pos[0]) {
+            fprintf(f, "\n%%*s", (int)(7 + len + 1), "");
+            py_args_wrap(f, pos, 7 + len, 7 + len + 1, 1);
+        }
+    } else {
+        fprintf(f, "\n       ");
+        py_args_wrap(f, opts, 6, 7, 1);
+        if (pos[0] && 6 + all > %[3]d) {
+            fprintf(f, "\n       ");
+            py_args_wrap(f, pos, 6, 7, 1);
+        } else {
+            py_args_wrap(f, pos, 0, 7, 0);
+        }
+    }
+    fputc('\n', f);
+}
+static void py_args_help(FILE* f) {
+    py_args_usage(f);
+    fputs(%[6]s, f);
+}
+// an error in the command line: the usage and the message on stderr, exit status 2
+static void py_args_error(const char* format, const char* a, const char* b) {
+    py_args_usage(stderr);
+    fprintf(stderr, "%%s: error: ", py_args_prog);
+    fprintf(stderr, format, a, b);
+    fputc('\n', stderr);
+    exit(2);
+}
+// add s to the list in buf (the missing arguments, the unrecognized ones), after sep unless it is the first
+static void py_args_join(char* buf, const char* sep, const char* s) {
+    size_t n = strlen(buf);
+    snprintf(buf + n, PY_ARGS_TEXT - n, "%%s%%s", n ? sep : "", s);
+}
+static int py_args_int(const char* s, const char* name) {
+    char* end;
+    long v = strtol(s, &end, 10);
+    if (*s == '\0' || *end != '\0') {
+        py_args_error("argument %%s: invalid int value: '%%s'", name, s);
+    }
+    return (int)v;
+}
+static double py_args_float(const char* s, const char* name) {
+    char* end;
+    double v = strtod(s, &end);
+    if (*s == '\0' || *end != '\0') {
+        py_args_error("argument %%s: invalid float value: '%%s'", name, s);
+    }
+    return v;
+}
+// a copy of a string from the list given to parse_args, kept until the program ends (the list may be freed)
+static char* py_args_keep(const char* s) {
+    static char** kept;
+    static int nkept;
+    char* copy = (char*)malloc(strlen(s) + 1);
+    strcpy(copy, s);
+    kept = (char**)realloc(kept, (nkept + 1) * sizeof(char*));
+    kept[nkept++] = copy;
+    return copy;
+}
+// a negative number such as -3 or -.5, which is a value rather than an option
+static int py_args_number(const char* s) {
+    size_t i = 1, digits = strspn(s + 1, "0123456789");
+    i += digits;
+    if (s[i] == '.') {
+        digits = strspn(s + i + 1, "0123456789");
+        i += 1 + digits;
+    }
+    return digits > 0 && s[i] == '\0';
+}
+// the name of an option in error messages
+static const char* py_args_option(int c) {
+    switch (c) {
+%[7]s    }
+    return "";
+}
+// parser.parse_args(): the command line after the program name, or the strings in given
+static PyArgs py_args_parse(%[8]s* argv, %[8]s* given) {
+    static const struct option longopts[] = {
+%[9]s        {NULL, 0, NULL, 0}
+    };
+    PyArgs a;
+    int n = given ? given->len + 1 : argv->len, c;
+%[10]s%[11]s}
+// str(args): Namespace(path='x', count=10)
+static char* py_args_repr(PyArgs a) {
+    char* buf = %[12]s;
+    snprintf(buf, PY_STRBUF_SIZE, "Namespace(%[13]s)"%[14]s);
+    return buf;
+}
+`, p.name, fields, argHelpWidth, opts, pos, strings.TrimPrefix(help, "\n        "), names, lt, longopts, decl, parse.String(), g.strBuf(), g.argsReprFormat(), g.argsReprArgs()))
+}
+
+// argStore: 把字符串 s 转换成参数的类型存进 a 的字段，有 choices 时检查
+func (g *generator) argStore(a *argAction, s, pad string) string {
+	field := "a." + a.field
+	switch {
+	case a.action == "store_true":
+		return pad + field + " = 1;\n"
+	case a.action == "store_false":
+		return pad + field + " = 0;\n"
+	}
+	conv := map[string]string{"int": "py_args_int(%s, \"%s\")", "double": "py_args_float(%s, \"%s\")", "char*": "%s"}[a.ctype]
+	if a.ctype == "char*" {
+		conv = fmt.Sprintf(conv, s)
+	} else {
+		conv = fmt.Sprintf(conv, s, a.name())
+	}
+	code := fmt.Sprintf("%s%s = %s;\n", pad, field, conv)
+	if len(a.choices) > 0 {
+		var tests, quoted []string
+		for _, c := range a.choices {
+			if a.ctype == "char*" {
+				tests = append(tests, fmt.Sprintf("strcmp(%s, %s) != 0", field, c))
+				u, _ := strconv.Unquote(c)
+				quoted = append(quoted, "'"+cEscape(u)+"'")
+			} else {
+				tests = append(tests, fmt.Sprintf("%s != %s", field, c))
+				quoted = append(quoted, c)
+			}
+		}
+		value := "%s"
+		if a.ctype == "char*" {
+			value = "'%s'"
+		}
+		msg := strings.ReplaceAll(join(quoted, ", "), "%", "%%")
+		code += fmt.Sprintf("%sif (%s) {\n%s    py_args_error(\"argument %%s: invalid choice: %s (choose from %s)\", \"%s\", %s);\n%s}\n",
+			pad, join(tests, " && "), pad, value, msg, a.name(), s, pad)
+	}
+	return code
+}
+
+// argsReprFormat / argsReprArgs: Namespace(...) 的格式串与实参，字符串为 None 或者带引号
+func (g *generator) argsReprFormat() string {
+	var parts []string
+	for _, a := range g.argParser.actions {
+		f := map[string]string{"int": "%d", "double": "%g", "char*": "%s%s%s"}[a.ctype]
+		if a.pytype == "bool" {
+			f = "%s"
+		}
+		parts = append(parts, a.dest+"="+f)
+	}
+	return join(parts, ", ")
+}
+
+func (g *generator) argsReprArgs() string {
+	code := ""
+	for _, a := range g.argParser.actions {
+		field := "a." + a.field
+		switch {
+		case a.pytype == "bool":
+			code += fmt.Sprintf(", %s ? \"True\" : \"False\"", field)
+		case a.ctype == "char*":
+			code += fmt.Sprintf(", %[1]s ? \"'\" : \"\", %[1]s ? %[1]s : \"None\", %[1]s ? \"'\" : \"\"", field)
+		default:
+			code += ", " + field
+		}
+	}
+	return code
+}
@@ -0,0 +1,134 @@
+package py2c
+
+import (
+	"fmt"
+	"strings"
+)
+
+// bisect 模块：在有序的列表中二分查找与插入，调用每种列表第一次用到时生成的辅助函数：
+//
+//	i = bisect.bisect_left(xs, 5)       int i = PyList_int_bisect_left(xs, 5, 0, -1);
+//	bisect.insort(xs, 4, 2)             PyList_int_insort_right(xs, 4, 2, -1);
+//
+// lo / hi 可以按位置或者关键字给出，hi 为 -1 表示到列表的末尾（与 CPython 相同）；lo 为负数时是 ValueError。
+// 元素的比较与 heapq.go 共用 list_lt，所以支持的元素相同；key= 不支持
+
+// bisectFuncs: bisect 模块的函数 -> 辅助函数的后缀（bisect 与 insort 是 bisect_right 与 insort_right 的别名）
+var bisectFuncs = map[string]string{
+	"bisect.bisect_left": "bisect_left", "bisect.bisect_right": "bisect_right", "bisect.bisect": "bisect_right",
+	"bisect.insort_left": "insort_left", "bisect.insort_right": "insort_right", "bisect.insort": "insort_right",
+}
+
+// bisectType: bisect_left / bisect_right / bisect 的结果是下标（类型推断在翻译 import 之前，按 importedName 识别）
+func (g *generator) bisectType(fn interface{}) string {
+	if strings.HasPrefix(bisectFuncs[g.importedName(fn)], "bisect") {
+		return "int"
+	}
+	return ""
+}
+
+// bisectCall: bisect.bisect_left(a, x[, lo[, hi]]) 等
+func (g *generator) bisectCall(qname string, node ASTNode) string {
+	suffix := bisectFuncs[qname]
+	if suffix == "" {
+		return g.unsupportedExpr(node, "call: "+qname)
+	}
+	args, _ := node["args"].([]interface{})
+	if len(args) < 2 || len(args) > 4 {
+		return g.unsupportedExpr(node, fmt.Sprintf("call: %s with %d arguments", qname, len(args)))
+	}
+	lt := g.getType(args[0])
+	elem, ok := g.listElemType(lt)
+	if !ok {
+		return g.unsupportedExpr(node, fmt.Sprintf("call: %s of something other than a list", qname))
+	}
+	list := strings.TrimSuffix(lt, "*")
+	if why := g.bisectRuntime(list, elem); why != "" {
+		return g.unsupportedExpr(node, fmt.Sprintf("call: %s on a list of %s (%s)", qname, elem, why))
+	}
+	a := g.toC(args[0].(map[string]interface{}), 0)
+	x := g.toC(args[1].(map[string]interface{}), 0)
+	if strings.HasPrefix(suffix, "insort") && g.isRcType(elem) {
+		x = g.rcRef(elem, x) // 与 append 一样，列表持有自己的引用
+	}
+	// lo 与 hi：按位置、按关键字或者默认值
+	bounds := []string{"0", "-1"}
+	for i := 2; i < len(args); i++ {
+		bounds[i-2] = g.toC(args[i].(map[string]interface{}), 0)
+	}
+	keywords, _ := node["keywords"].([]interface{})
+	for _, k := range keywords {
+		km, _ := k.(map[string]interface{})
+		v, _ := km["value"].(map[string]interface{})
+		switch km["arg"] {
+		case "lo":
+			bounds[0] = g.toC(v, 0)
+		case "hi":
+			if !isNoneConst(v) {
+				bounds[1] = g.toC(v, 0)
+			}
+		default:
+			return g.unsupportedExpr(node, fmt.Sprintf("call: %s with the keyword argument %v", qname, km["arg"]))
+		}
+	}
+	return fmt.Sprintf("%s_%s(%s, %s, %s, %s)", list, suffix, a, g.upcastElem(elem, args[1], x), bounds[0], bounds[1])
+}
+
+// bisectRuntime: 第一次用到时生成列表 list 的二分查找与插入（放在 classStructs 中，在列表之后）；元素不能比较时返回原因
+func (g *generator) bisectRuntime(list, elem string) string {
+	if why := g.listOrder(list, elem); why != "" || g.listFuncs[list+"_bisect_left"] {
+		return why
+	}
+	g.listFuncs[list+"_bisect_left"] = true
+	g.includes["string.h"] = true
+	g.classStructs = append(g.classStructs, fmt.Sprintf(`// bisect on %[1]s: the position of x in the sorted items[lo:hi] (hi -1 is the length), before equal items
+static int %[1]s_bisect_left(%[1]s* l, %[2]s x, int lo, int hi) {
+    if (lo < 0) {
+        %[3]s
+    }
+    if (hi == -1) {
+        hi = l->len;
+    }
+    while (lo < hi) {
+        int mid = lo + (hi - lo) / 2;
+        if (%[1]s_lt(*%[1]s_at(l, mid), x)) {
+            lo = mid + 1;
+        } else {
+            hi = mid;
+        }
+    }
+    return lo;
+}
+// the position of x in the sorted items[lo:hi], after equal items
+static int %[1]s_bisect_right(%[1]s* l, %[2]s x, int lo, int hi) {
+    if (lo < 0) {
+        %[3]s
+    }
+    if (hi == -1) {
+        hi = l->len;
+    }
+    while (lo < hi) {
+        int mid = lo + (hi - lo) / 2;
+        if (%[1]s_lt(x, *%[1]s_at(l, mid))) {
+            hi = mid;
+        } else {
+            lo = mid + 1;
+        }
+    }
+    return lo;
+}
+// insert x at position i, moving the items after it up by one
+static void %[1]s_insert_at(%[1]s* l, int i, %[2]s x) {
+    %[1]s_append(l, x);
+    memmove(&l->items[i + 1], &l->items[i], (l->len - 1 - i) * sizeof(%[2]s));
+    l->items[i] = x;
+}
+static void %[1]s_insort_left(%[1]s* l, %[2]s x, int lo, int hi) {
+    %[1]s_insert_at(l, %[1]s_bisect_left(l, x, lo, hi), x);
+}
+static void %[1]s_insort_right(%[1]s* l, %[2]s x, int lo, int hi) {
+    %[1]s_insert_at(l, %[1]s_bisect_right(l, x, lo, hi), x);
+}
+`, list, elem, g.runtimeError("ValueError", "lo must be non-negative")))
+	return ""
+}
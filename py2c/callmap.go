@@ -0,0 +1,206 @@
+package py2c
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Options.Calls（-map）：项目自己的函数怎样翻译，不必修改翻译器。
+//
+//	utils.log:
+//	  c: 'syslog({level}, "%s", {msg})'
+//	  params: [msg, level=LOG_INFO]
+//	  includes: [syslog.h]
+//
+// 键是调用的全名（import utils 后的 utils.log，from utils import log 后的 log 也是 utils.log），或者直接调用的名字。
+// 模板中 {0}、{1} 是按位置的实参，{名字} 是 params 中的参数（关键字实参也按名字对应，没有给出的用 = 之后的 C 代码），
+// {args} 是全部按位置的实参；{{ 与 }} 是大括号。实参每出现一次就求值一次
+
+// CallMap: 一个 Python 调用翻译成的 C 代码
+type CallMap struct {
+	C        string   `json:"c"`                  // C 表达式的模板
+	Params   []string `json:"params,omitempty"`   // 参数名，name=default 给出缺省的 C 代码
+	Includes []string `json:"includes,omitempty"` // 需要的头文件：x.h 为 <x.h>，"x.h" 为 #include "x.h"
+	Returns  string   `json:"returns,omitempty"`  // 结果的类型：int、float、str、bool 或 C 类型，空或 None 为没有结果
+}
+
+// callPlaceholder: 模板中的 {0}、{name}、{args}
+var callPlaceholder = regexp.MustCompile(`\{\{|\}\}|\{([A-Za-z_][A-Za-z0-9_]*|[0-9]+)\}`)
+
+// checkCallMaps: Options 检查：模板中的参数都有来源
+func checkCallMaps(calls map[string]CallMap) error {
+	for _, name := range sortedKeys(calls) {
+		m := calls[name]
+		if strings.TrimSpace(m.C) == "" {
+			return fmt.Errorf("Calls: %s has no C code", name)
+		}
+		params := map[string]bool{"args": true}
+		for _, p := range m.Params {
+			p = strings.TrimSpace(strings.SplitN(p, "=", 2)[0])
+			if !cIdent.MatchString(p) {
+				return fmt.Errorf("Calls: %s: parameter %q is not a name", name, p)
+			}
+			params[p] = true
+		}
+		for _, ph := range callPlaceholder.FindAllStringSubmatch(m.C, -1) {
+			if ph[1] == "" {
+				continue
+			}
+			if _, err := strconv.Atoi(ph[1]); err != nil && !params[ph[1]] {
+				return fmt.Errorf("Calls: %s: {%s} is neither an argument number nor one of params", name, ph[1])
+			}
+		}
+		if rest := callPlaceholder.ReplaceAllString(m.C, ""); strings.ContainsAny(rest, "{}") {
+			return fmt.Errorf("Calls: %s: unmatched brace in %q (write {{ and }} for braces)", name, m.C)
+		}
+	}
+	return nil
+}
+
+// callMapOf: fn 所调用的函数的映射，没有时为 nil
+func (g *generator) callMapOf(fn map[string]interface{}) (string, *CallMap) {
+	if len(g.optCalls) == 0 {
+		return "", nil
+	}
+	name := g.qualifiedCallName(fn)
+	if name == "" && fn["_type"] == "Name" {
+		name, _ = fn["id"].(string)
+		name = g.pythonName(name)
+	}
+	if m, ok := g.optCalls[name]; ok {
+		return name, &m
+	}
+	return "", nil
+}
+
+// mappedModule: module 中有函数在 Options.Calls 中或注册了 handler（plugin.go）：import 它不算没有翻译
+func (g *generator) mappedModule(module string) bool {
+	for _, names := range [][]string{sortedKeys(g.optCalls), sortedKeys(g.callHandlers)} {
+		for _, name := range names {
+			if strings.HasPrefix(name, module+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mappedCall: 按映射展开调用；实参不对应时报告
+func (g *generator) mappedCall(name string, m *CallMap, node ASTNode) string {
+	args, _ := node["args"].([]interface{})
+	keywords, _ := node["keywords"].([]interface{})
+	given := map[string]string{}
+	positional := []string{}
+	for _, a := range args {
+		positional = append(positional, g.toC(a.(map[string]interface{}), 0))
+	}
+	names := []string{}
+	for i, p := range m.Params {
+		parts := strings.SplitN(p, "=", 2)
+		pname := strings.TrimSpace(parts[0])
+		names = append(names, pname)
+		if i < len(positional) {
+			given[pname] = positional[i]
+		} else if len(parts) == 2 {
+			given[pname] = strings.TrimSpace(parts[1])
+		}
+	}
+	for _, k := range keywords {
+		km, _ := k.(map[string]interface{})
+		arg, _ := km["arg"].(string)
+		if !containsStr(names, arg) {
+			return g.unsupportedExpr(node, fmt.Sprintf("call: %s has no parameter %s in the call map", name, arg))
+		}
+		given[arg] = g.toC(km["value"].(map[string]interface{}), 0)
+	}
+	if len(m.Params) > 0 && len(positional) > len(m.Params) && !strings.Contains(m.C, "{args}") {
+		return g.unsupportedExpr(node, fmt.Sprintf("call: %s takes %d arguments in the call map", name, len(m.Params)))
+	}
+	var missing error
+	code := callPlaceholder.ReplaceAllStringFunc(m.C, func(ph string) string {
+		switch ph {
+		case "{{":
+			return "{"
+		case "}}":
+			return "}"
+		case "{args}":
+			return join(positional, ", ")
+		}
+		key := ph[1 : len(ph)-1]
+		if i, err := strconv.Atoi(key); err == nil {
+			if i < len(positional) {
+				return positional[i]
+			}
+		} else if v, ok := given[key]; ok {
+			return v
+		}
+		if missing == nil {
+			missing = fmt.Errorf("call: %s needs %s", name, key)
+		}
+		return ""
+	})
+	if missing != nil {
+		return g.unsupportedExpr(node, missing.Error())
+	}
+	for _, h := range m.Includes {
+		g.addInclude(h)
+	}
+	if !singleCall(code) {
+		code = "(" + code + ")"
+	}
+	return code
+}
+
+// addInclude: 包含头文件：x.h 与 <x.h> 为 #include <x.h>，"x.h" 为 #include "x.h"
+func (g *generator) addInclude(header string) {
+	if strings.HasPrefix(header, `"`) {
+		g.userIncludes[strings.Trim(header, `"`)] = true
+	} else {
+		g.includes[strings.Trim(header, "<>")] = true
+	}
+}
+
+// mappedCallType: 映射的调用在翻译中的类型
+func (g *generator) mappedCallType(m *CallMap) string {
+	switch m.Returns {
+	case "", "None", "void":
+		return "void"
+	case "int", "bool":
+		return "int"
+	case "float":
+		return "double"
+	case "str":
+		return "char*"
+	}
+	return m.Returns
+}
+
+// singleCall: code 是一个标识符加上括住其余部分的一对括号（f(a, b)），作为表达式不用再加括号
+func singleCall(code string) bool {
+	i := strings.IndexByte(code, '(')
+	if i <= 0 || !cIdent.MatchString(code[:i]) || !strings.HasSuffix(code, ")") {
+		return cIdent.MatchString(code)
+	}
+	depth := 0
+	for j := i; j < len(code); j++ {
+		switch code[j] {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 && j != len(code)-1 {
+				return false
+			}
+		case '"', '\'':
+			// 字符串中的括号不算
+			q := code[j]
+			for j++; j < len(code) && code[j] != q; j++ {
+				if code[j] == '\\' {
+					j++
+				}
+			}
+		}
+	}
+	return depth == 0
+}
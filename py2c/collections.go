@@ -0,0 +1,829 @@
+package py2c
+
+import (
+	"fmt"
+	"strings"
+)
+
+// collections 模块的 deque、Counter 与 defaultdict。每种元素（键、值）类型生成一组结构体与操作函数：
+//
+//	q = deque([1, 2])          PyDeque_int* q = PyDeque_int_from(_l0, -1);
+//	q.appendleft(0)            PyDeque_int_appendleft(q, 0);
+//	c = Counter(words)         PyCounter_charp* c = PyCounter_charp_from(words);
+//	c[w] += 1                  (*PyCounter_charp_at(c, w)) += 1;
+//	d = defaultdict(list)      PyDefaultDict_charp_PyList_intp* d = PyDefaultDict_charp_PyList_intp_new();
+//	d[k].append(n)             PyList_int_append((*PyDefaultDict_charp_PyList_intp_at(d, k)), n);
+//
+// deque 是环形缓冲区，满了容量翻倍；Counter 与 defaultdict 按插入顺序保存键与值，另有开放寻址的下标表。
+// 构造时没有实参决定的元素（键）类型按同一变量的第一处用法推断（q.append(x)、c[k]、d[k].append(v)），
+// 见 inferCollections；键只支持 int、float、str 与 Enum
+
+// collection: 一个 deque / Counter / defaultdict 类型
+type collection struct {
+	kind    string // deque、Counter 或 defaultdict
+	name    string // C 的类型名（不带 *）
+	key     string // Counter 与 defaultdict 的键的类型；deque 为空
+	value   string // deque 的元素、Counter 的计数（int）、defaultdict 的值的类型
+	factory string // defaultdict 的 int、float、str 或 list
+	emitted bool   // 结构体与操作函数已经输出
+}
+
+// defaultFactories: defaultdict 支持的默认值工厂与值的类型（list 的元素类型另外决定）
+var defaultFactories = map[string]string{"int": "int", "float": "double", "str": "char*", "list": ""}
+
+// collectionKind: deque(...)、Counter(...)、defaultdict(...)（或 collections.X(...)）调用的 X，不是时为空
+func (g *generator) collectionKind(node interface{}) string {
+	call, _ := node.(map[string]interface{})
+	if call["_type"] != "Call" {
+		return ""
+	}
+	switch q := g.importedName(call["func"]); q {
+	case "collections.deque", "collections.Counter", "collections.defaultdict":
+		return strings.TrimPrefix(q, "collections.")
+	}
+	return ""
+}
+
+// collectionCall: 构造调用的类型；不是构造调用时为 nil，翻译不了时 why 是原因
+func (g *generator) collectionCall(node interface{}) (c *collection, why string) {
+	kind := g.collectionKind(node)
+	if kind == "" {
+		return nil, ""
+	}
+	call := node.(map[string]interface{})
+	args, _ := call["args"].([]interface{})
+	keywords, _ := call["keywords"].([]interface{})
+	hint := func(field string) string {
+		if t, _ := call[field].(string); t != "" {
+			return t
+		}
+		return "double" // 与空列表一样
+	}
+	for _, k := range keywords {
+		if arg, _ := k.(map[string]interface{})["arg"].(string); kind != "deque" || arg != "maxlen" {
+			return nil, fmt.Sprintf("%s() with the keyword argument %s", kind, arg)
+		}
+	}
+	switch kind {
+	case "deque":
+		if len(args) > 2 {
+			return nil, "deque() with more than 2 arguments"
+		}
+		elem := hint("_elem")
+		if len(args) > 0 {
+			t, ok := g.listElemType(g.getType(args[0]))
+			if !ok {
+				return nil, "deque() of something other than a list"
+			}
+			elem = t
+		}
+		return g.collectionType(kind, "", elem, ""), ""
+	case "Counter":
+		if len(args) > 1 {
+			return nil, "Counter() with more than 1 argument"
+		}
+		key := hint("_key")
+		if len(args) > 0 {
+			t, ok := g.listElemType(g.getType(args[0]))
+			if !ok {
+				return nil, "Counter() of something other than a list"
+			}
+			key = t
+		}
+		if why := g.collectionKey(kind, key); why != "" {
+			return nil, why
+		}
+		return g.collectionType(kind, key, "int", ""), ""
+	}
+	f, _ := toNode(args, 0)["id"].(string)
+	value, ok := defaultFactories[f]
+	if len(args) != 1 || !ok || g.funcNodes[f] != nil {
+		return nil, "defaultdict() with a default factory other than int, float, str and list"
+	}
+	if f == "list" {
+		value = g.listType(hint("_elem"))
+	}
+	key := hint("_key")
+	if why := g.collectionKey(kind, key); why != "" {
+		return nil, why
+	}
+	return g.collectionType(kind, key, value, f), ""
+}
+
+// toNode: list 中第 i 个节点，没有时为空的节点
+func toNode(list []interface{}, i int) map[string]interface{} {
+	if i < len(list) {
+		m, _ := list[i].(map[string]interface{})
+		return m
+	}
+	return nil
+}
+
+// collectionKey: 键的类型不能做哈希时的原因
+func (g *generator) collectionKey(kind, key string) string {
+	switch {
+	case key == "int", key == "double", key == "char*", g.enums[key] != nil:
+		return ""
+	}
+	return fmt.Sprintf("%s with %s keys (only int, float, str and Enum keys are translated)", kind, key)
+}
+
+// collectionType: 登记并返回 kind 的这组类型；C 的代码在第一次构造时输出，见 emitCollection
+func (g *generator) collectionType(kind, key, value, factory string) *collection {
+	if g.classStructsMap[value] || g.annotClasses[value] {
+		value += "*" // 与列表一样按指针保存对象
+	}
+	name := "PyDeque_" + mangleType(value)
+	switch kind {
+	case "Counter":
+		name = "PyCounter_" + mangleType(key)
+	case "defaultdict":
+		name = "PyDefaultDict_" + mangleType(key) + "_" + mangleType(value)
+	}
+	if c := g.collections[name]; c != nil {
+		return c
+	}
+	c := &collection{kind: kind, name: name, key: key, value: value, factory: factory}
+	g.collections[name] = c
+	return c
+}
+
+// collectionOf: deque / Counter / defaultdict 的指针类型 t 对应的登记，其他类型为 nil
+func (g *generator) collectionOf(t string) *collection {
+	if !strings.HasSuffix(t, "*") {
+		return nil
+	}
+	return g.collections[strings.TrimSuffix(t, "*")]
+}
+
+// iterType: for x in c 的 x 的类型：deque 的元素，字典的键
+func (c *collection) iterType() string {
+	if c.kind == "deque" {
+		return c.value
+	}
+	return c.key
+}
+
+// --- 类型推断 ---
+
+// inferCollections: 构造时没有决定元素（键）类型的 deque()、Counter()、defaultdict(f)，按赋给的变量的第一处用法推断：
+// q.append(x)、q.appendleft(x)、q.extend(xs)、x in q 给出 deque 的元素，c[k]、k in c、c.update(xs) 给出键，
+// d[k].append(v) 给出 defaultdict(list) 的列表元素。结果记在构造调用节点的 _elem / _key 上，下一轮推断按它求类型
+func (g *generator) inferCollections(order []*inferScope) {
+	type ctorVar struct{ scope, id string }
+	ctors := map[ctorVar][]map[string]interface{}{}
+	for _, s := range order {
+		walkInferStmts(s.body, func(m map[string]interface{}) {
+			targets, _ := m["targets"].([]interface{})
+			target := toNode(targets, 0)
+			if id, _ := target["id"].(string); m["_type"] == "Assign" && len(targets) == 1 && target["_type"] == "Name" && g.collectionKind(m["value"]) != "" {
+				v := ctorVar{s.name, id}
+				ctors[v] = append(ctors[v], m["value"].(map[string]interface{}))
+			}
+		})
+	}
+	if len(ctors) == 0 {
+		return
+	}
+	hints := map[ctorVar]map[string]string{}
+	for _, s := range order {
+		// use: 名字 recv 的构造调用的 field 还没有推断出类型时取 expr 的类型（list 为 true 时取列表的元素类型）
+		use := func(recv interface{}, kinds, field string, expr interface{}, list bool) {
+			rm, _ := recv.(map[string]interface{})
+			id, _ := rm["id"].(string)
+			v := ctorVar{s.name, id}
+			if rm["_type"] != "Name" || len(ctors[v]) == 0 || !strings.Contains(kinds, g.collectionKind(ctors[v][0])) || hints[v][field] != "" {
+				return
+			}
+			t := g.typeIn(s.name, expr)
+			if list {
+				t, _ = g.listElemType(t)
+			}
+			if t != "" {
+				if hints[v] == nil {
+					hints[v] = map[string]string{}
+				}
+				hints[v][field] = t
+			}
+		}
+		walkInferStmts(s.body, func(m map[string]interface{}) {
+			walkNodes(m, func(n map[string]interface{}) {
+				fn, _ := n["func"].(map[string]interface{})
+				args, _ := n["args"].([]interface{})
+				switch {
+				case n["_type"] == "Call" && fn["_type"] == "Attribute" && len(args) == 1:
+					switch fn["attr"] {
+					case "append", "appendleft":
+						use(fn["value"], "deque", "_elem", args[0], false)
+						if sub, _ := fn["value"].(map[string]interface{}); sub["_type"] == "Subscript" && fn["attr"] == "append" {
+							use(sub["value"], "defaultdict", "_elem", args[0], false)
+						}
+					case "extend":
+						use(fn["value"], "deque", "_elem", args[0], true)
+					case "update":
+						use(fn["value"], "Counter", "_key", args[0], true)
+					}
+				case n["_type"] == "Subscript":
+					use(n["value"], "Counter defaultdict", "_key", n["slice"], false)
+				case n["_type"] == "Compare":
+					ops, _ := n["ops"].([]interface{})
+					comparators, _ := n["comparators"].([]interface{})
+					if op := toNode(ops, 0)["_type"]; len(ops) == 1 && (op == "In" || op == "NotIn") {
+						use(comparators[0], "deque", "_elem", n["left"], false)
+						use(comparators[0], "Counter defaultdict", "_key", n["left"], false)
+					}
+				}
+			})
+		})
+	}
+	for v, calls := range ctors {
+		for _, call := range calls {
+			for field, t := range hints[v] {
+				call[field] = t
+			}
+		}
+	}
+}
+
+// --- 代码生成 ---
+
+// emitCollection: 第一次构造时输出 c 的结构体与操作函数（放在 classStructs 中，元素可以是源码中的类）
+func (g *generator) emitCollection(c *collection) {
+	if c.emitted {
+		return
+	}
+	c.emitted = true
+	g.includes["stdlib.h"] = true
+	if c.kind == "deque" {
+		g.classStructs = append(g.classStructs, g.dequeCode(c))
+		return
+	}
+	g.classStructs = append(g.classStructs, g.dictCode(c))
+}
+
+// reprFormat: 容器的 str 中元素的格式与实参：字符串带引号，Enum 是 Color.RED
+func (g *generator) reprFormat(t, expr string) (string, string) {
+	if t == "char*" {
+		return "'%s'", expr
+	}
+	if e := g.enums[t]; e != nil {
+		return "%s", g.enumHelper(e, "repr") + "(" + expr + ")"
+	}
+	return g.typeFormat(t, expr)
+}
+
+// sameValue: 类型为 t 的两个值相等的 C 条件
+func (g *generator) sameValue(t, a, b string) string {
+	if t == "char*" {
+		g.includes["string.h"] = true
+		return fmt.Sprintf("!strcmp(%s, %s)", a, b)
+	}
+	return fmt.Sprintf("%s == %s", a, b)
+}
+
+// dequeCode: 环形缓冲区：items[(head + i) % cap] 是第 i 个元素；有 maxlen 时满了从另一端丢掉一个
+func (g *generator) dequeCode(c *collection) string {
+	elem, name := c.value, c.name
+	list := strings.TrimSuffix(g.listType(elem), "*")
+	itemFmt, itemArg := g.reprFormat(elem, "q->items[(q->head + i) % q->cap]")
+	// 容器持有元素的引用（-refcount、-owned-strings）：从其他列表复制时取得引用，丢掉时释放
+	item, drop := "l->items[i]", func(v string) string { return "(void)" + v + ";" }
+	if g.isRcType(elem) {
+		item = g.rcRef(elem, item)
+		drop = func(v string) string { return g.rcRelease(v) + ";" }
+	}
+	return fmt.Sprintf(`// collections.deque of %[2]s: a ring buffer, doubled when full; maxlen < 0 is unbounded
+typedef struct {
+    %[2]s* items;
+    int head;
+    int len;
+    int cap;
+    int maxlen;
+} %[1]s;
+static %[1]s* %[1]s_new(int maxlen) {
+    %[1]s* q = (%[1]s*)malloc(sizeof(%[1]s));
+    q->items = NULL;
+    q->head = 0;
+    q->len = 0;
+    q->cap = 0;
+    q->maxlen = maxlen;
+    return q;
+}
+static %[2]s* %[1]s_at(%[1]s* q, int i) {
+    if (i < 0) {
+        i += q->len;
+    }
+    if (i < 0 || i >= q->len) {
+        %[8]s
+    }
+    return &q->items[(q->head + i) %% q->cap];
+}
+// room for one more item: the ring is copied in order into a buffer twice as large
+static void %[1]s_grow(%[1]s* q) {
+    if (q->len < q->cap) {
+        return;
+    }
+    int cap = q->cap ? q->cap * 2 : 4;
+    %[2]s* items = (%[2]s*)malloc(cap * sizeof(%[2]s));
+    for (int i = 0; i < q->len; i++) {
+        items[i] = q->items[(q->head + i) %% q->cap];
+    }
+    free(q->items);
+    q->items = items;
+    q->head = 0;
+    q->cap = cap;
+}
+static %[2]s %[1]s_pop(%[1]s* q) {
+    if (q->len == 0) {
+        %[9]s
+    }
+    q->len--;
+    return q->items[(q->head + q->len) %% q->cap];
+}
+static %[2]s %[1]s_popleft(%[1]s* q) {
+    if (q->len == 0) {
+        %[9]s
+    }
+    %[2]s v = q->items[q->head];
+    q->head = (q->head + 1) %% q->cap;
+    q->len--;
+    return v;
+}
+static void %[1]s_append(%[1]s* q, %[2]s v) {
+    if (q->maxlen == 0) {
+        %[10]s
+        return;
+    }
+    if (q->len == q->maxlen) {
+        %[11]s
+    }
+    %[1]s_grow(q);
+    q->items[(q->head + q->len) %% q->cap] = v;
+    q->len++;
+}
+static void %[1]s_appendleft(%[1]s* q, %[2]s v) {
+    if (q->maxlen == 0) {
+        %[10]s
+        return;
+    }
+    if (q->len == q->maxlen) {
+        %[12]s
+    }
+    %[1]s_grow(q);
+    q->head = (q->head + q->cap - 1) %% q->cap;
+    q->items[q->head] = v;
+    q->len++;
+}
+static void %[1]s_extend(%[1]s* q, %[3]s* l) {
+    for (int i = 0; i < l->len; i++) {
+        %[1]s_append(q, %[7]s);
+    }
+}
+static %[1]s* %[1]s_from(%[3]s* l, int maxlen) {
+    %[1]s* q = %[1]s_new(maxlen);
+    %[1]s_extend(q, l);
+    return q;
+}
+static void %[1]s_clear(%[1]s* q) {
+    while (q->len > 0) {
+        %[12]s
+    }
+}
+// rotate(n): n steps to the right, to the left when n is negative
+static void %[1]s_rotate(%[1]s* q, int n) {
+    if (q->len <= 1) {
+        return;
+    }
+    n %%= q->len;
+    if (n < 0) {
+        n += q->len;
+    }
+    for (; n > 0; n--) {
+        %[1]s_appendleft(q, %[1]s_pop(q));
+    }
+}
+static int %[1]s_contains(%[1]s* q, %[2]s v) {
+    for (int i = 0; i < q->len; i++) {
+        if (%[13]s) {
+            return 1;
+        }
+    }
+    return 0;
+}
+static char* %[1]s_str(%[1]s* q) {
+    char* buf = %[6]s;
+    int n = snprintf(buf, PY_STRBUF_SIZE, "deque([");
+    for (int i = 0; i < q->len && n < PY_STRBUF_SIZE; i++) {
+        n += snprintf(buf + n, PY_STRBUF_SIZE - n, i ? ", %[4]s" : "%[4]s", %[5]s);
+    }
+    if (n < PY_STRBUF_SIZE && q->maxlen >= 0) {
+        snprintf(buf + n, PY_STRBUF_SIZE - n, "], maxlen=%%d)", q->maxlen);
+    } else if (n < PY_STRBUF_SIZE) {
+        snprintf(buf + n, PY_STRBUF_SIZE - n, "])");
+    }
+    return buf;
+}
+`, name, elem, list, itemFmt, itemArg, g.strBuf(), item, g.runtimeError("IndexError", "deque index out of range"), g.runtimeError("IndexError", "pop from an empty deque"),
+		drop("v"), drop(name+"_popleft(q)"), drop(name+"_pop(q)"), g.sameValue(elem, "q->items[(q->head + i) % q->cap]", "v"))
+}
+
+// dictCode: Counter 与 defaultdict：键与值按插入顺序放在数组中，slots 是开放寻址（线性探测）的下标表，
+// 放到一半时翻倍重建。键是字符串时保存一份副本（查找用的键可能是语句结束后就释放的临时字符串）
+func (g *generator) dictCode(c *collection) string {
+	name, key, value := c.name, c.key, c.value
+	hash := "unsigned long h = (unsigned long)k * 2654435761UL;\n    return h ^ h >> 16;"
+	switch key {
+	case "char*":
+		hash = "unsigned long h = 2166136261UL;\n    for (const unsigned char* p = (const unsigned char*)k; *p; p++) {\n        h = (h ^ *p) * 16777619UL;\n    }\n    return h;"
+	case "double":
+		g.includes["string.h"] = true
+		hash = "unsigned long long b;\n    k += 0.0; // -0.0 and 0.0 are one key\n    memcpy(&b, &k, sizeof b);\n    b ^= b >> 31;\n    b *= 0x9E3779B97F4A7C15ULL;\n    return (unsigned long)(b ^ b >> 29);"
+	}
+	stored := "k"
+	if key == "char*" {
+		stored = g.strDup() + "(k)"
+	}
+	keyFmt, keyArg := g.reprFormat(key, "d->keys[j]")
+	valueFmt, valueArg := g.reprFormat(value, "d->values[j]")
+	code := fmt.Sprintf(`// collections.%[4]s with %[2]s keys: keys and values in insertion order, found through an open-addressing table of their indexes
+typedef struct {
+    %[2]s* keys;
+    %[3]s* values;
+    int len;
+    int cap;
+    int* slots; // index + 1 of the key in each slot, 0 for an empty slot
+    int nslots;
+    int* order; // indexes by count for most_common()
+} %[1]s;
+static %[1]s* %[1]s_new(void) {
+    return (%[1]s*)calloc(1, sizeof(%[1]s));
+}
+static unsigned long %[1]s_hash(%[2]s k) {
+    %[5]s
+}
+static int %[1]s_find(%[1]s* d, %[2]s k) {
+    if (d->nslots == 0) {
+        return -1;
+    }
+    for (unsigned long s = %[1]s_hash(k) & (d->nslots - 1); d->slots[s]; s = (s + 1) & (d->nslots - 1)) {
+        if (%[6]s) {
+            return d->slots[s] - 1;
+        }
+    }
+    return -1;
+}
+static void %[1]s_place(%[1]s* d, int i) {
+    unsigned long s = %[1]s_hash(d->keys[i]) & (d->nslots - 1);
+    while (d->slots[s]) {
+        s = (s + 1) & (d->nslots - 1);
+    }
+    d->slots[s] = i + 1;
+}
+// a new key k with the value v; returns its index
+static int %[1]s_insert(%[1]s* d, %[2]s k, %[3]s v) {
+    if (d->len == d->cap) {
+        d->cap = d->cap ? d->cap * 2 : 8;
+        d->keys = (%[2]s*)realloc(d->keys, d->cap * sizeof(%[2]s));
+        d->values = (%[3]s*)realloc(d->values, d->cap * sizeof(%[3]s));
+    }
+    d->keys[d->len] = %[7]s;
+    d->values[d->len] = v;
+    d->len++;
+    if (2 * d->len > d->nslots) {
+        free(d->slots);
+        d->nslots = d->nslots ? d->nslots * 2 : 16;
+        d->slots = (int*)calloc(d->nslots, sizeof(int));
+        for (int i = 0; i < d->len; i++) {
+            %[1]s_place(d, i);
+        }
+    } else {
+        %[1]s_place(d, d->len - 1);
+    }
+    return d->len - 1;
+}
+// d[k]: the value of k, inserting the default value first when k is missing
+static %[3]s* %[1]s_at(%[1]s* d, %[2]s k) {
+    int i = %[1]s_find(d, k);
+    if (i < 0) {
+        i = %[1]s_insert(d, k, %[8]s);
+    }
+    return &d->values[i];
+}
+`, name, key, value, c.kind, hash, g.sameValue(key, "d->keys[d->slots[s] - 1]", "k"), stored, g.defaultValue(c))
+	buf := g.strBuf()
+	if c.kind == "defaultdict" {
+		return code + fmt.Sprintf(`static char* %[1]s_str(%[1]s* d) {
+    char* buf = %[2]s;
+    int n = snprintf(buf, PY_STRBUF_SIZE, "defaultdict(<class '%[3]s'>, {");
+    for (int j = 0; j < d->len && n < PY_STRBUF_SIZE; j++) {
+        n += snprintf(buf + n, PY_STRBUF_SIZE - n, j ? ", %[4]s: %[6]s" : "%[4]s: %[6]s", %[5]s, %[7]s);
+    }
+    if (n < PY_STRBUF_SIZE) {
+        snprintf(buf + n, PY_STRBUF_SIZE - n, "})");
+    }
+    return buf;
+}
+`, name, buf, c.factory, keyFmt, keyArg, valueFmt, valueArg)
+	}
+	list := strings.TrimSuffix(g.listType(key), "*")
+	keyArg = strings.ReplaceAll(keyArg, "d->keys[j]", "d->keys[d->order[j]]")
+	return code + fmt.Sprintf(`// c[k] of a missing key is 0 and does not insert it
+static int %[1]s_get(%[1]s* d, %[2]s k) {
+    int i = %[1]s_find(d, k);
+    return i < 0 ? 0 : d->values[i];
+}
+static void %[1]s_update(%[1]s* d, %[3]s* l) {
+    for (int i = 0; i < l->len; i++) {
+        (*%[1]s_at(d, l->items[i]))++;
+    }
+}
+static %[1]s* %[1]s_from(%[3]s* l) {
+    %[1]s* d = %[1]s_new();
+    %[1]s_update(d, l);
+    return d;
+}
+// most_common(): the indexes by count, highest first; equal counts keep insertion order
+static %[1]s* %[1]s_sorting;
+static int %[1]s_cmp(const void* a, const void* b) {
+    int x = *(const int*)a, y = *(const int*)b;
+    int cx = %[1]s_sorting->values[x], cy = %[1]s_sorting->values[y];
+    if (cx != cy) {
+        return cx > cy ? -1 : 1;
+    }
+    return x < y ? -1 : x > y;
+}
+static %[1]s* %[1]s_sort(%[1]s* d) {
+    d->order = (int*)realloc(d->order, (d->len ? d->len : 1) * sizeof(int));
+    for (int i = 0; i < d->len; i++) {
+        d->order[i] = i;
+    }
+    %[1]s_sorting = d;
+    qsort(d->order, d->len, sizeof(int), %[1]s_cmp);
+    return d;
+}
+static char* %[1]s_str(%[1]s* d) {
+    char* buf = %[4]s;
+    if (d->len == 0) {
+        snprintf(buf, PY_STRBUF_SIZE, "Counter()");
+        return buf;
+    }
+    %[1]s_sort(d);
+    int n = snprintf(buf, PY_STRBUF_SIZE, "Counter({");
+    for (int j = 0; j < d->len && n < PY_STRBUF_SIZE; j++) {
+        n += snprintf(buf + n, PY_STRBUF_SIZE - n, j ? ", %[5]s: %%d" : "%[5]s: %%d", %[6]s, d->values[d->order[j]]);
+    }
+    if (n < PY_STRBUF_SIZE) {
+        snprintf(buf + n, PY_STRBUF_SIZE - n, "})");
+    }
+    return buf;
+}
+`, name, key, list, buf, keyFmt, keyArg)
+}
+
+// defaultValue: d[k] 在 k 不存在时先放进去的值
+func (g *generator) defaultValue(c *collection) string {
+	switch c.factory {
+	case "float":
+		return "0.0"
+	case "str":
+		if g.isRcType("char*") {
+			return g.strDup() + "(\"\")" // 之后赋值时会释放它
+		}
+		return "\"\""
+	case "list":
+		return strings.TrimSuffix(c.value, "*") + "_new()"
+	}
+	return "0"
+}
+
+// collectionNew: 构造调用
+func (g *generator) collectionNew(c *collection, call map[string]interface{}) string {
+	g.emitCollection(c)
+	args, _ := call["args"].([]interface{})
+	switch c.kind {
+	case "deque":
+		maxlen := "-1"
+		if m := callKeyword(ASTNode(call), "maxlen"); m != nil && !isNoneConst(m) {
+			maxlen = g.toC(m, 0)
+		} else if m := toNode(args, 1); m != nil && !isNoneConst(m) {
+			maxlen = g.toC(m, 0)
+		}
+		if len(args) > 0 {
+			return fmt.Sprintf("%s_from(%s, %s)", c.name, g.toC(toNode(args, 0), 0), maxlen)
+		}
+		return fmt.Sprintf("%s_new(%s)", c.name, maxlen)
+	case "Counter":
+		if len(args) > 0 {
+			return fmt.Sprintf("%s_from(%s)", c.name, g.toC(toNode(args, 0), 0))
+		}
+	}
+	return c.name + "_new()"
+}
+
+// isNoneConst: 常量 None
+func isNoneConst(m map[string]interface{}) bool {
+	return m["_type"] == "Constant" && m["value"] == nil
+}
+
+// collectionSlot: q[i] / c[k] / d[k] 作为可以赋值的位置；c[k] 与 d[k] 在 k 不存在时先放进默认值
+func (g *generator) collectionSlot(c *collection, sub map[string]interface{}) string {
+	recv := g.toC(sub["value"].(map[string]interface{}), 0)
+	return fmt.Sprintf("(*%s_at(%s, %s))", c.name, recv, g.toC(sub["slice"].(map[string]interface{}), 0))
+}
+
+// collectionSubscript: 读取 q[i] / c[k] / d[k]；缺少的键在 Counter 中是 0（不放进去），在 defaultdict 中放进默认值
+func (g *generator) collectionSubscript(c *collection, sub map[string]interface{}) string {
+	if c.kind == "Counter" {
+		recv := g.toC(sub["value"].(map[string]interface{}), 0)
+		return fmt.Sprintf("%s_get(%s, %s)", c.name, recv, g.toC(sub["slice"].(map[string]interface{}), 0))
+	}
+	return g.collectionSlot(c, sub)
+}
+
+// collectionStore: q[i] = v / c[k] = v / d[k] = v
+func (g *generator) collectionStore(c *collection, target, value map[string]interface{}, indent int) string {
+	slot := g.collectionSlot(c, target)
+	v := g.toC(value, 0)
+	if g.isRcType(c.value) {
+		return g.rcStoreShared(slot, c.value, v, indent)
+	}
+	return fmt.Sprintf("%s%s = %s;\n", strings.Repeat(" ", indent*4), slot, v)
+}
+
+// handleAugAssign: 只翻译容器中数值的 c[k] += n（Counter、defaultdict(int)、deque）；其他的增量赋值仍然不支持
+func (g *generator) handleAugAssign(node ASTNode, indent int) string {
+	target, _ := node["target"].(map[string]interface{})
+	op, _ := node["op"].(map[string]interface{})
+	cop := map[string]string{"Add": "+=", "Sub": "-=", "Mult": "*="}[fmt.Sprint(op["_type"])]
+	if c := g.collectionOf(g.getType(target["value"])); target["_type"] == "Subscript" && c != nil && isNumericType(c.value) && cop != "" {
+		value := g.toC(node["value"].(map[string]interface{}), 0)
+		return fmt.Sprintf("%s%s %s %s;\n", strings.Repeat(" ", indent*4), g.collectionSlot(c, target), cop, value)
+	}
+	return g.handleUnsupported(node, indent)
+}
+
+// collectionTest: if q:、while q:、not q 中的容器：非空为真；其他类型的条件原样返回
+func (g *generator) collectionTest(node interface{}, expr string) string {
+	if t := g.getType(node); g.collectionOf(t) != nil || t == "PyMatch" {
+		return g.truthTest(expr, t)
+	}
+	return expr
+}
+
+// collectionContains: x in q / k in d（不放进默认值）
+func (g *generator) collectionContains(c *collection, op, left, right string) string {
+	not := ""
+	if op == "NotIn" {
+		not = "!"
+	}
+	if c.kind == "deque" {
+		return fmt.Sprintf("%s%s_contains(%s, %s)", not, c.name, right, left)
+	}
+	return fmt.Sprintf("%s(%s_find(%s, %s) >= 0)", not, c.name, right, left)
+}
+
+// collectionMethodType: q.pop() / q.popleft() 的类型，其他方法为空
+func (g *generator) collectionMethodType(fn map[string]interface{}) string {
+	if c := g.collectionOf(g.getType(fn["value"])); c != nil && c.kind == "deque" && (fn["attr"] == "pop" || fn["attr"] == "popleft") {
+		return c.value
+	}
+	return ""
+}
+
+// handleCollectionMethodCall: deque 的 append、appendleft、pop、popleft、extend、clear、rotate，Counter 的 update
+func (g *generator) handleCollectionMethodCall(fn map[string]interface{}, call map[string]interface{}) (string, bool) {
+	c := g.collectionOf(g.getType(fn["value"]))
+	if c == nil {
+		return "", false
+	}
+	recv := g.toC(fn["value"].(map[string]interface{}), 0)
+	args, _ := call["args"].([]interface{})
+	method, _ := fn["attr"].(string)
+	elem, _ := g.listElemType(g.getType(toNode(args, 0)))
+	switch {
+	case c.kind == "deque" && (method == "append" || method == "appendleft") && len(args) == 1:
+		v := g.toC(toNode(args, 0), 0)
+		if g.isRcType(c.value) {
+			v = g.rcRef(c.value, v) // 容器持有自己的引用
+		}
+		return fmt.Sprintf("%s_%s(%s, %s)", c.name, method, recv, g.upcastElem(c.value, args[0], v)), true
+	case c.kind == "deque" && (method == "pop" || method == "popleft") && len(args) == 0:
+		code := fmt.Sprintf("%s_%s(%s)", c.name, method, recv)
+		if g.optRefcount {
+			return g.rcHold(c.value, code), true // 取出容器的引用，与列表的 pop 相同
+		}
+		return code, true
+	case c.kind == "deque" && method == "extend" && len(args) == 1 && elem == c.value,
+		c.kind == "Counter" && method == "update" && len(args) == 1 && elem == c.key:
+		return fmt.Sprintf("%s_%s(%s, %s)", c.name, method, recv, g.toC(toNode(args, 0), 0)), true
+	case c.kind == "deque" && method == "clear" && len(args) == 0:
+		return fmt.Sprintf("%s_clear(%s)", c.name, recv), true
+	case c.kind == "deque" && method == "rotate" && len(args) <= 1:
+		n := "1"
+		if len(args) == 1 {
+			n = g.toC(toNode(args, 0), 0)
+		}
+		return fmt.Sprintf("%s_rotate(%s, %s)", c.name, recv, n), true
+	case method == "extend" || method == "update":
+		return g.unsupportedExpr(call, fmt.Sprintf("call: %s.%s() of something other than a list of %s", c.kind, method, c.iterType())), true
+	case method == "most_common" || method == "keys" || method == "values" || method == "items":
+		return g.unsupportedExpr(call, fmt.Sprintf("call: %s.%s() is only translated as the iterable of a for loop", c.kind, method)), true
+	}
+	return g.unsupportedExpr(call, fmt.Sprintf("call: %s method %s", c.kind, method)), true
+}
+
+// collectionView: for 循环的 iter 是 d.keys() / d.values() / d.items() / c.most_common(n) 时的容器与方法
+func (g *generator) collectionView(iter map[string]interface{}) (c *collection, recv map[string]interface{}, view string) {
+	fn, _ := iter["func"].(map[string]interface{})
+	if iter["_type"] != "Call" || fn["_type"] != "Attribute" {
+		return nil, nil, ""
+	}
+	if c := g.collectionOf(g.getType(fn["value"])); c != nil && c.kind != "deque" {
+		switch fn["attr"] {
+		case "keys", "values", "items", "most_common":
+			return c, fn["value"].(map[string]interface{}), fn["attr"].(string)
+		}
+	}
+	return nil, nil, ""
+}
+
+// collectionIterType: for 循环中 q、d、d.keys()、d.values() 的元素类型；不是容器（或是成对的元素）时为空
+func (g *generator) collectionIterType(iter map[string]interface{}, typeOf func(interface{}) string) string {
+	if c := g.collectionOf(typeOf(iter)); c != nil {
+		return c.iterType()
+	}
+	switch c, _, view := g.collectionView(iter); view {
+	case "keys":
+		return c.key
+	case "values":
+		return c.value
+	}
+	return ""
+}
+
+// handleForCollection: for x in q、for k in d（或 d.keys()）、for v in d.values()、
+// for k, v in d.items()、for k, n in c.most_common(m)：按下标遍历；most_common 先把下标按计数排序
+func (g *generator) handleForCollection(node ASTNode, indent int) (string, bool) {
+	pad := strings.Repeat(" ", indent*4)
+	iter := node["iter"].(map[string]interface{})
+	c, recvNode, view := g.collectionView(iter)
+	if c == nil {
+		if c = g.collectionOf(g.getType(iter)); c == nil {
+			return "", false
+		}
+		recvNode = iter
+	}
+	target := node["target"].(map[string]interface{})
+	targets := []interface{}{target}
+	if view == "items" || view == "most_common" {
+		targets, _ = target["elts"].([]interface{})
+		if target["_type"] != "Tuple" || len(targets) != 2 {
+			return pad + g.unsupportedExpr(node, fmt.Sprintf("for loop: %s() needs two targets", view)) + "\n", true
+		}
+	}
+	pre, recv := g.exprWithPre(recvNode, indent)
+	if recvNode["_type"] != "Name" {
+		tmp, decl := g.loopTemp("_c", c.name+"*")
+		g.declareTemp(tmp, c.name+"*")
+		pre += fmt.Sprintf("%s%s = %s;\n", pad, decl, recv)
+		recv = tmp
+	}
+	idx, idxDecl := g.loopTemp("_i", "int")
+	cond, at := fmt.Sprintf("%s < %s->len", idx, recv), idx
+	if view == "most_common" {
+		pre += fmt.Sprintf("%s%s_sort(%s);\n", pad, c.name, recv)
+		at = fmt.Sprintf("%s->order[%s]", recv, idx)
+		if args, _ := iter["args"].([]interface{}); len(args) == 1 {
+			end, endDecl := g.loopTemp("_end", "int")
+			pre += fmt.Sprintf("%s%s = %s;\n", pad, endDecl, g.toC(toNode(args, 0), 0))
+			cond += fmt.Sprintf(" && %s < %s", idx, end)
+		}
+	}
+	g.pushScope(scopeBlock, "for")
+	defer g.popScope()
+	declare := func(t interface{}, typ, value string) string {
+		name := g.toC(t.(map[string]interface{}), 0)
+		if !g.isDeclared(name) {
+			g.declareVar(name, typ)
+			return fmt.Sprintf("%s    %s %s = %s;\n", pad, typ, name, value)
+		}
+		if g.isRcType(typ) && g.isOwned(name) {
+			return g.rcStore(name, typ, value, indent+1)
+		}
+		return fmt.Sprintf("%s    %s = %s;\n", pad, name, value)
+	}
+	body := ""
+	switch {
+	case c.kind == "deque":
+		body = declare(target, c.value, fmt.Sprintf("(*%s_at(%s, %s))", c.name, recv, idx))
+	case view == "" || view == "keys":
+		body = declare(target, c.key, fmt.Sprintf("%s->keys[%s]", recv, at))
+	case view == "values":
+		body = declare(target, c.value, fmt.Sprintf("%s->values[%s]", recv, at))
+	default:
+		body = declare(targets[0], c.key, fmt.Sprintf("%s->keys[%s]", recv, at)) + declare(targets[1], c.value, fmt.Sprintf("%s->values[%s]", recv, at))
+	}
+	defer g.enterLoop()()
+	body += g.stmtsToC(node["body"], indent+1)
+	return fmt.Sprintf("%s%sfor (%s = 0; %s; %s++) {\n%s%s}\n", pre, pad, idxDecl, cond, idx, body, pad), true
+}
@@ -0,0 +1,202 @@
+package py2c
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// -comments：AST 中没有注释，从 Python 源码中找出 # 注释，按行号放回生成的 C 代码。
+// 单独一行的注释放在下一条语句之前，行尾的注释放在所在的语句之前；文件开头与其后的语句隔着空行的注释
+// 放在 C 文件开头，最后一条语句之后的放在文件末尾
+
+// pyComments: 一个模块的注释
+type pyComments struct {
+	stmts map[[2]int][]string // 语句的 行, 列 -> 放在它之前的注释
+	lead  []string            // 文件开头的注释
+	tail  []string            // 文件末尾的注释
+}
+
+// pyComment: 源码中的一条 # 注释
+type pyComment struct {
+	line int
+	text string
+	own  bool // 单独一行（前面没有代码）
+}
+
+// pyStmt: 语句在源码中的范围
+type pyStmt struct {
+	line, end, col int
+}
+
+// codingCookie: PEP 263 的编码声明，在 C 中没有意义
+var codingCookie = regexp.MustCompile(`^[ \t\f]*#.*?coding[:=]`)
+
+// scanComments: 找出源码中不在字符串里的 # 注释；不含第一行的 #! 与前两行中的编码声明
+func scanComments(source []string) []pyComment {
+	comments := []pyComment{}
+	quote := "" // 跨行的三引号字符串
+	for n, line := range source {
+		start := quote == ""
+		for i := 0; i < len(line); i++ {
+			if quote != "" {
+				if line[i] == '\\' {
+					i++
+				} else if strings.HasPrefix(line[i:], quote) {
+					i += len(quote) - 1
+					quote = ""
+				}
+				continue
+			}
+			switch c := line[i]; c {
+			case '#':
+				skip := (n == 0 && strings.HasPrefix(line[i:], "#!")) || (n < 2 && codingCookie.MatchString(line))
+				if !skip {
+					text := strings.TrimPrefix(strings.TrimRight(line[i+1:], " \t\r"), " ")
+					comments = append(comments, pyComment{n + 1, text, start && strings.TrimSpace(line[:i]) == ""})
+				}
+				i = len(line)
+			case '\'', '"':
+				if strings.HasPrefix(line[i:], strings.Repeat(string(c), 3)) {
+					quote = strings.Repeat(string(c), 3)
+					i += 2
+					continue
+				}
+				for i++; i < len(line) && line[i] != c; i++ {
+					if line[i] == '\\' {
+						i++
+					}
+				}
+			}
+		}
+	}
+	return comments
+}
+
+// collectComments: 把源码中的注释分给 AST 中的语句
+func collectComments(root ASTNode, source []string) *pyComments {
+	c := &pyComments{stmts: map[[2]int][]string{}}
+	stmts := []pyStmt{}
+	var visit func(node interface{})
+	visit = func(node interface{}) {
+		switch n := node.(type) {
+		case []interface{}:
+			for _, e := range n {
+				visit(e)
+			}
+		case map[string]interface{}:
+			if typ, _ := n["_type"].(string); pyStmtTypes[typ] {
+				s := pyStmt{line: posOf(n, "lineno"), col: posOf(n, "col_offset")}
+				if s.end = posOf(n, "end_lineno"); s.end < s.line {
+					s.end = s.line
+				}
+				if s.line > 0 {
+					stmts = append(stmts, s)
+				}
+			}
+			for _, v := range n {
+				visit(v)
+			}
+		}
+	}
+	visit(root["body"])
+	sort.SliceStable(stmts, func(i, j int) bool {
+		return stmts[i].line < stmts[j].line || stmts[i].line == stmts[j].line && stmts[i].col < stmts[j].col
+	})
+	if len(stmts) == 0 {
+		for _, cm := range scanComments(source) {
+			c.lead = append(c.lead, cm.text)
+		}
+		return c
+	}
+	// 文件开头的注释中，紧挨着第一条语句（中间没有空行）的一段属于这条语句；模块的文档字符串之前的都在文件开头
+	first := stmts[0].line
+	for first > 1 && first-2 < len(source) && strings.HasPrefix(strings.TrimSpace(source[first-2]), "#") {
+		first--
+	}
+	if _, ok := docstring(root["body"]); ok {
+		first = stmts[0].end + 1
+	}
+	for _, cm := range scanComments(source) {
+		if cm.line < first {
+			c.lead = append(c.lead, cm.text)
+			continue
+		}
+		var inside, next *pyStmt
+		for i := range stmts {
+			s := &stmts[i]
+			if s.line <= cm.line && cm.line <= s.end && (inside == nil || s.line > inside.line) {
+				inside = s
+			}
+			if s.line > cm.line && next == nil {
+				next = s
+			}
+		}
+		// 单独一行的注释属于下一条语句，除非它在一条语句（多行的表达式）的中间
+		to := inside
+		if inside == nil || cm.own && next != nil && next.line <= inside.end {
+			to = next
+		}
+		if to == nil {
+			c.tail = append(c.tail, cm.text)
+			continue
+		}
+		key := [2]int{to.line, to.col}
+		c.stmts[key] = append(c.stmts[key], cm.text)
+	}
+	return c
+}
+
+// pyStmtTypes: Python 的语句节点
+var pyStmtTypes = map[string]bool{
+	"FunctionDef": true, "AsyncFunctionDef": true, "ClassDef": true, "Return": true, "Delete": true,
+	"Assign": true, "AugAssign": true, "AnnAssign": true, "For": true, "AsyncFor": true, "While": true,
+	"If": true, "With": true, "AsyncWith": true, "Match": true, "Raise": true, "Try": true, "TryStar": true,
+	"Assert": true, "Import": true, "ImportFrom": true, "Global": true, "Nonlocal": true, "Expr": true,
+	"Pass": true, "Break": true, "Continue": true, "TypeAlias": true,
+}
+
+// posOf: 节点的行号或列号，没有时为 0
+func posOf(node map[string]interface{}, key string) int {
+	n, _ := strconv.Atoi(fmt.Sprint(node[key]))
+	return n
+}
+
+// comments: 放在语句之前的 // 注释
+func (g *generator) comments(node map[string]interface{}, indent int) string {
+	if g.pyComments == nil {
+		return ""
+	}
+	return commentLines(g.pyComments.stmts[[2]int{posOf(node, "lineno"), posOf(node, "col_offset")}], strings.Repeat(" ", indent*4))
+}
+
+// commentLines: 注释文本输出为 // 行；行尾的 \ 在 C 中会把下一行也变成注释，去掉
+func commentLines(texts []string, pad string) string {
+	out := ""
+	for _, t := range texts {
+		t = strings.TrimRight(strings.TrimRight(t, "\\"), " \t")
+		if t == "" {
+			out += pad + "//\n"
+			continue
+		}
+		out += pad + "// " + t + "\n"
+	}
+	return out
+}
+
+// fileComments: C 文件开头与末尾的注释
+func (g *generator) fileComments() (lead, tail string) {
+	if g.pyComments == nil {
+		return "", ""
+	}
+	lead, tail = commentLines(g.pyComments.lead, ""), commentLines(g.pyComments.tail, "")
+	if lead != "" {
+		lead += "\n"
+	}
+	if tail != "" {
+		tail = "\n" + tail
+	}
+	return lead, tail
+}
@@ -0,0 +1,75 @@
+package py2c
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// 翻译覆盖率：翻译时遇到的 Python 语句中有多少完整地翻译了，不能翻译的写法（错误诊断）是哪些、在哪里。
+// 用来估计移植一个代码库还要做多少工作
+
+// Coverage: 一次翻译的覆盖率
+type Coverage struct {
+	Statements int            `json:"statements"` // 翻译时遇到的 Python 语句（函数与类的定义也算）
+	Translated int            `json:"translated"` // 其中没有报告错误的；错误算在最内层的语句上，函数中有一条语句没有翻译时函数本身仍然算翻译了
+	Percent    float64        `json:"percent"`    // Translated / Statements，百分数；没有语句时为 100
+	ByNode     map[string]int `json:"by_node"`    // 没有翻译的节点类型 -> 次数
+	Dropped    []Diagnostic   `json:"dropped"`    // 没有翻译的写法：错误诊断，按位置排序
+}
+
+// Add: 合并另一次翻译的覆盖率（-batch 的总计）
+func (c *Coverage) Add(o Coverage) {
+	c.Statements += o.Statements
+	c.Translated += o.Translated
+	if c.ByNode == nil {
+		c.ByNode = map[string]int{}
+	}
+	for k, n := range o.ByNode {
+		c.ByNode[k] += n
+	}
+	c.Dropped = append(c.Dropped, o.Dropped...)
+	sort.SliceStable(c.Dropped, func(i, j int) bool { return diagLess(c.Dropped[i], c.Dropped[j]) })
+	c.Percent = coveragePercent(c.Translated, c.Statements)
+}
+
+// coveragePercent: 保留一位小数的百分数
+func coveragePercent(translated, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return math.Round(float64(translated)*1000/float64(total)) / 10
+}
+
+// coverStmt: toC 进入一条有位置的 Python 语句：记下它，返回恢复外层语句的函数
+func (g *generator) coverStmt(node ASTNode) func() {
+	key := fmt.Sprintf("%s:%v:%v:%v", g.pyFile, node["lineno"], node["col_offset"], node["_type"])
+	g.covStmts[key] = true
+	saved := g.covStmt
+	g.covStmt = key
+	return func() { g.covStmt = saved }
+}
+
+// coverage: 翻译结束时的覆盖率
+func (g *generator) coverage() Coverage {
+	c := Coverage{Statements: len(g.covStmts), ByNode: map[string]int{}, Dropped: []Diagnostic{}}
+	for key := range g.covStmts {
+		if !g.covDropped[key] {
+			c.Translated++
+		}
+	}
+	for _, d := range g.diagnostics {
+		if d.Severity != "error" {
+			continue
+		}
+		node := d.Node
+		if node == "" {
+			node = "?"
+		}
+		c.ByNode[node]++
+		c.Dropped = append(c.Dropped, d)
+	}
+	sort.SliceStable(c.Dropped, func(i, j int) bool { return diagLess(c.Dropped[i], c.Dropped[j]) })
+	c.Percent = coveragePercent(c.Translated, c.Statements)
+	return c
+}
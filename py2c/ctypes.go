@@ -0,0 +1,368 @@
+package py2c
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ctypes：已经用 ctypes 调用 C 库的脚本，调用直接生成对库函数的调用。
+//
+//	lib = ctypes.CDLL("libfoo.so")
+//	lib.bar.argtypes = [ctypes.c_int, ctypes.c_double]
+//	lib.bar.restype = ctypes.c_double
+//	print(lib.bar(1, 2.5))
+//
+// 载入库与设置 argtypes / restype 的顶层语句去掉，库函数在第一次调用之前声明为 extern 原型（与 @py2c.extern 相同，见 extern.go），
+// 没有 argtypes 时参数类型按第一次调用的实参；C 库与数学库中常见的函数包含声明它的头文件。
+// 需要链接的库记在 Output.Libraries 中
+
+// ctypesLib: ctypes.CDLL 载入的库
+type ctypesLib struct {
+	file string // CDLL 的参数（libfoo.so），find_library("foo") 时为 libfoo
+	link string // 链接时的 -l 名字（foo），C 库为空
+}
+
+// ctypesFunc: 库中调用的函数
+type ctypesFunc struct {
+	argtypes []string    // .argtypes 给出的参数类型，nil 为没有给出
+	restype  string      // .restype，空为 ctypes 的默认 c_int，void 为 None
+	spec     *externSpec // 第一次调用时声明
+}
+
+// ctypesTypes: ctypes 的类型 -> C 类型
+var ctypesTypes = map[string]string{
+	"c_bool": "_Bool", "c_char": "char", "c_byte": "signed char", "c_ubyte": "unsigned char",
+	"c_short": "short", "c_ushort": "unsigned short", "c_int": "int", "c_uint": "unsigned int",
+	"c_long": "long", "c_ulong": "unsigned long", "c_longlong": "long long", "c_ulonglong": "unsigned long long",
+	"c_size_t": "size_t", "c_ssize_t": "ptrdiff_t", "c_float": "float", "c_double": "double", "c_longdouble": "long double",
+	"c_char_p": "char*", "c_void_p": "void*", "c_wchar": "wchar_t", "c_wchar_p": "wchar_t*",
+	"c_int8": "int8_t", "c_uint8": "uint8_t", "c_int16": "int16_t", "c_uint16": "uint16_t",
+	"c_int32": "int32_t", "c_uint32": "uint32_t", "c_int64": "int64_t", "c_uint64": "uint64_t",
+}
+
+// ctypesLoaders: 载入库的调用
+var ctypesLoaders = map[string]bool{
+	"ctypes.CDLL": true, "ctypes.cdll.LoadLibrary": true, "ctypes.WinDLL": true, "ctypes.windll.LoadLibrary": true,
+}
+
+// collectCtypes: 登记 ctypes 载入的库与 argtypes / restype，去掉这些顶层语句。在 checkUnbound 之后运行：
+// 去掉的赋值不会让后面对库的使用成为没有定义的名字
+func (g *generator) collectCtypes(root ASTNode) {
+	body, _ := root["body"].([]interface{})
+	names := ctypesNames(body)
+	if len(names) == 0 {
+		return
+	}
+	kept := []interface{}{}
+	for _, s := range body {
+		if m, _ := s.(map[string]interface{}); m != nil && g.ctypesStmt(m, names) {
+			continue
+		}
+		kept = append(kept, s)
+	}
+	root["body"] = kept
+}
+
+// ctypesNames: 顶层 import 绑定的 ctypes 名字：本地名 -> ctypes 中的全名（import ctypes as ct 时 ct -> ctypes）
+func ctypesNames(body []interface{}) map[string]string {
+	names := map[string]string{}
+	for _, s := range body {
+		m, _ := s.(map[string]interface{})
+		aliases, _ := m["names"].([]interface{})
+		for _, a := range aliases {
+			am, _ := a.(map[string]interface{})
+			name, _ := am["name"].(string)
+			local, _ := am["asname"].(string)
+			switch {
+			case m["_type"] == "Import" && (name == "ctypes" || strings.HasPrefix(name, "ctypes.")):
+				if local == "" {
+					local, name = "ctypes", "ctypes" // import ctypes.util 绑定 ctypes
+				}
+				names[local] = name
+			case m["_type"] == "ImportFrom" && (m["module"] == "ctypes" || m["module"] == "ctypes.util"):
+				if local == "" {
+					local = name
+				}
+				names[local] = fmt.Sprintf("%v.%s", m["module"], name)
+			}
+		}
+	}
+	return names
+}
+
+// ctypesQual: names 中的名字及其属性的全名（ct.cdll.LoadLibrary -> ctypes.cdll.LoadLibrary），不是 ctypes 的为空
+func ctypesQual(node interface{}, names map[string]string) string {
+	m, _ := node.(map[string]interface{})
+	switch m["_type"] {
+	case "Name":
+		id, _ := m["id"].(string)
+		return names[id]
+	case "Attribute":
+		if q := ctypesQual(m["value"], names); q != "" {
+			return fmt.Sprintf("%s.%v", q, m["attr"])
+		}
+	}
+	return ""
+}
+
+// ctypesStmt: 载入库、设置 argtypes / restype 的语句登记后返回 true（从模块中去掉）
+func (g *generator) ctypesStmt(m map[string]interface{}, names map[string]string) bool {
+	targets, _ := m["targets"].([]interface{})
+	if m["_type"] != "Assign" || len(targets) != 1 {
+		return false
+	}
+	target, _ := targets[0].(map[string]interface{})
+	value, _ := m["value"].(map[string]interface{})
+	if call := value; target["_type"] == "Name" && call["_type"] == "Call" && ctypesLoaders[ctypesQual(call["func"], names)] {
+		lib, ok := g.ctypesLibrary(call, names)
+		if ok {
+			g.ctypesLibs[target["id"].(string)] = lib
+		}
+		return ok
+	}
+	// lib.bar.argtypes = [...] / lib.bar.restype = ...
+	fn, _ := target["value"].(map[string]interface{})
+	recv, _ := fn["value"].(map[string]interface{})
+	id, _ := recv["id"].(string)
+	if target["_type"] != "Attribute" || fn["_type"] != "Attribute" || recv["_type"] != "Name" || g.ctypesLibs[id] == nil {
+		return false
+	}
+	key := fmt.Sprintf("%s.%v", id, fn["attr"])
+	f := g.ctypesFuncs[key]
+	if f == nil {
+		f = &ctypesFunc{}
+		g.ctypesFuncs[key] = f
+	}
+	switch target["attr"] {
+	case "argtypes":
+		elts, _ := value["elts"].([]interface{})
+		if value["_type"] != "List" && value["_type"] != "Tuple" {
+			g.report(logError, m, "ctypes: %s.argtypes must be a list of ctypes types", key)
+			return true
+		}
+		types := []string{}
+		for _, e := range elts {
+			t := g.ctypesType(e, names)
+			if t == "" || t == "void" {
+				g.report(logError, e, "ctypes: %s.argtypes: not a ctypes type py2c knows", key)
+				return true
+			}
+			types = append(types, t)
+		}
+		f.argtypes = types
+	case "restype":
+		t := g.ctypesType(value, names)
+		if t == "" {
+			g.report(logError, value, "ctypes: %s.restype: not a ctypes type py2c knows", key)
+			return true
+		}
+		f.restype = t
+	default:
+		return false
+	}
+	return true
+}
+
+// ctypesLibrary: CDLL("libfoo.so") 或 CDLL(ctypes.util.find_library("foo")) 载入的库；不是常量时报告错误
+func (g *generator) ctypesLibrary(call map[string]interface{}, names map[string]string) (*ctypesLib, bool) {
+	args, _ := call["args"].([]interface{})
+	arg := map[string]interface{}{}
+	if len(args) > 0 {
+		arg, _ = args[0].(map[string]interface{})
+	}
+	if file, ok := arg["value"].(string); ok && arg["_type"] == "Constant" {
+		return &ctypesLib{file: file, link: ctypesLink(file)}, true
+	}
+	inner, _ := arg["args"].([]interface{})
+	if arg["_type"] == "Call" && ctypesQual(arg["func"], names) == "ctypes.util.find_library" && len(inner) == 1 {
+		if name, ok := inner[0].(map[string]interface{})["value"].(string); ok {
+			return &ctypesLib{file: "lib" + name, link: ctypesLink(name)}, true
+		}
+	}
+	g.report(logError, call, "ctypes: the library must be a string or ctypes.util.find_library(\"name\")")
+	return nil, false
+}
+
+// ctypesLink: 库文件名对应的 -l 名字：./libfoo.so.1 -> foo；C 库（libc、msvcrt）为空
+func ctypesLink(file string) string {
+	name := strings.TrimPrefix(filepath.Base(file), "lib")
+	for _, ext := range []string{".so", ".dylib", ".dll", ".a"} {
+		if i := strings.Index(name, ext); i > 0 {
+			name = name[:i]
+		}
+	}
+	if name == "c" || name == "msvcrt" || name == "ucrtbase" {
+		return ""
+	}
+	return name
+}
+
+// ctypesType: argtypes / restype 中的类型：ctypes.c_int、ctypes.POINTER(t)；None 为 void
+func (g *generator) ctypesType(node interface{}, names map[string]string) string {
+	m, _ := node.(map[string]interface{})
+	if m["_type"] == "Constant" && m["value"] == nil {
+		return "void"
+	}
+	if m["_type"] == "Call" && ctypesQual(m["func"], names) == "ctypes.POINTER" {
+		if args, _ := m["args"].([]interface{}); len(args) == 1 {
+			if t := g.ctypesType(args[0], names); t != "" && t != "void" {
+				return t + "*"
+			}
+		}
+		return ""
+	}
+	return g.ctypesCType(ctypesQual(node, names))
+}
+
+// ctypesCType: ctypes.c_xxx 对应的 C 类型，包含声明它的头文件；不是 ctypes 的类型为空
+func (g *generator) ctypesCType(qname string) string {
+	if !strings.HasPrefix(qname, "ctypes.") {
+		return ""
+	}
+	t := ctypesTypes[strings.TrimPrefix(qname, "ctypes.")]
+	switch {
+	case strings.HasPrefix(t, "int") && strings.HasSuffix(t, "_t"), strings.HasPrefix(t, "uint"):
+		g.includes["stdint.h"] = true
+	case t == "ptrdiff_t", strings.HasPrefix(t, "wchar_t"):
+		g.includes["stddef.h"] = true
+	}
+	return t
+}
+
+// ctypesFuncOf: fn（lib.bar）是库函数时的登记，没有登记过 argtypes / restype 时新建
+func (g *generator) ctypesFuncOf(fn map[string]interface{}) (*ctypesLib, string, *ctypesFunc) {
+	recv, _ := fn["value"].(map[string]interface{})
+	id, _ := recv["id"].(string)
+	lib := g.ctypesLibs[id]
+	if fn["_type"] != "Attribute" || recv["_type"] != "Name" || lib == nil {
+		return nil, "", nil
+	}
+	name, _ := fn["attr"].(string)
+	f := g.ctypesFuncs[id+"."+name]
+	if f == nil {
+		f = &ctypesFunc{}
+		g.ctypesFuncs[id+"."+name] = f
+	}
+	return lib, name, f
+}
+
+// handleCtypesCall: lib.bar(...) 生成 bar(...)，第一次调用时声明
+func (g *generator) handleCtypesCall(fn map[string]interface{}, node ASTNode) (string, bool) {
+	lib, name, f := g.ctypesFuncOf(fn)
+	if f == nil {
+		return "", false
+	}
+	if f.spec == nil {
+		spec := &externSpec{cName: name, ret: f.restype}
+		if spec.ret == "" {
+			spec.ret = "int"
+		}
+		types := f.argtypes
+		if types == nil {
+			args, _ := node["args"].([]interface{})
+			for i, a := range args {
+				t := g.ctypesArgType(a)
+				if t == "" {
+					return g.unsupportedExpr(node, fmt.Sprintf("call: the C type of argument %d of %s is not known; set %s.%s.argtypes", i+1, name, fn["value"].(map[string]interface{})["id"], name)), true
+				}
+				types = append(types, t)
+			}
+		}
+		for i, t := range types {
+			spec.params = append(spec.params, irParam{fmt.Sprintf("arg%d", i), t})
+		}
+		f.spec = spec
+		g.ctypesDecl(lib, spec)
+	}
+	return g.externCall(f.spec, node), true
+}
+
+// ctypesArgType: 没有 argtypes 时实参对应的 C 类型（ctypes 按实参转换：int、bytes/str 与 ctypes 的值）
+func (g *generator) ctypesArgType(arg interface{}) string {
+	m, _ := arg.(map[string]interface{})
+	if fn, _ := m["func"].(map[string]interface{}); m["_type"] == "Call" {
+		if t := g.ctypesCType(g.qualifiedCallName(fn)); t != "" {
+			return t
+		}
+	}
+	switch t := g.getType(arg); {
+	case t == "int" || t == "double" || t == "char*" || strings.HasSuffix(t, "*"):
+		return t
+	}
+	return ""
+}
+
+// ctypesDecl: 库函数的声明：常见的 C 库函数包含头文件，其他输出 extern 原型
+func (g *generator) ctypesDecl(lib *ctypesLib, spec *externSpec) {
+	if h := cLibHeader[spec.cName]; h != "" && (lib.link == "" || lib.link == "m") {
+		switch {
+		case h == "math.h":
+			g.usesPow = true // 包含 <math.h>，链接 -lm
+		case posixHeaders[h]:
+			g.usesPosix = true
+			g.posixIncludes[h] = true
+		case h != "stdio.h":
+			g.includes[h] = true
+		}
+		return
+	}
+	if lib.link != "" {
+		g.ctypesLinks[lib.link] = true
+	}
+	note := fmt.Sprintf("// %s: from %s\n", spec.cName, lib.file)
+	if lib.link != "" {
+		note = fmt.Sprintf("// %s: from %s, link with -l%s\n", spec.cName, lib.file, lib.link)
+	}
+	f := &irFunc{name: spec.cName, ret: spec.ret, params: spec.params}
+	g.classStructs = append(g.classStructs, note+"extern "+g.emit.emitPrototype(f))
+}
+
+// ctypesValue: ctypes 的值：c_int(x) 是 (int)x，byref(x) 与 pointer(x) 是 &x，sizeof(c_int) 是 sizeof(int)
+func (g *generator) ctypesValue(qname string, node ASTNode) (string, bool) {
+	args, _ := node["args"].([]interface{})
+	arg := func(i int) string { return g.toC(args[i].(map[string]interface{}), 0) }
+	t := g.ctypesCType(qname)
+	switch name := strings.TrimPrefix(qname, "ctypes."); {
+	case t != "" && len(args) == 0:
+		return "0", true
+	case t == "char*" && len(args) == 1:
+		return arg(0), true
+	case t != "" && len(args) == 1:
+		return fmt.Sprintf("((%s)%s)", t, arg(0)), true
+	case (name == "byref" || name == "pointer") && len(args) == 1:
+		return "&" + arg(0), true
+	case name == "sizeof" && len(args) == 1:
+		fn, _ := args[0].(map[string]interface{})
+		if t := g.ctypesCType(g.qualifiedCallName(fn)); t != "" {
+			return fmt.Sprintf("(int)sizeof(%s)", t), true
+		}
+		return fmt.Sprintf("(int)sizeof(%s)", arg(0)), true
+	}
+	return "", false
+}
+
+// ctypesCallType: ctypes 的值与库函数返回值在翻译中的类型：整数为 int，浮点为 double
+func (g *generator) ctypesCallType(qname string, fn map[string]interface{}) string {
+	t := ""
+	if strings.HasPrefix(qname, "ctypes.") {
+		t = ctypesTypes[strings.TrimPrefix(qname, "ctypes.")]
+		if name := strings.TrimPrefix(qname, "ctypes."); name == "sizeof" {
+			t = "int"
+		}
+	} else if _, _, f := g.ctypesFuncOf(fn); f != nil {
+		if t = f.restype; t == "" {
+			t = "int"
+		}
+	}
+	switch t {
+	case "", "void", "char*", "void*":
+		return t
+	case "float", "double", "long double":
+		return "double"
+	}
+	if strings.HasSuffix(t, "*") {
+		return t
+	}
+	return "int"
+}
@@ -0,0 +1,391 @@
+package py2c
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// C 后端：顶层函数（ir.go 的 irFunc）、结构体与整个翻译单元由 emitter 输出，按 Options.Std 选择的 C 方言各有一个实现。
+// 代码生成按 C99 生成代码，方言之间的差别（C11 关键字、for 中的声明、声明的位置、注释）
+// 在 emitter 中处理；新的方言只需要实现这个接口。
+
+// emitter: 一种 C 方言的后端
+type emitter interface {
+	std() string                                     // 方言名，也是构建文件中 -std= 的缺省值；空为按运行时的需要取 c99 或 c11
+	emitFunction(f *irFunc, tail string) string      // 函数定义，tail 为结尾 } 之前的代码（#line 复位）
+	emitPrototype(f *irFunc) string                  // 函数声明（多模块的头文件）
+	emitStruct(name string, fields []irParam) string // typedef struct
+	emitStmt(s irStmt, indent int) string            // 函数体中的一条语句
+	emitUnit(src string) string                      // 整个 .c / .h 文件：改写方言不支持的写法
+}
+
+// newEmitter: Options.Std 与 Options.Profile 对应的后端，已经由 checkOptions 检查过
+func newEmitter(std, profile string) emitter {
+	var e emitter = modernEmitter{dialect: std}
+	switch std {
+	case "c89":
+		e = c89Emitter{}
+	case "c99":
+		e = c99Emitter{}
+	}
+	if profile == "arduino" {
+		e = arduinoEmitter{e}
+	}
+	return e
+}
+
+// modernEmitter: 缺省的后端（-std 为空或 c11）：C99，运行时需要时用 C11 的 _Thread_local / _Noreturn
+type modernEmitter struct {
+	dialect string
+}
+
+func (e modernEmitter) std() string { return e.dialect }
+
+func (e modernEmitter) emitFunction(f *irFunc, tail string) string {
+	return functionDef(e, f, f.signature(), tail)
+}
+
+func (e modernEmitter) emitPrototype(f *irFunc) string { return f.signature() + ";\n" }
+
+func (e modernEmitter) emitStruct(name string, fields []irParam) string {
+	return structDef(name, fields)
+}
+
+func (e modernEmitter) emitStmt(s irStmt, indent int) string { return s.emit(indent) }
+
+func (e modernEmitter) emitUnit(src string) string { return src }
+
+// c99Emitter: 严格的 C99：C11 的关键字换成编译器扩展的宏，不支持时为空
+type c99Emitter struct{}
+
+func (c99Emitter) std() string { return "c99" }
+
+func (e c99Emitter) emitFunction(f *irFunc, tail string) string {
+	return functionDef(e, f, f.signature(), tail)
+}
+
+func (c99Emitter) emitPrototype(f *irFunc) string { return f.signature() + ";\n" }
+
+func (c99Emitter) emitStruct(name string, fields []irParam) string { return structDef(name, fields) }
+
+func (c99Emitter) emitStmt(s irStmt, indent int) string { return s.emit(indent) }
+
+func (c99Emitter) emitUnit(src string) string { return replaceC11Keywords(src) }
+
+// c89Emitter: C89 / C90：只有 /* */ 注释，声明必须在块的开头，for 中不能声明变量，
+// 没有参数的函数写成 (void)
+type c89Emitter struct{}
+
+func (c89Emitter) std() string { return "c89" }
+
+func (e c89Emitter) emitFunction(f *irFunc, tail string) string {
+	return functionDef(e, f, voidParams(f.signature()), tail)
+}
+
+func (c89Emitter) emitPrototype(f *irFunc) string { return voidParams(f.signature()) + ";\n" }
+
+func (c89Emitter) emitStruct(name string, fields []irParam) string { return structDef(name, fields) }
+
+func (c89Emitter) emitStmt(s irStmt, indent int) string { return s.emit(indent) }
+
+func (c89Emitter) emitUnit(src string) string {
+	return hoistDeclarations(lineComments(replaceC11Keywords(src)))
+}
+
+// functionDef: 函数定义：head、签名和逐条输出的函数体
+func functionDef(e emitter, f *irFunc, sig, tail string) string {
+	pad := strings.Repeat(" ", f.indent*4)
+	var body strings.Builder
+	for _, s := range f.body {
+		body.WriteString(e.emitStmt(s, f.indent+1))
+	}
+	return fmt.Sprintf("%s%s%s {\n%s%s%s}\n", f.head, pad, sig, body.String(), tail, pad)
+}
+
+// structDef: typedef struct { 字段 } 名字;
+func structDef(name string, fields []irParam) string {
+	var code strings.Builder
+	for _, f := range fields {
+		fmt.Fprintf(&code, "    %s %s;\n", f.typ, f.name)
+	}
+	return fmt.Sprintf("typedef struct {\n%s} %s;\n", code.String(), name)
+}
+
+// voidParams: 没有参数的函数头 f() 写成 f(void)
+func voidParams(sig string) string {
+	if strings.HasSuffix(sig, "()") {
+		return strings.TrimSuffix(sig, "()") + "(void)"
+	}
+	return sig
+}
+
+// c11Compat: C11 关键字在 C99 / C89 中的替代：GCC、Clang 与 MSVC 的扩展，其他编译器为空
+// （没有线程局部存储时，异常帧栈只在单线程中正确）
+const c11Compat = `#if defined(__GNUC__)
+#define PY2C_THREAD_LOCAL __thread
+#define PY2C_NORETURN __attribute__((noreturn))
+#elif defined(_MSC_VER)
+#define PY2C_THREAD_LOCAL __declspec(thread)
+#define PY2C_NORETURN __declspec(noreturn)
+#else
+#define PY2C_THREAD_LOCAL
+#define PY2C_NORETURN
+#endif
+`
+
+// replaceC11Keywords: 把 _Thread_local / _Noreturn 换成 c11Compat 中的宏，宏定义放在第一次使用之前
+func replaceC11Keywords(src string) string {
+	first := -1
+	for _, kw := range []string{"_Thread_local", "_Noreturn"} {
+		if i := strings.Index(src, kw); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	if first < 0 {
+		return src
+	}
+	start := strings.LastIndex(src[:first], "\n") + 1
+	src = src[:start] + c11Compat + src[start:]
+	src = strings.ReplaceAll(src, "_Thread_local", "PY2C_THREAD_LOCAL")
+	return strings.ReplaceAll(src, "_Noreturn", "PY2C_NORETURN")
+}
+
+// lineComments: 把 // 注释改写为 /* */，跳过字符串、字符常量与已有的 /* */ 注释
+func lineComments(src string) string {
+	var b strings.Builder
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != c && src[j] != '\n' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				j = len(src) - 1
+			}
+			b.WriteString(src[i : j+1])
+			i = j
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				b.WriteString(src[i:])
+				return b.String()
+			}
+			b.WriteString(src[i : i+2+end+2])
+			i += 2 + end + 1
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			text := strings.TrimSpace(src[i+2 : i+end])
+			b.WriteString("/* " + strings.ReplaceAll(text, "*/", "* /") + " */")
+			i += end - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// codeOnly: 把一行中的字符串、字符常量与注释换成空格（位置不变），只留下代码；
+// inComment 为跨行的 /* */ 注释状态
+func codeOnly(line string, inComment *bool) string {
+	out := []byte(line)
+	for i := 0; i < len(out); i++ {
+		if *inComment {
+			if strings.HasPrefix(line[i:], "*/") {
+				*inComment = false
+				out[i], out[i+1] = ' ', ' '
+				i++
+			} else {
+				out[i] = ' '
+			}
+			continue
+		}
+		switch c := line[i]; {
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(line) && line[j] != c {
+				if line[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			for k := i + 1; k < j && k < len(out); k++ {
+				out[k] = ' '
+			}
+			i = j
+		case strings.HasPrefix(line[i:], "/*"):
+			*inComment = true
+			out[i], out[i+1] = ' ', ' '
+			i++
+		case strings.HasPrefix(line[i:], "//"):
+			for k := i; k < len(out); k++ {
+				out[k] = ' '
+			}
+			return string(out)
+		}
+	}
+	return string(out)
+}
+
+var (
+	// declRe: 以声明开头的代码：[限定词] 类型 [*] 名字 后跟 = ; , 或 [
+	declRe = regexp.MustCompile(`^(?:(?:static|const|unsigned|signed|long|short|struct|volatile|register|extern)\s+)*([A-Za-z_]\w*)(?:\s*\*+\s*|\s+)(?:const\s+)?\**[A-Za-z_]\w*\s*(?:\[[^\]]*\]\s*)*[=;,\[]`)
+	// forDeclRe: for 初始化部分的声明：类型 与 名字 = 初值[, 名字 = 初值]
+	// （类型与名字之间要有空白或 *：for (py_i = 0; ...) 是赋值）
+	forDeclRe = regexp.MustCompile(`^\s*((?:(?:const|unsigned|signed|long|short|struct)\s+)*[A-Za-z_]\w*(?:\s*\*+|\s)(?:\s*\*)*)\s*([A-Za-z_]\w*\s*=.*)$`)
+	// declaratorRe: for 声明中的一个 名字 = 初值
+	declaratorRe = regexp.MustCompile(`^\s*([A-Za-z_]\w*)\s*=`)
+)
+
+// notTypes: 可能被 declRe 当成类型的语句开头
+var notTypes = map[string]bool{"return": true, "goto": true, "case": true, "else": true, "do": true, "sizeof": true, "typedef": true}
+
+// isDecl: 一行代码（已经去掉字符串与注释）以声明开头
+func isDecl(code string) bool {
+	m := declRe.FindStringSubmatch(code)
+	return m != nil && !notTypes[m[1]]
+}
+
+// forDecl: for (类型 名字 = 初值; ...) 拆成声明与不带声明的 for。code 为去掉字符串与注释的同一行；
+// 不是这种 for 时 decls 为空
+func forDecl(line, code string) (decls []string, rest string) {
+	at := strings.Index(code, "for (")
+	if at < 0 || strings.TrimSpace(code[:at]) != "" {
+		return nil, line
+	}
+	start := at + len("for (")
+	semi := strings.IndexByte(code[start:], ';')
+	if semi < 0 {
+		return nil, line
+	}
+	init := line[start : start+semi]
+	m := forDeclRe.FindStringSubmatch(init)
+	if m == nil || notTypes[strings.Fields(m[1])[0]] {
+		return nil, line
+	}
+	for _, d := range splitTopLevel(m[2], ',') {
+		n := declaratorRe.FindStringSubmatch(d)
+		if n == nil {
+			return nil, line
+		}
+		decls = append(decls, fmt.Sprintf("%s %s;", strings.TrimSpace(m[1]), n[1]))
+	}
+	return decls, line[:start] + strings.TrimSpace(m[2]) + line[start+semi:]
+}
+
+// splitTopLevel: 按不在括号中的 sep 拆分
+func splitTopLevel(s string, sep byte) []string {
+	parts, depth, last := []string{}, 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, s[last:i])
+				last = i + 1
+			}
+		}
+	}
+	return append(parts, s[last:])
+}
+
+// c89Block: hoistDeclarations 中一个打开的 { } 块
+type c89Block struct {
+	code   bool     // 函数体或其中的语句块（而不是 struct 或初始化列表）
+	stmts  bool     // 块中已经有语句：之后的声明要放进新的块
+	opened []string // 为声明新开的块（缩进），在块结束时一起关闭
+}
+
+// hoistDeclarations: C89 要求声明在块的开头：for 中的声明移到 for 之前，
+// 跟在语句后面的声明连同块的剩余部分放进新的 { }。按行处理，依赖生成代码每行一条语句
+func hoistDeclarations(src string) string {
+	var out strings.Builder
+	var stack []*c89Block
+	inComment := false
+	lines := strings.SplitAfter(src, "\n")
+	for _, raw := range lines {
+		line := strings.TrimSuffix(raw, "\n")
+		newline := raw[len(line):]
+		wasComment := inComment
+		code := codeOnly(line, &inComment)
+		trimmed := strings.TrimSpace(code)
+		if wasComment || trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			out.WriteString(raw)
+			continue
+		}
+		pad := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		top := func() *c89Block {
+			if len(stack) == 0 {
+				return nil
+			}
+			return stack[len(stack)-1]
+		}
+		// 声明：语句之后的声明先开一个新块
+		declare := func(b *c89Block) {
+			if b.stmts {
+				out.WriteString(pad + "{\n")
+				b.opened = append(b.opened, pad)
+				b.stmts = false
+			}
+		}
+		if b := top(); b != nil && b.code && !strings.HasPrefix(trimmed, "}") {
+			if decls, rest := forDecl(line, code); decls != nil {
+				declare(b)
+				for _, d := range decls {
+					out.WriteString(pad + d + "\n")
+				}
+				line = rest
+				code = codeOnly(line, new(bool))
+				b.stmts = true
+			} else if isDecl(trimmed) {
+				declare(b)
+			} else {
+				b.stmts = true
+			}
+		}
+		// 大括号：关闭块之前先关闭为声明新开的块
+		var b strings.Builder
+		leading, last := true, 0
+		for i := 0; i < len(code); i++ {
+			switch code[i] {
+			case '{':
+				// 初始化列表的 { 前面是 = , { 或 (
+				prev := strings.TrimRight(code[:i], " \t")
+				init := prev != "" && strings.ContainsAny(prev[len(prev)-1:], "=,{(")
+				outer := top()
+				fn := outer == nil && strings.Contains(prev, "(") && !strings.HasPrefix(trimmed, "typedef")
+				stack = append(stack, &c89Block{code: !init && (fn || outer != nil && outer.code)})
+				leading = false
+			case '}':
+				if blk := top(); blk != nil {
+					stack = stack[:len(stack)-1]
+					for j := len(blk.opened) - 1; j >= 0; j-- {
+						if leading {
+							b.WriteString(blk.opened[j] + "}\n")
+						} else {
+							b.WriteString(line[last:i] + "} ")
+							last = i
+						}
+					}
+				}
+			case ' ', '\t':
+			default:
+				leading = false
+			}
+		}
+		b.WriteString(line[last:] + newline)
+		out.WriteString(b.String())
+	}
+	return out.String()
+}
@@ -0,0 +1,200 @@
+package py2c
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// @py2c.extern：Python 函数由已有的 C 函数实现，调用直接生成对那个 C 函数的调用，函数体（Python 中的实现）不翻译。
+//
+//	@py2c.extern("crc16_ccitt", header="crc.h")
+//	def crc16(data: str, n: int) -> int: ...
+//
+// C 函数的签名按类型注解：int、bool 为 int，float 为 double，str 为 char*，字符串形式的注解原样作为 C 类型
+// （"const uint8_t*"）；没有返回注解或 -> None 为 void。返回值直接返回，不经过 result 指针。
+// 有 header 时包含这个头文件，否则输出 extern 原型。Options.Externs 不改源码也能指定（Python 名 -> C 名）
+
+// externSpec: 由 C 实现的函数
+type externSpec struct {
+	cName  string
+	params []irParam
+	ret    string // void 为没有返回值
+	header string // 声明它的头文件（"x.h" 或 <x.h>），空时输出原型
+}
+
+// cTypeRe: 字符串注解中允许的 C 类型：名字、空格与结尾的 *
+var cTypeRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_ ]*\**$`)
+
+// collectExterns: 找出由 C 实现的顶层函数，登记签名，去掉装饰器与函数体（留下文档字符串）。
+// 在 mangleNames 之后运行：g.externs 的键是改名后的名字，与调用处相同
+func (g *generator) collectExterns(root ASTNode) {
+	body, _ := root["body"].([]interface{})
+	found := map[string]bool{}
+	for _, s := range body {
+		m, _ := s.(map[string]interface{})
+		if m["_type"] != "FunctionDef" {
+			continue
+		}
+		name, _ := m["name"].(string)
+		pyName := g.pythonName(name)
+		found[pyName] = true
+		spec, ok := g.externDecorator(m, pyName)
+		if !ok {
+			cName, given := g.optExterns[pyName]
+			if !given {
+				continue
+			}
+			spec = &externSpec{cName: cName}
+		}
+		if !g.externSignature(m, pyName, spec) {
+			continue
+		}
+		stmts, _ := m["body"].([]interface{})
+		kept := []interface{}{}
+		if _, ok := docstring(stmts); ok {
+			kept = append(kept, stmts[0])
+		}
+		m["body"], m["_cextern"] = kept, true
+		g.externs[name] = spec
+	}
+	for _, py := range sortedKeys(g.optExterns) {
+		if !found[py] {
+			g.report(logWarn, nil, "-extern-map: there is no top-level function %s", py)
+		}
+	}
+}
+
+// pythonName: mangleNames 改名之前的名字
+func (g *generator) pythonName(name string) string {
+	for _, r := range g.renames {
+		if r.C == name {
+			return r.Python
+		}
+	}
+	return name
+}
+
+// externDecorator: @py2c.extern、@py2c.extern("c_name", header="x.h")（from py2c import extern 时为 @extern）；
+// 找到时从 decorator_list 中去掉
+func (g *generator) externDecorator(fn map[string]interface{}, pyName string) (*externSpec, bool) {
+	decos, _ := fn["decorator_list"].([]interface{})
+	for i, d := range decos {
+		dm, _ := d.(map[string]interface{})
+		call := dm
+		if dm["_type"] == "Call" {
+			dm, _ = dm["func"].(map[string]interface{})
+		}
+		recv, _ := dm["value"].(map[string]interface{})
+		if !(dm["_type"] == "Name" && dm["id"] == "extern") && !(dm["_type"] == "Attribute" && dm["attr"] == "extern" && recv["id"] == "py2c") {
+			continue
+		}
+		fn["decorator_list"] = append(append([]interface{}{}, decos[:i]...), decos[i+1:]...)
+		spec := &externSpec{cName: pyName}
+		if call["_type"] != "Call" {
+			return spec, true
+		}
+		args, _ := call["args"].([]interface{})
+		if len(args) > 1 {
+			g.report(logError, call, "@py2c.extern takes the C name and header=; %s is translated", pyName)
+			return nil, false
+		}
+		if len(args) == 1 {
+			c, ok := args[0].(map[string]interface{})["value"].(string)
+			if !ok || !cIdent.MatchString(c) {
+				g.report(logError, call, "@py2c.extern: the C name of %s must be a string with a C identifier", pyName)
+				return nil, false
+			}
+			spec.cName = c
+		}
+		if h := callKeyword(ASTNode(call), "header"); h != nil {
+			header, ok := h["value"].(string)
+			if !ok || header == "" {
+				g.report(logError, call, "@py2c.extern: header= of %s must be a file name", pyName)
+				return nil, false
+			}
+			spec.header = header
+		}
+		return spec, true
+	}
+	return nil, false
+}
+
+// externSignature: 按类型注解填写 spec 的参数与返回类型；不能确定时报告错误，函数照常翻译
+func (g *generator) externSignature(fn map[string]interface{}, pyName string, spec *externSpec) bool {
+	args, _ := fn["args"].(map[string]interface{})
+	for _, k := range []string{"posonlyargs", "kwonlyargs", "defaults"} {
+		if l, _ := args[k].([]interface{}); len(l) > 0 {
+			g.report(logError, fn, "%s is implemented in C (%s): only plain positional parameters are supported, it is translated", pyName, spec.cName)
+			return false
+		}
+	}
+	if args["vararg"] != nil || args["kwarg"] != nil {
+		g.report(logError, fn, "%s is implemented in C (%s): *args and **kwargs are not supported, it is translated", pyName, spec.cName)
+		return false
+	}
+	params, _ := args["args"].([]interface{})
+	for _, p := range params {
+		pm, _ := p.(map[string]interface{})
+		t := g.externType(pm["annotation"])
+		if t == "" {
+			g.report(logError, fn, "%s is implemented in C (%s): parameter %v needs a type annotation (int, float, str, bool or a C type as a string), it is translated", pyName, spec.cName, pm["arg"])
+			return false
+		}
+		spec.params = append(spec.params, irParam{fmt.Sprint(pm["arg"]), t})
+	}
+	spec.ret = "void"
+	if r, _ := fn["returns"].(map[string]interface{}); r != nil && !(r["_type"] == "Constant" && r["value"] == nil) {
+		if spec.ret = g.externType(r); spec.ret == "" {
+			g.report(logError, fn, "%s is implemented in C (%s): the return annotation is not a C type, it is translated", pyName, spec.cName)
+			return false
+		}
+	}
+	return true
+}
+
+// externType: 注解对应的 C 类型；类为指针，字符串注解为原样的 C 类型
+func (g *generator) externType(ann interface{}) string {
+	t := g.annotationType(ann)
+	if g.annotClasses[t] {
+		return t + "*"
+	}
+	if m, _ := ann.(map[string]interface{}); t == "" && m["_type"] == "Constant" {
+		if s, ok := m["value"].(string); ok && cTypeRe.MatchString(strings.TrimSpace(s)) {
+			return strings.TrimSpace(s)
+		}
+	}
+	return t
+}
+
+// externDecl: 函数定义的位置：包含声明它的头文件，或者输出原型
+func (g *generator) externDecl(name string, spec *externSpec, node ASTNode) {
+	if spec.header != "" {
+		if strings.HasPrefix(spec.header, "<") {
+			g.includes[strings.Trim(spec.header, "<>")] = true
+		} else {
+			g.userIncludes[strings.Trim(spec.header, `"`)] = true
+		}
+		return
+	}
+	note := fmt.Sprintf("// %s: implemented in C\n", name)
+	if spec.cName != name {
+		note = fmt.Sprintf("// %s: implemented in C by %s\n", name, spec.cName)
+	}
+	f := &irFunc{name: spec.cName, ret: spec.ret, params: spec.params}
+	g.classStructs = append(g.classStructs, g.docComment(node["body"], "")+note+"extern "+g.emit.emitPrototype(f))
+}
+
+// externCall: 对 C 函数的调用，实参按位置
+func (g *generator) externCall(spec *externSpec, node ASTNode) string {
+	args, _ := node["args"].([]interface{})
+	if kw, _ := node["keywords"].([]interface{}); len(kw) > 0 || len(args) != len(spec.params) {
+		return g.unsupportedExpr(node, fmt.Sprintf("call: %s takes %d positional arguments", spec.cName, len(spec.params)))
+	}
+	callArgs, ptypes := []string{}, []string{}
+	for i, a := range args {
+		callArgs = append(callArgs, g.toC(a.(map[string]interface{}), 0))
+		ptypes = append(ptypes, spec.params[i].typ)
+	}
+	return fmt.Sprintf("%s(%s)", spec.cName, join(g.objectArgsOf(ptypes, args, callArgs), ", "))
+}
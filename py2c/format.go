@@ -0,0 +1,193 @@
+package py2c
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 代码格式：代码生成按 4 空格缩进、大括号在行尾输出，formatUnit 在最后按 Options.Style 改写整个文件。
+
+// Style: 生成代码的格式，零值与默认输出相同
+type Style struct {
+	IndentWidth int    // 每层缩进的空格数，0 为 4
+	UseTabs     bool   // 每层缩进用一个制表符
+	Braces      string // attach（大括号在行尾，缺省）、allman（都另起一行）或 linux（只有函数定义另起一行）
+	MaxLine     int    // 超过这个长度的行在括号内的逗号处折行，0 为不限
+}
+
+// checkStyle: 检查 Style，空的字段换成默认值
+func checkStyle(s Style) (Style, error) {
+	if s.IndentWidth == 0 {
+		s.IndentWidth = 4
+	}
+	if s.IndentWidth < 0 || s.IndentWidth > 16 {
+		return s, fmt.Errorf("Style.IndentWidth must be between 1 and 16, got %d", s.IndentWidth)
+	}
+	if s.Braces == "" {
+		s.Braces = "attach"
+	}
+	if s.Braces != "attach" && s.Braces != "allman" && s.Braces != "linux" {
+		return s, fmt.Errorf("Style.Braces must be attach, allman or linux, got %q", s.Braces)
+	}
+	if s.MaxLine < 0 {
+		return s, fmt.Errorf("Style.MaxLine must not be negative, got %d", s.MaxLine)
+	}
+	return s, nil
+}
+
+// unit: 一层缩进
+func (s Style) unit() string {
+	if s.UseTabs {
+		return "\t"
+	}
+	return strings.Repeat(" ", s.IndentWidth)
+}
+
+// formatUnit: 按 style 改写整个 .c / .h 文件：缩进、大括号位置与折行。
+// 缩进按大括号的层数重新计算（生成代码中个别块的缩进并不整齐，默认格式也要经过这里），
+// 块内更深的行（case 下的语句等）与续行保留相对的缩进；预处理指令与跨行注释的内部不动
+func formatUnit(src string, style Style) string {
+	type block struct {
+		pad  string // 块中语句的缩进
+		base int    // 块中第一条语句原来的缩进，-1 为还没有
+		open string // 块开始那一行的缩进，结束块的 } 与它对齐
+	}
+	blocks := []block{{"", 0, ""}}
+	var out strings.Builder
+	inComment, cont := false, false
+	prevOrig, prevPad := 0, ""
+	for _, raw := range strings.SplitAfter(src, "\n") {
+		line := strings.TrimSuffix(raw, "\n")
+		wasComment := inComment
+		code := codeOnly(line, &inComment)
+		trimmed := strings.TrimSpace(code)
+		if wasComment || raw == lineResetMark || strings.HasPrefix(trimmed, "#") || strings.TrimSpace(line) == "" {
+			out.WriteString(raw)
+			continue
+		}
+		orig := len(line) - len(strings.TrimLeft(line, " "))
+		line, code = line[orig:], code[orig:]
+		// 行首的 } 先结束块，与块开始的那一行对齐
+		closes := len(code) - len(strings.TrimLeft(code, "}"))
+		closePad := ""
+		for i := 0; i < closes && len(blocks) > 1; i++ {
+			closePad = blocks[len(blocks)-1].open
+			blocks = blocks[:len(blocks)-1]
+		}
+		b := &blocks[len(blocks)-1]
+		pad := b.pad
+		switch {
+		case closes > 0:
+			pad = closePad
+		case cont:
+			pad = prevPad + style.extra(orig-prevOrig)
+		case b.base < 0:
+			b.base = orig
+		case len(blocks) > 1:
+			pad += style.extra(orig - b.base)
+		}
+		for _, l := range style.braceLines(line, code, len(blocks)-1) {
+			for _, part := range style.wrap(pad, l) {
+				out.WriteString(part + "\n")
+			}
+		}
+		for n := strings.Count(code, "{") - strings.Count(code, "}") + closes; n > 0; n-- {
+			blocks = append(blocks, block{pad + style.unit(), -1, pad})
+		}
+		for n := strings.Count(code, "}") - closes - strings.Count(code, "{"); n > 0 && len(blocks) > 1; n-- {
+			blocks = blocks[:len(blocks)-1]
+		}
+		if trimmed != "" {
+			cont = !strings.ContainsAny(trimmed[len(trimmed)-1:], ";{}:")
+			prevOrig, prevPad = orig, pad
+		}
+	}
+	return strings.TrimSuffix(out.String(), "\n") + src[len(strings.TrimRight(src, "\n")):]
+}
+
+// extra: 原来多出的 n 个空格：每 4 个为一层，其余原样
+func (s Style) extra(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.Repeat(s.unit(), n/4) + strings.Repeat(" ", n%4)
+}
+
+// braceLines: 按大括号风格拆分一行（已去掉缩进）；code 为去掉字符串与注释的同一行，depth 为行首的大括号层数
+func (s Style) braceLines(line, code string, depth int) []string {
+	if s.Braces == "attach" {
+		return []string{line}
+	}
+	end := strings.TrimRight(code, " \t")
+	if !strings.HasSuffix(end, "{") {
+		return []string{line}
+	}
+	at := len(end) - 1
+	head := strings.TrimRight(line[:at], " \t")
+	prev := strings.TrimRight(code[:at], " \t")
+	// 初始化列表与单独的 { 不动
+	if prev == "" || strings.ContainsAny(prev[len(prev)-1:], "=,({") {
+		return []string{line}
+	}
+	if s.Braces == "linux" && (depth > 0 || !strings.Contains(prev, "(")) {
+		return []string{line}
+	}
+	lines := []string{}
+	if strings.HasPrefix(head, "} ") {
+		// } else { -> }、else、{
+		lines = append(lines, "}")
+		head = strings.TrimSpace(head[1:])
+	}
+	return append(lines, head, line[at:])
+}
+
+// wrap: 超过 MaxLine 的行在括号内的逗号之后折行，续行比原来多缩进两层；
+// 找不到逗号（或逗号在字符串、注释中）时保持原样
+func (s Style) wrap(pad, line string) []string {
+	width := func(str string) int {
+		// 制表符按 IndentWidth 计算宽度
+		return len(str) + strings.Count(str, "\t")*(s.IndentWidth-1)
+	}
+	if s.MaxLine == 0 || width(pad+line) <= s.MaxLine {
+		return []string{pad + line}
+	}
+	code := codeOnly(line, new(bool))
+	// 找出最外层（深度最小且 >= 1）括号内的逗号
+	cuts, best, level := []int{}, -1, 0
+	for i := 0; i < len(code); i++ {
+		switch code[i] {
+		case '(', '[', '{':
+			level++
+		case ')', ']', '}':
+			level--
+		case ',':
+			if level < 1 || i+1 >= len(code) || code[i+1] != ' ' {
+				continue
+			}
+			if best < 0 || level < best {
+				best, cuts = level, nil
+			}
+			if level == best {
+				cuts = append(cuts, i+1)
+			}
+		}
+	}
+	if len(cuts) == 0 {
+		return []string{pad + line}
+	}
+	cont := pad + s.unit() + s.unit()
+	parts, start, cur := []string{}, 0, pad
+	last := 0
+	for _, c := range cuts {
+		if width(cur+line[start:c]) > s.MaxLine && last > start {
+			parts = append(parts, strings.TrimRight(cur+line[start:last], " "))
+			start, cur = last+1, cont
+		}
+		last = c
+	}
+	if width(cur+line[start:]) > s.MaxLine && last > start {
+		parts = append(parts, strings.TrimRight(cur+line[start:last], " "))
+		start, cur = last+1, cont
+	}
+	return append(parts, cur+line[start:])
+}
@@ -0,0 +1,372 @@
+package py2c
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// -freestanding：不依赖 C 库（内核、引导程序等）。不包含任何头文件，print 逐段交给使用者提供的
+// extern void putstr(const char* s)，<math.h> 的函数与几个字符串函数生成为 static 实现；
+// 其余仍然需要 C 库的函数（malloc、setjmp、文件……）在翻译后逐个报告为错误。
+
+// mathCall: 用到 <math.h> 的函数 name 的 C 名字：-freestanding 时换成生成的 py_ 前缀的实现
+func (g *generator) mathCall(name string) string {
+	if !g.optFreestanding {
+		g.usesPow = true
+		return name
+	}
+	g.runtimeHelpers["py_math_"+name] = freestandingMath[name]
+	return "py_" + name
+}
+
+// freestandingMath: -freestanding 时 <math.h> 函数的替代实现
+var freestandingMath = map[string]string{
+	"fabs": `// fabs without <math.h>
+static double py_fabs(double x) {
+    return x < 0 ? -x : x;
+}
+`,
+	"fmin": `// fmin without <math.h>
+static double py_fmin(double a, double b) {
+    return a < b ? a : b;
+}
+`,
+	"fmax": `// fmax without <math.h>
+static double py_fmax(double a, double b) {
+    return a > b ? a : b;
+}
+`,
+	"rint": `// rint without <math.h>: halves to even, for values that fit in a long long
+static double py_rint(double x) {
+    long long i = (long long)x;
+    double f = x - (double)i;
+    if (f > 0.5 || (f == 0.5 && (i & 1))) {
+        i++;
+    } else if (f < -0.5 || (f == -0.5 && (i & 1))) {
+        i--;
+    }
+    return (double)i;
+}
+`,
+	"pow": `// pow without <math.h>: integer exponents by squaring, others as exp(y * log(x))
+static double py_log(double x) {
+    // x = m * 2^k with m in [1, 2), log(m) = 2 atanh((m - 1) / (m + 1))
+    int k = 0;
+    while (x >= 2) {
+        x /= 2;
+        k++;
+    }
+    while (x < 1) {
+        x *= 2;
+        k--;
+    }
+    double t = (x - 1) / (x + 1), t2 = t * t, sum = 0, term = t;
+    for (int n = 1; n < 60; n += 2) {
+        sum += term / n;
+        term *= t2;
+    }
+    return 2 * sum + k * 0.69314718055994530942;
+}
+static double py_exp(double x) {
+    // e^x = 2^k * e^r with |r| <= ln2 / 2
+    int k = (int)(x / 0.69314718055994530942 + (x < 0 ? -0.5 : 0.5));
+    double r = x - k * 0.69314718055994530942, sum = 1, term = 1;
+    for (int n = 1; n < 30; n++) {
+        term *= r / n;
+        sum += term;
+    }
+    for (; k > 0; k--) {
+        sum *= 2;
+    }
+    for (; k < 0; k++) {
+        sum /= 2;
+    }
+    return sum;
+}
+static double py_pow(double x, double y) {
+    if (y == (double)(long)y && y > -2147483648.0 && y < 2147483648.0) {
+        long n = (long)y;
+        double base = n < 0 ? 1 / x : x, r = 1;
+        for (n = n < 0 ? -n : n; n > 0; n >>= 1) {
+            if (n & 1) {
+                r *= base;
+            }
+            base *= base;
+        }
+        return r;
+    }
+    if (x <= 0) {
+        return x == 0 ? 0 : (x - x) / (x - x);
+    }
+    return py_exp(y * py_log(x));
+}
+`,
+}
+
+// absCall: int 的 abs：-freestanding 时不用 <stdlib.h>
+func (g *generator) absCall(x string) string {
+	if !g.optFreestanding {
+		g.includes["stdlib.h"] = true
+		return fmt.Sprintf("abs(%s)", x)
+	}
+	return fmt.Sprintf("((%[1]s) < 0 ? -(%[1]s) : (%[1]s))", x)
+}
+
+// putRuntime: -freestanding 时 print 的输出函数
+func (g *generator) putRuntime() {
+	g.runtimeHelpers["py_put"] = `// print() without stdio: everything is written with putstr, provided by whoever links this code
+extern void putstr(const char* s);
+static void py_put_char(char c) {
+    char s[2];
+    s[0] = c;
+    s[1] = '\0';
+    putstr(s);
+}
+static void py_put_int(long v) {
+    char buf[24];
+    int i = sizeof(buf) - 1;
+    unsigned long u = v < 0 ? 0UL - (unsigned long)v : (unsigned long)v;
+    buf[i] = '\0';
+    do {
+        buf[--i] = (char)('0' + u % 10);
+        u /= 10;
+    } while (u);
+    if (v < 0) {
+        buf[--i] = '-';
+    }
+    putstr(buf + i);
+}
+// %.<prec>f: digits from the double itself, exact for the usual magnitudes
+static void py_put_double(double x, int prec) {
+    double scale = 1, ip = 1;
+    if (x != x) {
+        putstr("nan");
+        return;
+    }
+    if (x < 0) {
+        putstr("-");
+        x = -x;
+    }
+    if (x != 0 && x * 0.5 == x) {
+        putstr("inf");
+        return;
+    }
+    for (int i = 0; i < prec; i++) {
+        scale *= 10;
+    }
+    x += 0.5 / scale;
+    while (ip * 10 <= x) {
+        ip *= 10;
+    }
+    for (; ip >= 1; ip /= 10) {
+        int d = (int)(x / ip);
+        d = d > 9 ? 9 : d;
+        py_put_char((char)('0' + d));
+        x -= d * ip;
+    }
+    if (prec > 0) {
+        py_put_char('.');
+    }
+    for (int i = 0; i < prec; i++) {
+        x *= 10;
+        int d = (int)x;
+        d = d > 9 ? 9 : d;
+        py_put_char((char)('0' + d));
+        x -= d;
+    }
+}
+`
+}
+
+// printSpecRe: printf 格式串中的一个转换：标志、宽度、精度、长度修饰与转换字符
+var printSpecRe = regexp.MustCompile(`^%([-+ #0]*)(\d*)(?:\.(\d+))?(?:l|ll|z)?([a-zA-Z%])`)
+
+// freestandingPrint: 把 printf(format, args) 拆成逐段的 putstr / py_put_*，每段一行；
+// format 为生成的 C 字符串字面量的内容（已转义）
+func (g *generator) freestandingPrint(node interface{}, pad, format string, args []string) string {
+	g.putRuntime()
+	code, lit := "", ""
+	flush := func() {
+		if lit != "" {
+			code += fmt.Sprintf("%sputstr(\"%s\");\n", pad, lit)
+			lit = ""
+		}
+	}
+	next := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			lit += format[i : i+1]
+			if format[i] == '\\' && i+1 < len(format) {
+				lit += format[i+1 : i+2]
+				i++
+			}
+			continue
+		}
+		m := printSpecRe.FindStringSubmatch(format[i:])
+		if m == nil || m[4] == "%" {
+			lit += "%"
+			if m != nil {
+				i += len(m[0]) - 1
+			}
+			continue
+		}
+		i += len(m[0]) - 1
+		if next >= len(args) {
+			break
+		}
+		arg := args[next]
+		next++
+		if m[0] == "%s" && strings.HasPrefix(arg, "\"") && strings.HasSuffix(arg, "\"") && !strings.Contains(arg[1:len(arg)-1], "\"") {
+			// 字符串常量并入前后的文字
+			lit += arg[1 : len(arg)-1]
+			continue
+		}
+		flush()
+		if m[1] != "" || m[2] != "" {
+			g.report(logWarn, node, "-freestanding print ignores the width and flags of %s", m[0])
+		}
+		switch m[4] {
+		case "d", "i", "u", "x":
+			code += fmt.Sprintf("%spy_put_int((long)(%s));\n", pad, arg)
+		case "s":
+			code += fmt.Sprintf("%sputstr(%s);\n", pad, arg)
+		case "c":
+			code += fmt.Sprintf("%spy_put_char((char)(%s));\n", pad, arg)
+		default:
+			prec := 6
+			if m[3] != "" {
+				fmt.Sscan(m[3], &prec)
+			}
+			if m[4] != "f" && m[4] != "F" {
+				g.report(logWarn, node, "-freestanding print writes %s as %%.%df", m[0], prec)
+			}
+			code += fmt.Sprintf("%spy_put_double(%s, %d);\n", pad, arg, prec)
+		}
+	}
+	flush()
+	return code
+}
+
+// freestandingFuncs: 生成代码中可能用到的、-freestanding 时改名为 py_ 前缀并生成实现的 C 库函数
+var freestandingFuncs = map[string]string{
+	"strlen": `static unsigned long py_strlen(const char* s) {
+    unsigned long n = 0;
+    while (s[n]) {
+        n++;
+    }
+    return n;
+}
+`,
+	"strcmp": `static int py_strcmp(const char* a, const char* b) {
+    while (*a && *a == *b) {
+        a++;
+        b++;
+    }
+    return (unsigned char)*a - (unsigned char)*b;
+}
+`,
+	"strncmp": `static int py_strncmp(const char* a, const char* b, unsigned long n) {
+    for (; n > 0; n--, a++, b++) {
+        if (*a != *b || !*a) {
+            return (unsigned char)*a - (unsigned char)*b;
+        }
+    }
+    return 0;
+}
+`,
+	"memcpy": `static void* py_memcpy(void* dst, const void* src, unsigned long n) {
+    unsigned char* d = (unsigned char*)dst;
+    const unsigned char* s = (const unsigned char*)src;
+    while (n--) {
+        *d++ = *s++;
+    }
+    return dst;
+}
+`,
+	"memset": `static void* py_memset(void* dst, int c, unsigned long n) {
+    unsigned char* d = (unsigned char*)dst;
+    while (n--) {
+        *d++ = (unsigned char)c;
+    }
+    return dst;
+}
+`,
+}
+
+// libcFeatures: 仍然需要 C 库的函数，以及用到它的 Python 写法（诊断信息）
+var libcFeatures = map[string]string{
+	"malloc": "lists, dicts, strings built at run time and heap objects", "calloc": "lists, dicts, strings built at run time and heap objects",
+	"realloc": "lists, dicts, strings built at run time and heap objects", "free": "lists, dicts, strings built at run time and heap objects",
+	"strdup": "strings built at run time", "strcpy": "strings built at run time", "strcat": "strings built at run time",
+	"printf": "formatting", "fprintf": "printing to files and error messages", "snprintf": "str(), f-strings and other formatting outside print",
+	"sprintf": "formatting", "puts": "printing", "putchar": "printing",
+	"fopen": "open() and files", "fclose": "open() and files", "fgets": "reading files and input()", "fputs": "writing files",
+	"fread": "reading files", "fwrite": "writing files", "fflush": "files", "fgetc": "reading files", "getline": "reading files",
+	"setjmp": "try/except and raise with -exceptions=setjmp", "longjmp": "try/except and raise with -exceptions=setjmp",
+	"exit": "raise, sys.exit and runtime errors", "abort": "runtime errors",
+	"strtol": "int() of strings", "strtoll": "int() of strings", "strtod": "float() of strings", "atoi": "converting strings to numbers", "atof": "float() of strings",
+	"strchr": "string methods", "strstr": "string methods", "strrchr": "string methods", "memmove": "list insertion and removal", "memcmp": "comparisons",
+	"isdigit": "string methods", "isalpha": "string methods", "isspace": "string methods", "isalnum": "string methods",
+	"isupper": "string methods", "islower": "string methods", "toupper": "string methods", "tolower": "string methods",
+	"qsort": "sorting", "regcomp": "the re module", "regexec": "the re module", "getopt_long": "argparse", "rand": "the random module", "srand": "the random module",
+	"time": "the time module", "clock_gettime": "the time module", "nanosleep": "time.sleep", "localtime_r": "datetime", "strftime": "datetime",
+	"pthread_create": "threads", "pthread_join": "threads", "pthread_mutex_lock": "locks",
+	"getenv": "os.environ", "system": "os.system", "remove": "os.remove", "rename": "os.rename", "stat": "os.path",
+}
+
+// callRe: 函数调用 名字(
+var callRe = regexp.MustCompile(`\b([A-Za-z_]\w*)\s*\(`)
+
+// freestandingUnit: -freestanding 的收尾：上面的字符串函数改为生成的实现，
+// NULL / size_t 自己定义，其余的 C 库调用报告为错误
+func (g *generator) freestandingUnit(src string) string {
+	used := map[string]bool{}
+	inComment := false
+	for _, line := range strings.Split(src, "\n") {
+		code := codeOnly(line, &inComment)
+		if strings.HasPrefix(strings.TrimSpace(code), "#") {
+			continue
+		}
+		for _, m := range callRe.FindAllStringSubmatch(code, -1) {
+			used[m[1]] = true
+		}
+		if strings.Contains(code, "NULL") {
+			used["NULL"] = true
+		}
+		if strings.Contains(code, "size_t") {
+			used["size_t"] = true
+		}
+	}
+	compat := ""
+	if used["NULL"] || used["size_t"] {
+		// 头文件与 .c 都可能带上这一段
+		compat += "#ifndef PY2C_FREESTANDING\n#define PY2C_FREESTANDING\n#define NULL ((void*)0)\ntypedef unsigned long size_t;\n#endif\n"
+	}
+	for _, name := range sortedKeys(freestandingFuncs) {
+		if used[name] {
+			src = regexp.MustCompile(`\b`+name+`\(`).ReplaceAllString(src, "py_"+name+"(")
+			compat += freestandingFuncs[name]
+		}
+	}
+	for _, f := range g.irFuncs {
+		// 与 C 库函数同名的 Python 函数
+		delete(used, f.name)
+	}
+	missing := []string{}
+	for name := range used {
+		if _, ok := libcFeatures[name]; ok {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	g.diagStmt = nil
+	for _, name := range missing {
+		g.report(logError, nil, "-freestanding: %s() needs the C library (%s)", name, libcFeatures[name])
+	}
+	if compat == "" {
+		return src
+	}
+	return "// -freestanding: no C library headers\n" + compat + src
+}
@@ -0,0 +1,553 @@
+package py2c
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// map、filter 与 functools.reduce 展开为 C 循环，不生成迭代器：
+//
+//	ys = list(map(f, xs))           ->  PyList_T* _l1 = PyList_T_new(); 对 xs 的循环中 append f(x)
+//	total = sum(filter(p, xs))      ->  T _s1 = 0; 对 xs 的循环中 p(x) 成立时累加
+//	for y in map(f, xs): ...        ->  对 xs 的循环，每一轮 y = f(x)
+//	r = reduce(f, xs, init)         ->  T _r1 = init; 对 xs 的循环中 _r1 = f(_r1, x)
+//
+// xs 可以是 for 循环支持的任何迭代对象（列表、range()、生成器、itertools 与嵌套的 map / filter）。
+// f 是程序中的函数、str / int / float / abs / round / len，或者 lambda：lambda 提升为文件作用域的
+// static 函数 py_lambdaN，函数体中用到的外层局部变量成为额外的参数（lambdaCall）
+
+// callableBuiltins: 可以作为 map / filter / reduce 的函数参数的内置函数
+var callableBuiltins = map[string]bool{"str": true, "int": true, "float": true, "abs": true, "round": true, "len": true}
+
+// functionalCall: node 是 map(...)、filter(...) 或 functools.reduce(...) 的调用时返回 map、filter 或 reduce
+func (g *generator) functionalCall(node interface{}) string {
+	m, _ := node.(map[string]interface{})
+	fn, _ := m["func"].(map[string]interface{})
+	if m["_type"] != "Call" || fn == nil {
+		return ""
+	}
+	if id, _ := fn["id"].(string); fn["_type"] == "Name" && (id == "map" || id == "filter") && g.funcNodes[id] == nil && g.localVar(id) == nil {
+		return id
+	}
+	q := ""
+	switch fn["_type"] {
+	case "Name":
+		q = g.importNames[fmt.Sprint(fn["id"])]
+	case "Attribute":
+		if recv, _ := fn["value"].(map[string]interface{}); recv["_type"] == "Name" && g.importNames[fmt.Sprint(recv["id"])] == "functools" {
+			q = fmt.Sprintf("functools.%v", fn["attr"])
+		}
+	}
+	if q == "functools.reduce" {
+		return "reduce"
+	}
+	return ""
+}
+
+// functionalArgs: map(f, xs) / filter(p, xs) / reduce(f, xs[, init]) 的参数；不能翻译时 reason 说明原因
+func (g *generator) functionalArgs(call map[string]interface{}) (fn, iter, init map[string]interface{}, reason string) {
+	kind := g.functionalCall(call)
+	args, _ := call["args"].([]interface{})
+	if kw, _ := call["keywords"].([]interface{}); len(kw) > 0 {
+		return nil, nil, nil, kind + "() with keyword arguments"
+	}
+	if len(args) != 2 && !(kind == "reduce" && len(args) == 3) {
+		if kind == "map" && len(args) > 2 {
+			return nil, nil, nil, "map() over several iterables"
+		}
+		return nil, nil, nil, fmt.Sprintf("%s() with %d arguments", kind, len(args))
+	}
+	fn, _ = args[0].(map[string]interface{})
+	iter, _ = args[1].(map[string]interface{})
+	if len(args) == 3 {
+		init, _ = args[2].(map[string]interface{})
+	}
+	nargs := 1
+	if kind == "reduce" {
+		nargs = 2
+	}
+	switch id, _ := fn["id"].(string); {
+	case fn["_type"] == "Lambda":
+		if params, ok := lambdaParams(fn); !ok || len(params) != nargs {
+			return nil, nil, nil, fmt.Sprintf("%s() with a lambda that does not take exactly %s", kind, map[int]string{1: "one argument", 2: "two arguments"}[nargs])
+		}
+	case kind == "filter" && fn["_type"] == "Constant" && fn["value"] == nil:
+		// filter(None, xs)：元素本身为真
+	case fn["_type"] == "Name" && (g.funcNodes[id] != nil || callableBuiltins[id] && nargs == 1) && g.localVar(id) == nil:
+	default:
+		return nil, nil, nil, kind + "() with a function that is not a lambda, a function of the program or a builtin such as str"
+	}
+	return fn, iter, init, ""
+}
+
+// functionalArg: call 的第一个参数是 map(...) 或 filter(...)（list(map(...)) 等）
+func (g *generator) functionalArg(call map[string]interface{}) bool {
+	args, _ := call["args"].([]interface{})
+	if len(args) == 0 {
+		return false
+	}
+	kind := g.functionalCall(args[0])
+	return kind == "map" || kind == "filter"
+}
+
+// functionalCallee: map / filter / reduce 调用的程序中的函数（纯函数分析的调用图；lambda 的函数体另外检查）
+func (g *generator) functionalCallee(call map[string]interface{}) []string {
+	args, _ := call["args"].([]interface{})
+	if len(args) == 0 {
+		return nil
+	}
+	if fn, _ := args[0].(map[string]interface{}); fn["_type"] == "Name" && g.funcNodes[fmt.Sprint(fn["id"])] != nil {
+		return []string{fmt.Sprint(fn["id"])}
+	}
+	return nil
+}
+
+// applyCall: f(args...) 的调用节点；f 为 None（filter）时是参数本身
+func applyCall(fn map[string]interface{}, args ...interface{}) map[string]interface{} {
+	if fn["_type"] == "Constant" {
+		return args[0].(map[string]interface{})
+	}
+	return map[string]interface{}{"_type": "Call", "func": fn, "args": args, "keywords": []interface{}{}}
+}
+
+// callType: 以 argTypes 类型的参数调用 fn 的结果类型
+func (g *generator) callType(fn map[string]interface{}, argTypes []string) string {
+	g.pushScope(scopeComprehension, "call")
+	defer g.popScope()
+	args := []interface{}{}
+	for i, t := range argTypes {
+		id := fmt.Sprintf("_a%d", i)
+		g.declareTemp(id, t)
+		args = append(args, cName(id))
+	}
+	return g.getType(applyCall(fn, args...))
+}
+
+// functionalElemType: map(f, xs) 的值（f 作用于元素的结果）与 filter(p, xs) 的元素的类型，不知道时为空
+func (g *generator) functionalElemType(call map[string]interface{}, typeOf func(interface{}) string) string {
+	fn, iter, _, reason := g.functionalArgs(call)
+	if reason != "" {
+		return ""
+	}
+	elem := g.iterElemType(iter, typeOf)
+	if elem == "" || g.functionalCall(call) == "filter" {
+		return elem
+	}
+	return g.callType(fn, []string{elem})
+}
+
+// reduceType: reduce(f, xs[, init]) 的结果类型：init 的类型（没有时为元素类型）；f 的结果是不同的数值类型时为 double
+func (g *generator) reduceType(call map[string]interface{}) (acc, elem string) {
+	fn, iter, init, reason := g.functionalArgs(call)
+	if reason != "" {
+		return "", ""
+	}
+	elem = g.iterElemType(iter, g.getType)
+	acc = elem
+	if init != nil {
+		acc = g.getType(init)
+	}
+	if r := g.callType(fn, []string{acc, elem}); r != acc && isNumericType(r) && isNumericType(acc) {
+		acc = "double"
+	}
+	return acc, elem
+}
+
+// functionalLoop: 对 iter 的循环（synthetic For，循环变量是新的临时变量 x），body 由 x 生成
+func (g *generator) functionalLoop(iter map[string]interface{}, elem string, body func(x map[string]interface{}) []interface{}, indent int) string {
+	x, _ := g.loopTemp("_x", elem)
+	if g.curGen != nil {
+		g.declareTemp(x, elem) // 生成器中是结构体的字段，循环不再声明
+	}
+	loop := ASTNode{"_type": "For", "target": cName(x), "iter": iter, "body": body(cName(x)), "orelse": []interface{}{}}
+	return g.nodeToC(loop, indent)
+}
+
+// handleForFunctional: for y in map(f, xs) / filter(p, xs)
+func (g *generator) handleForFunctional(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	iter := node["iter"].(map[string]interface{})
+	kind := g.functionalCall(iter)
+	fn, xs, _, reason := g.functionalArgs(iter)
+	elem := ""
+	if reason == "" {
+		if elem = g.iterElemType(xs, g.getType); elem == "" {
+			reason = kind + "() over an iterable that a for loop does not support"
+		}
+	}
+	if reason != "" {
+		return pad + g.unsupportedExpr(node, "for loop over "+reason) + "\n"
+	}
+	body := node["body"].([]interface{})
+	if kind == "filter" {
+		// 循环变量就是 xs 的元素，不满足 p 的跳过
+		skip := map[string]interface{}{"_type": "If", "test": notExpr(applyCall(fn, node["target"])), "body": []interface{}{map[string]interface{}{"_type": "Continue"}}, "orelse": []interface{}{}}
+		return g.nodeToC(ASTNode{"_type": "For", "target": node["target"], "iter": xs, "body": append([]interface{}{skip}, body...), "orelse": []interface{}{}}, indent)
+	}
+	return g.functionalLoop(xs, elem, func(x map[string]interface{}) []interface{} {
+		assign := map[string]interface{}{"_type": "Assign", "targets": []interface{}{node["target"]}, "value": applyCall(fn, x)}
+		return append([]interface{}{assign}, body...)
+	}, indent)
+}
+
+// handleFunctionalCall: list / sum / min / max 的参数是 map(...) 或 filter(...) 的调用；其他地方的 map / filter 不支持
+func (g *generator) handleFunctionalCall(name string, call map[string]interface{}) (string, bool) {
+	if kind := g.functionalCall(call); kind == "map" || kind == "filter" {
+		return g.unsupportedExpr(call, "call: "+kind+"() outside list(), sum(), min(), max() or a for loop"), true
+	}
+	args, _ := call["args"].([]interface{})
+	if len(args) == 0 || g.funcNodes[name] != nil {
+		return "", false
+	}
+	arg, _ := args[0].(map[string]interface{})
+	if kind := g.functionalCall(arg); kind != "map" && kind != "filter" {
+		return "", false
+	}
+	switch name {
+	case "list":
+		if len(args) == 1 {
+			code, _ := g.functionalList(call, arg)
+			return code, true
+		}
+	case "sum":
+		return g.functionalSum(call, arg), true
+	case "min", "max":
+		if len(args) == 1 {
+			// 先建立列表，再按列表求最小、最大值
+			tmp, ok := g.functionalList(call, arg)
+			if !ok {
+				return tmp, true
+			}
+			return g.handleNumBuiltin(name, map[string]interface{}{"_type": "Call", "func": call["func"], "args": []interface{}{cName(tmp)}, "keywords": call["keywords"]})
+		}
+	}
+	return "", false
+}
+
+// notExpr: not e
+func notExpr(e interface{}) map[string]interface{} {
+	return map[string]interface{}{"_type": "UnaryOp", "op": map[string]interface{}{"_type": "Not"}, "operand": e}
+}
+
+// functionalList: list(map(f, xs)) / list(filter(p, xs))：循环中 append 到新的列表；不能翻译时 ok 为 false
+func (g *generator) functionalList(call, arg map[string]interface{}) (code string, ok bool) {
+	fn, xs, _, reason := g.functionalArgs(arg)
+	elem := ""
+	if reason == "" {
+		if elem = g.functionalElemType(arg, g.getType); elem == "" {
+			reason = g.functionalCall(arg) + "() whose values have no known type"
+		}
+	}
+	if reason != "" {
+		return g.unsupportedExpr(call, "call: list("+reason+")"), false
+	}
+	lt := g.listType(elem)
+	tmp, decl := g.loopTemp("_l", lt)
+	g.declareTemp(tmp, lt)
+	code = fmt.Sprintf("%s = %s_new();\n", decl, strings.TrimSuffix(lt, "*"))
+	filter := g.functionalCall(arg) == "filter"
+	code += g.functionalLoop(xs, g.iterElemType(xs, g.getType), func(x map[string]interface{}) []interface{} {
+		appendTo := map[string]interface{}{"_type": "Expr", "value": map[string]interface{}{"_type": "Call",
+			"func": map[string]interface{}{"_type": "Attribute", "value": cName(tmp), "attr": "append"}, "args": []interface{}{applyCall(fn, x)}, "keywords": []interface{}{}}}
+		if filter {
+			appendTo["value"].(map[string]interface{})["args"] = []interface{}{x}
+			return []interface{}{map[string]interface{}{"_type": "If", "test": applyCall(fn, x), "body": []interface{}{appendTo}, "orelse": []interface{}{}}}
+		}
+		return []interface{}{appendTo}
+	}, 0)
+	g.pendingPre = append(g.pendingPre, code)
+	if g.optRefcount {
+		g.rcTemps[tmp] = true
+		g.pendingPost = append(g.pendingPost, fmt.Sprintf("py_decref(%s);\n", tmp))
+	}
+	return tmp, true
+}
+
+// functionalSum: sum(map(f, xs)[, start]) / sum(filter(p, xs)[, start])：循环中累加，不建立列表
+func (g *generator) functionalSum(call, arg map[string]interface{}) string {
+	args, _ := call["args"].([]interface{})
+	fn, xs, _, reason := g.functionalArgs(arg)
+	t := ""
+	if reason == "" {
+		if t = g.numBuiltinType("sum", args); t == "" {
+			reason = g.functionalCall(arg) + "() whose values are not numbers"
+		}
+	}
+	if reason != "" {
+		return g.unsupportedExpr(call, "call: sum("+reason+")")
+	}
+	start := "0"
+	if len(args) == 2 {
+		start = g.toC(args[1].(map[string]interface{}), 0)
+	}
+	tmp, decl := g.loopTemp("_s", t)
+	g.declareTemp(tmp, t)
+	code := fmt.Sprintf("%s = %s;\n", decl, start)
+	filter := g.functionalCall(arg) == "filter"
+	code += g.functionalLoop(xs, g.iterElemType(xs, g.getType), func(x map[string]interface{}) []interface{} {
+		value := applyCall(fn, x)
+		if filter {
+			value = x
+		}
+		add := map[string]interface{}{"_type": "Assign", "targets": []interface{}{cName(tmp)},
+			"value": map[string]interface{}{"_type": "BinOp", "left": cName(tmp), "op": map[string]interface{}{"_type": "Add"}, "right": value}}
+		if filter {
+			return []interface{}{map[string]interface{}{"_type": "If", "test": applyCall(fn, x), "body": []interface{}{add}, "orelse": []interface{}{}}}
+		}
+		return []interface{}{add}
+	}, 0)
+	g.pendingPre = append(g.pendingPre, code)
+	return tmp
+}
+
+// functionalReduce: reduce(f, xs, init)：累加器从 init 开始，每个元素 acc = f(acc, x)。
+// 没有 init 时第一个元素是初值，xs 为空时是 TypeError
+func (g *generator) functionalReduce(call map[string]interface{}) string {
+	fn, xs, init, reason := g.functionalArgs(call)
+	acc, elem := "", ""
+	if reason == "" {
+		if acc, elem = g.reduceType(call); elem == "" {
+			reason = "reduce() over an iterable that a for loop does not support"
+		} else if r := g.callType(fn, []string{acc, elem}); r != acc && !(isNumericType(r) && isNumericType(acc)) {
+			reason = fmt.Sprintf("reduce() with a function that returns %s for a %s accumulator", r, acc)
+		}
+	}
+	if reason != "" {
+		return g.unsupportedExpr(call, "call: "+reason)
+	}
+	tmp, decl := g.loopTemp("_r", acc)
+	g.declareTemp(tmp, acc)
+	step := func(x map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"_type": "Assign", "targets": []interface{}{cName(tmp)}, "value": applyCall(fn, cName(tmp), x)}
+	}
+	if init != nil {
+		code := fmt.Sprintf("%s = %s;\n", decl, g.toC(init, 0))
+		code += g.functionalLoop(xs, elem, func(x map[string]interface{}) []interface{} { return []interface{}{step(x)} }, 0)
+		g.pendingPre = append(g.pendingPre, code)
+		return tmp
+	}
+	// 第一个元素作为初值：first 在取到它之前为 1
+	first, firstDecl := g.loopTemp("_n", "int")
+	g.declareTemp(first, "int")
+	code := fmt.Sprintf("%s = %s;\n%s = 1;\n", decl, zeroValue(acc), firstDecl)
+	code += g.functionalLoop(xs, elem, func(x map[string]interface{}) []interface{} {
+		start := []interface{}{
+			map[string]interface{}{"_type": "Assign", "targets": []interface{}{cName(tmp)}, "value": x},
+			map[string]interface{}{"_type": "Assign", "targets": []interface{}{cName(first)}, "value": map[string]interface{}{"_type": "Constant", "value": false}},
+		}
+		return []interface{}{map[string]interface{}{"_type": "If", "test": cName(first), "body": start, "orelse": []interface{}{step(x)}}}
+	}, 0)
+	g.reduceRuntime()
+	code += fmt.Sprintf("py_reduce_check(%s);\n", first)
+	g.pendingPre = append(g.pendingPre, code)
+	return tmp
+}
+
+// zeroValue: 还没有赋值的临时变量的初值
+func zeroValue(t string) string {
+	if strings.HasSuffix(t, "*") {
+		return "NULL"
+	}
+	return "0"
+}
+
+// reduceRuntime: 没有初值的 reduce() 遇到空的迭代对象
+func (g *generator) reduceRuntime() {
+	g.runtimeHelpers["py_reduce_check"] = fmt.Sprintf(`// reduce(f, xs) without an initial value: xs must not be empty
+static void py_reduce_check(int empty) {
+    if (empty) {
+        %s
+    }
+}
+`, g.runtimeError("TypeError", "reduce() of empty iterable with no initial value"))
+}
+
+// --- lambda ---
+
+// liftedLambda: 提升出来的 lambda 函数与它额外的参数（用到的外层局部变量）
+type liftedLambda struct {
+	name     string
+	captured []string
+}
+
+// lambdaParams: lambda 的参数名；有默认值、*args、仅限关键字等参数时 ok 为 false
+func lambdaParams(lam map[string]interface{}) (params []string, ok bool) {
+	args, _ := lam["args"].(map[string]interface{})
+	for _, f := range []string{"posonlyargs", "kwonlyargs", "defaults"} {
+		if l, _ := args[f].([]interface{}); len(l) > 0 {
+			return nil, false
+		}
+	}
+	if args["vararg"] != nil || args["kwarg"] != nil {
+		return nil, false
+	}
+	list, _ := args["args"].([]interface{})
+	for _, a := range list {
+		am, _ := a.(map[string]interface{})
+		params = append(params, fmt.Sprint(am["arg"]))
+	}
+	return params, true
+}
+
+// lambdaCaptures: lambda 的函数体中用到的外层局部变量（当前函数中在 C 里可见的声明），按名字排序
+func (g *generator) lambdaCaptures(lam map[string]interface{}, params []string) []string {
+	own := map[string]bool{}
+	for _, p := range params {
+		own[p] = true
+	}
+	seen := map[string]bool{}
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		switch n := node.(type) {
+		case []interface{}:
+			for _, e := range n {
+				walk(e)
+			}
+		case map[string]interface{}:
+			if id, _ := n["id"].(string); n["_type"] == "Name" && !own[id] && g.captureType(id) != "" {
+				seen[id] = true
+			}
+			for _, v := range n {
+				walk(v)
+			}
+		}
+	}
+	walk(lam["body"])
+	names := make([]string, 0, len(seen))
+	for id := range seen {
+		names = append(names, id)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// captureType: lambda 用到的外层局部变量的类型（方法中的 self 是类的指针），不是局部变量时为空
+func (g *generator) captureType(id string) string {
+	if sym := g.localVar(id); sym != nil {
+		return sym.typ
+	}
+	if id == "self" && g.currentClass != "" {
+		return g.currentClass + "*"
+	}
+	return ""
+}
+
+// lambdaType: 以 argTypes 调用 lambda 的结果类型
+func (g *generator) lambdaType(lam map[string]interface{}, argTypes []string) string {
+	params, _ := lambdaParams(lam)
+	g.pushScope(scopeComprehension, "lambda")
+	defer g.popScope()
+	for i, p := range params {
+		if i < len(argTypes) {
+			g.declareTemp(p, argTypes[i])
+		}
+	}
+	return g.getType(lam["body"])
+}
+
+// lambdaCall: (lambda x: ...)(a)：调用提升出来的函数，外层局部变量跟在参数后面
+func (g *generator) lambdaCall(lam, call map[string]interface{}) string {
+	args, _ := call["args"].([]interface{})
+	if kw, _ := call["keywords"].([]interface{}); len(kw) > 0 {
+		return g.unsupportedExpr(call, "call: lambda with keyword arguments")
+	}
+	var types, values []string
+	for _, a := range args {
+		types = append(types, g.getType(a))
+		values = append(values, g.toC(a.(map[string]interface{}), 0))
+	}
+	lifted, reason := g.liftLambda(lam, types)
+	if reason != "" {
+		return g.unsupportedExpr(call, "lambda: "+reason)
+	}
+	return fmt.Sprintf("%s(%s)", lifted.name, join(append(values, lifted.captured...), ", "))
+}
+
+// liftLambda: 把 lambda 生成为 static 函数（按参数类型只生成一次）：函数体是 return 表达式，
+// 外层局部变量按值传入（生成器中不能有 lambda，见 genExprRestriction）
+func (g *generator) liftLambda(lam map[string]interface{}, argTypes []string) (*liftedLambda, string) {
+	params, ok := lambdaParams(lam)
+	if !ok || len(params) != len(argTypes) {
+		return nil, fmt.Sprintf("called with %d arguments; only lambdas with that many positional parameters are supported", len(argTypes))
+	}
+	key := "_lifted(" + join(argTypes, ", ") + ")"
+	if l, ok := lam[key].(*liftedLambda); ok {
+		return l, ""
+	}
+	for i, t := range argTypes {
+		if t == "" || t == "void" {
+			return nil, fmt.Sprintf("the type of the argument %s is not known", params[i])
+		}
+	}
+	captured := g.lambdaCaptures(lam, params)
+	if g.optExceptions == "status" && g.callsStatusFunc(lam["body"]) {
+		return nil, "it calls a function that may raise (-exceptions=status)"
+	}
+	body := deepCopyNode(lam["body"])
+	var decls []string
+	tab := newSymbolTable(scopeFunction, "", nil)
+	for i, p := range params {
+		tab.vars[p] = &symbol{typ: argTypes[i], storage: "param"}
+		decls = append(decls, argTypes[i]+" "+p)
+	}
+	for _, c := range captured {
+		typ := g.captureType(c)
+		tab.vars[c] = &symbol{typ: typ, storage: "param"}
+		decls = append(decls, typ+" "+c)
+	}
+	name := g.newTemp("py_lambda")
+	tab.name, tab.locals = name, map[string]bool{}
+	for p := range tab.vars {
+		tab.locals[p] = true
+	}
+	// 函数体在模块作用域中生成：文件作用域的变量与函数可见，外层函数的局部变量只能通过参数
+	module := g.symtab
+	for module.parent != nil {
+		module = module.parent
+	}
+	tab.parent = module
+	savedTab, savedScope, savedTry := g.symtab, g.currentScope, g.tryFrames
+	savedPre, savedPost, savedIndent, savedOwned := g.pendingPre, g.pendingPost, g.scopeIndent, g.ownedObjects
+	g.symtab, g.currentScope, g.tryFrames = tab, name, nil
+	g.pendingPre, g.pendingPost, g.scopeIndent, g.ownedObjects = nil, nil, 1, nil
+	ret := g.getType(body)
+	code := g.toC(ASTNode{"_type": "Return", "value": body}, 1)
+	g.symtab, g.currentScope, g.tryFrames = savedTab, savedScope, savedTry
+	g.pendingPre, g.pendingPost, g.scopeIndent, g.ownedObjects = savedPre, savedPost, savedIndent, savedOwned
+	if len(decls) == 0 {
+		decls = []string{"void"}
+	}
+	sig := fmt.Sprintf("static %s %s(%s)", ret, name, join(decls, ", "))
+	line := ""
+	if lam["lineno"] != nil {
+		line = fmt.Sprintf(" on line %v", lam["lineno"])
+	}
+	g.classStructs = append(g.classStructs, sig+";\n")
+	g.funcDefs = append(g.funcDefs, fmt.Sprintf("// the lambda%s\n%s {\n%s}\n", line, sig, code))
+	l := &liftedLambda{name, captured}
+	lam[key] = l
+	return l, ""
+}
+
+// callsStatusFunc: 表达式中调用了 -exceptions=status 下返回错误码的函数
+func (g *generator) callsStatusFunc(node interface{}) bool {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			if g.callsStatusFunc(e) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		if fn, _ := n["func"].(map[string]interface{}); n["_type"] == "Call" && fn["_type"] == "Name" && g.statusFuncs[fmt.Sprint(fn["id"])] {
+			return true
+		}
+		for _, v := range n {
+			if g.callsStatusFunc(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
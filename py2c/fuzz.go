@@ -0,0 +1,59 @@
+package py2c
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/lixiasky/Py2c/py2c/pyast"
+)
+
+// 模糊测试的入口。格式不对的 AST（截断的 JSON、其他 Python 版本的节点、字段的类型不对）必须得到错误或诊断，
+// 而不是 panic：Translator 把代码生成中的 panic 转成错误给调用者，这里把这种错误重新当作崩溃报告出来。
+// go-fuzz 直接使用 Fuzz；go test -fuzz 见 translate_test.go 的 FuzzTranslate，语料在 testdata/fuzz/FuzzTranslate
+
+// fuzzOptions: 每个输入都用这几组选项翻译，覆盖主要的代码生成路径
+var fuzzOptions = func() []Options {
+	variants := []func(o *Options){
+		func(o *Options) {},
+		func(o *Options) { o.Refcount = true; o.Annotate = true; o.LineMap = "directive" },
+		func(o *Options) { o.Exceptions = "status"; o.StubUnsupported = true; o.Header = "fuzz.h" },
+		func(o *Options) { o.Freestanding = true; o.Optimize = true; o.Std = "c89" },
+	}
+	opts := make([]Options, len(variants))
+	for i, set := range variants {
+		opts[i] = DefaultOptions()
+		opts[i].SourceFile = "fuzz.py"
+		set(&opts[i])
+	}
+	return opts
+}()
+
+// Fuzz: go-fuzz 的入口：解析并翻译 data。返回 1 表示 data 是能翻译的 AST（值得继续变异），0 表示被拒绝。
+// 代码生成 panic、流式解析与 pyast.Parse 的结论不同、翻译成功却没有 C 代码、诊断没有内容时 panic
+func Fuzz(data []byte) int {
+	_, streamErr := decodeAST(bytes.NewReader(data))
+	_, typedErr := pyast.Parse(data)
+	if (streamErr == nil) != (typedErr == nil) {
+		panic(fmt.Sprintf("decodeAST and pyast.Parse disagree: %v / %v", streamErr, typedErr))
+	}
+	if streamErr != nil {
+		return 0
+	}
+	for _, o := range fuzzOptions {
+		out, diags, err := Translate(data, o)
+		var p *panicError
+		if errors.As(err, &p) {
+			panic(fmt.Sprintf("%v\n%s", p, p.stack))
+		}
+		for _, d := range diags {
+			if d.Severity == "" || d.Message == "" {
+				panic(fmt.Sprintf("diagnostic without a severity or message: %+v", d))
+			}
+		}
+		if err == nil && out.C == "" {
+			panic("translated without an error but produced no C")
+		}
+	}
+	return 1
+}
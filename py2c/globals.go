@@ -0,0 +1,199 @@
+package py2c
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 模块级变量：顶层代码在 main() 中，其中的变量函数看不到。函数中读取或用 global 声明的顶层变量
+// 改为文件作用域的 C 变量（符号表中 storage 为 global），只赋值一次、用常量初始化的为 const。
+// 处理数值与字符串（globalTypes）、列表与字典等指针类型以及对象，其他类型报错；只处理第一次赋值是顶层
+// （不在 if / for 中）的 X = ... 的变量
+
+// globalTypes: 可以作为文件作用域变量的值类型
+var globalTypes = map[string]bool{"double": true, "int": true, "char*": true}
+
+// declareGlobals: 找出函数中用到的顶层变量，在模块作用域中声明为 global，返回它们的 C 定义。
+// 用常量初始化的第一次赋值写进定义（Assign 节点标上 _global，handleAssign 不再输出），其余的赋值仍在原处
+func (g *generator) declareGlobals(body []interface{}) string {
+	used, written := functionGlobals(body)
+	stores := map[string]int{}
+	countStores(body, stores)
+	module := g.moduleScope()
+	code, seen := "", map[string]int{}
+	for _, s := range body {
+		stmt, _ := s.(map[string]interface{})
+		name, value := globalAssign(stmt)
+		first := name != "" && seen[name] == 0
+		countStores(stmt, seen)
+		if !first || !used[name] {
+			continue
+		}
+		typ := g.getType(value)
+		class := strings.TrimSuffix(typ, "*")
+		if !g.annotClasses[class] {
+			class = ""
+		} else if _, escapes := g.escapeInfo[""][name]; escapes || g.optHeap || g.optRefcount {
+			typ = class + "*" // 堆上的对象（见 constructObject），顶层代码中的变量是指针
+		}
+		if !globalTypes[typ] && !strings.HasSuffix(typ, "*") && class == "" {
+			g.report(logError, stmt, "unsupported module-level variable %s of type %s used in a function (numbers, strings, lists, dicts and objects can be shared)", name, typ)
+			continue
+		}
+		saved := g.diagStmt
+		g.diagStmt = stmt
+		g.declareIn(module, name, typ, "global")
+		g.diagStmt = saved
+		decl := typ + " " + name
+		if class != "" {
+			// 类的结构体在生成类时才输出：定义放在结构体之后
+			g.classGlobals[class] += decl + ";\n"
+			continue
+		}
+		if !isConstInitializer(value) {
+			code += decl + ";\n"
+			continue
+		}
+		if stores[name] == 1 && !written[name] {
+			// 不会再赋值：const（指针本身是常量，仍可传给 char* 参数）
+			decl = "const " + decl
+			if strings.HasSuffix(typ, "*") {
+				decl = typ + " const " + name
+			}
+		}
+		stmt["_global"] = true
+		code += fmt.Sprintf("%s = %s;\n", decl, g.toC(value, 0))
+	}
+	if code != "" {
+		code = "// module-level variables used by functions\n" + code
+	}
+	return code
+}
+
+// globalAssign: 只有一个名字目标的赋值 X = value，返回名字与值；其他语句名字为空
+func globalAssign(stmt map[string]interface{}) (string, map[string]interface{}) {
+	if stmt["_type"] != "Assign" {
+		return "", nil
+	}
+	targets, _ := stmt["targets"].([]interface{})
+	if len(targets) != 1 {
+		return "", nil
+	}
+	target, _ := targets[0].(map[string]interface{})
+	name, _ := target["id"].(string)
+	value, _ := stmt["value"].(map[string]interface{})
+	if target["_type"] != "Name" || value == nil {
+		return "", nil
+	}
+	return name, value
+}
+
+// countStores: 顶层代码中每个名字被赋值的次数（不进入函数与类）
+func countStores(node interface{}, stores map[string]int) {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			countStores(e, stores)
+		}
+	case map[string]interface{}:
+		switch n["_type"] {
+		case "FunctionDef", "AsyncFunctionDef", "ClassDef", "Lambda":
+			return
+		case "Name":
+			if ctx, _ := n["ctx"].(map[string]interface{}); ctx["_type"] == "Store" {
+				id, _ := n["id"].(string)
+				stores[id]++
+			}
+		case "ExceptHandler":
+			if id, ok := n["name"].(string); ok && id != "" {
+				stores[id]++
+			}
+		}
+		for _, v := range n {
+			countStores(v, stores)
+		}
+	}
+}
+
+// functionGlobals: 所有函数（含方法与嵌套函数）中不是局部变量或参数的名字，以及其中用 global 声明的名字
+func functionGlobals(node interface{}) (used, written map[string]bool) {
+	used, written = map[string]bool{}, map[string]bool{}
+	var visit func(node interface{})
+	visit = func(node interface{}) {
+		switch n := node.(type) {
+		case []interface{}:
+			for _, e := range n {
+				visit(e)
+			}
+		case map[string]interface{}:
+			if n["_type"] == "FunctionDef" || n["_type"] == "AsyncFunctionDef" {
+				body, _ := n["body"].([]interface{})
+				locals := localNames(body)
+				args, _ := n["args"].(map[string]interface{})
+				for _, key := range []string{"posonlyargs", "args", "kwonlyargs"} {
+					list, _ := args[key].([]interface{})
+					for _, a := range list {
+						am, _ := a.(map[string]interface{})
+						if id, ok := am["arg"].(string); ok {
+							locals[id] = true
+						}
+					}
+				}
+				functionNames(body, locals, used, written)
+			}
+			for _, v := range n {
+				visit(v)
+			}
+		}
+	}
+	visit(node)
+	return used, written
+}
+
+// functionNames: 一个函数体中用到的非局部名字（嵌套的函数由 functionGlobals 单独处理）
+func functionNames(node interface{}, locals, used, written map[string]bool) {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			functionNames(e, locals, used, written)
+		}
+	case map[string]interface{}:
+		switch n["_type"] {
+		case "FunctionDef", "AsyncFunctionDef", "ClassDef", "Lambda":
+			return
+		case "Name":
+			if id, _ := n["id"].(string); !locals[id] {
+				used[id] = true
+			}
+		case "Global":
+			ids, _ := n["names"].([]interface{})
+			for _, id := range ids {
+				if s, ok := id.(string); ok {
+					used[s], written[s] = true, true
+				}
+			}
+		}
+		for _, v := range n {
+			functionNames(v, locals, used, written)
+		}
+	}
+}
+
+// handleGlobal: global X 让函数中对 X 的赋值写到文件作用域变量：函数作用域中放入模块的同一个符号
+func (g *generator) handleGlobal(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	names, _ := node["names"].([]interface{})
+	module := g.moduleScope()
+	ids := []string{}
+	for _, n := range names {
+		name, _ := n.(string)
+		sym := module.vars[name]
+		if sym == nil || sym.storage != "global" {
+			// 不是文件作用域变量：赋值只会改变函数中的局部变量
+			return g.unsupportedStmt(node, pad, fmt.Sprintf("global %s (only numbers and strings first assigned at the top level can be shared)", name))
+		}
+		g.funcScope().vars[name] = sym
+		ids = append(ids, name)
+	}
+	return pad + "// global " + strings.Join(ids, ", ") + "\n"
+}
@@ -0,0 +1,393 @@
+// Package golden: 示例程序的回归测试。每个示例（.py，或者 py2ast.py 输出的 .json）翻译为 C，
+// 编译、运行，标准输出与期望的输出比较：示例旁边的 .out 文件（golden 文件），没有时是用 Python 运行原程序的输出。
+//
+//	results := golden.RunAll([]string{"examples"}, golden.Config{Options: py2c.DefaultOptions(), Parse: parse})
+//
+// py2c test（cmd/py2c）与 go test 都用它；Verify（verify.go）是 py2c -verify 的差分执行
+package golden
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lixiasky/Py2c/py2c"
+)
+
+// Config: 怎样翻译、编译与运行示例
+type Config struct {
+	Options py2c.Options                      // 翻译选项；SourceFile 与 CFile 按示例设置
+	Parse   func(path string) ([]byte, error) // .py 示例的 AST JSON（py2ast.py 的输出）；nil 时只能运行 .json 示例
+	CC      string                            // C 编译器，空为 $CC，否则 cc、gcc、clang 中第一个能找到的
+	CFlags  []string                          // 传给 C 编译器的选项
+	Python  string                            // 运行原程序的解释器，空为 python3，找不到时用 python
+	Update  bool                              // 用 Python 的输出重写 .out 文件
+	Args    []string                          // 运行两个程序时的命令行参数
+	Timeout time.Duration                     // 每次运行（Python 或生成的程序）的时限，0 为 10 秒
+}
+
+// Status: 一个示例的结果
+type Status string
+
+const (
+	Pass    Status = "pass"    // 输出与期望的相同
+	Fail    Status = "fail"    // 输出不同
+	Error   Status = "error"   // 没能比较：不能翻译、编译失败、运行超时等
+	Updated Status = "updated" // Config.Update：写了 .out，同时输出相同
+)
+
+// Result: 一个示例的结果
+type Result struct {
+	Sample      string            // 示例文件
+	Status      Status            // Pass、Fail、Error 或 Updated
+	Stage       string            // Error 时出错的步骤：parse、translate、compile、run 或 python
+	Message     string            // Error 时的原因
+	Want, Got   string            // 期望的与生成的程序的标准输出
+	Diagnostics []py2c.Diagnostic // 翻译的诊断
+
+	// Verify 的结果
+	WantExit, GotExit     int    // Python 与生成的程序的退出码，被信号终止时为 -1
+	WantStderr, GotStderr string // 两个程序的错误输出
+	Line                  int    // 第一处不同的输出行由原程序的这一行写出，0 为不知道（或者只有退出码不同）
+	Source                string // 这一行的源码
+}
+
+// Diff: Fail 时第一处不同的行，形如 "line 3: want "x", got "y""；输出相同时为退出码的不同（Verify）
+func (r Result) Diff() string {
+	want, got := strings.Split(r.Want, "\n"), strings.Split(r.Got, "\n")
+	for i := 0; i < len(want) || i < len(got); i++ {
+		w, g := "<end of output>", "<end of output>"
+		if i < len(want) {
+			w = fmt.Sprintf("%q", want[i])
+		}
+		if i < len(got) {
+			g = fmt.Sprintf("%q", got[i])
+		}
+		if w != g {
+			return fmt.Sprintf("line %d: want %s, got %s", i+1, w, g)
+		}
+	}
+	if r.WantExit != r.GotExit {
+		return fmt.Sprintf("exit status: want %d, got %d", r.WantExit, r.GotExit)
+	}
+	return ""
+}
+
+// Samples: 展开目录（递归，跳过 . 开头的目录与 __pycache__）中的示例：.py，以及旁边没有同名 .py 的 .json；按路径排序
+func Samples(paths []string) ([]string, error) {
+	samples := []string{}
+	for _, p := range paths {
+		st, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !st.IsDir() {
+			samples = append(samples, p)
+			continue
+		}
+		err = filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if path != p && (strings.HasPrefix(info.Name(), ".") || info.Name() == "__pycache__") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			switch filepath.Ext(path) {
+			case ".py":
+				samples = append(samples, path)
+			case ".json":
+				if _, err := os.Stat(strings.TrimSuffix(path, ".json") + ".py"); err != nil {
+					samples = append(samples, path)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(samples)
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no .py or AST samples in %s", strings.Join(paths, ", "))
+	}
+	return samples, nil
+}
+
+// RunAll: 依次运行 paths 中的所有示例
+func RunAll(paths []string, cfg Config) ([]Result, error) {
+	samples, err := Samples(paths)
+	if err != nil {
+		return nil, err
+	}
+	results := []Result{}
+	for _, s := range samples {
+		results = append(results, Run(s, cfg))
+	}
+	return results, nil
+}
+
+// Run: 翻译、编译并运行一个示例，与期望的输出比较
+func Run(sample string, cfg Config) Result {
+	r := Result{Sample: sample}
+	dir, err := ioutil.TempDir("", "py2c-golden")
+	if err != nil {
+		return r.fail("compile", err)
+	}
+	defer os.RemoveAll(dir)
+	ast, exe, r := build(sample, cfg, dir)
+	if r.Status == Error {
+		return r
+	}
+	want, err := expected(sample, ast, cfg)
+	if err != nil {
+		return r.fail("python", err)
+	}
+	got, err := run(cfg, filepath.Dir(sample), exe)
+	if err == nil && got.signal != "" {
+		err = fmt.Errorf("%s was killed by %s%s", filepath.Base(exe), got.signal, stderrTail(got.stderr))
+	}
+	if err != nil {
+		return r.fail("run", err)
+	}
+	r.Want, r.Got = want, got.stdout
+	switch {
+	case r.Want != r.Got:
+		r.Status = Fail
+	case cfg.Update:
+		r.Status = Updated
+	default:
+		r.Status = Pass
+	}
+	return r
+}
+
+// fail: 在 stage 出错的结果
+func (r Result) fail(stage string, err error) Result {
+	r.Status, r.Stage, r.Message = Error, stage, err.Error()
+	return r
+}
+
+// build: 读入、翻译示例并在 dir 中编译，返回 AST 与可执行文件；出错时结果的 Status 为 Error
+func build(sample string, cfg Config, dir string) ([]byte, string, Result) {
+	r := Result{Sample: sample}
+	ast, err := readAST(sample, cfg)
+	if err != nil {
+		return nil, "", r.fail("parse", err)
+	}
+	base := strings.TrimSuffix(filepath.Base(sample), filepath.Ext(sample))
+	cPath, exe := filepath.Join(dir, base+".c"), filepath.Join(dir, base)
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	opts := cfg.Options
+	opts.SourceFile, opts.CFile = py2c.SourceFileOf(sample), cPath
+	out, diags, err := py2c.Translate(ast, opts)
+	r.Diagnostics = diags
+	if err != nil {
+		return nil, "", r.fail("translate", err)
+	}
+	errors := 0
+	for _, d := range diags {
+		if d.Severity == "error" {
+			errors++
+		}
+	}
+	if errors > 0 && !opts.StubUnsupported {
+		// StubUnsupported 时没有翻译的代码在运行到时失败
+		return nil, "", r.fail("translate", fmt.Errorf("%d construct(s) could not be translated, e.g. %s", errors, firstError(diags)))
+	}
+	if err := ioutil.WriteFile(cPath, []byte(out.C), 0644); err != nil {
+		return nil, "", r.fail("compile", err)
+	}
+	if err := compile(cfg, cPath, exe, out); err != nil {
+		return nil, "", r.fail("compile", err)
+	}
+	return ast, exe, r
+}
+
+// firstError: 第一个错误诊断，文件:行:列: 消息
+func firstError(diags []py2c.Diagnostic) string {
+	for _, d := range diags {
+		if d.Severity == "error" {
+			return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Col, d.Message)
+		}
+	}
+	return ""
+}
+
+// readAST: .json 示例原样读入，.py 交给 Config.Parse
+func readAST(sample string, cfg Config) ([]byte, error) {
+	if filepath.Ext(sample) != ".py" {
+		return ioutil.ReadFile(sample)
+	}
+	if cfg.Parse == nil {
+		return nil, fmt.Errorf("%s: Config.Parse is nil, only .json samples can be run", sample)
+	}
+	return cfg.Parse(sample)
+}
+
+// expected: 期望的输出：.out 文件，没有时（或 Config.Update）为 Python 运行原程序的输出
+func expected(sample string, ast []byte, cfg Config) (string, error) {
+	golden := strings.TrimSuffix(sample, filepath.Ext(sample)) + ".out"
+	if !cfg.Update {
+		if data, err := ioutil.ReadFile(golden); err == nil {
+			return string(data), nil
+		}
+	}
+	src, cleanup, err := pythonSource(sample, ast)
+	if err != nil {
+		if filepath.Ext(sample) != ".py" {
+			err = fmt.Errorf("no %s, and %v", filepath.Base(golden), err)
+		}
+		return "", err
+	}
+	defer cleanup()
+	want, err := run(cfg, filepath.Dir(sample), python(cfg), src)
+	if err != nil {
+		return "", err
+	}
+	if cfg.Update {
+		if err := ioutil.WriteFile(golden, []byte(want.stdout), 0644); err != nil {
+			return "", err
+		}
+	}
+	return want.stdout, nil
+}
+
+// pythonSource: 原程序的绝对路径；AST 示例为 py2ast.py 写入的源码，写在临时文件中，用完后调用 cleanup 删除
+func pythonSource(sample string, ast []byte) (string, func(), error) {
+	src, cleanup := sample, func() {}
+	if filepath.Ext(sample) != ".py" {
+		var root struct {
+			Source *string `json:"source"`
+		}
+		if err := json.Unmarshal(ast, &root); err != nil || root.Source == nil {
+			return "", nil, fmt.Errorf("the AST has no source to run with Python")
+		}
+		f, err := ioutil.TempFile("", "py2c-golden-*.py")
+		if err != nil {
+			return "", nil, err
+		}
+		cleanup = func() { os.Remove(f.Name()) }
+		_, err = f.WriteString(*root.Source)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			cleanup()
+			return "", nil, err
+		}
+		src = f.Name()
+	}
+	abs, err := filepath.Abs(src)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return abs, cleanup, nil
+}
+
+// python: Config.Python，默认 python3，找不到时用 python
+func python(cfg Config) string {
+	if cfg.Python != "" {
+		return cfg.Python
+	}
+	if _, err := exec.LookPath("python3"); err != nil {
+		return "python"
+	}
+	return "python3"
+}
+
+// compile: 编译生成的 C 代码，链接它用到的库
+func compile(cfg Config, cPath, exe string, out py2c.Output) error {
+	cc := cfg.CC
+	if cc == "" {
+		cc = os.Getenv("CC")
+	}
+	for _, c := range []string{"cc", "gcc", "clang"} {
+		if cc != "" {
+			break
+		}
+		if _, err := exec.LookPath(c); err == nil {
+			cc = c
+		}
+	}
+	if cc == "" {
+		return fmt.Errorf("no C compiler found (cc, gcc or clang)")
+	}
+	args := append(append([]string{}, cfg.CFlags...), "-o", exe, cPath)
+	if out.UsesMath {
+		args = append(args, "-lm")
+	}
+	if out.UsesThreads {
+		args = append(args, "-pthread")
+	}
+	for _, l := range out.Libraries {
+		if l != "m" || !out.UsesMath {
+			args = append(args, "-l"+l)
+		}
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(cc, args...)
+	cmd.Stdout, cmd.Stderr = &stderr, &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %v\n%s", cc, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// proc: 一次运行的结果
+type proc struct {
+	stdout, stderr string
+	exit           int    // 退出码
+	signal         string // 被信号终止时的信号（如 segmentation fault），此时 exit 为 -1
+}
+
+// run: 在 dir 中运行程序（Config.Args 为参数，没有输入）；超时或者不能启动时为错误
+func run(cfg Config, dir, name string, args ...string) (proc, error) {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, append(args, cfg.Args...)...)
+	cmd.Dir, cmd.Stdout, cmd.Stderr = dir, &stdout, &stderr
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return proc{}, fmt.Errorf("%s did not finish within %v", filepath.Base(name), timeout)
+	}
+	p := proc{stdout: stdout.String(), stderr: stderr.String()}
+	if ee, ok := err.(*exec.ExitError); ok {
+		if p.exit = ee.ExitCode(); p.exit < 0 {
+			p.signal = strings.TrimPrefix(ee.Error(), "signal: ")
+		}
+		err = nil
+	}
+	if err != nil {
+		return proc{}, fmt.Errorf("running %s: %v", filepath.Base(name), err)
+	}
+	return p, nil
+}
+
+// stderrTail: 错误输出的最后一行，作为消息的补充
+func stderrTail(stderr string) string {
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return ": " + last
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+package golden
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lixiasky/Py2c/py2c"
+)
+
+// testConfig: 用 cc 编译、python3 与 py2ast.py 解析的 Config；没有 C 编译器或 Python 时跳过测试。
+// printf 的格式与实参类型不符（如 %f 配 int）是未定义行为，编译时就算错误
+func testConfig(t *testing.T) Config {
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("no cc")
+	}
+	py, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("no python3 to parse the samples")
+	}
+	script, _ := filepath.Abs("../../py2ast.py")
+	parse := func(path string) ([]byte, error) {
+		return exec.Command(py, script, path).Output()
+	}
+	return Config{Options: py2c.DefaultOptions(), Parse: parse, CC: "cc", CFlags: []string{"-Wformat", "-Werror=format"}, Python: py}
+}
+
+// TestExamples: examples/ 中的每个示例翻译、编译、运行后的输出与 .out 相同
+func TestExamples(t *testing.T) {
+	cfg := testConfig(t)
+	samples, err := Samples([]string{"../../examples"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range samples {
+		s := s
+		t.Run(filepath.Base(s), func(t *testing.T) {
+			switch r := Run(s, cfg); r.Status {
+			case Pass:
+			case Fail:
+				t.Errorf("%s", r.Diff())
+			default:
+				t.Errorf("%s: %s", r.Stage, r.Message)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	for _, c := range []struct{ want, got, diff string }{
+		{"a\nb\n", "a\nb\n", ""},
+		{"a\nb\n", "a\nc\n", `line 2: want "b", got "c"`},
+		{"a\n", "a\nb\n", `line 2: want "", got "b"`},
+		{"a\nb", "a", `line 2: want "b", got <end of output>`},
+	} {
+		if d := (Result{Want: c.want, Got: c.got}).Diff(); d != c.diff {
+			t.Errorf("Diff(%q, %q) = %q, want %q", c.want, c.got, d, c.diff)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	cfg := testConfig(t)
+	if r := Verify("../../examples/fib.py", cfg); r.Status != Pass {
+		t.Errorf("fib.py: %s", r.Report())
+	}
+	dir := t.TempDir()
+	sample := filepath.Join(dir, "div.py")
+	src := "a = 7\nb = 2\nprint(\"start\")\nprint(a / b)\n"
+	if err := ioutil.WriteFile(sample, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := Verify(sample, cfg)
+	if r.Status != Fail || r.Line != 4 || r.Source != "print(a / b)" || r.WantExit != 0 || r.GotExit != 0 {
+		t.Errorf("status %s, line %d %q, exit %d/%d; want a failure at line 4", r.Status, r.Line, r.Source, r.WantExit, r.GotExit)
+	}
+	if want := `output line 2: want "3.5", got "3.500000"`; !strings.Contains(r.Report(), want) {
+		t.Errorf("report lacks %q:\n%s", want, r.Report())
+	}
+}
+
+// TestInlineGetters: -inline-getters 不内联子类重写了的 getter
+func TestInlineGetters(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Options.InlineGetters = true
+	if r := Run("../../examples/getters.py", cfg); r.Status != Pass {
+		t.Errorf("getters.py: %s", r.Report())
+	}
+}
+
+// sanitize: 加上 -fsanitize=NAME 的 Config；编译器不支持该 sanitizer 或者编译出的程序不能运行时跳过测试。
+// 发现问题时程序以非 0 状态退出，所以用 Verify（比较退出状态）而不是 Run
+func sanitize(t *testing.T, cfg Config, name string) Config {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "probe.c")
+	if err := ioutil.WriteFile(src, []byte("int main(void) { return 0; }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	flag, exe := "-fsanitize="+name, filepath.Join(dir, "probe")
+	if err := exec.Command(cfg.CC, flag, "-o", exe, src).Run(); err != nil {
+		t.Skipf("cc has no %s", flag)
+	}
+	if err := exec.Command(exe).Run(); err != nil {
+		t.Skipf("%s programs do not run here: %v", flag, err)
+	}
+	cfg.CFlags = append(append([]string{}, cfg.CFlags...), flag, "-fno-sanitize-recover=all", "-g")
+	return cfg
+}
+
+// TestArena: -alloc arena 的示例在 UBSan 下运行，输出不变
+func TestArena(t *testing.T) {
+	cfg := sanitize(t, testConfig(t), "undefined")
+	cfg.Options.Alloc = "arena"
+	samples, err := Samples([]string{"../../examples"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range samples {
+		if r := Verify(s, cfg); r.Status != Pass {
+			t.Errorf("%s: %s", filepath.Base(s), r.Report())
+		}
+	}
+}
+
+// TestOwnedStrings: -owned-strings 释放只由字符串变量持有的字符串，在 ASan（含 LeakSanitizer）下没有泄漏；
+// 存入列表与对象的字符串不在此列，见 README
+func TestOwnedStrings(t *testing.T) {
+	cfg := sanitize(t, testConfig(t), "address")
+	cfg.Options.OwnedStrings = true
+	if r := Verify("../testdata/owned.json", cfg); r.Status != Pass {
+		t.Errorf("owned.json: %s", r.Report())
+	}
+}
+
+// TestFeatures: ../testdata 中的异常、with、文件与 json 用例在临时目录中运行（它们会写文件），
+// 输出与 Python 相同；每个再用 -exceptions status 跑一遍
+func TestFeatures(t *testing.T) {
+	cfg := testConfig(t)
+	status := cfg
+	status.Options.Exceptions = "status"
+	dir := t.TempDir()
+	for _, name := range []string{"exceptions", "with", "files", "jsonmod"} {
+		data, err := ioutil.ReadFile(filepath.Join("..", "testdata", name+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sample := filepath.Join(dir, name+".json")
+		if err := ioutil.WriteFile(sample, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, cfg := range []Config{cfg, status} {
+			if r := Run(sample, cfg); r.Status != Pass {
+				t.Errorf("%s (-exceptions %s): %s", name, cfg.Options.Exceptions, r.Report())
+			}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package golden
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Verify：差分执行。同时运行 Python 原程序与翻译后的程序，比较标准输出与退出码（不用 .out 文件）。
+// Python 通过 verifyDriver 运行，记下每一行输出由原程序的哪一行写出，不同时指出负责的语句，
+// 例如整数除法与浮点除法的差别：
+//
+//	foo.py: output line 3: want "2.5", got "2"
+//	  foo.py:7: print(a / b)
+
+// Verify: 翻译、编译 sample，与 Python 原程序比较输出与退出码
+func Verify(sample string, cfg Config) Result {
+	r := Result{Sample: sample}
+	dir, err := ioutil.TempDir("", "py2c-verify")
+	if err != nil {
+		return r.fail("compile", err)
+	}
+	defer os.RemoveAll(dir)
+	ast, exe, r := build(sample, cfg, dir)
+	if r.Status == Error {
+		return r
+	}
+	src, cleanup, err := pythonSource(sample, ast)
+	if err != nil {
+		return r.fail("python", err)
+	}
+	defer cleanup()
+	lineMap := filepath.Join(dir, "lines.json")
+	want, err := run(cfg, filepath.Dir(sample), python(cfg), "-c", verifyDriver, src, lineMap)
+	if err != nil {
+		return r.fail("python", err)
+	}
+	got, err := run(cfg, filepath.Dir(sample), exe)
+	if err != nil {
+		return r.fail("run", err)
+	}
+	r.Want, r.Got, r.WantExit, r.GotExit = want.stdout, got.stdout, want.exit, got.exit
+	r.WantStderr, r.GotStderr = want.stderr, got.stderr
+	if got.signal != "" {
+		r.GotStderr = strings.TrimRight(got.stderr, "\n") + "\n" + got.signal
+	}
+	if r.Want == r.Got && r.WantExit == r.GotExit {
+		r.Status = Pass
+		return r
+	}
+	r.Status = Fail
+	if r.Want != r.Got {
+		r.Line = responsibleLine(lineMap, firstDifference(r.Want, r.Got))
+		r.Source = sourceLine(src, r.Line)
+	}
+	return r
+}
+
+// firstDifference: 两个输出第一处不同的行号（从 0 开始）
+func firstDifference(want, got string) int {
+	w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+	i := 0
+	for i < len(w) && i < len(g) && w[i] == g[i] {
+		i++
+	}
+	return i
+}
+
+// responsibleLine: Python 的第 n 行输出（从 0 开始）由原程序的哪一行写出；输出没有这么多行时取最后一行
+func responsibleLine(lineMap string, n int) int {
+	data, err := ioutil.ReadFile(lineMap)
+	if err != nil {
+		return 0
+	}
+	var lines []int
+	if json.Unmarshal(data, &lines) != nil || len(lines) == 0 {
+		return 0
+	}
+	if n >= len(lines) {
+		n = len(lines) - 1
+	}
+	return lines[n]
+}
+
+// sourceLine: 源文件的第 n 行（从 1 开始），去掉缩进
+func sourceLine(path string, n int) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil || n <= 0 {
+		return ""
+	}
+	lines := strings.Split(string(data), "\n")
+	if n > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[n-1])
+}
+
+// Report: Verify 的结果的文字形式：相同时一行，不同时给出第一处不同与负责的源码行、两个程序的退出码与错误输出
+func (r Result) Report() string {
+	switch r.Status {
+	case Pass:
+		n := strings.Count(r.Got, "\n")
+		lines := "lines"
+		if n == 1 {
+			lines = "line"
+		}
+		return fmt.Sprintf("%s: same output (%d %s) and exit status %d\n", r.Sample, n, lines, r.GotExit)
+	case Error:
+		return fmt.Sprintf("%s: %s: %s\n", r.Sample, r.Stage, r.Message)
+	}
+	var b strings.Builder
+	if r.Want != r.Got {
+		d := Result{Want: r.Want, Got: r.Got}.Diff()
+		fmt.Fprintf(&b, "%s: output %s\n", r.Sample, d)
+		if r.Line > 0 {
+			fmt.Fprintf(&b, "  %s:%d: %s\n", r.Sample, r.Line, r.Source)
+		}
+	}
+	if r.WantExit != r.GotExit {
+		fmt.Fprintf(&b, "%s: exit status: Python %d, C %d\n", r.Sample, r.WantExit, r.GotExit)
+		for _, e := range []struct{ who, text string }{{"Python", r.WantStderr}, {"C", r.GotStderr}} {
+			if tail := stderrTail(e.text); tail != "" {
+				fmt.Fprintf(&b, "  %s%s\n", e.who, tail)
+			}
+		}
+	}
+	return b.String()
+}
+
+// verifyDriver: 用 runpy 运行原程序（sys.argv[1]），把每一行标准输出开始时原程序所在的行号写成 JSON（sys.argv[2]）
+const verifyDriver = `import json, runpy, sys
+path, line_map = sys.argv[1], sys.argv[2]
+sys.argv = [path] + sys.argv[3:]
+lines = []
+
+class Lines:
+    def __init__(self, out):
+        self.out, self.at_start = out, True
+    def write(self, s):
+        f = sys._getframe(1)
+        while f is not None and f.f_code.co_filename != path:
+            f = f.f_back
+        for c in s:
+            if self.at_start:
+                lines.append(f.f_lineno if f is not None else 0)
+            self.at_start = c == "\n"
+        return self.out.write(s)
+    def __getattr__(self, name):
+        return getattr(self.out, name)
+
+sys.stdout = Lines(sys.stdout)
+try:
+    runpy.run_path(path, run_name="__main__")
+finally:
+    sys.stdout.flush()
+    with open(line_map, "w") as f:
+        json.dump(lines, f)
+`
@@ -0,0 +1,179 @@
+package py2c
+
+import (
+	"fmt"
+	"strings"
+)
+
+// heapq 模块：heappush、heappop 与 heapify 把列表当作最小堆，调用每种列表第一次用到时生成的辅助函数：
+//
+//	heapq.heappush(h, 5)        PyList_int_heappush(h, 5);
+//	x = heapq.heappop(h)        int x = PyList_int_heappop(h);
+//	heapq.heapify(h)            PyList_int_heapify(h);
+//
+// 上浮与下沉按 CPython 的 _siftdown / _siftup 实现，所以操作之后列表中的顺序与 Python 相同（print(h) 的输出一致）。
+// 元素按 < 比较：数、字符串（strcmp）、IntEnum 的成员，以及按字段依次比较的 NamedTuple（Dijkstra 的 (dist, node)）
+
+// heapqFuncs: 翻译的 heapq 函数
+var heapqFuncs = map[string]bool{"heapq.heappush": true, "heapq.heappop": true, "heapq.heapify": true}
+
+// heapqPop: node 是 heapq.heappop(h) 时返回 h 的元素类型（类型推断在翻译 import 之前，按 importedName 识别）
+func (g *generator) heapqPop(node map[string]interface{}) string {
+	args, _ := node["args"].([]interface{})
+	if node["_type"] != "Call" || g.importedName(node["func"]) != "heapq.heappop" || len(args) != 1 {
+		return ""
+	}
+	elem, _ := g.listElemType(g.getType(args[0]))
+	return elem
+}
+
+// heapqCall: heapq.heappush(h, v) / heapq.heappop(h) / heapq.heapify(h)
+func (g *generator) heapqCall(qname string, node ASTNode) string {
+	name := strings.TrimPrefix(qname, "heapq.")
+	if !heapqFuncs[qname] {
+		return g.unsupportedExpr(node, fmt.Sprintf("call: %s (only heappush, heappop and heapify are translated)", qname))
+	}
+	args, _ := node["args"].([]interface{})
+	want := 1
+	if name == "heappush" {
+		want = 2
+	}
+	if len(args) != want || len(node["keywords"].([]interface{})) > 0 {
+		return g.unsupportedExpr(node, fmt.Sprintf("call: %s with %d arguments", qname, len(args)))
+	}
+	lt := g.getType(args[0])
+	elem, ok := g.listElemType(lt)
+	if !ok {
+		return g.unsupportedExpr(node, fmt.Sprintf("call: %s of something other than a list", qname))
+	}
+	if why := g.heapRuntime(strings.TrimSuffix(lt, "*"), elem); why != "" {
+		return g.unsupportedExpr(node, fmt.Sprintf("call: %s on a list of %s (%s)", qname, elem, why))
+	}
+	list := strings.TrimSuffix(lt, "*")
+	h := g.toC(args[0].(map[string]interface{}), 0)
+	switch name {
+	case "heappush":
+		v := g.toC(args[1].(map[string]interface{}), 0)
+		if g.isRcType(elem) {
+			v = g.rcRef(elem, v) // 与 append 一样，列表持有自己的引用
+		}
+		return fmt.Sprintf("%s_heappush(%s, %s)", list, h, g.upcastElem(elem, args[1], v))
+	case "heappop":
+		if !g.optRefcount {
+			return fmt.Sprintf("%s_heappop(%s)", list, h)
+		}
+		return g.rcHold(elem, fmt.Sprintf("%s_heappop(%s)", list, h)) // 取出列表持有的引用
+	}
+	return fmt.Sprintf("%s_heapify(%s)", list, h)
+}
+
+// listOrder: 第一次用到时生成列表 list 的元素比较函数 list_lt(a, b)（堆与 bisect.go 的二分查找共用）；元素不能比较时返回原因
+func (g *generator) listOrder(list, elem string) string {
+	less, why := g.orderLess(elem)
+	if why != "" || g.listFuncs[list+"_lt"] {
+		return why
+	}
+	g.listFuncs[list+"_lt"] = true
+	g.classStructs = append(g.classStructs, fmt.Sprintf("// a < b for the items of %[1]s\nstatic int %[1]s_lt(%[2]s a, %[2]s b) {\n%[3]s}\n", list, elem, less))
+	return ""
+}
+
+// orderLess: 元素类型 elem 的 a < b 的函数体，不能比较时返回原因
+func (g *generator) orderLess(elem string) (string, string) {
+	if less := g.scalarLess(elem, "a", "b"); less != "" {
+		return "    return " + less + ";\n", ""
+	}
+	cls := strings.TrimSuffix(elem, "*")
+	r := g.records[cls]
+	if r == nil || !g.isObjectPointer(elem) {
+		return "", "only numbers, strings, IntEnum members and NamedTuples are ordered"
+	}
+	// NamedTuple 按字段依次比较：前面的字段相等时才看下一个
+	body := ""
+	for _, f := range r.fields {
+		ft := g.classFieldType(cls, f)
+		lt, gt := g.scalarLess(ft, "a->"+f, "b->"+f), g.scalarLess(ft, "b->"+f, "a->"+f)
+		if lt == "" {
+			return "", fmt.Sprintf("the field %s of %s is %s, which is not ordered", f, cls, ft)
+		}
+		body += fmt.Sprintf("    if (%s) {\n        return 1;\n    }\n    if (%s) {\n        return 0;\n    }\n", lt, gt)
+	}
+	return body + "    return 0;\n", ""
+}
+
+// scalarLess: 数、字符串与 IntEnum 成员的 a < b，其他类型为空
+func (g *generator) scalarLess(t, a, b string) string {
+	switch {
+	case t == "int", t == "double", g.enums[t] != nil && g.enums[t].kind == "IntEnum":
+		return fmt.Sprintf("%s < %s", a, b)
+	case t == "char*":
+		g.includes["string.h"] = true
+		return fmt.Sprintf("strcmp(%s, %s) < 0", a, b)
+	}
+	return ""
+}
+
+// heapRuntime: 第一次用到时生成列表 list 的堆操作（放在 classStructs 中，在列表之后）；元素不能比较时返回原因
+func (g *generator) heapRuntime(list, elem string) string {
+	if why := g.listOrder(list, elem); why != "" || g.listFuncs[list+"_heappush"] {
+		return why
+	}
+	g.listFuncs[list+"_heappush"] = true
+	g.classStructs = append(g.classStructs, fmt.Sprintf(`// heapq on %[1]s: a binary min-heap in the items, sifted like CPython's heapq so the order of the items matches
+// move the item at pos towards the root (down to start) while it is smaller than its parent
+static void %[1]s_heapup(%[1]s* l, int start, int pos) {
+    %[2]s item = l->items[pos];
+    while (pos > start) {
+        int parent = (pos - 1) / 2;
+        if (!%[1]s_lt(item, l->items[parent])) {
+            break;
+        }
+        l->items[pos] = l->items[parent];
+        pos = parent;
+    }
+    l->items[pos] = item;
+}
+// move the smaller child up until the hole at pos reaches a leaf, then put the item there and move it back up
+static void %[1]s_heapdown(%[1]s* l, int pos) {
+    int start = pos;
+    %[2]s item = l->items[pos];
+    int child = 2 * pos + 1;
+    while (child < l->len) {
+        if (child + 1 < l->len && !%[1]s_lt(l->items[child], l->items[child + 1])) {
+            child++;
+        }
+        l->items[pos] = l->items[child];
+        pos = child;
+        child = 2 * pos + 1;
+    }
+    l->items[pos] = item;
+    %[1]s_heapup(l, start, pos);
+}
+static void %[1]s_heappush(%[1]s* l, %[2]s v) {
+    %[1]s_append(l, v);
+    %[1]s_heapup(l, 0, l->len - 1);
+}
+static %[2]s %[1]s_heappop(%[1]s* l) {
+    %[2]s last;
+    %[2]s top;
+    if (l->len == 0) {
+        %[3]s
+    }
+    last = l->items[--l->len];
+    if (l->len == 0) {
+        return last;
+    }
+    top = l->items[0];
+    l->items[0] = last;
+    %[1]s_heapdown(l, 0);
+    return top;
+}
+static void %[1]s_heapify(%[1]s* l) {
+    int i;
+    for (i = l->len / 2 - 1; i >= 0; i--) {
+        %[1]s_heapdown(l, i);
+    }
+}
+`, list, elem, g.runtimeError("IndexError", "index out of range")))
+	return ""
+}
@@ -0,0 +1,714 @@
+package py2c
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// --- 全程序类型推断 ---
+// 代码生成之前推断变量、顶层函数参数与返回值的类型：参数类型来自所有调用点的实参，
+// 返回类型来自 return 表达式，变量类型来自赋值。三者互相依赖（实参是调用方的变量，
+// 变量的值可能是另一个函数的返回值），所以反复迭代直到结果不再变化。
+// 调用点的实参类型（funcArgTypes、classInitArgTypes）按推断出的变量类型收集；
+// 类型冲突记为诊断，而不是悄悄当作 double。
+
+// maxInferRounds: 迭代次数的上限；每一轮只会让类型从未知变为已知或变为冲突，实际几轮就收敛
+const maxInferRounds = 10
+
+// inferScope: 参与推断的作用域：模块顶层（名字为空）、顶层函数、方法（类名.方法名）
+type inferScope struct {
+	name   string
+	fn     bool // 顶层函数与方法：推断参数与返回值
+	body   []interface{}
+	params []string // 参数名（方法不含 self）
+	locals map[string]bool
+}
+
+// inferConflict: 一处类型冲突，推断收敛后报告
+type inferConflict struct {
+	node interface{}
+	msg  string
+}
+
+// inferTypes: 迭代到不动点，结果留在 inferVars / inferParams / inferReturns，funcArgTypes 为最后一轮收集的实参类型
+func (g *generator) inferTypes(root ASTNode) {
+	g.inferScopes = map[string]*inferScope{}
+	order := []*inferScope{{name: "", body: root["body"].([]interface{})}}
+	body, _ := root["body"].([]interface{})
+	for _, stmt := range body {
+		m, _ := stmt.(map[string]interface{})
+		switch m["_type"] {
+		case "FunctionDef":
+			order = append(order, newInferScope(m["name"].(string), m, true, false))
+		case "ClassDef":
+			cbody, _ := m["body"].([]interface{})
+			for _, s := range cbody {
+				if fm, _ := s.(map[string]interface{}); fm["_type"] == "FunctionDef" {
+					key := fmt.Sprintf("%v.%v", m["name"], fm["name"])
+					order = append(order, newInferScope(key, fm, true, !g.staticMethods[key]))
+				}
+			}
+		}
+	}
+	for _, s := range order {
+		g.inferScopes[s.name] = s
+	}
+	g.inferVars, g.inferParams, g.inferReturns = map[string]map[string]string{}, map[string][]string{}, map[string]string{}
+	var conflicts []inferConflict
+	for round := 1; ; round++ {
+		before := []interface{}{copyTypes(g.inferVars), copyParams(g.inferParams), copyReturns(g.inferReturns)}
+		conflicts = g.inferRound(root, order)
+		if reflect.DeepEqual(before, []interface{}{g.inferVars, g.inferParams, g.inferReturns}) || round == maxInferRounds {
+			g.tracef("type inference: %d rounds, params=%v, returns=%v", round, g.inferParams, g.inferReturns)
+			break
+		}
+	}
+	for _, c := range conflicts {
+		g.report(logWarn, c.node, "%s", c.msg)
+	}
+}
+
+func newInferScope(name string, node map[string]interface{}, fn, method bool) *inferScope {
+	s := &inferScope{name: name, fn: fn}
+	s.body, _ = node["body"].([]interface{})
+	s.locals = localNames(s.body)
+	args, _ := node["args"].(map[string]interface{})
+	list, _ := args["args"].([]interface{})
+	for i, a := range list {
+		id, _ := a.(map[string]interface{})["arg"].(string)
+		s.locals[id] = true
+		if i > 0 || !method {
+			s.params = append(s.params, id)
+		}
+	}
+	return s
+}
+
+// inferRound: 一轮推断：实参 -> 参数类型，赋值 -> 变量类型，return -> 返回类型；返回本轮发现的冲突
+func (g *generator) inferRound(root ASTNode, order []*inferScope) []inferConflict {
+	var conflicts []inferConflict
+	g.funcArgTypes, g.classInitArgTypes = map[string][][]string{}, map[string][][]string{}
+	g.inferWidened = map[string]map[string]bool{}
+	g.collectFuncArgTypes(root)
+	g.collectSuperInitArgTypes(root)
+	g.inferCollections(order) // 见 collections.go
+	g.inferEmptyLists(order)
+	fields := map[string]map[string]string{}
+	for _, s := range order {
+		if !s.fn {
+			continue
+		}
+		calls, callee := g.funcArgTypes[s.name], s.name
+		ctor := strings.HasSuffix(s.name, ".__init__")
+		if ctor {
+			// 构造函数：实参来自 类名(...)、没有 __init__ 的子类的实例化与 super().__init__(...)
+			callee = strings.TrimSuffix(s.name, ".__init__")
+			calls = g.classInitArgTypes[callee]
+		}
+		types := make([]string, len(s.params))
+		for i, p := range s.params {
+			if t := g.annotParam(s.name, i); t != "" && !(ctor && g.annotClasses[t]) {
+				types[i] = t
+				continue
+			}
+			var seen []string
+			for _, call := range calls {
+				if i < len(call) {
+					seen = append(seen, call[i])
+				}
+			}
+			t, a, b := g.unifyTypes(seen)
+			if a != "" {
+				conflicts = append(conflicts, inferConflict{g.callSite(order, callee, i, b), fmt.Sprintf("argument %s of %s() is %s here but %s in another call; the parameter is declared double", p, callee, b, a)})
+			}
+			if cls := g.objectReturn(seen); t == "" && cls != "" {
+				t = cls + "*" // 对象参数按指针传递（多个类时由代码生成取共同祖先）
+			} else if t == "" && ctor && len(seen) > 0 {
+				// 构造函数不经过调用点的代码生成，多个类在这里取共同祖先
+				classes := map[string]bool{}
+				for _, c := range seen {
+					classes[c] = true
+				}
+				if cls := g.commonAncestor(classes); cls != "" {
+					t = cls + "*"
+				}
+			}
+			types[i] = t
+		}
+		if !reflect.DeepEqual(g.inferParams[s.name], types) {
+			delete(g.inferTabs, s.name)
+		}
+		g.inferParams[s.name] = types
+	}
+	for _, s := range order {
+		vars := g.inferVars[s.name]
+		if vars == nil {
+			vars = map[string]string{}
+			g.inferVars[s.name] = vars
+		}
+		first := map[string]interface{}{}
+		pending := map[string]bool{} // 本轮的值还没有定下来的变量，见 settledType
+		var returns []string
+		var returnNodes []interface{}
+		walkInferStmts(s.body, func(m map[string]interface{}) {
+			switch m["_type"] {
+			case "Assign":
+				targets, _ := m["targets"].([]interface{})
+				if len(targets) == 1 {
+					t, ok := g.settledType(s.name, m["value"], pending)
+					g.inferAssign(s, vars, first, targets[0], t, m, &conflicts)
+					markPending(pending, targets[0], ok)
+					if ok {
+						inferField(fields, s.name, targets[0], t)
+					}
+				}
+			case "AnnAssign":
+				if m["value"] != nil {
+					t, ok := g.settledType(s.name, m["value"], pending)
+					g.inferAssign(s, vars, first, m["target"], t, m, &conflicts)
+					markPending(pending, m["target"], ok)
+				}
+			case "For":
+				iter, _ := m["iter"].(map[string]interface{})
+				t := g.iterElemType(iter, func(e interface{}) string { return g.typeIn(s.name, e) })
+				if t != "" {
+					g.inferAssign(s, vars, first, m["target"], t, m, &conflicts)
+				}
+			case "Return":
+				t, ok := g.settledType(s.name, m["value"], pending)
+				if v, _ := m["value"].(map[string]interface{}); v["_type"] == "Name" && vars[fmt.Sprint(v["id"])] != "" {
+					t = vars[fmt.Sprint(v["id"])] // 对象与对象的列表不登记在符号表中（见 inferEnv）
+				}
+				if s.fn && m["value"] != nil && ok {
+					returns = append(returns, t)
+					returnNodes = append(returnNodes, m)
+				}
+			}
+		})
+		if !s.fn || returnsTuple(s.body) || g.annotReturns[s.name] != "" {
+			continue
+		}
+		t, a, b := g.unifyTypes(returns)
+		if a != "" {
+			for i, r := range returns {
+				if r == b {
+					conflicts = append(conflicts, inferConflict{returnNodes[i], fmt.Sprintf("%s() returns %s here but %s elsewhere; the result is declared double", s.name, b, a)})
+					break
+				}
+			}
+			t = ""
+		}
+		switch t {
+		case "int", "double", "char*":
+			g.inferReturns[s.name] = t
+		default:
+			if _, ok := g.listElemType(t); ok {
+				g.inferReturns[s.name] = t // 经由 result 返回的列表：调用方的变量也是列表
+				break
+			}
+			if cls := g.objectReturn(returns); cls != "" {
+				g.inferReturns[s.name] = cls + "*" // 工厂方法（return cls(...)）：调用点在方法生成之前也知道结果是对象
+				break
+			}
+			delete(g.inferReturns, s.name) // 对象、列表等由代码生成按原来的规则决定
+		}
+	}
+	g.inferFields = fields
+	return conflicts
+}
+
+// inferField: 方法中的 self.x = v 记为类的字段 x 的类型（每个字段第一次赋值的类型）
+func inferField(fields map[string]map[string]string, scope string, target interface{}, t string) {
+	tm, _ := target.(map[string]interface{})
+	self, _ := tm["value"].(map[string]interface{})
+	attr, _ := tm["attr"].(string)
+	i := strings.Index(scope, ".")
+	if tm["_type"] != "Attribute" || self["id"] != "self" || i < 0 || t == "" {
+		return
+	}
+	class := scope[:i]
+	if fields[class] == nil {
+		fields[class] = map[string]string{}
+	}
+	if _, ok := fields[class][attr]; !ok {
+		fields[class][attr] = t
+	}
+}
+
+// inferFieldType: 类（含父类）还没有生成时推断出的字段类型
+func (g *generator) inferFieldType(class, attr string) string {
+	for c := class; c != ""; c = g.preClassBases[c] {
+		if t := g.inferFields[c][attr]; t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+// inferEmptyLists: x = [] 与 x = [1, 2] 的元素类型按之后的 x.append(v) 推断，函数中 return [] 的按其他 return 的列表推断，
+// 记在 List 节点的 _elem 中（getType 取用）；推断不出时与原来一样是 double。int 与 float 合并为 double，多个类取共同祖先。
+// 模块级的 x = [] 也按函数中的 x.append(v) 推断（函数中用到的模块变量是文件作用域变量，见 declareGlobals）
+func (g *generator) inferEmptyLists(order []*inferScope) {
+	empties := map[string]map[string][]map[string]interface{}{} // 作用域 -> 变量 -> x = [] 的 List 节点
+	ints := map[string]map[string][]map[string]interface{}{}    // 作用域 -> 变量 -> x = [1, 2] 的 List 节点
+	seen := map[string]map[string][]string{}                    // 作用域 -> 变量 -> 追加的值的类型
+	for _, s := range order {
+		empty, intList := map[string][]map[string]interface{}{}, map[string][]map[string]interface{}{}
+		walkInferStmts(s.body, func(m map[string]interface{}) {
+			targets, _ := m["targets"].([]interface{})
+			target := toNode(targets, 0)
+			value, _ := m["value"].(map[string]interface{})
+			id, _ := target["id"].(string)
+			if m["_type"] != "Assign" || len(targets) != 1 || target["_type"] != "Name" {
+				return
+			}
+			if isEmptyList(value) {
+				empty[id] = append(empty[id], value)
+			} else if g.intList(s.name, value) {
+				intList[id] = append(intList[id], value)
+			}
+		})
+		empties[s.name], ints[s.name], seen[s.name] = empty, intList, map[string][]string{}
+	}
+	for _, s := range order {
+		walkInferStmts(s.body, func(m map[string]interface{}) {
+			walkCalls(m, func(call map[string]interface{}) {
+				fn, _ := call["func"].(map[string]interface{})
+				recv, _ := fn["value"].(map[string]interface{})
+				args, _ := call["args"].([]interface{})
+				id, _ := recv["id"].(string)
+				if fn["attr"] != "append" || recv["_type"] != "Name" || len(args) != 1 {
+					return
+				}
+				if empties[s.name][id] != nil || ints[s.name][id] != nil {
+					seen[s.name][id] = append(seen[s.name][id], g.elemTypeIn(s.name, args[0]))
+				} else if s.fn && !s.locals[id] && (empties[""][id] != nil || ints[""][id] != nil) {
+					seen[""][id] = append(seen[""][id], g.elemTypeIn(s.name, args[0]))
+				}
+			})
+		})
+	}
+	for _, s := range order {
+		for _, id := range sortedKeys(seen[s.name]) {
+			if ints[s.name][id] != nil {
+				// xs = [1, 2] 之后 xs.append(0.5)：元素为 double（每一轮重新判断，追加的值的类型可能还没有推断出来）
+				elem := ""
+				if t, _, _ := g.unifyTypes(append([]string{"int"}, seen[s.name][id]...)); t == "double" && allNumeric(seen[s.name][id]) {
+					elem = "double"
+				}
+				for _, node := range ints[s.name][id] {
+					if delete(node, "_elem"); elem != "" {
+						node["_elem"] = elem
+					}
+				}
+				if g.listVars[s.name][id] != "" && elem != "" {
+					g.listVars[s.name][id] = g.listType(elem)
+				}
+			}
+			if empties[s.name][id] == nil {
+				continue
+			}
+			elem := g.unifyElems(seen[s.name][id])
+			if elem == "" {
+				continue
+			}
+			for _, node := range empties[s.name][id] {
+				node["_elem"] = elem
+			}
+			if g.listVars[s.name][id] != "" {
+				g.listVars[s.name][id] = g.listType(elem)
+			}
+		}
+		if !s.fn {
+			continue
+		}
+		var emptyReturns []map[string]interface{}
+		var elems []string
+		walkInferStmts(s.body, func(m map[string]interface{}) {
+			value, _ := m["value"].(map[string]interface{})
+			if m["_type"] != "Return" || value == nil {
+				return
+			}
+			if isEmptyList(value) {
+				emptyReturns = append(emptyReturns, value)
+			} else if elem, ok := g.listElemType(g.typeIn(s.name, value)); ok {
+				elems = append(elems, elem)
+			}
+		})
+		if elem := g.unifyElems(elems); elem != "" {
+			for _, node := range emptyReturns {
+				node["_elem"] = elem
+			}
+		}
+	}
+}
+
+// intList: 节点是元素都是 int 的列表字面量
+func (g *generator) intList(scope string, value map[string]interface{}) bool {
+	elts, _ := value["elts"].([]interface{})
+	for _, e := range elts {
+		if g.typeIn(scope, e) != "int" {
+			return false
+		}
+	}
+	return value["_type"] == "List" && len(elts) > 0
+}
+
+func allNumeric(types []string) bool {
+	for _, t := range types {
+		if !isNumericType(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// isEmptyList: 节点是 []
+func isEmptyList(value map[string]interface{}) bool {
+	elts, _ := value["elts"].([]interface{})
+	return value["_type"] == "List" && len(elts) == 0
+}
+
+// unifyElems: 放进同一个列表的值的类型合并为元素类型，推断不出时为空串
+func (g *generator) unifyElems(types []string) string {
+	classes := map[string]bool{}
+	for _, t := range types {
+		classes[t] = true
+	}
+	if common := g.commonAncestor(classes); common != "" {
+		return common
+	}
+	elem, _, _ := g.unifyTypes(types)
+	return elem
+}
+
+// elemTypeIn: 放进列表的值的类型；对象变量不登记在符号表中（见 inferEnv），按 objectVars 与推断的变量类型
+func (g *generator) elemTypeIn(scope string, v interface{}) string {
+	if vm, _ := v.(map[string]interface{}); vm["_type"] == "Name" {
+		id, _ := vm["id"].(string)
+		if cls, ok := g.objectVars[scope][id]; ok {
+			return cls
+		}
+		if t := g.inferVars[scope][id]; g.isClassType(t) {
+			return strings.TrimSuffix(t, "*")
+		}
+	}
+	t := g.typeIn(scope, v)
+	if g.isClassType(t) {
+		return strings.TrimSuffix(t, "*") // listType 加上 *
+	}
+	return t
+}
+
+// settledType: scope 中 expr 的类型；用到还没有推断出返回类型的函数（递归调用的第一轮），或者用到这样赋值的
+// 变量（pending）时 ok 为假：这时的类型是 getType 默认的 char*，只能暂时给变量，不能当作 return 的类型
+func (g *generator) settledType(scope string, expr interface{}, pending map[string]bool) (t string, ok bool) {
+	g.inferPending = false
+	t = g.typeIn(scope, expr)
+	ok = !g.inferPending
+	g.inferPending = false
+	walkNodes(expr, func(n map[string]interface{}) {
+		if id, _ := n["id"].(string); n["_type"] == "Name" && pending[id] {
+			ok = false
+		}
+	})
+	return t, ok
+}
+
+// markPending: 赋值之后变量 target 的值是否还没有定下来
+func markPending(pending map[string]bool, target interface{}, settled bool) {
+	if tm, _ := target.(map[string]interface{}); tm["_type"] == "Name" {
+		pending[fmt.Sprint(tm["id"])] = !settled
+	}
+}
+
+// inferAssign: 变量的类型取首次赋值的类型，int 之后赋了 float 时为 double；之后赋了不兼容的类型时记为冲突（代码生成沿用首次的声明）
+func (g *generator) inferAssign(s *inferScope, vars map[string]string, first map[string]interface{}, target interface{}, t string, node map[string]interface{}, conflicts *[]inferConflict) {
+	tm, _ := target.(map[string]interface{})
+	if tm["_type"] != "Name" || t == "" {
+		return
+	}
+	id, _ := tm["id"].(string)
+	if s.name != "" && !s.locals[id] {
+		return
+	}
+	old, seen := first[id]
+	if !seen {
+		first[id] = node
+		if vars[id] != t {
+			vars[id] = t
+			g.inferChanged(s.name, id, t)
+		}
+		return
+	}
+	prev := vars[id]
+	if prev == "int" && t == "double" && g.numIn(s.name, node["value"]) == "double" {
+		// i = 0 之后 i = i + 0.5：和 unifyTypes 一样合并为 double，声明见 declType
+		vars[id] = t
+		g.inferChanged(s.name, id, t)
+		if g.inferWidened[s.name] == nil {
+			g.inferWidened[s.name] = map[string]bool{}
+		}
+		g.inferWidened[s.name][id] = true
+		return
+	}
+	if prev == t || (isNumericType(prev) && isNumericType(t)) || g.isClassType(prev) || g.isClassType(t) {
+		return
+	}
+	line, _ := strconv.Atoi(fmt.Sprint(old.(map[string]interface{})["lineno"]))
+	*conflicts = append(*conflicts, inferConflict{node, fmt.Sprintf("%s was first assigned %s (line %d) and is assigned %s here; it keeps the first type", id, prev, line, t)})
+}
+
+// unifyTypes: 多处取到的类型合并为一个：相同的取该类型，int 与 double 合并为 double，
+// 对象交给代码生成（多个类时取共同祖先）；不兼容时返回 double 及冲突的两个类型
+func (g *generator) unifyTypes(types []string) (t, a, b string) {
+	for _, x := range types {
+		switch {
+		case g.isClassType(x):
+			return "", "", ""
+		case t == "" || t == x:
+			t = x
+		case isNumericType(t) && isNumericType(x):
+			t = "double"
+		default:
+			return "double", t, x
+		}
+	}
+	return t, "", ""
+}
+
+// objectReturn: 各处 return 的都是同一个类的对象时为类名，否则为空串
+func (g *generator) objectReturn(returns []string) string {
+	cls := ""
+	for _, r := range returns {
+		c := strings.TrimSuffix(r, "*")
+		if !g.isClassType(r) || (cls != "" && c != cls) {
+			return ""
+		}
+		cls = c
+	}
+	return cls
+}
+
+func isNumericType(t string) bool {
+	return t == "int" || t == "double"
+}
+
+// isClassType: 源码中定义的类（按值或指针）
+func (g *generator) isClassType(t string) bool {
+	return g.annotClasses[strings.TrimSuffix(t, "*")]
+}
+
+// callSite: 第一个第 i 个实参类型为 t 的调用，报告冲突的位置
+func (g *generator) callSite(order []*inferScope, fname string, i int, t string) interface{} {
+	var found interface{}
+	for _, s := range order {
+		walkInferStmts(s.body, func(m map[string]interface{}) {
+			walkCalls(m, func(call map[string]interface{}) {
+				fn, _ := call["func"].(map[string]interface{})
+				args, _ := call["args"].([]interface{})
+				if found == nil && fn["_type"] == "Name" && fn["id"] == fname && i < len(args) && g.typeIn(s.name, args[i]) == t {
+					found = call
+				}
+			})
+		})
+	}
+	return found
+}
+
+// typeIn: 按作用域 scope 中推断出的变量类型求表达式的类型
+func (g *generator) typeIn(scope string, expr interface{}) string {
+	if g.inferScopes[scope] == nil || g.inferVars == nil {
+		return g.getType(expr)
+	}
+	saved := g.symtab
+	defer func() { g.symtab = saved }()
+	g.symtab = g.inferTab(scope)
+	return g.getType(expr)
+}
+
+// inferTab: typeIn 用的符号表，按作用域留着重用（每个表达式都重新登记全部变量，变量多的模块是平方级的）。
+// 模块的表只有一个，是各函数的表的外层；模块变量的类型变了就地修改，函数的变量或参数的类型变了重新建立
+func (g *generator) inferTab(scope string) *symbolTable {
+	if g.inferTabs == nil {
+		g.inferTabs = map[string]*symbolTable{}
+	}
+	if tab := g.inferTabs[scope]; tab != nil {
+		return tab
+	}
+	if scope == "" {
+		tab := newSymbolTable(scopeModule, "", nil)
+		g.inferModuleEnv(tab, g.inferVars[""])
+		g.inferTabs[""] = tab
+		return tab
+	}
+	s := g.inferScopes[scope]
+	tab := newSymbolTable(scopeFunction, scope, g.inferTab(""))
+	tab.locals = s.locals
+	params := map[string]string{}
+	for i, p := range s.params {
+		if types := g.inferParams[scope]; i < len(types) {
+			params[p] = types[i]
+		}
+	}
+	g.inferEnv(tab, params, "param")
+	for p, t := range params {
+		if g.isClassType(t) {
+			// 对象参数总是指针，登记之后 b.area() 能按类的方法表查到返回类型
+			tab.vars[p] = &symbol{typ: strings.TrimSuffix(t, "*") + "*", storage: "param"}
+		}
+	}
+	g.inferEnv(tab, g.inferVars[scope], "local")
+	g.inferTabs[scope] = tab
+	return tab
+}
+
+// numIn: scope 中数值表达式的类型；运算中有推断不出类型的操作数（如对象的字段）时为空串，getType 会把它算作 double。
+// 程序中的函数与方法（不是 math.sqrt 这样的模块函数）的调用也为空串：它们的返回类型本身在推断中，k = dec(k) 不能因为上一轮 dec 返回 double
+// 就把 k 改为 double（dec 的参数随之成为 double，推断在两种类型之间来回）
+func (g *generator) numIn(scope string, expr interface{}) string {
+	m, _ := expr.(map[string]interface{})
+	switch m["_type"] {
+	case "Call":
+		fn, _ := m["func"].(map[string]interface{})
+		if id, _ := fn["id"].(string); (fn["_type"] == "Attribute" && g.importedName(fn) == "") || g.inferScopes[id] != nil {
+			return ""
+		}
+	case "BinOp":
+		if g.numIn(scope, m["left"]) == "" || g.numIn(scope, m["right"]) == "" {
+			return ""
+		}
+	case "UnaryOp":
+		if g.numIn(scope, m["operand"]) == "" {
+			return ""
+		}
+	}
+	if t := g.typeIn(scope, expr); isNumericType(t) {
+		return t
+	}
+	return ""
+}
+
+// declType: 代码生成中首次赋值 name = v（v 的类型为 t）时变量的声明类型：之后还会赋 float 的 int 变量声明为 double
+func (g *generator) declType(name, t string) string {
+	scope := g.funcScope()
+	key := scope.name
+	if scope.kind == scopeModule {
+		key = ""
+	}
+	if t == "int" && g.inferWidened[key][name] {
+		return "double"
+	}
+	return t
+}
+
+// inferChanged: 作用域 scope 中变量 id 推断出的类型变成了 t
+func (g *generator) inferChanged(scope, id, t string) {
+	if scope != "" {
+		delete(g.inferTabs, scope)
+		return
+	}
+	if tab := g.inferTabs[""]; tab != nil {
+		delete(tab.vars, id)
+		g.inferModuleEnv(tab, map[string]string{id: t})
+	}
+}
+
+// inferModuleEnv: 登记模块变量的类型。与 inferEnv 不同，对象也登记：函数中用到的模块级对象是文件作用域变量
+// （见 declareGlobals），c.n 与 c.bump() 按类的字段与方法求类型
+func (g *generator) inferModuleEnv(tab *symbolTable, vars map[string]string) {
+	g.inferEnv(tab, vars, "local")
+	for _, name := range sortedKeys(vars) {
+		if t := vars[name]; g.isClassType(t) {
+			tab.vars[name] = &symbol{typ: t, storage: "local"}
+		}
+	}
+}
+
+// inferEnv: 把推断出的变量类型登记到符号表 tab。对象（及对象的列表）不登记，仍按代码生成时的规则
+// （objectVars、逃逸分析）处理：分析阶段求它们的类型会提前生成列表等辅助代码
+func (g *generator) inferEnv(tab *symbolTable, vars map[string]string, storage string) {
+	for _, name := range sortedKeys(vars) {
+		t := vars[name]
+		elem, isList := g.listElemType(t)
+		if t == "" || g.isClassType(t) || (isList && g.isClassType(elem)) {
+			continue
+		}
+		tab.vars[name] = &symbol{typ: t, storage: storage}
+	}
+}
+
+// walkInferStmts: 按源码顺序访问语句（进入复合语句的各个块，不进入嵌套的函数与类）
+func walkInferStmts(stmts []interface{}, visit func(m map[string]interface{})) {
+	for _, stmt := range stmts {
+		m, ok := stmt.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		visit(m)
+		switch m["_type"] {
+		case "FunctionDef", "AsyncFunctionDef", "ClassDef":
+			continue
+		}
+		for _, key := range []string{"body", "handlers", "orelse", "finalbody", "cases"} {
+			list, _ := m[key].([]interface{})
+			walkInferStmts(list, visit)
+		}
+	}
+}
+
+// walkCalls: 语句中（不含嵌套语句块）的所有调用
+func walkCalls(node interface{}, visit func(call map[string]interface{})) {
+	walkNodes(node, func(n map[string]interface{}) {
+		if n["_type"] == "Call" {
+			visit(n)
+		}
+	})
+}
+
+// walkNodes: 语句中（不含嵌套语句块）的所有节点
+func walkNodes(node interface{}, visit func(n map[string]interface{})) {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			walkNodes(e, visit)
+		}
+	case map[string]interface{}:
+		visit(n)
+		for _, k := range sortedKeys(n) {
+			switch k {
+			case "body", "handlers", "orelse", "finalbody", "cases":
+				if _, isList := n[k].([]interface{}); isList {
+					continue
+				}
+			}
+			walkNodes(n[k], visit)
+		}
+	}
+}
+
+func copyTypes(m map[string]map[string]string) map[string]map[string]string {
+	out := make(map[string]map[string]string, len(m))
+	for k, v := range m {
+		out[k] = copyReturns(v)
+	}
+	return out
+}
+
+func copyParams(m map[string][]string) map[string][]string {
+	out := make(map[string][]string, len(m))
+	for k, v := range m {
+		out[k] = append([]string{}, v...) // 与比较的 make([]string, 0) 相等（nil 切片不相等）
+	}
+	return out
+}
+
+func copyReturns(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,113 @@
+package py2c
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 函数的中间表示（IR）：只描述顶层函数的外形，即 C 名字、参数与返回类型、是否按 result 指针返回，
+// C 后端（emit.go）据此输出定义与原型，头文件、前向声明、-memoize 与 -only 也从这里查询签名，不必在生成的 C 代码里查找。
+// 函数体不是带类型的 IR：语句仍由 toC 生成为 C 文本，原样放在 irCode 中，只有写 result 与 return 是单独的节点。
+// 类、方法与模块顶层的代码不经过 IR，直接生成 C 文本。语句与表达式没有带类型的 IR，也没有产生它的语义分析阶段
+
+// irFunc: 一个顶层函数（也用于 ctypes / extern 的声明与生成器的辅助函数）
+type irFunc struct {
+	name   string    // C 函数名
+	ret    string    // C 返回类型：void，-exceptions=status 下可能抛出异常的函数为 int（错误码）
+	params []irParam // 参数，不含 result
+	result string    // result 指针指向的类型（有返回值时），空为没有返回值
+	head   string    // 定义前的注释与 #line
+	indent int       // 定义所在的缩进层级
+	body   []irStmt
+}
+
+// irParam: 带类型的参数
+type irParam struct {
+	name, typ string
+}
+
+// irStmt: 函数体中的一条语句：irCode、irSetResult 或 irReturn
+type irStmt interface {
+	emit(indent int) string // 输出为 C 代码，indent 为所在的缩进层级
+}
+
+// irExpr: 已生成的 C 表达式（文本）及其类型
+type irExpr struct {
+	code, typ string
+}
+
+// irCode: 已经生成好的 C 代码（带缩进与换行），函数体中的大部分语句
+type irCode string
+
+func (c irCode) emit(indent int) string {
+	return string(c)
+}
+
+// irSetResult: 把返回值写入 result 指针：*result = value;
+type irSetResult struct {
+	value irExpr
+}
+
+func (s *irSetResult) emit(indent int) string {
+	return fmt.Sprintf("%s*result = %s;\n", strings.Repeat(" ", indent*4), s.value.code)
+}
+
+// irReturn: return value;（value 为空时是 return;）
+type irReturn struct {
+	value irExpr
+}
+
+func (s *irReturn) emit(indent int) string {
+	if s.value.code == "" {
+		return strings.Repeat(" ", indent*4) + "return;\n"
+	}
+	return fmt.Sprintf("%sreturn %s;\n", strings.Repeat(" ", indent*4), s.value.code)
+}
+
+// hasResult: 函数按 result 指针约定返回值
+func (f *irFunc) hasResult() bool {
+	return f.result != ""
+}
+
+// signature: C 函数头，如 "void f(double x, double* result)"
+func (f *irFunc) signature() string {
+	params := make([]string, 0, len(f.params)+1)
+	for _, p := range f.params {
+		params = append(params, p.typ+" "+p.name)
+	}
+	if f.hasResult() {
+		params = append(params, f.result+"* result")
+	}
+	return fmt.Sprintf("%s %s(%s)", f.ret, f.name, join(params, ", "))
+}
+
+// emitBody: 函数体的 C 代码
+func (f *irFunc) emitBody() string {
+	code := ""
+	for _, s := range f.body {
+		code += s.emit(f.indent + 1)
+	}
+	return code
+}
+
+// endsWithReturn: 函数体的最后一条语句是 return（包括已生成的 C 代码中的 return）
+func (f *irFunc) endsWithReturn() bool {
+	if len(f.body) == 0 {
+		return false
+	}
+	if _, ok := f.body[len(f.body)-1].(*irReturn); ok {
+		return true
+	}
+	lines := strings.Split(strings.TrimRight(f.emitBody(), "\n"), "\n")
+	return strings.HasPrefix(strings.TrimSpace(lines[len(lines)-1]), "return ")
+}
+
+// lookupFunc: 已生成的顶层函数的 IR，还没有生成完时为 nil
+func (g *generator) lookupFunc(name string) *irFunc {
+	for _, f := range g.irFuncs {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
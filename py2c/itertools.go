@@ -0,0 +1,416 @@
+package py2c
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// itertools 的 count、repeat、chain、islice 只在 for 循环的迭代对象中翻译，展开成普通的循环：
+//
+//	for i in count(1, 2):      ->  for (int i = 1; ; i += 2) {...}
+//	for x in repeat(v, 3):     ->  for (int _r1 = 0; _r1 < 3; _r1++) { x = v; ... }
+//	for x in chain(a, b):      ->  for x in a: ... 之后 for x in b: ...（break 用标志跳过后面的循环）
+//	for x in islice(it, 5):    ->  for x in it: ...，计数到 5 时 break
+//
+// 操作数可以是 range()、列表、生成器、文件与嵌套的 itertools 调用，与 for 循环本来支持的相同
+
+// itertoolsLoops: 能展开成循环的 itertools 函数
+var itertoolsLoops = map[string]bool{
+	"itertools.count": true, "itertools.repeat": true, "itertools.chain": true, "itertools.islice": true,
+}
+
+// loopImports: 在类型推断之前要知道本地名的模块（itertools.go、functional.go、records.go、heapq.go、bisect.go，
+// 以及 unbound.go 的 sys.exit / os._exit）
+var loopImports = map[string]bool{"itertools": true, "functools": true, "typing": true, "collections": true, "enum": true, "heapq": true, "bisect": true, "re": true, "argparse": true, "sys": true, "os": true}
+
+// collectImports: 顶层 import 绑定的 itertools / functools 等模块的名字：本地名 -> 全名（import itertools as it 时 it -> itertools，
+// from itertools import count 时 count -> itertools.count）。类型推断在翻译 import 语句之前，不能用 qualifiedCallName
+func (g *generator) collectImports(root ASTNode) {
+	g.importNames = map[string]string{}
+	body, _ := root["body"].([]interface{})
+	for _, s := range body {
+		m, _ := s.(map[string]interface{})
+		aliases, _ := m["names"].([]interface{})
+		for _, a := range aliases {
+			am, _ := a.(map[string]interface{})
+			name, _ := am["name"].(string)
+			local, _ := am["asname"].(string)
+			if local == "" {
+				local = name
+			}
+			switch module, _ := m["module"].(string); {
+			case m["_type"] == "Import" && loopImports[name]:
+				g.importNames[local] = name
+			case m["_type"] == "ImportFrom" && loopImports[module]:
+				g.importNames[local] = module + "." + name
+			}
+		}
+	}
+}
+
+// itertoolsCall: iter 是 count(...)、itertools.chain(...) 等调用时返回 itertools.NAME
+func (g *generator) itertoolsCall(iter map[string]interface{}) string {
+	fn, _ := iter["func"].(map[string]interface{})
+	q := ""
+	switch fn["_type"] {
+	case "Name":
+		q = g.importNames[fmt.Sprint(fn["id"])]
+	case "Attribute":
+		if recv, _ := fn["value"].(map[string]interface{}); recv["_type"] == "Name" && g.importNames[fmt.Sprint(recv["id"])] == "itertools" {
+			q = fmt.Sprintf("itertools.%v", fn["attr"])
+		}
+	}
+	if iter["_type"] == "Call" && itertoolsLoops[q] {
+		return q
+	}
+	return ""
+}
+
+// iterElemType: for 循环变量的类型：range() 是 int，列表是元素类型，生成器是 yield 的类型，itertools 按操作数；
+// 不知道时为空。typeOf 是推断时的 typeIn 或代码生成时的 getType
+func (g *generator) iterElemType(iter map[string]interface{}, typeOf func(interface{}) string) string {
+	fn, _ := iter["func"].(map[string]interface{})
+	args, _ := iter["args"].([]interface{})
+	if iter["_type"] == "Call" && fn["_type"] == "Name" && fn["id"] == "range" {
+		return "int"
+	}
+	if elem, ok := g.listElemType(typeOf(iter)); ok {
+		return elem
+	}
+	if gen := g.genFuncs[fmt.Sprint(fn["id"])]; iter["_type"] == "Call" && fn["_type"] == "Name" && gen != nil && gen.reason == "" {
+		t, _ := g.yieldType(gen) // for x in gen(...)
+		return t
+	}
+	if kind := g.functionalCall(iter); kind == "map" || kind == "filter" {
+		return g.functionalElemType(iter, typeOf)
+	}
+	if e := g.enumOf(iter); e != nil {
+		return e.name
+	}
+	if t := g.collectionIterType(iter, typeOf); t != "" {
+		return t
+	}
+	switch g.itertoolsCall(iter) {
+	case "itertools.count":
+		return countType(args, typeOf)
+	case "itertools.repeat":
+		if len(args) > 0 {
+			return typeOf(args[0])
+		}
+	case "itertools.chain":
+		var elems []string
+		for _, a := range args {
+			am, _ := a.(map[string]interface{})
+			elems = append(elems, g.iterElemType(am, typeOf))
+		}
+		if t, conflict, _ := g.unifyTypes(elems); conflict == "" {
+			return t
+		}
+	case "itertools.islice":
+		if len(args) > 0 {
+			am, _ := args[0].(map[string]interface{})
+			return g.iterElemType(am, typeOf)
+		}
+	}
+	return ""
+}
+
+// countType: count(start, step) 的值的类型：都是整数时为 int（与 range 相同），否则为 double
+func countType(args []interface{}, typeOf func(interface{}) string) string {
+	for _, a := range args {
+		if !isIntConst(a) && typeOf(a) != "int" {
+			return "double"
+		}
+	}
+	return "int"
+}
+
+// isIntConst: 不带小数点的数字常量（Python 的 int）
+func isIntConst(node interface{}) bool {
+	m, _ := node.(map[string]interface{})
+	if num, ok := m["value"].(json.Number); ok && m["_type"] == "Constant" {
+		return !strings.ContainsAny(num.String(), ".eE")
+	}
+	if op, _ := m["op"].(map[string]interface{}); m["_type"] == "UnaryOp" && op["_type"] == "USub" {
+		return isIntConst(m["operand"])
+	}
+	return false
+}
+
+// handleForItertools: for x in itertools.NAME(...)：展开成普通的循环，参数不对时报告为不支持
+func (g *generator) handleForItertools(node ASTNode, qname string, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	iter := node["iter"].(map[string]interface{})
+	args, _ := iter["args"].([]interface{})
+	name := strings.TrimPrefix(qname, "itertools.")
+	if kw, _ := iter["keywords"].([]interface{}); len(kw) > 0 && name != "count" {
+		return pad + g.unsupportedExpr(node, fmt.Sprintf("for loop over %s() with keyword arguments", name)) + "\n"
+	}
+	if tm, _ := node["target"].(map[string]interface{}); tm["_type"] != "Name" {
+		return pad + g.unsupportedExpr(node, fmt.Sprintf("for loop over %s() with a target that is not a variable", name)) + "\n"
+	}
+	switch {
+	case name == "count" && len(args) <= 2:
+		return g.forCount(node, indent)
+	case name == "repeat" && (len(args) == 1 || len(args) == 2):
+		return g.forRepeat(node, indent)
+	case name == "chain" && len(args) > 0:
+		return g.forChain(node, indent)
+	case name == "islice" && len(args) >= 2 && len(args) <= 4:
+		return g.forIslice(node, indent)
+	}
+	return pad + g.unsupportedExpr(node, fmt.Sprintf("for loop over %s() with %d arguments", name, len(args))) + "\n"
+}
+
+// onceValue: 只求值一次的参数：常量与循环中不赋值的变量直接使用，其他的先存入临时变量（pre 是赋值语句）
+func (g *generator) onceValue(arg interface{}, typ string, body []interface{}, pad string) (value map[string]interface{}, pre string) {
+	am := arg.(map[string]interface{})
+	if am["_type"] == "Constant" || am["_type"] == "Name" && !assignedNames(body)[fmt.Sprint(am["id"])] {
+		return am, ""
+	}
+	tmp, decl := g.loopTemp("_it", typ)
+	pre = fmt.Sprintf("%s%s = %s;\n", pad, decl, g.toC(am, 0))
+	g.declareTemp(tmp, typ)
+	return cName(tmp), pre
+}
+
+// forCount: for x in count(start=0, step=1)：没有结束条件的 for 循环
+func (g *generator) forCount(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	iter := node["iter"].(map[string]interface{})
+	args, _ := iter["args"].([]interface{})
+	var start, step interface{}
+	if len(args) > 0 {
+		start = args[0]
+	}
+	if len(args) > 1 {
+		step = args[1]
+	}
+	if v := callKeyword(iter, "start"); v != nil {
+		start = v
+	}
+	if v := callKeyword(iter, "step"); v != nil {
+		step = v
+	}
+	var present []interface{}
+	for _, a := range []interface{}{start, step} {
+		if a != nil {
+			present = append(present, a)
+		}
+	}
+	typ := countType(present, g.getType)
+	body := node["body"].([]interface{})
+	target := g.toC(node["target"].(map[string]interface{}), 0)
+	code, first, incr := "", "0", target+"++"
+	if start != nil {
+		first = g.toC(start.(map[string]interface{}), 0)
+	}
+	if step != nil && !(isIntConst(step) && g.toC(step.(map[string]interface{}), 0) == "1") {
+		v, pre := g.onceValue(step, typ, body, pad)
+		code += pre
+		incr = fmt.Sprintf("%s += %s", target, g.toC(v, 0))
+	}
+	g.pushScope(scopeBlock, "for")
+	defer g.popScope()
+	decl := target
+	if !g.isDeclared(target) {
+		g.declareVar(target, typ)
+		decl = typ + " " + target
+	}
+	restore := g.enterLoop()
+	loop := g.stmtsToC(body, indent+1)
+	restore()
+	return fmt.Sprintf("%s%sfor (%s = %s; ; %s) {\n%s%s}\n", code, pad, decl, first, incr, loop, pad)
+}
+
+// forRepeat: for x in repeat(v, n)：循环 n 次（没有 n 时不停止），每一轮 x = v；v 只求值一次
+func (g *generator) forRepeat(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	iter := node["iter"].(map[string]interface{})
+	args, _ := iter["args"].([]interface{})
+	body := node["body"].([]interface{})
+	value, pre := g.onceValue(args[0], g.getType(args[0]), body, pad)
+	assign := map[string]interface{}{"_type": "Assign", "targets": []interface{}{node["target"]}, "value": value}
+	loopBody := append([]interface{}{assign}, body...)
+	if len(args) == 1 {
+		return pre + g.nodeToC(ASTNode{"_type": "While", "test": map[string]interface{}{"_type": "Constant", "value": true}, "body": loopBody}, indent)
+	}
+	counter, _ := g.loopTemp("_r", "int")
+	if g.curGen != nil {
+		g.declareTemp(counter, "int") // 生成器中是结构体的字段，range 的循环不再声明
+	}
+	rng := map[string]interface{}{"_type": "Call", "func": cName("range"), "args": []interface{}{args[1]}, "keywords": []interface{}{}}
+	return pre + g.nodeToC(ASTNode{"_type": "For", "target": cName(counter), "iter": rng, "body": loopBody, "orelse": []interface{}{}}, indent)
+}
+
+// forChain: for x in chain(a, b, ...)：依次是每个操作数上的循环。循环体中有 break 时设置标志，后面的循环不再执行
+func (g *generator) forChain(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	iter := node["iter"].(map[string]interface{})
+	args, _ := iter["args"].([]interface{})
+	code := ""
+	// x 在所有循环中是同一个变量，类型取各操作数元素类型的统一类型
+	target := g.toC(node["target"].(map[string]interface{}), 0)
+	if tm, _ := node["target"].(map[string]interface{}); tm["_type"] == "Name" && !g.isDeclared(target) {
+		if t := g.iterElemType(iter, g.getType); t != "" {
+			g.declareVar(target, t)
+			code += fmt.Sprintf("%s%s %s;\n", pad, t, target)
+		}
+	}
+	body := node["body"].([]interface{})
+	flag := ""
+	if len(args) > 1 && loopBreaks(body) {
+		name, decl := g.loopTemp("_brk", "int")
+		g.declareTemp(name, "int")
+		code += fmt.Sprintf("%s%s = 0;\n", pad, decl)
+		flag = name
+		body = markBreaks(deepCopyNode(body).([]interface{}), flag)
+	}
+	for i, a := range args {
+		loop := ASTNode{"_type": "For", "target": node["target"], "iter": a, "body": body, "orelse": []interface{}{}}
+		if i > 0 && flag != "" {
+			not := map[string]interface{}{"_type": "UnaryOp", "op": map[string]interface{}{"_type": "Not"}, "operand": cName(flag)}
+			code += g.nodeToC(ASTNode{"_type": "If", "test": not, "body": []interface{}{map[string]interface{}(loop)}, "orelse": []interface{}{}}, indent)
+			continue
+		}
+		code += g.nodeToC(loop, indent)
+	}
+	return code
+}
+
+// forIslice: for x in islice(it, [start,] stop[, step])：在 it 上的循环中计数，跳过 start 之前与不在 step 上的元素，
+// 取到 stop 个时 break（不再从 it 取下一个元素）。stop 为 None 时不限制；参数应当是非负整数
+func (g *generator) forIslice(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	iter := node["iter"].(map[string]interface{})
+	args, _ := iter["args"].([]interface{})
+	body := node["body"].([]interface{})
+	var start, stop, step interface{}
+	if len(args) == 2 {
+		stop = args[1]
+	} else {
+		start, stop = args[1], args[2]
+		if len(args) == 4 {
+			step = args[3]
+		}
+	}
+	isNone := func(a interface{}) bool {
+		m, _ := a.(map[string]interface{})
+		return a == nil || m["_type"] == "Constant" && m["value"] == nil
+	}
+	code := ""
+	once := func(a interface{}) map[string]interface{} {
+		v, pre := g.onceValue(a, "int", body, pad)
+		code += pre
+		return v
+	}
+	num := func(n string) map[string]interface{} {
+		return map[string]interface{}{"_type": "Constant", "value": json.Number(n)}
+	}
+	op := func(name string) map[string]interface{} { return map[string]interface{}{"_type": name} }
+	compare := func(l interface{}, o string, r interface{}) map[string]interface{} {
+		return map[string]interface{}{"_type": "Compare", "left": l, "ops": []interface{}{op(o)}, "comparators": []interface{}{r}}
+	}
+	ifThen := func(test map[string]interface{}, stmts ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"_type": "If", "test": test, "body": stmts, "orelse": []interface{}{}}
+	}
+	name, decl := g.loopTemp("_n", "int")
+	g.declareTemp(name, "int")
+	count := cName(name)
+	code += fmt.Sprintf("%s%s = 0;\n", pad, decl)
+	incr := map[string]interface{}{"_type": "Assign", "targets": []interface{}{count},
+		"value": map[string]interface{}{"_type": "BinOp", "left": count, "op": op("Add"), "right": num("1")}}
+	var prelude, epilogue []interface{}
+	if !isNone(stop) {
+		limit := once(stop)
+		done := ifThen(compare(count, "GtE", limit), op("Break"))
+		// 跳过的元素与 continue 不经过循环体末尾的检查，在取下一个元素之后检查
+		if !isNone(start) || !isNone(step) || loopContinues(body) || !isIntConst(stop) || g.toC(stop.(map[string]interface{}), 0) == "0" {
+			prelude = append(prelude, done)
+		}
+		epilogue = append(epilogue, done)
+	}
+	var skip []map[string]interface{}
+	if !isNone(start) {
+		first := once(start)
+		skip = append(skip, compare(count, "Lt", first))
+		if !isNone(step) {
+			diff := map[string]interface{}{"_type": "BinOp", "left": count, "op": op("Sub"), "right": first}
+			mod := map[string]interface{}{"_type": "BinOp", "left": diff, "op": op("Mod"), "right": once(step)}
+			skip = append(skip, compare(mod, "NotEq", num("0")))
+		}
+	}
+	if len(skip) > 0 {
+		test := skip[0]
+		if len(skip) > 1 {
+			test = map[string]interface{}{"_type": "BoolOp", "op": op("Or"), "values": []interface{}{skip[0], skip[1]}}
+		}
+		prelude = append(prelude, ifThen(test, incr, op("Continue")))
+	}
+	prelude = append(prelude, incr)
+	loopBody := append(append(prelude, body...), epilogue...)
+	return code + g.nodeToC(ASTNode{"_type": "For", "target": node["target"], "iter": args[0], "body": loopBody, "orelse": []interface{}{}}, indent)
+}
+
+// cName: 引用变量（或生成器中 self->x 形式的字段）的 Name 节点
+func cName(id string) map[string]interface{} {
+	return map[string]interface{}{"_type": "Name", "id": id, "ctx": map[string]interface{}{"_type": "Load"}}
+}
+
+// loopBreaks / loopContinues: 循环体中有属于这个循环的 break / continue（不进入嵌套的循环与函数）
+func loopBreaks(node interface{}) bool    { return findLoopControl(node, "Break") }
+func loopContinues(node interface{}) bool { return findLoopControl(node, "Continue") }
+
+func findLoopControl(node interface{}, typ string) bool {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			if findLoopControl(e, typ) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		switch n["_type"] {
+		case typ:
+			return true
+		case "For", "AsyncFor", "While":
+			return findLoopControl(n["orelse"], typ)
+		case "FunctionDef", "AsyncFunctionDef", "ClassDef", "Lambda":
+			return false
+		}
+		for _, v := range n {
+			if findLoopControl(v, typ) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// markBreaks: 属于这个循环的 break 之前先设置 flag = 1（修改并返回 stmts）
+func markBreaks(stmts []interface{}, flag string) []interface{} {
+	out := make([]interface{}, 0, len(stmts))
+	for _, s := range stmts {
+		m, _ := s.(map[string]interface{})
+		switch m["_type"] {
+		case "Break":
+			set := map[string]interface{}{"_type": "Assign", "targets": []interface{}{cName(flag)}, "value": map[string]interface{}{"_type": "Constant", "value": json.Number("1")}}
+			out = append(out, set, m)
+			continue
+		case "For", "AsyncFor", "While":
+			if orelse, ok := m["orelse"].([]interface{}); ok {
+				m["orelse"] = markBreaks(orelse, flag)
+			}
+		case "FunctionDef", "AsyncFunctionDef", "ClassDef":
+		default:
+			for k, v := range m {
+				if list, ok := v.([]interface{}); ok {
+					m[k] = markBreaks(list, flag)
+				}
+			}
+		}
+		out = append(out, s)
+	}
+	return out
+}
@@ -0,0 +1,216 @@
+package py2c
+
+import (
+	"fmt"
+	"strings"
+)
+
+// @functools.lru_cache / @functools.cache：纯的数值函数在入口按实参查生成的表，return 时把结果放进表中：
+//
+//	@lru_cache(maxsize=None)           void fib(int n, int* result) {
+//	def fib(n):                            if (py_cache_fib_get(n, result)) {
+//	    if n < 2:                              return;
+//	        return n                       }
+//	    return fib(n - 1) + fib(n - 2)     ...
+//	                                       *result = py_cache_fib_put(n, (_t0 + _t1));
+//
+// 表以实参为键做开放寻址（线性探测），装到一半时容量翻倍，所以查找与插入都是常数时间。
+// maxsize 不限制表的大小：结果都保留（maxsize=0 时 Python 不缓存，函数照常翻译）。
+// 只支持参数与返回值都是 int / double、不给参数赋值的纯函数（analyzePurity），其他情形报告警告并照常翻译
+
+// memoFunc: 带缓存的函数
+type memoFunc struct {
+	name   string    // 函数名，表与辅助函数是 py_cache_NAME…
+	params []irParam // 键
+	result string    // 值的类型
+}
+
+// memoDecorator: fn 的 @lru_cache、@lru_cache(...)、@cache（或 @functools.X）装饰器与显示用的名字；
+// maxsize=0 时 off 为 true
+func (g *generator) memoDecorator(fn map[string]interface{}) (deco map[string]interface{}, name string, off bool) {
+	decos, _ := fn["decorator_list"].([]interface{})
+	for _, d := range decos {
+		dm, _ := d.(map[string]interface{})
+		target := dm
+		if dm["_type"] == "Call" {
+			target, _ = dm["func"].(map[string]interface{})
+		}
+		q := ""
+		switch target["_type"] {
+		case "Name":
+			q = g.importNames[fmt.Sprint(target["id"])]
+		case "Attribute":
+			if recv, _ := target["value"].(map[string]interface{}); recv["_type"] == "Name" && g.importNames[fmt.Sprint(recv["id"])] == "functools" {
+				q = fmt.Sprintf("functools.%v", target["attr"])
+			}
+		}
+		if q != "functools.lru_cache" && q != "functools.cache" {
+			continue
+		}
+		if dm["_type"] == "Call" {
+			args, _ := dm["args"].([]interface{})
+			var maxsize interface{} = callKeyword(ASTNode(dm), "maxsize")
+			if len(args) > 0 {
+				maxsize = args[0]
+			}
+			if m, _ := maxsize.(map[string]interface{}); m["_type"] == "Constant" && fmt.Sprint(m["value"]) == "0" {
+				off = true
+			}
+		}
+		return dm, "@" + strings.TrimPrefix(q, "functools."), off
+	}
+	return nil, "", false
+}
+
+// memoize: handleFunctionDef 中登记带缓存的函数 f（参数与结果类型已经确定）并生成它的表；
+// 不带装饰器或者不能缓存时为 nil
+func (g *generator) memoize(node ASTNode, f *irFunc) *memoFunc {
+	deco, decoName, off := g.memoDecorator(node)
+	if deco == nil || off {
+		return nil
+	}
+	reason := ""
+	args, _ := node["args"].(map[string]interface{})
+	assigned := assignedNames(node["body"].([]interface{}))
+	switch {
+	case g.currentClass != "":
+		reason = "only top-level functions are cached"
+	case args["vararg"] != nil || args["kwarg"] != nil:
+		reason = "it takes *args or **kwargs"
+	case g.funcPurity[f.name] != "":
+		reason = "it is not pure (" + g.funcPurity[f.name] + ")"
+	case f.result != "int" && f.result != "double":
+		reason = "it does not return an int or a float"
+	}
+	for _, p := range f.params {
+		if reason != "" {
+			break
+		}
+		if p.typ != "int" && p.typ != "double" {
+			reason = fmt.Sprintf("the parameter %s is %s, not an int or a float", p.name, p.typ)
+		} else if assigned[p.name] {
+			reason = fmt.Sprintf("it assigns to the parameter %s", p.name)
+		}
+	}
+	if reason != "" {
+		g.report(logWarn, deco, "%s on %s() is not translated because %s; the function is called without a cache", decoName, f.name, reason)
+		return nil
+	}
+	m := &memoFunc{f.name, f.params, f.result}
+	g.memoRuntime(m)
+	g.memoFuncs[f.name] = m
+	return m
+}
+
+// lookup: 函数入口：表中有这组实参时直接返回
+func (m *memoFunc) lookup(ret string, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	return fmt.Sprintf("%sif (py_cache_%s_get(%s)) {\n%s    %s\n%s}\n", pad, m.name, m.args("", "result"), pad, ret, pad)
+}
+
+// put: 返回值 value 先放进表中
+func (m *memoFunc) put(value string) string {
+	return fmt.Sprintf("py_cache_%s_put(%s)", m.name, m.args("", value))
+}
+
+// args: 键（参数名，prefix 为每个名字之前的表达式）与 extra 组成的实参列表
+func (m *memoFunc) args(prefix string, extra ...string) string {
+	var names []string
+	for _, p := range m.params {
+		names = append(names, prefix+p.name)
+	}
+	return join(append(names, extra...), ", ")
+}
+
+// memoRuntime: 函数 m 的表：条目结构体、槽位、查找与插入（插入时按需扩容）。
+// 参数用 Python 的参数名，表中其他的名字都以 py_ 开头，不会与它们冲突
+func (g *generator) memoRuntime(m *memoFunc) {
+	g.includes["stdlib.h"] = true
+	g.runtimeHelpers["py_cache_"] = `// hash of the arguments of @lru_cache functions: FNV-1a over their bytes
+static unsigned long py_cache_hash(unsigned long h, const void* p, size_t n) {
+    const unsigned char* b = (const unsigned char*)p;
+    size_t i;
+    for (i = 0; i < n; i++) {
+        h = (h ^ b[i]) * 16777619UL;
+    }
+    return h;
+}
+`
+	t := "py_cache_" + m.name
+	fields := []irParam{{"py_used", "int"}}
+	var decls, hash, same, stores []string
+	for _, p := range m.params {
+		fields = append(fields, p)
+		decls = append(decls, p.typ+" "+p.name)
+		if p.typ == "double" {
+			// -0.0 == 0.0 是同一个键：哈希之前统一成 0.0
+			hash = append(hash, fmt.Sprintf("    %s += 0.0; // -0.0 and 0.0 are one key\n", p.name))
+		}
+		hash = append(hash, fmt.Sprintf("    py_h = py_cache_hash(py_h, &%s, sizeof %s);\n", p.name, p.name))
+		same = append(same, fmt.Sprintf("%s[py_i].%s == %s", t, p.name, p.name))
+		stores = append(stores, fmt.Sprintf("    %s[py_i].%s = %s;\n", t, p.name, p.name))
+	}
+	fields = append(fields, irParam{"py_value", m.result})
+	sameKey := join(same, " && ")
+	if sameKey == "" {
+		sameKey = "1" // 没有参数：只有一个条目
+	}
+	params := func(extra ...string) string {
+		if l := append(append([]string{}, decls...), extra...); len(l) > 0 {
+			return join(l, ", ")
+		}
+		return "void"
+	}
+	code := fmt.Sprintf("// the @lru_cache table of %s(): open addressing on the arguments, doubled when half full\n", m.name)
+	code += g.emit.emitStruct(t+"_entry", fields)
+	code += fmt.Sprintf(`static %[1]s_entry* %[1]s;
+static unsigned long %[1]s_cap = 0;
+static unsigned long %[1]s_len = 0;
+// the first slot to probe for these arguments
+static unsigned long %[1]s_slot(%[2]s) {
+    unsigned long py_h = 2166136261UL;
+%[3]s    return py_h & (%[1]s_cap - 1);
+}
+static int %[1]s_get(%[4]s) {
+    unsigned long py_i;
+    if (%[1]s_cap == 0) {
+        return 0;
+    }
+    for (py_i = %[1]s_slot(%[5]s); %[1]s[py_i].py_used; py_i = (py_i + 1) & (%[1]s_cap - 1)) {
+        if (%[6]s) {
+            *py_v = %[1]s[py_i].py_value;
+            return 1;
+        }
+    }
+    return 0;
+}
+static %[7]s %[1]s_put(%[8]s) {
+    unsigned long py_i;
+    if (2 * (%[1]s_len + 1) > %[1]s_cap) {
+        %[1]s_entry* py_old = %[1]s;
+        unsigned long py_cap = %[1]s_cap;
+        %[1]s_cap = py_cap ? py_cap * 2 : 64;
+        %[1]s = (%[1]s_entry*)calloc(%[1]s_cap, sizeof(%[1]s_entry));
+        %[1]s_len = 0;
+        for (py_i = 0; py_i < py_cap; py_i++) {
+            if (py_old[py_i].py_used) {
+                %[1]s_put(%[9]s);
+            }
+        }
+        free(py_old);
+    }
+    for (py_i = %[1]s_slot(%[5]s); %[1]s[py_i].py_used; py_i = (py_i + 1) & (%[1]s_cap - 1)) {
+        if (%[6]s) {
+            %[1]s[py_i].py_value = py_v;
+            return py_v;
+        }
+    }
+    %[1]s[py_i].py_used = 1;
+%[10]s    %[1]s[py_i].py_value = py_v;
+    %[1]s_len++;
+    return py_v;
+}
+`, t, params(), strings.Join(hash, ""), params(m.result+"* py_v"), m.args(""), sameKey,
+		m.result, params(m.result+" py_v"), m.args("py_old[py_i].", "py_old[py_i].py_value"), strings.Join(stores, ""))
+	g.runtimeHelpers[t] = code
+}
@@ -0,0 +1,605 @@
+package py2c
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 名字改写：Python 中合法的名字在 C 中可能是关键字（int、switch、default）、C 库的函数与宏（abs、time、errno），
+// 或者与生成代码的名字（py_ 开头的运行时、临时变量 _t1、结果参数 result、main）冲突。这些名字在生成代码之前
+// 改为 名字_（已被占用时为 名字_1、名字_2 ...），结果在 Output.Renames 中。
+// 结构体成员与方法（C 中是 类名_方法名）只会与关键字和宏冲突。
+// C89 的标识符只能是 ASCII：非 ASCII 字符（中文变量名等）改为 _uXXXX（café -> caf_u00E9），Identifiers 为 utf8 时保留；
+// NameMap 给出的名字（如 CLI 的 -identifiers pinyin 用拼音：总数 -> zong_shu）优先。C 文件开头的注释列出非 ASCII 名字对应的 C 名
+
+// Rename: 一个改了名字的 Python 标识符
+type Rename struct {
+	Python string `json:"python"`
+	C      string `json:"c"`
+	Reason string `json:"reason"` // C keyword、C library name、generated name、non-ASCII 或 name map
+}
+
+// reservedC: C89 到 C11 的关键字，以及标准头文件中的宏与类型名（在任何作用域中都不能作为名字）
+var reservedC = wordSet(`auto break case char const continue default do double else enum extern float for goto if
+	inline int long register restrict return short signed sizeof static struct switch typedef union unsigned void
+	volatile while _Bool _Complex _Imaginary _Alignas _Alignof _Atomic _Generic _Noreturn _Static_assert _Thread_local
+	bool true false NULL EOF errno assert FILE size_t jmp_buf setjmp stdin stdout stderr va_list offsetof
+	va_start va_arg va_end va_copy isnan isinf isfinite isnormal signbit fpclassify isgreater isgreaterequal isless
+	islessequal islessgreater isunordered math_errhandling alloca linux unix no_argument required_argument
+	optional_argument`)
+
+// cLibDecls: 生成代码可能包含的头文件中声明的函数（局部变量会遮住它们，文件作用域的同名定义不能编译）。
+// 名字取自 glibc 的头文件在默认与 _XOPEN_SOURCE 700 下的声明（不以 _ 开头），头文件间接包含的声明（<stdlib.h> 中的
+// select、<string.h> 中的 index）记在声明它的头文件下。ctypes 载入的 C 库函数也用这张表找头文件
+var cLibDecls = []struct{ header, names string }{
+	{"stdio.h", `clearerr clearerr_unlocked ctermid dprintf fclose fdopen feof feof_unlocked ferror ferror_unlocked fflush
+		fflush_unlocked fgetc fgetc_unlocked fgetpos fgets fileno fileno_unlocked flockfile fmemopen fopen fprintf
+		fputc fputc_unlocked fputs fread fread_unlocked freopen fscanf fseek fseeko fsetpos ftell ftello
+		ftrylockfile funlockfile fwrite fwrite_unlocked getc getc_unlocked getchar getchar_unlocked getdelim getline
+		getw open_memstream pclose perror popen printf putc putc_unlocked putchar putchar_unlocked puts putw remove
+		rename renameat rewind scanf setbuf setbuffer setlinebuf setvbuf snprintf sprintf sscanf tempnam tmpfile
+		tmpnam tmpnam_r ungetc vdprintf vfprintf vfscanf vprintf vscanf vsnprintf vsprintf vsscanf`},
+	{"stdlib.h", `a64l abort abs aligned_alloc arc4random arc4random_buf arc4random_uniform at_quick_exit atexit atof atoi
+		atol bsearch calloc clearenv div drand48 drand48_r ecvt ecvt_r erand48 erand48_r exit fcvt fcvt_r free gcvt
+		getenv getloadavg getsubopt grantpt initstate initstate_r jrand48 jrand48_r l64a labs lcong48 lcong48_r ldiv
+		lrand48 lrand48_r malloc mblen mbstowcs mbtowc mkdtemp mkstemp mkstemps mktemp mrand48 mrand48_r nrand48
+		nrand48_r on_exit posix_memalign posix_openpt ptsname putenv qecvt qecvt_r qfcvt qfcvt_r qgcvt qsort
+		quick_exit rand rand_r random random_r realloc reallocarray realpath rpmatch seed48 seed48_r setenv setstate
+		setstate_r srand srand48 srand48_r srandom srandom_r strtod strtof strtol strtold strtoul system unlockpt
+		unsetenv valloc wcstombs wctomb`},
+	{"alloca.h", `alloca`},
+	{"sys/select.h", `pselect select`},
+	{"string.h", `explicit_bzero memccpy memchr memcmp memcpy memmove memset stpcpy stpncpy strcat strchr strcmp strcoll
+		strcoll_l strcpy strcspn strdup strerror strerror_l strerror_r strlen strncat strncmp strncpy strndup
+		strnlen strpbrk strrchr strsep strsignal strspn strstr strtok strtok_r strxfrm strxfrm_l`},
+	{"strings.h", `bcmp bcopy bzero ffs ffsl index rindex strcasecmp strcasecmp_l strncasecmp strncasecmp_l`},
+	{"math.h", `acos acosf acosh acoshf acoshl acosl asin asinf asinh asinhf asinhl asinl atan atan2 atan2f atan2l atanf
+		atanh atanhf atanhl atanl cbrt cbrtf cbrtl ceil ceilf ceill copysign copysignf copysignl cos cosf cosh coshf
+		coshl cosl drem dremf dreml erf erfc erfcf erfcl erff erfl exp exp2 exp2f exp2l expf expl expm1 expm1f
+		expm1l fabs fabsf fabsl fdim fdimf fdiml finite finitef finitel floor floorf floorl fma fmaf fmal fmax fmaxf
+		fmaxl fmin fminf fminl fmod fmodf fmodl frexp frexpf frexpl gamma gammaf gammal hypot hypotf hypotl ilogb
+		ilogbf ilogbl isinf isinff isinfl isnan isnanf isnanl j0 j0f j0l j1 j1f j1l jn jnf jnl ldexp ldexpf ldexpl
+		lgamma lgamma_r lgammaf lgammaf_r lgammal lgammal_r log log10 log10f log10l log1p log1pf log1pl log2 log2f
+		log2l logb logbf logbl logf logl lrint lrintf lrintl lround lroundf lroundl modf modff modfl nan nanf nanl
+		nearbyint nearbyintf nearbyintl nextafter nextafterf nextafterl nexttoward nexttowardf nexttowardl pow powf
+		powl remainder remainderf remainderl remquo remquof remquol rint rintf rintl round roundf roundl scalb
+		scalbf scalbl scalbln scalblnf scalblnl scalbn scalbnf scalbnl significand significandf significandl sin
+		sinf sinh sinhf sinhl sinl sqrt sqrtf sqrtl tan tanf tanh tanhf tanhl tanl tgamma tgammaf tgammal trunc
+		truncf truncl y0 y0f y0l y1 y1f y1l yn ynf ynl`},
+	{"ctype.h", `isalnum isalnum_l isalpha isalpha_l isascii isblank isblank_l iscntrl iscntrl_l isdigit isdigit_l isgraph
+		isgraph_l islower islower_l isprint isprint_l ispunct ispunct_l isspace isspace_l isupper isupper_l isxdigit
+		isxdigit_l toascii tolower tolower_l toupper toupper_l`},
+	{"time.h", `asctime asctime_r clock clock_getcpuclockid clock_getres clock_gettime clock_nanosleep clock_settime ctime
+		ctime_r difftime dysize getdate gmtime gmtime_r localtime localtime_r mktime nanosleep strftime strftime_l
+		strptime time timegm timelocal timer_create timer_delete timer_getoverrun timer_gettime timer_settime
+		timespec_get tzset`},
+	{"setjmp.h", `longjmp setjmp siglongjmp`},
+	{"unistd.h", `access acct alarm brk chdir chown chroot close closefrom confstr crypt daemon dup dup2 endusershell execl
+		execle execlp execv execve execvp faccessat fchdir fchown fchownat fdatasync fexecve fork fpathconf fsync
+		ftruncate getcwd getdomainname getdtablesize getegid geteuid getgid getgroups gethostid gethostname getlogin
+		getlogin_r getopt getpagesize getpass getpgid getpgrp getpid getppid getsid getuid getusershell getwd isatty
+		lchown link linkat lockf lseek nice pathconf pause pipe pread profil pwrite read readlink readlinkat revoke
+		rmdir sbrk setdomainname setegid seteuid setgid sethostid sethostname setlogin setpgid setpgrp setregid
+		setreuid setsid setuid setusershell sleep swab symlink symlinkat sync syscall sysconf tcgetpgrp tcsetpgrp
+		truncate ttyname ttyname_r ttyslot ualarm unlink unlinkat usleep vfork vhangup write`},
+	{"sys/stat.h", `chmod fchmod fchmodat fstat fstatat futimens lchmod lstat mkdir mkdirat mkfifo mkfifoat mknod mknodat stat
+		umask utimensat`},
+	{"dirent.h", `alphasort closedir dirfd fdopendir getdirentries opendir readdir readdir_r rewinddir scandir seekdir telldir`},
+	{"regex.h", `regcomp regerror regexec regfree`},
+	{"getopt.h", `getopt_long getopt_long_only`},
+	{"sched.h", `sched_get_priority_max sched_get_priority_min sched_getparam sched_getscheduler sched_rr_get_interval
+		sched_setparam sched_setscheduler sched_yield`},
+	{"pthread.h", `pthread_atfork pthread_attr_destroy pthread_attr_getdetachstate pthread_attr_getguardsize
+		pthread_attr_getinheritsched pthread_attr_getschedparam pthread_attr_getschedpolicy pthread_attr_getscope
+		pthread_attr_getstack pthread_attr_getstackaddr pthread_attr_getstacksize pthread_attr_init
+		pthread_attr_setdetachstate pthread_attr_setguardsize pthread_attr_setinheritsched
+		pthread_attr_setschedparam pthread_attr_setschedpolicy pthread_attr_setscope pthread_attr_setstack
+		pthread_attr_setstackaddr pthread_attr_setstacksize pthread_barrier_destroy pthread_barrier_init
+		pthread_barrier_wait pthread_barrierattr_destroy pthread_barrierattr_getpshared pthread_barrierattr_init
+		pthread_barrierattr_setpshared pthread_cancel pthread_cond_broadcast pthread_cond_destroy pthread_cond_init
+		pthread_cond_signal pthread_cond_timedwait pthread_cond_wait pthread_condattr_destroy
+		pthread_condattr_getclock pthread_condattr_getpshared pthread_condattr_init pthread_condattr_setclock
+		pthread_condattr_setpshared pthread_create pthread_detach pthread_equal pthread_exit pthread_getconcurrency
+		pthread_getcpuclockid pthread_getschedparam pthread_getspecific pthread_join pthread_key_create
+		pthread_key_delete pthread_mutex_consistent pthread_mutex_destroy pthread_mutex_getprioceiling
+		pthread_mutex_init pthread_mutex_lock pthread_mutex_setprioceiling pthread_mutex_timedlock
+		pthread_mutex_trylock pthread_mutex_unlock pthread_mutexattr_destroy pthread_mutexattr_getprioceiling
+		pthread_mutexattr_getprotocol pthread_mutexattr_getpshared pthread_mutexattr_getrobust
+		pthread_mutexattr_gettype pthread_mutexattr_init pthread_mutexattr_setprioceiling
+		pthread_mutexattr_setprotocol pthread_mutexattr_setpshared pthread_mutexattr_setrobust
+		pthread_mutexattr_settype pthread_once pthread_rwlock_destroy pthread_rwlock_init pthread_rwlock_rdlock
+		pthread_rwlock_timedrdlock pthread_rwlock_timedwrlock pthread_rwlock_tryrdlock pthread_rwlock_trywrlock
+		pthread_rwlock_unlock pthread_rwlock_wrlock pthread_rwlockattr_destroy pthread_rwlockattr_getkind_np
+		pthread_rwlockattr_getpshared pthread_rwlockattr_init pthread_rwlockattr_setkind_np
+		pthread_rwlockattr_setpshared pthread_self pthread_setcancelstate pthread_setcanceltype
+		pthread_setconcurrency pthread_setschedparam pthread_setschedprio pthread_setspecific pthread_spin_destroy
+		pthread_spin_init pthread_spin_lock pthread_spin_trylock pthread_spin_unlock pthread_testcancel`},
+}
+
+// cLibHeader: C 库函数 -> 声明它的头文件（由 cLibDecls 得到）
+var cLibHeader = map[string]string{}
+
+// posixHeaders: cLibDecls 中不属于 ISO C 的头文件（在 #ifndef _WIN32 中包含）
+var posixHeaders = wordSet(`alloca.h sys/select.h strings.h unistd.h sys/stat.h dirent.h regex.h getopt.h sched.h pthread.h`)
+
+func init() {
+	for _, d := range cLibDecls {
+		for _, n := range strings.Fields(d.names) {
+			cLibHeader[n] = d.header
+		}
+	}
+}
+
+// generatedName: 生成代码使用的名字：运行时（py_、Py、PY）、main 与其参数、临时变量（_t1、_i0 等）与结果参数
+var generatedName = regexp.MustCompile(`^(py_|Py|PY|(main|argc|argv)$|_(t|i|j|e|f|l|n|o|p|r|s|cm|end|inv|lb|lc|st|warned|x)[0-9]+$|result$)`)
+
+// wordSet: 以空白分隔的词的集合
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// nonASCII: 名字中有非 ASCII 字符
+func nonASCII(name string) bool {
+	return strings.IndexFunc(name, func(r rune) bool { return r > 127 }) >= 0
+}
+
+// renameReason: 名字为什么不能直接用在 C 中；member 为结构体成员或方法名，只检查关键字与宏
+func (g *generator) renameReason(name string, member bool) string {
+	switch {
+	case g.optNameMap[name] != "":
+		return "name map"
+	case nonASCII(name) && g.optIdents != "utf8":
+		return "non-ASCII"
+	case reservedC[name]:
+		return "C keyword"
+	case member:
+		return ""
+	case cLibHeader[name] != "":
+		return "C library name"
+	case generatedName.MatchString(name):
+		return "generated name"
+	}
+	return ""
+}
+
+// mangleNames: 找出程序中定义的、在 C 中会冲突的名字，改写整个 AST 中对它们的引用
+func (g *generator) mangleNames(root ASTNode) {
+	defined, members, used := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	collectIdents(root["body"], false, defined, members, used)
+	wanted := map[string]string{} // 名字 -> 原因
+	for name := range defined {
+		if reason := g.renameReason(name, false); reason != "" {
+			wanted[name] = reason
+		}
+	}
+	for name := range members {
+		if reason := g.renameReason(name, true); reason != "" {
+			wanted[name] = reason
+		}
+	}
+	if len(wanted) == 0 {
+		return
+	}
+	names := make([]string, 0, len(wanted))
+	for name := range wanted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	vars, attrs := map[string]string{}, map[string]string{}
+	for _, name := range names {
+		base := asciiName(name)
+		if mapped := g.optNameMap[name]; mapped != "" {
+			base = mapped
+		}
+		if base == name || reservedC[base] || cLibHeader[base] != "" || generatedName.MatchString(base) {
+			base += "_"
+		}
+		c := base
+		for i := 1; used[c]; i++ {
+			c = fmt.Sprintf("%s%d", base, i)
+		}
+		used[c] = true
+		if defined[name] && g.renameReason(name, false) != "" {
+			vars[name] = c
+		}
+		if members[name] && g.renameReason(name, true) != "" {
+			attrs[name] = c
+		}
+		g.renames = append(g.renames, Rename{Python: name, C: c, Reason: wanted[name]})
+		g.tracef("renamed %s to %s (%s)", name, c, wanted[name])
+	}
+	renameIdents(root["body"], false, vars, attrs)
+}
+
+// asciiName: 非 ASCII 字符改为 _uXXXX
+func asciiName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r > 127 {
+			fmt.Fprintf(&b, "_u%04X", r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// annotationKeys: 类型注解，其中的名字是类型，不改
+var annotationKeys = map[string]bool{"annotation": true, "returns": true, "type_comment": true}
+
+// collectIdents: defined 为定义的变量、函数、类与参数的名字，members 为赋值过的属性、类体中的字段与方法，
+// used 为出现过的所有名字；inClass 表示 node 是类体中的语句
+func collectIdents(node interface{}, inClass bool, defined, members, used map[string]bool) {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			collectIdents(e, inClass, defined, members, used)
+		}
+	case map[string]interface{}:
+		switch n["_type"] {
+		case "Name":
+			id, _ := n["id"].(string)
+			used[id] = true
+			if ctx, _ := n["ctx"].(map[string]interface{}); ctx["_type"] == "Store" {
+				defined[id] = true
+			}
+		case "Attribute":
+			attr, _ := n["attr"].(string)
+			used[attr] = true
+			if ctx, _ := n["ctx"].(map[string]interface{}); ctx["_type"] == "Store" {
+				members[attr] = true
+			}
+		case "FunctionDef", "AsyncFunctionDef":
+			name, _ := n["name"].(string)
+			used[name] = true
+			if inClass {
+				members[name] = true
+			} else {
+				defined[name] = true
+			}
+		case "ClassDef":
+			name, _ := n["name"].(string)
+			used[name], defined[name] = true, true
+			body, _ := n["body"].([]interface{})
+			for _, s := range body {
+				for _, t := range classTargets(s) {
+					members[t] = true
+				}
+			}
+			for k, v := range n {
+				if k != "body" {
+					collectIdents(v, false, defined, members, used)
+				}
+			}
+			collectIdents(body, true, defined, members, used)
+			return
+		case "Assign", "AnnAssign":
+			if inClass {
+				// 类体中的字段不是变量（已由 ClassDef 记入 members）
+				for _, t := range classTargets(n) {
+					used[t] = true
+				}
+				for k, v := range n {
+					if k != "targets" && k != "target" && !annotationKeys[k] {
+						collectIdents(v, false, defined, members, used)
+					}
+				}
+				return
+			}
+		case "arg":
+			id, _ := n["arg"].(string)
+			used[id], defined[id] = true, true
+		case "ExceptHandler":
+			if id, ok := n["name"].(string); ok {
+				used[id], defined[id] = true, true
+			}
+		}
+		for k, v := range n {
+			if !annotationKeys[k] {
+				collectIdents(v, false, defined, members, used)
+			}
+		}
+	}
+}
+
+// classTargets: 类体中 X = ... / X: T 定义的字段名
+func classTargets(stmt interface{}) []string {
+	s, _ := stmt.(map[string]interface{})
+	targets, _ := s["targets"].([]interface{})
+	if s["_type"] == "AnnAssign" {
+		targets = []interface{}{s["target"]}
+	} else if s["_type"] != "Assign" {
+		return nil
+	}
+	names := []string{}
+	for _, t := range targets {
+		if tm, _ := t.(map[string]interface{}); tm["_type"] == "Name" {
+			names = append(names, fmt.Sprint(tm["id"]))
+		}
+	}
+	return names
+}
+
+// renameIdents: 按 vars（变量、函数、类、参数）与 attrs（属性、字段、方法）改写子树中的名字
+func renameIdents(node interface{}, inClass bool, vars, attrs map[string]string) {
+	rename := func(m map[string]string, n map[string]interface{}, key string) {
+		if id, ok := n[key].(string); ok && m[id] != "" {
+			n[key] = m[id]
+		}
+	}
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			renameIdents(e, inClass, vars, attrs)
+		}
+	case map[string]interface{}:
+		switch n["_type"] {
+		case "Name", "Assign", "AnnAssign":
+			if inClass {
+				// 类体中的字段
+				if n["_type"] == "Name" {
+					rename(attrs, n, "id")
+					return
+				}
+				for k, v := range n {
+					if k == "targets" || k == "target" {
+						renameIdents(v, true, vars, attrs)
+					} else if !annotationKeys[k] {
+						renameIdents(v, false, vars, attrs)
+					}
+				}
+				return
+			}
+			rename(vars, n, "id")
+		case "Attribute":
+			rename(attrs, n, "attr")
+		case "FunctionDef", "AsyncFunctionDef":
+			if inClass {
+				rename(attrs, n, "name")
+			} else {
+				rename(vars, n, "name")
+			}
+		case "ClassDef":
+			rename(vars, n, "name")
+			for k, v := range n {
+				if k != "body" {
+					renameIdents(v, false, vars, attrs)
+				}
+			}
+			renameIdents(n["body"], true, vars, attrs)
+			return
+		case "arg":
+			rename(vars, n, "arg")
+		case "keyword":
+			rename(vars, n, "arg")
+		case "ExceptHandler":
+			rename(vars, n, "name")
+		case "Global", "Nonlocal":
+			ids, _ := n["names"].([]interface{})
+			for i, id := range ids {
+				if s, ok := id.(string); ok && vars[s] != "" {
+					ids[i] = vars[s]
+				}
+			}
+		}
+		for k, v := range n {
+			if !annotationKeys[k] {
+				renameIdents(v, false, vars, attrs)
+			}
+		}
+	}
+}
+
+// renameLegend: 生成的代码 src 中用到的非 ASCII 名字的原名，放在 C 文件开头
+func (g *generator) renameLegend(src string) string {
+	legend := ""
+	for _, r := range g.renames {
+		if nonASCII(r.Python) && strings.Contains(src, r.C) {
+			legend += fmt.Sprintf("//   %s -> %s\n", r.Python, r.C)
+		}
+	}
+	if legend == "" {
+		return ""
+	}
+	return "// Python names renamed for C:\n" + legend + "\n"
+}
+
+// pyDef: 模块顶层或类体中定义的函数、类
+type pyDef struct {
+	kind string // function、class 或 method
+	line int
+}
+
+// checkRedefinitions: Python 允许重新定义函数与类、给函数名赋值，C 中同一个名字只能有一个定义。
+// 和 Python 一样最后一个定义生效，之前的从 AST 中拿掉（模块中留下注释）：顶层的同类定义之间没有用到这个名字时只是警告，
+// 否则（之间用到了、函数与类同名、定义在 if / for / try 等块里，C 没有按条件选择的定义）报告为错误，连同生效的定义的行号。
+// 给函数、类名的赋值报告为错误并拿掉；@x.setter 与 @overload 桩不算重复
+func (g *generator) checkRedefinitions(root ASTNode) {
+	body, _ := root["body"].([]interface{})
+	var sites []defSite
+	collectDefSites(body, -1, false, &sites)
+	last := map[string]defSite{}
+	for _, d := range sites {
+		last[d.name] = d
+	}
+	for i, d := range sites {
+		keep := last[d.name]
+		if i == keep.order {
+			continue
+		}
+		switch {
+		case d.kind != keep.kind:
+			d.block[d.index] = g.leaveOut(d.node, "%s %s: the name is redefined as a %s at line %d", d.kind, d.name, keep.kind, keep.line)
+		case d.nested || keep.nested:
+			d.block[d.index] = g.leaveOut(d.node, "%s %s is defined again at line %d inside a block: C has no conditional definitions, only the last one is kept", d.kind, d.name, keep.line)
+		default:
+			if line := nameUsedBetween(body, d.top, keep.top, d.name); line != 0 {
+				d.block[d.index] = g.leaveOut(d.node, "%s %s is used at line %d before it is redefined at line %d: C has only the last definition", d.kind, d.name, line, keep.line)
+			} else {
+				d.block[d.index] = g.dropStmt(logWarn, d.node, "%s %s is redefined at line %d", d.kind, d.name, keep.line)
+			}
+		}
+	}
+	defs := map[string]pyDef{}
+	for name, d := range last {
+		defs[name] = pyDef{d.kind, d.line}
+		if d.kind == "class" {
+			d.node["body"] = g.checkMethodRedefinitions(name, d.node["body"])
+		}
+	}
+	root["body"] = g.checkShadowingAssigns(body, defs)
+}
+
+// defSite: 模块中（包括 if / for / while / with / try 块里）的一个函数或类定义，以及它在所在语句列表中的位置
+type defSite struct {
+	pyDef
+	name   string
+	node   map[string]interface{}
+	block  []interface{}
+	index  int
+	top    int  // 所在的顶层语句的下标
+	nested bool // 在块里
+	order  int  // 在 sites 中的下标
+}
+
+// collectDefSites: 按源码顺序收集定义，不进入函数与类；top 为 -1 时 stmts 是模块顶层
+func collectDefSites(stmts []interface{}, top int, nested bool, sites *[]defSite) {
+	for i, stmt := range stmts {
+		m, _ := stmt.(map[string]interface{})
+		t := top
+		if top < 0 {
+			t = i
+		}
+		if kind := map[interface{}]string{"FunctionDef": "function", "AsyncFunctionDef": "function", "ClassDef": "class"}[m["_type"]]; kind != "" {
+			name, _ := m["name"].(string)
+			*sites = append(*sites, defSite{pyDef{kind, posOf(m, "lineno")}, name, m, stmts, i, t, nested, len(*sites)})
+			continue
+		}
+		for _, key := range []string{"body", "orelse", "finalbody"} {
+			if b, ok := m[key].([]interface{}); ok {
+				collectDefSites(b, t, true, sites)
+			}
+		}
+		handlers, _ := m["handlers"].([]interface{})
+		for _, h := range handlers {
+			if hm, ok := h.(map[string]interface{}); ok {
+				b, _ := hm["body"].([]interface{})
+				collectDefSites(b, t, true, sites)
+			}
+		}
+	}
+}
+
+// nameUsedBetween: 顶层语句 from 与 to 之间（不含两端，不进入函数与类）第一次用到 name 的行号，没有为 0
+func nameUsedBetween(body []interface{}, from, to int, name string) int {
+	for _, stmt := range body[from+1 : to] {
+		m, _ := stmt.(map[string]interface{})
+		if m["_type"] == "FunctionDef" || m["_type"] == "AsyncFunctionDef" || m["_type"] == "ClassDef" {
+			continue
+		}
+		used := false
+		collectNames(m, func(id string) { used = used || id == name })
+		if used {
+			return posOf(m, "lineno")
+		}
+	}
+	return 0
+}
+
+// checkMethodRedefinitions: 类体中重复的方法（C 中都是 类名_方法名）：最后一个定义生效，之前的拿掉并给出警告
+func (g *generator) checkMethodRedefinitions(class string, body interface{}) []interface{} {
+	stmts, _ := body.([]interface{})
+	last := map[string]int{}
+	for _, stmt := range stmts {
+		m, _ := stmt.(map[string]interface{})
+		if name, _ := m["name"].(string); m["_type"] == "FunctionDef" && !hasDecorator(m, "setter") && !hasDecorator(m, "deleter") {
+			last[name] = posOf(m, "lineno")
+		}
+	}
+	out := []interface{}{}
+	for _, stmt := range stmts {
+		m, _ := stmt.(map[string]interface{})
+		name, _ := m["name"].(string)
+		if line, ok := last[name]; ok && m["_type"] == "FunctionDef" && !hasDecorator(m, "setter") && !hasDecorator(m, "deleter") && line != posOf(m, "lineno") {
+			g.dropStmt(logWarn, m, "method %s.%s is redefined at line %d", class, name, line)
+			continue
+		}
+		out = append(out, stmt)
+	}
+	return out
+}
+
+// checkShadowingAssigns: 模块中（包括 if / for / while / with / try 块里）给函数名或类名赋值的语句
+func (g *generator) checkShadowingAssigns(stmts []interface{}, defs map[string]pyDef) []interface{} {
+	for i, stmt := range stmts {
+		m, _ := stmt.(map[string]interface{})
+		targets := []interface{}{}
+		switch m["_type"] {
+		case "Assign":
+			targets, _ = m["targets"].([]interface{})
+		case "AnnAssign", "AugAssign", "For":
+			targets = []interface{}{m["target"]}
+		case "FunctionDef", "AsyncFunctionDef", "ClassDef":
+			continue
+		}
+		shadowed := ""
+		for _, t := range targets {
+			targetNames(t, func(id string) {
+				if _, ok := defs[id]; ok && shadowed == "" {
+					shadowed = id
+				}
+			})
+		}
+		if d, ok := defs[shadowed]; ok {
+			stmts[i] = g.leaveOut(m, "assignment to %s, the %s defined at line %d: in C a name cannot be both", shadowed, d.kind, d.line)
+			continue
+		}
+		for _, key := range []string{"body", "orelse", "finalbody"} {
+			if b, ok := m[key].([]interface{}); ok {
+				m[key] = g.checkShadowingAssigns(b, defs)
+			}
+		}
+		handlers, _ := m["handlers"].([]interface{})
+		for _, h := range handlers {
+			if hm, ok := h.(map[string]interface{}); ok {
+				b, _ := hm["body"].([]interface{})
+				hm["body"] = g.checkShadowingAssigns(b, defs)
+			}
+		}
+	}
+	return stmts
+}
+
+// targetNames: 赋值目标中的名字；a[i] 只看 a，下标中的名字（d[Color.RED] 的 Color）不是赋值的对象
+func targetNames(t interface{}, fn func(id string)) {
+	m, _ := t.(map[string]interface{})
+	switch m["_type"] {
+	case "Name":
+		fn(fmt.Sprint(m["id"]))
+	case "Subscript", "Attribute", "Starred":
+		targetNames(m["value"], fn)
+	case "Tuple", "List":
+		elts, _ := m["elts"].([]interface{})
+		for _, e := range elts {
+			targetNames(e, fn)
+		}
+	}
+}
+
+// leaveOut: 报告错误并把语句换成 pass，输出中是一行说明它被拿掉的注释
+func (g *generator) leaveOut(node map[string]interface{}, format string, args ...interface{}) map[string]interface{} {
+	return g.dropStmt(logError, node, format, args...)
+}
+
+// dropStmt: 按 level 报告并把语句换成 pass（见 leaveOut）
+func (g *generator) dropStmt(level int, node map[string]interface{}, format string, args ...interface{}) map[string]interface{} {
+	msg := fmt.Sprintf(format, args...)
+	g.report(level, node, "%s; it is left out", msg)
+	return map[string]interface{}{"_type": "Pass", "lineno": node["lineno"], "col_offset": node["col_offset"], "_leftOut": msg}
+}
@@ -0,0 +1,309 @@
+package py2c
+
+import (
+	"encoding/json"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// -O：生成代码前后的优化。代码生成之前改写 AST：常量表达式折叠（60*60*24 -> 86400），
+// 去掉条件为常量的 if / while 中不会执行的分支，以及 return / raise / break / continue 之后的语句；
+// 代码生成之后去掉没有用到的 static 辅助函数（运行时的一组函数常常只用到其中几个）。
+
+// optimize: 代码生成之前的 AST 优化，没有 -O 时不做
+func (g *generator) optimize(root ASTNode) {
+	if !g.optOptimize {
+		return
+	}
+	root["body"] = g.optimizeBlock(root["body"])
+}
+
+// optimizeBlock: 优化一个语句列表：先处理每条语句内部，再展开常量条件的分支，截掉不可达的语句
+func (g *generator) optimizeBlock(node interface{}) []interface{} {
+	stmts, _ := node.([]interface{})
+	out := []interface{}{}
+	for i, s := range stmts {
+		stmt, ok := s.(map[string]interface{})
+		if !ok {
+			out = append(out, s)
+			continue
+		}
+		g.optimizeStmt(stmt)
+		kept := []interface{}{stmt}
+		switch stmt["_type"] {
+		case "If":
+			if cond, ok := g.constCondition(stmt["test"]); ok {
+				// if False: / if True: 只留下会执行的分支
+				kept, _ = stmt["orelse"].([]interface{})
+				if cond {
+					kept, _ = stmt["body"].([]interface{})
+				}
+			}
+		case "While":
+			if cond, ok := g.constCondition(stmt["test"]); ok && !cond {
+				kept, _ = stmt["orelse"].([]interface{})
+			}
+		}
+		out = append(out, kept...)
+		if len(kept) > 0 && g.terminates(kept[len(kept)-1]) {
+			if i+1 < len(stmts) {
+				g.tracef("-O: %d unreachable statements removed after line %v", len(stmts)-i-1, stmt["lineno"])
+			}
+			break
+		}
+	}
+	if len(stmts) > 0 && len(out) == 0 {
+		// Python 的语句块不能为空
+		out = append(out, map[string]interface{}{"_type": "Pass"})
+	}
+	return out
+}
+
+// optimizeStmt: 折叠语句中的常量表达式，优化其中的语句块
+func (g *generator) optimizeStmt(stmt map[string]interface{}) {
+	for key, v := range stmt {
+		switch key {
+		case "body", "orelse", "finalbody":
+			if _, ok := v.([]interface{}); ok {
+				stmt[key] = g.optimizeBlock(v)
+				continue
+			}
+		case "handlers":
+			handlers, _ := v.([]interface{})
+			for _, h := range handlers {
+				if hm, ok := h.(map[string]interface{}); ok {
+					hm["body"] = g.optimizeBlock(hm["body"])
+				}
+			}
+			continue
+		}
+		g.foldConstants(v)
+	}
+}
+
+// terminates: 语句之后的代码不会执行
+func (g *generator) terminates(node interface{}) bool {
+	stmt, _ := node.(map[string]interface{})
+	switch stmt["_type"] {
+	case "Return", "Raise", "Break", "Continue":
+		return true
+	case "If":
+		body, _ := stmt["body"].([]interface{})
+		orelse, _ := stmt["orelse"].([]interface{})
+		return len(body) > 0 && len(orelse) > 0 && g.terminates(body[len(body)-1]) && g.terminates(orelse[len(orelse)-1])
+	case "While":
+		// 没有 break 的 while True:
+		cond, ok := g.constCondition(stmt["test"])
+		return ok && cond && !loopControl(stmt["body"])
+	}
+	return false
+}
+
+// constCondition: 只由常量组成的条件的值
+func (g *generator) constCondition(node interface{}) (bool, bool) {
+	if !constTree(node) {
+		return false, false
+	}
+	v, ok := g.evalConstExpr(node, map[string]constVal{}, 0)
+	return v.truthy(), ok
+}
+
+// constTree: 表达式只由数字、布尔常量与运算组成（没有变量与调用）
+func constTree(node interface{}) bool {
+	m, _ := node.(map[string]interface{})
+	switch m["_type"] {
+	case "Constant":
+		switch m["value"].(type) {
+		case json.Number, bool:
+			return true
+		}
+		return false
+	case "BinOp":
+		return constTree(m["left"]) && constTree(m["right"])
+	case "UnaryOp":
+		return constTree(m["operand"])
+	case "BoolOp", "Compare":
+		operands, _ := m["values"].([]interface{})
+		if m["_type"] == "Compare" {
+			operands, _ = m["comparators"].([]interface{})
+			operands = append([]interface{}{m["left"]}, operands...)
+		}
+		for _, e := range operands {
+			if !constTree(e) {
+				return false
+			}
+		}
+		return len(operands) > 0
+	case "IfExp":
+		return constTree(m["test"]) && constTree(m["body"]) && constTree(m["orelse"])
+	}
+	return false
+}
+
+// foldConstants: 把只由数字常量组成的算术表达式改写为常量节点；比较与逻辑运算的结果是 bool，留给 C 编译器
+func (g *generator) foldConstants(node interface{}) {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			g.foldConstants(e)
+		}
+	case map[string]interface{}:
+		for _, v := range n {
+			g.foldConstants(v)
+		}
+		if n["_type"] == "IfExp" && constTree(n["test"]) {
+			if cond, ok := g.evalConstExpr(n["test"], map[string]constVal{}, 0); ok {
+				branch, _ := n["orelse"].(map[string]interface{})
+				if cond.truthy() {
+					branch, _ = n["body"].(map[string]interface{})
+				}
+				replaceNode(n, branch)
+			}
+			return
+		}
+		if (n["_type"] != "BinOp" && n["_type"] != "UnaryOp") || !constTree(n) || hugePower(n) {
+			return
+		}
+		v, ok := g.evalConstExpr(n, map[string]constVal{}, 0)
+		if !ok {
+			return
+		}
+		if v.kind == 'i' && hasPower(n) {
+			// C 中的幂是 pow()，结果为 double：折叠后仍是浮点常量，printf 等不受影响
+			v = floatVal(float64(v.i))
+		}
+		lit := ""
+		switch v.kind {
+		case 'i':
+			if v.i > 1<<53 || v.i < -(1<<53) {
+				// 超出 double 能精确表示的范围：留给运行时
+				return
+			}
+			lit = strconv.FormatInt(v.i, 10)
+		case 'f':
+			if math.IsInf(v.f, 0) || math.IsNaN(v.f) {
+				return
+			}
+			lit = strconv.FormatFloat(v.f, 'g', -1, 64)
+			if !strings.ContainsAny(lit, ".eE") {
+				lit += ".0"
+			}
+		default:
+			return
+		}
+		replaceNode(n, map[string]interface{}{"_type": "Constant", "value": json.Number(lit)})
+	}
+}
+
+// hugePower: 整数的大指数幂（编译期逐次相乘，结果也会溢出）
+func hugePower(n map[string]interface{}) bool {
+	op, _ := n["op"].(map[string]interface{})
+	right, _ := n["right"].(map[string]interface{})
+	exp, ok := right["value"].(json.Number)
+	return op["_type"] == "Pow" && ok && len(exp.String()) > 2
+}
+
+// hasPower: 表达式中有 ** 运算
+func hasPower(node interface{}) bool {
+	n, _ := node.(map[string]interface{})
+	switch n["_type"] {
+	case "BinOp":
+		op, _ := n["op"].(map[string]interface{})
+		return op["_type"] == "Pow" || hasPower(n["left"]) || hasPower(n["right"])
+	case "UnaryOp":
+		return hasPower(n["operand"])
+	}
+	return false
+}
+
+// replaceNode: 原地把节点 n 换成 with，保留 n 的源码位置
+func replaceNode(n, with map[string]interface{}) {
+	pos := map[string]interface{}{}
+	for _, k := range []string{"lineno", "col_offset", "end_lineno", "end_col_offset"} {
+		if v, ok := n[k]; ok {
+			pos[k] = v
+		}
+	}
+	for k := range n {
+		delete(n, k)
+	}
+	for k, v := range with {
+		n[k] = v
+	}
+	for k, v := range pos {
+		n[k] = v
+	}
+}
+
+// staticFuncStart: 文件作用域 static 函数定义或原型的第一行，子匹配为函数名
+var staticFuncStart = regexp.MustCompile(`^static [^=;(]*?\b(\w+)\(.*\)( \{|;)$`)
+
+// identRe: C 标识符
+var identRe = regexp.MustCompile(`[A-Za-z_]\w*`)
+
+// pruneHelpers: 去掉没有被调用（也没有取地址）的 static 函数，连同紧挨在定义前的注释与原型；
+// 删掉一个函数后它调用的函数可能也不再用到，反复进行直到没有变化
+func pruneHelpers(src string) string {
+	for {
+		lines := strings.SplitAfter(src, "\n")
+		type span struct{ start, end int }
+		spans := map[string][]span{}
+		for i := 0; i < len(lines); i++ {
+			m := staticFuncStart.FindStringSubmatch(strings.TrimRight(lines[i], "\n"))
+			if m == nil {
+				continue
+			}
+			end := i
+			if m[2] == " {" {
+				for end < len(lines) && lines[end] != "}\n" {
+					end++
+				}
+				if end == len(lines) {
+					return src
+				}
+			}
+			spans[m[1]] = append(spans[m[1]], span{i, end})
+			i = end
+		}
+		// 每个名字在定义、原型之外出现的次数
+		uses := map[string]int{}
+		for _, id := range identRe.FindAllString(src, -1) {
+			if _, ok := spans[id]; ok {
+				uses[id]++
+			}
+		}
+		drop := make([]bool, len(lines))
+		changed := false
+		for name, ss := range spans {
+			own := 0
+			for _, s := range ss {
+				own += len(regexp.MustCompile(`\b`+name+`\b`).FindAllString(strings.Join(lines[s.start:s.end+1], ""), -1))
+			}
+			if uses[name] > own {
+				continue
+			}
+			changed = true
+			for _, s := range ss {
+				start := s.start
+				for start > 0 && strings.HasPrefix(lines[start-1], "// ") {
+					start--
+				}
+				for i := start; i <= s.end; i++ {
+					drop[i] = true
+				}
+			}
+		}
+		if !changed {
+			return src
+		}
+		kept := ""
+		for i, line := range lines {
+			if !drop[i] {
+				kept += line
+			}
+		}
+		src = kept
+	}
+}
@@ -0,0 +1,195 @@
+package py2c
+
+import (
+	"strings"
+	"sync"
+)
+
+// 扩展接口：下游工具不改 nodeToC 的 switch，就能为某种节点或某个函数调用提供自己的翻译。
+//
+//	func init() {
+//		py2c.RegisterHandler("ListComp", func(c *py2c.Context) (string, bool) { ... })
+//		py2c.RegisterCallHandler("numpy.zeros", "double*", func(c *py2c.Context) (string, bool) { ... })
+//	}
+//
+// 注册在 init 中完成（与 database/sql 的驱动一样）；每次翻译开始时取一份快照，翻译中注册的要到下一次翻译才生效。
+// handler 返回 false 时照常翻译；Context.Default 是内置的翻译，可以在它的结果上修改
+
+// Handler: 一个节点的翻译；ok 为 false 时使用内置的翻译
+type Handler func(c *Context) (code string, ok bool)
+
+// callHandler: RegisterCallHandler 注册的调用
+type callHandler struct {
+	typ string
+	fn  Handler
+}
+
+var registry struct {
+	sync.RWMutex
+	nodes map[string]Handler
+	calls map[string]callHandler
+}
+
+// RegisterHandler: 为 AST 节点类型（py2ast.py 的 _type，如 ListComp、While）注册翻译，替换之前注册的。
+// 表达式返回 C 表达式；语句返回带缩进（Context.Pad）与换行的完整代码
+func RegisterHandler(nodeType string, h Handler) {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.nodes == nil {
+		registry.nodes = map[string]Handler{}
+	}
+	registry.nodes[nodeType] = h
+}
+
+// RegisterCallHandler: 为函数调用注册翻译。name 是调用的全名（import numpy as np 后 np.zeros 为 numpy.zeros），
+// 或者直接调用的函数名；resultType 是结果在翻译中的类型（int、double、char* 或 C 类型），空为没有结果。
+// 先于标准库的映射与 Options.Calls
+func RegisterCallHandler(name, resultType string, h Handler) {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.calls == nil {
+		registry.calls = map[string]callHandler{}
+	}
+	registry.calls[name] = callHandler{resultType, h}
+}
+
+// Handlers: 已注册的节点类型与调用名，按名字排序
+func Handlers() (nodes, calls []string) {
+	registry.RLock()
+	defer registry.RUnlock()
+	nodes, calls = sortedKeys(registry.nodes), sortedKeys(registry.calls)
+	return nodes, calls
+}
+
+// pluginSnapshot: 翻译开始时的注册表
+func pluginSnapshot() (map[string]Handler, map[string]callHandler) {
+	registry.RLock()
+	defer registry.RUnlock()
+	nodes, calls := map[string]Handler{}, map[string]callHandler{}
+	for k, v := range registry.nodes {
+		nodes[k] = v
+	}
+	for k, v := range registry.calls {
+		calls[k] = v
+	}
+	return nodes, calls
+}
+
+// pluginDefault: 节点上的标记：Context.Default 正在为它做内置的翻译，不再交给 handler
+const pluginDefault = "_plugin_default"
+
+// pluginNode: 节点类型注册了 handler 时调用它
+func (g *generator) pluginNode(typeStr string, node ASTNode, indent int) (string, bool) {
+	h := g.nodeHandlers[typeStr]
+	if h == nil || node[pluginDefault] == true {
+		return "", false
+	}
+	return h(&Context{g: g, node: node, indent: indent, builtin: g.nodeToC})
+}
+
+// pluginCall: 调用的函数注册了 handler 时调用它
+func (g *generator) pluginCall(fn map[string]interface{}, node ASTNode, indent int) (string, bool) {
+	if len(g.callHandlers) == 0 || node[pluginDefault] == true {
+		return "", false
+	}
+	h, ok := g.callHandlers[g.pluginCallName(fn)]
+	if !ok {
+		return "", false
+	}
+	return h.fn(&Context{g: g, node: node, indent: indent, builtin: g.handleCall})
+}
+
+// pluginCallType: 注册了 handler 的调用的结果类型
+func (g *generator) pluginCallType(fn map[string]interface{}) (string, bool) {
+	if len(g.callHandlers) == 0 {
+		return "", false
+	}
+	h, ok := g.callHandlers[g.pluginCallName(fn)]
+	if ok && h.typ == "" {
+		return "void", true
+	}
+	return h.typ, ok
+}
+
+// pluginCallName: 查找调用 handler 用的名字：全名，或者直接调用的（未改名的）函数名
+func (g *generator) pluginCallName(fn map[string]interface{}) string {
+	if q := g.qualifiedCallName(fn); q != "" {
+		return q
+	}
+	if id, _ := fn["id"].(string); fn["_type"] == "Name" {
+		return g.pythonName(id)
+	}
+	return ""
+}
+
+// Context: handler 翻译一个节点时可以用的信息与翻译器的功能
+type Context struct {
+	g       *generator
+	node    map[string]interface{}
+	indent  int
+	builtin func(ASTNode, int) string
+}
+
+// Node: 正在翻译的节点（py2ast.py 的 JSON 解码后的 map）；handler 不应修改它
+func (c *Context) Node() map[string]interface{} { return c.node }
+
+// Indent: 语句所在的缩进层级
+func (c *Context) Indent() int { return c.indent }
+
+// Pad: 缩进层级对应的空格
+func (c *Context) Pad() string { return strings.Repeat(" ", c.indent*4) }
+
+// Expr: 翻译子表达式（如 Node()["args"] 中的实参）
+func (c *Context) Expr(expr interface{}) string {
+	m, ok := expr.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	return c.g.toC(m, 0)
+}
+
+// Stmts: 翻译语句列表（如 Node()["body"]），缩进为 indent
+func (c *Context) Stmts(body interface{}, indent int) string {
+	list, _ := body.([]interface{})
+	return c.g.stmtsToC(list, indent)
+}
+
+// Type: 表达式在翻译中的类型（int、double、char*、类名* 等）
+func (c *Context) Type(expr interface{}) string { return c.g.getType(expr) }
+
+// CallName: 调用的全名（import numpy as np 时 np.zeros 为 numpy.zeros），不是模块中的函数时为空
+func (c *Context) CallName(fn interface{}) string {
+	m, _ := fn.(map[string]interface{})
+	return c.g.qualifiedCallName(m)
+}
+
+// Include: 生成的代码包含头文件：x.h 为 <x.h>，"x.h" 为 #include "x.h"
+func (c *Context) Include(header string) { c.g.addInclude(header) }
+
+// Temp: 新的临时变量名（prefix 加编号）
+func (c *Context) Temp(prefix string) string { return c.g.newTemp(prefix) }
+
+// Before: 在当前语句之前执行的 C 代码（不带缩进，如临时变量的声明）
+func (c *Context) Before(code string) {
+	c.g.pendingPre = append(c.g.pendingPre, strings.TrimSuffix(code, "\n")+"\n")
+}
+
+// Warn: 报告节点上的警告，与翻译器自己的诊断一起输出
+func (c *Context) Warn(format string, args ...interface{}) {
+	c.g.report(logWarn, c.node, format, args...)
+}
+
+// Error: 报告节点上的错误
+func (c *Context) Error(format string, args ...interface{}) {
+	c.g.report(logError, c.node, format, args...)
+}
+
+// Default: 内置的翻译（不再调用这个 handler）
+func (c *Context) Default() string {
+	if c.node[pluginDefault] == true {
+		return c.builtin(c.node, c.indent)
+	}
+	c.node[pluginDefault] = true
+	defer delete(c.node, pluginDefault)
+	return c.builtin(c.node, c.indent)
+}
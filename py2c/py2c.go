@@ -0,0 +1,10112 @@
+// Package py2c translates a Python AST (the JSON written by py2ast.py) to C
+// py2c 包：Python AST（JSON）转C代码；命令行工具见 cmd/py2c
+package py2c
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ASTNode: alias for Python AST node (as map)
+// ASTNode：Python AST节点的map别名
+type ASTNode map[string]interface{}
+
+// statementTypes: 由 toC 统一输出 pendingPre / pendingPost 的语句
+var statementTypes = map[string]bool{
+	"Assign": true, "AugAssign": true, "AnnAssign": true, "Expr": true, "Return": true,
+	"If": true, "For": true, "While": true, "Raise": true, "Assert": true, "Delete": true,
+}
+
+// ownedObj: 作用域结束时销毁的对象
+type ownedObj struct {
+	name, class string
+	heap        bool // true：malloc 分配，释放时调用 Class_free
+	rc          bool // true：-refcount 模式下持有的引用或 -owned-strings 的字符串，释放时 py_decref / free
+}
+
+// methodSig: 方法签名（不含 self）
+type methodSig struct {
+	ret        string
+	params     []string // 带类型的参数，如 "double x"
+	paramNames []string
+}
+
+// generator: 一次翻译的代码生成状态。每次 Translate / TranslateModules 使用新的 generator，
+// 互不影响，可以并发翻译
+type generator struct {
+	usesPow         bool            // Whether pow() is used 是否用到pow函数
+	usesArgv        bool            // 是否用到 sys.argv，main 带 argc/argv 参数
+	usesPosix       bool            // 是否用到 POSIX 函数（clock_gettime、nanosleep 等），需要在头文件之前定义 _XOPEN_SOURCE
+	symtab          *symbolTable    // 当前作用域的符号表：变量名 -> 类型，见 symtab.go
+	funcDefs        []string        // All function definitions 所有函数定义
+	irFuncs         []*irFunc       // 已生成的顶层函数的 IR，与 funcDefs 一一对应
+	classStructs    []string        // All struct definitions 所有结构体定义
+	classStructsMap map[string]bool // 类名集合
+
+	// --- 全局函数参数类型映射 ---
+	funcArgTypes map[string][][]string // 函数名 -> 多个调用的参数类型列表
+
+	// --- collectClassInitArgTypes: 收集所有类构造函数参数类型 ---
+	classInitArgTypes map[string][][]string // 类名 -> 多个调用的参数类型列表
+
+	// --- 全程序类型推断（infer.go）：作用域为空（模块顶层）、函数名或 类名.方法名 ---
+	inferScopes  map[string]*inferScope
+	inferVars    map[string]map[string]string // 作用域 -> 变量 -> 首次赋值的类型
+	inferWidened map[string]map[string]bool   // 作用域 -> 首次赋值 int、之后又赋了 float 的变量（声明为 double，见 declType）
+	inferParams  map[string][]string          // 顶层函数 -> 按位置的参数类型，空为未知或对象
+	inferReturns map[string]string            // 函数与方法 -> 返回值类型（int、double、char*、列表或对象指针）
+	inferFields  map[string]map[string]string // 类名 -> 字段 -> 方法中第一次 self.x = ... 的类型（类生成之前 getType 取用）
+	inferTabs    map[string]*symbolTable      // typeIn 为各作用域建立的符号表；推断出的变量或参数类型变了就清空
+	inferPending bool                         // 求类型时调用了还没有推断出返回类型的函数（如递归调用），结果是默认的 char*
+
+	// --- 头文件与逃逸分析状态 ---
+	includes        map[string]bool               // 额外需要的头文件（stdio.h/math.h 之外）
+	winIncludes     map[string]bool               // 只在 Windows 上包含的头文件（#ifdef _WIN32）
+	posixIncludes   map[string]bool               // 只在其他（POSIX）系统上包含的头文件（#else 分支）
+	userIncludes    map[string]bool               // #include "x.h"：@py2c.extern(header=) 给出的头文件
+	funcResultTypes map[string]string             // 函数名 -> result 指针指向的类型
+	forwardCalls    map[string]map[protoSlot]bool // 函数名 -> 在它生成之前调用它的位置
+	objectVars      map[string]map[string]string  // 作用域 -> 对象变量 -> 类名
+	escapeInfo      map[string]map[string]string  // 作用域 -> 逃逸的对象变量 -> 逃逸原因
+	currentScope    string                        // 当前生成的作用域：函数名 / 类名.方法名，main 为空
+
+	// --- 类信息登记：继承关系、字段、方法签名 ---
+	classBases      map[string]string            // 类名 -> 父类名（无父类为空）
+	classFields     map[string]map[string]string // 类名 -> 自身声明的字段 -> 类型
+	classMethods    map[string][]string          // 类名 -> 方法名（含继承来的），按定义顺序
+	methodSigs      map[string]methodSig         // 类名.方法名 -> 签名
+	currentClass    string                       // 当前生成的类，self 的字段访问据此解析
+	classFieldOrder map[string][]string          // 类名 -> 自身声明的字段，按定义顺序
+	strFuncs        map[string]bool              // 已生成 类名_str 的类
+	classAttrs      map[string]map[string]string // 类名 -> 类属性 -> 类型（输出为文件作用域变量 类名_属性）
+	staticMethods   map[string]bool              // 类名.方法名 -> @staticmethod / @classmethod，没有 self 参数
+	properties      map[string]bool              // 类名.属性名 -> @property，读写改为调用 类名_get_x / 类名_set_x
+
+	// --- 表达式中的调用提升 ---
+	// 有返回值的函数采用 result 指针约定，不能直接出现在表达式里：
+	// 先把调用写入临时变量，调用语句暂存在 pendingPre，由所在语句统一输出到语句之前。
+	pendingPre []string // 当前语句需要先执行的代码（不含缩进）
+
+	// --- 元组返回值 ---
+	// 返回元组的函数：result 指向按元素类型生成的结构体，字段依次为 _0, _1, ...
+	tupleTypes map[string][]string // 元组结构体名 -> 元素类型
+
+	// --- 类型注解 ---
+	// if TYPE_CHECKING 块与 @overload 桩只供类型检查，代码生成前从 AST 中去掉；
+	// 它们和普通函数定义上的注解一起登记下来，优先于调用点推断的类型。
+	annotParams  map[string][]string // 函数名 / 类名.方法名 -> 参数注解对应的 C 类型（不含 self，未注解为空）
+	annotReturns map[string]string   // 函数名 / 类名.方法名 -> 返回值注解对应的 C 类型
+	typeAliases  map[string]string   // TYPE_CHECKING 块中的类型别名 -> C 类型
+	annotClasses map[string]bool     // 源码中定义的类，注解里出现时按对象处理
+
+	// --- 列表运行时 ---
+	// Python 的 list 是引用类型：按元素类型生成 PyList_<类型> 结构体和操作函数，变量保存指针
+	listTypes map[string]string            // 列表结构体名 -> 元素类型
+	listLater map[string]bool              // 分析阶段遇到的对象列表：结构体要等元素的类生成之后才输出
+	copyFuncs map[string]bool              // 已生成的 copy/deepcopy 辅助函数
+	listVars  map[string]map[string]string // 作用域 -> 列表变量 -> 列表类型，供代码生成前的调用点类型收集使用
+
+	// --- 标准库映射 ---
+	moduleAliases  map[string]string // 本地名 -> 模块名（import warnings as w）
+	importedFuncs  map[string]string // 本地名 -> 模块名.函数名（from warnings import warn）
+	unresolved     map[string]bool   // import 的模块中既不是本地模块、也不在 stdlibModules 中的
+	runtimeHelpers map[string]string // 生成代码用到的运行时辅助函数：名字 -> 定义，输出在结构体之前
+
+	// --- 优化选项 ---
+	optInlineGetters bool              // -inline-getters：简单 getter 调用直接替换为字段访问
+	optLICM          bool              // -licm：把 range 循环中的不变表达式提到循环外
+	optHeap          bool              // -heap：所有对象都用 malloc 分配，作用域结束时释放
+	optRefcount      bool              // -refcount：字符串、列表、对象都带引用计数，赋值/出作用域/放入容器时增减
+	optOwnedStrs     bool              // -owned-strings（-refcount 也是）：动态字符串按实际长度分配，变量持有自己的副本
+	optArena         bool              // -alloc arena：分配调用改为从大块中依次切出、程序结束时一起释放的 py_arena_ 函数
+	optCallGraph     string            // 调用图的格式：dot 或 json，空为不生成
+	optAnnotate      bool              // -annotate：每条翻译后的 C 代码前加上原 Python 语句的注释
+	optLineMap       string            // -line-map：directive 时每条语句前加 #line 指回 Python 源码，comment 时加 /* 文件:行:列 */ 注释
+	optHeader        string            // -header：同时输出头文件，顶层代码放到 名字_module_init() 而不是 main
+	optBuildFiles    []string          // -build-files：多模块翻译时生成的构建文件（make、cmake）
+	optCStd          string            // 构建文件中的 C 标准，空时取 emit 的方言，再按运行时的需要取 c99 或 c11
+	optProfile       string            // -profile：目标平台，arduino 见 arduino.go
+	optFreestanding  bool              // -freestanding：不包含头文件、不调用 C 库，见 freestanding.go
+	optStyle         Style             // 生成代码的格式，见 format.go
+	optOptimize      bool              // -O：常量折叠、去掉不可达的代码与没有用到的辅助函数，见 optimize.go
+	optStripDocs     bool              // -strip-docstrings：文档字符串不输出为 /** */ 注释
+	optComments      bool              // -comments：Python 源码中的 # 注释放回 C 代码，见 comments.go
+	optStrict        bool              // -strict：使用前可能没有赋值的变量报告为错误，见 unbound.go
+	optOnly          map[string]bool   // -only：只翻译这些顶层函数，nil 为全部；见 select.go
+	optExclude       map[string]bool   // -exclude：这些顶层函数只输出原型
+	optIdents        string            // -identifiers：非 ASCII 名字为 escape（_uXXXX）或 utf8（原样），见 names.go
+	optNameMap       map[string]string // Python 名 -> C 名，优先于自动改名
+	optExterns       map[string]string // Python 名 -> 实现它的 C 函数，见 extern.go
+	optStubs         bool              // -stub-unsupported：不能翻译的代码换成运行时失败的调用，见 stub.go
+	emit             emitter           // -std 与 -profile 选择的 C 后端，见 emit.go
+	optCFile         string            // 生成的 C 文件名，写进函数结尾的 #line
+	optOutputDir     string            // 多模块时的输出目录，#line 中的文件名相对于它
+	traceOut         io.Writer         // 分析过程的调试信息，nil 为不输出
+	optExceptions    string            // -exceptions：setjmp（try/except 可以捕获）、exit（raise 打印后退出）或 status（返回错误码）
+	tempCounter      int               // 生成临时变量名的计数器
+	getterFields     map[string]string // 类名.方法名 -> 该 getter 直接返回的字段
+	classGlobals     map[string]string // 类名 -> 该类对象的文件作用域变量的定义，紧跟在类的结构体之后（见 declareGlobals）
+
+	// --- 对象生命周期 ---
+	ownedObjects []ownedObj      // 当前作用域顶层声明、未逃逸的对象，作用域结束时销毁
+	scopeIndent  int             // 当前函数体的缩进层级，只有这一层声明的对象才登记
+	freeFuncs    map[string]bool // 已生成 Class_free 的类
+	rcLocals     []string        // -refcount：嵌套块里首次赋值的引用变量，声明提到函数体开头
+	pendingPost  []string        // 当前语句结束后要执行的代码（释放临时引用）
+	rcTemps      map[string]bool // 保存新引用的临时变量
+
+	// --- 异常 ---
+	usesExceptions                    bool            // 源码中有 try/raise：运行时错误（如下标越界）也按异常抛出
+	excClasses                        map[string]bool // 继承自异常类型的用户类
+	tryFrames                         []tryFrame      // 当前函数中包住当前语句的 try 帧，由外到内
+	loopTryBase                       int             // 最内层循环开始时 tryFrames 的长度，break/continue 只离开其后的帧
+	currentHandler, currentHandlerVar string          // 所在 except 块的异常帧及 as 绑定的变量名，供 raise 重新抛出
+	statusFuncs                       map[string]bool // -exceptions=status：返回错误码的函数
+	statusTargets                     []statusTarget  // 包住当前语句的 try 块：出错时写入的状态变量与跳转标签
+	errCodes                          []string        // 用到的错误码（异常类型名），按登记顺序编号
+	tryDecls                          *[]string       // 最外层 try 块之前的变量声明，见 tryHoist
+	tryScope                          *symbolTable    // tryDecls 中的变量登记所在的作用域
+
+	// --- 调用图 ---
+	translatedFuncs map[string]string // 由 Python 函数/方法翻译来的 C 函数 -> Python 中的名字
+
+	// --- 由 C 实现的函数（extern.go） ---
+	externs map[string]*externSpec // 顶层函数名 -> 实现它的 C 函数与签名
+
+	// --- ctypes（ctypes.go） ---
+	ctypesLibs  map[string]*ctypesLib  // 保存库的变量 -> 库
+	ctypesFuncs map[string]*ctypesFunc // 变量.函数名 -> argtypes、restype 与声明
+	ctypesLinks map[string]bool        // 需要链接的库（-l 的名字）
+
+	// --- -map（callmap.go） ---
+	optCalls map[string]CallMap // 调用的全名 -> 翻译成的 C 代码
+
+	// --- 扩展（plugin.go）：翻译开始时注册表的快照 ---
+	nodeHandlers map[string]Handler     // 节点类型 -> handler
+	callHandlers map[string]callHandler // 调用的全名 -> handler 与结果类型
+
+	// --- 虚方法分派 ---
+	funcParamTypes  map[string][]string // 顶层函数名（方法为 类名.方法名，不含 self）-> 参数类型（按位置）
+	preClassBases   map[string]string   // 预扫描得到的 类名 -> 父类名，代码生成前可用
+	preClassMethods map[string][]string // 预扫描得到的 类名 -> 自身定义的方法
+	virtualIntro    map[string]string   // 类名.方法名 -> 引入该虚方法槽位的类
+	vtableSlots     map[string][]string // 类名 -> 该类引入的虚方法槽位
+	polyRoot        map[string]string   // 多态层次中的类 -> 层次的根类
+
+	// --- 纯函数分析状态 ---
+	funcPurity map[string]string                 // 函数名（方法为 类名.方法名）-> 不纯的原因，纯函数为空串
+	jsonFuncs  map[string]bool                   // 返回 JSON 值（PyJson*）的顶层函数
+	funcNodes  map[string]map[string]interface{} // 顶层函数名 -> FunctionDef 节点，供常量折叠求值
+
+	// --- 生成器函数（yield.go） ---
+	genFuncs map[string]*genFunc // 有 yield 的顶层函数
+	curGen   *genFunc            // 正在生成的生成器函数体，其他时候为 nil
+
+	// --- itertools 与 functools（itertools.go、functional.go） ---
+	importNames map[string]string // 顶层 import 绑定的 itertools / functools 等模块的名字：本地名 -> 全名
+
+	// --- @lru_cache（memo.go） ---
+	memoFuncs map[string]*memoFunc // 带缓存的顶层函数
+
+	// --- NamedTuple 与 Enum（records.go） ---
+	records map[string]*record    // 改写为普通类的 NamedTuple
+	enums   map[string]*enumClass // 翻译为 C 的 enum 的类
+
+	// --- deque、Counter 与 defaultdict（collections.go） ---
+	collections map[string]*collection // 用到的容器类型：C 的类型名 -> 元素（键、值）类型
+
+	// --- heapq 与 bisect（heapq.go、bisect.go） ---
+	listFuncs map[string]bool // 已生成的列表的比较、堆与二分查找函数
+
+	// --- re（re.go） ---
+	rePatterns map[string]*rePattern // 转换过的模式：标志:Python 的模式 -> 模式
+
+	// --- argparse（argparse.go） ---
+	argParser *argParser // 程序中的 ArgumentParser，没有时为 nil
+
+	// --- 翻译诊断 ---
+	diagnostics []Diagnostic
+	diagSeen    map[Diagnostic]bool    // 同一节点可能被翻译多次（推断类型、内联等），只记一次
+	renames     []Rename               // 改了名字的标识符，见 names.go
+	diagStmt    map[string]interface{} // 正在翻译的语句，表达式节点没有位置时用它的位置
+	panicNode   map[string]interface{} // 代码生成出错（panic）时最内层有位置的节点
+
+	// --- 覆盖率，见 coverage.go ---
+	covStmts   map[string]bool // 翻译时遇到的 Python 语句（文件:行:列:类型）
+	covDropped map[string]bool // 其中报告了错误的语句
+	covStmt    string          // 正在翻译的最内层语句
+
+	// --- 常量折叠、异常、源码位置 ---
+	foldBudget int               // 单次折叠允许执行的语句数，防止编译期死循环
+	excBases   map[string]string // 异常类型的继承关系（子类 -> 父类），从内置异常类型 builtinExcBases 开始，加上用户定义的异常类
+	pySource   []string          // 原 Python 源码的各行（py2ast.py 写在 Module 的 source 字段；没有时注释只给出行号）
+	pyComments *pyComments       // -comments 时当前模块的注释
+	pyFile     string            // 当前翻译的 Python 源文件名，写进 #line 与行号注释
+}
+
+// toC: recursively convert ASTNode to C code
+// toC：递归将AST节点转为C代码
+func (g *generator) toC(node ASTNode, indent int) string {
+	typeStr, _ := node["_type"].(string)
+	defer func() {
+		// 出错时记下最内层有位置的节点，见 panicSite
+		if r := recover(); r != nil {
+			if g.panicNode == nil && node["lineno"] != nil {
+				g.panicNode = node
+			}
+			panic(r)
+		}
+	}()
+	if pyStmtTypes[typeStr] && node["lineno"] != nil {
+		defer g.coverStmt(node)()
+	}
+	if statementTypes[typeStr] {
+		// 语句中的表达式可能产生需要提前执行的代码，放在语句之前
+		saved, savedPost, savedStmt := g.pendingPre, g.pendingPost, g.diagStmt
+		g.pendingPre, g.pendingPost, g.diagStmt = nil, nil, node
+		code := g.nodeToC(node, indent)
+		pre, post := g.pendingPre, g.pendingPost
+		g.pendingPre, g.pendingPost, g.diagStmt = saved, savedPost, savedStmt
+		mark := g.lineMark(node, indent)
+		if len(pre) > 0 && g.optLineMap == "directive" {
+			code = mark + code // 提前执行的代码占了几行，语句本身再标一次
+		}
+		return g.annotation(node, indent) + mark + formatPre(pre, indent) + code + formatPre(post, indent)
+	}
+	if annotatedTypes[typeStr] {
+		return g.annotation(node, indent) + g.lineMark(node, indent) + g.nodeToC(node, indent)
+	}
+	if pyStmtTypes[typeStr] && typeStr != "FunctionDef" && typeStr != "ClassDef" {
+		// pass、global 等：只有 -comments 的注释（函数与类的注释在定义之前）
+		return g.comments(node, indent) + g.nodeToC(node, indent)
+	}
+	return g.nodeToC(node, indent)
+}
+
+// nodeToC: 按节点类型分派到各个 handler
+// nodeToC：按节点类型分派到各个处理函数
+func (g *generator) nodeToC(node ASTNode, indent int) string {
+	typeStr, _ := node["_type"].(string)
+	if code, ok := g.pluginNode(typeStr, node, indent); ok {
+		return code
+	}
+	switch typeStr {
+	case "Assign":
+		return g.handleAssign(node, indent)
+	case "AugAssign":
+		return g.handleAugAssign(node, indent)
+	case "Call":
+		return g.handleCall(node, indent)
+	case "FunctionDef":
+		return g.handleFunctionDef(node, indent)
+	case "ClassDef":
+		return g.handleClassDef(node, indent)
+	case "Return":
+		return g.handleReturn(node, indent)
+	case "Expr":
+		return g.handleExpr(node, indent)
+	case "If":
+		return g.handleIf(node, indent)
+	case "For":
+		return g.handleFor(node, indent)
+	case "While":
+		return g.handleWhile(node, indent)
+	case "Break":
+		return g.handleBreak(node, indent)
+	case "Continue":
+		return g.handleContinue(node, indent)
+	case "Pass":
+		return handlePass(node, indent)
+	case "Global":
+		return g.handleGlobal(node, indent)
+	case "List":
+		return g.handleList(node, indent)
+	case "Dict":
+		return g.handleDict(node, indent)
+	case "Attribute":
+		return g.handleAttribute(node, indent)
+	case "Name":
+		return g.handleName(node, indent)
+	case "Constant":
+		return handleConstant(node, indent)
+	case "Import":
+		return g.handleImport(node, indent)
+	case "ImportFrom":
+		return g.handleImportFrom(node, indent)
+	case "With":
+		return g.handleWith(node, indent)
+	case "Try":
+		return g.handleTry(node, indent)
+	case "AsyncFunctionDef":
+		return handleAsyncFunctionDef(node, indent)
+	case "Await":
+		return handleAwait(node, indent)
+	case "Compare":
+		return g.handleCompare(node, indent)
+	case "BinOp":
+		return g.handleBinOp(node, indent)
+	case "UnaryOp":
+		return g.handleUnaryOp(node, indent)
+	case "Subscript":
+		return g.handleSubscript(node, indent)
+	case "JoinedStr":
+		return g.handleJoinedStr(node, indent)
+	case "Delete":
+		return g.handleDelete(node, indent)
+	case "Raise":
+		return g.handleRaise(node, indent)
+	case "IfExp":
+		return g.handleIfExp(node, indent)
+	case "BoolOp":
+		return g.handleBoolOp(node, indent)
+	default:
+		return g.handleUnsupported(node, indent)
+	}
+}
+
+// isPow: check if node is a pow operation
+// isPow：判断节点是否为幂运算
+func isPow(node interface{}) bool {
+	n, ok := node.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	if n["_type"] == "BinOp" && n["op"].(map[string]interface{})["_type"] == "Pow" {
+		return true
+	}
+	// 递归检查左右
+	if n["_type"] == "BinOp" {
+		return isPow(n["left"]) || isPow(n["right"])
+	}
+	return false
+}
+
+// containsStr: check if a string slice contains s
+// containsStr：字符串切片中是否包含 s
+func containsStr(arr []string, s string) bool {
+	for _, a := range arr {
+		if a == s {
+			return true
+		}
+	}
+	return false
+}
+
+// join: join string array with separator
+// join：用分隔符拼接字符串数组
+func join(arr []string, sep string) string {
+	// 大模块有成千上万个函数，逐个 += 是平方级的复制
+	return strings.Join(arr, sep)
+}
+
+// --- getType: 整数字面量及整数之间的 + - * % 为 int，其余数字为 double ---
+func (g *generator) getType(node interface{}) string {
+	if node == nil {
+		return "char*"
+	}
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return "char*"
+	}
+	if t := g.enumExprType(m); t != "" {
+		return t
+	}
+	var ret string
+	switch m["_type"] {
+	case "Constant":
+		v := m["value"]
+		switch v := v.(type) {
+		case json.Number:
+			ret = "double"
+			if isIntLiteral(v) {
+				ret = "int"
+			}
+		case float64:
+			ret = "double"
+		case int:
+			ret = "int"
+		case string:
+			ret = "char*"
+		case bool:
+			ret = "int"
+		}
+	case "UnaryOp":
+		// 取负/取反保持操作数的整型，其余一律 double
+		if op, _ := m["op"].(map[string]interface{}); op["_type"] == "Not" || g.getType(m["operand"]) == "int" {
+			ret = "int"
+		} else {
+			ret = "double"
+		}
+	case "BinOp":
+		// 字符串拼接仍为 char*；整数之间的 + - * % 在 C 中也是 int，其余算术结果为 double
+		lt, rt := g.getType(m["left"]), g.getType(m["right"])
+		op, _ := m["op"].(map[string]interface{})
+		switch {
+		case lt == "char*" && rt == "char*":
+			ret = "char*"
+		case lt == "int" && rt == "int" && intBinOps[fmt.Sprint(op["_type"])]:
+			ret = "int"
+		default:
+			ret = "double"
+		}
+	case "Compare":
+		ret = "int"
+	case "IfExp":
+		// 两个分支类型不同时取 double（数值）
+		ret = g.getType(m["body"])
+		if other := g.getType(m["orelse"]); other != ret && ret != "char*" && other != "char*" {
+			ret = "double"
+		}
+	case "BoolOp":
+		ret = "int"
+		if !isBoolExpr(m) {
+			// and/or 的值是某个操作数
+			values, _ := m["values"].([]interface{})
+			ret = g.getType(values[0])
+			for _, v := range values[1:] {
+				if t := g.getType(v); t != ret {
+					ret = "double"
+				}
+			}
+		}
+	case "Name":
+		id := m["id"].(string)
+		if _, t := g.stdlibAttr(g.qualifiedCallName(m)); t != "" {
+			ret = t
+		} else if sym := g.lookupVar(id); sym != nil {
+			ret = sym.typ
+		} else {
+			ret = "double"
+		}
+	case "Call":
+		if fn, ok := m["func"].(map[string]interface{}); ok {
+			args, _ := m["args"].([]interface{})
+			if t, ok := g.pluginCallType(fn); ok {
+				return t
+			}
+			if _, cm := g.callMapOf(fn); cm != nil {
+				return g.mappedCallType(cm)
+			}
+			if q := g.qualifiedCallName(fn); (q == "copy.copy" || q == "copy.deepcopy") && len(args) == 1 {
+				// 拷贝的类型与原对象相同
+				return g.getType(args[0])
+			} else if t := g.stdlibCallType(q); t != "" {
+				return t
+			} else if t := g.ctypesCallType(q, fn); t != "" {
+				return t
+			}
+			if g.functionalCall(m) == "reduce" {
+				if acc, _ := g.reduceType(m); acc != "" {
+					return acc
+				}
+			}
+			if id, _ := fn["id"].(string); fn["_type"] == "Name" && id == "list" && g.funcNodes[id] == nil && len(args) == 1 && g.functionalCall(args[0]) != "" {
+				// list(map(...)) / list(filter(...))，见 functional.go
+				if elem := g.functionalElemType(args[0].(map[string]interface{}), g.getType); elem != "" {
+					return g.listType(elem)
+				}
+			}
+			if r, _ := g.recordReplace(m); r != nil {
+				return g.getType(r) + "*" // 构造调用的结果是堆上对象的指针
+			}
+			if c, _ := g.collectionCall(m); c != nil {
+				return c.name + "*"
+			}
+			if t := g.collectionMethodType(fn); t != "" && fn["_type"] == "Attribute" {
+				return t
+			}
+			if t := g.heapqPop(m); t != "" {
+				return t
+			}
+			if t := g.bisectType(fn); t != "" {
+				return t
+			}
+			if t := g.reCallType(fn); t != "" {
+				return t
+			}
+			if t := g.argparseType(m); t != "" {
+				return t
+			}
+			if fn["_type"] == "Lambda" {
+				var types []string
+				for _, a := range args {
+					types = append(types, g.getType(a))
+				}
+				return g.lambdaType(fn, types)
+			}
+			if fn["_type"] == "Attribute" && g.getType(fn["value"]) == "PyDateTime" {
+				return "char*"
+			}
+			if fn["_type"] == "Attribute" && fn["attr"] == "get" && g.getType(fn["value"]) == "PyJson*" {
+				return "PyJson*"
+			}
+			if fn["_type"] == "Name" && fn["id"] == "len" {
+				return "int"
+			}
+			if fn["_type"] == "Name" && fn["id"] == "open" {
+				return "FILE*"
+			}
+			if id, _ := fn["id"].(string); fn["_type"] == "Name" && conversionType[id] != "" && g.funcNodes[id] == nil {
+				return conversionType[id]
+			}
+			if id, _ := fn["id"].(string); fn["_type"] == "Name" && g.funcNodes[id] == nil {
+				if t := g.numBuiltinType(id, args); t != "" {
+					return t
+				}
+			}
+			if fn["_type"] == "Attribute" && g.getType(fn["value"]) == "FILE*" {
+				if t := g.fileMethodType(fn["attr"].(string)); t != "" {
+					return t
+				}
+			}
+			if fn["_type"] == "Attribute" && g.isStrValue(fn["value"]) {
+				if t := g.strMethodType(fn["attr"].(string)); t != "" {
+					return t
+				}
+			}
+			if fn["_type"] == "Attribute" && fn["attr"] == "join" && g.getType(fn["value"]) == "char*" {
+				return "char*"
+			}
+			if elem, ok := g.listElemType(g.getType(fn["value"])); ok && fn["_type"] == "Attribute" {
+				switch fn["attr"] {
+				case "pop":
+					return elem
+				case "copy":
+					return g.getType(fn["value"])
+				}
+			}
+			if fn["_type"] == "Attribute" {
+				// 方法调用：按接收者的类在方法登记表中查返回类型
+				method, _ := fn["attr"].(string)
+				if owner := g.resolveMethodClass(g.receiverClass(fn["value"]), method); owner != "" {
+					if sig, ok := g.methodSigs[owner+"."+method]; ok && sig.ret != "void" {
+						ret = sig.ret
+					} else if t := g.annotReturns[owner+"."+method]; !ok && t != "" {
+						if g.annotClasses[t] {
+							t += "*"
+						}
+						ret = t // 还没有生成的方法：用注解或推断出的返回类型
+					} else if t := g.inferReturns[owner+"."+method]; !ok && t != "" {
+						ret = t
+					} else if s := g.inferScopes[owner+"."+method]; !ok && s != nil && funcHasReturn(s.body) {
+						g.inferPending = true
+					}
+				}
+			}
+			if fn["_type"] == "Name" {
+				fname := fn["id"].(string)
+				if g.classStructsMap[fname] || g.annotClasses[fname] {
+					ret = fname // 分析阶段类还没有生成
+				}
+				if spec := g.externs[fname]; spec != nil && spec.ret != "void" {
+					ret = spec.ret
+				} else if g.hasResultParam(fname) {
+					ret = g.funcResultTypes[fname]
+				} else if t := g.inferReturns[fname]; t != "" {
+					ret = t // 还没有生成的函数：用推断出的返回类型
+				} else if s := g.inferScopes[fname]; s != nil && s.fn && funcHasReturn(s.body) && ret == "" {
+					g.inferPending = true
+				}
+			}
+		}
+	case "Attribute":
+		// 对象字段：按接收者的类查字段类型
+		attr, _ := m["attr"].(string)
+		if g.getType(m["value"]) == "PyDateTime" {
+			ret = "int"
+			break
+		}
+		if t := g.argparseType(m); t != "" {
+			ret = t
+			break
+		}
+		if _, t := g.stdlibAttr(g.qualifiedCallName(m)); t != "" {
+			ret = t
+			break
+		}
+		if t := g.classFieldType(g.receiverClass(m["value"]), attr); t != "" {
+			ret = t
+			break
+		}
+		if _, t := g.classAttrOwner(g.receiverClass(m["value"]), attr); t != "" {
+			ret = t
+			break
+		}
+		if owner := g.propertyOwner(g.receiverClass(m["value"]), attr); owner != "" {
+			ret = g.methodSigs[owner+".get_"+attr].ret
+			break
+		}
+		if cls := g.receiverClass(m["value"]); g.annotClasses[cls] && !g.classStructsMap[cls] {
+			// 类还没有生成：用推断出的字段类型，还没有时结果未定
+			if ret = g.inferFieldType(cls, attr); ret == "" {
+				g.inferPending = true
+			}
+			break
+		}
+		calls := false
+		walkCalls(m["value"], func(map[string]interface{}) { calls = true })
+		if calls {
+			break // 推断类型时不翻译调用：翻译有副作用，接收者还没有类型时会报错
+		}
+		obj := g.toC(m["value"].(map[string]interface{}), 0)
+		if sym := g.lookupVar(obj); sym != nil {
+			ret = sym.typ
+		}
+	case "Dict":
+		if g.isJSONDict(m) {
+			ret = "PyJson*"
+		}
+	case "List":
+		elts, _ := m["elts"].([]interface{})
+		elem := "double"
+		if t, _ := m["_elem"].(string); t != "" {
+			elem = t // x = [] 与 x = [1, 2]：按之后追加的元素推断，见 inferEmptyLists
+		} else if len(elts) > 0 {
+			elem = g.getType(elts[0])
+			for _, e := range elts[1:] {
+				if isNumericType(elem) && g.getType(e) == "double" {
+					elem = "double" // [1, 2.5]
+				}
+			}
+		}
+		if g.isClassType(elem) {
+			// [Sq(2), Circ(1)]：元素是各元素的类最近的共同祖先
+			classes := map[string]bool{}
+			for _, e := range elts {
+				classes[g.getType(e)] = true
+			}
+			if common := g.commonAncestor(classes); common != "" {
+				elem = common
+			}
+		}
+		ret = g.listType(elem)
+	case "Subscript":
+		if elem, ok := g.listElemType(g.getType(m["value"])); ok {
+			ret = elem
+			break
+		}
+		if field := g.recordField(m["value"], m["slice"]); field != nil {
+			ret = g.getType(field)
+			break
+		}
+		if c := g.collectionOf(g.getType(m["value"])); c != nil {
+			ret = c.value
+			break
+		}
+		if g.getType(m["value"]) == "PyJson*" {
+			ret = "PyJson*"
+			break
+		}
+		// 元组按常量下标取对应元素的类型
+		if elems, ok := g.tupleTypes[g.getType(m["value"])]; ok {
+			if i, ok := constIndex(m["slice"]); ok && i < len(elems) {
+				ret = elems[i]
+			}
+		}
+	}
+	if ret == "" {
+		ret = "char*"
+	}
+	return ret
+}
+
+// --- getPrintFmt: 数字统一用 %f ---
+func getPrintFmt(typ string) string {
+	switch typ {
+	case "char*":
+		return "%s"
+	case "int":
+		return "%d"
+	case "double":
+		return "%f"
+	default:
+		return "%f"
+	}
+}
+
+// --- 辅助：扫描 AST 收集所有函数调用参数类型 ---
+func (g *generator) collectFuncArgTypes(node interface{}) {
+	if root, ok := node.(ASTNode); ok {
+		node = map[string]interface{}(root)
+	}
+	g.collectScopedFuncArgTypes(node, "")
+}
+
+// --- collectScopedFuncArgTypes: 按作用域收集，实参为对象变量时记录其类名 ---
+func (g *generator) collectScopedFuncArgTypes(node interface{}, scope string) {
+	n, ok := node.(map[string]interface{})
+	if !ok {
+		if arr, ok := node.([]interface{}); ok {
+			for _, elem := range arr {
+				g.collectScopedFuncArgTypes(elem, scope)
+			}
+		}
+		return
+	}
+	switch n["_type"] {
+	case "FunctionDef":
+		name, _ := n["name"].(string)
+		if strings.HasSuffix(scope, ".") {
+			scope += name // 方法：类名.方法名
+		} else {
+			scope = name
+		}
+	case "ClassDef":
+		name, _ := n["name"].(string)
+		scope = name + "."
+	}
+	if kind := g.functionalCall(n); n["_type"] == "Call" && kind != "" {
+		// map(f, xs) 等：f 以元素为参数调用（reduce 时是累加器与元素），见 functional.go
+
+		args, _ := n["args"].([]interface{})
+		fn := map[string]interface{}{}
+		if len(args) > 1 {
+			fn, _ = args[0].(map[string]interface{})
+		}
+		if id, _ := fn["id"].(string); fn["_type"] == "Name" && g.funcNodes[id] != nil {
+			typeOf := func(e interface{}) string { return g.typeIn(scope, e) }
+			elem := g.iterElemType(args[1].(map[string]interface{}), typeOf)
+			argTypes := []string{elem}
+			if kind == "reduce" {
+				acc := elem
+				if len(args) > 2 {
+					acc = typeOf(args[2])
+				}
+				argTypes = []string{acc, elem}
+			}
+			if elem != "" {
+				g.funcArgTypes[id] = append(g.funcArgTypes[id], argTypes)
+			}
+		}
+	}
+	if n["_type"] == "Call" {
+		if fn, ok := n["func"].(map[string]interface{}); ok && fn["_type"] == "Name" {
+			fname, _ := fn["id"].(string)
+			argTypes, initTypes := []string{}, []string{} // 构造函数的实参中对象按指针传递，列表不改写
+			if args, ok := n["args"].([]interface{}); ok {
+				for _, a := range args {
+					t := g.typeIn(scope, a)
+					it := t
+					if g.ctorClass(a) != "" {
+						it += "*"
+					}
+					if am, ok := a.(map[string]interface{}); ok && am["_type"] == "Name" {
+						id, _ := am["id"].(string)
+						if cls, ok := g.objectVars[scope][id]; ok {
+							t, it = cls, cls+"*"
+						}
+						if lt, ok := g.listVars[scope][id]; ok {
+							t = lt
+						}
+					}
+					argTypes, initTypes = append(argTypes, t), append(initTypes, it)
+				}
+			}
+			g.funcArgTypes[fname] = append(g.funcArgTypes[fname], argTypes)
+			g.classInitArgTypes[fname] = append(g.classInitArgTypes[fname], initTypes)
+		}
+		if fn, ok := n["func"].(map[string]interface{}); ok && fn["_type"] == "Attribute" {
+			// 类名.静态方法(...) 与 对象.方法(...)：按 类名.方法名 登记，实参为对象变量时记录其类名
+			recv, _ := fn["value"].(map[string]interface{})
+			id, _ := recv["id"].(string)
+			cls := ""
+			if g.annotClasses[id] {
+				cls = id
+			} else if c, ok := g.objectVars[scope][id]; ok && recv["_type"] == "Name" {
+				cls = c
+			} else if i := strings.Index(scope, "."); id == "self" && i > 0 {
+				cls = scope[:i]
+			}
+			if cls != "" {
+				argTypes := []string{}
+				args, _ := n["args"].([]interface{})
+				for _, a := range args {
+					t := g.typeIn(scope, a)
+					if am, ok := a.(map[string]interface{}); ok && am["_type"] == "Name" {
+						arg, _ := am["id"].(string)
+						if c, ok := g.objectVars[scope][arg]; ok && !g.annotClasses[id] {
+							t = c
+						} else if c := g.inferVars[scope][arg]; g.annotClasses[id] && g.isClassType(c) {
+							t = strings.TrimSuffix(c, "*") + "*" // 静态方法的参数：对象按指针传递
+						}
+					}
+					argTypes = append(argTypes, t)
+				}
+				key := fmt.Sprintf("%v.%v", cls, fn["attr"])
+				g.funcArgTypes[key] = append(g.funcArgTypes[key], argTypes)
+			}
+		}
+	}
+	for _, v := range n {
+		g.collectScopedFuncArgTypes(v, scope)
+	}
+}
+
+// --- 翻译诊断 ---
+// 不支持的写法在输出中成为注释，同时记下 Python 源码中的位置，随翻译结果一起返回
+
+// 诊断的级别
+const (
+	logError = iota
+	logWarn
+)
+
+// Diagnostic: 一条翻译诊断
+type Diagnostic struct {
+	Severity string `json:"severity"` // error：代码没有翻译；warning：翻译了但可能与 Python 不同
+	File     string `json:"file"`
+	Node     string `json:"node,omitempty"` // 报告所在的 AST 节点类型
+	Line     int    `json:"line"`           // 0 表示位置未知
+	Col      int    `json:"col"`            // 从 1 开始
+	Message  string `json:"message"`
+}
+
+// report: 记下当前文件中 node 处的诊断
+func (g *generator) report(level int, node interface{}, format string, args ...interface{}) {
+	g.addDiag(level, g.pyFile, node, fmt.Sprintf(format, args...))
+}
+
+// addDiag: 记下 file 中 node 处（没有行号时取所在语句）的诊断
+func (g *generator) addDiag(level int, file string, node interface{}, msg string) {
+	m, ok := node.(map[string]interface{})
+	if n, isAST := node.(ASTNode); isAST {
+		m, ok = n, true
+	}
+	if !ok || m["lineno"] == nil {
+		m = g.diagStmt
+	}
+	d := Diagnostic{Severity: "warning", File: file, Message: msg}
+	if level == logError {
+		d.Severity = "error"
+	}
+	if m != nil {
+		d.Node, _ = m["_type"].(string)
+		d.Line, _ = strconv.Atoi(fmt.Sprint(m["lineno"]))
+		d.Col, _ = strconv.Atoi(fmt.Sprint(m["col_offset"]))
+		d.Col++
+	}
+	if !g.diagSeen[d] {
+		g.diagSeen[d] = true
+		g.diagnostics = append(g.diagnostics, d)
+		if level == logError && g.covStmt != "" {
+			g.covDropped[g.covStmt] = true
+		}
+	}
+}
+
+// unsupportedStmt: 不能翻译的语句，输出中留下 // 注释（-stub-unsupported 时为 stub.go 的调用）
+func (g *generator) unsupportedStmt(node interface{}, pad, what string) string {
+	g.report(logError, node, "unsupported %s", what)
+	if g.optStubs {
+		return pad + g.notImplemented(node, what) + "; // unsupported " + what + "\n"
+	}
+	return pad + "// unsupported " + what + "\n"
+}
+
+// unsupportedExpr: 不能翻译的表达式，输出中留下 /* */ 注释（-stub-unsupported 时为 stub.go 的调用）
+func (g *generator) unsupportedExpr(node interface{}, what string) string {
+	g.report(logError, node, "unsupported %s", what)
+	if g.optStubs {
+		return g.stubExpr(node, what)
+	}
+	return "/* unsupported " + what + " */"
+}
+
+// analyzeProgram: 代码生成前的各遍分析
+func (g *generator) analyzeProgram(root ASTNode) {
+	g.tracef("running the analysis passes")
+	g.symtab = newSymbolTable(scopeModule, "", nil) // 每次主函数重置
+	g.funcDefs = []string{}                         // 每次主函数重置
+	g.irFuncs = nil                                 // 每次主函数重置
+	g.classStructs = []string{}                     // 每次主函数重置
+	g.funcArgTypes = map[string][][]string{}        // 每次主函数重置
+	g.collectImports(root)                          // import 的 itertools / functools 等模块的名字，见 itertools.go
+	g.lowerRecords(root)                            // NamedTuple 改写为普通的类，登记 Enum 类，见 records.go
+	g.stripTypingOnly(root)                         // 去掉 if TYPE_CHECKING 块与 @overload 桩，登记类型注解
+	g.selectFunctions(root)                         // -only / -exclude：没有选中的函数只输出原型，见 select.go
+	g.checkUnbound(root)                            // 使用前没有赋值、没有定义的名字，见 unbound.go（重复的定义还在）
+	g.checkRedefinitions(root)                      // 重复定义的函数、类与方法，给函数名赋值
+	g.mangleNames(root)                             // 与 C 关键字、C 库、生成代码冲突的名字改名，见 names.go
+	g.collectExterns(root)                          // @py2c.extern：由已有的 C 函数实现的函数，见 extern.go
+	g.collectCtypes(root)                           // ctypes.CDLL 载入的库与 argtypes / restype，见 ctypes.go
+	g.collectArgparse(root)                         // ArgumentParser 与 add_argument，见 argparse.go
+	g.optimize(root)                                // -O：常量折叠，去掉不会执行的分支与语句
+	g.collectExceptions(root)                       // 异常类与 try/raise 的使用
+	g.lowerClassMethods(root)                       // 静态方法/类方法去掉 self/cls 参数
+	g.analyzeEscapes(root)                          // 逃逸分析：决定对象分配在栈上还是堆上
+	g.analyzeVirtuals(root)                         // 找出被子类重写的方法，生成虚表
+	g.collectListVars(root, "")                     // 列表变量的类型，调用点收集时需要
+	g.collectGenerators(root)                       // 有 yield 的顶层函数翻译为状态机，见 yield.go
+	g.collectFuncNodes(root)                        // 顶层函数的节点：推断 map(f, xs) 等时要知道 f 是程序中的函数
+	g.inferTypes(root)                              // 类型推断：函数与类构造函数调用的参数类型按推断出的变量类型收集
+	g.registerFuncResults(root)                     // 顶层函数的返回类型：调用可能在函数生成之前（前向调用、递归）
+	g.analyzePurity(root)                           // 纯函数分析：供常量折叠与输出注释使用
+	g.analyzeStatusFuncs(root)                      // -exceptions=status：找出可能抛出异常的函数
+	g.checkGenerators()                             // 生成器的值与局部变量的类型
+}
+
+// preamble: 生成代码开头的 #include（代码生成之后调用，才知道用到了哪些头文件）
+func (g *generator) preamble() string {
+	// @py2c.extern(header=) 的头文件：-freestanding 时也包含
+	user := ""
+	for _, h := range sortedKeys(g.userIncludes) {
+		user += fmt.Sprintf("#include \"%s\"\n", h)
+	}
+	if g.optFreestanding {
+		return user
+	}
+	code := ""
+	if g.usesPosix && g.optProfile != "arduino" {
+		// -std=c99 下 <time.h> 不声明 POSIX 函数
+		code += "#if !defined(_WIN32) && !defined(_XOPEN_SOURCE)\n#define _XOPEN_SOURCE 700\n#endif\n"
+	}
+	code += "#include <stdio.h>\n"
+	if g.usesPow {
+		code += "#include <math.h>\n"
+	}
+	for _, h := range sortedKeys(g.includes) {
+		code += fmt.Sprintf("#include <%s>\n", h)
+	}
+	if len(g.winIncludes) > 0 || len(g.posixIncludes) > 0 {
+		code += "#ifdef _WIN32\n"
+		for _, h := range sortedKeys(g.winIncludes) {
+			code += fmt.Sprintf("#include <%s>\n", h)
+		}
+		if len(g.posixIncludes) > 0 {
+			code += "#else\n"
+		}
+		for _, h := range sortedKeys(g.posixIncludes) {
+			code += fmt.Sprintf("#include <%s>\n", h)
+		}
+		code += "#endif\n"
+	}
+	code += user
+	if g.optProfile == "arduino" {
+		code += arduinoPreamble
+	}
+	return code + "\n"
+}
+
+// runtimeCode: 用到的运行时辅助函数，按名字排序（名字决定依赖顺序）
+func (g *generator) runtimeCode() string {
+	g.errCodeTable()
+	var code strings.Builder
+	for _, h := range sortedKeys(g.runtimeHelpers) {
+		code.WriteString(g.runtimeHelpers[h])
+	}
+	return code.String()
+}
+
+// mainSignature: 用到 sys.argv 时 main 带 argc/argv 参数
+func (g *generator) mainSignature() string {
+	if g.usesArgv {
+		return "int main(int argc, char** argv)"
+	}
+	return "int main()"
+}
+
+// --- 多模块翻译 ---
+// 多个 AST 文件（或一个目录下的所有 .json）一起翻译：先把对本地模块的 import 换成直接引用，
+// 合并后整体分析（跨模块调用的参数类型照常推断），再按模块拆分输出 模块名.c / 模块名.h。
+// 所有模块共用的 #include、运行时辅助函数和类型放在 py2c_runtime.h，其中的变量定义在主模块的 .c 里。
+
+const runtimeHeader = "py2c_runtime.h"
+
+// pyModule: 一个输入模块
+type pyModule struct {
+	name   string
+	file   string // Python 源文件，用于诊断与 #line
+	root   ASTNode
+	source []string
+	defs   map[string]bool // 顶层定义的函数和类
+	deps   []string        // import 的本地模块，按出现顺序
+	body   []interface{}   // 分析之后属于该模块的顶层语句
+}
+
+// ModuleName: 文件名去掉扩展名，即模块名（mymod.py、mymod.json、mymod.ast.json -> mymod）
+func ModuleName(path string) string {
+	base := filepath.Base(path)
+	if i := strings.Index(base, "."); i > 0 {
+		base = base[:i]
+	}
+	return base
+}
+
+var cIdent = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// resolveLocalImports: 去掉对本地模块的 import 语句，m.f 改为 f，from m import f as g 中的 g 改回 f；
+// 返回 import 的本地模块。其他 import（标准库）不变
+func (g *generator) resolveLocalImports(mod *pyModule, modules map[string]*pyModule) []string {
+	aliases := map[string]string{} // 本地名 -> 本地模块（import m as x）
+	renames := map[string]string{} // from m import f as g：g -> f
+	deps := []string{}
+	addDep := func(name string) {
+		if !containsStr(deps, name) {
+			deps = append(deps, name)
+		}
+	}
+	checkDef := func(m, name string, node map[string]interface{}) {
+		if !modules[m].defs[name] {
+			g.addDiag(logWarn, mod.file, node, fmt.Sprintf("%s.%s: only functions and classes of local modules can be imported", m, name))
+		}
+	}
+	// isLocal: import 语句是否只涉及本地模块，同时登记别名
+	isLocal := func(n map[string]interface{}) bool {
+		names, _ := n["names"].([]interface{})
+		switch n["_type"] {
+		case "Import":
+			for _, a := range names {
+				if modules[fmt.Sprint(a.(map[string]interface{})["name"])] == nil {
+					return false
+				}
+			}
+			for _, a := range names {
+				a := a.(map[string]interface{})
+				name, local := fmt.Sprint(a["name"]), fmt.Sprint(a["name"])
+				if as, ok := a["asname"].(string); ok {
+					local = as
+				}
+				aliases[local] = name
+				addDep(name)
+			}
+			return true
+		case "ImportFrom":
+			module, _ := n["module"].(string)
+			if module == "" {
+				// from . import m：导入的是模块本身
+				for _, a := range names {
+					if modules[fmt.Sprint(a.(map[string]interface{})["name"])] == nil {
+						return false
+					}
+				}
+				for _, a := range names {
+					a := a.(map[string]interface{})
+					name, local := fmt.Sprint(a["name"]), fmt.Sprint(a["name"])
+					if as, ok := a["asname"].(string); ok {
+						local = as
+					}
+					aliases[local] = name
+					addDep(name)
+				}
+				return true
+			}
+			if modules[module] == nil {
+				return false
+			}
+			addDep(module)
+			for _, a := range names {
+				a := a.(map[string]interface{})
+				name := fmt.Sprint(a["name"])
+				if name == "*" {
+					continue
+				}
+				checkDef(module, name, n)
+				if as, ok := a["asname"].(string); ok && as != name {
+					renames[as] = name
+				}
+			}
+			return true
+		}
+		return false
+	}
+	// 先去掉 import 语句并登记别名，再改写引用
+	var strip func(node interface{}) interface{}
+	strip = func(node interface{}) interface{} {
+		switch n := node.(type) {
+		case []interface{}:
+			kept := n[:0]
+			for _, e := range n {
+				if em, ok := e.(map[string]interface{}); ok && (em["_type"] == "Import" || em["_type"] == "ImportFrom") && isLocal(em) {
+					continue
+				}
+				kept = append(kept, strip(e))
+			}
+			return kept
+		case map[string]interface{}:
+			for k, v := range n {
+				n[k] = strip(v)
+			}
+		}
+		return node
+	}
+	var rewrite func(node interface{})
+	rewrite = func(node interface{}) {
+		switch n := node.(type) {
+		case []interface{}:
+			for _, e := range n {
+				rewrite(e)
+			}
+		case map[string]interface{}:
+			if n["_type"] == "Attribute" {
+				if v, _ := n["value"].(map[string]interface{}); v["_type"] == "Name" && aliases[fmt.Sprint(v["id"])] != "" {
+					// m.f -> f
+					attr := fmt.Sprint(n["attr"])
+					checkDef(aliases[fmt.Sprint(v["id"])], attr, n)
+					delete(n, "value")
+					delete(n, "attr")
+					n["_type"], n["id"] = "Name", attr
+					return
+				}
+			}
+			if n["_type"] == "Name" {
+				if orig, ok := renames[fmt.Sprint(n["id"])]; ok {
+					n["id"] = orig
+				}
+			}
+			for _, v := range n {
+				rewrite(v)
+			}
+		}
+	}
+	mod.root["body"] = strip(mod.root["body"])
+	rewrite(mod.root["body"])
+	return deps
+}
+
+// translateModules: 多模块翻译的入口，输出文件写在 -o 指定的目录，默认是主模块输入文件所在的目录。
+// 返回写出的 .c 文件和可执行文件的默认路径（主模块名）
+func (g *generator) translateModules(modules []*pyModule, mainModule string) (Output, error) {
+	byName := map[string]*pyModule{}
+	for _, m := range modules {
+		byName[m.name] = m
+	}
+	imported := map[string]bool{}
+	for _, m := range modules {
+		m.deps = g.resolveLocalImports(m, byName)
+		for _, d := range m.deps {
+			imported[d] = true
+		}
+	}
+	// 主模块：Options.MainModule；没有指定时是唯一没有被其他模块 import 的模块
+	entry := byName[mainModule]
+	if mainModule == "" {
+		roots := []string{}
+		for _, m := range modules {
+			if !imported[m.name] {
+				roots = append(roots, m.name)
+			}
+		}
+		if len(roots) != 1 {
+			return Output{}, fmt.Errorf("cannot tell the main module: modules not imported by any other: [%s]; list the input files with the main module first", join(roots, ", "))
+		}
+		entry = byName[roots[0]]
+	} else if entry == nil {
+		return Output{}, fmt.Errorf("main module %s is not among the modules", mainModule)
+	}
+	// 被 import 的模块在前（Python 在 import 时执行模块代码），主模块最后
+	ordered := []*pyModule{}
+	seen := map[string]bool{entry.name: true}
+	var visit func(m *pyModule)
+	visit = func(m *pyModule) {
+		if seen[m.name] {
+			return
+		}
+		seen[m.name] = true
+		for _, d := range m.deps {
+			visit(byName[d])
+		}
+		ordered = append(ordered, m)
+	}
+	for _, d := range entry.deps {
+		visit(byName[d])
+	}
+	for _, m := range modules {
+		visit(m)
+	}
+	ordered = append(ordered, entry)
+
+	// 合并成一个程序分析；顶层语句标上所属模块，分析之后按标记拆回
+	merged := []interface{}{}
+	for _, m := range ordered {
+		body, _ := m.root["body"].([]interface{})
+		for _, s := range body {
+			if sm, ok := s.(map[string]interface{}); ok {
+				sm["_module"] = m.name
+			}
+			merged = append(merged, s)
+		}
+	}
+	root := ASTNode{"_type": "Module", "body": merged}
+	g.analyzeProgram(root)
+	owner := ordered[0].name
+	for _, s := range root["body"].([]interface{}) {
+		if sm, ok := s.(map[string]interface{}); ok && sm["_module"] != nil {
+			owner = fmt.Sprint(sm["_module"])
+		}
+		byName[owner].body = append(byName[owner].body, s)
+	}
+
+	// 逐个模块生成；记录每个模块生成的结构体/函数的范围
+	structEnd, funcEnd := map[string]int{}, map[string]int{}
+	code := map[string]string{}        // 模块的顶层代码：主模块在 main 中，其他模块在 模块名_module_init 中
+	globalOwner := map[string]string{} // 文件作用域变量 -> 所在模块
+	declareGlobals := func(m *pyModule) error {
+		// 函数中用到的模块变量是文件作用域变量（定义由 shareFileData 放在主模块的 .c 中），不是 模块名_module_init 的局部变量
+		if globals := g.declareGlobals(m.body); globals != "" {
+			g.classStructs = append(g.classStructs, globals)
+		}
+		for _, name := range sortedKeys(g.moduleScope().vars) {
+			if g.moduleScope().vars[name].storage != "global" {
+				continue
+			}
+			if owner, ok := globalOwner[name]; ok && owner != m.name {
+				return fmt.Errorf("module-level variable %s is used by functions in both %s and %s; names must be unique across modules", name, owner, m.name)
+			}
+			globalOwner[name] = m.name
+		}
+		return nil
+	}
+	for _, m := range ordered {
+		g.pySource, g.pyFile = m.source, m.file
+		if g.optComments {
+			g.pyComments = collectComments(m.root, m.source)
+		}
+		body := ""
+		if m == entry {
+			if err := declareGlobals(m); err != nil {
+				return Output{}, err
+			}
+			body = g.stmtsToC(m.body, 1)
+			body = formatPre(g.rcLocals, 1) + body + g.scopeExit(1)
+		} else {
+			restore := g.enterScope(scopeModule, m.name)
+			g.scopeIndent = 1
+			if err := declareGlobals(m); err != nil {
+				restore()
+				return Output{}, err
+			}
+			body = g.stmtsToC(m.body, 1)
+			body = formatPre(g.rcLocals, 1) + body + g.scopeExit(1)
+			restore()
+			if !hasCode(body) {
+				// 只有函数/类定义（和注释）：不需要初始化函数
+				body = ""
+			} else {
+				g.translatedFuncs[m.name+"_module_init"] = "<" + m.name + ">"
+			}
+		}
+		code[m.name] = body
+		structEnd[m.name], funcEnd[m.name] = len(g.classStructs), len(g.funcDefs)
+	}
+
+	// 共用头文件：结构体中非 static 的函数（方法等）只留原型，定义放到生成它的模块
+	shared := g.preamble() + g.runtimeCode()
+	defs := map[string]string{}
+	structStart, funcStart := 0, 0
+	for _, m := range ordered {
+		for _, s := range g.classStructs[structStart:structEnd[m.name]] {
+			rest, _, body := splitFuncDefs(s)
+			shared += rest
+			defs[m.name] += body
+		}
+		structStart = structEnd[m.name]
+	}
+	shared, data := shareFileData(shared)
+	files := map[string]string{}
+	files[runtimeHeader] = "#ifndef PY2C_RUNTIME_H\n#define PY2C_RUNTIME_H\n" +
+		"// every module includes this header: not all of the static helpers are used everywhere\n" +
+		"#if defined(__GNUC__)\n#pragma GCC diagnostic ignored \"-Wunused-function\"\n#endif\n" + shared + "#endif\n"
+	mainBody := ""
+	for _, m := range ordered {
+		guard := strings.ToUpper(m.name) + "_H"
+		header := fmt.Sprintf("#ifndef %s\n#define %s\n#include \"%s\"\n", guard, guard, runtimeHeader)
+		for _, d := range m.deps {
+			header += fmt.Sprintf("#include \"%s.h\"\n", d)
+		}
+		src := fmt.Sprintf("#include \"%s.h\"\n\n", m.name)
+		if m == entry {
+			src += data
+		}
+		src += defs[m.name]
+		for i := funcStart; i < funcEnd[m.name]; i++ {
+			doc, _, _ := docBefore(g.irFuncs[i].head)
+			header += doc + g.emit.emitPrototype(g.irFuncs[i])
+			src += g.funcDefs[i]
+		}
+		funcStart = funcEnd[m.name]
+		if m != entry && code[m.name] != "" {
+			header += fmt.Sprintf("void %s_module_init(void);\n", m.name)
+			src += fmt.Sprintf("void %s_module_init(void) {\n%s%s}\n", m.name, code[m.name], g.lineReset())
+			mainBody += fmt.Sprintf("    %s_module_init();\n", m.name)
+		}
+		if m == entry {
+			mainBody += code[m.name]
+			if g.usesArgv {
+				mainBody = g.sysArgvInit() + mainBody
+			}
+			src += g.mainSignature() + " {\n" + mainBody + g.lineReset() + "    return 0;\n}\n"
+		}
+		doc := g.docComment(m.root["body"], "")
+		if g.optComments {
+			g.pyComments = collectComments(m.root, m.source)
+		}
+		lead, tail := g.fileComments()
+		files[m.name+".h"] = doc + header + "#endif\n"
+		files[m.name+".c"] = lead + doc + g.renameLegend(src) + src + tail
+	}
+	out := Output{Files: files, Main: entry.name, Renames: g.renames, Unresolved: sortedKeys(g.unresolved), Libraries: sortedKeys(g.ctypesLinks), Coverage: g.coverage()}
+	if g.optCallGraph != "" {
+		graph, err := g.callGraph(g.optCallGraph, root, join(mapValues(files), ""))
+		if err != nil {
+			return Output{}, fmt.Errorf("call graph: %v", err)
+		}
+		out.CallGraph = graph
+	}
+	if err := g.arenaFiles(files, runtimeHeader); err != nil {
+		return Output{}, err
+	}
+	for name, src := range files {
+		files[name] = resolveLineResets(formatUnit(g.emit.emitUnit(src), g.optStyle), filepath.Join(g.optOutputDir, name))
+	}
+	g.buildFiles(files, entry.name)
+	return out, nil
+}
+
+// buildFiles: 按 Options.BuildFiles 加入 Makefile / CMakeLists.txt，列出生成的源文件、要链接的库和 C 标准
+func (g *generator) buildFiles(files map[string]string, exe string) {
+	srcs, headers := []string{}, []string{}
+	for _, name := range sortedKeys(files) {
+		if strings.HasSuffix(name, ".c") {
+			srcs = append(srcs, name)
+		} else {
+			headers = append(headers, name)
+		}
+	}
+	// 缺省的后端在运行时用到 C11 的 _Thread_local / _Noreturn 时要求 C11；-std 指定的方言与 Options.CStd 优先
+	std := "c99"
+	if source := join(mapValues(files), ""); strings.Contains(source, "_Thread_local") || strings.Contains(source, "_Noreturn") {
+		std = "c11"
+	}
+	if g.emit.std() != "" {
+		std = g.emit.std()
+	}
+	if g.optCStd != "" {
+		std = g.optCStd
+	}
+	libs := []string{}
+	if g.usesPow {
+		libs = append(libs, "-lm")
+	}
+	for _, l := range sortedKeys(g.ctypesLinks) {
+		if l != "m" || !g.usesPow {
+			libs = append(libs, "-l"+l)
+		}
+	}
+	threads := g.includes["pthread.h"]
+	for _, kind := range g.optBuildFiles {
+		switch kind {
+		case "make":
+			ldlibs := join(libs, " ")
+			if threads {
+				ldlibs = strings.TrimSpace(ldlibs + " -pthread")
+			}
+			files["Makefile"] = fmt.Sprintf(`# generated by py2c
+CFLAGS ?= -O2
+CFLAGS += -std=%[1]s
+LDLIBS = %[2]s
+SRCS = %[3]s
+OBJS = $(SRCS:.c=.o)
+
+%[4]s: $(OBJS)
+	$(CC) $(CFLAGS) -o $@ $(OBJS) $(LDLIBS)
+
+%%.o: %%.c %[5]s
+	$(CC) $(CFLAGS) -c -o $@ $<
+
+clean:
+	rm -f %[4]s $(OBJS)
+
+.PHONY: clean
+`, std, ldlibs, join(srcs, " "), exe, join(headers, " "))
+		case "cmake":
+			// CMake 把 C89 叫作 90
+			level := strings.TrimLeft(std, "cgnu")
+			if level == "89" {
+				level = "90"
+			}
+			code := fmt.Sprintf(`# generated by py2c
+cmake_minimum_required(VERSION 3.10)
+project(%[1]s C)
+set(CMAKE_C_STANDARD %[2]s)
+set(CMAKE_C_STANDARD_REQUIRED ON)
+set(CMAKE_C_EXTENSIONS %[3]s)
+add_executable(%[1]s %[4]s)
+`, exe, level, map[bool]string{true: "ON", false: "OFF"}[strings.HasPrefix(std, "gnu")], join(srcs, " "))
+			if g.usesPow {
+				code += fmt.Sprintf("if(NOT MSVC)\n    target_link_libraries(%s m)\nendif()\n", exe)
+			}
+			if threads {
+				code += fmt.Sprintf("find_package(Threads REQUIRED)\ntarget_link_libraries(%s Threads::Threads)\n", exe)
+			}
+			if len(g.ctypesLinks) > 0 {
+				code += fmt.Sprintf("target_link_libraries(%s %s)\n", exe, join(sortedKeys(g.ctypesLinks), " "))
+			}
+			files["CMakeLists.txt"] = code
+		}
+	}
+}
+
+// hasCode: 生成的代码中是否有注释以外的内容
+func hasCode(code string) bool {
+	for _, line := range strings.Split(code, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "//") && !isLineMark(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitFuncDefs: 把 code 中非 static 的函数定义换成原型。返回替换后的代码、原型以及拿出来的定义
+func splitFuncDefs(code string) (rest, protos, defs string) {
+	lines := strings.SplitAfter(code, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if !isFuncStart(line) {
+			rest += line
+			continue
+		}
+		// 函数前的 #line 跟着定义走，不留在头文件里
+		if lines := strings.SplitAfter(rest, "\n"); len(lines) > 1 && strings.HasPrefix(lines[len(lines)-2], "#line ") {
+			mark := lines[len(lines)-2]
+			rest = strings.TrimSuffix(rest, mark)
+			defs += mark
+		}
+		// 顶层函数的定义带一级缩进，结束的 } 与开头对齐
+		body := strings.TrimLeft(line, " ")
+		end := line[:len(line)-len(body)] + "}"
+		proto := strings.TrimSuffix(strings.TrimRight(body, "\n"), " {") + ";\n"
+		rest += proto
+		doc, _, _ := docBefore(strings.TrimSuffix(rest, proto))
+		protos += doc + proto
+		for ; i < len(lines); i++ {
+			defs += lines[i]
+			if strings.TrimRight(lines[i], "\n") == end {
+				break
+			}
+		}
+	}
+	return rest, protos, defs
+}
+
+// docBefore: code 末尾（其后只有单行注释与 #line）的 /** */ 文档注释，去掉缩进；
+// 返回注释与它在 code 中的范围，没有时注释为空
+func docBefore(code string) (doc string, start, end int) {
+	lines := strings.SplitAfter(code, "\n")
+	last := len(lines) - 1
+	for last >= 0 && (lines[last] == "" || strings.HasPrefix(lines[last], "#line ") || strings.HasPrefix(strings.TrimLeft(lines[last], " "), "// ") || strings.HasPrefix(strings.TrimLeft(lines[last], " "), "/* ")) {
+		// 纯度说明、-line-map 的位置注释等
+		last--
+	}
+	first := last
+	for first >= 0 && !strings.HasPrefix(strings.TrimLeft(lines[first], " "), "/**") {
+		if first < last && !strings.HasPrefix(strings.TrimLeft(lines[first], " "), "*") || first == last && !strings.HasSuffix(strings.TrimRight(lines[first], "\n"), "*/") {
+			return "", 0, 0
+		}
+		first--
+	}
+	if first < 0 || !strings.HasSuffix(strings.TrimRight(lines[last], "\n"), "*/") {
+		return "", 0, 0
+	}
+	start = len(strings.Join(lines[:first], ""))
+	end = start + len(strings.Join(lines[first:last+1], ""))
+	for _, l := range lines[first : last+1] {
+		l = strings.TrimLeft(l, " ")
+		if strings.HasPrefix(l, "*") {
+			l = " " + l
+		}
+		doc += l
+	}
+	return doc, start, end
+}
+
+// isFuncStart: 非 static 函数定义的第一行，如 "void f(double x) {"（if/for 等语句的括号前有空格，不会匹配）
+func isFuncStart(line string) bool {
+	line = strings.TrimRight(strings.TrimLeft(line, " "), "\n")
+	for _, p := range []string{"static ", "typedef ", "struct ", "enum ", "union ", "extern "} {
+		if strings.HasPrefix(line, p) {
+			return false
+		}
+	}
+	return funcStart.MatchString(line)
+}
+
+var funcStart = regexp.MustCompile(`^[A-Za-z_][\w\s*]*[\s*]\w+\(.*\) \{$`)
+
+// shareFileData: 头文件中的文件作用域变量（异常类型、异常帧栈、类属性等）改为 extern 声明，
+// 返回改写后的头文件和这些变量的定义（只在一个 .c 中出现，所有模块共用同一份）
+func shareFileData(code string) (string, string) {
+	rest, defs := "", ""
+	declared := map[string]bool{}
+	initialized := map[string]bool{}
+	pending := []string{} // 没有初始值的定义（static const T x; 之后可能还有带初始值的定义）
+	lines := strings.SplitAfter(code, "\n")
+	for _, line := range lines {
+		decl, init, ok := fileData(line)
+		if !ok {
+			rest += line
+			continue
+		}
+		if !declared[decl] {
+			declared[decl] = true
+			rest += "extern " + decl + ";\n"
+		}
+		if init == "" {
+			pending = append(pending, decl)
+			continue
+		}
+		initialized[decl] = true
+		defs += decl + " = " + init + ";\n"
+	}
+	tentative := ""
+	for _, decl := range pending {
+		if !initialized[decl] {
+			initialized[decl] = true
+			tentative += decl + ";\n"
+		}
+	}
+	if defs += tentative; defs != "" {
+		defs += "\n"
+	}
+	return rest, defs
+}
+
+// fileData: 解析文件作用域的变量定义，返回去掉 static 的声明部分和初始值
+func fileData(line string) (decl, init string, ok bool) {
+	line = strings.TrimRight(line, "\n")
+	if line == "" || !(line[0] == '_' || line[0] >= 'A' && line[0] <= 'Z' || line[0] >= 'a' && line[0] <= 'z') {
+		return "", "", false
+	}
+	for _, p := range []string{"typedef ", "struct ", "enum ", "union ", "extern ", "return "} {
+		if strings.HasPrefix(line, p) {
+			return "", "", false
+		}
+	}
+	if i := strings.Index(line, "; //"); i >= 0 {
+		line = line[:i+1]
+	}
+	if !strings.HasSuffix(line, ";") {
+		return "", "", false
+	}
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "static "), ";")
+	decl = line
+	if i := strings.Index(line, " = "); i >= 0 {
+		decl, init = line[:i], line[i+3:]
+	}
+	if strings.ContainsAny(decl, "(){}") {
+		return "", "", false
+	}
+	return decl, init, true
+}
+
+// --- -header：头文件 ---
+// 头文件中是 #include、类型定义、非 static 函数的原型和全局变量的 extern 声明，.c 文件包含它；
+// 顶层代码不生成 main，而是放到 名字_module_init()（名字取自头文件名），由已有的 C 程序调用。
+
+// headerOutput: optHeader 的内容与对应的 C 代码
+func (g *generator) headerOutput(mainBody string) (string, string, error) {
+	name := ModuleName(g.optHeader)
+	if !cIdent.MatchString(name) {
+		return "", "", fmt.Errorf("%s: %q is not a C identifier", g.optHeader, name)
+	}
+	initSig := fmt.Sprintf("void %s_module_init(void)", name)
+	if g.usesArgv {
+		initSig = fmt.Sprintf("void %s_module_init(int argc, char** argv)", name)
+	}
+	source, protos := g.runtimeCode(), ""
+	for _, s := range append(append([]string{}, g.classStructs...), g.funcDefs...) {
+		_, p, _ := splitFuncDefs(s)
+		protos += p
+		source += s
+	}
+	types, rest := splitTypes(source)
+	externs := ""
+	for _, line := range strings.SplitAfter(rest, "\n") {
+		if decl, _, ok := fileData(line); ok && !strings.HasPrefix(line, "static ") {
+			externs += "extern " + decl + ";\n"
+		} else if proto := strings.TrimLeft(line, " "); strings.HasPrefix(proto, "extern ") && strings.HasSuffix(proto, ");\n") {
+			// -only / -exclude 留给手写 C 代码的函数：实现它的文件也包含这个头文件
+			protos += proto
+		}
+	}
+	guard := strings.ToUpper(name) + "_H"
+	header := fmt.Sprintf("#ifndef %s\n#define %s\n%s%s%s%s%s;\n#endif\n", guard, guard, g.preamble(), types, externs, protos, initSig)
+	return header, fmt.Sprintf("#include \"%s\"\n\n%s%s {\n%s}\n", filepath.Base(g.optHeader), rest, initSig, mainBody), nil
+}
+
+// splitTypes: 拿出文件作用域的类型定义（typedef、struct、enum），返回类型定义和其余代码
+func splitTypes(code string) (types, rest string) {
+	lines := strings.SplitAfter(code, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if !strings.HasPrefix(line, "typedef ") && !strings.HasPrefix(line, "struct ") && !strings.HasPrefix(line, "enum ") {
+			rest += line
+			continue
+		}
+		// 类型前的文档注释跟着类型走
+		doc, start, end := docBefore(rest)
+		rest = rest[:start] + rest[end:]
+		types += doc + line
+		if !strings.HasSuffix(strings.TrimRight(line, "\n"), "{") {
+			continue
+		}
+		// 多行的定义到 "} 名字;" 或 "};" 结束
+		for i++; i < len(lines); i++ {
+			types += lines[i]
+			if strings.HasPrefix(lines[i], "}") {
+				break
+			}
+		}
+	}
+	return types, rest
+}
+
+// --- 辅助：判断函数是否有 return ---
+func funcHasReturn(body []interface{}) bool {
+	for _, stmt := range body {
+		if m, ok := stmt.(map[string]interface{}); ok && m["_type"] == "Return" && m["value"] != nil {
+			return true
+		}
+	}
+	return nestedReturn(body)
+}
+
+// nestedReturn: if/for/while/try 块里是否有带值的 return（同样要通过 result 返回）
+func nestedReturn(body []interface{}) bool {
+	for _, stmt := range body {
+		m, _ := stmt.(map[string]interface{})
+		switch m["_type"] {
+		case "If", "For", "While", "With", "Try":
+		default:
+			continue
+		}
+		inner := []interface{}{}
+		for _, k := range []string{"body", "orelse", "finalbody"} {
+			l, _ := m[k].([]interface{})
+			inner = append(inner, l...)
+		}
+		handlers, _ := m["handlers"].([]interface{})
+		for _, h := range handlers {
+			inner = append(inner, h.(map[string]interface{})["body"].([]interface{})...)
+		}
+		for _, s := range inner {
+			if r, _ := s.(map[string]interface{}); r["_type"] == "Return" && r["value"] != nil {
+				return true
+			}
+		}
+		if nestedReturn(inner) {
+			return true
+		}
+	}
+	return false
+}
+
+// --- handleFunctionDef: 所有函数声明为 void，有返回值时加 result 指针参数 ---
+func (g *generator) handleFunctionDef(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	name, _ := node["name"].(string)
+	if spec := g.externs[name]; spec != nil && node["_cextern"] == true {
+		g.externDecl(name, spec, node)
+		return ""
+	}
+	defer g.enterScope(scopeFunction, name)()
+	g.symtab.locals = localNames(node["body"].([]interface{}))
+	args, _ := node["args"].(map[string]interface{})
+	f := &irFunc{name: name, ret: "void", indent: indent}
+	argTypes := map[string]string{}
+	if argCalls, ok := g.funcArgTypes[name]; ok && len(argCalls) > 0 {
+		maxArgs := 0
+		for _, call := range argCalls {
+			if len(call) > maxArgs {
+				maxArgs = len(call)
+			}
+		}
+		for i := 0; i < maxArgs; i++ {
+			typesSet := map[string]bool{}
+			for _, call := range argCalls {
+				if i < len(call) {
+					typesSet[call[i]] = true
+				}
+			}
+			typeStr := "double"
+			if len(typesSet) == 1 {
+				for t := range typesSet {
+					typeStr = t
+				}
+			} else {
+				typeStr = "double"
+			}
+			// 对象按引用传递（与 Python 语义一致），多个类时取共同祖先实现多态
+			if cls := g.commonAncestor(typesSet); cls != "" {
+				typeStr = cls + "*"
+			}
+			argTypes[fmt.Sprintf("arg%d", i)] = typeStr
+		}
+	}
+	if argsList, ok := args["args"].([]interface{}); ok {
+		for i, arg := range argsList {
+			argName := arg.(map[string]interface{})["arg"].(string)
+			argType := "double"
+			if t, ok := argTypes[fmt.Sprintf("arg%d", i)]; ok && t != "" {
+				argType = t
+			}
+			if t := g.annotParam(name, i); t != "" {
+				// 显式注解优先于调用点推断；对象参数按指针传递
+				argType = t
+				if g.annotClasses[t] {
+					argType = t + "*"
+				}
+			}
+			f.params = append(f.params, irParam{argName, argType})
+			g.declareParam(argName, argType)
+			g.funcParamTypes[name] = append(g.funcParamTypes[name], argType)
+		}
+	}
+	g.tracef("handleFunctionDef: name=%s, argTypes=%#v, params=%v", name, argTypes, f.params)
+	if gen := g.genFuncs[name]; gen != nil && gen.reason == "" {
+		return g.generatorDef(node, f, gen)
+	}
+	bodyList, _ := node["body"].([]interface{})
+	hasRet := funcHasReturn(bodyList)
+	tupleRet := hasRet && returnsTuple(bodyList)
+	if hasRet && !tupleRet {
+		f.result = g.funcResultType(name, bodyList)
+		g.funcResultTypes[name] = f.result
+	}
+	if node["_extern"] == true {
+		// 由手写的 C 代码提供：只输出原型
+		g.translatedFuncs[name] = name
+		if g.statusFuncs[name] {
+			f.ret = "int"
+		}
+		g.irFuncs = append(g.irFuncs, f)
+		g.funcDefs = append(g.funcDefs, g.externFunc(f, node, pad))
+		g.forwardPrototypes(f)
+		return ""
+	}
+	prevScope := g.currentScope
+	g.currentScope = name
+	defer func() { g.currentScope = prevScope }()
+	g.scopeIndent = indent + 1
+	memo := g.memoize(node, f)
+	g.ownParams(f.params, bodyList)
+	g.translatedFuncs[name] = name
+	for _, stmt := range bodyList {
+		if hasRet {
+			if m, ok := stmt.(map[string]interface{}); ok && m["_type"] == "Return" && m["value"] != nil {
+				uncover := g.coverStmt(m) // 不经过 toC 的语句
+				mark := len(g.pendingPost)
+				f.body = append(f.body, irCode(g.annotation(m, indent+1)+g.lineMark(m, indent+1)))
+				if tupleRet {
+					f.body = append(f.body, irCode(g.tupleReturn(m["value"].(map[string]interface{}), indent+1)+g.takePost(mark, indent+1)))
+					uncover()
+					continue
+				}
+				pre, ret := g.exprWithPre(m["value"].(map[string]interface{}), indent+1)
+				t := g.funcResultTypes[name]
+				if g.isRcType(t) {
+					ret = g.rcRef(t, ret) // 调用方得到一个新引用
+				}
+				if memo != nil {
+					ret = memo.put(ret)
+				}
+				f.body = append(f.body, irCode(pre), &irSetResult{irExpr{ret, t}}, irCode(g.takePost(mark, indent+1)))
+				uncover()
+				continue
+			}
+		}
+		f.body = append(f.body, irCode(g.toC(stmt.(map[string]interface{}), indent+1)))
+	}
+	f.body = append(append([]irStmt{irCode(formatPre(g.rcLocals, indent+1))}, f.body...), irCode(g.scopeExit(indent+1)))
+	if memo != nil {
+		f.body = append([]irStmt{irCode(memo.lookup(g.voidReturn(), indent+1))}, f.body...)
+	}
+	if tupleRet {
+		// 元素类型要等函数体里的局部变量都登记后才能推断
+		f.result = g.tupleResultType(bodyList)
+		g.funcResultTypes[name] = f.result
+	}
+	if g.statusFuncs[name] {
+		// 可能抛出异常：返回错误码，正常结束为 PY_OK
+		f.ret = "int"
+		// 末尾的 return x 只写入 *result，并不离开函数
+		if !f.endsWithReturn() {
+			f.body = append(f.body, &irReturn{irExpr{"PY_OK", "int"}})
+		}
+	}
+	f.head = g.annotation(node, indent) + g.docComment(node["body"], pad) + g.purityComment(name, pad) + g.lineMark(node, indent)
+	g.irFuncs = append(g.irFuncs, f)
+	g.funcDefs = append(g.funcDefs, g.emit.emitFunction(f, g.lineReset()))
+	g.forwardPrototypes(f)
+	return ""
+}
+
+// --- handleAssign: 赋值右侧为函数调用且有 result 时，生成 void 调用并传入左值地址 ---
+func (g *generator) handleAssign(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	targets, _ := node["targets"].([]interface{})
+	if len(targets) == 0 {
+		return g.unsupportedStmt(node, pad, "assign (no targets)")
+	}
+	if node["_global"] == true {
+		// 常量初始值已经写在文件作用域变量的定义中，见 declareGlobals
+		return ""
+	}
+	target := targets[0].(map[string]interface{})
+	if target["_type"] == "Tuple" {
+		return g.handleTupleAssign(target, node["value"].(map[string]interface{}), indent)
+	}
+	if target["_type"] == "Subscript" {
+		if c := g.collectionOf(g.getType(target["value"])); c != nil {
+			return g.collectionStore(c, target, node["value"].(map[string]interface{}), indent)
+		}
+		if elem, ok := g.listElemType(g.getType(target["value"])); ok {
+			value := g.toC(node["value"].(map[string]interface{}), 0)
+			if g.isRcType(elem) {
+				return g.rcStoreShared(g.toC(target, 0), elem, value, indent)
+			}
+			return fmt.Sprintf("%s%s = %s;\n", pad, g.toC(target, 0), value)
+		}
+		if g.getType(target["value"]) == "PyJson*" {
+			// d[key] = v / xs[i] = v：容器接管新构造的值
+			v := g.jsonValue(node["value"])
+			j, key := g.jsonSubscript(target["value"], target["slice"])
+			if g.getType(target["slice"]) == "char*" {
+				return fmt.Sprintf("%spy_json_set(%s, %s, %s);\n", pad, j, key, v)
+			}
+			return fmt.Sprintf("%spy_json_put(%s, %s, %s);\n", pad, j, key, v)
+		}
+		return g.unsupportedStmt(node, pad, "assign (subscript)")
+	}
+	if vm, _ := node["value"].(map[string]interface{}); vm["_type"] == "List" && target["_type"] == "Name" {
+		// 列表字面量直接构造到目标变量
+		name, _ := target["id"].(string)
+		lt := g.getType(vm)
+		if declared := g.isDeclared(name); !declared || !g.optRefcount {
+			g.declareVar(name, lt)
+			if g.optRefcount {
+				g.ownObject(name, lt, false, indent)
+			}
+			return formatPre([]string{g.listLiteral(lt, name, vm["elts"].([]interface{}), !declared)}, indent)
+		}
+	}
+	if target["_type"] == "Attribute" {
+		attr := target["attr"].(string)
+		if g.propertyOwner(g.receiverClass(target["value"]), attr) != "" {
+			// property：赋值改为调用 setter
+			setter := map[string]interface{}{"_type": "Attribute", "value": target["value"], "attr": "set_" + attr}
+			return pad + g.handleCall(ASTNode{"_type": "Call", "func": setter, "args": []interface{}{node["value"]}}, 0) + ";\n"
+		}
+		if code, ok := g.constructField(target, node["value"], indent); ok {
+			return code
+		}
+		obj := g.toC(target["value"].(map[string]interface{}), 0)
+		value := g.toC(node["value"].(map[string]interface{}), 0)
+		if owner, _ := g.classAttrOwner(obj, attr); g.classStructsMap[obj] && owner != "" && value != "" {
+			return fmt.Sprintf("%s%s_%s = %s;\n", pad, owner, attr, value)
+		}
+		if obj == "self" && attr != "" && value != "" {
+			if t := g.classFieldType(g.currentClass, attr); g.isRcType(t) {
+				return g.rcStoreShared("self->"+g.fieldAccessPath(g.currentClass, attr), t, value, indent)
+			}
+			return fmt.Sprintf("%sself->%s = %s;\n", pad, g.fieldAccessPath(g.currentClass, attr), value)
+		}
+		if cls := g.receiverClass(target["value"]); g.classHasField(cls, attr) && value != "" {
+			// 其他对象的字段
+			if t := g.classFieldType(cls, attr); g.isRcType(t) {
+				return g.rcStoreShared(g.toC(target, 0), t, value, indent)
+			}
+			return fmt.Sprintf("%s%s = %s;\n", pad, g.toC(target, 0), value)
+		}
+		return g.unsupportedStmt(node, pad, "assign (attribute)")
+	}
+	name, _ := target["id"].(string)
+	valueNode, _ := node["value"].(map[string]interface{})
+	if t := g.declType(name, g.getType(valueNode)); g.classStructsMap[t] {
+		g.rcHoist(name, t+"*", indent)
+	} else {
+		g.rcHoist(name, t, indent)
+		g.tryHoist(name, t)
+	}
+	if valueNode["_type"] == "Call" {
+		if fn, ok := valueNode["func"].(map[string]interface{}); ok && fn["_type"] == "Name" {
+			className := fn["id"].(string)
+			if _, ok := g.classStructsMap[className]; ok {
+				ctorArgs, _ := valueNode["args"].([]interface{})
+				return g.constructObject(name, className, ctorArgs, indent)
+			}
+			if lit, ok := g.foldPureCall(valueNode); ok {
+				// 纯函数 + 常量实参：编译期直接求值
+				resType := g.funcResultTypes[className]
+				comment := fmt.Sprintf(" // folded pure call: %s(%s)", className, g.joinCallArgs(valueNode["args"].([]interface{})))
+				if g.isDeclared(name) {
+					return fmt.Sprintf("%s%s = %s;%s\n", pad, name, lit, comment)
+				}
+				g.declareVar(name, resType)
+				return fmt.Sprintf("%s%s %s = %s;%s\n", pad, resType, name, lit, comment)
+			}
+			if g.hasResultParam(className) {
+				resType := g.funcResultTypes[className]
+				callArgs := append(g.objectArgs(className, valueNode["args"].([]interface{}), g.splitCallArgs(valueNode["args"].([]interface{}))), "&"+name)
+				if g.isDeclared(name) {
+					if g.isRcType(resType) && g.isOwned(name) {
+						// 结果直接写入变量，先保存旧引用，调用后再释放
+						old := g.newTemp("_o")
+						return fmt.Sprintf("%s%s %s = %s;\n%s%s%s;\n", pad, resType, old, name, g.callStmt(className, callArgs, indent), pad, g.rcRelease(old))
+					}
+					return g.callStmt(className, callArgs, indent)
+				}
+				if g.isRcType(resType) {
+					g.ownObject(name, resType, false, indent)
+				}
+				g.declareVar(name, resType)
+				return fmt.Sprintf("%s%s %s;\n%s", pad, resType, name, g.callStmt(className, callArgs, indent))
+			}
+		}
+	}
+	if fn, _ := valueNode["func"].(map[string]interface{}); valueNode["_type"] == "Call" && fn["_type"] == "Name" && fn["id"] == "open" && name != "" {
+		declared := g.isDeclared(name)
+		g.declareVar(name, "FILE*")
+		return g.openFile(valueNode, name, !declared, indent)
+	}
+	typ := g.declType(name, g.getType(valueNode))
+	if typ == "" || name == "" {
+		return g.unsupportedStmt(node, pad, "assign (unknown type or name)")
+	}
+	value := g.toC(valueNode, 0)
+	if value == "" {
+		return g.unsupportedStmt(node, pad, "assign (empty value)")
+	}
+	if typ == "char*" && g.mayBeNone(valueNode) {
+		defer g.markNone(name)
+	}
+	if g.isRcType(typ) {
+		// 变量持有自己的引用
+		if !g.isDeclared(name) {
+			g.declareVar(name, typ)
+			g.ownObject(name, typ, false, indent)
+			return fmt.Sprintf("%s%s %s = %s;\n", pad, typ, name, g.rcRef(typ, value))
+		}
+		if sym := g.lookupVar(name); g.isOwned(name) || (sym != nil && sym.storage == "global" && typ != "char*") {
+			// 文件作用域的列表等：变量持有引用（初始为 NULL），函数中的赋值也先取得新引用再释放旧的
+			return g.rcStore(name, typ, value, indent)
+		}
+		if typ == "char*" {
+			// 不由本作用域持有的变量（循环变量、文件作用域变量）：存入副本，语句后释放的临时字符串不会留在变量里
+			return fmt.Sprintf("%s%s = %s;\n", pad, name, g.rcRef(typ, value))
+		}
+	}
+	if !g.isDeclared(name) {
+		g.declareVar(name, typ)
+		return fmt.Sprintf("%s%s %s = %s;\n", pad, typ, name, value)
+	} else {
+		return fmt.Sprintf("%s%s = %s;\n", pad, name, value)
+	}
+}
+
+// --- handleCall: 调用有 result 的函数时传入目标变量地址 ---
+func (g *generator) handleCall(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	funcName := ""
+	if fn, ok := node["func"].(map[string]interface{}); ok {
+		if code, ok := g.pluginCall(fn, node, indent); ok {
+			return code
+		}
+		if name, m := g.callMapOf(fn); m != nil {
+			return g.mappedCall(name, m, node)
+		}
+		if qname := g.qualifiedCallName(fn); qname != "" {
+			if code, ok := g.handleStdlibCall(qname, node); ok {
+				return code
+			}
+		}
+	}
+	if node["func"] != nil {
+		if fn, ok := node["func"].(map[string]interface{}); ok {
+			if fn["_type"] == "Name" && fn["id"] != nil {
+				funcName = fn["id"].(string)
+				if g.genCall(map[string]interface{}(node)) != nil {
+					return g.unsupportedExpr(node, fmt.Sprintf("use of the generator %s() outside a for loop", funcName))
+				}
+			}
+			if e := g.enumOf(fn); e != nil {
+				return g.enumCall(e, node)
+			}
+			if r, why := g.recordReplace(node); r != nil {
+				return g.nodeToC(r, 0)
+			} else if why != "" {
+				return g.unsupportedExpr(node, why)
+			}
+			if c, why := g.collectionCall(map[string]interface{}(node)); c != nil {
+				return g.collectionNew(c, node)
+			} else if why != "" {
+				return g.unsupportedExpr(node, "call: "+why)
+			}
+			if fn["_type"] == "Attribute" {
+				method := fn["attr"].(string)
+				if code, ok := g.handleCtypesCall(fn, node); ok {
+					return code
+				}
+				if code, ok := g.handleStrJoin(fn, node); ok {
+					return code
+				}
+				if code, ok := g.handleCollectionMethodCall(fn, node); ok {
+					return code
+				}
+				if code, ok := g.handleArgParserCall(fn, node); ok {
+					return code
+				}
+				if code, ok := g.handleMatchMethodCall(fn, node); ok {
+					return code
+				}
+				if code, ok := g.handleListMethodCall(fn, node); ok {
+					return code
+				}
+				if code, ok := g.handleFileMethodCall(fn, node); ok {
+					return code
+				}
+				if code, ok := g.handleStaticMethodCall(fn, node); ok {
+					return g.rcResult(node, code)
+				}
+				if code, ok := g.handleBaseMethodCall(fn, node); ok {
+					return g.rcResult(node, code)
+				}
+				if code, ok := g.handleStrMethodCall(fn, node); ok {
+					return code
+				}
+				if code, ok := g.handleDateTimeMethodCall(fn, node); ok {
+					return code
+				}
+				if code, ok := g.handleJsonMethodCall(fn, node); ok {
+					return code
+				}
+				obj := g.toC(fn["value"].(map[string]interface{}), 0)
+				classType := ""
+				if obj == "self" {
+					classType = g.currentClass + "*"
+				} else if obj != "" && g.varType(obj) != "" {
+					classType = g.varType(obj)
+				} else if t := g.getType(fn["value"]); g.classStructsMap[strings.TrimSuffix(t, "*")] {
+					if g.ctorClass(fn["value"]) != "" {
+						t += "*"
+					}
+					// 接收者是字段或调用结果等表达式：按表达式的类型；按值返回的对象先存入临时变量才能取地址，
+					// 字段（a.b.c）直接取地址，方法修改的是对象里的成员
+					classType = t
+					if vm, _ := fn["value"].(map[string]interface{}); !g.isObjectPointer(t) && vm["_type"] != "Attribute" {
+						tmp := g.newTemp("_t")
+						g.declareTemp(tmp, t)
+						g.pendingPre = append(g.pendingPre, fmt.Sprintf("%s %s = %s;\n", t, tmp, obj))
+						obj = tmp
+					}
+				}
+				receiver := "&" + obj
+				if g.isObjectPointer(classType) {
+					// 堆上的对象已经是指针
+					classType = strings.TrimSuffix(classType, "*")
+					receiver = obj
+				}
+				if field, ok := g.getterFields[classType+"."+method]; ok && g.optInlineGetters && len(node["args"].([]interface{})) == 0 && !g.overriddenBelow(classType, method) {
+					// getter 只是返回字段，直接读取结构体成员；子类重写了它时对象可能是子类，照常调用（经由虚表）
+					return g.handleAttribute(ASTNode{"_type": "Attribute", "value": fn["value"], "attr": field}, 0)
+				}
+				callArgs := []string{receiver}
+				for _, a := range node["args"].([]interface{}) {
+					s := g.toC(a.(map[string]interface{}), 0)
+					if s == "" {
+						return g.unsupportedStmt(node, pad, "call (empty arg)")
+					}
+					callArgs = append(callArgs, s)
+				}
+				if intro := g.virtualIntro[classType+"."+method]; intro != "" && g.overriddenBelow(classType, method) {
+					// 子类可能重写：经由虚表分派
+					vtbl := obj + "." + g.vtblPath(classType)
+					if receiver == obj {
+						vtbl = obj + "->" + g.vtblPath(classType)
+					}
+					callArgs[0] = fmt.Sprintf("(%s*)%s", intro, receiver)
+					callArgs = append(callArgs[:1], g.objectArgs(intro+"."+method, node["args"].([]interface{}), callArgs[1:])...)
+					return g.rcResult(node, fmt.Sprintf("((const %sVtbl*)%s)->%s(%s)", intro, vtbl, method, join(callArgs, ", ")))
+				}
+				owner := g.resolveMethodClass(classType, method)
+				if owner == "" {
+					return g.unsupportedExpr(node, fmt.Sprintf("call: unknown method %s.%s", obj, method))
+				}
+				if owner != classType && g.classStructsMap[classType] {
+					callArgs[0] = fmt.Sprintf("(%s*)%s", owner, receiver)
+				}
+				// 按值的对象实参传地址
+				callArgs = append(callArgs[:1], g.objectArgs(owner+"."+method, node["args"].([]interface{}), callArgs[1:])...)
+				return g.rcResult(node, fmt.Sprintf("%s_%s(%s)", owner, method, join(callArgs, ", ")))
+			}
+		}
+	}
+	if fn, _ := node["func"].(map[string]interface{}); fn["_type"] == "Lambda" {
+		return g.lambdaCall(fn, node)
+	}
+	if code, ok := g.handleFunctionalCall(funcName, node); ok {
+		return code
+	}
+	if g.classStructsMap[funcName] {
+		return g.newObject(funcName, node)
+	}
+	if spec := g.externs[funcName]; spec != nil {
+		return g.externCall(spec, node)
+	}
+	g.noteForwardCall(funcName)
+	if code, ok := g.handleConversion(funcName, node); ok {
+		return code
+	}
+	if code, ok := g.handleNumBuiltin(funcName, node); ok {
+		return code
+	}
+	if funcName == "len" {
+		if args, _ := node["args"].([]interface{}); len(args) == 1 {
+			if _, ok := g.listElemType(g.getType(args[0])); ok || g.collectionOf(g.getType(args[0])) != nil {
+				return fmt.Sprintf("%s->len", g.toC(args[0].(map[string]interface{}), 0))
+			}
+			if g.isStrValue(args[0]) {
+				g.includes["string.h"] = true
+				return fmt.Sprintf("(int)strlen(%s)", g.toC(args[0].(map[string]interface{}), 0))
+			}
+			if g.getType(args[0]) == "PyJson*" {
+				return fmt.Sprintf("py_json_len(%s)", g.toC(args[0].(map[string]interface{}), 0))
+			}
+		}
+	}
+	if funcName == "open" {
+		// 表达式中的 open()：先打开到临时变量并检查
+		tmp := g.newTemp("_f")
+		g.declareTemp(tmp, "FILE*")
+		g.pendingPre = append(g.pendingPre, g.openFile(node, tmp, true, 0))
+		return tmp
+	}
+	if funcName == "input" && g.funcNodes["input"] == nil {
+		return g.inputCall(node)
+	}
+	if funcName == "print" {
+		if node["args"] != nil {
+			args, _ := node["args"].([]interface{})
+			if len(args) > 0 {
+				argStrs := []string{}
+				fmts := []string{}
+				for _, a := range args {
+					if am, _ := a.(map[string]interface{}); am["_type"] == "JoinedStr" {
+						// f-string 直接展开进 printf 的格式串
+						f, fargs := g.formatPieces(am)
+						fmts = append(fmts, f)
+						argStrs = append(argStrs, fargs...)
+						continue
+					}
+					f, s := g.valueFormat(a)
+					if s == "" {
+						return g.unsupportedStmt(node, pad, "print (empty arg)")
+					}
+					if am, _ := a.(map[string]interface{}); am["_type"] == "Call" && countCalls(args) > 1 && strings.HasSuffix(s, ")") {
+						// C 不规定实参的求值顺序：有副作用的调用（如 xs.pop()）按 Python 的从左到右先求值
+						tmp := g.newTemp("_p")
+						g.pendingPre = append(g.pendingPre, fmt.Sprintf("%s %s = %s;\n", g.printTempType(a, f), tmp, s))
+						s = tmp
+					}
+					fmts = append(fmts, f)
+					argStrs = append(argStrs, s)
+				}
+				fmtStr := join(fmts, " ") + "\\n"
+				if g.optFreestanding {
+					return g.freestandingPrint(node, pad, fmtStr, argStrs)
+				}
+				out := "printf("
+				if g.optProfile == "arduino" {
+					out = "py_serial_printf("
+				}
+				if f := callKeyword(node, "file"); f != nil && g.getType(f) == "FILE*" {
+					// print(..., file=sys.stderr) / file=f
+					out = "fprintf(" + g.toC(f, 0) + ", "
+				}
+				if len(argStrs) == 0 {
+					return fmt.Sprintf("%s%s\"%s\");\n", pad, out, fmtStr)
+				}
+				return fmt.Sprintf("%s%s\"%s\", %s);\n", pad, out, fmtStr, join(argStrs, ", "))
+			}
+		}
+	}
+	if funcName != "" {
+		if lit, ok := g.foldPureCall(node); ok {
+			return lit
+		}
+		if g.untranslatedBuiltin(funcName) {
+			if funcName == "exit" || funcName == "quit" {
+				return g.sysExit(node)
+			}
+			// sorted(xs)、list(dq) 等：没有同名的 C 函数，调用它只会在链接时失败
+			return g.unsupportedExpr(node, fmt.Sprintf("call: builtin %s()", funcName))
+		}
+		if g.hasResultParam(funcName) {
+			// 赋值语句由 handleAssign 直接生成；表达式中的调用先写入临时变量
+			args, _ := node["args"].([]interface{})
+			tmp := g.newTemp("_t")
+			callArgs := append(g.objectArgs(funcName, args, g.splitCallArgs(args)), "&"+tmp)
+			g.declareTemp(tmp, g.funcResultTypes[funcName])
+			g.pendingPre = append(g.pendingPre, fmt.Sprintf("%s %s;\n", g.funcResultTypes[funcName], tmp)+g.callStmt(funcName, callArgs, 0))
+			if g.isRcType(g.funcResultTypes[funcName]) {
+				g.rcTemps[tmp] = true
+				g.pendingPost = append(g.pendingPost, g.rcRelease(tmp)+";\n")
+			}
+			return tmp
+		}
+		callArgs := []string{}
+		for _, a := range node["args"].([]interface{}) {
+			s := g.toC(a.(map[string]interface{}), 0)
+			if s == "" {
+				return g.unsupportedStmt(node, pad, "call (empty arg)")
+			}
+			callArgs = append(callArgs, s)
+		}
+		if g.statusFuncs[funcName] {
+			// 没有返回值、可能抛出异常的函数：调用后检查状态码
+			g.pendingPre = append(g.pendingPre, g.callStmt(funcName, g.objectArgs(funcName, node["args"].([]interface{}), callArgs), 0))
+			return ""
+		}
+		return fmt.Sprintf("%s(%s)", funcName, join(g.objectArgs(funcName, node["args"].([]interface{}), callArgs), ", "))
+	}
+	return g.unsupportedStmt(node, pad, "call (unknown function)")
+}
+
+// untranslatedBuiltin: name 是走到 handleCall 末尾的 Python 内置函数，没有被程序中的函数、类、变量或 import 遮蔽
+func (g *generator) untranslatedBuiltin(name string) bool {
+	if !pyBuiltinNames[name] || g.inferScopes[name] != nil || g.classStructsMap[name] || g.importNames[name] != "" {
+		return false
+	}
+	_, isFunc := g.funcParamTypes[name]
+	return !isFunc && g.lookupVar(name) == nil
+}
+
+// --- handleClassDef: 精确推断 struct 字段类型，方法参数/返回类型与字段一致 ---
+func (g *generator) handleClassDef(node ASTNode, indent int) string {
+	name, _ := node["name"].(string)
+	if g.excClasses[name] {
+		return g.excClassDef(node)
+	}
+	if g.enums[name] != nil {
+		return g.enumDef(node)
+	}
+	// 单继承：第一个已知父类作为 base 成员嵌入
+	base := ""
+	if bases, ok := node["bases"].([]interface{}); ok && len(bases) > 0 {
+		if b, ok := bases[0].(map[string]interface{}); ok && b["_type"] == "Name" {
+			if id, _ := b["id"].(string); g.classStructsMap[id] {
+				base = id
+			}
+		}
+	}
+	g.classBases[name] = base
+	g.pushScope(scopeClass, name)
+	defer g.popScope()
+	fields := map[string]string{}
+	fieldOrder := []string{} // 字段按首次赋值的顺序输出
+	// 构造参数类型与所有实例化调用点一致，参数名与类型一一对应
+	ctorArgTypes := map[string]string{}
+	initParamNames := []string{}
+	hasInit := false
+	for _, stmt := range node["body"].([]interface{}) {
+		if m, ok := stmt.(map[string]interface{}); ok && m["_type"] == "FunctionDef" && m["name"] == "__init__" {
+			hasInit = true
+			args := m["args"].(map[string]interface{})
+			if argsList, ok := args["args"].([]interface{}); ok {
+				for i, arg := range argsList {
+					if i == 0 {
+						continue
+					}
+					argName := arg.(map[string]interface{})["arg"].(string)
+					initParamNames = append(initParamNames, argName)
+				}
+			}
+		}
+	}
+	if !hasInit && base != "" {
+		// 没有自己的 __init__ 时沿用父类的构造参数
+		initParamNames = g.methodSigs[base+".__init__"].paramNames
+	}
+	for i, t := range g.initParamTypes(name) {
+		if i < len(initParamNames) && t != "" {
+			ctorArgTypes[initParamNames[i]] = t
+		}
+	}
+	for i, p := range initParamNames {
+		if t := g.annotParam(name+".__init__", i); t != "" && !g.annotClasses[t] {
+			ctorArgTypes[p] = t
+		}
+	}
+	// 收集所有 self.xxx 赋值（父类已有的字段不再重复声明）
+	for _, stmt := range node["body"].([]interface{}) {
+		if m, ok := stmt.(map[string]interface{}); ok && m["_type"] == "FunctionDef" {
+			for _, s := range m["body"].([]interface{}) {
+				if assign, ok := s.(map[string]interface{}); ok && assign["_type"] == "Assign" {
+					targets := assign["targets"].([]interface{})
+					if len(targets) > 0 {
+						t, _ := targets[0].(map[string]interface{})
+						if t["_type"] == "Attribute" && t["value"].(map[string]interface{})["id"] == "self" {
+							attr := t["attr"].(string)
+							if g.classHasField(base, attr) || g.propertyOwner(name, attr) != "" {
+								continue
+							}
+							if _, seen := fields[attr]; !seen {
+								fieldOrder = append(fieldOrder, attr)
+							}
+							valNode := assign["value"]
+							// 如果赋值为参数名，且参数名在 ctorArgTypes，直接用
+							if valMap, ok := valNode.(map[string]interface{}); ok && valMap["_type"] == "Name" {
+								argName := valMap["id"].(string)
+								if t, ok := ctorArgTypes[argName]; ok {
+									fields[attr] = t
+									continue
+								}
+							}
+							// 否则用 getType
+							fields[attr] = g.getType(valNode)
+						}
+					}
+				}
+			}
+		}
+	}
+	// 用构造参数类型修正字段类型
+	for k := range fields {
+		if t, ok := ctorArgTypes[k]; ok {
+			fields[k] = t
+		}
+	}
+	// 字段登记在类作用域
+	for k, v := range fields {
+		g.declareIn(g.symtab, k, v, "field")
+	}
+	g.classFields[name] = fields
+	g.classFieldOrder[name] = fieldOrder
+	var structFields []irParam
+	if base != "" {
+		structFields = append(structFields, irParam{"base", base})
+	} else if g.polyRoot[name] == name {
+		// 多态层次的根类：第一个成员是虚表指针，子类通过 base 链共享
+		structFields = append(structFields, irParam{"vtbl", "const void*"})
+	}
+	for _, k := range fieldOrder {
+		if v := fields[k]; k != "" && v != "" {
+			structFields = append(structFields, irParam{k, v})
+		}
+	}
+	structCode := g.emit.emitStruct(name, structFields)
+	if g.optRefcount {
+		// 方法体里可能就会构造本类对象，释放函数先声明
+		g.rcRuntime()
+		structCode += fmt.Sprintf("static void %s__drop(void* p);\n", name)
+	}
+	g.classStructs = append(g.classStructs, g.annotation(node, 0)+g.docComment(node["body"], "")+structCode)
+	g.classStructsMap[name] = true // 记录类名
+	g.classStructs = append(g.classStructs, g.classAttrDecls(name, node["body"].([]interface{})))
+	if decls := g.classGlobals[name]; decls != "" {
+		g.classStructs = append(g.classStructs, "// module-level objects used by functions\n"+decls)
+	}
+	g.currentClass = name
+	defer func() { g.currentClass = "" }()
+	ownMethods := map[string]bool{}
+	for _, stmt := range node["body"].([]interface{}) {
+		if m, ok := stmt.(map[string]interface{}); ok && m["_type"] == "FunctionDef" {
+			ownMethods[m["name"].(string)] = true
+		}
+	}
+	// 未重写的父类方法：生成转发函数，调用点统一使用 类名_方法名
+	if base != "" {
+		for _, mname := range g.classMethods[base] {
+			if ownMethods[mname] {
+				continue
+			}
+			sig := g.methodSigs[base+"."+mname]
+			g.methodSigs[name+"."+mname] = sig
+			g.funcParamTypes[name+"."+mname] = nil
+			for i, p := range sig.params {
+				g.funcParamTypes[name+"."+mname] = append(g.funcParamTypes[name+"."+mname], strings.TrimSuffix(p, " "+sig.paramNames[i]))
+			}
+			if field, ok := g.getterFields[base+"."+mname]; ok {
+				g.getterFields[name+"."+mname] = field
+			}
+			g.classMethods[name] = append(g.classMethods[name], mname)
+			params := append([]string{name + "* self"}, sig.params...)
+			call := fmt.Sprintf("%s_%s(%s)", base, mname, join(append([]string{"&self->base"}, sig.paramNames...), ", "))
+			if g.staticMethods[base+"."+mname] {
+				g.staticMethods[name+"."+mname] = true
+				params = sig.params
+				call = fmt.Sprintf("%s_%s(%s)", base, mname, join(sig.paramNames, ", "))
+			}
+			if sig.ret != "void" {
+				call = "return " + call
+			}
+			g.classStructs = append(g.classStructs, fmt.Sprintf("%s %s_%s(%s) {\n    %s;\n}\n", sig.ret, name, mname, join(params, ", "), call))
+		}
+	}
+	// 第一遍：确定所有方法签名，虚表与方法体都依赖签名
+	for _, stmt := range node["body"].([]interface{}) {
+		if m, ok := stmt.(map[string]interface{}); ok && m["_type"] == "FunctionDef" {
+			mname := m["name"].(string)
+			restore := g.enterScope(scopeFunction, name+"."+mname)
+			g.symtab.locals = localNames(m["body"].([]interface{}))
+			sig := methodSig{}
+			args := m["args"].(map[string]interface{})
+			static := g.staticMethods[name+"."+mname]
+			if argsList, ok := args["args"].([]interface{}); ok {
+				for i, arg := range argsList {
+					pos := i - 1
+					if static {
+						pos = i
+					} else if i == 0 {
+						continue
+					}
+					argName := arg.(map[string]interface{})["arg"].(string)
+					// 参数类型：若字段有类型则用字段类型，否则用 ctorArgTypes，否则 char*；
+					// 静态方法没有字段可参考，和普通函数一样按调用点推断
+					argType := "char*"
+					if t := g.annotParam(name+"."+mname, pos); t != "" && !g.annotClasses[t] {
+						argType = t
+					} else if prop := strings.TrimPrefix(mname, "set_"); prop != mname && g.properties[name+"."+prop] && g.methodSigs[name+".get_"+prop].ret != "void" {
+						// setter 的参数与 getter 的返回值同类型
+						argType = g.methodSigs[name+".get_"+prop].ret
+					} else if static {
+						argType = g.callSiteArgType(name+"."+mname, pos)
+					} else if t := g.classFieldType(name, argName); t != "" {
+						argType = t
+					} else if t, ok := ctorArgTypes[argName]; ok {
+						argType = t
+					} else if t := g.methodArgType(name, mname, pos); t != "" {
+						argType = t
+					}
+					sig.params = append(sig.params, argType+" "+argName)
+					sig.paramNames = append(sig.paramNames, argName)
+					g.declareParam(argName, argType)
+				}
+			}
+			// 返回类型：若 return 某字段则用字段类型，否则推断
+			retType := "void"
+			for _, s := range m["body"].([]interface{}) {
+				if ret, ok := s.(map[string]interface{}); ok && ret["_type"] == "Return" {
+					if retVal, ok := ret["value"].(map[string]interface{}); ok && retVal["_type"] == "Attribute" && retVal["value"].(map[string]interface{})["id"] == "self" {
+						attr := retVal["attr"].(string)
+						if t := g.classFieldType(name, attr); t != "" {
+							retType = t
+						}
+					} else if retVal["_type"] == "Name" && retVal["id"] == "self" {
+						// return self（如 __enter__）：返回对象本身的指针
+						retType = name + "*"
+					} else if cls, ok := g.objectVars[name+"."+mname][fmt.Sprint(retVal["id"])]; ok && retVal["_type"] == "Name" {
+						// 返回方法内创建的对象（逃逸到堆上）
+						retType = cls + "*"
+					} else if cls := g.ctorClass(ret["value"]); cls != "" {
+						// return Rect(...)：新对象在堆上，与顶层函数的 result 一样返回指针
+						retType = cls + "*"
+					} else if t := g.getType(ret["value"]); t != "" {
+						retType = t
+					}
+				}
+			}
+			if t := g.inferReturns[name+"."+mname]; retType == "void" && t != "" {
+				// return 在 if / 循环之中：用整个程序的推断结果
+				retType = t
+			}
+			if t := g.annotReturns[name+"."+mname]; t != "" {
+				if g.annotClasses[t] {
+					t += "*"
+				}
+				retType = t
+			}
+			sig.ret = retType
+			if intro := g.virtualIntro[name+"."+mname]; intro != "" && intro != name {
+				// 重写虚方法：参数与返回类型必须和虚表槽位一致
+				slot := g.methodSigs[intro+"."+mname]
+				if len(slot.params) == len(sig.params) {
+					sig.ret = slot.ret
+					for i, p := range slot.params {
+						sig.params[i] = strings.TrimSuffix(p, slot.paramNames[i]) + sig.paramNames[i]
+					}
+				}
+			}
+			g.methodSigs[name+"."+mname] = sig
+			g.funcParamTypes[name+"."+mname] = nil
+			for i, p := range sig.params {
+				g.funcParamTypes[name+"."+mname] = append(g.funcParamTypes[name+"."+mname], strings.TrimSuffix(p, " "+sig.paramNames[i]))
+			}
+			if field, ok := simpleGetterField(m); ok {
+				g.getterFields[name+"."+mname] = field
+			}
+			g.classMethods[name] = append(g.classMethods[name], mname)
+			restore()
+		}
+	}
+	if g.polyRoot[name] != "" {
+		g.classStructs = append(g.classStructs, g.vtableDecl(name))
+	}
+	// 第二遍：生成方法体；调用了后面才定义的方法时，在最前面补上原型
+	protoIdx := len(g.classStructs)
+	g.classStructs = append(g.classStructs, "")
+	emitted, emittedBodies := []string{}, []string{}
+	for _, stmt := range node["body"].([]interface{}) {
+		if m, ok := stmt.(map[string]interface{}); ok && m["_type"] == "FunctionDef" {
+			mname := m["name"].(string)
+			g.currentScope = name + "." + mname
+			g.translatedFuncs[name+"_"+mname] = name + "." + mname
+			restore := g.enterScope(scopeFunction, name+"."+mname)
+			g.symtab.locals = localNames(m["body"].([]interface{}))
+			sig := g.methodSigs[name+"."+mname]
+			declared := []irParam{}
+			for i, p := range sig.params {
+				declared = append(declared, irParam{sig.paramNames[i], strings.TrimSpace(strings.TrimSuffix(p, sig.paramNames[i]))})
+				g.declareParam(sig.paramNames[i], declared[i].typ)
+			}
+			params := append([]string{fmt.Sprintf("%s* self", name)}, sig.params...)
+			if g.staticMethods[name+"."+mname] {
+				params = sig.params
+			}
+			g.scopeIndent = indent + 1
+			g.ownParams(declared, m["body"].([]interface{}))
+			body := ""
+			body += g.stmtsToC(m["body"], indent+1)
+			if stmts := m["body"].([]interface{}); stmts[len(stmts)-1].(map[string]interface{})["_type"] != "Return" {
+				body += g.scopeExit(indent + 1) // 以 return 结尾时已在 return 前销毁
+			}
+			body = formatPre(g.rcLocals, indent+1) + body
+			funcCode := fmt.Sprintf("%s%s%s%s%s %s_%s(%s) {\n%s%s}\n", g.annotation(m, 0), g.docComment(m["body"], ""), g.purityComment(name+"."+mname, ""), g.lineMark(m, 0), sig.ret, name, mname, join(params, ", "), body, g.lineReset())
+			g.classStructs = append(g.classStructs, funcCode)
+			emitted = append(emitted, fmt.Sprintf("%s %s_%s(%s)", sig.ret, name, mname, join(params, ", ")))
+			emittedBodies = append(emittedBodies, funcCode)
+			restore()
+			g.currentScope = ""
+		}
+	}
+	g.classStructs[protoIdx] = methodPrototypes(emitted, emittedBodies)
+	if g.polyRoot[name] != "" {
+		g.classStructs = append(g.classStructs, g.vtableThunks(name, ownMethods)+g.vtableInstance(name))
+	}
+	if _, ok := g.methodSigs[name+".__str__"]; ok {
+		g.ensureStrFunc(name)
+	} else if _, ok := g.methodSigs[name+".__repr__"]; ok {
+		g.ensureStrFunc(name)
+	}
+	if g.optRefcount {
+		g.classStructs = append(g.classStructs, g.dropFunc(name))
+	}
+	return ""
+}
+
+func (g *generator) handleReturn(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	if g.curGen != nil {
+		// 生成器结束（带值的 return 不能翻译为状态机，见 yield.go）
+		return fmt.Sprintf("%sself->_state = -1;\n%sreturn 0;\n", pad, pad)
+	}
+	// 先离开 try 块（执行 finally），再销毁局部对象
+	release := g.tryUnwind(0, indent) + g.scopeExit(indent)
+	if val, ok := node["value"]; ok && val != nil {
+		mark := len(g.pendingPost)
+		ret := g.toC(val.(map[string]interface{}), 0)
+		if ret == "" {
+			return g.unsupportedStmt(node, pad, "return (empty value)")
+		}
+		t := g.getType(val)
+		if vm, _ := val.(map[string]interface{}); vm["id"] == "self" && g.currentClass != "" {
+			t = g.currentClass + "*"
+		}
+		if g.isRcType(t) {
+			// 返回新引用；语句里的临时引用与局部变量随后释放
+			ret = g.rcRef(t, ret)
+			release = g.takePost(mark, indent) + release
+		}
+		if m := g.memoFuncs[g.currentScope]; m != nil {
+			ret = m.put(ret)
+		}
+		if g.usesResultPointer(g.currentScope) {
+			// 嵌套在 if/try 等块里的 return：写入 result 后返回
+			return fmt.Sprintf("%s*result = %s;\n%s%s%s\n", pad, ret, release, pad, g.voidReturn())
+		}
+		if release != "" {
+			// 返回值可能引用这些对象，先求值再销毁
+			tmp := g.newTemp("_r")
+			return fmt.Sprintf("%s%s %s = %s;\n%s%sreturn %s;\n", pad, g.getType(val), tmp, ret, release, pad, tmp)
+		}
+		return fmt.Sprintf("%sreturn %s;\n", pad, ret)
+	}
+	return fmt.Sprintf("%s%s%s\n", release, pad, g.voidReturn())
+}
+
+func (g *generator) handleExpr(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	val := node["value"].(map[string]interface{})
+	if val["_type"] == "Constant" {
+		// 文档字符串、单独的 ... 等常量没有作用；文档字符串由 docComment 输出在定义前
+		return ""
+	}
+	if val["_type"] == "Yield" && g.curGen != nil {
+		return g.yieldStmt(val, indent)
+	}
+	if val["_type"] == "Call" {
+		if fn, ok := val["func"].(map[string]interface{}); ok && fn["_type"] == "Name" {
+			if name, _ := fn["id"].(string); g.funcResultTypes[name] != "" {
+				// 丢弃返回值的调用：纯函数调用直接省略，其余只保留提前生成的调用语句
+				if reason, ok := g.funcPurity[name]; ok && reason == "" {
+					return ""
+				}
+				g.toC(val, indent)
+				return ""
+			}
+		}
+		code := g.toC(val, indent)
+		// print 等已经是完整语句（含缩进与换行），其余调用补上分号
+		if g.rcTemps[code] {
+			// 只为释放而保存的返回值，调用已在语句之前
+			return ""
+		}
+		if code == "" || strings.HasSuffix(code, "\n") {
+			return code
+		}
+		return pad + code + ";\n"
+	}
+	return g.toC(val, indent)
+}
+
+func (g *generator) handleIf(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	test, ok := g.constTest(node["test"])
+	if !ok {
+		test = g.collectionTest(node["test"], g.toC(node["test"].(map[string]interface{}), 0))
+	}
+	body := ""
+	g.pushScope(scopeBlock, "if")
+	body += g.stmtsToC(node["body"], indent+1)
+	g.popScope()
+	orelse := ""
+	if orelseList, ok := node["orelse"].([]interface{}); ok && len(orelseList) > 0 {
+		g.pushScope(scopeBlock, "else")
+		defer g.popScope()
+		if len(orelseList) == 1 {
+			if orelseIf, ok := orelseList[0].(map[string]interface{}); ok && orelseIf["_type"] == "If" {
+				mark := g.lineMark(orelseIf, indent)
+				orelseIf["_elif"] = true // 行号标记放在 else 之前，不进 else 与 if 之间
+				elif := g.toC(orelseIf, indent)
+				// -comments、-annotate 的注释放在 else 之前；elif 与 else 写在同一行：else if (...) {
+				for strings.HasPrefix(elif, pad+"//") {
+					end := strings.Index(elif, "\n") + 1
+					mark, elif = mark+elif[:end], elif[end:]
+				}
+				if strings.HasPrefix(elif, pad+"if") {
+					elif = strings.TrimPrefix(elif, pad)
+				} else {
+					// elif 的条件需要先求值，只能放进 else 块里
+					elif = fmt.Sprintf("{\n%s%s}\n", formatPre([]string{elif}, 1), pad)
+				}
+				orelse += fmt.Sprintf("%s%selse %s", mark, pad, elif)
+				return fmt.Sprintf("%sif (%s) {\n%s%s}\n%s", pad, test, body, pad, orelse)
+			}
+		}
+		orelse += fmt.Sprintf("%selse {\n", pad)
+		orelse += g.stmtsToC(orelseList, indent+1)
+		orelse += fmt.Sprintf("%s}\n", pad)
+	}
+	return fmt.Sprintf("%sif (%s) {\n%s%s}\n%s", pad, test, body, pad, orelse)
+}
+
+func (g *generator) handleFor(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	if code, ok := g.handleForCollection(node, indent); ok {
+		return code // 目标可以是 k, v，在目标转换为 C 之前分派
+	}
+	target := g.toC(node["target"].(map[string]interface{}), 0)
+	iter := node["iter"].(map[string]interface{})
+	if gen := g.genCall(iter); gen != nil {
+		return g.handleForGenerator(node, gen, indent)
+	}
+	if qname := g.itertoolsCall(iter); qname != "" {
+		return g.handleForItertools(node, qname, indent)
+	}
+	if kind := g.functionalCall(iter); kind == "map" || kind == "filter" {
+		return g.handleForFunctional(node, indent)
+	}
+	if e := g.enumOf(iter); e != nil {
+		return g.handleForEnum(node, e, indent)
+	}
+	if elem, ok := g.listElemType(g.getType(iter)); ok {
+		return g.handleForList(node, elem, indent)
+	}
+	if g.getType(iter) == "FILE*" {
+		return g.handleForFile(node, indent)
+	}
+	if g.getType(iter) == "PyJson*" || g.isJSONView(iter) {
+		return g.handleForJson(node, indent)
+	}
+	if iter["_type"] == "Call" {
+		funcName, _ := iter["func"].(map[string]interface{})["id"].(string)
+		if funcName == "range" {
+			args := iter["args"].([]interface{})
+			var decl string
+			g.pushScope(scopeBlock, "for")
+			defer g.popScope()
+			if !g.isDeclared(target) {
+				g.declareVar(target, "int")
+				decl = fmt.Sprintf("int %s", target)
+			} else {
+				decl = target
+			}
+			if len(args) == 1 || len(args) == 2 {
+				start := "0"
+				if len(args) == 2 {
+					start = g.toC(args[0].(map[string]interface{}), 0)
+				}
+				endNode := args[len(args)-1].(map[string]interface{})
+				end := g.toC(endNode, 0)
+				bodyStmts := node["body"].([]interface{})
+				assigned := assignedNames(bodyStmts)
+				assigned[target] = true
+				hoisted := ""
+				// range 的上界在 Python 中只求值一次；循环体会修改其中的变量时先保存下来
+				if endNode["_type"] != "Constant" && !g.isLoopInvariant(endNode, assigned) {
+					tmp, decl := g.loopTemp("_end", g.loopTempType(endNode))
+					hoisted += fmt.Sprintf("%s%s = %s;\n", pad, decl, end)
+					end = tmp
+				}
+				if g.optLICM {
+					var inv string
+					bodyStmts, inv = g.hoistLoopInvariants(bodyStmts, assigned, pad)
+					hoisted += inv
+					if g.isHoistable(endNode, assigned) {
+						tmp := g.newTemp("_inv")
+						hoisted += fmt.Sprintf("%s%s %s = %s;\n", pad, g.loopTempType(endNode), tmp, end)
+						end = tmp
+					}
+				}
+				body := ""
+				restore := g.enterLoop()
+				body += g.stmtsToC(bodyStmts, indent+1)
+				restore()
+				return fmt.Sprintf("%s%sfor (%s = %s; %s < %s; %s++) {\n%s%s}\n", hoisted, pad, decl, start, target, end, target, body, pad)
+			}
+		}
+	}
+	return pad + g.unsupportedExpr(node, "for loop") + "\n"
+}
+
+func (g *generator) handleWhile(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	mark := len(g.pendingPost)
+	pre, test := "", ""
+	if c, ok := g.constTest(node["test"]); ok {
+		test = c
+	} else {
+		pre, test = g.exprWithPre(node["test"].(map[string]interface{}), indent+1)
+		test = g.collectionTest(node["test"], test)
+	}
+	post := g.takePost(mark, indent+1)
+	body := ""
+	restore := g.enterLoop()
+	g.pushScope(scopeBlock, "while")
+	body += g.stmtsToC(node["body"], indent+1)
+	g.popScope()
+	restore()
+	if pre != "" {
+		// 条件中含有函数调用：每轮循环开头重新求值，条件不成立时退出
+		done := formatPre([]string{post}, 1)
+		return fmt.Sprintf("%swhile (1) {\n%s%s    if (!(%s)) {\n%s%s        break;\n%s    }\n%s%s%s}\n", pad, pre, pad, test, done, pad, pad, post, body, pad)
+	}
+	return fmt.Sprintf("%swhile (%s) {\n%s%s}\n", pad, test, body, pad)
+}
+
+func (g *generator) handleBreak(node ASTNode, indent int) string {
+	return g.tryUnwind(g.loopTryBase, indent) + strings.Repeat(" ", indent*4) + "break;\n"
+}
+
+func (g *generator) handleContinue(node ASTNode, indent int) string {
+	return g.tryUnwind(g.loopTryBase, indent) + strings.Repeat(" ", indent*4) + "continue;\n"
+}
+
+func handlePass(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	if msg, ok := node["_leftOut"].(string); ok {
+		// 重复定义等被拿掉的语句，见 checkRedefinitions
+		return pad + "// left out: " + msg + "\n"
+	}
+	return pad + "// pass\n"
+}
+
+func (g *generator) handleList(node ASTNode, indent int) string {
+	elts := node["elts"].([]interface{})
+	lt := g.getType(map[string]interface{}(node))
+	tmp, decl := g.loopTemp("_l", lt) // 生成器中是结构体的字段：yield 之后的循环还在用它
+	g.declareTemp(tmp, lt)
+	g.pendingPre = append(g.pendingPre, g.listLiteral(lt, tmp, elts, decl != tmp))
+	if g.optRefcount {
+		g.rcTemps[tmp] = true
+		g.pendingPost = append(g.pendingPost, fmt.Sprintf("py_decref(%s);\n", tmp))
+	}
+	return tmp
+}
+
+// upcastElem: 子类对象放进基类的列表（[Sq(2), Circ(1)] 是 PyList_Shapep）时转换指针类型
+func (g *generator) upcastElem(elem string, node interface{}, v string) string {
+	if cls := strings.TrimSuffix(g.getType(node), "*"); g.isObjectPointer(elem) && g.classStructsMap[cls] && cls+"*" != elem {
+		return "(" + elem + ")" + v
+	}
+	return v
+}
+
+// listLiteral: 新建列表并依次追加元素
+func (g *generator) listLiteral(lt, name string, elts []interface{}, declare bool) string {
+	list := strings.TrimSuffix(lt, "*")
+	code := fmt.Sprintf("%s = %s_new();\n", name, list)
+	if declare {
+		code = lt + " " + code
+	}
+	elem, _ := g.listElemType(lt)
+	for _, e := range elts {
+		v := g.toC(e.(map[string]interface{}), 0)
+		if g.isRcType(elem) {
+			v = g.rcRef(elem, v)
+		}
+		code += fmt.Sprintf("%s_append(%s, %s);\n", list, name, g.upcastElem(elem, e, v))
+	}
+	return code
+}
+
+func (g *generator) handleDict(node ASTNode, indent int) string {
+	if g.isJSONDict(map[string]interface{}(node)) {
+		// 键为字符串的字典：构造 PyJson 对象
+		return g.rcHold("PyJson*", g.jsonValue(map[string]interface{}(node)))
+	}
+	keys := node["keys"].([]interface{})
+	vals := node["values"].([]interface{})
+	pairs := []string{}
+	for i := range keys {
+		k := keys[i]
+		v := vals[i]
+		if k != nil {
+			kStr := g.toC(k.(map[string]interface{}), 0)
+			vStr := g.toC(v.(map[string]interface{}), 0)
+			pairs = append(pairs, fmt.Sprintf("%s: %s", kStr, vStr))
+		}
+	}
+	g.report(logError, node, "unsupported dict: only literals with string keys are translated")
+	return fmt.Sprintf("/* dict: {%s} */", join(pairs, ", "))
+}
+
+func (g *generator) handleAttribute(node ASTNode, indent int) string {
+	if code := g.enumAttr(node); code != "" {
+		return code
+	}
+	if code, ok := g.argsAttr(node); ok {
+		return code
+	}
+	attr := ""
+	if node["attr"] != nil {
+		attr, _ = node["attr"].(string)
+	}
+	if e := g.excObjectOfType(node["value"]); e != "" && attr == "__name__" {
+		// type(e).__name__：不翻译 type(e) 本身
+		if g.optExceptions == "status" {
+			return fmt.Sprintf("py_err_name[%s->type]", e)
+		}
+		return e + "->type->name"
+	}
+	value := ""
+	if node["value"] != nil {
+		value = g.toC(node["value"].(map[string]interface{}), 0)
+	}
+	if code, _ := g.stdlibAttr(g.qualifiedCallName(node)); code != "" {
+		return code
+	}
+	if cls := g.receiverClass(node["value"]); g.propertyOwner(cls, attr) != "" && !g.classHasField(cls, attr) {
+		// property：读取改为调用 getter
+		return g.handleCall(ASTNode{"_type": "Call", "func": map[string]interface{}{"_type": "Attribute", "value": node["value"], "attr": "get_" + attr}, "args": []interface{}{}}, 0)
+	}
+	if g.classStructsMap[value] {
+		// 类名.属性：类属性是文件作用域变量
+		if owner, _ := g.classAttrOwner(value, attr); owner != "" {
+			return owner + "_" + attr
+		}
+	}
+	if cls := g.receiverClass(node["value"]); cls != "" && !g.classHasField(cls, attr) {
+		// 通过实例读取类属性
+		if owner, _ := g.classAttrOwner(cls, attr); owner != "" {
+			return owner + "_" + attr
+		}
+	}
+	if value == "self" {
+		return fmt.Sprintf("self->%s", g.fieldAccessPath(g.currentClass, attr))
+	}
+	objType := g.varType(value)
+	if vm, _ := node["value"].(map[string]interface{}); vm["_type"] != "Name" {
+		// a.b.c、f().x：每一步按表达式的类型决定用 . 还是 ->；构造调用的结果是堆上对象的指针
+		objType = g.getType(vm)
+		if g.ctorClass(vm) != "" {
+			objType += "*"
+		}
+	}
+	if g.isObjectPointer(objType) {
+		return fmt.Sprintf("%s->%s", value, g.fieldAccessPath(strings.TrimSuffix(objType, "*"), attr))
+	} else if g.classStructsMap[objType] {
+		return fmt.Sprintf("%s.%s", value, g.fieldAccessPath(objType, attr))
+	}
+	return fmt.Sprintf("%s.%s", value, attr)
+}
+
+func (g *generator) handleName(node ASTNode, indent int) string {
+	if node["id"] == nil {
+		return ""
+	}
+	if code, _ := g.stdlibAttr(g.qualifiedCallName(node)); code != "" {
+		// from sys import argv
+		return code
+	}
+	return node["id"].(string)
+}
+
+func handleConstant(node ASTNode, indent int) string {
+	v := node["value"]
+	switch val := v.(type) {
+	case string:
+		return fmt.Sprintf("\"%s\"", cEscape(val))
+	case json.Number:
+		return formatNumber(val)
+	case nil:
+		return "NULL"
+	case bool:
+		// C89 没有 true / false（C99 要 <stdbool.h>）
+		if val {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+// --- isIntLiteral: 数字字面量是否为 C int（不带小数点/指数且在 32 位范围内）---
+func isIntLiteral(num json.Number) bool {
+	s := num.String()
+	if strings.ContainsAny(s, ".eE") {
+		return false
+	}
+	i, err := num.Int64()
+	return err == nil && i >= math.MinInt32 && i <= math.MaxInt32
+}
+
+// --- formatNumber: 把 JSON 数字原文转为合法的 C 字面量 ---
+// int 范围内的整数原样输出，其余整数与 getType 一致按 double 处理，加 .0；
+// 浮点数保证带小数点或指数，避免 2.0 被输出成整型的 2
+func formatNumber(num json.Number) string {
+	s := num.String()
+	if isIntLiteral(num) {
+		return s
+	}
+	if !strings.ContainsAny(s, ".eE") {
+		return s + ".0"
+	}
+	if strings.HasPrefix(s, ".") {
+		s = "0" + s
+	}
+	if strings.HasSuffix(s, ".") {
+		s += "0"
+	}
+	return s
+}
+
+// intBinOps: 两侧都是 int 时结果也是 int 的运算（/ 是真除法，** 用 pow）
+var intBinOps = map[string]bool{"Add": true, "Sub": true, "Mult": true, "Mod": true}
+
+// --- isIntExpr: 判断表达式在 C 中是否为整型（整数字面量、int 变量及其运算）---
+func (g *generator) isIntExpr(node interface{}) bool {
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	switch m["_type"] {
+	case "Constant":
+		if num, ok := m["value"].(json.Number); ok {
+			return isIntLiteral(num)
+		}
+	case "Name":
+		id, _ := m["id"].(string)
+		return g.varType(id) == "int"
+	case "UnaryOp":
+		op, _ := m["op"].(map[string]interface{})
+		return op["_type"] != "Not" && g.isIntExpr(m["operand"])
+	case "BinOp":
+		op, _ := m["op"].(map[string]interface{})
+		switch op["_type"] {
+		case "Add", "Sub", "Mult", "Mod":
+			return g.isIntExpr(m["left"]) && g.isIntExpr(m["right"])
+		}
+	}
+	return false
+}
+
+// stdlibModules: 有函数或变量映射到 C 的标准库模块（handleStdlibCall、stdlibAttr 等）；
+// import 其他的模块记在 Output.Unresolved 中，用到它们的代码成为注释
+var stdlibModules = map[string]bool{
+	"__future__": true, "argparse": true, "bisect": true, "collections": true, "copy": true, "ctypes": true, "ctypes.util": true, "datetime": true, "enum": true, "functools": true, "heapq": true, "itertools": true, "json": true,
+	"os": true, "os.path": true, "re": true, "sys": true, "time": true, "typing": true, "warnings": true,
+	"py2c": true, // @py2c.extern 的标记模块（仓库中的 py2c.py），见 extern.go
+}
+
+// importModule: 记下不能翻译的模块；from . import x 等相对导入的模块名以 . 开头
+func (g *generator) importModule(module string) {
+	if !stdlibModules[module] && !g.mappedModule(module) {
+		g.unresolved[module] = true
+	}
+}
+
+func (g *generator) handleImport(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	names := node["names"].([]interface{})
+	imports := []string{}
+	for _, n := range names {
+		asname := n.(map[string]interface{})["asname"]
+		name := n.(map[string]interface{})["name"].(string)
+		g.importModule(name)
+		if asname != nil {
+			imports = append(imports, fmt.Sprintf("%s as %s", name, asname.(string)))
+			g.moduleAliases[asname.(string)] = name
+		} else {
+			imports = append(imports, name)
+			g.moduleAliases[name] = name
+		}
+	}
+	return fmt.Sprintf("%s// import %s\n", pad, join(imports, ", "))
+}
+
+func (g *generator) handleImportFrom(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	module := ""
+	if node["module"] != nil {
+		module, _ = node["module"].(string)
+	}
+	level, _ := node["level"].(json.Number)
+	dots, _ := level.Int64()
+	g.importModule(strings.Repeat(".", int(dots)) + module)
+	names := node["names"].([]interface{})
+	imports := []string{}
+	for _, n := range names {
+		asname := n.(map[string]interface{})["asname"]
+		name := n.(map[string]interface{})["name"].(string)
+		if asname != nil {
+			imports = append(imports, fmt.Sprintf("%s as %s", name, asname.(string)))
+			g.importedFuncs[asname.(string)] = module + "." + name
+		} else {
+			imports = append(imports, name)
+			g.importedFuncs[name] = module + "." + name
+		}
+	}
+	return fmt.Sprintf("%s// from %s import %s\n", pad, module, join(imports, ", "))
+}
+
+// handleWith: with 语句按 try/finally 展开：先获取资源，离开语句块时（包括 return/break/continue 和异常）一定释放。
+// open() 打开的文件用 fclose 关闭；定义了 __enter__/__exit__ 的类调用这两个方法；其他上下文管理器只生成注释
+func (g *generator) handleWith(node ASTNode, indent int) string {
+	items, _ := node["items"].([]interface{})
+	if len(items) == 0 {
+		return g.stmtsToC(node["body"], indent)
+	}
+	body := node["body"]
+	if len(items) > 1 {
+		// with a, b: 等价于嵌套的 with
+		body = []interface{}{map[string]interface{}{"_type": "With", "items": items[1:], "body": node["body"]}}
+	}
+	item := items[0].(map[string]interface{})
+	ctx := item["context_expr"].(map[string]interface{})
+	target, _ := item["optional_vars"].(map[string]interface{})
+	acquire, release := g.withResource(ctx, target)
+	if release == nil {
+		return g.withComment(node, indent)
+	}
+	code := ""
+	for _, stmt := range acquire {
+		code += g.toC(stmt, indent)
+	}
+	try := ASTNode{"_type": "Try", "body": body, "finalbody": release}
+	if g.optExceptions == "setjmp" && !g.usesExceptions {
+		// 没有异常可以跳出语句块，不需要异常帧
+		return code + g.tryInline(try, indent)
+	}
+	return code + g.handleTry(try, indent)
+}
+
+// withResource: with 的上下文表达式对应的获取语句与释放语句（合成的 AST 节点）；不认识时 release 为 nil
+func (g *generator) withResource(ctx, target map[string]interface{}) (acquire []ASTNode, release []interface{}) {
+	name := func(id string) map[string]interface{} { return map[string]interface{}{"_type": "Name", "id": id} }
+	call := func(obj map[string]interface{}, method string, args ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"_type": "Call", "func": map[string]interface{}{"_type": "Attribute", "value": obj, "attr": method}, "args": args}
+	}
+	assign := func(target, value map[string]interface{}) ASTNode {
+		return ASTNode{"_type": "Assign", "targets": []interface{}{target}, "value": value}
+	}
+	expr := func(value map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"_type": "Expr", "value": value}
+	}
+	// 上下文对象保存在 as 的变量或临时变量里；已经是变量时直接使用
+	obj := ctx
+	if ctx["_type"] != "Name" {
+		obj = name(g.newTemp("_cm"))
+		if target["_type"] == "Name" && g.getType(ctx) == "FILE*" {
+			// 文件：as 的变量就是文件本身
+			obj = target
+		}
+		acquire = append(acquire, assign(obj, ctx))
+	}
+	if g.getType(ctx) == "FILE*" {
+		if target != nil && obj["id"] != target["id"] {
+			acquire = append(acquire, assign(target, obj))
+		}
+		return acquire, []interface{}{expr(call(obj, "close"))}
+	}
+	class := strings.TrimSuffix(g.getType(ctx), "*")
+	if g.resolveMethodClass(class, "__enter__") == "" || g.resolveMethodClass(class, "__exit__") == "" {
+		return nil, nil
+	}
+	if target != nil {
+		acquire = append(acquire, assign(target, call(obj, "__enter__")))
+	} else {
+		acquire = append(acquire, ASTNode(expr(call(obj, "__enter__"))))
+	}
+	// 异常信息不传给 __exit__，返回值也不能吞掉异常
+	none := map[string]interface{}{"_type": "Constant", "value": nil}
+	return acquire, []interface{}{expr(call(obj, "__exit__", none, none, none))}
+}
+
+// withComment: 不支持的上下文管理器：语句块照常翻译，with 写成注释
+func (g *generator) withComment(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	g.report(logError, node, "unsupported context manager: the with block runs without __enter__/__exit__")
+	withHeader := ""
+	for _, item := range node["items"].([]interface{}) {
+		itemMap := item.(map[string]interface{})
+		contextExpr := g.toC(itemMap["context_expr"].(map[string]interface{}), 0)
+		if ov, ok := itemMap["optional_vars"].(map[string]interface{}); ok {
+			withHeader += fmt.Sprintf("%s// with %s as %s {\n", pad, contextExpr, g.toC(ov, 0))
+		} else {
+			withHeader += fmt.Sprintf("%s// with %s {\n", pad, contextExpr)
+		}
+	}
+	return withHeader + g.stmtsToC(node["body"], indent+1) + fmt.Sprintf("%s// }\n", pad)
+}
+
+// stmtsToC: 依次翻译语句列表（可以为 nil）
+func (g *generator) stmtsToC(stmts interface{}, indent int) string {
+	var code strings.Builder
+	list, _ := stmts.([]interface{})
+	for _, stmt := range list {
+		code.WriteString(g.toC(stmt.(map[string]interface{}), indent))
+	}
+	return code.String()
+}
+
+// handleTry: try/except/finally 用 setjmp/longjmp 实现。
+// try 块压入一个异常帧，py_raise 跳回最内层的帧；有 finally 时按 try { try/except } finally 处理，
+// 异常、return、break、continue 离开 try 块时都会先执行 finally
+func (g *generator) handleTry(node ASTNode, indent int) string {
+	if g.optExceptions == "exit" {
+		return g.tryInline(node, indent)
+	}
+	if g.tryDecls == nil {
+		// 最外层的 try 块：块里首次赋值的变量在块外声明
+		var decls []string
+		g.tryDecls, g.tryScope = &decls, g.symtab
+		code := g.handleTry(node, indent)
+		g.tryDecls = nil
+		return formatPre(decls, indent) + code
+	}
+	if g.optExceptions == "status" {
+		return g.tryStatus(node, indent)
+	}
+	pad := strings.Repeat(" ", indent*4)
+	g.excRuntime()
+	finalbody, _ := node["finalbody"].([]interface{})
+	handlers, _ := node["handlers"].([]interface{})
+	frame := g.newTemp("_e")
+	if len(finalbody) == 0 {
+		return g.tryExcept(node, frame, indent)
+	}
+	g.tryFrames = append(g.tryFrames, tryFrame{frame, finalbody, ""})
+	body := ""
+	if len(handlers) > 0 {
+		body = g.tryExcept(node, g.newTemp("_e"), indent+2) + fmt.Sprintf("%s        py_try_pop(&%s);\n", pad, frame)
+	} else {
+		body = g.stmtsToC(node["body"], indent+2) + tryPop(node["body"], frame, indent+2)
+	}
+	g.tryFrames = g.tryFrames[:len(g.tryFrames)-1]
+	// finally 里的异常、return 不再经过本帧
+	finally := g.stmtsToC(finalbody, indent+1)
+	return fmt.Sprintf("%[1]s{\n%[1]s    PyExcFrame %[2]s;\n%[1]s    py_try_push(&%[2]s);\n%[1]s    if (setjmp(%[2]s.env) == 0) {\n%[3]s%[1]s    }\n%[4]s%[1]s    if (%[2]s.exc.type) {\n%[1]s        py_reraise(&%[2]s.exc); // re-raise after finally\n%[1]s    }\n%[1]s}\n",
+		pad, frame, body, finally)
+}
+
+// tryInline: -exceptions=exit 时 raise 直接退出，except 永远不会执行：
+// 依次执行 try 块、else 块与 finally（return/break/continue 仍会先执行 finally）
+func (g *generator) tryInline(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	finalbody, _ := node["finalbody"].([]interface{})
+	g.tryFrames = append(g.tryFrames, tryFrame{"", finalbody, ""})
+	code := g.stmtsToC(node["body"], indent)
+	g.tryFrames = g.tryFrames[:len(g.tryFrames)-1]
+	handlers, _ := node["handlers"].([]interface{})
+	for _, h := range handlers {
+		t := "all exceptions"
+		if ht, ok := h.(map[string]interface{})["type"].(map[string]interface{}); ok {
+			// 只写出异常的名字：except (KeyError, ValueError) 的元组不是表达式
+			names := []interface{}{ht}
+			if ht["_type"] == "Tuple" {
+				names, _ = ht["elts"].([]interface{})
+			}
+			ids := []string{}
+			for _, e := range names {
+				em, _ := e.(map[string]interface{})
+				id, ok := em["id"].(string)
+				if !ok {
+					id, _ = em["attr"].(string)
+				}
+				ids = append(ids, id)
+			}
+			t = join(ids, ", ")
+		}
+		code += fmt.Sprintf("%s// except %s: not reachable, raise exits with -exceptions=exit\n", pad, t)
+	}
+	if endsWithJump(node["body"]) {
+		// 离开时已经执行过 finally
+		return code
+	}
+	return code + g.stmtsToC(node["orelse"], indent) + g.stmtsToC(finalbody, indent)
+}
+
+// tryExcept: 没有 finally 的 try/except/else；没有匹配的 except 时继续向外抛出
+func (g *generator) tryExcept(node ASTNode, frame string, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	g.tryFrames = append(g.tryFrames, tryFrame{frame, nil, ""})
+	body := g.stmtsToC(node["body"], indent+2) + tryPop(node["body"], frame, indent+2)
+	g.tryFrames = g.tryFrames[:len(g.tryFrames)-1]
+	// else 块在异常帧弹出之后执行，其中的异常不由本 try 处理
+	orelse := g.stmtsToC(node["orelse"], indent+2)
+	code := fmt.Sprintf("%[1]s{\n%[1]s    PyExcFrame %[2]s;\n%[1]s    py_try_push(&%[2]s);\n%[1]s    if (setjmp(%[2]s.env) == 0) {\n%[3]s%[4]s%[1]s    }", pad, frame, body, orelse)
+	catchAll := false
+	handlers, _ := node["handlers"].([]interface{})
+	for _, h := range handlers {
+		handler := h.(map[string]interface{})
+		cond := g.excMatch(handler["type"], frame+".exc.type")
+		if cond == "" {
+			// 不认识的异常类型：不会匹配
+			g.report(logError, handler, "unsupported exception type")
+			code += fmt.Sprintf(" else if (0) { // unsupported exception type\n")
+		} else if cond == "1" {
+			catchAll = true
+			code += " else {\n"
+		} else {
+			code += fmt.Sprintf(" else if (%s) {\n", cond)
+		}
+		savedHandler, savedVar := g.currentHandler, g.currentHandlerVar
+		g.currentHandler, g.currentHandlerVar = frame, ""
+		if v, ok := handler["name"].(string); ok && v != "" {
+			// except ... as e：e 指向异常记录，打印时为消息
+			g.currentHandlerVar = v
+			g.declareVar(v, "PyException*")
+			code += fmt.Sprintf("%s        PyException* %s = &%s.exc;\n", pad, v, frame)
+		}
+		code += g.stmtsToC(handler["body"], indent+2) + pad + "    }"
+		g.currentHandler, g.currentHandlerVar = savedHandler, savedVar
+		if catchAll {
+			break
+		}
+	}
+	if !catchAll {
+		code += fmt.Sprintf(" else {\n%[1]s        py_reraise(&%[2]s.exc);\n%[1]s    }", pad, frame)
+	}
+	return code + "\n" + pad + "}\n"
+}
+
+func handleAsyncFunctionDef(node ASTNode, indent int) string {
+	name := node["name"].(string)
+	return fmt.Sprintf("// async def %s(...) not supported, please rewrite as sync function\n", name)
+}
+
+func handleAwait(node ASTNode, indent int) string {
+	return "// await ... not supported, please rewrite as sync call\n"
+}
+
+func (g *generator) handleCompare(node ASTNode, indent int) string {
+	left := g.toC(node["left"].(map[string]interface{}), 0)
+	ops := node["ops"].([]interface{})
+	comparators := node["comparators"].([]interface{})
+	if len(ops) == 1 && len(comparators) == 1 {
+		op := ops[0].(map[string]interface{})["_type"].(string)
+		right := g.toC(comparators[0].(map[string]interface{}), 0)
+		switch op {
+		case "Gt":
+			return fmt.Sprintf("%s > %s", left, right)
+		case "Lt":
+			return fmt.Sprintf("%s < %s", left, right)
+		case "Eq":
+			return fmt.Sprintf("%s == %s", left, right)
+		case "NotEq":
+			return fmt.Sprintf("%s != %s", left, right)
+		case "GtE":
+			return fmt.Sprintf("%s >= %s", left, right)
+		case "LtE":
+			return fmt.Sprintf("%s <= %s", left, right)
+		case "In", "NotIn":
+			if c, _ := comparators[0].(map[string]interface{}); g.qualifiedCallName(c) == "os.environ" {
+				// name in os.environ
+				g.includes["stdlib.h"] = true
+				if op == "NotIn" {
+					return fmt.Sprintf("(getenv(%s) == NULL)", left)
+				}
+				return fmt.Sprintf("(getenv(%s) != NULL)", left)
+			}
+			if c := g.collectionOf(g.getType(comparators[0])); c != nil {
+				return g.collectionContains(c, op, left, right)
+			}
+			if g.getType(comparators[0]) == "PyJson*" && g.getType(node["left"]) == "char*" {
+				// key in d
+				if op == "NotIn" {
+					return fmt.Sprintf("!py_json_has(%s, %s)", right, left)
+				}
+				return fmt.Sprintf("py_json_has(%s, %s)", right, left)
+			}
+			return g.unsupportedExpr(node, "compare op")
+		case "Is", "IsNot":
+			if g.enums[g.getType(node["left"])] != nil {
+				// Enum 的成员只有一个实例：is 就是 ==
+				if op == "IsNot" {
+					return fmt.Sprintf("%s != %s", left, right)
+				}
+				return fmt.Sprintf("%s == %s", left, right)
+			}
+			if c, _ := comparators[0].(map[string]interface{}); isNoneConst(c) && g.getType(node["left"]) == "PyMatch" {
+				// m is None：re.match 等没有匹配
+				if op == "IsNot" {
+					return fmt.Sprintf("(%s).ok", left)
+				}
+				return fmt.Sprintf("!(%s).ok", left)
+			}
+			if c, _ := comparators[0].(map[string]interface{}); isNoneConst(c) && g.getType(node["left"]) == "char*" {
+				// 字符串的 None 是 NULL（没有默认值的选项、没有参与匹配的组）
+				if op == "IsNot" {
+					return fmt.Sprintf("(%s != NULL)", left)
+				}
+				return fmt.Sprintf("(%s == NULL)", left)
+			}
+			return g.unsupportedExpr(node, "compare op")
+		default:
+			return g.unsupportedExpr(node, "compare op")
+		}
+	}
+	return g.unsupportedExpr(node, "multi-compare")
+}
+
+func (g *generator) handleBinOp(node ASTNode, indent int) string {
+	op := node["op"].(map[string]interface{})["_type"].(string)
+	if op == "Add" && g.getType(node["left"]) == "char*" && g.getType(node["right"]) == "char*" {
+		// 字符串拼接：和 f-string 一样格式化到缓冲区（两侧只转换一次，避免重复生成提前的语句）
+		return g.handleJoinedStr(node, indent)
+	}
+	left := g.toC(node["left"].(map[string]interface{}), 0)
+	right := g.toC(node["right"].(map[string]interface{}), 0)
+	switch op {
+	case "Add":
+		return fmt.Sprintf("(%s + %s)", left, right)
+	case "Sub":
+		return fmt.Sprintf("(%s - %s)", left, right)
+	case "Mult":
+		return fmt.Sprintf("(%s * %s)", left, right)
+	case "Div":
+		// Python 的 / 总是真除法，两侧都是整数时需要转成 double
+		if g.getType(node["left"]) == "int" && g.getType(node["right"]) == "int" {
+			return fmt.Sprintf("((double)%s / %s)", left, right)
+		}
+		return fmt.Sprintf("(%s / %s)", left, right)
+	case "Mod":
+		return fmt.Sprintf("(%s %% %s)", left, right)
+	case "Pow":
+		return fmt.Sprintf("%s(%s, %s)", g.mathCall("pow"), left, right)
+	default:
+		return g.unsupportedExpr(node, fmt.Sprintf("BinOp: %s", op))
+	}
+}
+
+// --- handleUnaryOp: 一元运算，负数字面量直接输出，其余加括号 ---
+// handleIfExp: a if cond else b。分支里含有要提前求值的调用（或 -refcount 的临时引用）时，
+// 它们只能在分支执行时求值，结果先写入临时变量
+func (g *generator) handleIfExp(node ASTNode, indent int) string {
+	testNode := node["test"].(map[string]interface{})
+	test, ok := g.constTest(testNode)
+	if !ok {
+		test = g.toC(testNode, 0)
+	}
+	if !ok && !isBoolExpr(testNode) {
+		test = g.truthTest(test, g.getType(testNode))
+	}
+	t := g.getType(map[string]interface{}(node))
+	tmp := g.newTemp("_t")
+	body, a, simpleA := g.condBranch(node["body"], tmp, t)
+	orelse, b, simpleB := g.condBranch(node["orelse"], tmp, t)
+	if simpleA && simpleB {
+		return fmt.Sprintf("(%s ? %s : %s)", test, a, b)
+	}
+	g.holdTemp(tmp, t)
+	g.pendingPre = append(g.pendingPre, fmt.Sprintf("%s %s;\nif (%s) {\n%s} else {\n%s}\n", t, tmp, test, body, orelse))
+	return tmp
+}
+
+// handleBoolOp: and / or。操作数都是布尔表达式时用 && / ||；否则按 Python 语义取值
+// （a or b：a 为真时为 a，否则为 b），结果写入临时变量，后面的操作数只在需要时求值
+func (g *generator) handleBoolOp(node ASTNode, indent int) string {
+	or := node["op"].(map[string]interface{})["_type"] == "Or"
+	values := node["values"].([]interface{})
+	t := g.getType(map[string]interface{}(node))
+	first := g.toC(values[0].(map[string]interface{}), 0)
+	tmp := g.newTemp("_t")
+	cond := g.truthTest(tmp, t)
+	if or {
+		cond = "!" + cond
+	}
+	branches := []string{}
+	exprs := []string{first}
+	simple := isBoolExpr(map[string]interface{}(node))
+	for _, v := range values[1:] {
+		code, expr, ok := g.condBranch(v, tmp, t)
+		if g.isRcType(t) {
+			code = "    " + g.rcRelease(tmp) + ";\n" + code
+		}
+		branches = append(branches, code)
+		exprs = append(exprs, expr)
+		simple = simple && ok
+	}
+	if simple {
+		op := " && "
+		if or {
+			op = " || "
+		}
+		return "(" + join(exprs, op) + ")"
+	}
+	g.holdTemp(tmp, t)
+	if g.isRcType(t) {
+		first = g.rcRef(t, first)
+	}
+	// 从最后一个操作数开始向外嵌套
+	code := ""
+	for i := len(branches) - 1; i >= 0; i-- {
+		inner := ""
+		if code != "" {
+			inner = formatPre([]string{code}, 1)
+		}
+		code = fmt.Sprintf("if (%s) {\n%s%s}\n", cond, branches[i], inner)
+	}
+	g.pendingPre = append(g.pendingPre, fmt.Sprintf("%s %s = %s;\n%s", t, tmp, first, code))
+	return tmp
+}
+
+// condBranch: 只在条件成立时求值的表达式，生成给 tmp 赋值的代码块（已缩进一级）；
+// simple 表示没有提前代码和语句后的释放，可以直接内联
+func (g *generator) condBranch(node interface{}, tmp, t string) (code, expr string, simple bool) {
+	mark := len(g.pendingPost)
+	pre, expr := g.exprWithPre(node.(map[string]interface{}), 1)
+	value := expr
+	if g.isRcType(t) {
+		value = g.rcRef(t, expr) // 临时变量持有自己的引用
+	}
+	post := g.takePost(mark, 1)
+	code = fmt.Sprintf("%s    %s = %s;\n%s", pre, tmp, value, post)
+	return code, expr, pre == "" && post == "" && !g.isRcType(t)
+}
+
+// truthTest: 按 Python 的真值规则判断一个值：空字符串、空列表为假
+func (g *generator) truthTest(expr, t string) string {
+	if t == "char*" {
+		return fmt.Sprintf("(%s[0] != '\\0')", expr)
+	}
+	if _, ok := g.listElemType(t); ok || g.collectionOf(t) != nil {
+		return fmt.Sprintf("(%s->len != 0)", expr)
+	}
+	if t == "PyMatch" {
+		return fmt.Sprintf("(%s).ok", expr)
+	}
+	return expr
+}
+
+// holdTemp: 登记条件表达式的结果临时变量；-refcount 下它持有一个引用，语句结束后释放
+func (g *generator) holdTemp(tmp, t string) {
+	g.declareTemp(tmp, t)
+	if g.isRcType(t) {
+		g.rcTemps[tmp] = true
+		g.pendingPost = append(g.pendingPost, g.rcRelease(tmp)+";\n")
+	}
+}
+
+// constTest: 只由常量组成的条件（True、not False、1 < 2）直接输出为 1 或 0，while True: 成为 while (1)；
+// -O 时这样的 if / while 在代码生成之前已经只留下会执行的分支
+func (g *generator) constTest(node interface{}) (string, bool) {
+	cond, ok := g.constCondition(node)
+	if !ok {
+		return "", false
+	}
+	if cond {
+		return "1", true
+	}
+	return "0", true
+}
+
+// isBoolExpr: 表达式的值是否一定是布尔值（比较、not、布尔值的 and/or）
+func isBoolExpr(node interface{}) bool {
+	m, _ := node.(map[string]interface{})
+	switch m["_type"] {
+	case "Compare":
+		return true
+	case "UnaryOp":
+		op, _ := m["op"].(map[string]interface{})
+		return op["_type"] == "Not"
+	case "BoolOp":
+		values, _ := m["values"].([]interface{})
+		for _, v := range values {
+			if !isBoolExpr(v) {
+				return false
+			}
+		}
+		return true
+	case "Constant":
+		_, ok := m["value"].(bool)
+		return ok
+	}
+	return false
+}
+
+func (g *generator) handleUnaryOp(node ASTNode, indent int) string {
+	operandNode, _ := node["operand"].(map[string]interface{})
+	operand := g.collectionTest(operandNode, g.toC(operandNode, 0))
+	if operand == "" {
+		return g.unsupportedExpr(node, "UnaryOp (empty operand)")
+	}
+	op := node["op"].(map[string]interface{})["_type"].(string)
+	if operandNode["_type"] == "Constant" && !strings.HasPrefix(operand, "-") {
+		switch op {
+		case "USub":
+			return "-" + operand
+		case "UAdd":
+			return operand
+		}
+	}
+	switch op {
+	case "USub":
+		return fmt.Sprintf("(-%s)", operand)
+	case "UAdd":
+		return fmt.Sprintf("(+%s)", operand)
+	case "Not":
+		if operandNode["_type"] == "Compare" {
+			// 比较表达式本身不带括号
+			return fmt.Sprintf("(!(%s))", operand)
+		}
+		return fmt.Sprintf("(!%s)", operand)
+	case "Invert":
+		return fmt.Sprintf("(~%s)", operand)
+	default:
+		return g.unsupportedExpr(node, fmt.Sprintf("UnaryOp: %s", op))
+	}
+}
+
+func (g *generator) handleUnsupported(node ASTNode, indent int) string {
+	typ, _ := node["_type"].(string)
+	what := "node: " + typ
+	if gen := g.genFuncs[g.currentScope]; gen != nil && gen.reason != "" && (typ == "Yield" || typ == "YieldFrom") {
+		// 不能翻译为状态机的生成器，见 yield.go
+		what += fmt.Sprintf(" (%s() cannot be translated as a generator because of %s)", gen.name, gen.reason)
+	}
+	if g.optStubs && exprNodes[typ] {
+		return g.unsupportedExpr(node, what)
+	}
+	return g.unsupportedStmt(node, strings.Repeat(" ", indent*4), what)
+}
+
+// --- joinCallArgs: 辅助函数，将 args 转为逗号分隔的 C 表达式字符串 ---
+func (g *generator) joinCallArgs(args []interface{}) string {
+	return join(g.splitCallArgs(args), ", ")
+}
+
+// --- splitCallArgs: 将 args 逐个转为 C 表达式，跳过空结果 ---
+func (g *generator) splitCallArgs(args []interface{}) []string {
+	strs := []string{}
+	for _, a := range args {
+		s := g.toC(a.(map[string]interface{}), 0)
+		if s != "" {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
+
+// --- childValues: 按字段名排序返回节点的所有子值，保证分析结果与遍历顺序无关 ---
+func childValues(n map[string]interface{}) []interface{} {
+	vals := []interface{}{}
+	for _, k := range sortedNodeKeys(n) {
+		vals = append(vals, n[k])
+	}
+	return vals
+}
+
+// --- sortedNodeKeys: 按字典序返回节点的字段名 ---
+func sortedNodeKeys(n map[string]interface{}) []string {
+	keys := []string{}
+	for k := range n {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// --- sortedKeys: 按字典序返回 map 的键，保证输出稳定 ---
+func sortedKeys[V any](m map[string]V) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// --- isObjectPointer: 类型是否为指向类实例的指针（如 Person*，不含 char*）---
+func (g *generator) isObjectPointer(typ string) bool {
+	return strings.HasSuffix(typ, "*") && g.classStructsMap[strings.TrimSuffix(typ, "*")]
+}
+
+// --- funcResultType: 推断 result 指针的类型，返回堆对象时为 类名*，否则 double ---
+func (g *generator) funcResultType(fname string, body []interface{}) string {
+	if t := g.annotReturns[fname]; t != "" {
+		if g.annotClasses[t] {
+			return t + "*"
+		}
+		return t
+	}
+	for _, stmt := range body {
+		m, ok := stmt.(map[string]interface{})
+		if !ok || m["_type"] != "Return" {
+			continue
+		}
+		if v, ok := m["value"].(map[string]interface{}); ok && v["_type"] == "Name" {
+			id, _ := v["id"].(string)
+			if cls, ok := g.objectVars[fname][id]; ok {
+				return cls + "*"
+			}
+			if lt := g.listVars[fname][id]; lt != "" {
+				return lt // 列表（PyList_T*）或 JSON 值
+			}
+		}
+		if t := g.typeIn(fname, m["value"]); t == "PyJson*" {
+			return "PyJson*"
+		} else if _, ok := g.listElemType(t); ok {
+			return t // return s.split() 等：经由 result 返回列表
+		}
+		if cls := g.ctorClass(m["value"]); cls != "" {
+			// return Rect(...)：新对象在堆上
+			return cls + "*"
+		}
+	}
+	if t := g.inferReturns[fname]; t != "" {
+		return t
+	}
+	return "double"
+}
+
+// --- analyzeEscapes: 逃逸分析 ---
+// 只在函数内部创建和使用的对象保持为栈上的结构体；被返回、存入容器、
+// 赋给其他对象的字段或被闭包捕获的对象必须分配在堆上，否则离开作用域后悬空。
+// 结果按作用域记录在 objectVars / escapeInfo 中，供代码生成与后续的所有权管理使用。
+func (g *generator) analyzeEscapes(root ASTNode) {
+	body, _ := root["body"].([]interface{})
+	classNames := map[string]bool{}
+	for _, stmt := range body {
+		if m, ok := stmt.(map[string]interface{}); ok && m["_type"] == "ClassDef" {
+			name, _ := m["name"].(string)
+			classNames[name] = true
+		}
+	}
+	mainStmts := []interface{}{}
+	for _, stmt := range body {
+		m, ok := stmt.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch m["_type"] {
+		case "FunctionDef":
+			name, _ := m["name"].(string)
+			fbody, _ := m["body"].([]interface{})
+			g.analyzeScopeEscapes(name, fbody, classNames)
+		case "ClassDef":
+			cname, _ := m["name"].(string)
+			cbody, _ := m["body"].([]interface{})
+			for _, s := range cbody {
+				if fm, ok := s.(map[string]interface{}); ok && fm["_type"] == "FunctionDef" {
+					mname, _ := fm["name"].(string)
+					fbody, _ := fm["body"].([]interface{})
+					g.analyzeScopeEscapes(cname+"."+mname, fbody, classNames)
+				}
+			}
+		default:
+			mainStmts = append(mainStmts, stmt)
+		}
+	}
+	g.analyzeScopeEscapes("", mainStmts, classNames)
+}
+
+// --- analyzeScopeEscapes: 分析单个作用域内对象变量的逃逸情况 ---
+func (g *generator) analyzeScopeEscapes(scope string, body []interface{}, classNames map[string]bool) {
+	objs := map[string]string{}      // 变量 -> 类名
+	aliases := map[string][]string{} // q = p 产生的别名关系
+	reasons := map[string]string{}   // 变量 -> 逃逸原因
+	markName := func(node interface{}, reason string) {
+		if m, ok := node.(map[string]interface{}); ok && m["_type"] == "Name" {
+			id, _ := m["id"].(string)
+			if _, seen := reasons[id]; !seen {
+				reasons[id] = reason
+			}
+		}
+	}
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		switch n := node.(type) {
+		case []interface{}:
+			for _, e := range n {
+				walk(e)
+			}
+		case map[string]interface{}:
+			switch n["_type"] {
+			case "FunctionDef", "Lambda":
+				// 嵌套函数/lambda 中引用到的变量视为被捕获
+				collectNames(n, func(id string) {
+					if _, seen := reasons[id]; !seen {
+						reasons[id] = "captured by closure"
+					}
+				})
+				return
+			case "Assign":
+				targets, _ := n["targets"].([]interface{})
+				value, _ := n["value"].(map[string]interface{})
+				for _, t := range targets {
+					tm, _ := t.(map[string]interface{})
+					switch tm["_type"] {
+					case "Name":
+						id, _ := tm["id"].(string)
+						if value["_type"] == "Call" {
+							if fn, ok := value["func"].(map[string]interface{}); ok && fn["_type"] == "Name" {
+								if cls, _ := fn["id"].(string); classNames[cls] {
+									objs[id] = cls
+								}
+							}
+						}
+						if value["_type"] == "Name" {
+							src, _ := value["id"].(string)
+							aliases[id] = append(aliases[id], src)
+							aliases[src] = append(aliases[src], id)
+						}
+					case "Subscript":
+						markName(value, "stored into container")
+					case "Attribute":
+						markName(value, "stored into object field")
+					}
+				}
+			case "Return":
+				markName(n["value"], "returned")
+				if v, ok := n["value"].(map[string]interface{}); ok && v["_type"] == "Tuple" {
+					elts, _ := v["elts"].([]interface{})
+					for _, e := range elts {
+						markName(e, "returned")
+					}
+				}
+			case "List", "Tuple", "Set":
+				elts, _ := n["elts"].([]interface{})
+				for _, e := range elts {
+					markName(e, "stored into container")
+				}
+			case "Dict":
+				vals, _ := n["values"].([]interface{})
+				for _, v := range vals {
+					markName(v, "stored into container")
+				}
+			case "Call":
+				if fn, ok := n["func"].(map[string]interface{}); ok && fn["_type"] == "Name" && classNames[fmt.Sprint(fn["id"])] {
+					// 构造参数中的对象可能存为新对象的字段，比创建它的作用域活得更久
+					args, _ := n["args"].([]interface{})
+					for _, a := range args {
+						markName(a, "passed to constructor "+fmt.Sprint(fn["id"]))
+					}
+				}
+				if fn, ok := n["func"].(map[string]interface{}); ok && fn["_type"] == "Attribute" {
+					switch fn["attr"] {
+					case "append", "insert", "add", "extend", "appendleft":
+						args, _ := n["args"].([]interface{})
+						for _, a := range args {
+							markName(a, "stored into container")
+						}
+					}
+				}
+			}
+			for _, v := range childValues(n) {
+				walk(v)
+			}
+		}
+	}
+	walk(body)
+	// 别名传播：q = p 之后 q 逃逸则 p 也逃逸
+	queue := []string{}
+	for id := range reasons {
+		queue = append(queue, id)
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, other := range aliases[id] {
+			if _, seen := reasons[other]; !seen {
+				reasons[other] = reasons[id]
+				queue = append(queue, other)
+			}
+		}
+	}
+	g.objectVars[scope] = objs
+	g.escapeInfo[scope] = map[string]string{}
+	for id := range objs {
+		if r, ok := reasons[id]; ok {
+			g.escapeInfo[scope][id] = r
+		}
+	}
+}
+
+// --- collectNames: 遍历子树，对每个 Name 节点回调其 id ---
+func collectNames(node interface{}, fn func(id string)) {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			collectNames(e, fn)
+		}
+	case map[string]interface{}:
+		if n["_type"] == "Name" {
+			if id, ok := n["id"].(string); ok {
+				fn(id)
+			}
+		}
+		for _, v := range n {
+			collectNames(v, fn)
+		}
+	}
+}
+
+// collectFuncNodes: 登记顶层函数的节点（analyzePurity 之前就要用到 funcNodes 的分析）
+func (g *generator) collectFuncNodes(root ASTNode) {
+	body, _ := root["body"].([]interface{})
+	for _, stmt := range body {
+		if m, _ := stmt.(map[string]interface{}); m["_type"] == "FunctionDef" {
+			g.funcNodes[fmt.Sprint(m["name"])] = m
+		}
+	}
+}
+
+// --- 纯函数分析 ---
+// 没有 I/O、不写全局变量、不修改参数/对象、只调用纯函数的函数视为纯函数。
+// 先逐个函数做局部检查，再沿调用图迭代到不动点（递归调用乐观地视为纯）。
+var pureBuiltins = map[string]bool{"abs": true, "min": true, "max": true, "len": true, "round": true, "int": true, "float": true, "str": true, "bool": true, "pow": true, "range": true, "sum": true}
+var ioBuiltins = map[string]bool{"print": true, "input": true, "open": true, "exit": true, "quit": true}
+
+func (g *generator) analyzePurity(root ASTNode) {
+	body, _ := root["body"].([]interface{})
+	type fnEntry struct {
+		key, class string
+		node       map[string]interface{}
+	}
+	entries := []fnEntry{}
+	methods := map[string]bool{}
+	for _, stmt := range body {
+		m, ok := stmt.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch m["_type"] {
+		case "FunctionDef":
+			name, _ := m["name"].(string)
+			g.funcNodes[name] = m
+			entries = append(entries, fnEntry{name, "", m})
+		case "ClassDef":
+			cname, _ := m["name"].(string)
+			cbody, _ := m["body"].([]interface{})
+			for _, s := range cbody {
+				if fm, ok := s.(map[string]interface{}); ok && fm["_type"] == "FunctionDef" {
+					mname, _ := fm["name"].(string)
+					methods[cname+"."+mname] = true
+					entries = append(entries, fnEntry{cname + "." + mname, cname, fm})
+				}
+			}
+		}
+	}
+	callees := map[string][]string{}
+	for _, e := range entries {
+		reason, calls := g.localImpurity(e.node, e.class, methods)
+		if e.node["_cextern"] == true {
+			reason = "implemented in C" // 不知道 C 函数做什么，不能在翻译时求值
+		}
+		g.funcPurity[e.key] = reason
+		callees[e.key] = calls
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, e := range entries {
+			if g.funcPurity[e.key] != "" {
+				continue
+			}
+			for _, c := range callees[e.key] {
+				if g.funcPurity[c] != "" {
+					g.funcPurity[e.key] = "calls impure function " + c
+					changed = true
+					break
+				}
+			}
+		}
+	}
+}
+
+// --- localImpurity: 检查单个函数体本身的副作用，返回原因与调用到的用户函数 ---
+func (g *generator) localImpurity(fn map[string]interface{}, class string, methods map[string]bool) (string, []string) {
+	reason := ""
+	calls := []string{}
+	setReason := func(r string) {
+		if reason == "" {
+			reason = r
+		}
+	}
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		switch n := node.(type) {
+		case []interface{}:
+			for _, e := range n {
+				walk(e)
+			}
+		case map[string]interface{}:
+			switch n["_type"] {
+			case "FunctionDef", "Lambda", "ClassDef":
+				return
+			case "Global", "Nonlocal":
+				names, _ := n["names"].([]interface{})
+				if len(names) > 0 {
+					setReason(fmt.Sprintf("writes global %v", names[0]))
+				}
+			case "Assign", "AugAssign":
+				targets, _ := n["targets"].([]interface{})
+				if t, ok := n["target"]; ok {
+					targets = append(targets, t)
+				}
+				for _, t := range targets {
+					tm, _ := t.(map[string]interface{})
+					switch tm["_type"] {
+					case "Attribute":
+						if v, ok := tm["value"].(map[string]interface{}); ok && v["id"] == "self" && class != "" {
+							setReason("mutates self")
+						} else if id, _ := v["id"].(string); g.annotClasses[id] {
+							setReason(fmt.Sprintf("writes class attribute %s.%v", id, tm["attr"]))
+						} else {
+							setReason("mutates object attribute")
+						}
+					case "Subscript":
+						setReason("mutates container")
+					}
+				}
+			case "Call":
+				fnNode, _ := n["func"].(map[string]interface{})
+				switch fnNode["_type"] {
+				case "Name":
+					id, _ := fnNode["id"].(string)
+					if ioBuiltins[id] {
+						setReason("performs I/O (" + id + ")")
+					} else if _, ok := g.funcNodes[id]; ok {
+						calls = append(calls, id)
+					} else if g.functionalCall(n) != "" || id == "list" && g.functionalArg(n) {
+						calls = append(calls, g.functionalCallee(n)...)
+					} else if !pureBuiltins[id] && g.itertoolsCall(n) == "" {
+						setReason("calls " + id)
+					}
+				case "Attribute":
+					recv, _ := fnNode["value"].(map[string]interface{})
+					attr, _ := fnNode["attr"].(string)
+					if recv["id"] == "math" || g.itertoolsCall(n) != "" {
+						break
+					}
+					if g.functionalCall(n) != "" {
+						calls = append(calls, g.functionalCallee(n)...)
+						break
+					}
+					if recv["id"] == "self" && methods[class+"."+attr] {
+						calls = append(calls, class+"."+attr)
+					} else if id, _ := recv["id"].(string); methods[id+"."+attr] {
+						calls = append(calls, id+"."+attr)
+					} else {
+						setReason(fmt.Sprintf("calls method %s", attr))
+					}
+				default:
+					setReason("calls unknown function")
+				}
+			}
+			for _, v := range childValues(n) {
+				walk(v)
+			}
+		}
+	}
+	walk(fn["body"])
+	return reason, calls
+}
+
+// --- purityComment: 为审阅者输出函数的纯度说明 ---
+func (g *generator) purityComment(key, pad string) string {
+	reason, ok := g.funcPurity[key]
+	if !ok {
+		return ""
+	}
+	if reason == "" {
+		return pad + "// pure: no I/O or global writes\n"
+	}
+	return pad + "// impure: " + reason + "\n"
+}
+
+// --- 编译期常量求值 ---
+// constVal 表示 Python 的 int / float / bool 常量
+type constVal struct {
+	kind byte // 'i' int, 'f' float, 'b' bool
+	i    int64
+	f    float64
+}
+
+func (v constVal) num() float64 {
+	if v.kind == 'f' {
+		return v.f
+	}
+	return float64(v.i)
+}
+
+func (v constVal) truthy() bool {
+	if v.kind == 'f' {
+		return v.f != 0
+	}
+	return v.i != 0
+}
+
+func intVal(i int64) constVal     { return constVal{kind: 'i', i: i} }
+func floatVal(f float64) constVal { return constVal{kind: 'f', f: f} }
+func boolVal(b bool) constVal {
+	if b {
+		return constVal{kind: 'b', i: 1}
+	}
+	return constVal{kind: 'b', i: 0}
+}
+
+// --- foldPureCall: 调用纯函数且实参全为常量时，在编译期求值，返回 C 字面量 ---
+func (g *generator) foldPureCall(call map[string]interface{}) (string, bool) {
+	fn, ok := call["func"].(map[string]interface{})
+	if !ok || fn["_type"] != "Name" {
+		return "", false
+	}
+	name, _ := fn["id"].(string)
+	if _, ok := g.funcNodes[name]; !ok {
+		return "", false
+	}
+	args, _ := call["args"].([]interface{})
+	vals := []constVal{}
+	for _, a := range args {
+		v, ok := g.evalConstExpr(a, map[string]constVal{}, 0)
+		if !ok {
+			return "", false
+		}
+		vals = append(vals, v)
+	}
+	g.foldBudget = 10000
+	v, ok := g.evalPureCall(name, vals, 0)
+	if !ok || math.IsInf(v.num(), 0) || math.IsNaN(v.num()) {
+		return "", false
+	}
+	if g.funcResultTypes[name] == "int" {
+		// 注解为 int 的返回值：与 C 中赋给 int 一样截断
+		return strconv.FormatInt(int64(v.num()), 10), true
+	}
+	// 其余 result 指针为 double，字面量也输出为浮点形式
+	lit := strconv.FormatFloat(v.num(), 'g', -1, 64)
+	if v.num() == math.Trunc(v.num()) && math.Abs(v.num()) < 1e15 {
+		lit = strconv.FormatFloat(v.num(), 'f', -1, 64)
+	}
+	if !strings.ContainsAny(lit, ".eE") {
+		lit += ".0"
+	}
+	return lit, true
+}
+
+// --- evalPureCall: 解释执行一个纯函数 ---
+func (g *generator) evalPureCall(name string, args []constVal, depth int) (constVal, bool) {
+	fn, ok := g.funcNodes[name]
+	if !ok || g.funcPurity[name] != "" || depth > 64 {
+		return constVal{}, false
+	}
+	argsNode, _ := fn["args"].(map[string]interface{})
+	params, _ := argsNode["args"].([]interface{})
+	if len(params) != len(args) {
+		return constVal{}, false
+	}
+	env := map[string]constVal{}
+	for i, p := range params {
+		pn, _ := p.(map[string]interface{})
+		id, _ := pn["arg"].(string)
+		env[id] = args[i]
+	}
+	body, _ := fn["body"].([]interface{})
+	v, sig, ok := g.execConstBlock(body, env, depth)
+	if !ok || sig != "return" {
+		return constVal{}, false
+	}
+	return v, true
+}
+
+// --- execConstBlock: 执行语句块，sig 为 "return" / "break" / "continue" / "" ---
+func (g *generator) execConstBlock(stmts []interface{}, env map[string]constVal, depth int) (constVal, string, bool) {
+	for _, s := range stmts {
+		g.foldBudget--
+		if g.foldBudget < 0 {
+			return constVal{}, "", false
+		}
+		m, ok := s.(map[string]interface{})
+		if !ok {
+			return constVal{}, "", false
+		}
+		switch m["_type"] {
+		case "Pass":
+		case "Expr":
+			// 只允许文档字符串之类的常量表达式
+			if v, ok := m["value"].(map[string]interface{}); !ok || v["_type"] != "Constant" {
+				return constVal{}, "", false
+			}
+		case "Assign":
+			targets, _ := m["targets"].([]interface{})
+			if len(targets) != 1 {
+				return constVal{}, "", false
+			}
+			t, _ := targets[0].(map[string]interface{})
+			id, isName := t["id"].(string)
+			v, ok := g.evalConstExpr(m["value"], env, depth)
+			if t["_type"] != "Name" || !isName || !ok {
+				return constVal{}, "", false
+			}
+			env[id] = v
+		case "AugAssign":
+			t, _ := m["target"].(map[string]interface{})
+			id, _ := t["id"].(string)
+			cur, ok := env[id]
+			if t["_type"] != "Name" || !ok {
+				return constVal{}, "", false
+			}
+			rhs, ok := g.evalConstExpr(m["value"], env, depth)
+			if !ok {
+				return constVal{}, "", false
+			}
+			op, _ := m["op"].(map[string]interface{})
+			opName, _ := op["_type"].(string)
+			v, ok := evalConstBinOp(opName, cur, rhs)
+			if !ok {
+				return constVal{}, "", false
+			}
+			env[id] = v
+		case "Return":
+			if m["value"] == nil {
+				return constVal{}, "", false
+			}
+			v, ok := g.evalConstExpr(m["value"], env, depth)
+			return v, "return", ok
+		case "If":
+			cond, ok := g.evalConstExpr(m["test"], env, depth)
+			if !ok {
+				return constVal{}, "", false
+			}
+			branch, _ := m["body"].([]interface{})
+			if !cond.truthy() {
+				branch, _ = m["orelse"].([]interface{})
+			}
+			v, sig, ok := g.execConstBlock(branch, env, depth)
+			if !ok || sig != "" {
+				return v, sig, ok
+			}
+		case "While":
+			for {
+				cond, ok := g.evalConstExpr(m["test"], env, depth)
+				if !ok {
+					return constVal{}, "", false
+				}
+				if !cond.truthy() {
+					break
+				}
+				body, _ := m["body"].([]interface{})
+				v, sig, ok := g.execConstBlock(body, env, depth)
+				if !ok || sig == "return" {
+					return v, sig, ok
+				}
+				if sig == "break" {
+					break
+				}
+			}
+		case "For":
+			t, _ := m["target"].(map[string]interface{})
+			id, _ := t["id"].(string)
+			iter, _ := m["iter"].(map[string]interface{})
+			fnNode, _ := iter["func"].(map[string]interface{})
+			rargs, _ := iter["args"].([]interface{})
+			if t["_type"] != "Name" || fnNode["id"] != "range" || len(rargs) == 0 || len(rargs) > 3 {
+				return constVal{}, "", false
+			}
+			bounds := []int64{0, 0, 1}
+			for i, a := range rargs {
+				v, ok := g.evalConstExpr(a, env, depth)
+				if !ok || v.kind == 'f' {
+					return constVal{}, "", false
+				}
+				if len(rargs) == 1 {
+					bounds[1] = v.i
+				} else {
+					bounds[i] = v.i
+				}
+			}
+			if bounds[2] == 0 {
+				return constVal{}, "", false
+			}
+			body, _ := m["body"].([]interface{})
+			for x := bounds[0]; (bounds[2] > 0 && x < bounds[1]) || (bounds[2] < 0 && x > bounds[1]); x += bounds[2] {
+				env[id] = intVal(x)
+				v, sig, ok := g.execConstBlock(body, env, depth)
+				if !ok || sig == "return" {
+					return v, sig, ok
+				}
+				if sig == "break" {
+					break
+				}
+			}
+		case "Break":
+			return constVal{}, "break", true
+		case "Continue":
+			return constVal{}, "continue", true
+		default:
+			return constVal{}, "", false
+		}
+	}
+	return constVal{}, "", true
+}
+
+// --- evalConstExpr: 求值常量表达式，无法在编译期确定时返回 false ---
+func (g *generator) evalConstExpr(node interface{}, env map[string]constVal, depth int) (constVal, bool) {
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return constVal{}, false
+	}
+	switch m["_type"] {
+	case "Constant":
+		switch v := m["value"].(type) {
+		case json.Number:
+			if !strings.ContainsAny(v.String(), ".eE") {
+				i, err := v.Int64()
+				return intVal(i), err == nil
+			}
+			f, err := v.Float64()
+			return floatVal(f), err == nil
+		case bool:
+			return boolVal(v), true
+		}
+	case "Name":
+		v, ok := env[m["id"].(string)]
+		return v, ok
+	case "UnaryOp":
+		v, ok := g.evalConstExpr(m["operand"], env, depth)
+		if !ok {
+			return constVal{}, false
+		}
+		op, _ := m["op"].(map[string]interface{})
+		switch op["_type"] {
+		case "USub":
+			if v.kind == 'f' {
+				return floatVal(-v.f), true
+			}
+			return intVal(-v.i), true
+		case "UAdd":
+			return v, true
+		case "Not":
+			return boolVal(!v.truthy()), true
+		case "Invert":
+			if v.kind != 'f' {
+				return intVal(^v.i), true
+			}
+		}
+	case "BinOp":
+		l, ok1 := g.evalConstExpr(m["left"], env, depth)
+		r, ok2 := g.evalConstExpr(m["right"], env, depth)
+		if !ok1 || !ok2 {
+			return constVal{}, false
+		}
+		op, _ := m["op"].(map[string]interface{})
+		opName, _ := op["_type"].(string)
+		return evalConstBinOp(opName, l, r)
+	case "Compare":
+		left, ok := g.evalConstExpr(m["left"], env, depth)
+		if !ok {
+			return constVal{}, false
+		}
+		ops, _ := m["ops"].([]interface{})
+		comps, _ := m["comparators"].([]interface{})
+		if len(ops) != len(comps) {
+			return constVal{}, false
+		}
+		for i := range ops {
+			right, ok := g.evalConstExpr(comps[i], env, depth)
+			if !ok {
+				return constVal{}, false
+			}
+			op, _ := ops[i].(map[string]interface{})
+			a, b := left.num(), right.num()
+			res := false
+			switch op["_type"] {
+			case "Eq":
+				res = a == b
+			case "NotEq":
+				res = a != b
+			case "Lt":
+				res = a < b
+			case "LtE":
+				res = a <= b
+			case "Gt":
+				res = a > b
+			case "GtE":
+				res = a >= b
+			default:
+				return constVal{}, false
+			}
+			if !res {
+				return boolVal(false), true
+			}
+			left = right
+		}
+		return boolVal(true), true
+	case "BoolOp":
+		op, _ := m["op"].(map[string]interface{})
+		values, _ := m["values"].([]interface{})
+		var v constVal
+		for _, e := range values {
+			var ok bool
+			v, ok = g.evalConstExpr(e, env, depth)
+			if !ok {
+				return constVal{}, false
+			}
+			if (op["_type"] == "And") != v.truthy() {
+				return v, true
+			}
+		}
+		return v, len(values) > 0
+	case "IfExp":
+		cond, ok := g.evalConstExpr(m["test"], env, depth)
+		if !ok {
+			return constVal{}, false
+		}
+		if cond.truthy() {
+			return g.evalConstExpr(m["body"], env, depth)
+		}
+		return g.evalConstExpr(m["orelse"], env, depth)
+	case "Call":
+		fn, _ := m["func"].(map[string]interface{})
+		name, _ := fn["id"].(string)
+		args, _ := m["args"].([]interface{})
+		vals := []constVal{}
+		for _, a := range args {
+			v, ok := g.evalConstExpr(a, env, depth)
+			if !ok {
+				return constVal{}, false
+			}
+			vals = append(vals, v)
+		}
+		switch name {
+		case "abs":
+			if len(vals) == 1 {
+				if vals[0].kind == 'f' {
+					return floatVal(math.Abs(vals[0].f)), true
+				}
+				if vals[0].i < 0 {
+					return intVal(-vals[0].i), true
+				}
+				return intVal(vals[0].i), true
+			}
+		case "min", "max":
+			if len(vals) > 0 {
+				best := vals[0]
+				for _, v := range vals[1:] {
+					if (name == "min" && v.num() < best.num()) || (name == "max" && v.num() > best.num()) {
+						best = v
+					}
+				}
+				return best, true
+			}
+		case "int":
+			if len(vals) == 1 {
+				return intVal(int64(vals[0].num())), true
+			}
+		case "float":
+			if len(vals) == 1 {
+				return floatVal(vals[0].num()), true
+			}
+		default:
+			if fn["_type"] == "Name" {
+				return g.evalPureCall(name, vals, depth+1)
+			}
+		}
+	}
+	return constVal{}, false
+}
+
+// --- evalConstBinOp: 按 Python 语义计算二元运算（整数除法向下取整、余数与除数同号）---
+func evalConstBinOp(op string, l, r constVal) (constVal, bool) {
+	bothInt := l.kind != 'f' && r.kind != 'f'
+	switch op {
+	case "Add":
+		if bothInt {
+			return intVal(l.i + r.i), true
+		}
+		return floatVal(l.num() + r.num()), true
+	case "Sub":
+		if bothInt {
+			return intVal(l.i - r.i), true
+		}
+		return floatVal(l.num() - r.num()), true
+	case "Mult":
+		if bothInt {
+			return intVal(l.i * r.i), true
+		}
+		return floatVal(l.num() * r.num()), true
+	case "Div":
+		if r.num() == 0 {
+			return constVal{}, false
+		}
+		return floatVal(l.num() / r.num()), true
+	case "FloorDiv":
+		if r.num() == 0 {
+			return constVal{}, false
+		}
+		if bothInt {
+			q := l.i / r.i
+			if (l.i%r.i != 0) && ((l.i < 0) != (r.i < 0)) {
+				q--
+			}
+			return intVal(q), true
+		}
+		return floatVal(math.Floor(l.num() / r.num())), true
+	case "Mod":
+		if r.num() == 0 {
+			return constVal{}, false
+		}
+		if bothInt {
+			m := l.i % r.i
+			if m != 0 && ((m < 0) != (r.i < 0)) {
+				m += r.i
+			}
+			return intVal(m), true
+		}
+		m := math.Mod(l.num(), r.num())
+		if m != 0 && ((m < 0) != (r.num() < 0)) {
+			m += r.num()
+		}
+		return floatVal(m), true
+	case "Pow":
+		if bothInt && r.i >= 0 {
+			res := int64(1)
+			for k := int64(0); k < r.i; k++ {
+				res *= l.i
+			}
+			return intVal(res), true
+		}
+		return floatVal(math.Pow(l.num(), r.num())), true
+	}
+	return constVal{}, false
+}
+
+// --- 继承辅助 ---
+
+// classFieldType: 沿继承链查找字段类型，找不到返回空串
+func (g *generator) classFieldType(class, attr string) string {
+	for c := class; c != ""; c = g.classBases[c] {
+		if t, ok := g.classFields[c][attr]; ok {
+			return t
+		}
+	}
+	return ""
+}
+
+// classHasField: 字段是否已在 class 或其祖先中声明
+func (g *generator) classHasField(class, attr string) bool {
+	return g.classFieldType(class, attr) != ""
+}
+
+// fieldAccessPath: 继承来的字段需要经过 base 成员访问，如 base.base.name
+func (g *generator) fieldAccessPath(class, attr string) string {
+	path := ""
+	for c := class; c != ""; c = g.classBases[c] {
+		if _, ok := g.classFields[c][attr]; ok {
+			return path + attr
+		}
+		path += "base."
+	}
+	return attr
+}
+
+// ancestorPath: 从 class 到祖先类 ancestor 的 base 成员路径，不是祖先时返回 false
+func (g *generator) ancestorPath(class, ancestor string) (string, bool) {
+	path := ""
+	for c := g.classBases[class]; c != ""; c = g.classBases[c] {
+		path += "base."
+		if c == ancestor {
+			return strings.TrimSuffix(path, "."), true
+		}
+	}
+	return "", false
+}
+
+// --- handleBaseMethodCall: super().m(...) 与 Base.m(self, ...) 转为对父类函数的直接调用 ---
+func (g *generator) handleBaseMethodCall(fn map[string]interface{}, call map[string]interface{}) (string, bool) {
+	method, _ := fn["attr"].(string)
+	recv, _ := fn["value"].(map[string]interface{})
+	args, _ := call["args"].([]interface{})
+	target := ""
+	if recv["_type"] == "Call" {
+		if sf, ok := recv["func"].(map[string]interface{}); ok && sf["id"] == "super" {
+			target = g.classBases[g.currentClass]
+		}
+		if target == "" {
+			return "", false
+		}
+	} else if recv["_type"] == "Name" && len(args) > 0 {
+		id, _ := recv["id"].(string)
+		first, _ := args[0].(map[string]interface{})
+		if !g.classStructsMap[id] || first["id"] != "self" {
+			return "", false
+		}
+		target = id
+		args = args[1:]
+	} else {
+		return "", false
+	}
+	path, ok := g.ancestorPath(g.currentClass, target)
+	if !ok {
+		return "", false
+	}
+	callArgs := append([]string{"&self->" + path}, g.splitCallArgs(args)...)
+	return fmt.Sprintf("%s_%s(%s)", target, method, join(callArgs, ", ")), true
+}
+
+// initParamTypes: 类（没有 __init__ 时为定义了 __init__ 的祖先）的构造参数推断出的类型，见 inferTypes
+func (g *generator) initParamTypes(class string) []string {
+	for c := class; c != ""; c = g.preClassBases[c] {
+		if types, ok := g.inferParams[c+".__init__"]; ok {
+			return types
+		}
+	}
+	return nil
+}
+
+// hasInit: 类或它的某个祖先定义了 __init__（都没有时不生成构造函数，实例化时也不调用）
+func (g *generator) hasInit(class string) bool {
+	for c := class; c != ""; c = g.preClassBases[c] {
+		if _, ok := g.inferParams[c+".__init__"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// --- collectSuperInitArgTypes: 把子类实例化与 super().__init__ 的实参类型传给父类构造函数 ---
+// 子类总是定义在父类之后，逆序处理可以让孙类的类型先传到子类再传到父类
+func (g *generator) collectSuperInitArgTypes(root ASTNode) {
+	body, _ := root["body"].([]interface{})
+	for i := len(body) - 1; i >= 0; i-- {
+		cls, ok := body[i].(map[string]interface{})
+		if !ok || cls["_type"] != "ClassDef" {
+			continue
+		}
+		name, _ := cls["name"].(string)
+		bases, _ := cls["bases"].([]interface{})
+		if len(bases) == 0 {
+			continue
+		}
+		b, _ := bases[0].(map[string]interface{})
+		base, _ := b["id"].(string)
+		if base == "" {
+			continue
+		}
+		var initNode map[string]interface{}
+		cbody, _ := cls["body"].([]interface{})
+		for _, s := range cbody {
+			if m, ok := s.(map[string]interface{}); ok && m["_type"] == "FunctionDef" && m["name"] == "__init__" {
+				initNode = m
+			}
+		}
+		if initNode == nil {
+			g.classInitArgTypes[base] = append(g.classInitArgTypes[base], g.classInitArgTypes[name]...)
+			continue
+		}
+		paramIndex := map[string]int{}
+		argsNode, _ := initNode["args"].(map[string]interface{})
+		params, _ := argsNode["args"].([]interface{})
+		for j, p := range params {
+			if j == 0 {
+				continue
+			}
+			pm, _ := p.(map[string]interface{})
+			id, _ := pm["arg"].(string)
+			paramIndex[id] = j - 1
+		}
+		var walk func(node interface{})
+		walk = func(node interface{}) {
+			switch n := node.(type) {
+			case []interface{}:
+				for _, e := range n {
+					walk(e)
+				}
+			case map[string]interface{}:
+				if n["_type"] == "Call" {
+					fn, _ := n["func"].(map[string]interface{})
+					recv, _ := fn["value"].(map[string]interface{})
+					args, _ := n["args"].([]interface{})
+					isSuper := false
+					if fn["_type"] == "Attribute" && fn["attr"] == "__init__" {
+						if sf, ok := recv["func"].(map[string]interface{}); ok && sf["id"] == "super" {
+							isSuper = true
+						} else if recv["id"] == base && len(args) > 0 {
+							isSuper = true
+							args = args[1:]
+						}
+					}
+					if isSuper {
+						calls := g.classInitArgTypes[name]
+						if len(calls) == 0 {
+							calls = [][]string{{}}
+						}
+						for _, row := range calls {
+							types := []string{}
+							for _, a := range args {
+								am, _ := a.(map[string]interface{})
+								id, _ := am["id"].(string)
+								if j, ok := paramIndex[id]; ok && am["_type"] == "Name" && j < len(row) {
+									types = append(types, row[j])
+								} else {
+									types = append(types, g.getType(a))
+								}
+							}
+							g.classInitArgTypes[base] = append(g.classInitArgTypes[base], types)
+						}
+					}
+				}
+				for _, v := range n {
+					walk(v)
+				}
+			}
+		}
+		walk(initNode["body"])
+	}
+}
+
+// --- simpleGetterField: 方法体只有 return self.x（可带文档字符串）时返回字段名 x ---
+func simpleGetterField(fn map[string]interface{}) (string, bool) {
+	argsNode, _ := fn["args"].(map[string]interface{})
+	if params, _ := argsNode["args"].([]interface{}); len(params) != 1 {
+		return "", false
+	}
+	body, _ := fn["body"].([]interface{})
+	if len(body) == 2 {
+		if doc, ok := body[0].(map[string]interface{}); ok && doc["_type"] == "Expr" {
+			if v, ok := doc["value"].(map[string]interface{}); ok && v["_type"] == "Constant" {
+				body = body[1:]
+			}
+		}
+	}
+	if len(body) != 1 {
+		return "", false
+	}
+	ret, _ := body[0].(map[string]interface{})
+	if ret["_type"] != "Return" {
+		return "", false
+	}
+	val, _ := ret["value"].(map[string]interface{})
+	if val["_type"] != "Attribute" {
+		return "", false
+	}
+	recv, _ := val["value"].(map[string]interface{})
+	if recv["_type"] != "Name" || recv["id"] != "self" {
+		return "", false
+	}
+	attr, ok := val["attr"].(string)
+	return attr, ok
+}
+
+// --- 循环不变量外提（LICM）---
+// 对 range 循环体做一次 AST 层面的变换：只由常量和循环内未被赋值的变量组成的
+// 算术子表达式提到循环前的临时变量中，循环体内改为引用临时变量。
+// 变换作用在循环体的副本上，不修改原 AST。
+
+// newTemp: 生成唯一的临时变量名
+func (g *generator) newTemp(prefix string) string {
+	name := fmt.Sprintf("%s%d", prefix, g.tempCounter)
+	g.tempCounter++
+	return name
+}
+
+// loopTempType: 临时变量的 C 类型，整型表达式保持 int
+func (g *generator) loopTempType(expr interface{}) string {
+	if g.isIntExpr(expr) {
+		return "int"
+	}
+	return "double"
+}
+
+// assignedNames: 收集语句块中所有被赋值的变量名（含嵌套循环变量）
+func assignedNames(stmts []interface{}) map[string]bool {
+	names := map[string]bool{}
+	var addTarget func(t interface{})
+	addTarget = func(t interface{}) {
+		tm, _ := t.(map[string]interface{})
+		switch tm["_type"] {
+		case "Name":
+			id, _ := tm["id"].(string)
+			names[id] = true
+		case "Tuple", "List":
+			elts, _ := tm["elts"].([]interface{})
+			for _, e := range elts {
+				addTarget(e)
+			}
+		}
+	}
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		switch n := node.(type) {
+		case []interface{}:
+			for _, e := range n {
+				walk(e)
+			}
+		case map[string]interface{}:
+			switch n["_type"] {
+			case "Assign":
+				targets, _ := n["targets"].([]interface{})
+				for _, t := range targets {
+					addTarget(t)
+				}
+			case "AugAssign", "AnnAssign", "For":
+				addTarget(n["target"])
+			case "Global", "Nonlocal":
+				ids, _ := n["names"].([]interface{})
+				for _, id := range ids {
+					if s, ok := id.(string); ok {
+						names[s] = true
+					}
+				}
+			}
+			for _, v := range n {
+				walk(v)
+			}
+		}
+	}
+	walk(stmts)
+	return names
+}
+
+// isLoopInvariant: 表达式只含数字常量和未在循环内赋值的变量
+func (g *generator) isLoopInvariant(node interface{}, assigned map[string]bool) bool {
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	switch m["_type"] {
+	case "Constant":
+		_, isNum := m["value"].(json.Number)
+		return isNum
+	case "Name":
+		id, _ := m["id"].(string)
+		return !assigned[id] && !g.classStructsMap[id] && g.getType(m) != "char*"
+	case "UnaryOp":
+		return g.isLoopInvariant(m["operand"], assigned)
+	case "BinOp":
+		op, _ := m["op"].(map[string]interface{})
+		switch op["_type"] {
+		case "Add", "Sub", "Mult", "Div", "Pow":
+			// 取模/整除提前求值可能在循环不执行时引入除零，不外提
+			return g.isLoopInvariant(m["left"], assigned) && g.isLoopInvariant(m["right"], assigned)
+		}
+	}
+	return false
+}
+
+// isHoistable: 值得外提的不变表达式——至少含一个变量的二元运算
+func (g *generator) isHoistable(node interface{}, assigned map[string]bool) bool {
+	m, ok := node.(map[string]interface{})
+	if !ok || m["_type"] != "BinOp" || !g.isLoopInvariant(m, assigned) {
+		return false
+	}
+	hasName := false
+	collectNames(m, func(string) { hasName = true })
+	return hasName
+}
+
+// hoistLoopInvariants: 返回替换后的循环体副本与需要放在循环前的声明
+func (g *generator) hoistLoopInvariants(body []interface{}, assigned map[string]bool, pad string) ([]interface{}, string) {
+	copied := deepCopyNode(body).([]interface{})
+	decls := ""
+	temps := map[string]string{} // C 表达式 -> 临时变量，相同的不变表达式只计算一次
+	hoist := func(expr map[string]interface{}) map[string]interface{} {
+		code := g.toC(expr, 0)
+		tmp, ok := temps[code]
+		if !ok {
+			tmp = g.newTemp("_inv")
+			temps[code] = tmp
+			decls += fmt.Sprintf("%s%s %s = %s;\n", pad, g.loopTempType(expr), tmp, code)
+		}
+		g.declareTemp(tmp, g.loopTempType(expr))
+		return map[string]interface{}{"_type": "Name", "id": tmp, "ctx": map[string]interface{}{"_type": "Load"}}
+	}
+	var visit func(node interface{})
+	visit = func(node interface{}) {
+		switch n := node.(type) {
+		case []interface{}:
+			for i, e := range n {
+				if em, ok := e.(map[string]interface{}); ok && g.isHoistable(em, assigned) {
+					n[i] = hoist(em)
+					continue
+				}
+				visit(e)
+			}
+		case map[string]interface{}:
+			switch n["_type"] {
+			case "FunctionDef", "Lambda", "ClassDef":
+				return
+			}
+			for _, k := range sortedNodeKeys(n) {
+				if em, ok := n[k].(map[string]interface{}); ok && g.isHoistable(em, assigned) {
+					n[k] = hoist(em)
+					continue
+				}
+				visit(n[k])
+			}
+		}
+	}
+	visit(copied)
+	return copied, decls
+}
+
+// deepCopyNode: 深拷贝 AST 子树
+func deepCopyNode(node interface{}) interface{} {
+	switch n := node.(type) {
+	case []interface{}:
+		out := make([]interface{}, len(n))
+		for i, e := range n {
+			out[i] = deepCopyNode(e)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(n))
+		for k, v := range n {
+			out[k] = deepCopyNode(v)
+		}
+		return out
+	}
+	return node
+}
+
+// --- analyzeVirtuals: 预扫描类层次，找出被子类重写的方法 ---
+// 方法 m 在某个子类中被重写时，最早定义 m 的祖先类 I 为其引入一个虚表槽位；
+// 层次中的每个类都有自己的虚表（首成员嵌入父类虚表），对象的虚表指针放在根类中。
+func (g *generator) analyzeVirtuals(root ASTNode) {
+	body, _ := root["body"].([]interface{})
+	order := []string{}
+	for _, stmt := range body {
+		m, ok := stmt.(map[string]interface{})
+		if !ok || m["_type"] != "ClassDef" {
+			continue
+		}
+		name, _ := m["name"].(string)
+		order = append(order, name)
+		if bases, _ := m["bases"].([]interface{}); len(bases) > 0 {
+			if b, ok := bases[0].(map[string]interface{}); ok && b["_type"] == "Name" {
+				if id, _ := b["id"].(string); g.preClassMethods[id] != nil {
+					g.preClassBases[name] = id
+				}
+			}
+		}
+		g.preClassMethods[name] = []string{}
+		cbody, _ := m["body"].([]interface{})
+		for _, s := range cbody {
+			if fm, ok := s.(map[string]interface{}); ok && fm["_type"] == "FunctionDef" && fm["name"] != "__init__" && !g.staticMethods[fmt.Sprintf("%s.%v", name, fm["name"])] {
+				g.preClassMethods[name] = append(g.preClassMethods[name], fm["name"].(string))
+			}
+		}
+	}
+	definesOwn := func(class, method string) bool {
+		for _, m := range g.preClassMethods[class] {
+			if m == method {
+				return true
+			}
+		}
+		return false
+	}
+	slotSet := map[string]bool{}
+	for _, name := range order {
+		for _, m := range g.preClassMethods[name] {
+			top := name
+			for c := g.preClassBases[name]; c != ""; c = g.preClassBases[c] {
+				if definesOwn(c, m) {
+					top = c
+				}
+			}
+			if top != name && !slotSet[top+"."+m] {
+				slotSet[top+"."+m] = true
+				g.vtableSlots[top] = append(g.vtableSlots[top], m)
+			}
+		}
+	}
+	rootOf := func(class string) string {
+		for g.preClassBases[class] != "" {
+			class = g.preClassBases[class]
+		}
+		return class
+	}
+	polyRoots := map[string]bool{}
+	for cls := range g.vtableSlots {
+		polyRoots[rootOf(cls)] = true
+	}
+	for _, name := range order {
+		if polyRoots[rootOf(name)] {
+			g.polyRoot[name] = rootOf(name)
+		}
+		// 类自身及祖先引入的槽位都可以经由该类的虚表访问
+		for c := name; c != ""; c = g.preClassBases[c] {
+			for _, m := range g.vtableSlots[c] {
+				if _, ok := g.virtualIntro[name+"."+m]; !ok {
+					g.virtualIntro[name+"."+m] = c
+				}
+			}
+		}
+	}
+}
+
+// overriddenBelow: 方法是否在 class 的某个真子类中被重写（否则可以静态调用）
+func (g *generator) overriddenBelow(class, method string) bool {
+	for sub, base := range g.preClassBases {
+		if base != class {
+			continue
+		}
+		for _, m := range g.preClassMethods[sub] {
+			if m == method {
+				return true
+			}
+		}
+		if g.overriddenBelow(sub, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// vtblPath: 从 class 访问根类虚表指针的成员路径，如 base.base.vtbl
+func (g *generator) vtblPath(class string) string {
+	path := ""
+	for c := class; g.classBases[c] != ""; c = g.classBases[c] {
+		path += "base."
+	}
+	return path + "vtbl"
+}
+
+// vtableDecl: 虚表结构体定义及实例的前置声明
+func (g *generator) vtableDecl(class string) string {
+	slots := ""
+	if base := g.classBases[class]; base != "" && g.polyRoot[base] != "" {
+		slots += fmt.Sprintf("    %sVtbl base;\n", base)
+	}
+	for _, m := range g.vtableSlots[class] {
+		sig := g.methodSigs[class+"."+m]
+		params := append([]string{class + "* self"}, sig.params...)
+		slots += fmt.Sprintf("    %s (*%s)(%s);\n", sig.ret, m, join(params, ", "))
+	}
+	if slots == "" {
+		slots = "    char _unused;\n"
+	}
+	return fmt.Sprintf("typedef struct {\n%s} %sVtbl;\nstatic const %sVtbl %s_vtbl;\n", slots, class, class, class)
+}
+
+// vtableThunks: 重写祖先槽位的方法需要一个接受祖先指针的转接函数
+func (g *generator) vtableThunks(class string, ownMethods map[string]bool) string {
+	code := ""
+	for _, m := range g.preClassMethods[class] {
+		intro := g.virtualIntro[class+"."+m]
+		if intro == "" || intro == class || !ownMethods[m] {
+			continue
+		}
+		sig := g.methodSigs[class+"."+m]
+		params := append([]string{intro + "* self"}, sig.params...)
+		call := fmt.Sprintf("%s_%s(%s)", class, m, join(append([]string{"(" + class + "*)self"}, sig.paramNames...), ", "))
+		if sig.ret != "void" {
+			call = "return " + call
+		}
+		code += fmt.Sprintf("static %s %s_%s__vt(%s) {\n    %s;\n}\n", sig.ret, class, m, join(params, ", "), call)
+	}
+	return code
+}
+
+// vtableInstance: class 的虚表实例，每个槽位填入离 class 最近的实现
+func (g *generator) vtableInstance(class string) string {
+	var init func(level string) string
+	init = func(level string) string {
+		parts := []string{}
+		if base := g.classBases[level]; base != "" && g.polyRoot[base] != "" {
+			parts = append(parts, init(base))
+		}
+		for _, m := range g.vtableSlots[level] {
+			impl := ""
+			for c := class; c != ""; c = g.classBases[c] {
+				own := false
+				for _, om := range g.preClassMethods[c] {
+					own = own || om == m
+				}
+				if own {
+					impl = c
+					break
+				}
+			}
+			if impl == level {
+				parts = append(parts, fmt.Sprintf("%s_%s", level, m))
+			} else {
+				parts = append(parts, fmt.Sprintf("%s_%s__vt", impl, m))
+			}
+		}
+		if len(parts) == 0 {
+			parts = append(parts, "0")
+		}
+		return "{" + join(parts, ", ") + "}"
+	}
+	return fmt.Sprintf("static const %sVtbl %s_vtbl = %s;\n", class, class, init(class))
+}
+
+// commonAncestor: 类型集合全部是类（或类指针）时返回它们最近的共同祖先
+func (g *generator) commonAncestor(types map[string]bool) string {
+	common := ""
+	for t := range types {
+		cls := strings.TrimSuffix(t, "*")
+		if g.preClassMethods[cls] == nil {
+			return ""
+		}
+		if common == "" {
+			common = cls
+			continue
+		}
+		// 沿 common 的祖先链找到 cls 的祖先
+		found := ""
+		for c := common; c != "" && found == ""; c = g.preClassBases[c] {
+			for d := cls; d != ""; d = g.preClassBases[d] {
+				if d == c {
+					found = c
+					break
+				}
+			}
+		}
+		if found == "" {
+			return ""
+		}
+		common = found
+	}
+	return common
+}
+
+// objectArgs: 形参为对象指针时，实参改为取地址并转换到形参的类
+func (g *generator) objectArgs(fname string, args []interface{}, cArgs []string) []string {
+	return g.objectArgsOf(g.funcParamTypes[fname], args, cArgs)
+}
+
+// objectArgsOf: 同 objectArgs，参数类型直接给出
+func (g *generator) objectArgsOf(ptypes []string, args []interface{}, cArgs []string) []string {
+	if len(cArgs) != len(args) {
+		return cArgs
+	}
+	out := []string{}
+	for i, a := range cArgs {
+		if i < len(ptypes) && g.isObjectPointer(ptypes[i]) {
+			am, _ := args[i].(map[string]interface{})
+			id, _ := am["id"].(string)
+			vt := g.varType(id)
+			if am["_type"] == "Name" && g.classStructsMap[vt] {
+				a = "&" + a
+				if vt+"*" != ptypes[i] {
+					a = "(" + ptypes[i] + ")" + a
+				}
+			} else if am["_type"] == "Name" && g.isObjectPointer(vt) && vt != ptypes[i] {
+				a = "(" + ptypes[i] + ")" + a
+			}
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// --- 方法解析 ---
+
+// receiverClass: 方法调用接收者的静态类型（类名），未知时为空串
+func (g *generator) receiverClass(recv interface{}) string {
+	m, ok := recv.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if m["_type"] != "Name" {
+		// 调用结果等表达式
+		if cls := strings.TrimSuffix(g.getType(m), "*"); g.classStructsMap[cls] {
+			return cls
+		}
+		return ""
+	}
+	id, _ := m["id"].(string)
+	if id == "self" {
+		return g.currentClass
+	}
+	if g.classStructsMap[id] || g.annotClasses[id] {
+		return id // 类名.静态方法(...)；分析阶段类还没有生成
+	}
+	return strings.TrimSuffix(g.varType(id), "*")
+}
+
+// resolveMethodClass: 根据接收者类型在方法登记表中查找方法所属的类。
+// 接收者类型已知时直接查（继承来的方法已登记在子类名下）；
+// 类型未知时，只有唯一一个类定义了该方法才认为可以解析。
+func (g *generator) resolveMethodClass(classType, method string) string {
+	if _, ok := g.methodSigs[classType+"."+method]; ok {
+		return classType
+	}
+	if g.classStructsMap[classType] {
+		return ""
+	}
+	for cls := classType; cls != ""; cls = g.preClassBases[cls] {
+		// 分析阶段类还没有生成：按类与基类的方法名查（preClassMethods 不含静态方法）
+		if g.staticMethods[cls+"."+method] {
+			return cls
+		}
+		for _, m := range g.preClassMethods[cls] {
+			if m == method {
+				return cls
+			}
+		}
+	}
+	owner := ""
+	for _, cls := range sortedKeys(g.classStructsMap) {
+		for _, m := range g.preClassMethods[cls] {
+			if m != method {
+				continue
+			}
+			if owner != "" {
+				return "" // 多个类都有同名方法，无法确定
+			}
+			owner = cls
+		}
+	}
+	return owner
+}
+
+// --- exprWithPre: 单独转换一个表达式，返回需要先执行的代码（已缩进）和表达式本身 ---
+func (g *generator) exprWithPre(node ASTNode, indent int) (string, string) {
+	saved := g.pendingPre
+	g.pendingPre = nil
+	expr := g.toC(node, 0)
+	pre := g.pendingPre
+	g.pendingPre = saved
+	return formatPre(pre, indent), expr
+}
+
+// --- formatPre: 给提前执行的代码逐行加上缩进 ---
+func formatPre(pre []string, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	out := ""
+	for _, block := range pre {
+		for _, line := range strings.Split(strings.TrimSuffix(block, "\n"), "\n") {
+			out += pad + line + "\n"
+		}
+	}
+	return out
+}
+
+// --- 元组：返回值结构体与解包赋值 ---
+
+// returnsTuple: 函数体的 return 是否返回元组
+func returnsTuple(body []interface{}) bool {
+	for _, stmt := range body {
+		if m, ok := stmt.(map[string]interface{}); ok && m["_type"] == "Return" {
+			if v, ok := m["value"].(map[string]interface{}); ok && v["_type"] == "Tuple" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tupleResultType: 按第一个 return 的元素类型登记元组结构体，返回结构体名
+func (g *generator) tupleResultType(body []interface{}) string {
+	for _, stmt := range body {
+		m, ok := stmt.(map[string]interface{})
+		if !ok || m["_type"] != "Return" {
+			continue
+		}
+		v, _ := m["value"].(map[string]interface{})
+		elts, _ := v["elts"].([]interface{})
+		types := []string{}
+		for _, e := range elts {
+			types = append(types, g.getType(e))
+		}
+		return g.tupleStruct(types)
+	}
+	return "double"
+}
+
+// tupleStruct: 元素类型对应的结构体名（如 Tuple_double_charp），首次使用时生成定义
+func (g *generator) tupleStruct(types []string) string {
+	parts := []string{"Tuple"}
+	for _, t := range types {
+		parts = append(parts, strings.ReplaceAll(t, "*", "p"))
+	}
+	name := join(parts, "_")
+	if _, ok := g.tupleTypes[name]; ok {
+		return name
+	}
+	g.tupleTypes[name] = types
+	fields := make([]irParam, len(types))
+	for i, t := range types {
+		fields[i] = irParam{fmt.Sprintf("_%d", i), t}
+	}
+	g.classStructs = append(g.classStructs, g.emit.emitStruct(name, fields))
+	return name
+}
+
+// tupleReturn: return a, b -> 逐个写入 result 的字段
+func (g *generator) tupleReturn(value ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	code := ""
+	elts, _ := value["elts"].([]interface{})
+	for i, e := range elts {
+		pre, expr := g.exprWithPre(e.(map[string]interface{}), indent)
+		if t := g.getType(e); g.isRcType(t) {
+			expr = g.rcRef(t, expr)
+		}
+		code += fmt.Sprintf("%s%sresult->_%d = %s;\n", pre, pad, i, expr)
+	}
+	return code
+}
+
+// handleTupleAssign: a, b = f(...) 或 a, b = x, y
+// 右侧先整体求值到临时变量，再逐个赋给左侧，保证 a, b = b, a 之类的交换语义正确
+func (g *generator) handleTupleAssign(target ASTNode, value ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	elts, _ := target["elts"].([]interface{})
+	names := []string{}
+	for _, e := range elts {
+		em, _ := e.(map[string]interface{})
+		id, _ := em["id"].(string)
+		if em["_type"] != "Name" || id == "" {
+			return g.unsupportedStmt(target, pad, "assign (tuple target)")
+		}
+		names = append(names, id)
+	}
+	code := ""
+	values := []string{}
+	types := []string{}
+	switch value["_type"] {
+	case "Tuple":
+		vals, _ := value["elts"].([]interface{})
+		if len(vals) != len(names) {
+			return g.unsupportedStmt(target, pad, "assign (tuple length mismatch)")
+		}
+		for _, v := range vals {
+			typ := g.getType(v)
+			tmp := g.newTemp("_t")
+			pre, expr := g.exprWithPre(v.(map[string]interface{}), indent)
+			code += fmt.Sprintf("%s%s%s %s = %s;\n", pre, pad, typ, tmp, expr)
+			g.declareTemp(tmp, typ)
+			values = append(values, tmp)
+			types = append(types, typ)
+		}
+	default:
+		typ := g.getType(map[string]interface{}(value))
+		if r := g.recordOf(typ); r != nil && len(r.fields) == len(names) {
+			// x, y = p（p 是 NamedTuple）：依次取字段，p 不是变量时先存入临时变量
+			recv := map[string]interface{}(value)
+			if value["_type"] != "Name" {
+				tmp := g.newTemp("_t")
+				pre, expr := g.exprWithPre(value, indent)
+				code += fmt.Sprintf("%s%s%s %s = %s;\n", pre, pad, typ, tmp, expr)
+				g.declareTemp(tmp, typ)
+				recv = cName(tmp)
+			}
+			for _, f := range r.fields {
+				field := map[string]interface{}{"_type": "Attribute", "value": recv, "attr": f, "ctx": map[string]interface{}{"_type": "Load"}}
+				values = append(values, g.nodeToC(field, 0))
+				types = append(types, g.getType(field))
+			}
+			break
+		}
+		elems, ok := g.tupleTypes[typ]
+		if !ok || len(elems) != len(names) {
+			return g.unsupportedStmt(target, pad, "assign (value is not a tuple)")
+		}
+		pre, expr := g.exprWithPre(value, indent)
+		code += pre
+		for i := range names {
+			values = append(values, fmt.Sprintf("%s._%d", expr, i))
+		}
+		types = elems
+	}
+	// 函数返回的元组里已经是新引用，直接交给左侧变量持有
+	owns := g.optOwnedStrs && value["_type"] == "Call"
+	for i, name := range names {
+		if owns {
+			g.rcHoist(name, types[i], indent)
+		}
+		if g.isDeclared(name) {
+			if owns && g.isRcType(types[i]) && g.isOwned(name) {
+				old := g.newTemp("_o")
+				code += fmt.Sprintf("%s%s %s = %s;\n%s%s = %s;\n%s%s;\n", pad, types[i], old, name, pad, name, values[i], pad, g.rcRelease(old))
+				continue
+			}
+			code += fmt.Sprintf("%s%s = %s;\n", pad, name, values[i])
+			continue
+		}
+		g.declareVar(name, types[i])
+		if owns && g.isRcType(types[i]) {
+			g.ownObject(name, types[i], false, indent)
+		}
+		code += fmt.Sprintf("%s%s %s = %s;\n", pad, types[i], name, values[i])
+	}
+	return code
+}
+
+// handleSubscript: 元组常量下标转为字段访问，其余按数组下标处理
+func (g *generator) handleSubscript(node ASTNode, indent int) string {
+	if v, _ := node["value"].(map[string]interface{}); g.qualifiedCallName(v) == "os.environ" {
+		return g.osEnviron(g.toC(node["slice"].(map[string]interface{}), 0))
+	}
+	if g.getType(node["value"]) == "PyJson*" {
+		j, key := g.jsonSubscript(node["value"], node["slice"])
+		switch g.getType(node["slice"]) {
+		case "char*":
+			return fmt.Sprintf("py_json_get(%s, %s)", j, key)
+		case "PyJson*":
+			return fmt.Sprintf("py_json_index(%s, %s)", j, key)
+		}
+		return fmt.Sprintf("py_json_at(%s, %s)", j, key)
+	}
+	if e := g.enumOf(node["value"]); e != nil {
+		return g.enumLookup(e, node)
+	}
+	if field := g.recordField(node["value"], node["slice"]); field != nil {
+		// NamedTuple 的 p[0]：对应位置的字段
+		return g.nodeToC(field, 0)
+	}
+	if c := g.collectionOf(g.getType(node["value"])); c != nil {
+		return g.collectionSubscript(c, node)
+	}
+	value := g.toC(node["value"].(map[string]interface{}), 0)
+	if _, ok := g.listElemType(g.getType(node["value"])); ok {
+		// 列表下标：支持负数下标，越界时与 Python 一样报 IndexError
+		slice, _ := node["slice"].(map[string]interface{})
+		return fmt.Sprintf("(*%s_at(%s, %s))", strings.TrimSuffix(g.getType(node["value"]), "*"), value, g.toC(slice, 0))
+	}
+	if _, ok := g.tupleTypes[g.getType(node["value"])]; ok {
+		if i, ok := constIndex(node["slice"]); ok {
+			return fmt.Sprintf("%s._%d", value, i)
+		}
+		return g.unsupportedExpr(node, "subscript: tuple index must be a constant")
+	}
+	slice, _ := node["slice"].(map[string]interface{})
+	return fmt.Sprintf("%s[%s]", value, g.toC(slice, 0))
+}
+
+// constIndex: 非负整型常量下标
+func constIndex(node interface{}) (int, bool) {
+	m, _ := node.(map[string]interface{})
+	if m["_type"] != "Constant" {
+		return 0, false
+	}
+	n, ok := m["value"].(json.Number)
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.Atoi(n.String())
+	return i, err == nil && i >= 0
+}
+
+// --- 字符串格式化：f-string、字符串拼接与对象的 __str__ ---
+
+// cEscape: 转义字符串使其可以放进 C 字符串字面量
+func cEscape(s string) string {
+	r := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\t", "\\t", "\r", "\\r")
+	return r.Replace(s)
+}
+
+// valueFormat: 单个值的 printf 格式与实参；类实例通过 类名_str 转成字符串
+func (g *generator) valueFormat(node interface{}) (string, string) {
+	m, _ := node.(map[string]interface{})
+	expr := g.toC(m, 0)
+	t := g.getType(node)
+	if m["_type"] == "Name" && m["id"] == "self" && g.currentClass != "" {
+		t = g.currentClass + "*"
+	}
+	if g.ctorClass(m) != "" {
+		t += "*" // print(Point(1, 2))：构造调用的结果是堆上对象的指针
+	}
+	if t == "char*" && g.mayBeNone(node) {
+		g.runtimeHelpers["py_str_or_none"] = `// a str that may be None (NULL), as print shows it
+static char* py_str_or_none(char* s) {
+    return s ? s : (char*)"None";
+}
+`
+		expr = fmt.Sprintf("py_str_or_none(%s)", expr)
+	}
+	return g.typeFormat(t, expr)
+}
+
+// typeFormat: 给定类型的表达式对应的 printf 格式与实参
+func (g *generator) typeFormat(t, expr string) (string, string) {
+	if isExcRecord(t) {
+		// str(e)：异常的消息
+		return "%s", expr + "->msg"
+	}
+	if cls := strings.TrimSuffix(t, "*"); g.classStructsMap[cls] {
+		g.ensureStrFunc(cls)
+		if t == cls {
+			expr = "&" + expr
+		}
+		return "%s", fmt.Sprintf("%s_str(%s)", cls, expr)
+	}
+	if _, ok := g.listElemType(t); ok || g.collectionOf(t) != nil {
+		return "%s", fmt.Sprintf("%s_str(%s)", strings.TrimSuffix(t, "*"), expr)
+	}
+	if e := g.enums[t]; e != nil {
+		return g.enumFormat(e, expr)
+	}
+	if t == "PyDateTime" {
+		return "%s", fmt.Sprintf("py_datetime_str(%s, ' ')", expr)
+	}
+	if t == "PyJson*" {
+		return "%s", fmt.Sprintf("py_json_str(%s)", expr)
+	}
+	if t == "PyMatch" {
+		return "%s", fmt.Sprintf("py_re_repr(%s)", expr)
+	}
+	if t == "PyArgs" {
+		return "%s", fmt.Sprintf("py_args_repr(%s)", expr)
+	}
+	return getPrintFmt(t), expr
+}
+
+// formatPieces: 把 f-string / 字符串拼接展开成一个 printf 格式串和对应实参
+func (g *generator) formatPieces(node interface{}) (string, []string) {
+	m, _ := node.(map[string]interface{})
+	switch m["_type"] {
+	case "Constant":
+		if s, ok := m["value"].(string); ok {
+			return strings.ReplaceAll(cEscape(s), "%", "%%"), nil
+		}
+	case "JoinedStr":
+		f := ""
+		args := []string{}
+		values, _ := m["values"].([]interface{})
+		for _, v := range values {
+			vf, vargs := g.formatPieces(v)
+			f += vf
+			args = append(args, vargs...)
+		}
+		return f, args
+	case "FormattedValue":
+		f, arg := g.valueFormat(m["value"])
+		if spec := formatSpec(m["format_spec"]); spec != "" && g.getType(m["value"]) == "PyDateTime" {
+			// {d:%Y-%m-%d}：按 strftime 格式化
+			return "%s", []string{fmt.Sprintf("py_datetime_strftime(%s, \"%s\")", g.toC(m["value"].(map[string]interface{}), 0), cEscape(spec))}
+		} else if spec != "" {
+			if last := spec[len(spec)-1]; (last < 'a' || last > 'z') && (last < 'A' || last > 'Z') {
+				spec += strings.TrimPrefix(f, "%")
+			}
+			f = "%" + spec
+			// {7:.2f} / {x:d}：实参换成说明符要求的 C 类型
+			switch t, conv := g.getType(m["value"]), f[len(f)-1]; {
+			case t == "int" && strings.IndexByte("eEfFgG", conv) >= 0:
+				arg = "(double)" + arg
+			case t == "double" && strings.IndexByte("dioxXc", conv) >= 0:
+				arg = "(int)" + arg
+			}
+		}
+		if conv, _ := m["conversion"].(json.Number); conv == "114" && f == "%s" && g.getType(m["value"]) == "char*" {
+			// !r：字符串的 repr 带引号
+			f = "'%s'"
+		}
+		return f, []string{arg}
+	case "BinOp":
+		if op, _ := m["op"].(map[string]interface{}); op["_type"] == "Add" && g.getType(m["left"]) == "char*" && g.getType(m["right"]) == "char*" {
+			lf, largs := g.formatPieces(m["left"])
+			rf, rargs := g.formatPieces(m["right"])
+			return lf + rf, append(largs, rargs...)
+		}
+	case "Call":
+		// 拼接中的 str(x)：直接按 x 的类型格式化
+		if fn, _ := m["func"].(map[string]interface{}); fn["_type"] == "Name" && fn["id"] == "str" {
+			if args, _ := m["args"].([]interface{}); len(args) == 1 {
+				f, arg := g.valueFormat(args[0])
+				return f, []string{arg}
+			}
+		}
+	}
+	f, arg := g.valueFormat(node)
+	return f, []string{arg}
+}
+
+// formatSpec: f-string 中 {x:.2f} 的格式说明（只支持常量）
+func formatSpec(node interface{}) string {
+	m, ok := node.(map[string]interface{})
+	if !ok || m["_type"] != "JoinedStr" {
+		return ""
+	}
+	spec := ""
+	values, _ := m["values"].([]interface{})
+	for _, v := range values {
+		vm, _ := v.(map[string]interface{})
+		s, ok := vm["value"].(string)
+		if vm["_type"] != "Constant" || !ok {
+			return ""
+		}
+		spec += s
+	}
+	return spec
+}
+
+// handleJoinedStr: 格式化到运行时的轮转缓冲区，表达式的值就是缓冲区；
+// -owned-strings 时按实际长度分配新字符串，由临时变量持有到语句结束
+func (g *generator) handleJoinedStr(node ASTNode, indent int) string {
+	return g.formatString(map[string]interface{}(node), g.isRcType("char*"))
+}
+
+// formatString: f-string 或字符串拼接的值；owned 为 false 时总是写入轮转缓冲区（如 raise 的消息，
+// 抛出后语句末尾的释放不会执行）
+func (g *generator) formatString(node map[string]interface{}, owned bool) string {
+	f, args := g.formatPieces(node)
+	tmp := g.newTemp("_s")
+	g.declareTemp(tmp, "char*")
+	if owned {
+		g.strRuntime()
+		g.rcTemps[tmp] = true
+		g.pendingPre = append(g.pendingPre, fmt.Sprintf("char* %s = %s.data;\n", tmp, formatCall("py_str_format", f, args)))
+		g.pendingPost = append(g.pendingPost, g.rcRelease(tmp)+";\n")
+		return tmp
+	}
+	call := fmt.Sprintf("snprintf(%s, PY_STRBUF_SIZE, \"%s\")", tmp, f)
+	if len(args) > 0 {
+		call = fmt.Sprintf("snprintf(%s, PY_STRBUF_SIZE, \"%s\", %s)", tmp, f, join(args, ", "))
+	}
+	g.pendingPre = append(g.pendingPre, fmt.Sprintf("char* %s = %s;\n%s;\n", tmp, g.strBuf(), call))
+	return tmp
+}
+
+// formatCall: fn("格式", 参数...)
+func formatCall(fn, f string, args []string) string {
+	if len(args) == 0 {
+		return fmt.Sprintf("%s(\"%s\")", fn, f)
+	}
+	return fmt.Sprintf("%s(\"%s\", %s)", fn, f, join(args, ", "))
+}
+
+// strBuf: 取一个临时字符串缓冲区的表达式。
+// 缓冲区轮流使用，同一条 printf 里的多个 __str__ / f-string 结果不会互相覆盖
+func (g *generator) strBuf() string {
+	size, count := 1024, 16
+	if g.optProfile == "arduino" {
+		// 微控制器的 RAM 只有几 KB
+		size, count = 64, 4
+	}
+	g.runtimeHelpers["py_strbuf"] = fmt.Sprintf(`#define PY_STRBUF_SIZE %d
+// scratch buffers for formatted strings, reused round-robin
+static char* py_strbuf(void) {
+    static char bufs[%d][PY_STRBUF_SIZE];
+    static int next = 0;
+    next = (next + 1) %% %d;
+    return bufs[next];
+}
+`, size, count, count)
+	return "py_strbuf()"
+}
+
+// ensureStrFunc: 生成 char* 类名_str(类名* self)，print 对象时调用
+// 优先使用 __str__，其次 __repr__，都没有时按字段生成默认输出：Point(x=1.000000, y=2.000000)
+func (g *generator) ensureStrFunc(class string) {
+	if g.strFuncs[class] {
+		return
+	}
+	g.strFuncs[class] = true
+	method := ""
+	for _, m := range []string{"__str__", "__repr__"} {
+		if _, ok := g.methodSigs[class+"."+m]; ok {
+			method = m
+			break
+		}
+	}
+	body := ""
+	if method != "" {
+		call := fmt.Sprintf("%s_%s(self)", class, method)
+		if intro := g.virtualIntro[class+"."+method]; intro != "" && g.overriddenBelow(class, method) {
+			// 子类重写了 __str__：经由虚表分派
+			call = fmt.Sprintf("((const %sVtbl*)self->%s)->%s((%s*)self)", intro, g.vtblPath(class), method, intro)
+		}
+		body = fmt.Sprintf("    return %s;\n", call)
+		if g.isRcType("char*") {
+			// __str__ 返回新的计数字符串：复制到临时缓冲区后释放
+			body = fmt.Sprintf("    char* s = %s;\n    char* buf = %s;\n    snprintf(buf, PY_STRBUF_SIZE, \"%%s\", s);\n    %s;\n    return buf;\n", call, g.strBuf(), g.rcRelease("s"))
+		}
+	} else {
+		chain := []string{}
+		for c := class; c != ""; c = g.classBases[c] {
+			chain = append([]string{c}, chain...)
+		}
+		fmts := []string{}
+		args := []string{}
+		for _, c := range chain {
+			for _, field := range g.classFieldOrder[c] {
+				t := g.classFieldType(class, field)
+				f, arg := g.typeFormat(t, "self->"+g.fieldAccessPath(class, field))
+				if t == "char*" {
+					f = "'%s'"
+				}
+				if e := g.enums[t]; e != nil {
+					f, arg = "%s", fmt.Sprintf("%s(self->%s)", g.enumHelper(e, "repr"), g.fieldAccessPath(class, field))
+				}
+				fmts = append(fmts, field+"="+f)
+				args = append(args, arg)
+			}
+		}
+		call := fmt.Sprintf("snprintf(buf, PY_STRBUF_SIZE, \"%s(%s)\")", class, join(fmts, ", "))
+		if len(args) > 0 {
+			call = fmt.Sprintf("snprintf(buf, PY_STRBUF_SIZE, \"%s(%s)\", %s)", class, join(fmts, ", "), join(args, ", "))
+		}
+		body = fmt.Sprintf("    char* buf = %s;\n    %s;\n    return buf;\n", g.strBuf(), call)
+	}
+	g.classStructs = append(g.classStructs, fmt.Sprintf("char* %s_str(%s* self) {\n%s}\n", class, class, body))
+}
+
+// --- stripTypingOnly: 去掉仅供类型检查的结构，并登记所有函数的类型注解 ---
+func (g *generator) stripTypingOnly(root ASTNode) {
+	body, _ := root["body"].([]interface{})
+	for _, stmt := range body {
+		if m, ok := stmt.(map[string]interface{}); ok && m["_type"] == "ClassDef" && g.enums[m["name"].(string)] == nil {
+			g.annotClasses[m["name"].(string)] = true
+		}
+	}
+	root["body"] = g.stripTypingStmts(body, "")
+}
+
+func (g *generator) stripTypingStmts(stmts []interface{}, class string) []interface{} {
+	out := []interface{}{}
+	for _, stmt := range stmts {
+		m, ok := stmt.(map[string]interface{})
+		if !ok {
+			out = append(out, stmt)
+			continue
+		}
+		switch m["_type"] {
+		case "If":
+			if isTypeCheckingTest(m["test"]) {
+				// 块内只登记类型信息，运行时走 else 分支
+				body, _ := m["body"].([]interface{})
+				g.harvestTypingBlock(body, class)
+				orelse, _ := m["orelse"].([]interface{})
+				out = append(out, g.stripTypingStmts(orelse, class)...)
+				continue
+			}
+			for _, key := range []string{"body", "orelse"} {
+				if b, ok := m[key].([]interface{}); ok {
+					m[key] = g.stripTypingStmts(b, class)
+				}
+			}
+		case "ClassDef":
+			body, _ := m["body"].([]interface{})
+			m["body"] = g.stripTypingStmts(body, m["name"].(string))
+		case "FunctionDef":
+			overload := hasDecorator(m, "overload")
+			g.harvestAnnotations(m, class, overload)
+			if overload {
+				continue
+			}
+			body, _ := m["body"].([]interface{})
+			m["body"] = g.stripTypingStmts(body, "")
+		case "For", "While":
+			for _, key := range []string{"body", "orelse"} {
+				if b, ok := m[key].([]interface{}); ok {
+					m[key] = g.stripTypingStmts(b, class)
+				}
+			}
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// isTypeCheckingTest: if TYPE_CHECKING: / if typing.TYPE_CHECKING:
+func isTypeCheckingTest(test interface{}) bool {
+	m, _ := test.(map[string]interface{})
+	switch m["_type"] {
+	case "Name":
+		return m["id"] == "TYPE_CHECKING"
+	case "Attribute":
+		return m["attr"] == "TYPE_CHECKING"
+	}
+	return false
+}
+
+// hasDecorator: 函数是否带有 @name 或 @module.name 装饰器；name 为 "x.setter" 时要求完全一致
+func hasDecorator(fn map[string]interface{}, name string) bool {
+	decos, _ := fn["decorator_list"].([]interface{})
+	for _, d := range decos {
+		dm, _ := d.(map[string]interface{})
+		if strings.Contains(name, ".") {
+			if recv, _ := dm["value"].(map[string]interface{}); dm["_type"] == "Attribute" && fmt.Sprintf("%v.%v", recv["id"], dm["attr"]) == name {
+				return true
+			}
+			continue
+		}
+		if (dm["_type"] == "Name" && dm["id"] == name) || (dm["_type"] == "Attribute" && dm["attr"] == name) {
+			return true
+		}
+	}
+	return false
+}
+
+// harvestTypingBlock: TYPE_CHECKING 块中的类型别名（Number = float）与函数桩
+func (g *generator) harvestTypingBlock(stmts []interface{}, class string) {
+	for _, stmt := range stmts {
+		m, _ := stmt.(map[string]interface{})
+		switch m["_type"] {
+		case "Assign":
+			targets, _ := m["targets"].([]interface{})
+			if len(targets) != 1 {
+				continue
+			}
+			tm, _ := targets[0].(map[string]interface{})
+			if id, ok := tm["id"].(string); ok && tm["_type"] == "Name" {
+				if t := g.annotationType(m["value"]); t != "" {
+					g.typeAliases[id] = t
+				}
+			}
+		case "FunctionDef":
+			g.harvestAnnotations(m, class, true)
+		case "If":
+			body, _ := m["body"].([]interface{})
+			g.harvestTypingBlock(body, class)
+		}
+	}
+}
+
+// harvestAnnotations: 登记函数参数与返回值注解
+// 多个 @overload 桩的注解取交集（int 与 float 合并为 double），真正的定义中有注解的位置优先
+func (g *generator) harvestAnnotations(fn map[string]interface{}, class string, stub bool) {
+	key, _ := fn["name"].(string)
+	if class != "" {
+		key = class + "." + key
+	}
+	types := []string{}
+	args, _ := fn["args"].(map[string]interface{})
+	argsList, _ := args["args"].([]interface{})
+	for i, a := range argsList {
+		if class != "" && i == 0 && !hasDecorator(fn, "staticmethod") {
+			continue
+		}
+		am, _ := a.(map[string]interface{})
+		types = append(types, g.annotationType(am["annotation"]))
+	}
+	ret := g.annotationType(fn["returns"])
+	prev, seen := g.annotParams[key]
+	for i, t := range types {
+		if i >= len(prev) {
+			continue
+		}
+		if stub {
+			types[i] = mergeAnnotTypes(prev[i], t)
+		} else if t == "" {
+			types[i] = prev[i]
+		}
+	}
+	g.annotParams[key] = types
+	if prevRet, ok := g.annotReturns[key]; ok && seen {
+		if stub {
+			ret = mergeAnnotTypes(prevRet, ret)
+		} else if ret == "" {
+			ret = prevRet
+		}
+	}
+	g.annotReturns[key] = ret
+}
+
+// mergeAnnotTypes: 两个重载中同一位置的类型能否用一个 C 类型表示
+func mergeAnnotTypes(a, b string) string {
+	if a == b {
+		return a
+	}
+	if (a == "int" || a == "double") && (b == "int" || b == "double") {
+		return "double"
+	}
+	return ""
+}
+
+// annotationType: 注解表达式对应的 C 类型，类名原样返回，无法表示时为空
+func (g *generator) annotationType(node interface{}) string {
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	switch m["_type"] {
+	case "Name":
+		id, _ := m["id"].(string)
+		switch id {
+		case "int", "bool":
+			return "int"
+		case "float":
+			return "double"
+		case "str":
+			return "char*"
+		}
+		if t, ok := g.typeAliases[id]; ok {
+			return t
+		}
+		if g.annotClasses[id] || g.enums[id] != nil {
+			return id
+		}
+	case "Constant":
+		// 字符串形式的前向引用："Point"
+		if s, ok := m["value"].(string); ok {
+			return g.annotationType(map[string]interface{}{"_type": "Name", "id": s})
+		}
+	case "BinOp":
+		// int | float
+		if op, _ := m["op"].(map[string]interface{}); op["_type"] == "BitOr" {
+			return mergeAnnotTypes(g.annotationType(m["left"]), g.annotationType(m["right"]))
+		}
+	}
+	return ""
+}
+
+// annotParam: 第 i 个参数（不含 self）的注解类型
+func (g *generator) annotParam(key string, i int) string {
+	if types := g.annotParams[key]; i < len(types) {
+		return types[i]
+	}
+	return ""
+}
+
+// --- 类属性与静态方法 ---
+
+// lowerClassMethods: @staticmethod / @classmethod 登记为没有 self 的方法，
+// 类方法去掉 cls 参数，方法体里的 cls 直接换成类名（不支持通过 cls 实现的多态）；
+// @property 与 @x.setter 改名为普通方法 get_x / set_x
+func (g *generator) lowerClassMethods(root ASTNode) {
+	body, _ := root["body"].([]interface{})
+	for _, stmt := range body {
+		cls, _ := stmt.(map[string]interface{})
+		if cls["_type"] != "ClassDef" {
+			continue
+		}
+		name, _ := cls["name"].(string)
+		cbody, _ := cls["body"].([]interface{})
+		for _, s := range cbody {
+			fm, _ := s.(map[string]interface{})
+			if fm["_type"] != "FunctionDef" {
+				continue
+			}
+			mname, _ := fm["name"].(string)
+			switch {
+			case hasDecorator(fm, "property"):
+				g.properties[name+"."+mname] = true
+				fm["name"] = "get_" + mname
+			case hasDecorator(fm, mname+".setter"):
+				fm["name"] = "set_" + mname
+			case hasDecorator(fm, mname+".deleter"):
+				fm["name"] = "del_" + mname
+			case hasDecorator(fm, "staticmethod"):
+				g.staticMethods[name+"."+mname] = true
+			case hasDecorator(fm, "classmethod"):
+				g.staticMethods[name+"."+mname] = true
+				args, _ := fm["args"].(map[string]interface{})
+				argsList, _ := args["args"].([]interface{})
+				if len(argsList) == 0 {
+					continue
+				}
+				clsName, _ := argsList[0].(map[string]interface{})["arg"].(string)
+				args["args"] = argsList[1:]
+				renameNames(fm["body"], clsName, name)
+			}
+		}
+	}
+}
+
+// renameNames: 把子树中名为 from 的 Name 节点改名为 to
+func renameNames(node interface{}, from, to string) {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			renameNames(e, from, to)
+		}
+	case map[string]interface{}:
+		if n["_type"] == "Name" && n["id"] == from {
+			n["id"] = to
+		}
+		for _, v := range n {
+			renameNames(v, from, to)
+		}
+	}
+}
+
+// classAttrDecls: 类体中的 count = 0 输出为文件作用域变量 类名_count
+func (g *generator) classAttrDecls(class string, body []interface{}) string {
+	code := ""
+	g.classAttrs[class] = map[string]string{}
+	for _, stmt := range body {
+		m, _ := stmt.(map[string]interface{})
+		var target, value map[string]interface{}
+		typ := ""
+		switch m["_type"] {
+		case "Assign":
+			targets, _ := m["targets"].([]interface{})
+			if len(targets) != 1 {
+				continue
+			}
+			target, _ = targets[0].(map[string]interface{})
+			value, _ = m["value"].(map[string]interface{})
+		case "AnnAssign":
+			target, _ = m["target"].(map[string]interface{})
+			value, _ = m["value"].(map[string]interface{})
+			typ = g.annotationType(m["annotation"])
+			if g.annotClasses[typ] {
+				typ = ""
+			}
+		default:
+			continue
+		}
+		attr, _ := target["id"].(string)
+		if target["_type"] != "Name" || attr == "" || value == nil {
+			continue
+		}
+		if typ == "" {
+			typ = g.getType(value)
+		}
+		g.classAttrs[class][attr] = typ
+		init := g.toC(value, 0)
+		if !isConstInitializer(value) {
+			g.report(logError, value, "unsupported class attribute initializer")
+			code += fmt.Sprintf("%s %s_%s; // unsupported class attribute initializer\n", typ, class, attr)
+			continue
+		}
+		code += fmt.Sprintf("%s %s_%s = %s;\n", typ, class, attr, init)
+	}
+	return code
+}
+
+// isConstInitializer: 文件作用域变量只能用常量初始化
+func isConstInitializer(node map[string]interface{}) bool {
+	switch node["_type"] {
+	case "Constant":
+		return true
+	case "UnaryOp":
+		operand, _ := node["operand"].(map[string]interface{})
+		return operand["_type"] == "Constant"
+	}
+	return false
+}
+
+// classAttrOwner: 沿继承链查找定义类属性的类及其类型
+func (g *generator) classAttrOwner(class, attr string) (string, string) {
+	for c := class; c != ""; c = g.classBases[c] {
+		if t, ok := g.classAttrs[c][attr]; ok {
+			return c, t
+		}
+	}
+	return "", ""
+}
+
+// callSiteArgType: 所有调用点第 pos 个实参类型一致时取该类型，否则为 double
+func (g *generator) callSiteArgType(key string, pos int) string {
+	typesSet := map[string]bool{}
+	for _, call := range g.funcArgTypes[key] {
+		if pos < len(call) {
+			typesSet[call[pos]] = true
+		}
+	}
+	if len(typesSet) == 1 {
+		for t := range typesSet {
+			return t
+		}
+	}
+	return "double"
+}
+
+// methodArgType: 方法第 pos 个参数在调用点（本类与子类的对象上）的实参类型，不一致时为 double，没有调用时为空串；
+// 对象按指针传递，多个类时取共同祖先
+func (g *generator) methodArgType(class, method string, pos int) string {
+	typesSet := map[string]bool{}
+	for _, cls := range sortedKeys(g.preClassMethods) {
+		sub := cls
+		for sub != "" && sub != class {
+			sub = g.preClassBases[sub]
+		}
+		if sub == "" {
+			continue
+		}
+		for _, call := range g.funcArgTypes[cls+"."+method] {
+			if pos < len(call) {
+				typesSet[call[pos]] = true
+			}
+		}
+	}
+	if len(typesSet) == 0 {
+		return ""
+	}
+	if cls := g.commonAncestor(typesSet); cls != "" {
+		return cls + "*"
+	}
+	if len(typesSet) == 1 {
+		for t := range typesSet {
+			return t
+		}
+	}
+	return "double"
+}
+
+// handleStaticMethodCall: Class.m(...) 或 obj.m(...) 调用静态方法/类方法时不传 self
+func (g *generator) handleStaticMethodCall(fn map[string]interface{}, call map[string]interface{}) (string, bool) {
+	method, _ := fn["attr"].(string)
+	cls := g.receiverClass(fn["value"])
+	owner := g.resolveMethodClass(cls, method)
+	if owner == "" || !g.staticMethods[owner+"."+method] {
+		return "", false
+	}
+	args, _ := call["args"].([]interface{})
+	return fmt.Sprintf("%s_%s(%s)", owner, method, g.joinCallArgs(args)), true
+}
+
+// --- 标准库调用：按 模块名.函数名 映射到 C 代码 ---
+
+// qualifiedCallName: warnings.warn(...) / w.warn(...) / warn(...) 解析为 "warnings.warn"，不是导入的函数时为空
+func (g *generator) qualifiedCallName(fn map[string]interface{}) string {
+	switch fn["_type"] {
+	case "Name":
+		id, _ := fn["id"].(string)
+		return g.importedFuncs[id]
+	case "Attribute":
+		recv, _ := fn["value"].(map[string]interface{})
+		id, _ := recv["id"].(string)
+		if module, ok := g.moduleAliases[id]; ok && recv["_type"] == "Name" {
+			return fmt.Sprintf("%s.%v", module, fn["attr"])
+		}
+		// datetime.datetime.now / from datetime import datetime; datetime.now
+		if prefix := g.qualifiedCallName(recv); prefix != "" {
+			return fmt.Sprintf("%s.%v", prefix, fn["attr"])
+		}
+	}
+	return ""
+}
+
+// handleStdlibCall: 已支持的标准库函数
+func (g *generator) handleStdlibCall(qname string, node ASTNode) (string, bool) {
+	if strings.HasPrefix(qname, "ctypes.") {
+		return g.ctypesValue(qname, node)
+	}
+	if strings.HasPrefix(qname, "bisect.") {
+		return g.bisectCall(qname, node), true
+	}
+	if strings.HasPrefix(qname, "re.") {
+		return g.reCall(qname, node), true
+	}
+	if strings.HasPrefix(qname, "argparse.") {
+		return g.unsupportedExpr(node, "call: "+qname+" (only an ArgumentParser assigned to a variable, its add_argument and parse_args are translated)"), true
+	}
+	switch qname {
+	case "warnings.warn":
+		return g.handleWarn(node), true
+	case "time.time", "time.sleep":
+		return g.timeCall(qname, node), true
+	case "sys.exit":
+		return g.sysExit(node), true
+	case "os._exit", "os.abort":
+		return g.osExit(qname, node), true
+	case "os.getcwd", "os.path.join", "os.path.exists", "os.path.isfile", "os.path.isdir", "os.listdir", "os.environ.get":
+		return g.osCall(qname, node), true
+	case "json.loads", "json.load", "json.dumps", "json.dump":
+		return g.jsonCall(qname, node), true
+	case "itertools.count", "itertools.repeat", "itertools.chain", "itertools.islice":
+		return g.unsupportedExpr(node, "call: "+qname+"() outside a for loop"), true
+	case "functools.reduce":
+		return g.functionalReduce(node), true
+	case "heapq.heappush", "heapq.heappop", "heapq.heapify", "heapq.heappushpop", "heapq.heapreplace", "heapq.nlargest", "heapq.nsmallest", "heapq.merge":
+		return g.heapqCall(qname, node), true
+	case "datetime.datetime.now":
+		g.datetimeRuntime()
+		return "py_datetime_now()", true
+	case "copy.copy", "copy.deepcopy":
+		args, _ := node["args"].([]interface{})
+		if len(args) != 1 {
+			return g.unsupportedExpr(node, "call: "+qname+" expects one argument"), true
+		}
+		return g.copyExpr(args[0].(map[string]interface{}), qname == "copy.deepcopy"), true
+	}
+	return "", false
+}
+
+// callKeyword: 取关键字参数 name=value，没有时为 nil
+func callKeyword(node ASTNode, name string) map[string]interface{} {
+	keywords, _ := node["keywords"].([]interface{})
+	for _, k := range keywords {
+		km, _ := k.(map[string]interface{})
+		if km["arg"] == name {
+			v, _ := km["value"].(map[string]interface{})
+			return v
+		}
+	}
+	return nil
+}
+
+// handleWarn: warnings.warn(msg, category) -> py_warn，输出到 stderr
+// 与 Python 默认的过滤规则一样，消息为常量时每个调用点只输出一次
+func (g *generator) handleWarn(node ASTNode) string {
+	g.runtimeHelpers["py_warn"] = `// warnings.warn: prints "line N: Category: message" to stderr, only once per call site when shown is set
+static void py_warn(int* shown, const char* category, const char* msg, int lineno) {
+    if (shown) {
+        if (*shown) {
+            return;
+        }
+        *shown = 1;
+    }
+    fprintf(stderr, "line %d: %s: %s\n", lineno, category, msg);
+}
+`
+	args, _ := node["args"].([]interface{})
+	msg := "\"\""
+	var msgNode map[string]interface{}
+	if len(args) > 0 {
+		msgNode, _ = args[0].(map[string]interface{})
+		msg = g.toC(msgNode, 0)
+	}
+	catNode := callKeyword(node, "category")
+	if catNode == nil && len(args) > 1 {
+		catNode, _ = args[1].(map[string]interface{})
+	}
+	category := "UserWarning"
+	if catNode != nil {
+		if id, ok := catNode["id"].(string); ok {
+			category = id
+		} else if attr, ok := catNode["attr"].(string); ok {
+			category = attr
+		}
+	}
+	lineno := fmt.Sprint(node["lineno"])
+	shown := "NULL"
+	if msgNode == nil || msgNode["_type"] == "Constant" {
+		flag := g.newTemp("_warned")
+		g.pendingPre = append(g.pendingPre, fmt.Sprintf("static int %s = 0;\n", flag))
+		shown = "&" + flag
+	}
+	return fmt.Sprintf("py_warn(%s, \"%s\", %s, %s)", shown, category, msg, lineno)
+}
+
+// propertyOwner: 沿继承链查找定义 property 的类
+func (g *generator) propertyOwner(class, attr string) string {
+	for c := class; c != ""; c = g.preClassBases[c] {
+		if g.properties[c+"."+attr] {
+			return c
+		}
+	}
+	return ""
+}
+
+// methodPrototypes: 方法体中调用了定义在其后的方法时，需要的原型声明
+func methodPrototypes(decls []string, bodies []string) string {
+	code := ""
+	for i, decl := range decls {
+		fname := decl[strings.LastIndex(decl[:strings.Index(decl, "(")], " ")+1 : strings.Index(decl, "(")]
+		for j := 0; j < i; j++ {
+			if strings.Contains(bodies[j], fname+"(") {
+				code += decl + ";\n"
+				break
+			}
+		}
+	}
+	return code
+}
+
+// --- 列表运行时 ---
+
+// mangleType: C 类型转为可以放进标识符的形式，char* -> charp
+func mangleType(t string) string {
+	return strings.ReplaceAll(t, "*", "p")
+}
+
+// listElemType: PyList_double* -> double
+func (g *generator) listElemType(t string) (string, bool) {
+	elem, ok := g.listTypes[strings.TrimSuffix(t, "*")]
+	return elem, ok && strings.HasSuffix(t, "*")
+}
+
+// listType: 元素类型对应的列表指针类型，首次使用时生成结构体与操作函数
+// 对象元素总是按指针保存（放进容器的对象会逃逸到堆上）
+func (g *generator) listType(elem string) string {
+	if g.classStructsMap[elem] || g.annotClasses[elem] {
+		elem += "*"
+	}
+	name := "PyList_" + mangleType(elem)
+	if _, ok := g.listTypes[name]; ok && !g.listLater[name] {
+		return name + "*"
+	}
+	g.listTypes[name] = elem
+	if cls := strings.TrimSuffix(elem, "*"); g.annotClasses[cls] && !g.classStructsMap[cls] || g.enums[elem] != nil && !g.enums[elem].defined {
+		g.listLater[name] = true
+		return name + "*"
+	}
+	delete(g.listLater, name)
+	g.includes["stdlib.h"] = true
+	itemFmt, itemArg := g.typeFormat(elem, "l->items[i]")
+	if elem == "char*" {
+		itemFmt = "'%s'"
+	}
+	if e := g.enums[elem]; e != nil {
+		itemFmt, itemArg = "%s", g.enumHelper(e, "repr")+"(l->items[i])"
+	}
+	// -refcount：列表本身带计数，释放时放掉元素的引用；复制时元素计数加一
+	alloc, drop, item := fmt.Sprintf("(%s*)malloc(sizeof(%s))", name, name), "", "l->items[i]"
+	if g.optRefcount {
+		g.rcRuntime()
+		alloc = fmt.Sprintf("(%[1]s*)py_rc_alloc(sizeof(%[1]s), %[1]s_drop)", name)
+		release := ""
+		if g.isRcType(elem) {
+			release = "    for (int i = 0; i < l->len; i++) {\n        py_decref(l->items[i]);\n    }\n"
+			item = "py_incref(l->items[i])"
+		}
+		drop = fmt.Sprintf("static void %[1]s_drop(void* p) {\n    %[1]s* l = (%[1]s*)p;\n%[2]s    free(l->items);\n}\n", name, release)
+	}
+	code := fmt.Sprintf(`typedef struct {
+    %[2]s* items;
+    int len;
+    int cap;
+} %[1]s;
+%[6]sstatic %[1]s* %[1]s_new(void) {
+    %[1]s* l = %[7]s;
+    l->items = NULL;
+    l->len = 0;
+    l->cap = 0;
+    return l;
+}
+static void %[1]s_append(%[1]s* l, %[2]s v) {
+    if (l->len == l->cap) {
+        l->cap = l->cap ? l->cap * 2 : 4;
+        l->items = (%[2]s*)realloc(l->items, l->cap * sizeof(%[2]s));
+    }
+    l->items[l->len++] = v;
+}
+static %[2]s* %[1]s_at(%[1]s* l, int i) {
+    if (i < 0) {
+        i += l->len;
+    }
+    if (i < 0 || i >= l->len) {
+        %[9]s
+    }
+    return &l->items[i];
+}
+static %[2]s %[1]s_pop(%[1]s* l) {
+    if (l->len == 0) {
+        %[10]s
+    }
+    return l->items[--l->len];
+}
+static %[1]s* %[1]s_copy(%[1]s* l) {
+    %[1]s* c = %[1]s_new();
+    for (int i = 0; i < l->len; i++) {
+        %[1]s_append(c, %[8]s);
+    }
+    return c;
+}
+static char* %[1]s_str(%[1]s* l) {
+    char* buf = %[5]s;
+    int n = snprintf(buf, PY_STRBUF_SIZE, "[");
+    for (int i = 0; i < l->len && n < PY_STRBUF_SIZE; i++) {
+        n += snprintf(buf + n, PY_STRBUF_SIZE - n, i ? ", %[3]s" : "%[3]s", %[4]s);
+    }
+    if (n < PY_STRBUF_SIZE) {
+        snprintf(buf + n, PY_STRBUF_SIZE - n, "]");
+    }
+    return buf;
+}
+`, name, elem, itemFmt, itemArg, g.strBuf(), drop, alloc, item, g.runtimeError("IndexError", "list index out of range"), g.runtimeError("IndexError", "pop from empty list"))
+	g.classStructs = append(g.classStructs, code)
+	return name + "*"
+}
+
+// handleListMethodCall: xs.append(v) / xs.pop() / xs.copy()
+func (g *generator) handleListMethodCall(fn map[string]interface{}, call map[string]interface{}) (string, bool) {
+	lt := g.getType(fn["value"])
+	elem, ok := g.listElemType(lt)
+	if !ok {
+		return "", false
+	}
+	list := strings.TrimSuffix(lt, "*")
+	recv := g.toC(fn["value"].(map[string]interface{}), 0)
+	args, _ := call["args"].([]interface{})
+	method, _ := fn["attr"].(string)
+	switch {
+	case method == "append" && len(args) == 1:
+		v := g.toC(args[0].(map[string]interface{}), 0)
+		if g.isRcType(elem) {
+			v = g.rcRef(elem, v) // 容器持有自己的引用
+		}
+		return fmt.Sprintf("%s_append(%s, %s)", list, recv, g.upcastElem(elem, args[0], v)), true
+	case method == "pop" && len(args) == 0:
+		if !g.optRefcount {
+			// -owned-strings：元素可能与别的列表共享，取出的值仍按借用处理
+			return fmt.Sprintf("%s_pop(%s)", list, recv), true
+		}
+		return g.rcResult(call, fmt.Sprintf("%s_pop(%s)", list, recv)), true
+	case method == "copy" && len(args) == 0:
+		return g.rcResult(call, fmt.Sprintf("%s_copy(%s)", list, recv)), true
+	}
+	return g.unsupportedExpr(call, fmt.Sprintf("call: list method %s", method)), true
+}
+
+// handleForList: for x in xs -> 按下标遍历
+func (g *generator) handleForList(node ASTNode, elem string, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	target := g.toC(node["target"].(map[string]interface{}), 0)
+	list := g.toC(node["iter"].(map[string]interface{}), 0)
+	idx, idxDecl := g.loopTemp("_i", "int")
+	decl := target
+	g.pushScope(scopeBlock, "for")
+	defer g.popScope()
+	if !g.isDeclared(target) {
+		g.declareVar(target, elem)
+		decl = elem + " " + target
+	}
+	body := fmt.Sprintf("%s    %s = %s->items[%s];\n", pad, decl, list, idx)
+	if decl == target && g.isRcType(elem) && g.isOwned(target) {
+		// 循环变量原来持有引用：每一轮换成元素的引用
+		body = g.rcStore(target, elem, fmt.Sprintf("%s->items[%s]", list, idx), indent+1)
+	}
+	defer g.enterLoop()()
+	body += g.stmtsToC(node["body"], indent+1)
+	return fmt.Sprintf("%sfor (%s = 0; %s < %s->len; %s++) {\n%s%s}\n", pad, idxDecl, idx, list, idx, body, pad)
+}
+
+// --- copy.copy / copy.deepcopy ---
+
+// copyExpr: 浅拷贝：结构体直接赋值，堆上的对象与列表复制一层；
+// 深拷贝：逐层复制列表与对象字段（不处理循环引用）
+func (g *generator) copyExpr(arg ASTNode, deep bool) string {
+	t := g.getType(map[string]interface{}(arg))
+	expr := g.toC(arg, 0)
+	if deep {
+		if code := g.deepcopyCall(t, expr); code != expr {
+			return g.rcHold(t, code) // 新复制出来的列表/对象是新引用
+		}
+		return expr
+	}
+	if _, ok := g.listElemType(t); ok {
+		return g.rcHold(t, fmt.Sprintf("%s_copy(%s)", strings.TrimSuffix(t, "*"), expr))
+	}
+	if cls := strings.TrimSuffix(t, "*"); g.isObjectPointer(t) && g.classStructsMap[cls] {
+		fname := cls + "__copy"
+		if !g.copyFuncs[fname] {
+			g.copyFuncs[fname] = true
+			g.includes["stdlib.h"] = true
+			alloc, share := fmt.Sprintf("(%[1]s*)malloc(sizeof(%[1]s))", cls), ""
+			if g.optRefcount {
+				// 浅拷贝与原对象共享字段引用的值
+				alloc = g.rcAlloc(cls)
+				for _, path := range g.rcFieldPaths(cls) {
+					share += fmt.Sprintf("    py_incref(c->%s);\n", path)
+				}
+			}
+			g.classStructs = append(g.classStructs, fmt.Sprintf("static %[1]s* %[2]s(%[1]s* src) {\n    %[1]s* c = %[3]s;\n    *c = *src;\n%[4]s    return c;\n}\n", cls, fname, alloc, share))
+		}
+		return g.rcHold(t, fmt.Sprintf("%s(%s)", fname, expr))
+	}
+	// 栈上的结构体与标量：赋值本身就是拷贝
+	return expr
+}
+
+// deepcopyCall: 类型 t 的表达式 expr 的深拷贝表达式，不需要复制时原样返回
+func (g *generator) deepcopyCall(t, expr string) string {
+	if fname := g.deepcopyFunc(t); fname != "" {
+		if g.classStructsMap[t] {
+			expr = "&" + expr
+		}
+		return fmt.Sprintf("%s(%s)", fname, expr)
+	}
+	return expr
+}
+
+// deepcopyFunc: 生成并返回类型 t 的深拷贝函数名，标量和字符串（不可变）不需要复制，返回空
+// 列表 -> PyList_X_deepcopy，对象指针 -> Class__deepcopy_new，栈上对象 -> Class__deepcopy（按值返回）
+func (g *generator) deepcopyFunc(t string) string {
+	if elem, ok := g.listElemType(t); ok {
+		list := strings.TrimSuffix(t, "*")
+		inner := g.deepcopyFunc(elem)
+		if inner == "" {
+			return list + "_copy"
+		}
+		fname := list + "_deepcopy"
+		if !g.copyFuncs[fname] {
+			g.copyFuncs[fname] = true
+			g.classStructs = append(g.classStructs, fmt.Sprintf("static %[1]s* %[2]s(%[1]s* l) {\n    %[1]s* c = %[1]s_new();\n    for (int i = 0; i < l->len; i++) {\n        %[1]s_append(c, %[3]s(l->items[i]));\n    }\n    return c;\n}\n", list, fname, inner))
+		}
+		return fname
+	}
+	cls := strings.TrimSuffix(t, "*")
+	if !g.classStructsMap[cls] || g.copyFuncs[cls+"__busy"] {
+		// 字段引用自身类型（链表等）时只复制一层，避免无限递归
+		return ""
+	}
+	g.copyFuncs[cls+"__busy"] = true
+	defer delete(g.copyFuncs, cls+"__busy")
+	fields := ""
+	for c := cls; c != ""; c = g.classBases[c] {
+		for _, f := range g.classFieldOrder[c] {
+			path := g.fieldAccessPath(cls, f)
+			if inner := g.deepcopyFunc(g.classFieldType(cls, f)); inner != "" {
+				arg := "src->" + path
+				if g.classStructsMap[g.classFieldType(cls, f)] {
+					arg = "&" + arg
+				}
+				fields += fmt.Sprintf("    c.%s = %s(%s);\n", path, inner, arg)
+			} else if ft := g.classFieldType(cls, f); g.isRcType(ft) && g.optRefcount {
+				fields += fmt.Sprintf("    py_incref(c.%s);\n", path)
+			} else if g.isRcType(ft) {
+				// -owned-strings：字段里的字符串各有一份
+				fields += fmt.Sprintf("    c.%s = %s;\n", path, g.rcRef(ft, "c."+path))
+			}
+		}
+	}
+	if fields == "" && t == cls {
+		// 只有标量字段的结构体：赋值就是深拷贝
+		return ""
+	}
+	byValue := cls + "__deepcopy"
+	if !g.copyFuncs[byValue] {
+		g.copyFuncs[byValue] = true
+		g.classStructs = append(g.classStructs, fmt.Sprintf("static %[1]s %[2]s(%[1]s* src) {\n    %[1]s c = *src;\n%[3]s    return c;\n}\n", cls, byValue, fields))
+	}
+	if t == cls {
+		return byValue
+	}
+	fname := cls + "__deepcopy_new"
+	if !g.copyFuncs[fname] {
+		g.copyFuncs[fname] = true
+		g.includes["stdlib.h"] = true
+		alloc := fmt.Sprintf("(%[1]s*)malloc(sizeof(%[1]s))", cls)
+		if g.optRefcount {
+			alloc = g.rcAlloc(cls)
+		}
+		g.classStructs = append(g.classStructs, fmt.Sprintf("static %[1]s* %[2]s(%[1]s* src) {\n    %[1]s* c = %[4]s;\n    *c = %[3]s(src);\n    return c;\n}\n", cls, fname, byValue, alloc))
+	}
+	return fname
+}
+
+// enterScope: 进入函数体（或其他模块的顶层）前压入新的符号表并保存函数级的状态，调用返回的函数恢复，
+// 函数的参数与局部变量不会泄漏到外层，外层的同名变量也不会被当作已声明
+func (g *generator) enterScope(kind scopeKind, name string) func() {
+	saved := g.symtab
+	if kind == scopeModule {
+		g.symtab = nil // 每个模块有自己的顶层作用域
+	}
+	g.pushScope(kind, name)
+	savedOwned, savedIndent, savedLocals := g.ownedObjects, g.scopeIndent, g.rcLocals
+	savedFrames, savedBase, savedHandler, savedVar := g.tryFrames, g.loopTryBase, g.currentHandler, g.currentHandlerVar
+	savedTargets, savedDecls := g.statusTargets, g.tryDecls
+	g.ownedObjects, g.rcLocals = nil, nil
+	g.tryFrames, g.loopTryBase, g.currentHandler, g.currentHandlerVar = nil, 0, "", ""
+	g.statusTargets, g.tryDecls = nil, nil
+	return func() {
+		g.popScope()
+		g.symtab, g.ownedObjects, g.scopeIndent, g.rcLocals = saved, savedOwned, savedIndent, savedLocals
+		g.tryFrames, g.loopTryBase, g.currentHandler, g.currentHandlerVar = savedFrames, savedBase, savedHandler, savedVar
+		g.statusTargets, g.tryDecls = savedTargets, savedDecls
+	}
+}
+
+// collectListVars: 按作用域登记赋值为列表或 JSON 值（字典字面量、json.loads）的变量（xs = [...] 或 ys = xs）
+func (g *generator) collectListVars(node interface{}, scope string) {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			g.collectListVars(e, scope)
+		}
+	case ASTNode:
+		g.collectListVars(map[string]interface{}(n), scope)
+	case map[string]interface{}:
+		switch n["_type"] {
+		case "FunctionDef":
+			name, _ := n["name"].(string)
+			if strings.HasSuffix(scope, ".") {
+				g.collectListVars(n["body"], scope+name)
+			} else {
+				g.collectListVars(n["body"], name)
+				// 函数还没有生成时，调用点要知道它返回 JSON 值
+				if body, _ := n["body"].([]interface{}); scope == "" && g.funcResultType(name, body) == "PyJson*" {
+					g.jsonFuncs[name] = true
+				}
+			}
+			return
+		case "ClassDef":
+			name, _ := n["name"].(string)
+			g.collectListVars(n["body"], name+".")
+			return
+		case "Assign":
+			targets, _ := n["targets"].([]interface{})
+			value, _ := n["value"].(map[string]interface{})
+			if len(targets) == 1 {
+				tm, _ := targets[0].(map[string]interface{})
+				id, _ := tm["id"].(string)
+				lt := g.getType(value)
+				if value["_type"] == "Name" {
+					lt = g.listVars[scope][fmt.Sprint(value["id"])]
+				}
+				if fn, _ := value["func"].(map[string]interface{}); value["_type"] == "Call" && g.jsonFuncs[fmt.Sprint(fn["id"])] {
+					lt = "PyJson*"
+				}
+				if _, ok := g.listElemType(lt); (ok || lt == "PyJson*") && id != "" {
+					if g.listVars[scope] == nil {
+						g.listVars[scope] = map[string]string{}
+					}
+					g.listVars[scope][id] = lt
+				}
+			}
+		}
+		for _, k := range sortedNodeKeys(n) {
+			g.collectListVars(n[k], scope)
+		}
+	}
+}
+
+// printTempType: print 实参提前求值时临时变量的类型
+func (g *generator) printTempType(arg interface{}, format string) string {
+	if format == "%s" || format == "'%s'" {
+		return "char*"
+	}
+	return g.getType(arg)
+}
+
+// countCalls: 实参中函数调用的个数
+func countCalls(args []interface{}) int {
+	n := 0
+	for _, a := range args {
+		if am, _ := a.(map[string]interface{}); am["_type"] == "Call" {
+			n++
+		}
+	}
+	return n
+}
+
+// ownObject: 登记作用域顶层声明的对象；嵌套块里声明的对象出了 C 块就不可见，不登记
+func (g *generator) ownObject(name, class string, heap bool, indent int) {
+	if indent != g.scopeIndent || g.isOwned(name) {
+		return
+	}
+	g.ownedObjects = append(g.ownedObjects, ownedObj{name: name, class: class, heap: heap, rc: g.optRefcount || g.isRcType(class)})
+}
+
+// ownParams: 函数体中重新赋值的字符串参数在函数开头复制一份，由函数持有：
+// 赋值时释放的旧值不会是调用方的字符串，语句后释放的临时字符串也不会留在参数里
+func (g *generator) ownParams(params []irParam, body []interface{}) {
+	if !g.isRcType("char*") {
+		return
+	}
+	assigned := localNames(body)
+	for _, p := range params {
+		if p.typ == "char*" && assigned[p.name] {
+			g.rcLocals = append(g.rcLocals, fmt.Sprintf("%s = %s(%s);\n", p.name, g.strDup(), p.name))
+			g.ownObject(p.name, p.typ, false, g.scopeIndent)
+		}
+	}
+}
+
+// rcHoist: -refcount 模式下嵌套块里首次赋值的引用变量，声明（初始为 NULL）提到函数体开头，
+// 和 Python 一样活到作用域结束；之后的赋值（包括循环的下一轮）都按重新绑定处理
+func (g *generator) rcHoist(name, typ string, indent int) {
+	if g.isDeclared(name) || indent == g.scopeIndent || !g.isRcType(typ) {
+		return
+	}
+	g.declareHoisted(name, typ)
+	g.rcLocals = append(g.rcLocals, fmt.Sprintf("%s %s = NULL;\n", typ, name))
+	g.ownObject(name, typ, false, g.scopeIndent)
+}
+
+// tryHoist: try（以及按 try/finally 展开的 with）的 C 块里首次赋值的变量，声明提到最外层的 try 块之前，
+// 块后的代码（如 with open(...) as f: data = f.read() 之后）还能使用；对象与引用计数的变量不在此列
+func (g *generator) tryHoist(name, typ string) {
+	if g.isDeclared(name) || g.tryDecls == nil || name == "" || g.isRcType(typ) || g.classStructsMap[typ] {
+		return
+	}
+	g.declareIn(g.tryScope, name, typ, "hoisted")
+	*g.tryDecls = append(*g.tryDecls, fmt.Sprintf("%s %s;\n", typ, name))
+}
+
+// isOwned: 变量是否由当前作用域持有
+func (g *generator) isOwned(name string) bool {
+	for _, o := range g.ownedObjects {
+		if o.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// rebindObject: 变量已持有同类对象时返回销毁旧对象的代码，并告知可以复用原声明
+func (g *generator) rebindObject(name, class, pad string) (string, bool) {
+	declared := g.varType(name)
+	if declared != class && declared != class+"*" {
+		return "", false
+	}
+	for _, o := range g.ownedObjects {
+		if o.name == name {
+			return g.destroyObject(o, pad), true
+		}
+	}
+	return "", true
+}
+
+// destroyObject: 堆对象调用 Class_free，栈对象只在有 __del__ 时调用它
+func (g *generator) destroyObject(o ownedObj, pad string) string {
+	if o.rc {
+		return fmt.Sprintf("%s%s;\n", pad, g.rcRelease(o.name))
+	}
+	if o.heap {
+		g.ensureFreeFunc(o.class)
+		return fmt.Sprintf("%s%s_free(%s);\n", pad, o.class, o.name)
+	}
+	if _, ok := g.methodSigs[o.class+".__del__"]; ok {
+		return fmt.Sprintf("%s%s___del__(&%s);\n", pad, o.class, o.name)
+	}
+	return ""
+}
+
+// scopeExit: 作用域结束时销毁登记的对象，顺序与 CPython 清理局部变量一致（按声明顺序）
+func (g *generator) scopeExit(indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	code := ""
+	for _, o := range g.ownedObjects {
+		code += g.destroyObject(o, pad)
+	}
+	return code
+}
+
+// takePost: 取出 mark 之后登记的语句后释放代码（已缩进），用于不经过 toC 包装的表达式
+func (g *generator) takePost(mark, indent int) string {
+	post := g.pendingPost[mark:]
+	g.pendingPost = g.pendingPost[:mark]
+	return formatPre(post, indent)
+}
+
+// constructObject: name = Class(args)。逃逸的对象、-heap 与 -refcount 模式下放在堆上；
+// 变量原来持有对象时，先构造到临时变量，旧对象等新对象构造完再销毁（构造参数可能还在引用它）
+// ctorClass: node 是构造调用 Cls(...) 时返回类名
+func (g *generator) ctorClass(node interface{}) string {
+	m, _ := node.(map[string]interface{})
+	fn, _ := m["func"].(map[string]interface{})
+	class, _ := fn["id"].(string)
+	if m["_type"] != "Call" || fn["_type"] != "Name" || !g.annotClasses[class] {
+		return ""
+	}
+	return class
+}
+
+// newObject: 表达式中的构造调用（people.append(Person("a", 1))、f(Point(1, 2))）：对象没有名字，
+// 在堆上构造到临时指针变量中，和逃逸的对象一样不释放；-refcount 时语句结束后放掉临时变量的引用
+func (g *generator) newObject(class string, node ASTNode) string {
+	g.includes["stdlib.h"] = true
+	tmp := g.newTemp("_o")
+	g.declareTemp(tmp, class+"*")
+	alloc := fmt.Sprintf("(%s*)malloc(sizeof(%s))", class, class)
+	if g.optRefcount {
+		alloc = g.rcAlloc(class)
+	}
+	code := fmt.Sprintf("%s* %s = %s;\n", class, tmp, alloc)
+	if g.polyRoot[class] != "" {
+		code += fmt.Sprintf("%s->%s = &%s_vtbl;\n", tmp, g.vtblPath(class), class)
+	}
+	if g.hasInit(class) {
+		ctorArgs, _ := node["args"].([]interface{})
+		args := g.objectArgs(class+".__init__", ctorArgs, g.splitCallArgs(ctorArgs))
+		code += fmt.Sprintf("%s___init__(%s);\n", class, join(append([]string{tmp}, args...), ", "))
+	}
+	g.pendingPre = append(g.pendingPre, code)
+	if g.optRefcount {
+		g.rcTemps[tmp] = true
+		g.pendingPost = append(g.pendingPost, g.rcRelease(tmp)+";\n")
+	}
+	return tmp
+}
+
+// constructField: self.engine = Engine(100)：字段是嵌入的结构体，直接在字段上构造（组合）
+func (g *generator) constructField(target map[string]interface{}, value interface{}, indent int) (string, bool) {
+	vm, _ := value.(map[string]interface{})
+	fn, _ := vm["func"].(map[string]interface{})
+	class, _ := fn["id"].(string)
+	if vm["_type"] != "Call" || fn["_type"] != "Name" || !g.classStructsMap[class] {
+		return "", false
+	}
+	if g.classFieldType(g.receiverClass(target["value"]), fmt.Sprint(target["attr"])) != class {
+		return "", false
+	}
+	pad := strings.Repeat(" ", indent*4)
+	field := g.toC(target, 0)
+	code := ""
+	if g.polyRoot[class] != "" {
+		code = fmt.Sprintf("%s%s.%s = &%s_vtbl;\n", pad, field, g.vtblPath(class), class)
+	}
+	if !g.hasInit(class) {
+		return code, true
+	}
+	ctorArgs, _ := vm["args"].([]interface{})
+	args := g.objectArgs(class+".__init__", ctorArgs, g.splitCallArgs(ctorArgs))
+	return code + fmt.Sprintf("%s%s___init__(%s);\n", pad, class, join(append([]string{"&" + field}, args...), ", ")), true
+}
+
+func (g *generator) constructObject(name, class string, ctorArgs []interface{}, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	release, reuse := g.rebindObject(name, class, pad)
+	reason, escapes := g.escapeInfo[g.currentScope][name]
+	heap := escapes || g.optHeap || g.optRefcount
+	target := name
+	if release != "" {
+		target = g.newTemp("_o")
+	}
+	comment := ""
+	if escapes {
+		comment = " // escapes: " + reason
+	}
+	code := ""
+	recv := "&" + target
+	if heap {
+		g.includes["stdlib.h"] = true
+		recv = target
+		alloc := fmt.Sprintf("(%s*)malloc(sizeof(%s))", class, class)
+		if g.optRefcount {
+			alloc = g.rcAlloc(class)
+		}
+		decl := class + "* "
+		if reuse && target == name {
+			decl = ""
+		} else if g.optRefcount && target == name {
+			g.ownObject(name, class+"*", false, indent)
+		}
+		code = fmt.Sprintf("%s%s%s = %s;%s\n", pad, decl, target, alloc, comment)
+		if g.polyRoot[class] != "" {
+			code += fmt.Sprintf("%s%s->%s = &%s_vtbl;\n", pad, target, g.vtblPath(class), class)
+		}
+		g.declareVar(name, class+"*")
+	} else {
+		if !reuse || target != name {
+			code = fmt.Sprintf("%s%s %s;\n", pad, class, target)
+		}
+		if g.polyRoot[class] != "" {
+			code += fmt.Sprintf("%s%s.%s = &%s_vtbl;\n", pad, target, g.vtblPath(class), class)
+		}
+		g.declareVar(name, class)
+	}
+	if g.hasInit(class) {
+		code += fmt.Sprintf("%s%s___init__(%s);\n", pad, class, join(append([]string{recv}, g.splitCallArgs(ctorArgs)...), ", "))
+	}
+	if target != name {
+		code += release + fmt.Sprintf("%s%s = %s;\n", pad, name, target)
+	}
+	if !escapes && !g.optRefcount {
+		g.ownObject(name, class, heap, indent)
+	}
+	return code
+}
+
+// ensureFreeFunc: 生成 Class_free，先调用 __del__（含继承来的）再释放内存
+func (g *generator) ensureFreeFunc(class string) {
+	if g.freeFuncs[class] {
+		return
+	}
+	g.freeFuncs[class] = true
+	g.includes["stdlib.h"] = true
+	body := ""
+	if _, ok := g.methodSigs[class+".__del__"]; ok {
+		body = fmt.Sprintf("    %s___del__(self);\n", class)
+	}
+	g.classStructs = append(g.classStructs, fmt.Sprintf("void %s_free(%s* self) {\n%s    free(self);\n}\n", class, class, body))
+}
+
+// handleDelete: del x 立即销毁作用域持有的对象，其余目标只解除绑定
+func (g *generator) handleDelete(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	code := ""
+	targets, _ := node["targets"].([]interface{})
+	for _, t := range targets {
+		tm, _ := t.(map[string]interface{})
+		name, _ := tm["id"].(string)
+		found := false
+		for i, o := range g.ownedObjects {
+			if tm["_type"] == "Name" && o.name == name {
+				code += g.destroyObject(o, pad)
+				g.ownedObjects = append(g.ownedObjects[:i], g.ownedObjects[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			g.report(logWarn, tm, "del %s: nothing to release, the name stays defined", g.toC(tm, 0))
+			code += fmt.Sprintf("%s// del %s: no destructor path\n", pad, g.toC(tm, 0))
+		}
+	}
+	return code
+}
+
+// --- str.join ---
+
+// handleStrJoin: sep.join(xs) -> 循环拼接到轮转缓冲区，从第二个元素起先写分隔符。
+// 支持字符串列表，以及 sep.join(str(x) for x in xs/range(...)) 形式的生成器与列表推导
+func (g *generator) handleStrJoin(fn map[string]interface{}, call map[string]interface{}) (string, bool) {
+	args, _ := call["args"].([]interface{})
+	if fn["attr"] != "join" || g.getType(fn["value"]) != "char*" || len(args) != 1 {
+		return "", false
+	}
+	sep := g.toC(fn["value"].(map[string]interface{}), 0)
+	arg, _ := args[0].(map[string]interface{})
+	var iter, elt interface{} = arg, nil
+	target := ""
+	if arg["_type"] == "GeneratorExp" || arg["_type"] == "ListComp" {
+		gens, _ := arg["generators"].([]interface{})
+		if len(gens) != 1 {
+			return g.unsupportedExpr(call, "join: nested comprehension"), true
+		}
+		comp := gens[0].(map[string]interface{})
+		tm, _ := comp["target"].(map[string]interface{})
+		if ifs, _ := comp["ifs"].([]interface{}); len(ifs) > 0 || tm["_type"] != "Name" {
+			return g.unsupportedExpr(call, "join: comprehension with filter or tuple target"), true
+		}
+		iter, elt, target = comp["iter"], arg["elt"], tm["id"].(string)
+	}
+	i := g.newTemp("_i")
+	count, item, elem := "", "", ""
+	if im, _ := iter.(map[string]interface{}); isRangeCall(im) && target != "" {
+		rargs := im["args"].([]interface{})
+		start, stop := "0", g.toC(rargs[0].(map[string]interface{}), 0)
+		if len(rargs) == 2 {
+			start, stop = stop, g.toC(rargs[1].(map[string]interface{}), 0)
+		} else if len(rargs) != 1 {
+			return g.unsupportedExpr(call, "join: range with step"), true
+		}
+		count, item, elem = fmt.Sprintf("(%s - %s)", stop, start), fmt.Sprintf("%s + %s", start, i), "int"
+	} else if et, ok := g.listElemType(g.getType(iter)); ok {
+		list := g.toC(iter.(map[string]interface{}), 0)
+		count, item, elem = list+"->len", fmt.Sprintf("%s->items[%s]", list, i), et
+	} else {
+		return g.unsupportedExpr(call, "join: argument is not a list"), true
+	}
+	head, tail := "", ""
+	pieceF, pieceArgs := "%s", []string{item}
+	if target != "" {
+		// 生成器的循环变量只在循环体内可见
+		g.pushScope(scopeComprehension, "join")
+		g.declareVar(target, elem)
+		outer, outerPost := g.pendingPre, g.pendingPost
+		g.pendingPre, g.pendingPost = nil, nil
+		pieceF, pieceArgs = g.formatPieces(elt)
+		head = fmt.Sprintf("    %s %s = %s;\n", elem, target, item) + formatPre(g.pendingPre, 1)
+		tail = formatPre(g.pendingPost, 1)
+		g.pendingPre, g.pendingPost = outer, outerPost
+		g.popScope()
+	} else if elem != "char*" {
+		return g.unsupportedExpr(call, "join: list items are not strings"), true
+	}
+	buf, n := g.newTemp("_s"), g.newTemp("_n")
+	g.declareTemp(buf, "char*")
+	if g.isRcType("char*") {
+		// 逐个拼接到按实际长度分配的字符串，结果由临时变量持有
+		g.strRuntime()
+		acc := g.newTemp("_p")
+		piece := formatCall("py_str_format", pieceF, pieceArgs)
+		if pieceF == "%s" && len(pieceArgs) == 1 {
+			piece = fmt.Sprintf("py_str_borrow(%s)", pieceArgs[0])
+		}
+		loop := fmt.Sprintf("PyStr %[1]s = py_str_create(0);\nfor (int %[2]s = 0; %[2]s < %[3]s; %[2]s++) {\n", acc, i, count)
+		loop += head
+		loop += fmt.Sprintf("    if (%[1]s) {\n        %[2]s = py_str_concat(%[2]s, py_str_borrow(%[3]s));\n    }\n    %[2]s = py_str_concat(%[2]s, %[4]s);\n", i, acc, sep, piece)
+		loop += tail + "}\n"
+		loop += fmt.Sprintf("char* %s = %s.data;\n", buf, acc)
+		g.pendingPre = append(g.pendingPre, loop)
+		g.rcTemps[buf] = true
+		g.pendingPost = append(g.pendingPost, g.rcRelease(buf)+";\n")
+		return buf, true
+	}
+	loop := fmt.Sprintf("char* %[1]s = %[2]s;\n%[1]s[0] = '\\0';\n", buf, g.strBuf())
+	loop += fmt.Sprintf("for (int %[1]s = 0, %[2]s = 0; %[1]s < %[3]s && %[2]s < PY_STRBUF_SIZE; %[1]s++) {\n", i, n, count)
+	loop += head
+	loop += fmt.Sprintf("    %[1]s += snprintf(%[2]s + %[1]s, PY_STRBUF_SIZE - %[1]s, \"%%s%[3]s\", %[4]s ? %[5]s : \"\", %[6]s);\n", n, buf, pieceF, i, sep, join(pieceArgs, ", "))
+	loop += tail + "}\n"
+	g.pendingPre = append(g.pendingPre, loop)
+	return buf, true
+}
+
+// isRangeCall: 是否为 range(...) 调用
+func isRangeCall(m map[string]interface{}) bool {
+	fn, _ := m["func"].(map[string]interface{})
+	return m["_type"] == "Call" && fn["_type"] == "Name" && fn["id"] == "range"
+}
+
+// --- 引用计数（-refcount） ---
+
+// isRcType: -refcount 模式下由引用计数管理的类型：字符串、列表与（都在堆上的）对象；
+// -owned-strings 只管理字符串：变量与临时变量持有字符串的副本，离开作用域时释放
+func (g *generator) isRcType(t string) bool {
+	if !g.optRefcount {
+		return g.optOwnedStrs && t == "char*"
+	}
+	if _, ok := g.listElemType(t); ok || t == "char*" || t == "PyJson*" {
+		return true
+	}
+	cls := strings.TrimSuffix(t, "*")
+	return cls != t && (g.classStructsMap[cls] || g.annotClasses[cls])
+}
+
+// rcRuntime: 计数头放在对象前面，计数归零时先调用 drop 释放成员，再释放内存
+func (g *generator) rcRuntime() {
+	g.includes["stdlib.h"] = true
+	g.includes["string.h"] = true
+	g.runtimeHelpers["py_rc"] = `// reference counting: a hidden header in front of every heap value
+typedef struct {
+    int refs;
+    void (*drop)(void*);
+} PyRcHead;
+static void* py_rc_alloc(size_t size, void (*drop)(void*)) {
+    PyRcHead* h = (PyRcHead*)calloc(1, sizeof(PyRcHead) + size);
+    h->refs = 1;
+    h->drop = drop;
+    return h + 1;
+}
+static void* py_incref(void* p) {
+    if (p) {
+        ((PyRcHead*)p - 1)->refs++;
+    }
+    return p;
+}
+static void py_decref(void* p) {
+    if (!p) {
+        return;
+    }
+    PyRcHead* h = (PyRcHead*)p - 1;
+    if (--h->refs == 0) {
+        if (h->drop) {
+            h->drop(p);
+        }
+        free(h);
+    }
+}
+// strings are immutable: every stored string is a counted copy
+static char* py_str_new(const char* s) {
+    size_t n = strlen(s) + 1;
+    char* c = (char*)py_rc_alloc(n, NULL);
+    memcpy(c, s, n);
+    return c;
+}
+`
+}
+
+// strRuntime: 按实际长度分配的字符串（-owned-strings 与 -refcount）：PyStr 记下长度以及内存是否归它所有，
+// 拼接时放掉归它所有的操作数；变量与临时变量保存的是其中的 data（-refcount 时带计数头）
+func (g *generator) strRuntime() {
+	g.includes["stdlib.h"] = true
+	g.includes["string.h"] = true
+	g.includes["stdarg.h"] = true
+	alloc, release := "(char*)malloc(len + 1)", "free(s.data)"
+	if g.optRefcount {
+		g.rcRuntime()
+		alloc, release = "(char*)py_rc_alloc(len + 1, NULL)", "py_decref(s.data)"
+	}
+	// 排在 py_rc 之后
+	g.runtimeHelpers["py_str"] = fmt.Sprintf(`// owned strings: data is len bytes plus '\0'; owned strings allocated data and free it
+typedef struct {
+    char* data;
+    size_t len;
+    int owned;
+} PyStr;
+static PyStr py_str_borrow(const char* s) {
+    PyStr r;
+    r.data = (char*)s;
+    r.len = strlen(s);
+    r.owned = 0;
+    return r;
+}
+static PyStr py_str_create(size_t len) {
+    PyStr r;
+    r.data = %s;
+    r.data[0] = '\0';
+    r.len = len;
+    r.owned = 1;
+    return r;
+}
+static void py_str_free(PyStr s) {
+    if (s.owned) {
+        %s;
+    }
+}
+// a + b as a new string; a and b are released
+static PyStr py_str_concat(PyStr a, PyStr b) {
+    PyStr r = py_str_create(a.len + b.len);
+    memcpy(r.data, a.data, a.len);
+    memcpy(r.data + a.len, b.data, b.len + 1);
+    py_str_free(a);
+    py_str_free(b);
+    return r;
+}
+// printf into a new string of exactly the formatted length
+static PyStr py_str_format(const char* fmt, ...) {
+    va_list ap;
+    va_start(ap, fmt);
+    int n = vsnprintf(NULL, 0, fmt, ap);
+    va_end(ap);
+    PyStr r = py_str_create(n > 0 ? (size_t)n : 0);
+    va_start(ap, fmt);
+    vsnprintf(r.data, r.len + 1, fmt, ap);
+    va_end(ap);
+    return r;
+}
+`, alloc, release)
+}
+
+// rcAlloc: 分配带计数头的对象
+func (g *generator) rcAlloc(class string) string {
+	g.rcRuntime()
+	return fmt.Sprintf("(%s*)py_rc_alloc(sizeof(%s), %s__drop)", class, class, class)
+}
+
+// rcRef: 存入变量、字段、列表或作为返回值时取得自己的引用：字符串复制一份，其余计数加一
+// 表达式本身是保存新引用的临时变量时直接转交，不再释放它
+func (g *generator) rcRef(t, expr string) string {
+	for i, p := range g.pendingPost {
+		if g.rcTemps[expr] && p == g.rcRelease(expr)+";\n" {
+			g.pendingPost = append(g.pendingPost[:i:i], g.pendingPost[i+1:]...)
+			return expr
+		}
+	}
+	if t == "char*" {
+		return fmt.Sprintf("%s(%s)", g.strDup(), expr)
+	}
+	g.rcRuntime()
+	return fmt.Sprintf("py_incref(%s)", expr)
+}
+
+// rcRelease: 放掉 expr 持有的引用；-owned-strings 的字符串是普通的堆内存
+func (g *generator) rcRelease(expr string) string {
+	if !g.optRefcount {
+		return "free(" + expr + ")"
+	}
+	return "py_decref(" + expr + ")"
+}
+
+// rcStore: 给已持有引用的位置赋值：先取得新引用，再释放旧的（两者可能是同一个对象）
+func (g *generator) rcStore(slot, t, value string, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	old := g.newTemp("_o")
+	return fmt.Sprintf("%s%s %s = %s;\n%s%s = %s;\n%s%s;\n", pad, t, old, slot, pad, slot, g.rcRef(t, value), pad, g.rcRelease(old))
+}
+
+// rcStoreShared: 给字段或列表元素赋值。-owned-strings 下对象按值复制、sorted 等的结果与原列表共享元素，
+// 旧值可能还在别处使用：只存入副本，不释放旧值
+func (g *generator) rcStoreShared(slot, t, value string, indent int) string {
+	if !g.optRefcount {
+		return fmt.Sprintf("%s%s = %s;\n", strings.Repeat(" ", indent*4), slot, g.rcRef(t, value))
+	}
+	return g.rcStore(slot, t, value, indent)
+}
+
+// rcResult: 返回新引用的调用先存入临时变量，语句结束后释放
+// 方法调用按登记的返回类型判断，getType 对未知调用默认为 char*
+func (g *generator) rcResult(call map[string]interface{}, code string) string {
+	fn, _ := call["func"].(map[string]interface{})
+	if _, ok := g.listElemType(g.getType(fn["value"])); !ok && fn["_type"] == "Attribute" {
+		method, _ := fn["attr"].(string)
+		owner := g.resolveMethodClass(g.receiverClass(fn["value"]), method)
+		return g.rcHold(g.methodSigs[owner+"."+method].ret, code)
+	}
+	return g.rcHold(g.getType(call), code)
+}
+
+// rcHold: 把类型为 t 的新引用存入临时变量，语句结束后释放
+func (g *generator) rcHold(t, code string) string {
+	if !g.isRcType(t) {
+		return code
+	}
+	tmp := g.newTemp("_t")
+	g.declareTemp(tmp, t)
+	g.rcTemps[tmp] = true
+	g.pendingPre = append(g.pendingPre, fmt.Sprintf("%s %s = %s;\n", t, tmp, code))
+	g.pendingPost = append(g.pendingPost, g.rcRelease(tmp)+";\n")
+	return tmp
+}
+
+// rcFieldPaths: 类（含继承来的）由引用计数管理的字段访问路径
+func (g *generator) rcFieldPaths(class string) []string {
+	paths := []string{}
+	for c := class; c != ""; c = g.classBases[c] {
+		for _, f := range g.classFieldOrder[c] {
+			if g.isRcType(g.classFieldType(class, f)) {
+				paths = append(paths, g.fieldAccessPath(class, f))
+			}
+		}
+	}
+	return paths
+}
+
+// dropFunc: 对象计数归零时调用 __del__，再释放字段持有的引用
+func (g *generator) dropFunc(class string) string {
+	body := fmt.Sprintf("    %s* self = (%s*)p;\n", class, class)
+	if _, ok := g.methodSigs[class+".__del__"]; ok {
+		body += fmt.Sprintf("    %s___del__(self);\n", class)
+	}
+	for _, path := range g.rcFieldPaths(class) {
+		body += fmt.Sprintf("    py_decref(self->%s);\n", path)
+	}
+	for c := class; c != ""; c = g.classBases[c] {
+		for _, f := range g.classFieldOrder[c] {
+			if t := g.classFieldType(class, f); g.classStructsMap[t] {
+				// 嵌入的对象（组合）随外层对象一起销毁
+				body += fmt.Sprintf("    %s__drop(&self->%s);\n", t, g.fieldAccessPath(class, f))
+			}
+		}
+	}
+	return fmt.Sprintf("static void %s__drop(void* p) {\n%s}\n", class, body)
+}
+
+// --- 调用图（-emit-callgraph） ---
+
+// callGraphNode / callGraphEdge: JSON 输出格式
+type callGraphNode struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"` // translated：由 Python 翻译；runtime：生成的辅助函数；external：C 库函数；indirect：经虚表/函数指针调用
+	Python string `json:"python,omitempty"`
+}
+
+type callGraphEdge struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Dropped bool   `json:"dropped,omitempty"` // Python 中有这个调用，生成的 C 里没有（折叠、省略或翻译丢失）
+}
+
+var cFuncHeader = regexp.MustCompile(`^\s*(?:static\s+)?(?:const\s+)?\w+[\s*]+(\w+)\(.*\)\s*\{$`)
+var cCallSite = regexp.MustCompile(`(->|\.)?\b([A-Za-z_]\w*)\s*\(`)
+var cLiteral = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`)
+var cKeywords = map[string]bool{"if": true, "for": true, "while": true, "switch": true, "return": true, "sizeof": true, "else": true}
+
+// parseCCalls: 从生成的 C 代码中找出函数定义及其函数体里的调用；
+// 经虚表或函数指针的调用（->m(...)）记为 "->m"
+func parseCCalls(source string) ([]string, map[string][]string) {
+	order := []string{}
+	calls := map[string][]string{}
+	current, depth := "", 0
+	for _, line := range strings.Split(source, "\n") {
+		code := cLiteral.ReplaceAllString(line, `""`)
+		if current == "" {
+			if m := cFuncHeader.FindStringSubmatch(code); m != nil && !cKeywords[m[1]] {
+				current, depth = m[1], 0
+				order = append(order, current)
+				calls[current] = []string{}
+			} else {
+				continue
+			}
+		} else {
+			for _, m := range cCallSite.FindAllStringSubmatch(code, -1) {
+				if callee := m[1] + m[2]; !cKeywords[m[2]] && !containsStr(calls[current], callee) {
+					calls[current] = append(calls[current], callee)
+				}
+			}
+		}
+		depth += strings.Count(code, "{") - strings.Count(code, "}")
+		if depth <= 0 {
+			current = ""
+		}
+	}
+	return order, calls
+}
+
+// pythonCalls: Python 源码中可以对应到 C 函数的调用：顶层函数、构造函数、self.方法、类名.静态方法
+func (g *generator) pythonCalls(node interface{}, caller, class string, out map[string][]string) {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			g.pythonCalls(e, caller, class, out)
+		}
+	case ASTNode:
+		g.pythonCalls(map[string]interface{}(n), caller, class, out)
+	case map[string]interface{}:
+		switch n["_type"] {
+		case "ClassDef":
+			class = n["name"].(string)
+		case "FunctionDef":
+			if class != "" {
+				caller = class + "_" + n["name"].(string)
+			} else {
+				caller = n["name"].(string)
+			}
+		case "Call":
+			fn, _ := n["func"].(map[string]interface{})
+			callee := ""
+			switch fn["_type"] {
+			case "Name":
+				name, _ := fn["id"].(string)
+				if g.classStructsMap[name] && g.hasInit(name) {
+					callee = name + "___init__"
+				} else if _, ok := g.funcNodes[name]; ok {
+					callee = name
+				}
+			case "Attribute":
+				recv, _ := fn["value"].(map[string]interface{})
+				method, _ := fn["attr"].(string)
+				if id, _ := recv["id"].(string); id == "self" && class != "" {
+					callee = g.resolveMethodClass(class, method) + "_" + method
+				} else if g.classStructsMap[id] {
+					callee = id + "_" + method
+				}
+			}
+			if callee != "" && !strings.HasPrefix(callee, "_") && !containsStr(out[caller], callee) {
+				out[caller] = append(out[caller], callee)
+			}
+		}
+		for _, k := range sortedKeys(n) {
+			if k != "_type" {
+				g.pythonCalls(n[k], caller, class, out)
+			}
+		}
+	}
+}
+
+// callGraph: 生成代码的调用图（format 为 json 或 dot），并标出 Python 中存在、C 中丢失的调用
+func (g *generator) callGraph(format string, root ASTNode, source string) (string, error) {
+	order, calls := parseCCalls(source)
+	defined := map[string]bool{}
+	for _, f := range order {
+		defined[f] = true
+	}
+	nodes := []callGraphNode{}
+	seen := map[string]bool{}
+	addNode := func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		kind := "external"
+		if strings.HasPrefix(name, "->") {
+			kind = "indirect"
+		} else if g.translatedFuncs[name] != "" {
+			kind = "translated"
+		} else if defined[name] {
+			kind = "runtime"
+		}
+		nodes = append(nodes, callGraphNode{Name: name, Kind: kind, Python: g.translatedFuncs[name]})
+	}
+	edges := []callGraphEdge{}
+	for _, f := range order {
+		addNode(f)
+		for _, callee := range calls[f] {
+			if strings.HasPrefix(callee, ".") {
+				callee = "->" + callee[1:]
+			}
+			addNode(callee)
+			edges = append(edges, callGraphEdge{From: f, To: callee})
+		}
+	}
+	expected := map[string][]string{}
+	g.pythonCalls(root, "main", "", expected)
+	for _, caller := range sortedKeys(expected) {
+		if !defined[caller] {
+			continue
+		}
+		for _, callee := range expected[caller] {
+			method := callee[strings.LastIndex(callee, "_")+1:]
+			if containsStr(calls[caller], callee) || containsStr(calls[caller], "->"+method) {
+				continue
+			}
+			addNode(callee)
+			edges = append(edges, callGraphEdge{From: caller, To: callee, Dropped: true})
+		}
+	}
+	if format == "json" {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false) // 保留 "<module>" 原样
+		enc.SetIndent("", "  ")
+		graph := struct {
+			Nodes []callGraphNode `json:"nodes"`
+			Edges []callGraphEdge `json:"edges"`
+		}{nodes, edges}
+		if err := enc.Encode(graph); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	dot := "digraph callgraph {\n    rankdir=LR;\n"
+	for _, n := range nodes {
+		switch n.Kind {
+		case "translated":
+			dot += fmt.Sprintf("    %q [shape=box, label=%q];\n", n.Name, n.Name+"\n"+n.Python)
+		case "runtime":
+			dot += fmt.Sprintf("    %q [shape=ellipse, style=filled, fillcolor=lightgrey];\n", n.Name)
+		case "indirect":
+			dot += fmt.Sprintf("    %q [shape=diamond];\n", n.Name)
+		default:
+			dot += fmt.Sprintf("    %q [shape=plaintext];\n", n.Name)
+		}
+	}
+	for _, e := range edges {
+		if e.Dropped {
+			dot += fmt.Sprintf("    %q -> %q [style=dashed, color=red, label=\"dropped\"];\n", e.From, e.To)
+			continue
+		}
+		dot += fmt.Sprintf("    %q -> %q;\n", e.From, e.To)
+	}
+	return dot + "}\n", nil
+}
+
+// mapValues: 按键排序后的值，与输出顺序一致
+func mapValues(m map[string]string) []string {
+	values := []string{}
+	for _, k := range sortedKeys(m) {
+		values = append(values, m[k])
+	}
+	return values
+}
+
+// --- 异常（setjmp/longjmp） ---
+
+// tryFrame: 一个 try 块的异常帧；离开 try 块时要执行的 finally 语句，
+// 以及随后执行的 C 清理代码（如释放逐行读文件的缓冲区，这种帧没有名字）
+type tryFrame struct {
+	name    string
+	finally []interface{}
+	cleanup string
+}
+
+var builtinExcBases = map[string]string{
+	"BaseException": "", "Exception": "BaseException", "KeyboardInterrupt": "BaseException", "SystemExit": "BaseException",
+	"ArithmeticError": "Exception", "ZeroDivisionError": "ArithmeticError", "OverflowError": "ArithmeticError",
+	"LookupError": "Exception", "IndexError": "LookupError", "KeyError": "LookupError",
+	"ValueError": "Exception", "TypeError": "Exception", "AttributeError": "Exception", "NameError": "Exception",
+	"AssertionError": "Exception", "StopIteration": "Exception", "OSError": "Exception", "EOFError": "Exception",
+	"RuntimeError": "Exception", "NotImplementedError": "RuntimeError", "RecursionError": "RuntimeError",
+	"FileNotFoundError": "OSError", "FileExistsError": "OSError", "PermissionError": "OSError",
+}
+
+// collectExceptions: 登记继承自异常的类（按定义顺序，父类在前），并记下是否用到 try/raise
+func (g *generator) collectExceptions(node interface{}) {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			g.collectExceptions(e)
+		}
+	case ASTNode:
+		g.collectExceptions(map[string]interface{}(n))
+	case map[string]interface{}:
+		switch n["_type"] {
+		case "Try", "Raise":
+			g.usesExceptions = g.optExceptions == "setjmp"
+		case "ClassDef":
+			name, _ := n["name"].(string)
+			if bases, _ := n["bases"].([]interface{}); len(bases) > 0 {
+				if b, _ := bases[0].(map[string]interface{}); b["_type"] == "Name" {
+					if id, _ := b["id"].(string); g.isExcName(id) {
+						g.excBases[name] = id
+						g.excClasses[name] = true
+					}
+				}
+			}
+		}
+		for _, k := range sortedKeys(n) {
+			g.collectExceptions(n[k])
+		}
+	}
+}
+
+// isExcName: 名字是否为已知的异常类型
+func (g *generator) isExcName(name string) bool {
+	_, ok := g.excBases[name]
+	return ok
+}
+
+// excType: 异常类型描述符的地址；首次使用时连同父类一起生成
+// （-exceptions=status 时为错误码常量 PY_ERR_名字）
+func (g *generator) excType(name string) string {
+	if g.optExceptions == "status" {
+		return g.errCode(name)
+	}
+	g.excRuntime()
+	depth := 0
+	for b := g.excBases[name]; b != ""; b = g.excBases[b] {
+		depth++
+	}
+	base := "NULL"
+	if b := g.excBases[name]; b != "" {
+		base = g.excType(b)
+	}
+	// 键按继承深度排序，父类总在子类之前输出
+	g.runtimeHelpers[fmt.Sprintf("py_exc_%02d_%s", depth, name)] = fmt.Sprintf("static const PyExcType PyExc_%[1]s = {\"%[1]s\", %[2]s};\n", name, base)
+	return "&PyExc_" + name
+}
+
+// excRuntime: 异常帧栈、py_raise 与类型匹配
+func (g *generator) excRuntime() {
+	g.includes["setjmp.h"] = true
+	g.includes["stdlib.h"] = true
+	g.runtimeHelpers["py_exc"] = `// exceptions: every try block pushes a frame, py_raise longjmps to the innermost one
+typedef struct PyExcType {
+    const char* name;
+    const struct PyExcType* base;
+} PyExcType;
+// the exception record bound by "except E as e"
+typedef struct {
+    const PyExcType* type;
+    char msg[256];
+    int line; // line of the raise statement, 0 for errors raised by runtime helpers
+} PyException;
+typedef struct PyExcFrame {
+    jmp_buf env;
+    struct PyExcFrame* prev;
+    PyException exc; // exc.type is NULL until an exception reaches this frame
+} PyExcFrame;
+static _Thread_local PyExcFrame* py_exc_top = NULL;
+static void py_try_push(PyExcFrame* f) {
+    f->prev = py_exc_top;
+    f->exc.type = NULL;
+    f->exc.msg[0] = '\0';
+    f->exc.line = 0;
+    py_exc_top = f;
+}
+static void py_try_pop(PyExcFrame* f) {
+    py_exc_top = f->prev;
+}
+// is t the handler type h or one of its subclasses
+static int py_exc_matches(const PyExcType* t, const PyExcType* h) {
+    for (; t; t = t->base) {
+        if (t == h) {
+            return 1;
+        }
+    }
+    return 0;
+}
+// unwind to the innermost try block; without one, report like py_warn and exit
+static _Noreturn void py_raise(const PyExcType* type, const char* msg, int line) {
+    PyExcFrame* f = py_exc_top;
+    if (!f) {
+        if (line) {
+            fprintf(stderr, "line %d: ", line);
+        }
+        if (msg[0]) {
+            fprintf(stderr, "%s: %s\n", type->name, msg);
+        } else {
+            fprintf(stderr, "%s\n", type->name);
+        }
+        exit(1);
+    }
+    py_exc_top = f->prev;
+    f->exc.type = type;
+    snprintf(f->exc.msg, sizeof f->exc.msg, "%s", msg);
+    f->exc.line = line;
+    longjmp(f->env, 1);
+}
+static _Noreturn void py_reraise(const PyException* e) {
+    py_raise(e->type, e->msg, e->line);
+}
+`
+}
+
+// runtimeError: 运行时辅助函数里的错误；用到异常时抛出，否则打印后退出
+func (g *generator) runtimeError(exc, msg string) string {
+	if g.usesExceptions {
+		return fmt.Sprintf("py_raise(%s, \"%s\", 0);", g.excType(exc), msg)
+	}
+	g.includes["stdlib.h"] = true
+	return fmt.Sprintf("fprintf(stderr, \"%s: %s\\n\");\n        exit(1);", exc, msg)
+}
+
+// excMatch: except 子句的匹配条件；"1" 表示匹配所有异常，"" 表示类型不认识
+func (g *generator) excMatch(t interface{}, current string) string {
+	m, _ := t.(map[string]interface{})
+	if m == nil {
+		return "1"
+	}
+	names := []interface{}{m}
+	if m["_type"] == "Tuple" {
+		names = m["elts"].([]interface{})
+	}
+	conds := []string{}
+	for _, e := range names {
+		id, _ := e.(map[string]interface{})["id"].(string)
+		if id == "BaseException" {
+			return "1"
+		}
+		if g.isExcName(id) && g.optExceptions == "status" {
+			conds = append(conds, fmt.Sprintf("py_err_matches(%s, %s)", current, g.excType(id)))
+		} else if g.isExcName(id) {
+			conds = append(conds, fmt.Sprintf("py_exc_matches(%s, %s)", current, g.excType(id)))
+		}
+	}
+	return join(conds, " || ")
+}
+
+// handleRaise: raise E(msg) / raise E / raise（在 except 中重新抛出当前异常）。
+// 生成的异常记录带有类型、消息和 raise 所在行；-exceptions=exit 时打印到 stderr 后退出，
+// -exceptions=status 时记下错误并把状态码交给外层
+func (g *generator) handleRaise(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	line := fmt.Sprint(node["lineno"])
+	exc, _ := node["exc"].(map[string]interface{})
+	if id, _ := exc["id"].(string); exc == nil || (id != "" && id == g.currentHandlerVar) {
+		if g.currentHandler == "" {
+			return g.raiseCode("RuntimeError", `"No active exception to reraise"`, line, pad)
+		}
+		if g.optExceptions == "status" {
+			// 状态变量还保存着正在处理的错误
+			return formatPre([]string{g.statusJump(g.currentHandler)}, indent)
+		}
+		return fmt.Sprintf("%spy_reraise(&%s.exc);\n", pad, g.currentHandler)
+	}
+	name, msg := "", `""`
+	switch exc["_type"] {
+	case "Name":
+		name, _ = exc["id"].(string)
+	case "Call":
+		fn, _ := exc["func"].(map[string]interface{})
+		name, _ = fn["id"].(string)
+		if args, _ := exc["args"].([]interface{}); len(args) > 0 {
+			arg := args[0].(map[string]interface{})
+			if op, _ := arg["op"].(map[string]interface{}); arg["_type"] == "JoinedStr" || arg["_type"] == "BinOp" && op["_type"] == "Add" && g.getType(arg) == "char*" {
+				// 异常记录复制消息；抛出后不会执行语句末尾的释放，格式化到轮转缓冲区
+				msg = g.formatString(arg, false)
+			} else if g.getType(arg) == "char*" {
+				msg = g.toC(arg, 0)
+			} else {
+				// 其他类型的参数按 str() 格式化
+				msg = g.formatString(map[string]interface{}{"_type": "JoinedStr", "values": []interface{}{
+					map[string]interface{}{"_type": "FormattedValue", "value": arg, "conversion": json.Number("-1")},
+				}}, false)
+			}
+		}
+	}
+	if !g.isExcName(name) {
+		return g.unsupportedStmt(node, pad, fmt.Sprintf("raise: %s", name))
+	}
+	if g.optExceptions == "exit" {
+		// 退出前执行本函数里外层 try 的 finally
+		return g.tryUnwind(0, indent) + g.raiseCode(name, msg, line, pad)
+	}
+	return g.raiseCode(name, msg, line, pad)
+}
+
+// raiseCode: 抛出类型为 name、消息为 msg（C 字符串表达式）的异常
+func (g *generator) raiseCode(name, msg, line, pad string) string {
+	if g.optExceptions == "exit" {
+		g.includes["stdlib.h"] = true
+		if msg == `""` {
+			return fmt.Sprintf("%sfprintf(stderr, \"line %s: %s\\n\");\n%sexit(1);\n", pad, line, name, pad)
+		}
+		return fmt.Sprintf("%sfprintf(stderr, \"line %s: %s: %%s\\n\", %s);\n%sexit(1);\n", pad, line, name, msg, pad)
+	}
+	if g.optExceptions == "status" {
+		return formatPre([]string{g.statusJump(fmt.Sprintf("py_err_set(%s, %s, %s)", g.excType(name), msg, line))}, len(pad)/4)
+	}
+	return fmt.Sprintf("%spy_raise(%s, %s, %s);\n", pad, g.excType(name), msg, line)
+}
+
+// excClassDef: class E(Exception)：只生成异常类型描述符，类体不翻译
+func (g *generator) excClassDef(node ASTNode) string {
+	name, _ := node["name"].(string)
+	if g.optExceptions == "setjmp" {
+		g.excType(name)
+	}
+	for _, stmt := range node["body"].([]interface{}) {
+		switch s := stmt.(map[string]interface{}); s["_type"] {
+		case "Pass":
+		case "Expr":
+			if v, _ := s["value"].(map[string]interface{}); v["_type"] == "Constant" {
+				continue
+			}
+			return fmt.Sprintf("    // exception class %s: only the type is translated, class body ignored\n", name)
+		default:
+			return fmt.Sprintf("    // exception class %s: only the type is translated, class body ignored\n", name)
+		}
+	}
+	return ""
+}
+
+// excObjectOfType: node 为 type(e)（e 为异常记录）时返回 e
+func (g *generator) excObjectOfType(node interface{}) string {
+	call, _ := node.(map[string]interface{})
+	fn, _ := call["func"].(map[string]interface{})
+	args, _ := call["args"].([]interface{})
+	if call["_type"] != "Call" || fn["id"] != "type" || len(args) != 1 || !isExcRecord(g.getType(args[0])) {
+		return ""
+	}
+	return g.toC(args[0].(map[string]interface{}), 0)
+}
+
+// tryUnwind: return/break/continue 离开 try 块：从内到外弹出 base 之后的异常帧并执行 finally
+func (g *generator) tryUnwind(base, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	frames := g.tryFrames
+	defer func() { g.tryFrames = frames }()
+	code := ""
+	for i := len(frames) - 1; i >= base; i-- {
+		g.tryFrames = frames[:i]
+		if frames[i].name != "" {
+			code += fmt.Sprintf("%spy_try_pop(&%s);\n", pad, frames[i].name)
+		}
+		code += g.stmtsToC(frames[i].finally, indent)
+		if frames[i].cleanup != "" {
+			code += formatPre([]string{frames[i].cleanup}, indent)
+		}
+	}
+	return code
+}
+
+// tryPop: try 块正常结束时弹出异常帧；以 return/raise/break/continue 结尾时已经离开
+func tryPop(body interface{}, frame string, indent int) string {
+	if endsWithJump(body) {
+		return ""
+	}
+	return fmt.Sprintf("%spy_try_pop(&%s);\n", strings.Repeat(" ", indent*4), frame)
+}
+
+// endsWithJump: 语句块是否以 return/raise/break/continue 结尾
+func endsWithJump(body interface{}) bool {
+	stmts, _ := body.([]interface{})
+	if len(stmts) == 0 {
+		return false
+	}
+	switch stmts[len(stmts)-1].(map[string]interface{})["_type"] {
+	case "Return", "Raise", "Break", "Continue":
+		return true
+	}
+	return false
+}
+
+// enterLoop: 循环体内的 break/continue 只离开循环里打开的 try 块
+func (g *generator) enterLoop() func() {
+	saved := g.loopTryBase
+	g.loopTryBase = len(g.tryFrames)
+	return func() { g.loopTryBase = saved }
+}
+
+// usesResultPointer: 函数是否通过 result 指针返回值（方法直接返回）
+func (g *generator) usesResultPointer(scope string) bool {
+	return g.funcResultTypes[scope] != "" && !strings.Contains(scope, ".") && !g.classStructsMap[scope]
+}
+
+// --- -annotate：原 Python 语句注释 ---
+
+// annotatedTypes: 不经过语句包装、但也要加注释的语句
+var annotatedTypes = map[string]bool{
+	"Try": true, "With": true, "Break": true, "Continue": true, "Import": true, "ImportFrom": true,
+}
+
+// annotation: 语句之前的注释：-comments 时源码中的 # 注释，-annotate 时语句本身
+func (g *generator) annotation(node map[string]interface{}, indent int) string {
+	return g.comments(node, indent) + g.sourceLines(node, indent)
+}
+
+// sourceLines: 语句对应的 Python 源码注释；复合语句只取到第一条子语句之前的头部
+func (g *generator) sourceLines(node map[string]interface{}, indent int) string {
+	if !g.optAnnotate {
+		return ""
+	}
+	pad := strings.Repeat(" ", indent*4)
+	start, err := strconv.Atoi(fmt.Sprint(node["lineno"]))
+	if err != nil || start < 1 {
+		return ""
+	}
+	if start > len(g.pySource) {
+		return fmt.Sprintf("%s// line %d\n", pad, start)
+	}
+	end, err := strconv.Atoi(fmt.Sprint(node["end_lineno"]))
+	if err != nil || end < start {
+		end = start
+	}
+	if body, ok := node["body"].([]interface{}); ok && len(body) > 0 {
+		if first, err := strconv.Atoi(fmt.Sprint(body[0].(map[string]interface{})["lineno"])); err == nil {
+			end = first - 1
+			if end < start {
+				end = start // 单行的 if x: y
+			}
+		}
+	}
+	if end > len(g.pySource) {
+		end = len(g.pySource)
+	}
+	lines := g.pySource[start-1 : end]
+	if strings.HasPrefix(strings.TrimSpace(lines[0]), "elif") {
+		// elif 接在 else 后面，注释放不进去
+		return ""
+	}
+	// 去掉语句本身的缩进与末尾的空行、续行符（行尾的 \ 在 C 注释里会把下一行也变成注释）
+	col, _ := strconv.Atoi(fmt.Sprint(node["col_offset"]))
+	out := ""
+	for _, l := range lines {
+		l = strings.TrimRight(l, " \t\r")
+		if col >= 0 && len(l) >= col && strings.TrimSpace(l[:col]) == "" {
+			l = l[col:]
+		}
+		l = strings.TrimRight(strings.TrimSuffix(l, "\\"), " \t")
+		if l != "" {
+			out += pad + "// " + l + "\n"
+		}
+	}
+	return out
+}
+
+// --- 文档字符串 ---
+
+// docstring: 函数、类或模块的文档字符串（语句块中第一条是字符串常量的表达式语句）
+func docstring(body interface{}) (string, bool) {
+	stmts, _ := body.([]interface{})
+	if len(stmts) == 0 {
+		return "", false
+	}
+	first, _ := stmts[0].(map[string]interface{})
+	value, _ := first["value"].(map[string]interface{})
+	doc, ok := value["value"].(string)
+	return doc, ok && first["_type"] == "Expr" && value["_type"] == "Constant"
+}
+
+// docComment: 文档字符串输出为定义前的 /** */ 注释（按 inspect.cleandoc 去掉缩进与首尾空行），
+// -strip-docstrings 时不输出
+func (g *generator) docComment(body interface{}, pad string) string {
+	doc, ok := docstring(body)
+	if !ok || g.optStripDocs {
+		return ""
+	}
+	lines := strings.Split(strings.ReplaceAll(doc, "\t", "        "), "\n")
+	margin := -1
+	for _, l := range lines[1:] {
+		if text := strings.TrimLeft(l, " "); text != "" && (margin < 0 || len(l)-len(text) < margin) {
+			margin = len(l) - len(text)
+		}
+	}
+	for i, l := range lines {
+		if i == 0 {
+			l = strings.TrimLeft(l, " ")
+		} else if len(l) >= margin && margin > 0 {
+			l = l[margin:]
+		}
+		// 文档中的 */ 会提前结束注释
+		l = strings.ReplaceAll(strings.ReplaceAll(l, "*/", "* /"), "/*", "/ *")
+		lines[i] = strings.TrimRight(l, " \r")
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	switch len(lines) {
+	case 0:
+		return ""
+	case 1:
+		return pad + "/** " + lines[0] + " */\n"
+	}
+	code := pad + "/**\n"
+	for _, l := range lines {
+		code += strings.TrimRight(pad+" * "+l, " ") + "\n"
+	}
+	return code + pad + " */\n"
+}
+
+// --- -line-map：指回 Python 源码的行号 ---
+
+// lineResetMark: 函数与 main 结束处的占位行，写文件时换成指回 C 文件本身的 #line
+const lineResetMark = "#line py2c-reset\n"
+
+// lineMark: 语句前的 #line 指令或 /* 文件:行:列 */ 注释；elif 的标记由 handleIf 放在 else 之前
+func (g *generator) lineMark(node map[string]interface{}, indent int) string {
+	if g.optLineMap == "none" || node["_elif"] == true {
+		return ""
+	}
+	line, err := strconv.Atoi(fmt.Sprint(node["lineno"]))
+	if err != nil || line < 1 {
+		return ""
+	}
+	if g.optLineMap == "directive" {
+		return fmt.Sprintf("#line %d \"%s\"\n", line, cEscape(g.pyFile))
+	}
+	col, _ := strconv.Atoi(fmt.Sprint(node["col_offset"]))
+	return fmt.Sprintf("%s/* %s:%d:%d */\n", strings.Repeat(" ", indent*4), g.pyFile, line, col+1)
+}
+
+// lineReset: 之后的代码不再对应 Python 源码（函数的结尾、main 的 return 等）
+func (g *generator) lineReset() string {
+	if g.optLineMap != "directive" {
+		return ""
+	}
+	return lineResetMark
+}
+
+// isLineMark: lineMark 生成的行
+func isLineMark(line string) bool {
+	return strings.HasPrefix(line, "#line ") || strings.HasPrefix(line, "/* ") && strings.HasSuffix(line, " */") && strings.Contains(line, ".py:")
+}
+
+// resolveLineResets: 占位行换成 #line 下一行的行号 "C 文件"，编译器对生成的代码报自己的位置
+func resolveLineResets(src, path string) string {
+	if !strings.Contains(src, lineResetMark) {
+		return src
+	}
+	lines := strings.SplitAfter(src, "\n")
+	for i, l := range lines {
+		if l == lineResetMark {
+			lines[i] = fmt.Sprintf("#line %d \"%s\"\n", i+2, cEscape(path))
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// --- -exceptions=status：错误码 ---
+// 可能抛出异常的顶层函数返回 int 错误码（PY_OK 为 0），返回值照旧通过 result 指针；
+// 调用后检查错误码：在 try 块里跳到 except/finally 标签，在其他状态函数里继续返回，在 main 中报告后退出。
+
+// statusTarget: try 块中出错时的去向
+type statusTarget struct {
+	status, label string
+	used          *bool
+}
+
+// analyzeStatusFuncs: 含有 raise 或调用了状态函数的顶层函数（求不动点）；返回元组的函数不参与
+func (g *generator) analyzeStatusFuncs(root ASTNode) {
+	if g.optExceptions != "status" {
+		return
+	}
+	changed := true
+	for changed {
+		changed = false
+		for _, name := range sortedKeys(g.funcNodes) {
+			fn := g.funcNodes[name]
+			body, _ := fn["body"].([]interface{})
+			if g.statusFuncs[name] || returnsTuple(body) {
+				continue
+			}
+			if g.mayRaise(body) {
+				g.statusFuncs[name] = true
+				changed = true
+			}
+		}
+	}
+}
+
+// mayRaise: 语句中是否有 raise 或对状态函数的调用（不进入嵌套的函数与类）
+func (g *generator) mayRaise(node interface{}) bool {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			if g.mayRaise(e) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		switch n["_type"] {
+		case "Raise":
+			return true
+		case "FunctionDef", "ClassDef", "Lambda":
+			return false
+		case "Call":
+			if fn, _ := n["func"].(map[string]interface{}); fn["_type"] == "Name" && (g.statusFuncs[fn["id"].(string)] || fn["id"] == "open") {
+				return true
+			}
+		}
+		for _, k := range sortedKeys(n) {
+			if g.mayRaise(n[k]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// errCode: 异常类型的错误码常量，连同父类一起登记
+func (g *generator) errCode(name string) string {
+	if b := g.excBases[name]; b != "" {
+		g.errCode(b)
+	}
+	if !containsStr(g.errCodes, name) {
+		g.errCodes = append(g.errCodes, name)
+	}
+	g.includes["stdlib.h"] = true
+	g.runtimeHelpers["py_err_rt"] = `// error codes: functions that can raise return the exception type, PY_OK when they succeed
+typedef struct {
+    int type;
+    char msg[256];
+    int line; // line of the raise statement
+} PyError;
+static PyError py_err; // the last raised error, bound by "except E as e"
+static int py_err_set(int type, const char* msg, int line) {
+    py_err.type = type;
+    snprintf(py_err.msg, sizeof py_err.msg, "%s", msg);
+    py_err.line = line;
+    return type;
+}
+// is type the handler type h or one of its subclasses
+static int py_err_matches(int type, int h) {
+    for (; type != PY_OK; type = py_err_base[type]) {
+        if (type == h) {
+            return 1;
+        }
+    }
+    return 0;
+}
+// uncaught error: report like py_warn and exit
+static void py_err_exit(int type) {
+    if (py_err.msg[0]) {
+        fprintf(stderr, "line %d: %s: %s\n", py_err.line, py_err_name[type], py_err.msg);
+    } else {
+        fprintf(stderr, "line %d: %s\n", py_err.line, py_err_name[type]);
+    }
+    exit(1);
+}
+`
+	return "PY_ERR_" + name
+}
+
+// errCodeTable: 错误码的枚举、父类表与名字表；要等所有用到的类型都登记后生成
+func (g *generator) errCodeTable() {
+	if len(g.errCodes) == 0 {
+		return
+	}
+	names, bases, strs := []string{"PY_OK"}, []string{"PY_OK"}, []string{`""`}
+	for _, e := range g.errCodes {
+		names = append(names, "PY_ERR_"+e)
+		base := "PY_OK"
+		if b := g.excBases[e]; b != "" {
+			base = "PY_ERR_" + b
+		}
+		bases = append(bases, base)
+		strs = append(strs, fmt.Sprintf("%q", e))
+	}
+	g.runtimeHelpers["py_err"] = fmt.Sprintf("enum { %s };\nstatic const int py_err_base[] = {%s};\nstatic const char* const py_err_name[] = {%s};\n",
+		join(names, ", "), join(bases, ", "), join(strs, ", "))
+}
+
+// callStmt: 调用函数的语句（已缩进）；状态函数检查返回的错误码
+func (g *generator) callStmt(fname string, args []string, indent int) string {
+	g.noteForwardCall(fname)
+	call := fmt.Sprintf("%s(%s)", fname, join(args, ", "))
+	if !g.statusFuncs[fname] {
+		return fmt.Sprintf("%s%s;\n", strings.Repeat(" ", indent*4), call)
+	}
+	return formatPre([]string{g.statusCheck(call)}, indent)
+}
+
+// statusCheck: 执行返回错误码的 call，出错时交给外层（未缩进）
+func (g *generator) statusCheck(call string) string {
+	if n := len(g.statusTargets); n > 0 {
+		t := g.statusTargets[n-1]
+		*t.used = true
+		return fmt.Sprintf("if ((%s = %s)) {\n    goto %s;\n}\n", t.status, call, t.label)
+	}
+	st := g.newTemp("_st")
+	return fmt.Sprintf("int %[1]s = %[2]s;\nif (%[1]s) {\n%[3]s}\n", st, call, formatPre([]string{g.statusJump(st)}, 1))
+}
+
+// statusJump: 把非零错误码 value 交给外层（未缩进）：try 块里跳到其标签，
+// 状态函数里销毁局部对象后返回，其他地方（main、方法）报告后退出
+func (g *generator) statusJump(value string) string {
+	if n := len(g.statusTargets); n > 0 {
+		t := g.statusTargets[n-1]
+		*t.used = true
+		if t.status == value {
+			return fmt.Sprintf("goto %s;\n", t.label)
+		}
+		return fmt.Sprintf("%s = %s;\ngoto %s;\n", t.status, value, t.label)
+	}
+	if g.statusFuncs[g.currentScope] {
+		if release := g.tryUnwind(0, 0) + g.scopeExit(0); release != "" && strings.Contains(value, "(") {
+			// 先求出错误码再释放局部对象
+			st := g.newTemp("_st")
+			return fmt.Sprintf("int %s = %s;\n%sreturn %s;\n", st, value, release, st)
+		}
+		return fmt.Sprintf("%s%sreturn %s;\n", g.tryUnwind(0, 0), g.scopeExit(0), value)
+	}
+	return fmt.Sprintf("py_err_exit(%s);\n", value)
+}
+
+// voidReturn: 没有返回值的 return（状态函数返回 PY_OK）
+func (g *generator) voidReturn() string {
+	if g.statusFuncs[g.currentScope] {
+		return "return PY_OK;"
+	}
+	return "return;"
+}
+
+// isExcRecord: except ... as e 绑定的异常记录类型
+func isExcRecord(t string) bool {
+	return t == "PyException*" || t == "PyError*"
+}
+
+// tryStatus: -exceptions=status 的 try/except/else/finally：
+// 状态变量记录 try 块里的错误，出错时跳到 except 标签匹配类型；else/except 中的错误跳到 finally 标签，
+// finally 之后仍有错误时交给外层
+func (g *generator) tryStatus(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	st := g.newTemp("_e")
+	finalbody, _ := node["finalbody"].([]interface{})
+	handlers, _ := node["handlers"].([]interface{})
+	exceptUsed, finallyUsed := false, false
+	exceptLabel := st + "_except"
+	if len(handlers) == 0 {
+		exceptLabel = st + "_finally"
+	}
+	g.tryFrames = append(g.tryFrames, tryFrame{"", finalbody, ""})
+	g.statusTargets = append(g.statusTargets, statusTarget{st, exceptLabel, &exceptUsed})
+	body := g.stmtsToC(node["body"], indent+1)
+	g.statusTargets[len(g.statusTargets)-1] = statusTarget{st, st + "_finally", &finallyUsed}
+	orelse := g.stmtsToC(node["orelse"], indent+1)
+	excepts := ""
+	for i, h := range handlers {
+		handler := h.(map[string]interface{})
+		cond := g.excMatch(handler["type"], st)
+		switch {
+		case cond == "":
+			g.report(logError, handler, "unsupported exception type")
+			excepts += fmt.Sprintf("%s        if (0) { // unsupported exception type\n", pad)
+		case cond == "1" && i == 0:
+			excepts += fmt.Sprintf("%s        {\n", pad)
+		case cond == "1":
+			excepts = strings.TrimSuffix(excepts, "\n") + " else {\n"
+		default:
+			if i > 0 {
+				excepts = strings.TrimSuffix(excepts, "\n") + fmt.Sprintf(" else if (%s) {\n", cond)
+			} else {
+				excepts += fmt.Sprintf("%s        if (%s) {\n", pad, cond)
+			}
+		}
+		savedHandler, savedVar := g.currentHandler, g.currentHandlerVar
+		g.currentHandler, g.currentHandlerVar = st, ""
+		if v, ok := handler["name"].(string); ok && v != "" {
+			g.currentHandlerVar = v
+			g.declareVar(v, "PyError*")
+			excepts += fmt.Sprintf("%s            PyError* %s = &py_err;\n", pad, v)
+		}
+		excepts += g.stmtsToC(handler["body"], indent+3)
+		if !endsWithJump(handler["body"]) {
+			excepts += fmt.Sprintf("%s            %s = PY_OK; // handled\n", pad, st)
+		}
+		excepts += pad + "        }\n"
+		g.currentHandler, g.currentHandlerVar = savedHandler, savedVar
+		if cond == "1" {
+			break
+		}
+	}
+	g.statusTargets = g.statusTargets[:len(g.statusTargets)-1]
+	g.tryFrames = g.tryFrames[:len(g.tryFrames)-1]
+	code := fmt.Sprintf("%s{\n%s    int %s = PY_OK;\n%s%s", pad, pad, st, body, orelse)
+	if len(handlers) > 0 {
+		if exceptUsed {
+			code += fmt.Sprintf("%s%s_except: ;\n", pad, st)
+		}
+		code += fmt.Sprintf("%s    if (%s) {\n%s%s    }\n", pad, st, excepts, pad)
+	}
+	if finallyUsed || (exceptUsed && len(handlers) == 0) {
+		code += fmt.Sprintf("%s%s_finally: ;\n", pad, st)
+	}
+	code += g.stmtsToC(finalbody, indent+1)
+	code += fmt.Sprintf("%s    if (%s) {\n%s%s    }\n", pad, st, formatPre([]string{g.statusJump(st)}, indent+2), pad)
+	return code + pad + "}\n"
+}
+
+// hasResultParam: 函数是否已按 result 指针约定生成（返回 void 或错误码）
+func (g *generator) hasResultParam(fname string) bool {
+	if f := g.lookupFunc(fname); f != nil {
+		return f.hasResult()
+	}
+	return g.funcResultTypes[fname] != ""
+}
+
+// registerFuncResults: 生成代码之前登记经由 result 参数返回的顶层函数及其类型，按名字查询，
+// 不依赖已生成的代码；返回元组的函数要等函数体生成之后才知道元素类型，不预先登记
+func (g *generator) registerFuncResults(root ASTNode) {
+	body, _ := root["body"].([]interface{})
+	for _, stmt := range body {
+		m, _ := stmt.(map[string]interface{})
+		name, _ := m["name"].(string)
+		fbody, _ := m["body"].([]interface{})
+		if m["_type"] == "FunctionDef" && funcHasReturn(fbody) && !returnsTuple(fbody) {
+			g.funcResultTypes[name] = g.funcResultType(name, fbody)
+		}
+	}
+}
+
+// protoSlot: 调用了还没有生成的顶层函数的代码：classStructs（方法）或 funcDefs 中的下标
+type protoSlot struct {
+	method bool
+	at     int
+}
+
+// noteForwardCall: 调用定义在后面的顶层函数时记下调用所在的位置，函数生成后在那里补上原型
+func (g *generator) noteForwardCall(fname string) {
+	if g.funcNodes[fname] == nil || g.lookupFunc(fname) != nil || g.currentScope == fname {
+		return
+	}
+	slot := protoSlot{false, len(g.funcDefs)}
+	if g.currentClass != "" {
+		slot = protoSlot{true, len(g.classStructs)}
+	} else if g.currentScope == "" {
+		return // main 在所有函数之后
+	}
+	if g.forwardCalls[fname] == nil {
+		g.forwardCalls[fname] = map[protoSlot]bool{}
+	}
+	g.forwardCalls[fname][slot] = true
+}
+
+// forwardPrototypes: f 生成之后，把它的原型放到之前调用它的代码前面
+func (g *generator) forwardPrototypes(f *irFunc) {
+	proto := strings.Repeat(" ", f.indent*4) + g.emit.emitPrototype(f)
+	for slot := range g.forwardCalls[f.name] {
+		if slot.method {
+			g.classStructs[slot.at] = proto + g.classStructs[slot.at]
+		} else {
+			g.funcDefs[slot.at] = proto + g.funcDefs[slot.at]
+		}
+	}
+	delete(g.forwardCalls, f.name)
+}
+
+// --- 文件对象：open() 得到 FILE*，打开失败时抛出异常 ---
+
+// openFile: 把 open(path[, mode]) 打开到变量 name 并检查（已缩进）
+func (g *generator) openFile(call map[string]interface{}, name string, declare bool, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	args, _ := call["args"].([]interface{})
+	path, mode := `""`, `"r"`
+	if len(args) > 0 {
+		path = g.toC(args[0].(map[string]interface{}), 0)
+	}
+	var modeNode map[string]interface{}
+	if len(args) > 1 {
+		modeNode = args[1].(map[string]interface{})
+	}
+	if kw := callKeyword(call, "mode"); kw != nil {
+		modeNode = kw
+	}
+	if s, ok := modeNode["value"].(string); ok && modeNode["_type"] == "Constant" {
+		mode = fopenMode(s)
+	} else if modeNode != nil {
+		mode = g.toC(modeNode, 0)
+	}
+	g.includes["errno.h"] = true
+	g.includes["string.h"] = true
+	code := pad
+	if declare {
+		code += "FILE* "
+	}
+	code += fmt.Sprintf("%s = fopen(%s, %s);\n%sif (!%s) {\n", name, path, mode, pad, name)
+	// 读文件失败多半是文件不存在，"x" 模式是文件已存在，其他按 OSError 处理
+	exc := "OSError"
+	if strings.HasPrefix(mode, `"r`) {
+		exc = "FileNotFoundError"
+	} else if strings.HasSuffix(mode, `x"`) {
+		exc = "FileExistsError"
+	}
+	if g.optExceptions == "exit" {
+		code += g.tryUnwind(0, indent+1)
+	}
+	return code + g.raiseCode(exc, "strerror(errno)", fmt.Sprint(call["lineno"]), pad+"    ") + pad + "}\n"
+}
+
+// handleFileMethodCall: 文件对象（FILE*）的方法调用：read/readline/readlines 读成新字符串（列表），write 写入 fputs
+func (g *generator) handleFileMethodCall(fn, node map[string]interface{}) (string, bool) {
+	if g.getType(fn["value"]) != "FILE*" {
+		return "", false
+	}
+	f := g.toC(fn["value"].(map[string]interface{}), 0)
+	args, _ := node["args"].([]interface{})
+	switch fn["attr"] {
+	case "close":
+		if v, _ := fn["value"].(map[string]interface{}); v["_type"] == "Name" {
+			// with 语句离开时还会再关闭一次
+			g.runtimeHelpers["py_fclose"] = `// close a file and clear the variable so a second close (e.g. at the end of a with block) is harmless
+static void py_fclose(FILE** f) {
+    if (*f) {
+        fclose(*f);
+        *f = NULL;
+    }
+}
+`
+			return fmt.Sprintf("py_fclose(&%s)", f), true
+		}
+		return fmt.Sprintf("fclose(%s)", f), true
+	case "read":
+		g.fileRuntime()
+		n := "-1"
+		if len(args) > 0 {
+			n = g.toC(args[0].(map[string]interface{}), 0)
+		}
+		return g.rcHold("char*", fmt.Sprintf("py_file_read(%s, %s)", f, n)), true
+	case "readline":
+		g.fileRuntime()
+		return g.rcHold("char*", fmt.Sprintf("py_file_readline(%s)", f)), true
+	case "readlines":
+		g.fileReadlines()
+		return g.rcHold(g.listType("char*"), fmt.Sprintf("py_file_readlines(%s)", f)), true
+	case "write":
+		if len(args) != 1 {
+			return g.unsupportedExpr(node, "call: write expects one argument"), true
+		}
+		return fmt.Sprintf("fputs(%s, %s)", g.toC(args[0].(map[string]interface{}), 0), f), true
+	case "flush":
+		return fmt.Sprintf("fflush(%s)", f), true
+	}
+	return g.unsupportedExpr(node, fmt.Sprintf("call: file method %s", fn["attr"])), true
+}
+
+// fileMethodType: 文件方法调用的结果类型
+func (g *generator) fileMethodType(method string) string {
+	switch method {
+	case "read", "readline":
+		return "char*"
+	case "readlines":
+		return g.listType("char*")
+	case "write":
+		return "int"
+	}
+	return ""
+}
+
+// fopenMode: Python 的打开模式对应的 fopen 模式；"t" 是默认的文本模式，"x" 对应 C11 的 "wx"
+func fopenMode(mode string) string {
+	base, plus, bin, excl := "r", "", "", ""
+	for _, c := range mode {
+		switch c {
+		case 'r', 'w', 'a':
+			base = string(c)
+		case 'x':
+			base, excl = "w", "x"
+		case '+':
+			plus = "+"
+		case 'b':
+			bin = "b"
+		}
+	}
+	return `"` + base + bin + plus + excl + `"`
+}
+
+// fileRuntime: 按行或整体读文件的辅助函数；读到的字符串是新分配的（-refcount 时带计数）
+func (g *generator) fileRuntime() {
+	g.includes["stdlib.h"] = true
+	dup := g.strDup()
+	// 排在 py_rc 与 py_dup 之后
+	g.runtimeHelpers["py_stdio"] = fmt.Sprintf(`// read up to and including delim (EOF: to the end of the file), at most max bytes when max >= 0, into *buf
+// (a portable getdelim); returns the length, -1 when there was nothing left to read
+static long py_getdelim(char** buf, size_t* cap, int delim, long max, FILE* f) {
+    long len = 0;
+    int c = 0;
+    if (!*buf) {
+        *cap = 128;
+        *buf = (char*)malloc(*cap);
+    }
+    while ((max < 0 || len < max) && (c = fgetc(f)) != EOF) {
+        if ((size_t)len + 2 > *cap) {
+            *cap *= 2;
+            *buf = (char*)realloc(*buf, *cap);
+        }
+        (*buf)[len++] = (char)c;
+        if (c == delim) {
+            break;
+        }
+    }
+    (*buf)[len] = '\0';
+    return len == 0 && c == EOF ? -1 : len;
+}
+// f.read(n): the rest of the file, or at most n bytes when n >= 0
+static char* py_file_read(FILE* f, long n) {
+    char* buf = NULL;
+    size_t cap = 0;
+    py_getdelim(&buf, &cap, EOF, n, f);
+    char* s = %[1]s(buf);
+    free(buf);
+    return s;
+}
+// f.readline(): the next line including '\n', "" at the end of the file
+static char* py_file_readline(FILE* f) {
+    char* buf = NULL;
+    size_t cap = 0;
+    py_getdelim(&buf, &cap, '\n', -1, f);
+    char* s = %[1]s(buf);
+    free(buf);
+    return s;
+}
+`, dup)
+}
+
+// fileReadlines: f.readlines()，用到字符串列表，和列表类型一起输出在结构体之后
+func (g *generator) fileReadlines() {
+	g.fileRuntime()
+	lt := strings.TrimSuffix(g.listType("char*"), "*")
+	if g.copyFuncs["py_file_readlines"] {
+		return
+	}
+	g.copyFuncs["py_file_readlines"] = true
+	dup := g.strDup()
+	g.classStructs = append(g.classStructs, fmt.Sprintf(`// f.readlines(): the remaining lines, each including its '\n'
+static %[1]s* py_file_readlines(FILE* f) {
+    %[1]s* l = %[1]s_new();
+    char* buf = NULL;
+    size_t cap = 0;
+    while (py_getdelim(&buf, &cap, '\n', -1, f) >= 0) {
+        %[1]s_append(l, %[2]s(buf));
+    }
+    free(buf);
+    return l;
+}
+`, lt, dup))
+}
+
+// handleForFile: for line in f: 逐行读到缓冲区，line 指向缓冲区（下一行会覆盖）；
+// 缓冲区在循环结束或 return 离开时释放
+func (g *generator) handleForFile(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	g.fileRuntime()
+	f := g.toC(node["iter"].(map[string]interface{}), 0)
+	target := g.toC(node["target"].(map[string]interface{}), 0)
+	buf, size := g.newTemp("_lb"), g.newTemp("_lc")
+	code := fmt.Sprintf("%schar* %s = NULL;\n%ssize_t %s = 0;\n", pad, buf, pad, size)
+	if !g.isDeclared(target) {
+		g.declareVar(target, "char*")
+		code += fmt.Sprintf("%schar* %s;\n", pad, target)
+	}
+	release := fmt.Sprintf("free(%s);\n", buf)
+	// 帧在循环之外：break/continue 不释放，return 才释放
+	g.tryFrames = append(g.tryFrames, tryFrame{"", nil, release})
+	restore := g.enterLoop()
+	g.pushScope(scopeBlock, "for")
+	body := g.stmtsToC(node["body"], indent+1)
+	g.popScope()
+	restore()
+	g.tryFrames = g.tryFrames[:len(g.tryFrames)-1]
+	code += fmt.Sprintf("%swhile (py_getdelim(&%s, &%s, '\\n', -1, %s) >= 0) {\n%s    %s = %s;\n%s%s}\n", pad, buf, size, f, pad, target, buf, body, pad)
+	return code + pad + release
+}
+
+// inputCall: input(prompt) 从标准输入读一行（不限长度，去掉换行符），结果是新分配的字符串
+func (g *generator) inputCall(call map[string]interface{}) string {
+	args, _ := call["args"].([]interface{})
+	prompt := `""`
+	if len(args) == 1 {
+		prompt = g.toC(args[0].(map[string]interface{}), 0)
+	} else if len(args) > 1 {
+		return g.unsupportedExpr(call, "input with more than one argument")
+	}
+	g.fileRuntime()
+	g.runtimeHelpers["py_stdio_input"] = fmt.Sprintf(`// input(prompt): the next line of stdin without the newline, as a new string
+static char* py_input(const char* prompt) {
+    char* buf = NULL;
+    size_t cap = 0;
+    fputs(prompt, stdout);
+    fflush(stdout);
+    long n = py_getdelim(&buf, &cap, '\n', -1, stdin);
+    if (n < 0) {
+        free(buf);
+        %s
+    }
+    if (n > 0 && buf[n - 1] == '\n') {
+        buf[n - 1] = '\0';
+    }
+    char* s = %s(buf);
+    free(buf);
+    return s;
+}
+`, g.runtimeError("EOFError", "EOF when reading a line"), g.strDup())
+	return g.rcHold("char*", fmt.Sprintf("py_input(%s)", prompt))
+}
+
+// --- 字符串方法 ---
+// 返回字符串的方法写入轮转缓冲区（和 f-string 一样最长 PY_STRBUF_SIZE - 1 个字符），split 返回新的字符串列表
+
+// strDup: 把字符串复制成新分配的字符串的辅助函数名（-refcount 时是带计数的 py_str_new）
+func (g *generator) strDup() string {
+	g.includes["string.h"] = true
+	if g.optRefcount {
+		g.rcRuntime()
+		return "py_str_new"
+	}
+	g.includes["stdlib.h"] = true
+	g.runtimeHelpers["py_dup"] = `// copy a string into a new heap string
+static char* py_str_dup(const char* s) {
+    size_t n = strlen(s) + 1;
+    char* c = (char*)malloc(n);
+    memcpy(c, s, n);
+    return c;
+}
+`
+	return "py_str_dup"
+}
+
+// isStrValue: 表达式是否确实是字符串（getType 对不认识的名字也返回 char*，如模块名）
+func (g *generator) isStrValue(node interface{}) bool {
+	m, _ := node.(map[string]interface{})
+	switch m["_type"] {
+	case "Name":
+		return g.varType(fmt.Sprint(m["id"])) == "char*"
+	case "Call":
+		if fn, _ := m["func"].(map[string]interface{}); fn["id"] == "super" {
+			return false
+		}
+	}
+	return g.getType(m) == "char*"
+}
+
+// strMethodType: 字符串方法调用的结果类型
+func (g *generator) strMethodType(method string) string {
+	switch method {
+	case "upper", "lower", "strip", "lstrip", "rstrip", "replace":
+		return "char*"
+	case "find", "startswith", "endswith":
+		return "int"
+	case "split":
+		return g.listType("char*")
+	}
+	return ""
+}
+
+// strHelpers: 字符串方法的 C 实现，名字 -> 定义
+var strHelpers = map[string]string{
+	"py_str_map": `// str.upper() / str.lower(): apply f to every character
+static char* py_str_map(const char* s, int (*f)(int)) {
+    char* buf = py_strbuf();
+    size_t i = 0;
+    for (; s[i] && i < PY_STRBUF_SIZE - 1; i++) {
+        buf[i] = (char)f((unsigned char)s[i]);
+    }
+    buf[i] = '\0';
+    return buf;
+}
+`,
+	"py_str_strip": `// str.strip / lstrip / rstrip: chars NULL strips whitespace; which: 1 left, 2 right, 3 both
+static char* py_str_strip(const char* s, const char* chars, int which) {
+    size_t start = 0, end = strlen(s);
+    while ((which & 1) && start < end && (chars ? strchr(chars, s[start]) != NULL : isspace((unsigned char)s[start]))) {
+        start++;
+    }
+    while ((which & 2) && end > start && (chars ? strchr(chars, s[end - 1]) != NULL : isspace((unsigned char)s[end - 1]))) {
+        end--;
+    }
+    char* buf = py_strbuf();
+    snprintf(buf, PY_STRBUF_SIZE, "%.*s", (int)(end - start), s + start);
+    return buf;
+}
+`,
+	"py_str_find": `// str.find(sub): index of the first occurrence, -1 when missing
+static int py_str_find(const char* s, const char* sub) {
+    const char* p = strstr(s, sub);
+    return p ? (int)(p - s) : -1;
+}
+`,
+	"py_str_replace": `// append len bytes of s at buf[n], truncated to the scratch buffer; returns the new length
+static size_t py_str_put(char* buf, size_t n, const char* s, size_t len) {
+    if (len > PY_STRBUF_SIZE - 1 - n) {
+        len = PY_STRBUF_SIZE - 1 - n;
+    }
+    memcpy(buf + n, s, len);
+    buf[n + len] = '\0';
+    return n + len;
+}
+// str.replace(old, new): like Python, an empty old inserts new around every character
+static char* py_str_replace(const char* s, const char* old, const char* rep) {
+    char* buf = py_strbuf();
+    size_t n = py_str_put(buf, 0, "", 0), olen = strlen(old), rlen = strlen(rep);
+    if (olen == 0) {
+        n = py_str_put(buf, n, rep, rlen);
+        for (; *s; s++) {
+            n = py_str_put(buf, n, s, 1);
+            n = py_str_put(buf, n, rep, rlen);
+        }
+        return buf;
+    }
+    for (;;) {
+        const char* p = strstr(s, old);
+        n = py_str_put(buf, n, s, p ? (size_t)(p - s) : strlen(s));
+        if (!p) {
+            return buf;
+        }
+        n = py_str_put(buf, n, rep, rlen);
+        s = p + olen;
+    }
+}
+`,
+	"py_str_startswith": `static int py_str_startswith(const char* s, const char* prefix) {
+    return strncmp(s, prefix, strlen(prefix)) == 0;
+}
+`,
+	"py_str_endswith": `static int py_str_endswith(const char* s, const char* suffix) {
+    size_t n = strlen(s), m = strlen(suffix);
+    return m <= n && strcmp(s + n - m, suffix) == 0;
+}
+`,
+}
+
+// strHelper: 登记字符串方法的辅助函数
+func (g *generator) strHelper(name string) {
+	g.includes["string.h"] = true
+	g.includes["ctype.h"] = true
+	g.strBuf()
+	// 排在 py_strbuf 之后
+	g.runtimeHelpers["py_strbuf_"+strings.TrimPrefix(name, "py_str_")] = strHelpers[name]
+}
+
+// handleStrMethodCall: 字符串（char*）的方法调用；join 见 handleStrJoin
+func (g *generator) handleStrMethodCall(fn, call map[string]interface{}) (string, bool) {
+	if !g.isStrValue(fn["value"]) {
+		return "", false
+	}
+	s := g.toC(fn["value"].(map[string]interface{}), 0)
+	args := []string{}
+	for _, a := range call["args"].([]interface{}) {
+		args = append(args, g.toC(a.(map[string]interface{}), 0))
+	}
+	method, _ := fn["attr"].(string)
+	arity := map[string][2]int{
+		"upper": {0, 0}, "lower": {0, 0}, "strip": {0, 1}, "lstrip": {0, 1}, "rstrip": {0, 1},
+		"find": {1, 1}, "replace": {2, 2}, "startswith": {1, 1}, "endswith": {1, 1}, "split": {0, 1},
+	}
+	n, ok := arity[method]
+	if !ok {
+		return g.unsupportedExpr(call, fmt.Sprintf("call: str method %s", method)), true
+	}
+	if len(args) < n[0] || len(args) > n[1] {
+		return g.unsupportedExpr(call, fmt.Sprintf("call: str.%s with %d arguments", method, len(args))), true
+	}
+	switch method {
+	case "upper", "lower":
+		g.strHelper("py_str_map")
+		return fmt.Sprintf("py_str_map(%s, to%s)", s, method), true
+	case "strip", "lstrip", "rstrip":
+		g.strHelper("py_str_strip")
+		chars := "NULL"
+		if len(args) == 1 {
+			chars = args[0]
+		}
+		which := map[string]int{"lstrip": 1, "rstrip": 2, "strip": 3}[method]
+		return fmt.Sprintf("py_str_strip(%s, %s, %d)", s, chars, which), true
+	case "split":
+		g.strSplit()
+		sep := "NULL"
+		if len(args) == 1 {
+			sep = args[0]
+		}
+		return g.rcHold(g.listType("char*"), fmt.Sprintf("py_str_split(%s, %s)", s, sep)), true
+	}
+	g.strHelper("py_str_" + method)
+	return fmt.Sprintf("py_str_%s(%s)", method, join(append([]string{s}, args...), ", ")), true
+}
+
+// strSplit: str.split(sep) 的辅助函数，用到字符串列表，和列表类型一起输出在结构体之后
+func (g *generator) strSplit() {
+	lt := strings.TrimSuffix(g.listType("char*"), "*")
+	if g.copyFuncs["py_str_split"] {
+		return
+	}
+	g.copyFuncs["py_str_split"] = true
+	g.includes["ctype.h"] = true
+	dup := g.strDup()
+	g.classStructs = append(g.classStructs, fmt.Sprintf(`// str.split(sep): sep NULL splits on runs of whitespace and drops empty pieces
+static %[1]s* py_str_split(const char* s, const char* sep) {
+    if (sep && !sep[0]) {
+        %[3]s
+    }
+    %[1]s* l = %[1]s_new();
+    size_t len = strlen(s), i = 0;
+    char* piece = (char*)malloc(len + 1);
+    for (;;) {
+        while (!sep && i < len && isspace((unsigned char)s[i])) {
+            i++;
+        }
+        if (!sep && i == len) {
+            break;
+        }
+        const char* p = sep ? strstr(s + i, sep) : NULL;
+        size_t j = sep ? (p ? (size_t)(p - s) : len) : i;
+        while (!sep && j < len && !isspace((unsigned char)s[j])) {
+            j++;
+        }
+        memcpy(piece, s + i, j - i);
+        piece[j - i] = '\0';
+        %[1]s_append(l, %[2]s(piece));
+        if (sep && !p) {
+            break;
+        }
+        i = sep ? j + strlen(sep) : j;
+    }
+    free(piece);
+    return l;
+}
+`, lt, dup, g.runtimeError("ValueError", "empty separator")))
+}
+
+// --- str() / int() / float() ---
+
+// conversionType: 类型转换内置函数的结果类型
+var conversionType = map[string]string{"str": "char*", "int": "int", "float": "double"}
+
+// handleConversion: str(x) 按 x 的类型格式化到缓冲区（与 f-string 相同），
+// int(s) / float(s) 用 strtol / strtod 解析（格式不对时抛出 ValueError），数字之间直接转换（int() 向零截断）
+func (g *generator) handleConversion(name string, call map[string]interface{}) (string, bool) {
+	if conversionType[name] == "" || g.funcNodes[name] != nil {
+		return "", false
+	}
+	args, _ := call["args"].([]interface{})
+	if len(args) == 0 {
+		return map[string]string{"str": `""`, "int": "0", "float": "0.0"}[name], true
+	}
+	arg := args[0].(map[string]interface{})
+	t := g.getType(arg)
+	x := g.toC(arg, 0)
+	if t == "PyJson*" {
+		g.jsonRuntime()
+		return fmt.Sprintf(map[string]string{"str": "py_json_str(%s)", "int": "(int)py_json_num(%s)", "float": "py_json_num(%s)"}[name], x), true
+	}
+	switch name {
+	case "str":
+		if t == "char*" && g.isStrValue(arg) && !g.mayBeNone(arg) {
+			return x, true
+		}
+		if t == "double" && !g.isIntExpr(arg) {
+			g.floatStr()
+			return fmt.Sprintf("py_float_str(%s)", x), true
+		}
+		return g.handleJoinedStr(ASTNode{"_type": "JoinedStr", "values": []interface{}{
+			map[string]interface{}{"_type": "FormattedValue", "value": arg, "conversion": json.Number("-1")},
+		}}, 0), true
+	case "int":
+		switch {
+		case len(args) == 2 && t == "char*":
+			g.parseRuntime()
+			return fmt.Sprintf("py_int_parse(%s, %s)", x, g.toC(args[1].(map[string]interface{}), 0)), true
+		case t == "int":
+			return x, true
+		case t == "double":
+			return fmt.Sprintf("(int)(%s)", x), true
+		case t == "char*":
+			g.parseRuntime()
+			return fmt.Sprintf("py_int_parse(%s, 10)", x), true
+		}
+	case "float":
+		switch {
+		case t == "double" && !g.isIntExpr(arg):
+			return x, true
+		case t == "int" || t == "double":
+			// 整数字面量在 C 中仍是 int
+			return fmt.Sprintf("(double)(%s)", x), true
+		case t == "char*":
+			g.parseRuntime()
+			return fmt.Sprintf("py_float_parse(%s)", x), true
+		}
+	}
+	return g.unsupportedExpr(call, fmt.Sprintf("call: %s() of %s", name, t)), true
+}
+
+// floatStr: str(float) 与 Python 的 repr 一致：能读回原值的最短位数，
+// 指数在 [-4, 16) 内用小数形式且至少保留一位小数（2.5、100.0、1e+16）
+func (g *generator) floatStr() {
+	g.includes["stdlib.h"] = true
+	g.includes["string.h"] = true
+	g.strBuf()
+	g.runtimeHelpers["py_strbuf_float"] = `// str(x) of a float: the shortest digits that read back as x, formatted like Python's repr
+static char* py_float_str(double x) {
+    char* buf = py_strbuf();
+    if (x != x || x - x != 0) {
+        snprintf(buf, PY_STRBUF_SIZE, "%s", x != x ? "nan" : x > 0 ? "inf" : "-inf");
+        return buf;
+    }
+    int digits = 1;
+    for (; digits < 17; digits++) {
+        snprintf(buf, PY_STRBUF_SIZE, "%.*e", digits - 1, x);
+        if (strtod(buf, NULL) == x) {
+            break;
+        }
+    }
+    snprintf(buf, PY_STRBUF_SIZE, "%.*e", digits - 1, x);
+    int exp = atoi(strchr(buf, 'e') + 1);
+    if (exp < -4 || exp >= 16) {
+        return buf;
+    }
+    snprintf(buf, PY_STRBUF_SIZE, "%.*f", digits - 1 - exp > 0 ? digits - 1 - exp : 0, x);
+    if (!strchr(buf, '.')) {
+        strcat(buf, ".0");
+    }
+    return buf;
+}
+`
+}
+
+// parseRuntime: 字符串转数字；和 Python 一样允许前后的空白，其余字符都算格式错误
+func (g *generator) parseRuntime() {
+	g.includes["stdlib.h"] = true
+	g.includes["ctype.h"] = true
+	g.includes["errno.h"] = true
+	g.runtimeHelpers["py_parse"] = fmt.Sprintf(`// int(s, base): an integer literal with optional sign and surrounding whitespace
+static int py_int_parse(const char* s, int base) {
+    char* end;
+    errno = 0;
+    long v = strtol(s, &end, base);
+    while (isspace((unsigned char)*end)) {
+        end++;
+    }
+    if (end == s || *end || errno) {
+        %s
+    }
+    return (int)v;
+}
+// float(s): a decimal or exponent literal, also inf and nan
+static double py_float_parse(const char* s) {
+    char* end;
+    double v = strtod(s, &end);
+    while (isspace((unsigned char)*end)) {
+        end++;
+    }
+    if (end == s || *end) {
+        %s
+    }
+    return v;
+}
+`, g.runtimeError("ValueError", "invalid literal for int()"), g.runtimeError("ValueError", "could not convert string to float"))
+}
+
+// --- abs() / min() / max() / round() / sum() ---
+
+// numType: 数值表达式在 C 中的类型（整数字面量也算 int），不是数值时为 ""
+func (g *generator) numType(node interface{}) string {
+	switch t := g.getType(node); {
+	case t == "int" || (t == "double" && g.isIntExpr(node)):
+		return "int"
+	case t == "double":
+		return "double"
+	}
+	return ""
+}
+
+// numListElem: 数值列表的元素类型，其余为 ""
+func (g *generator) numListElem(node interface{}) string {
+	if m, _ := node.(map[string]interface{}); g.functionalCall(m) == "map" || g.functionalCall(m) == "filter" {
+		if elem := g.functionalElemType(m, g.getType); elem == "int" || elem == "double" {
+			return elem
+		}
+		return ""
+	}
+	if elem, ok := g.listElemType(g.getType(node)); ok && (elem == "int" || elem == "double") {
+		return elem
+	}
+	return ""
+}
+
+// numBuiltinType: 数值内置函数的结果类型；操作数都是整数时为 int，否则为 double；不支持时为 ""
+func (g *generator) numBuiltinType(name string, args []interface{}) string {
+	switch {
+	case name == "abs" && len(args) == 1:
+		return g.numType(args[0])
+	case (name == "min" || name == "max") && len(args) == 1:
+		return g.numListElem(args[0])
+	case (name == "min" || name == "max") && len(args) > 1:
+		ret := "int"
+		for _, a := range args {
+			switch g.numType(a) {
+			case "":
+				return ""
+			case "double":
+				ret = "double"
+			}
+		}
+		return ret
+	case name == "round" && len(args) == 1 && g.numType(args[0]) != "":
+		return "int"
+	case name == "round" && len(args) == 2:
+		return g.numType(args[0])
+	case name == "sum" && len(args) == 1:
+		return g.numListElem(args[0])
+	case name == "sum" && len(args) == 2:
+		elem, start := g.numListElem(args[0]), g.numType(args[1])
+		if elem == "" || start == "" {
+			return ""
+		}
+		if elem == "int" && start == "int" {
+			return "int"
+		}
+		return "double"
+	}
+	return ""
+}
+
+// handleNumBuiltin: int 用 abs / 生成的 py_min_int 等，double 用 fabs / fmin / fmax / rint；
+// 参数是一个列表时（min(xs)、sum(xs)）调用按元素类型生成的循环辅助函数
+func (g *generator) handleNumBuiltin(name string, call map[string]interface{}) (string, bool) {
+	switch name {
+	case "abs", "min", "max", "round", "sum":
+	default:
+		return "", false
+	}
+	if g.funcNodes[name] != nil {
+		return "", false
+	}
+	args, _ := call["args"].([]interface{})
+	t := g.numBuiltinType(name, args)
+	if kw, _ := call["keywords"].([]interface{}); t == "" || len(kw) > 0 {
+		return g.unsupportedExpr(call, fmt.Sprintf("call: %s()", name)), true
+	}
+	xs := []string{}
+	for _, a := range args {
+		xs = append(xs, g.toC(a.(map[string]interface{}), 0))
+	}
+	if elem := g.numListElem(args[0]); elem != "" && name != "abs" && name != "round" {
+		fn := g.listReduce(elem, name)
+		if len(xs) == 2 {
+			return fmt.Sprintf("(%s + %s(%s))", xs[1], fn, xs[0]), true
+		}
+		return fmt.Sprintf("%s(%s)", fn, xs[0]), true
+	}
+	switch name {
+	case "abs":
+		if t == "int" {
+			return g.absCall(xs[0]), true
+		}
+		return fmt.Sprintf("%s(%s)", g.mathCall("fabs"), xs[0]), true
+	case "round":
+		if g.numType(args[0]) == "int" {
+			return xs[0], true
+		}
+		rint := g.mathCall("rint")
+		if len(xs) == 2 {
+			g.roundRuntime()
+			return fmt.Sprintf("py_round(%s, %s)", xs[0], xs[1]), true
+		}
+		// rint 在默认舍入模式下与 Python 一样，.5 舍入到偶数
+		return fmt.Sprintf("(int)%s(%s)", rint, xs[0]), true
+	}
+	// min(a, b, c) -> fmin(fmin(a, b), c)
+	fn := "py_" + name + "_int"
+	if t == "int" {
+		g.minMaxRuntime()
+	} else {
+		fn = g.mathCall("f" + name)
+	}
+	code := xs[0]
+	for _, x := range xs[1:] {
+		code = fmt.Sprintf("%s(%s, %s)", fn, code, x)
+	}
+	return code, true
+}
+
+// minMaxRuntime: 整数的 min / max
+func (g *generator) minMaxRuntime() {
+	g.runtimeHelpers["py_minmax"] = `// min(a, b) / max(a, b) of ints
+static int py_min_int(int a, int b) {
+    return a < b ? a : b;
+}
+static int py_max_int(int a, int b) {
+    return a > b ? a : b;
+}
+`
+}
+
+// roundRuntime: round(x, n) 按 10 的幂缩放后舍入到偶数，结果仍是 double
+func (g *generator) roundRuntime() {
+	g.runtimeHelpers["py_round"] = fmt.Sprintf(`// round(x, n): round to n decimal places, halves to even
+static double py_round(double x, int n) {
+    double p = %[1]s(10, n);
+    return n >= 0 ? %[2]s(x * p) / p : %[2]s(x / %[1]s(10, -n)) * %[1]s(10, -n);
+}
+`, g.mathCall("pow"), g.mathCall("rint"))
+}
+
+// listReduce: min(xs) / max(xs) / sum(xs) 的循环辅助函数，用到列表类型，和列表类型一起输出在结构体之后
+func (g *generator) listReduce(elem, name string) string {
+	lt := strings.TrimSuffix(g.listType(elem), "*")
+	fn := lt + "_" + name
+	if g.copyFuncs[fn] {
+		return fn
+	}
+	g.copyFuncs[fn] = true
+	if name == "sum" {
+		g.classStructs = append(g.classStructs, fmt.Sprintf(`// sum(xs)
+static %[2]s %[1]s_sum(%[1]s* l) {
+    %[2]s total = 0;
+    for (int i = 0; i < l->len; i++) {
+        total += l->items[i];
+    }
+    return total;
+}
+`, lt, elem))
+		return fn
+	}
+	op := map[string]string{"min": "<", "max": ">"}[name]
+	g.classStructs = append(g.classStructs, fmt.Sprintf(`// %[3]s(xs): the first smallest / largest item
+static %[2]s %[1]s_%[3]s(%[1]s* l) {
+    if (l->len == 0) {
+        %[5]s
+    }
+    %[2]s best = l->items[0];
+    for (int i = 1; i < l->len; i++) {
+        if (l->items[i] %[4]s best) {
+            best = l->items[i];
+        }
+    }
+    return best;
+}
+`, lt, elem, name, op, g.runtimeError("ValueError", name+"() arg is an empty sequence")))
+	return fn
+}
+
+// --- time / datetime ---
+
+// stdlibCallType: 标准库函数调用的结果类型，不认识时为 ""
+func (g *generator) stdlibCallType(qname string) string {
+	switch qname {
+	case "time.time":
+		return "double"
+	case "datetime.datetime.now":
+		return "PyDateTime"
+	case "os.getcwd", "os.path.join", "os.environ.get":
+		return "char*"
+	case "os.path.exists", "os.path.isfile", "os.path.isdir":
+		return "int"
+	case "os.listdir":
+		return g.listType("char*")
+	case "json.loads", "json.load":
+		return "PyJson*"
+	case "json.dumps":
+		return "char*"
+	}
+	return ""
+}
+
+// timeCall: time.time() 取 CLOCK_REALTIME（Windows 为 GetSystemTimeAsFileTime），time.sleep(s) 用 nanosleep（Windows 为 Sleep）
+func (g *generator) timeCall(qname string, node ASTNode) string {
+	args, _ := node["args"].([]interface{})
+	if g.optProfile == "arduino" {
+		return g.arduinoTimeCall(qname, node, args)
+	}
+	g.includes["time.h"] = true
+	g.winIncludes["windows.h"] = true
+	g.usesPosix = true
+	if qname == "time.time" {
+		g.runtimeHelpers["py_time"] = `// time.time(): seconds since the epoch
+static double py_time(void) {
+#ifdef _WIN32
+    FILETIME ft;
+    GetSystemTimeAsFileTime(&ft);
+    unsigned long long t = ((unsigned long long)ft.dwHighDateTime << 32) | ft.dwLowDateTime;
+    return (double)(t - 116444736000000000ULL) / 1e7;
+#else
+    struct timespec ts;
+    clock_gettime(CLOCK_REALTIME, &ts);
+    return (double)ts.tv_sec + ts.tv_nsec / 1e9;
+#endif
+}
+`
+		return "py_time()"
+	}
+	if len(args) != 1 {
+		return g.unsupportedExpr(node, "call: time.sleep expects one argument")
+	}
+	g.includes["errno.h"] = true
+	g.runtimeHelpers["py_time_sleep"] = fmt.Sprintf(`// time.sleep(s): fractional seconds, resumed after signals
+static void py_sleep(double s) {
+    if (s < 0) {
+        %s
+    }
+#ifdef _WIN32
+    Sleep((DWORD)(s * 1000));
+#else
+    struct timespec ts;
+    ts.tv_sec = (time_t)s;
+    ts.tv_nsec = (long)((s - (double)ts.tv_sec) * 1e9);
+    while (nanosleep(&ts, &ts) == -1 && errno == EINTR) {
+    }
+#endif
+}
+`, g.runtimeError("ValueError", "sleep length must be non-negative"))
+	return fmt.Sprintf("py_sleep(%s)", g.toC(args[0].(map[string]interface{}), 0))
+}
+
+// datetimeFields: PyDateTime 的字段，与 Python datetime 的属性同名
+var datetimeFields = []string{"year", "month", "day", "hour", "minute", "second", "microsecond"}
+
+// datetimeRuntime: datetime 按值传递的结构体，now() 取本地时间；strftime 在 C 的基础上支持 %f（微秒）
+func (g *generator) datetimeRuntime() {
+	g.includes["time.h"] = true
+	g.winIncludes["windows.h"] = true
+	g.usesPosix = true
+	g.strBuf()
+	// 排在 py_strbuf 之后
+	g.runtimeHelpers["py_strbuf_datetime"] = `// datetime.datetime: local date and time with microseconds
+typedef struct {
+    int year, month, day, hour, minute, second, microsecond;
+} PyDateTime;
+// datetime.datetime.now()
+static PyDateTime py_datetime_now(void) {
+    PyDateTime d;
+#ifdef _WIN32
+    SYSTEMTIME st;
+    GetLocalTime(&st);
+    d.year = st.wYear;
+    d.month = st.wMonth;
+    d.day = st.wDay;
+    d.hour = st.wHour;
+    d.minute = st.wMinute;
+    d.second = st.wSecond;
+    d.microsecond = st.wMilliseconds * 1000;
+#else
+    struct timespec ts;
+    struct tm tm;
+    clock_gettime(CLOCK_REALTIME, &ts);
+    localtime_r(&ts.tv_sec, &tm);
+    d.year = tm.tm_year + 1900;
+    d.month = tm.tm_mon + 1;
+    d.day = tm.tm_mday;
+    d.hour = tm.tm_hour;
+    d.minute = tm.tm_min;
+    d.second = tm.tm_sec;
+    d.microsecond = (int)(ts.tv_nsec / 1000);
+#endif
+    return d;
+}
+// str(d) / d.isoformat(): the microseconds are left out when they are zero
+static char* py_datetime_str(PyDateTime d, char sep) {
+    char* buf = py_strbuf();
+    int n = snprintf(buf, PY_STRBUF_SIZE, "%04d-%02d-%02d%c%02d:%02d:%02d", d.year, d.month, d.day, sep, d.hour, d.minute, d.second);
+    if (d.microsecond) {
+        snprintf(buf + n, PY_STRBUF_SIZE - n, ".%06d", d.microsecond);
+    }
+    return buf;
+}
+// d.strftime(fmt): C strftime with %f expanded to the microseconds first
+static char* py_datetime_strftime(PyDateTime d, const char* fmt) {
+    char spec[256];
+    size_t n = 0;
+    for (const char* p = fmt; *p && n < sizeof(spec) - 8; p++) {
+        if (p[0] == '%' && p[1] == 'f') {
+            n += snprintf(spec + n, sizeof(spec) - n, "%06d", d.microsecond);
+            p++;
+        } else if (p[0] == '%' && p[1]) {
+            spec[n++] = *p++;
+            spec[n++] = *p;
+        } else {
+            spec[n++] = *p;
+        }
+    }
+    spec[n] = '\0';
+    struct tm tm = {0};
+    tm.tm_year = d.year - 1900;
+    tm.tm_mon = d.month - 1;
+    tm.tm_mday = d.day;
+    tm.tm_hour = d.hour;
+    tm.tm_min = d.minute;
+    tm.tm_sec = d.second;
+    tm.tm_isdst = -1;
+    // fills in the weekday and day of the year for %a, %A, %j
+    mktime(&tm);
+    char* buf = py_strbuf();
+    if (strftime(buf, PY_STRBUF_SIZE, spec, &tm) == 0) {
+        buf[0] = '\0';
+    }
+    return buf;
+}
+`
+}
+
+// handleDateTimeMethodCall: d.strftime(fmt) / d.isoformat()
+func (g *generator) handleDateTimeMethodCall(fn, call map[string]interface{}) (string, bool) {
+	if g.getType(fn["value"]) != "PyDateTime" {
+		return "", false
+	}
+	d := g.toC(fn["value"].(map[string]interface{}), 0)
+	args, _ := call["args"].([]interface{})
+	switch {
+	case fn["attr"] == "strftime" && len(args) == 1:
+		return fmt.Sprintf("py_datetime_strftime(%s, %s)", d, g.toC(args[0].(map[string]interface{}), 0)), true
+	case fn["attr"] == "isoformat" && len(args) == 0:
+		return fmt.Sprintf("py_datetime_str(%s, 'T')", d), true
+	}
+	return g.unsupportedExpr(call, fmt.Sprintf("call: datetime.%v()", fn["attr"])), true
+}
+
+// --- sys ---
+
+// stdlibAttr: 标准库模块的变量（sys.argv、sys.stderr ...）对应的 C 表达式和类型，不认识时为 ""
+func (g *generator) stdlibAttr(qname string) (string, string) {
+	switch qname {
+	case "sys.argv":
+		return g.sysArgv(), g.listType("char*")
+	case "sys.stdin", "sys.stdout", "sys.stderr":
+		return strings.TrimPrefix(qname, "sys."), "FILE*"
+	}
+	return "", ""
+}
+
+// sysArgv: sys.argv 是文件作用域的字符串列表，main 开头由 argc/argv 填充
+func (g *generator) sysArgv() string {
+	lt := strings.TrimSuffix(g.listType("char*"), "*")
+	g.usesArgv = true
+	if !g.copyFuncs["py_sys_argv"] {
+		g.copyFuncs["py_sys_argv"] = true
+		g.classStructs = append(g.classStructs, fmt.Sprintf("// sys.argv, filled in at the start of main\nstatic %s* py_sys_argv;\n", lt))
+	}
+	return "py_sys_argv"
+}
+
+// sysArgvInit: main 开头把命令行参数放进 sys.argv（-refcount 时列表保存计数的副本）
+func (g *generator) sysArgvInit() string {
+	lt := strings.TrimSuffix(g.listType("char*"), "*")
+	arg := "argv[i]"
+	if g.optRefcount {
+		arg = g.strDup() + "(argv[i])"
+	}
+	return fmt.Sprintf("    py_sys_argv = %[1]s_new();\n    for (int i = 0; i < argc; i++) {\n        %[1]s_append(py_sys_argv, %[2]s);\n    }\n", lt, arg)
+}
+
+// sysExit: sys.exit(n) -> exit(n)；sys.exit() / sys.exit(None) 的状态为 0，
+// 和 Python 一样，sys.exit(msg) 把消息写到 stderr 后以状态 1 退出
+func (g *generator) sysExit(node ASTNode) string {
+	g.includes["stdlib.h"] = true
+	args, _ := node["args"].([]interface{})
+	if len(args) == 0 {
+		return "exit(0)"
+	}
+	arg := args[0].(map[string]interface{})
+	switch t := g.getType(arg); {
+	case arg["_type"] == "Constant" && arg["value"] == nil:
+		return "exit(0)"
+	case t == "char*":
+		g.pendingPre = append(g.pendingPre, fmt.Sprintf("fprintf(stderr, \"%%s\\n\", %s);\n", g.toC(arg, 0)))
+		return "exit(1)"
+	case t == "int" || g.isIntExpr(arg):
+		return fmt.Sprintf("exit(%s)", g.toC(arg, 0))
+	case t == "double":
+		return fmt.Sprintf("exit((int)(%s))", g.toC(arg, 0))
+	}
+	return g.unsupportedExpr(node, "call: sys.exit()")
+}
+
+// --- os ---
+
+// osExit: os._exit(n) -> _Exit(n)，和 Python 一样不刷新缓冲区、不运行 atexit；os.abort() -> abort()
+func (g *generator) osExit(qname string, node ASTNode) string {
+	g.includes["stdlib.h"] = true
+	args, _ := node["args"].([]interface{})
+	if qname == "os.abort" && len(args) == 0 {
+		return "abort()"
+	}
+	if qname == "os._exit" && len(args) == 1 {
+		arg := args[0].(map[string]interface{})
+		if t := g.getType(arg); t == "int" || g.isIntExpr(arg) {
+			return fmt.Sprintf("_Exit(%s)", g.toC(arg, 0))
+		}
+	}
+	return g.unsupportedExpr(node, "call: "+qname+"()")
+}
+
+// osCall: os.getcwd / os.path.* / os.listdir / os.environ.get。
+// 路径函数按 POSIX 实现（unistd.h、dirent.h），Windows 上换成 direct.h 和 FindFirstFile
+func (g *generator) osCall(qname string, node ASTNode) string {
+	args, _ := node["args"].([]interface{})
+	xs := []string{}
+	for _, a := range args {
+		xs = append(xs, g.toC(a.(map[string]interface{}), 0))
+	}
+	switch {
+	case qname == "os.getcwd" && len(xs) == 0:
+		g.strBuf()
+		g.winIncludes["direct.h"] = true
+		g.posixIncludes["unistd.h"] = true
+		g.runtimeHelpers["py_strbuf_os_getcwd"] = fmt.Sprintf(`// os.getcwd()
+static char* py_getcwd(void) {
+    char* buf = py_strbuf();
+#ifdef _WIN32
+    if (!_getcwd(buf, PY_STRBUF_SIZE)) {
+#else
+    if (!getcwd(buf, PY_STRBUF_SIZE)) {
+#endif
+        %s
+    }
+    return buf;
+}
+`, g.runtimeError("OSError", "getcwd failed"))
+		return "py_getcwd()"
+	case qname == "os.path.join" && len(xs) > 0:
+		g.includes["string.h"] = true
+		g.strBuf()
+		g.runtimeHelpers["py_strbuf_os_path_join"] = `// os.path.join(a, b): b replaces a when it is absolute, otherwise a separator is added if a lacks one
+static char* py_path_join(const char* a, const char* b) {
+    char* buf = py_strbuf();
+    size_t n = strlen(a);
+    if (b[0] == '/' || n == 0) {
+        snprintf(buf, PY_STRBUF_SIZE, "%s", b);
+    } else if (a[n - 1] == '/') {
+        snprintf(buf, PY_STRBUF_SIZE, "%s%s", a, b);
+    } else {
+        snprintf(buf, PY_STRBUF_SIZE, "%s/%s", a, b);
+    }
+    return buf;
+}
+`
+		// os.path.join(a, b, c) -> py_path_join(py_path_join(a, b), c)
+		code := xs[0]
+		for _, x := range xs[1:] {
+			code = fmt.Sprintf("py_path_join(%s, %s)", code, x)
+		}
+		return code
+	case (qname == "os.path.exists" || qname == "os.path.isfile" || qname == "os.path.isdir") && len(xs) == 1:
+		g.includes["sys/stat.h"] = true
+		g.runtimeHelpers["py_os_stat"] = `// os.path.exists / isfile / isdir
+#if defined(_WIN32) && !defined(S_ISDIR)
+#define S_ISDIR(m) (((m) & S_IFMT) == S_IFDIR)
+#define S_ISREG(m) (((m) & S_IFMT) == S_IFREG)
+#endif
+static int py_path_exists(const char* p) {
+    struct stat st;
+    return stat(p, &st) == 0;
+}
+static int py_path_isfile(const char* p) {
+    struct stat st;
+    return stat(p, &st) == 0 && S_ISREG(st.st_mode);
+}
+static int py_path_isdir(const char* p) {
+    struct stat st;
+    return stat(p, &st) == 0 && S_ISDIR(st.st_mode);
+}
+`
+		return fmt.Sprintf("py_path_%s(%s)", strings.TrimPrefix(qname, "os.path."), xs[0])
+	case qname == "os.listdir" && len(xs) <= 1:
+		g.osListdir()
+		if len(xs) == 0 {
+			xs = append(xs, `"."`)
+		}
+		return g.rcHold(g.listType("char*"), fmt.Sprintf("py_listdir(%s)", xs[0]))
+	case qname == "os.environ.get" && (len(xs) == 1 || len(xs) == 2):
+		g.includes["stdlib.h"] = true
+		if len(xs) == 1 {
+			// 没有时为 None
+			return fmt.Sprintf("getenv(%s)", xs[0])
+		}
+		g.runtimeHelpers["py_os_getenv_or"] = `// os.environ.get(name, default)
+static char* py_getenv_or(const char* name, char* def) {
+    char* v = getenv(name);
+    return v ? v : def;
+}
+`
+		return fmt.Sprintf("py_getenv_or(%s, %s)", xs[0], xs[1])
+	}
+	return g.unsupportedExpr(node, fmt.Sprintf("call: %s()", qname))
+}
+
+// osEnviron: os.environ[name]，变量不存在时与 Python 一样抛出 KeyError
+func (g *generator) osEnviron(key string) string {
+	g.includes["stdlib.h"] = true
+	g.runtimeHelpers["py_os_getenv"] = fmt.Sprintf(`// os.environ[name]
+static char* py_getenv(const char* name) {
+    char* v = getenv(name);
+    if (!v) {
+        %s
+    }
+    return v;
+}
+`, g.runtimeError("KeyError", "environment variable not set"))
+	return fmt.Sprintf("py_getenv(%s)", key)
+}
+
+// osListdir: os.listdir(path) 的辅助函数，返回新的字符串列表（不含 . 和 ..，顺序由系统决定），和列表类型一起输出在结构体之后
+func (g *generator) osListdir() {
+	lt := strings.TrimSuffix(g.listType("char*"), "*")
+	if g.copyFuncs["py_listdir"] {
+		return
+	}
+	g.copyFuncs["py_listdir"] = true
+	g.includes["string.h"] = true
+	g.posixIncludes["dirent.h"] = true
+	dup := g.strDup()
+	fail := g.runtimeError("FileNotFoundError", "No such file or directory")
+	g.classStructs = append(g.classStructs, fmt.Sprintf(`// os.listdir(path): the names in a directory except . and ..
+static %[1]s* py_listdir(const char* path) {
+    %[1]s* l;
+#ifdef _WIN32
+    char pattern[MAX_PATH];
+    WIN32_FIND_DATAA fd;
+    snprintf(pattern, sizeof(pattern), "%%s\\*", path);
+    HANDLE h = FindFirstFileA(pattern, &fd);
+    if (h == INVALID_HANDLE_VALUE) {
+        %[3]s
+    }
+    l = %[1]s_new();
+    do {
+        if (strcmp(fd.cFileName, ".") && strcmp(fd.cFileName, "..")) {
+            %[1]s_append(l, %[2]s(fd.cFileName));
+        }
+    } while (FindNextFileA(h, &fd));
+    FindClose(h);
+#else
+    DIR* d = opendir(path);
+    if (!d) {
+        %[3]s
+    }
+    l = %[1]s_new();
+    struct dirent* e;
+    while ((e = readdir(d))) {
+        if (strcmp(e->d_name, ".") && strcmp(e->d_name, "..")) {
+            %[1]s_append(l, %[2]s(e->d_name));
+        }
+    }
+    closedir(d);
+#endif
+    return l;
+}
+`, lt, dup, fail))
+	g.winIncludes["windows.h"] = true
+}
+
+// --- json ---
+
+// jsonRuntime: json.loads / json.dumps 用到的动态类型值 PyJson：null、bool、整数、浮点数、字符串、列表和对象（键保持插入顺序）。
+// -refcount 时每个值都带计数，容器释放时放掉子值；否则用 malloc，和字符串一样不释放
+func (g *generator) jsonRuntime() {
+	g.includes["stdlib.h"] = true
+	g.includes["string.h"] = true
+	g.floatStr()
+	alloc, release, releaseStr, freeDecl := "(PyJson*)calloc(1, sizeof(PyJson))", "py_json_free", "free", `static void py_json_free(PyJson* j) {
+    if (j) {
+        py_json_drop(j);
+        free(j);
+    }
+}
+`
+	if g.optRefcount {
+		g.rcRuntime()
+		alloc, release, releaseStr, freeDecl = "(PyJson*)py_rc_alloc(sizeof(PyJson), py_json_drop)", "py_decref", "py_decref", ""
+	}
+	dup := g.strDup()
+	// 排在 py_strbuf 和 py_float_str 之后
+	g.runtimeHelpers["py_strbuf_json"] = fmt.Sprintf(`// json: a dynamically typed value for json.loads / json.dumps and dict literals
+enum { PY_JSON_NULL, PY_JSON_BOOL, PY_JSON_INT, PY_JSON_FLOAT, PY_JSON_STR, PY_JSON_LIST, PY_JSON_OBJ };
+typedef struct PyJson PyJson;
+struct PyJson {
+    int kind;
+    double num;
+    char* str;
+    PyJson** items; // list items, object values
+    PyJson** keys;  // object keys (strings), in insertion order
+    int len;
+    int cap;
+};
+static void py_json_drop(void* p);
+%[4]sstatic void py_json_drop(void* p) {
+    PyJson* j = (PyJson*)p;
+    if (j->str) {
+        %[3]s(j->str);
+    }
+    for (int i = 0; i < j->len; i++) {
+        %[2]s(j->items[i]);
+        if (j->keys) {
+            %[2]s(j->keys[i]);
+        }
+    }
+    free(j->items);
+    free(j->keys);
+}
+static PyJson* py_json_new(int kind) {
+    PyJson* j = %[1]s;
+    j->kind = kind;
+    return j;
+}
+static PyJson* py_json_number(double x, int isint) {
+    PyJson* j = py_json_new(isint ? PY_JSON_INT : PY_JSON_FLOAT);
+    j->num = x;
+    return j;
+}
+static PyJson* py_json_bool(int b) {
+    PyJson* j = py_json_new(PY_JSON_BOOL);
+    j->num = b != 0;
+    return j;
+}
+static PyJson* py_json_string(const char* s) {
+    PyJson* j = py_json_new(PY_JSON_STR);
+    j->str = %[5]s(s);
+    return j;
+}
+// the container takes over the reference to v
+static PyJson* py_json_append(PyJson* j, PyJson* v) {
+    if (j->len == j->cap) {
+        j->cap = j->cap ? j->cap * 2 : 4;
+        j->items = (PyJson**)realloc(j->items, j->cap * sizeof(PyJson*));
+        if (j->kind == PY_JSON_OBJ) {
+            j->keys = (PyJson**)realloc(j->keys, j->cap * sizeof(PyJson*));
+        }
+    }
+    j->items[j->len++] = v;
+    return j;
+}
+static int py_json_find(PyJson* j, const char* key) {
+    for (int i = 0; i < j->len; i++) {
+        if (!strcmp(j->keys[i]->str, key)) {
+            return i;
+        }
+    }
+    return -1;
+}
+static void py_json_expect(PyJson* j, int kind) {
+    if (!j || j->kind != kind) {
+        %[6]s
+    }
+}
+// d[key] = v: replaces the value of an existing key, like a Python dict
+static PyJson* py_json_set(PyJson* j, const char* key, PyJson* v) {
+    py_json_expect(j, PY_JSON_OBJ);
+    int i = py_json_find(j, key);
+    if (i >= 0) {
+        %[2]s(j->items[i]);
+        j->items[i] = v;
+        return j;
+    }
+    py_json_append(j, v);
+    j->keys[j->len - 1] = py_json_string(key);
+    return j;
+}
+static PyJson* py_json_get(PyJson* j, const char* key) {
+    py_json_expect(j, PY_JSON_OBJ);
+    int i = py_json_find(j, key);
+    if (i < 0) {
+        %[7]s
+    }
+    return j->items[i];
+}
+// d.get(key, default): NULL stands for None
+static PyJson* py_json_get_or(PyJson* j, const char* key, PyJson* def) {
+    py_json_expect(j, PY_JSON_OBJ);
+    int i = py_json_find(j, key);
+    return i < 0 ? def : j->items[i];
+}
+static int py_json_has(PyJson* j, const char* key) {
+    py_json_expect(j, PY_JSON_OBJ);
+    return py_json_find(j, key) >= 0;
+}
+static PyJson** py_json_slot(PyJson* j, int i) {
+    py_json_expect(j, PY_JSON_LIST);
+    if (i < 0) {
+        i += j->len;
+    }
+    if (i < 0 || i >= j->len) {
+        %[8]s
+    }
+    return &j->items[i];
+}
+static PyJson* py_json_at(PyJson* j, int i) {
+    return *py_json_slot(j, i);
+}
+// for x in value: the items of a list, the keys of an object
+static PyJson* py_json_iter(PyJson* j, int i) {
+    return j->kind == PY_JSON_OBJ ? j->keys[i] : j->items[i];
+}
+static void py_json_put(PyJson* j, int i, PyJson* v) {
+    PyJson** slot = py_json_slot(j, i);
+    %[2]s(*slot);
+    *slot = v;
+}
+static void py_json_iterable(PyJson* j) {
+    if (!j || (j->kind != PY_JSON_LIST && j->kind != PY_JSON_OBJ)) {
+        %[6]s
+    }
+}
+static int py_json_len(PyJson* j) {
+    if (j && j->kind == PY_JSON_STR) {
+        return (int)strlen(j->str);
+    }
+    py_json_iterable(j);
+    return j->len;
+}
+static double py_json_num(PyJson* j) {
+    if (!j || j->kind < PY_JSON_BOOL || j->kind > PY_JSON_FLOAT) {
+        %[6]s
+    }
+    return j->num;
+}
+// value[key] where the key is itself a JSON value (a string for objects, an integer for lists)
+static PyJson* py_json_index(PyJson* j, PyJson* key) {
+    if (key && key->kind == PY_JSON_STR) {
+        return py_json_get(j, key->str);
+    }
+    return py_json_at(j, (int)py_json_num(key));
+}
+`, alloc, release, releaseStr, freeDecl, dup,
+		g.runtimeError("TypeError", "unsupported operation for this JSON value"),
+		g.runtimeError("KeyError", "key not found"),
+		g.runtimeError("IndexError", "list index out of range"))
+	g.jsonParser(release)
+	g.jsonWriter(dup)
+}
+
+// jsonParser: 递归下降解析 JSON 文本；出错时释放已经建好的部分并抛出 ValueError
+func (g *generator) jsonParser(release string) {
+	g.runtimeHelpers["py_strbuf_json_parse"] = fmt.Sprintf(`// json.loads(s)
+static void py_json_ws(const char** p) {
+    while (**p == ' ' || **p == '\t' || **p == '\n' || **p == '\r') {
+        (*p)++;
+    }
+}
+static int py_json_hex(const char* p) {
+    int v = 0;
+    for (int i = 0; i < 4; i++) {
+        int c = p[i];
+        int d = c >= '0' && c <= '9' ? c - '0' : c >= 'a' && c <= 'f' ? c - 'a' + 10 : c >= 'A' && c <= 'F' ? c - 'A' + 10 : -1;
+        if (d < 0) {
+            return -1;
+        }
+        v = v * 16 + d;
+    }
+    return v;
+}
+// a string literal at *p (on the opening quote) as a new malloc'd string, NULL when malformed
+static char* py_json_parse_str(const char** p) {
+    const char* s = *p + 1;
+    size_t n = 0;
+    while (s[n] && s[n] != '"') {
+        n += s[n] == '\\' && s[n + 1] ? 2 : 1;
+    }
+    if (s[n] != '"') {
+        return NULL;
+    }
+    char* out = (char*)malloc(n + 1);
+    size_t k = 0;
+    for (size_t i = 0; i < n; i++) {
+        unsigned char c = (unsigned char)s[i];
+        if (c < 0x20) {
+            free(out);
+            return NULL;
+        }
+        if (c != '\\') {
+            out[k++] = (char)c;
+            continue;
+        }
+        c = (unsigned char)s[++i];
+        switch (c) {
+        case '"': case '\\': case '/': out[k++] = (char)c; break;
+        case 'b': out[k++] = '\b'; break;
+        case 'f': out[k++] = '\f'; break;
+        case 'n': out[k++] = '\n'; break;
+        case 'r': out[k++] = '\r'; break;
+        case 't': out[k++] = '\t'; break;
+        case 'u': {
+            int u = i + 4 < n ? py_json_hex(s + i + 1) : -1;
+            if (u < 0) {
+                free(out);
+                return NULL;
+            }
+            i += 4;
+            if (u >= 0xD800 && u < 0xDC00 && i + 6 < n && s[i + 1] == '\\' && s[i + 2] == 'u') {
+                int lo = py_json_hex(s + i + 3);
+                if (lo >= 0xDC00 && lo < 0xE000) {
+                    u = 0x10000 + ((u - 0xD800) << 10) + (lo - 0xDC00);
+                    i += 6;
+                }
+            }
+            // UTF-8; never longer than the escape it replaces
+            if (u < 0x80) {
+                out[k++] = (char)u;
+            } else if (u < 0x800) {
+                out[k++] = (char)(0xC0 | u >> 6);
+                out[k++] = (char)(0x80 | (u & 0x3F));
+            } else if (u < 0x10000) {
+                out[k++] = (char)(0xE0 | u >> 12);
+                out[k++] = (char)(0x80 | (u >> 6 & 0x3F));
+                out[k++] = (char)(0x80 | (u & 0x3F));
+            } else {
+                out[k++] = (char)(0xF0 | u >> 18);
+                out[k++] = (char)(0x80 | (u >> 12 & 0x3F));
+                out[k++] = (char)(0x80 | (u >> 6 & 0x3F));
+                out[k++] = (char)(0x80 | (u & 0x3F));
+            }
+            break;
+        }
+        default:
+            free(out);
+            return NULL;
+        }
+    }
+    out[k] = '\0';
+    *p = s + n + 1;
+    return out;
+}
+static PyJson* py_json_value(const char** p, int depth) {
+    py_json_ws(p);
+    const char* s = *p;
+    if (depth > 500) {
+        return NULL;
+    }
+    if (*s == '{' || *s == '[') {
+        int obj = *s == '{';
+        PyJson* j = py_json_new(obj ? PY_JSON_OBJ : PY_JSON_LIST);
+        (*p)++;
+        py_json_ws(p);
+        if (**p == (obj ? '}' : ']')) {
+            (*p)++;
+            return j;
+        }
+        for (;;) {
+            char* key = NULL;
+            if (obj) {
+                py_json_ws(p);
+                key = **p == '"' ? py_json_parse_str(p) : NULL;
+                py_json_ws(p);
+                if (!key || **p != ':') {
+                    free(key);
+                    %[1]s(j);
+                    return NULL;
+                }
+                (*p)++;
+            }
+            PyJson* v = py_json_value(p, depth + 1);
+            if (!v) {
+                free(key);
+                %[1]s(j);
+                return NULL;
+            }
+            if (obj) {
+                py_json_set(j, key, v);
+                free(key);
+            } else {
+                py_json_append(j, v);
+            }
+            py_json_ws(p);
+            if (**p == ',') {
+                (*p)++;
+                continue;
+            }
+            if (**p == (obj ? '}' : ']')) {
+                (*p)++;
+                return j;
+            }
+            %[1]s(j);
+            return NULL;
+        }
+    }
+    if (*s == '"') {
+        char* str = py_json_parse_str(p);
+        if (!str) {
+            return NULL;
+        }
+        PyJson* j = py_json_string(str);
+        free(str);
+        return j;
+    }
+    if (!strncmp(s, "true", 4) || !strncmp(s, "false", 5)) {
+        *p += *s == 't' ? 4 : 5;
+        return py_json_bool(*s == 't');
+    }
+    if (!strncmp(s, "null", 4)) {
+        *p += 4;
+        return py_json_new(PY_JSON_NULL);
+    }
+    if (*s == '-' || (*s >= '0' && *s <= '9')) {
+        char* end;
+        double x = strtod(s, &end);
+        int isint = 1;
+        for (const char* c = s; c < end; c++) {
+            if (*c == '.' || *c == 'e' || *c == 'E') {
+                isint = 0;
+            }
+        }
+        *p = end;
+        return py_json_number(x, isint);
+    }
+    return NULL;
+}
+static PyJson* py_json_loads(const char* s) {
+    const char* p = s;
+    PyJson* j = py_json_value(&p, 0);
+    if (j) {
+        py_json_ws(&p);
+        if (*p) {
+            %[1]s(j);
+            j = NULL;
+        }
+    }
+    if (!j) {
+        %[2]s
+    }
+    return j;
+}
+`, release, g.runtimeError("ValueError", "invalid JSON document"))
+}
+
+// jsonWriter: json.dumps 按 Python 的默认格式输出（", " / ": " 分隔，非 ASCII 字符转成 \uXXXX，indent 时换行缩进）；
+// str() / print 按 Python 的 repr 输出容器（{'a': 1, 'b': [True, None]}）
+func (g *generator) jsonWriter(dup string) {
+	result := "o.buf"
+	if g.optRefcount {
+		result = fmt.Sprintf("%s(o.buf)", dup)
+	}
+	g.runtimeHelpers["py_strbuf_json_write"] = fmt.Sprintf(`// json.dumps(x) and str(x)
+typedef struct {
+    char* buf;
+    size_t len;
+    size_t cap;
+} PyJsonOut;
+static void py_json_put_n(PyJsonOut* o, const char* s, size_t n) {
+    if (o->len + n + 1 > o->cap) {
+        o->cap = (o->len + n + 1) * 2;
+        o->buf = (char*)realloc(o->buf, o->cap);
+    }
+    memcpy(o->buf + o->len, s, n);
+    o->len += n;
+    o->buf[o->len] = '\0';
+}
+static void py_json_puts(PyJsonOut* o, const char* s) {
+    py_json_put_n(o, s, strlen(s));
+}
+static void py_json_quote(PyJsonOut* o, const char* s, int repr) {
+    char q = repr && strchr(s, '\'') && !strchr(s, '"') ? '"' : repr ? '\'' : '"';
+    char esc[16];
+    py_json_put_n(o, &q, 1);
+    for (const unsigned char* c = (const unsigned char*)s; *c; c++) {
+        if (*c == q || *c == '\\') {
+            esc[0] = '\\';
+            esc[1] = (char)*c;
+            py_json_put_n(o, esc, 2);
+        } else if (*c == '\n' || *c == '\r' || *c == '\t') {
+            py_json_puts(o, *c == '\n' ? "\\n" : *c == '\r' ? "\\r" : "\\t");
+        } else if (*c < 0x20) {
+            snprintf(esc, sizeof(esc), repr ? "\\x%%02x" : "\\u%%04x", *c);
+            py_json_puts(o, esc);
+        } else if (*c >= 0x80 && !repr) {
+            // ensure_ascii: decode the UTF-8 sequence and escape the code point
+            int extra = *c >= 0xF0 ? 3 : *c >= 0xE0 ? 2 : 1;
+            unsigned u = *c & (0x3F >> extra);
+            for (int i = 0; i < extra && (c[1] & 0xC0) == 0x80; i++) {
+                u = u << 6 | (*++c & 0x3F);
+            }
+            if (u >= 0x10000) {
+                snprintf(esc, sizeof(esc), "\\u%%04x\\u%%04x", 0xD800 + ((u - 0x10000) >> 10), 0xDC00 + ((u - 0x10000) & 0x3FF));
+            } else {
+                snprintf(esc, sizeof(esc), "\\u%%04x", u);
+            }
+            py_json_puts(o, esc);
+        } else {
+            py_json_put_n(o, (const char*)c, 1);
+        }
+    }
+    py_json_put_n(o, &q, 1);
+}
+static void py_json_newline(PyJsonOut* o, int indent, int depth) {
+    py_json_puts(o, "\n");
+    for (int i = 0; i < indent * depth; i++) {
+        py_json_puts(o, " ");
+    }
+}
+// indent < 0: everything on one line
+static void py_json_write(PyJsonOut* o, PyJson* j, int repr, int indent, int depth) {
+    char num[32];
+    if (!j || j->kind == PY_JSON_NULL) {
+        py_json_puts(o, repr ? "None" : "null");
+        return;
+    }
+    switch (j->kind) {
+    case PY_JSON_BOOL:
+        py_json_puts(o, j->num ? (repr ? "True" : "true") : (repr ? "False" : "false"));
+        return;
+    case PY_JSON_INT:
+        snprintf(num, sizeof(num), "%%lld", (long long)j->num);
+        py_json_puts(o, num);
+        return;
+    case PY_JSON_FLOAT:
+        if (!repr && (j->num != j->num || j->num - j->num != 0)) {
+            py_json_puts(o, j->num != j->num ? "NaN" : j->num > 0 ? "Infinity" : "-Infinity");
+            return;
+        }
+        py_json_puts(o, py_float_str(j->num));
+        return;
+    case PY_JSON_STR:
+        py_json_quote(o, j->str, repr);
+        return;
+    }
+    int obj = j->kind == PY_JSON_OBJ;
+    py_json_puts(o, obj ? "{" : "[");
+    for (int i = 0; i < j->len; i++) {
+        if (i > 0) {
+            py_json_puts(o, indent >= 0 ? "," : ", ");
+        }
+        if (indent >= 0) {
+            py_json_newline(o, indent, depth + 1);
+        }
+        if (obj) {
+            py_json_quote(o, j->keys[i]->str, repr);
+            py_json_puts(o, ": ");
+        }
+        py_json_write(o, j->items[i], repr, indent, depth + 1);
+    }
+    if (indent >= 0 && j->len > 0) {
+        py_json_newline(o, indent, depth);
+    }
+    py_json_puts(o, obj ? "}" : "]");
+}
+// json.dumps(x, indent=n): a new string
+static char* py_json_dumps(PyJson* j, int indent) {
+    PyJsonOut o = {NULL, 0, 0};
+    py_json_write(&o, j, 0, indent, 0);
+    char* s = %[1]s;%[2]s
+    return s;
+}
+// str(x): strings as they are, other values like Python's repr (in a scratch buffer)
+static char* py_json_str(PyJson* j) {
+    if (j && j->kind == PY_JSON_STR) {
+        return j->str;
+    }
+    PyJsonOut o = {NULL, 0, 0};
+    py_json_write(&o, j, 1, -1, 0);
+    char* buf = py_strbuf();
+    snprintf(buf, PY_STRBUF_SIZE, "%%s", o.buf);
+    free(o.buf);
+    return buf;
+}
+`, result, map[bool]string{true: "\n    free(o.buf);", false: ""}[g.optRefcount])
+}
+
+// isJSONDict: 键都是字符串的字典字面量按 PyJson 对象处理
+func (g *generator) isJSONDict(node interface{}) bool {
+	m, _ := node.(map[string]interface{})
+	if m["_type"] != "Dict" {
+		return false
+	}
+	keys, _ := m["keys"].([]interface{})
+	for _, k := range keys {
+		if k == nil || !g.isStrValue(k) {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonElem: 类型为 t 的 C 表达式 expr 转成新的 PyJson* 值，不支持的类型返回 ""
+func (g *generator) jsonElem(t, expr string, isInt bool) string {
+	switch {
+	case t == "PyJson*":
+		// 放进容器的是新的引用
+		if g.optRefcount {
+			return fmt.Sprintf("(PyJson*)py_incref(%s)", expr)
+		}
+		return expr
+	case t == "char*":
+		return fmt.Sprintf("py_json_string(%s)", expr)
+	case t == "int" || isInt:
+		return fmt.Sprintf("py_json_number(%s, 1)", expr)
+	case t == "double":
+		return fmt.Sprintf("py_json_number(%s, 0)", expr)
+	}
+	if _, ok := g.listElemType(t); ok {
+		if fn := g.jsonFromList(t); fn != "" {
+			return fmt.Sprintf("%s(%s)", fn, expr)
+		}
+	}
+	return ""
+}
+
+// jsonFromList: 列表转成 PyJson 列表的辅助函数 PyList_X_json，元素类型不支持时返回 ""
+func (g *generator) jsonFromList(t string) string {
+	elem, _ := g.listElemType(t)
+	lt := strings.TrimSuffix(t, "*")
+	fn := lt + "_json"
+	if g.copyFuncs[fn] {
+		return fn
+	}
+	item := g.jsonElem(elem, "l->items[i]", false)
+	if item == "" {
+		return ""
+	}
+	g.copyFuncs[fn] = true
+	g.jsonRuntime()
+	g.classStructs = append(g.classStructs, fmt.Sprintf(`// a list as a new JSON list (json.dumps, dict values)
+static PyJson* %[1]s(%[2]s* l) {
+    PyJson* j = py_json_new(PY_JSON_LIST);
+    for (int i = 0; i < l->len; i++) {
+        py_json_append(j, %[3]s);
+    }
+    return j;
+}
+`, fn, lt, item))
+	return fn
+}
+
+// jsonValue: Python 表达式构造成新的 PyJson* 值：字典 / 列表 / 元组字面量逐项构造，常量按类型，其余按表达式的类型转换
+func (g *generator) jsonValue(node interface{}) string {
+	g.jsonRuntime()
+	m, _ := node.(map[string]interface{})
+	switch m["_type"] {
+	case "Dict":
+		if !g.isJSONDict(m) {
+			break
+		}
+		code := "py_json_new(PY_JSON_OBJ)"
+		vals, _ := m["values"].([]interface{})
+		for i, k := range m["keys"].([]interface{}) {
+			code = fmt.Sprintf("py_json_set(%s, %s, %s)", code, g.toC(k.(map[string]interface{}), 0), g.jsonValue(vals[i]))
+		}
+		return code
+	case "List", "Tuple":
+		code := "py_json_new(PY_JSON_LIST)"
+		for _, e := range m["elts"].([]interface{}) {
+			code = fmt.Sprintf("py_json_append(%s, %s)", code, g.jsonValue(e))
+		}
+		return code
+	case "Constant":
+		switch v := m["value"].(type) {
+		case nil:
+			return "py_json_new(PY_JSON_NULL)"
+		case bool:
+			if v {
+				return "py_json_bool(1)"
+			}
+			return "py_json_bool(0)"
+		}
+	}
+	if code := g.jsonElem(g.getType(m), g.toC(m, 0), g.isIntExpr(m)); code != "" {
+		return code
+	}
+	return "py_json_new(PY_JSON_NULL) " + g.unsupportedExpr(m, "JSON value: "+g.getType(m))
+}
+
+// jsonCall: json.loads / json.load / json.dumps / json.dump
+func (g *generator) jsonCall(qname string, node ASTNode) string {
+	args, _ := node["args"].([]interface{})
+	g.jsonRuntime()
+	if len(args) == 0 {
+		return g.unsupportedExpr(node, fmt.Sprintf("call: %s()", qname))
+	}
+	arg := args[0].(map[string]interface{})
+	switch qname {
+	case "json.loads":
+		return g.rcHold("PyJson*", fmt.Sprintf("py_json_loads(%s)", g.toC(arg, 0)))
+	case "json.load":
+		g.fileRuntime()
+		text := g.rcHold("char*", fmt.Sprintf("py_file_read(%s, -1)", g.toC(arg, 0)))
+		return g.rcHold("PyJson*", fmt.Sprintf("py_json_loads(%s)", text))
+	}
+	// dumps：PyJson 值直接输出，其他值先构造成临时的 PyJson
+	v := ""
+	if g.getType(arg) == "PyJson*" {
+		v = g.toC(arg, 0)
+	} else {
+		v = g.rcHold("PyJson*", g.jsonValue(arg))
+	}
+	indent := "-1"
+	if kw := callKeyword(node, "indent"); kw != nil && !(kw["_type"] == "Constant" && kw["value"] == nil) {
+		indent = g.toC(kw, 0)
+	}
+	text := g.rcHold("char*", fmt.Sprintf("py_json_dumps(%s, %s)", v, indent))
+	if qname == "json.dump" {
+		if len(args) < 2 {
+			return g.unsupportedExpr(node, "call: json.dump expects a file")
+		}
+		return fmt.Sprintf("fputs(%s, %s)", text, g.toC(args[1].(map[string]interface{}), 0))
+	}
+	return text
+}
+
+// handleJsonMethodCall: d.get(key[, default]) / xs.append(v)
+func (g *generator) handleJsonMethodCall(fn, call map[string]interface{}) (string, bool) {
+	if g.getType(fn["value"]) != "PyJson*" {
+		return "", false
+	}
+	j := g.toC(fn["value"].(map[string]interface{}), 0)
+	args, _ := call["args"].([]interface{})
+	switch {
+	case fn["attr"] == "get" && len(args) == 1:
+		return fmt.Sprintf("py_json_get_or(%s, %s, NULL)", j, g.toC(args[0].(map[string]interface{}), 0)), true
+	case fn["attr"] == "get" && len(args) == 2:
+		// 默认值是临时构造的，语句结束时释放
+		def := g.rcHold("PyJson*", g.jsonValue(args[1]))
+		return fmt.Sprintf("py_json_get_or(%s, %s, %s)", j, g.toC(args[0].(map[string]interface{}), 0), def), true
+	case fn["attr"] == "append" && len(args) == 1:
+		return fmt.Sprintf("py_json_append(%s, %s)", j, g.jsonValue(args[0])), true
+	}
+	return g.unsupportedExpr(call, fmt.Sprintf("call: JSON value method %v()", fn["attr"])), true
+}
+
+// jsonSubscript: d["key"] / xs[i]，按下标的类型区分对象和列表
+func (g *generator) jsonSubscript(value, slice interface{}) (string, string) {
+	j := g.toC(value.(map[string]interface{}), 0)
+	key := g.toC(slice.(map[string]interface{}), 0)
+	if g.getType(slice) == "char*" {
+		return j, key
+	}
+	if !g.isIntExpr(slice) && g.getType(slice) != "int" {
+		key = fmt.Sprintf("(int)(%s)", key)
+	}
+	return j, key
+}
+
+// handleForJson: for x in d（对象按键，列表按元素）以及 d.keys() / d.values() / d.items()
+func (g *generator) handleForJson(node ASTNode, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	iter := node["iter"].(map[string]interface{})
+	mode := ""
+	if iter["_type"] == "Call" {
+		fn, _ := iter["func"].(map[string]interface{})
+		mode, _ = fn["attr"].(string)
+		iter = fn["value"].(map[string]interface{})
+	}
+	j := g.newTemp("_j")
+	idx := g.newTemp("_i")
+	pre, expr := g.exprWithPre(iter, indent)
+	check := fmt.Sprintf("%spy_json_expect(%s, PY_JSON_OBJ);\n", pad, j)
+	if mode == "" {
+		check = fmt.Sprintf("%spy_json_iterable(%s);\n", pad, j)
+	}
+	g.pushScope(scopeBlock, "for")
+	defer g.popScope()
+	declare := func(target interface{}, t, value string) string {
+		name := g.toC(target.(map[string]interface{}), 0)
+		if g.isDeclared(name) {
+			return fmt.Sprintf("%s    %s = %s;\n", pad, name, value)
+		}
+		g.declareVar(name, t)
+		return fmt.Sprintf("%s    %s %s = %s;\n", pad, t, name, value)
+	}
+	key := fmt.Sprintf("%s->keys[%s]->str", j, idx)
+	item := fmt.Sprintf("%s->items[%s]", j, idx)
+	body := ""
+	target := node["target"].(map[string]interface{})
+	switch mode {
+	case "":
+		body = declare(target, "PyJson*", fmt.Sprintf("py_json_iter(%s, %s)", j, idx))
+	case "keys":
+		body = declare(target, "char*", key)
+	case "values":
+		body = declare(target, "PyJson*", item)
+	case "items":
+		elts, _ := target["elts"].([]interface{})
+		if target["_type"] != "Tuple" || len(elts) != 2 {
+			return pad + g.unsupportedExpr(node, "for loop: items() needs two targets") + "\n"
+		}
+		body = declare(elts[0], "char*", key) + declare(elts[1], "PyJson*", item)
+	default:
+		return pad + g.unsupportedExpr(node, fmt.Sprintf("for loop: JSON value method %s()", mode)) + "\n"
+	}
+	defer g.enterLoop()()
+	body += g.stmtsToC(node["body"], indent+1)
+	return fmt.Sprintf("%s%sPyJson* %s = %s;\n%sfor (int %s = 0; %s < %s->len; %s++) {\n%s%s}\n", pre, pad, j, expr, check, idx, idx, j, idx, body, pad)
+}
+
+// isJSONView: d.keys() / d.values() / d.items()
+func (g *generator) isJSONView(node map[string]interface{}) bool {
+	fn, _ := node["func"].(map[string]interface{})
+	switch fn["attr"] {
+	case "keys", "values", "items":
+		return node["_type"] == "Call" && fn["_type"] == "Attribute" && g.getType(fn["value"]) == "PyJson*"
+	}
+	return false
+}
@@ -0,0 +1,608 @@
+// Package pyast is a typed form of the Python AST written by py2ast.py
+// pyast 包：py2ast.py 输出的 Python AST 的类型化表示。节点与 Python 的 ast 模块一一对应，
+// 字段名按 Go 的习惯改写（decorator_list -> DecoratorList），运算符与 ctx 保存为名字（"Add"、"Load"）
+package pyast
+
+// Pos: 节点在 Python 源码中的位置。行从 1 开始，列与 Python 的 col_offset 一样从 0 开始；没有位置时为 0
+type Pos struct {
+	Line, Col       int
+	EndLine, EndCol int
+}
+
+// Node: 所有节点
+type Node interface {
+	Type() string  // Python 中的节点类型名（"FunctionDef"、"Expr"、"AsyncFor" ...）
+	Position() Pos // 源码位置
+}
+
+// Stmt: 语句
+type Stmt interface {
+	Node
+	stmtNode()
+}
+
+// Expr: 表达式
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// Pattern: match 语句中 case 的模式
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// base: 各节点共有的类型名与位置
+type base struct {
+	typ string
+	Pos
+}
+
+func (b *base) Type() string  { return b.typ }
+func (b *base) Position() Pos { return b.Pos }
+
+// --- 模块与辅助节点 ---
+
+// Module: 整个源文件
+type Module struct {
+	base
+	Body   []Stmt
+	Source string // py2ast.py 附带的源码文本，旧的 JSON 没有
+
+	Version Version // 输出 AST 的 Python 版本，见 DetectVersion
+}
+
+// Arguments: 函数的形参
+type Arguments struct {
+	base
+	PosOnlyArgs []*Arg
+	Args        []*Arg
+	Vararg      *Arg // *args，没有为 nil
+	KwOnlyArgs  []*Arg
+	KwDefaults  []Expr // 与 KwOnlyArgs 对应，没有默认值的为 nil
+	Kwarg       *Arg   // **kwargs，没有为 nil
+	Defaults    []Expr // 最后 len(Defaults) 个位置参数的默认值
+}
+
+// Arg: 一个形参
+type Arg struct {
+	base
+	Arg        string
+	Annotation Expr
+}
+
+// Keyword: 调用或类定义中的关键字参数；Arg 为空时是 **value
+type Keyword struct {
+	base
+	Arg   string
+	Value Expr
+}
+
+// Alias: import 的一个名字
+type Alias struct {
+	base
+	Name   string
+	Asname string
+}
+
+// Comprehension: 推导式中的一个 for 子句
+type Comprehension struct {
+	base
+	Target  Expr
+	Iter    Expr
+	Ifs     []Expr
+	IsAsync bool
+}
+
+// ExceptHandler: except 子句；ExcType（JSON 中的 type）为 nil 时是裸 except
+type ExceptHandler struct {
+	base
+	ExcType Expr
+	Name    string
+	Body    []Stmt
+}
+
+// WithItem: with 语句中的一项
+type WithItem struct {
+	base
+	ContextExpr  Expr
+	OptionalVars Expr
+}
+
+// MatchCase: match 语句的一个 case
+type MatchCase struct {
+	base
+	Pattern Pattern
+	Guard   Expr
+	Body    []Stmt
+}
+
+// Unknown: 本包不认识的节点类型（更新的 Python 版本），保留原始字段；可以出现在语句、表达式与模式的位置
+type Unknown struct {
+	base
+	Fields map[string]interface{}
+}
+
+// --- 语句 ---
+
+// FunctionDef: def 与 async def（Async）
+type FunctionDef struct {
+	base
+	Name          string
+	Args          *Arguments
+	Body          []Stmt
+	DecoratorList []Expr
+	Returns       Expr
+	Async         bool
+}
+
+// ClassDef: class 定义
+type ClassDef struct {
+	base
+	Name          string
+	Bases         []Expr
+	Keywords      []*Keyword
+	Body          []Stmt
+	DecoratorList []Expr
+}
+
+// Return: return 语句，Value 可以为 nil
+type Return struct {
+	base
+	Value Expr
+}
+
+// Delete: del 语句
+type Delete struct {
+	base
+	Targets []Expr
+}
+
+// Assign: a = b = value
+type Assign struct {
+	base
+	Targets []Expr
+	Value   Expr
+}
+
+// AugAssign: a += value
+type AugAssign struct {
+	base
+	Target Expr
+	Op     string
+	Value  Expr
+}
+
+// AnnAssign: a: T = value，Value 可以为 nil
+type AnnAssign struct {
+	base
+	Target     Expr
+	Annotation Expr
+	Value      Expr
+	Simple     bool
+}
+
+// For: for 与 async for（Async）
+type For struct {
+	base
+	Target Expr
+	Iter   Expr
+	Body   []Stmt
+	Orelse []Stmt
+	Async  bool
+}
+
+// While: while 循环
+type While struct {
+	base
+	Test   Expr
+	Body   []Stmt
+	Orelse []Stmt
+}
+
+// If: if 语句，elif 是 Orelse 中唯一的 If
+type If struct {
+	base
+	Test   Expr
+	Body   []Stmt
+	Orelse []Stmt
+}
+
+// With: with 与 async with（Async）
+type With struct {
+	base
+	Items []*WithItem
+	Body  []Stmt
+	Async bool
+}
+
+// Match: match 语句
+type Match struct {
+	base
+	Subject Expr
+	Cases   []*MatchCase
+}
+
+// Raise: raise 语句，Exc 为 nil 时重新抛出
+type Raise struct {
+	base
+	Exc   Expr
+	Cause Expr
+}
+
+// Try: try 与 try/except*（Star）
+type Try struct {
+	base
+	Body      []Stmt
+	Handlers  []*ExceptHandler
+	Orelse    []Stmt
+	Finalbody []Stmt
+	Star      bool
+}
+
+// Assert: assert 语句
+type Assert struct {
+	base
+	Test Expr
+	Msg  Expr
+}
+
+// Import: import a, b as c
+type Import struct {
+	base
+	Names []*Alias
+}
+
+// ImportFrom: from module import names；Level 是相对 import 的点数
+type ImportFrom struct {
+	base
+	Module string
+	Names  []*Alias
+	Level  int
+}
+
+// Global: global 语句
+type Global struct {
+	base
+	Names []string
+}
+
+// Nonlocal: nonlocal 语句
+type Nonlocal struct {
+	base
+	Names []string
+}
+
+// ExprStmt: 表达式语句（Python 中的 Expr）
+type ExprStmt struct {
+	base
+	Value Expr
+}
+
+// Pass: pass
+type Pass struct{ base }
+
+// Break: break
+type Break struct{ base }
+
+// Continue: continue
+type Continue struct{ base }
+
+// --- 表达式 ---
+
+// BoolOp: a and b and c
+type BoolOp struct {
+	base
+	Op     string
+	Values []Expr
+}
+
+// NamedExpr: (target := value)
+type NamedExpr struct {
+	base
+	Target Expr
+	Value  Expr
+}
+
+// BinOp: 二元运算
+type BinOp struct {
+	base
+	Left  Expr
+	Op    string
+	Right Expr
+}
+
+// UnaryOp: 一元运算
+type UnaryOp struct {
+	base
+	Op      string
+	Operand Expr
+}
+
+// Lambda: lambda 表达式
+type Lambda struct {
+	base
+	Args *Arguments
+	Body Expr
+}
+
+// IfExp: body if test else orelse
+type IfExp struct {
+	base
+	Test   Expr
+	Body   Expr
+	Orelse Expr
+}
+
+// Dict: 字典字面量；**d 展开时对应的 Keys 元素为 nil
+type Dict struct {
+	base
+	Keys   []Expr
+	Values []Expr
+}
+
+// Set: 集合字面量
+type Set struct {
+	base
+	Elts []Expr
+}
+
+// ListComp: 列表推导式
+type ListComp struct {
+	base
+	Elt        Expr
+	Generators []*Comprehension
+}
+
+// SetComp: 集合推导式
+type SetComp struct {
+	base
+	Elt        Expr
+	Generators []*Comprehension
+}
+
+// DictComp: 字典推导式
+type DictComp struct {
+	base
+	Key        Expr
+	Value      Expr
+	Generators []*Comprehension
+}
+
+// GeneratorExp: 生成器表达式
+type GeneratorExp struct {
+	base
+	Elt        Expr
+	Generators []*Comprehension
+}
+
+// Await: await value
+type Await struct {
+	base
+	Value Expr
+}
+
+// Yield: yield value，Value 可以为 nil
+type Yield struct {
+	base
+	Value Expr
+}
+
+// YieldFrom: yield from value
+type YieldFrom struct {
+	base
+	Value Expr
+}
+
+// Compare: a < b <= c，Ops 与 Comparators 一一对应
+type Compare struct {
+	base
+	Left        Expr
+	Ops         []string
+	Comparators []Expr
+}
+
+// Call: 函数调用
+type Call struct {
+	base
+	Func     Expr
+	Args     []Expr
+	Keywords []*Keyword
+}
+
+// FormattedValue: f-string 中的 {value!conversion:format_spec}；Conversion 为 -1 时没有转换
+type FormattedValue struct {
+	base
+	Value      Expr
+	Conversion int
+	FormatSpec Expr
+}
+
+// JoinedStr: f-string
+type JoinedStr struct {
+	base
+	Values []Expr
+}
+
+// Constant: 常量。Value 是 string、bool、nil、json.Number（数字保留原文）或 Ellipsis
+type Constant struct {
+	base
+	Value interface{}
+	Kind  string // "u" 前缀的字符串为 "u"
+}
+
+// Ellipsis: Constant 的值为 ...
+type Ellipsis struct{}
+
+// Attribute: value.attr
+type Attribute struct {
+	base
+	Value Expr
+	Attr  string
+	Ctx   string
+}
+
+// Subscript: value[slice]
+type Subscript struct {
+	base
+	Value Expr
+	Slice Expr
+	Ctx   string
+}
+
+// Starred: *value
+type Starred struct {
+	base
+	Value Expr
+	Ctx   string
+}
+
+// Name: 名字；Ctx 为 "Load"、"Store" 或 "Del"
+type Name struct {
+	base
+	ID  string
+	Ctx string
+}
+
+// List: 列表字面量
+type List struct {
+	base
+	Elts []Expr
+	Ctx  string
+}
+
+// Tuple: 元组
+type Tuple struct {
+	base
+	Elts []Expr
+	Ctx  string
+}
+
+// Slice: lower:upper:step，各部分可以为 nil
+type Slice struct {
+	base
+	Lower Expr
+	Upper Expr
+	Step  Expr
+}
+
+// --- 模式 ---
+
+// MatchValue: case 常量或属性
+type MatchValue struct {
+	base
+	Value Expr
+}
+
+// MatchSingleton: case None / True / False
+type MatchSingleton struct {
+	base
+	Value interface{}
+}
+
+// MatchSequence: case [a, b, *rest]
+type MatchSequence struct {
+	base
+	Patterns []Pattern
+}
+
+// MatchMapping: case {"k": p, **rest}
+type MatchMapping struct {
+	base
+	Keys     []Expr
+	Patterns []Pattern
+	Rest     string
+}
+
+// MatchClass: case Point(x, y=p)
+type MatchClass struct {
+	base
+	Cls         Expr
+	Patterns    []Pattern
+	KwdAttrs    []string
+	KwdPatterns []Pattern
+}
+
+// MatchStar: 序列模式中的 *name（Name 为空时是 *_）
+type MatchStar struct {
+	base
+	Name string
+}
+
+// MatchAs: case p as name；Pattern 为 nil 时是捕获模式，二者都为空时是 _
+type MatchAs struct {
+	base
+	Pattern Pattern
+	Name    string
+}
+
+// MatchOr: case p1 | p2
+type MatchOr struct {
+	base
+	Patterns []Pattern
+}
+
+func (*FunctionDef) stmtNode() {}
+func (*ClassDef) stmtNode()    {}
+func (*Return) stmtNode()      {}
+func (*Delete) stmtNode()      {}
+func (*Assign) stmtNode()      {}
+func (*AugAssign) stmtNode()   {}
+func (*AnnAssign) stmtNode()   {}
+func (*For) stmtNode()         {}
+func (*While) stmtNode()       {}
+func (*If) stmtNode()          {}
+func (*With) stmtNode()        {}
+func (*Match) stmtNode()       {}
+func (*Raise) stmtNode()       {}
+func (*Try) stmtNode()         {}
+func (*Assert) stmtNode()      {}
+func (*Import) stmtNode()      {}
+func (*ImportFrom) stmtNode()  {}
+func (*Global) stmtNode()      {}
+func (*Nonlocal) stmtNode()    {}
+func (*ExprStmt) stmtNode()    {}
+func (*Pass) stmtNode()        {}
+func (*Break) stmtNode()       {}
+func (*Continue) stmtNode()    {}
+func (*Unknown) stmtNode()     {}
+
+func (*BoolOp) exprNode()         {}
+func (*NamedExpr) exprNode()      {}
+func (*BinOp) exprNode()          {}
+func (*UnaryOp) exprNode()        {}
+func (*Lambda) exprNode()         {}
+func (*IfExp) exprNode()          {}
+func (*Dict) exprNode()           {}
+func (*Set) exprNode()            {}
+func (*ListComp) exprNode()       {}
+func (*SetComp) exprNode()        {}
+func (*DictComp) exprNode()       {}
+func (*GeneratorExp) exprNode()   {}
+func (*Await) exprNode()          {}
+func (*Yield) exprNode()          {}
+func (*YieldFrom) exprNode()      {}
+func (*Compare) exprNode()        {}
+func (*Call) exprNode()           {}
+func (*FormattedValue) exprNode() {}
+func (*JoinedStr) exprNode()      {}
+func (*Constant) exprNode()       {}
+func (*Attribute) exprNode()      {}
+func (*Subscript) exprNode()      {}
+func (*Starred) exprNode()        {}
+func (*Name) exprNode()           {}
+func (*List) exprNode()           {}
+func (*Tuple) exprNode()          {}
+func (*Slice) exprNode()          {}
+func (*Unknown) exprNode()        {}
+
+func (*MatchValue) patternNode()     {}
+func (*MatchSingleton) patternNode() {}
+func (*MatchSequence) patternNode()  {}
+func (*MatchMapping) patternNode()   {}
+func (*MatchClass) patternNode()     {}
+func (*MatchStar) patternNode()      {}
+func (*MatchAs) patternNode()        {}
+func (*MatchOr) patternNode()        {}
+func (*Unknown) patternNode()        {}
@@ -0,0 +1,740 @@
+package pyast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Parse: 解析 py2ast.py 输出的 JSON，或者 ast.dump() 的文本（见 DecodeDump）。结构不对时返回的错误给出字段路径与源码行号，
+// 如 body[2].value (line 3): expected 'value' expression at Assign, got a list
+func Parse(data []byte) (*Module, error) {
+	if IsDump(data) {
+		raw, err := DecodeDump(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return FromMap(raw)
+	}
+	return Decode(bytes.NewReader(data))
+}
+
+// UnmarshalJSON: 按各节点的 _type 构造对应的类型；数字保留原文（json.Number）。用 Decode 逐条语句转换
+func (m *Module) UnmarshalJSON(data []byte) error {
+	mod, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	*m = *mod
+	return nil
+}
+
+// FromMap: 从已经解析为 map 的 JSON 构造 Module。旧版本 Python 的节点先在 raw 中就地换成现在的形式（见 Normalize）
+func FromMap(raw map[string]interface{}) (*Module, error) {
+	version, err := Normalize(raw)
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{}
+	o := d.object(raw, site{}, "Module")
+	if o == nil {
+		return nil, d.err
+	}
+	m := &Module{base: o.base(), Body: o.stmts("body")}
+	m.Source, _ = raw["source"].(string)
+	m.Version = version
+	if d.err != nil {
+		return nil, d.err
+	}
+	return m, nil
+}
+
+// decoder: 记下第一个错误，之后的转换都返回零值
+type decoder struct {
+	err error
+}
+
+// object: 一个 JSON 对象形式的节点
+type object struct {
+	d    *decoder
+	m    map[string]interface{}
+	typ  string
+	path string
+	pos  Pos
+	near Pos // 错误信息用的位置：自己没有位置时是所在节点的
+}
+
+// site: 值所在的位置：字段路径（body[2].value）、字段名与所在节点的类型（Assign 的 value），以及所在节点的源码位置
+type site struct {
+	path, field, owner string
+	element            bool // 列表字段中的元素
+	at                 Pos
+}
+
+// fail: 记下第一个错误，如 body[2].value (line 3): expected 'value' expression at Assign, got a list。
+// pos 没有行号时用所在节点的；got 为空时是字段缺失
+func (d *decoder) fail(s site, pos Pos, what, got string) {
+	if d.err != nil {
+		return
+	}
+	where := s.path
+	if where == "" {
+		where = "module"
+	}
+	if pos.Line == 0 {
+		pos = s.at
+	}
+	if pos.Line > 0 {
+		where += fmt.Sprintf(" (line %d)", pos.Line)
+	}
+	msg := "expected " + what
+	switch {
+	case s.owner == "":
+	case s.element:
+		msg = fmt.Sprintf("expected %s in '%s' at %s", what, s.field, s.owner)
+	default:
+		msg = fmt.Sprintf("expected '%s' %s at %s", s.field, what, s.owner)
+	}
+	if got != "" {
+		msg += ", got " + got
+	}
+	d.err = fmt.Errorf("%s: %s", where, msg)
+}
+
+// object: 检查 v 是带 _type 的对象；want 非空时类型必须是它
+func (d *decoder) object(v interface{}, s site, want string) *object {
+	if d.err != nil {
+		return nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		d.fail(s, Pos{}, nodeKind(want), kindOf(v))
+		return nil
+	}
+	typ, ok := m["_type"].(string)
+	if !ok {
+		d.fail(s, Pos{}, nodeKind(want), kindOf(v))
+		return nil
+	}
+	o := &object{d: d, m: m, typ: typ, path: s.path}
+	o.pos = Pos{Line: o.optInt("lineno"), Col: o.optInt("col_offset"), EndLine: o.optInt("end_lineno"), EndCol: o.optInt("end_col_offset")}
+	if o.near = o.pos; o.near.Line == 0 {
+		o.near = s.at
+	}
+	if want != "" && typ != want {
+		d.fail(s, o.pos, nodeKind(want), typ)
+		return nil
+	}
+	return o
+}
+
+func (o *object) base() base { return base{typ: o.typ, Pos: o.pos} }
+
+// field: 字段的路径，用于错误信息
+func (o *object) field(name string) string {
+	if o.path == "" {
+		return name
+	}
+	return o.path + "." + name
+}
+
+// at: 字段 name 的位置；at(name, i) 是列表字段的第 i 个元素
+func (o *object) at(name string, index ...int) site {
+	path := o.field(name)
+	for _, i := range index {
+		path += fmt.Sprintf("[%d]", i)
+	}
+	return site{path: path, field: name, owner: o.typ, element: len(index) > 0, at: o.near}
+}
+
+func (o *object) fail(name, what, got string) {
+	o.d.fail(o.at(name), o.pos, what, got)
+}
+
+// list: 列表字段，Python 的 AST 中总是有（可以为空）
+func (o *object) list(name string) []interface{} {
+	v, present := o.m[name]
+	if !present {
+		if !newerFields[name] {
+			o.fail(name, "list", "")
+		}
+		return nil
+	}
+	l, ok := v.([]interface{})
+	if !ok {
+		o.fail(name, "list", kindOf(v))
+	}
+	return l
+}
+
+func (o *object) str(name string) string {
+	v := o.m[name]
+	if v == nil {
+		return ""
+	}
+	s, ok := v.(string)
+	if !ok {
+		o.fail(name, "string", kindOf(v))
+	}
+	return s
+}
+
+// required: 必须有的字符串字段（名字、属性名）
+func (o *object) required(name string) string {
+	if _, ok := o.m[name].(string); !ok && o.d.err == nil {
+		o.fail(name, "string", kindOf(o.m[name]))
+		return ""
+	}
+	return o.str(name)
+}
+
+// block: 语句块，Python 中至少有一条语句
+func (o *object) block(name string) []Stmt {
+	o.nonEmpty(name)
+	return o.stmts(name)
+}
+
+// nonEmpty: Python 的 AST 中不会为空的列表（语句块、Assign.targets、BoolOp.values ...）
+func (o *object) nonEmpty(name string) {
+	if v, ok := o.m[name].([]interface{}); ok && len(v) == 0 {
+		o.fail(name, "non-empty list", "an empty list")
+	}
+}
+
+// sameLength: 一一对应的两个列表字段（Compare.ops 与 comparators、Dict.keys 与 values）
+func (o *object) sameLength(a, b string) {
+	la, _ := o.m[a].([]interface{})
+	lb, okb := o.m[b].([]interface{})
+	if okb && len(la) != len(lb) {
+		o.fail(b, fmt.Sprintf("list as long as '%s' (%d)", a, len(la)), fmt.Sprintf("%d elements", len(lb)))
+	}
+}
+
+func (o *object) strs(name string) []string {
+	var out []string
+	for i, v := range o.list(name) {
+		s, ok := v.(string)
+		if !ok {
+			o.d.fail(o.at(name, i), o.pos, "string", kindOf(v))
+			return nil
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func (o *object) optInt(name string) int {
+	switch v := o.m[name].(type) {
+	case json.Number:
+		n, _ := strconv.Atoi(string(v))
+		return n
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+func (o *object) boolean(name string) bool {
+	switch v := o.m[name].(type) {
+	case bool:
+		return v
+	case json.Number:
+		return v != "0"
+	case float64:
+		return v != 0
+	}
+	return false
+}
+
+// op: 必须有的运算符
+func (o *object) op(name string) string {
+	if v, ok := o.m[name]; v == nil {
+		got := ""
+		if ok {
+			got = "null"
+		}
+		o.fail(name, "operator", got)
+		return ""
+	}
+	return o.name(name)
+}
+
+// name: 运算符或 ctx 这样只有类型名的节点
+func (o *object) name(name string) string {
+	v := o.m[name]
+	if v == nil {
+		return ""
+	}
+	c := o.d.object(v, o.at(name), "")
+	if c == nil {
+		return ""
+	}
+	return c.typ
+}
+
+func (o *object) names(name string) []string {
+	var out []string
+	for i, v := range o.list(name) {
+		c := o.d.object(v, o.at(name, i), "")
+		if c == nil {
+			return nil
+		}
+		out = append(out, c.typ)
+	}
+	return out
+}
+
+// expr: 必须有的表达式字段
+func (o *object) expr(name string) Expr {
+	if o.m[name] == nil && o.d.err == nil {
+		o.fail(name, "expression", "")
+		return nil
+	}
+	return o.optExpr(name)
+}
+
+// optExpr: 可以为 null 的表达式字段
+func (o *object) optExpr(name string) Expr {
+	v := o.m[name]
+	if v == nil {
+		return nil
+	}
+	return o.d.expr(v, o.at(name))
+}
+
+// exprs: 表达式列表；allowNil 时元素可以为 null（Dict.keys、kw_defaults）
+func (o *object) exprs(name string, allowNil bool) []Expr {
+	var out []Expr
+	for i, v := range o.list(name) {
+		if v == nil && allowNil {
+			out = append(out, nil)
+			continue
+		}
+		out = append(out, o.d.expr(v, o.at(name, i)))
+	}
+	return out
+}
+
+func (o *object) stmts(name string) []Stmt {
+	var out []Stmt
+	for i, v := range o.list(name) {
+		out = append(out, o.d.stmt(v, o.at(name, i)))
+	}
+	return out
+}
+
+func (o *object) pattern(name string) Pattern {
+	v := o.m[name]
+	if v == nil {
+		return nil
+	}
+	return o.d.pattern(v, o.at(name))
+}
+
+func (o *object) patterns(name string) []Pattern {
+	var out []Pattern
+	for i, v := range o.list(name) {
+		out = append(out, o.d.pattern(v, o.at(name, i)))
+	}
+	return out
+}
+
+func (o *object) arguments(name string) *Arguments {
+	a := o.d.object(o.m[name], o.at(name), "arguments")
+	if a == nil {
+		return nil
+	}
+	return &Arguments{base: a.base(), PosOnlyArgs: a.args("posonlyargs"), Args: a.args("args"), Vararg: a.arg("vararg"),
+		KwOnlyArgs: a.args("kwonlyargs"), KwDefaults: a.exprs("kw_defaults", true), Kwarg: a.arg("kwarg"), Defaults: a.exprs("defaults", false)}
+}
+
+func (o *object) arg(name string) *Arg {
+	if o.m[name] == nil {
+		return nil
+	}
+	return o.d.arg(o.m[name], o.at(name))
+}
+
+func (o *object) args(name string) []*Arg {
+	var out []*Arg
+	for i, v := range o.list(name) {
+		out = append(out, o.d.arg(v, o.at(name, i)))
+	}
+	return out
+}
+
+func (d *decoder) arg(v interface{}, s site) *Arg {
+	a := d.object(v, s, "arg")
+	if a == nil {
+		return nil
+	}
+	return &Arg{base: a.base(), Arg: a.required("arg"), Annotation: a.optExpr("annotation")}
+}
+
+func (o *object) keywords(name string) []*Keyword {
+	var out []*Keyword
+	for i, v := range o.list(name) {
+		k := o.d.object(v, o.at(name, i), "keyword")
+		if k == nil {
+			return nil
+		}
+		out = append(out, &Keyword{base: k.base(), Arg: k.str("arg"), Value: k.expr("value")})
+	}
+	return out
+}
+
+func (o *object) aliases(name string) []*Alias {
+	var out []*Alias
+	for i, v := range o.list(name) {
+		a := o.d.object(v, o.at(name, i), "alias")
+		if a == nil {
+			return nil
+		}
+		out = append(out, &Alias{base: a.base(), Name: a.required("name"), Asname: a.str("asname")})
+	}
+	return out
+}
+
+func (o *object) comprehensions(name string) []*Comprehension {
+	var out []*Comprehension
+	for i, v := range o.list(name) {
+		c := o.d.object(v, o.at(name, i), "comprehension")
+		if c == nil {
+			return nil
+		}
+		out = append(out, &Comprehension{base: c.base(), Target: c.expr("target"), Iter: c.expr("iter"), Ifs: c.exprs("ifs", false), IsAsync: c.boolean("is_async")})
+	}
+	return out
+}
+
+func (o *object) handlers(name string) []*ExceptHandler {
+	var out []*ExceptHandler
+	for i, v := range o.list(name) {
+		h := o.d.object(v, o.at(name, i), "ExceptHandler")
+		if h == nil {
+			return nil
+		}
+		out = append(out, &ExceptHandler{base: h.base(), ExcType: h.optExpr("type"), Name: h.str("name"), Body: h.block("body")})
+	}
+	return out
+}
+
+func (o *object) withItems(name string) []*WithItem {
+	var out []*WithItem
+	for i, v := range o.list(name) {
+		w := o.d.object(v, o.at(name, i), "withitem")
+		if w == nil {
+			return nil
+		}
+		out = append(out, &WithItem{base: w.base(), ContextExpr: w.expr("context_expr"), OptionalVars: w.optExpr("optional_vars")})
+	}
+	return out
+}
+
+func (o *object) cases(name string) []*MatchCase {
+	var out []*MatchCase
+	for i, v := range o.list(name) {
+		c := o.d.object(v, o.at(name, i), "match_case")
+		if c == nil {
+			return nil
+		}
+		out = append(out, &MatchCase{base: c.base(), Pattern: c.pattern("pattern"), Guard: c.optExpr("guard"), Body: c.block("body")})
+	}
+	return out
+}
+
+// stmt: 语句节点
+func (d *decoder) stmt(v interface{}, s site) Stmt {
+	if _, ok := v.(map[string]interface{}); !ok && d.err == nil {
+		d.fail(s, Pos{}, "statement", kindOf(v))
+		return nil
+	}
+	o := d.object(v, s, "")
+	if o == nil {
+		return nil
+	}
+	b := o.base()
+	switch o.typ {
+	case "FunctionDef", "AsyncFunctionDef":
+		return &FunctionDef{base: b, Name: o.required("name"), Args: o.arguments("args"), Body: o.block("body"),
+			DecoratorList: o.exprs("decorator_list", false), Returns: o.optExpr("returns"), Async: o.typ == "AsyncFunctionDef"}
+	case "ClassDef":
+		return &ClassDef{base: b, Name: o.required("name"), Bases: o.exprs("bases", false), Keywords: o.keywords("keywords"),
+			Body: o.block("body"), DecoratorList: o.exprs("decorator_list", false)}
+	case "Return":
+		return &Return{base: b, Value: o.optExpr("value")}
+	case "Delete":
+		o.nonEmpty("targets")
+		return &Delete{base: b, Targets: o.exprs("targets", false)}
+	case "Assign":
+		o.nonEmpty("targets")
+		return &Assign{base: b, Targets: o.exprs("targets", false), Value: o.expr("value")}
+	case "AugAssign":
+		return &AugAssign{base: b, Target: o.expr("target"), Op: o.op("op"), Value: o.expr("value")}
+	case "AnnAssign":
+		return &AnnAssign{base: b, Target: o.expr("target"), Annotation: o.expr("annotation"), Value: o.optExpr("value"), Simple: o.boolean("simple")}
+	case "For", "AsyncFor":
+		return &For{base: b, Target: o.expr("target"), Iter: o.expr("iter"), Body: o.block("body"), Orelse: o.stmts("orelse"), Async: o.typ == "AsyncFor"}
+	case "While":
+		return &While{base: b, Test: o.expr("test"), Body: o.block("body"), Orelse: o.stmts("orelse")}
+	case "If":
+		return &If{base: b, Test: o.expr("test"), Body: o.block("body"), Orelse: o.stmts("orelse")}
+	case "With", "AsyncWith":
+		o.nonEmpty("items")
+		return &With{base: b, Items: o.withItems("items"), Body: o.block("body"), Async: o.typ == "AsyncWith"}
+	case "Match":
+		return &Match{base: b, Subject: o.expr("subject"), Cases: o.cases("cases")}
+	case "Raise":
+		return &Raise{base: b, Exc: o.optExpr("exc"), Cause: o.optExpr("cause")}
+	case "Try", "TryStar":
+		return &Try{base: b, Body: o.block("body"), Handlers: o.handlers("handlers"), Orelse: o.stmts("orelse"), Finalbody: o.stmts("finalbody"), Star: o.typ == "TryStar"}
+	case "Assert":
+		return &Assert{base: b, Test: o.expr("test"), Msg: o.optExpr("msg")}
+	case "Import":
+		o.nonEmpty("names")
+		return &Import{base: b, Names: o.aliases("names")}
+	case "ImportFrom":
+		if level, ok := o.m["level"]; ok && level != nil {
+			if n, err := strconv.Atoi(fmt.Sprint(level)); err != nil || n < 0 {
+				o.fail("level", "non-negative integer", fmt.Sprint(level))
+			}
+		}
+		return &ImportFrom{base: b, Module: o.str("module"), Names: o.aliases("names"), Level: o.optInt("level")}
+	case "Global":
+		return &Global{base: b, Names: o.strs("names")}
+	case "Nonlocal":
+		return &Nonlocal{base: b, Names: o.strs("names")}
+	case "Expr":
+		return &ExprStmt{base: b, Value: o.expr("value")}
+	case "Pass":
+		return &Pass{b}
+	case "Break":
+		return &Break{b}
+	case "Continue":
+		return &Continue{b}
+	}
+	if exprTypes[o.typ] || patternTypes[o.typ] {
+		d.fail(s, o.pos, "statement", o.typ)
+		return nil
+	}
+	return o.unknown()
+}
+
+// expr: 表达式节点
+func (d *decoder) expr(v interface{}, s site) Expr {
+	if _, ok := v.(map[string]interface{}); !ok && d.err == nil {
+		d.fail(s, Pos{}, "expression", kindOf(v))
+		return nil
+	}
+	o := d.object(v, s, "")
+	if o == nil {
+		return nil
+	}
+	b := o.base()
+	switch o.typ {
+	case "BoolOp":
+		o.nonEmpty("values")
+		return &BoolOp{base: b, Op: o.op("op"), Values: o.exprs("values", false)}
+	case "NamedExpr":
+		return &NamedExpr{base: b, Target: o.expr("target"), Value: o.expr("value")}
+	case "BinOp":
+		return &BinOp{base: b, Left: o.expr("left"), Op: o.op("op"), Right: o.expr("right")}
+	case "UnaryOp":
+		return &UnaryOp{base: b, Op: o.op("op"), Operand: o.expr("operand")}
+	case "Lambda":
+		return &Lambda{base: b, Args: o.arguments("args"), Body: o.expr("body")}
+	case "IfExp":
+		return &IfExp{base: b, Test: o.expr("test"), Body: o.expr("body"), Orelse: o.expr("orelse")}
+	case "Dict":
+		o.sameLength("keys", "values")
+		return &Dict{base: b, Keys: o.exprs("keys", true), Values: o.exprs("values", false)}
+	case "Set":
+		return &Set{base: b, Elts: o.exprs("elts", false)}
+	case "ListComp":
+		return &ListComp{base: b, Elt: o.expr("elt"), Generators: o.comprehensions("generators")}
+	case "SetComp":
+		return &SetComp{base: b, Elt: o.expr("elt"), Generators: o.comprehensions("generators")}
+	case "DictComp":
+		return &DictComp{base: b, Key: o.expr("key"), Value: o.expr("value"), Generators: o.comprehensions("generators")}
+	case "GeneratorExp":
+		return &GeneratorExp{base: b, Elt: o.expr("elt"), Generators: o.comprehensions("generators")}
+	case "Await":
+		return &Await{base: b, Value: o.expr("value")}
+	case "Yield":
+		return &Yield{base: b, Value: o.optExpr("value")}
+	case "YieldFrom":
+		return &YieldFrom{base: b, Value: o.expr("value")}
+	case "Compare":
+		o.nonEmpty("ops")
+		o.sameLength("ops", "comparators")
+		return &Compare{base: b, Left: o.expr("left"), Ops: o.names("ops"), Comparators: o.exprs("comparators", false)}
+	case "Call":
+		return &Call{base: b, Func: o.expr("func"), Args: o.exprs("args", false), Keywords: o.keywords("keywords")}
+	case "FormattedValue":
+		conv := -1
+		if _, ok := o.m["conversion"]; ok {
+			conv = o.optInt("conversion")
+		}
+		return &FormattedValue{base: b, Value: o.expr("value"), Conversion: conv, FormatSpec: o.optExpr("format_spec")}
+	case "JoinedStr":
+		return &JoinedStr{base: b, Values: o.exprs("values", false)}
+	case "Constant":
+		return &Constant{base: b, Value: d.constant(o.m["value"]), Kind: o.str("kind")}
+	case "Attribute":
+		return &Attribute{base: b, Value: o.expr("value"), Attr: o.required("attr"), Ctx: o.name("ctx")}
+	case "Subscript":
+		return &Subscript{base: b, Value: o.expr("value"), Slice: o.expr("slice"), Ctx: o.name("ctx")}
+	case "Starred":
+		return &Starred{base: b, Value: o.expr("value"), Ctx: o.name("ctx")}
+	case "Name":
+		return &Name{base: b, ID: o.required("id"), Ctx: o.name("ctx")}
+	case "List":
+		return &List{base: b, Elts: o.exprs("elts", false), Ctx: o.name("ctx")}
+	case "Tuple":
+		return &Tuple{base: b, Elts: o.exprs("elts", false), Ctx: o.name("ctx")}
+	case "Slice":
+		return &Slice{base: b, Lower: o.optExpr("lower"), Upper: o.optExpr("upper"), Step: o.optExpr("step")}
+	}
+	if stmtTypes[o.typ] || patternTypes[o.typ] {
+		d.fail(s, o.pos, "expression", o.typ)
+		return nil
+	}
+	return o.unknown()
+}
+
+// pattern: match 的模式
+func (d *decoder) pattern(v interface{}, s site) Pattern {
+	if _, ok := v.(map[string]interface{}); !ok && d.err == nil {
+		d.fail(s, Pos{}, "pattern", kindOf(v))
+		return nil
+	}
+	o := d.object(v, s, "")
+	if o == nil {
+		return nil
+	}
+	b := o.base()
+	switch o.typ {
+	case "MatchValue":
+		return &MatchValue{base: b, Value: o.expr("value")}
+	case "MatchSingleton":
+		return &MatchSingleton{base: b, Value: d.constant(o.m["value"])}
+	case "MatchSequence":
+		return &MatchSequence{base: b, Patterns: o.patterns("patterns")}
+	case "MatchMapping":
+		return &MatchMapping{base: b, Keys: o.exprs("keys", false), Patterns: o.patterns("patterns"), Rest: o.str("rest")}
+	case "MatchClass":
+		return &MatchClass{base: b, Cls: o.expr("cls"), Patterns: o.patterns("patterns"), KwdAttrs: o.strs("kwd_attrs"), KwdPatterns: o.patterns("kwd_patterns")}
+	case "MatchStar":
+		return &MatchStar{base: b, Name: o.str("name")}
+	case "MatchAs":
+		return &MatchAs{base: b, Pattern: o.pattern("pattern"), Name: o.str("name")}
+	case "MatchOr":
+		return &MatchOr{base: b, Patterns: o.patterns("patterns")}
+	}
+	if stmtTypes[o.typ] || exprTypes[o.typ] {
+		d.fail(s, o.pos, "pattern", o.typ)
+		return nil
+	}
+	return o.unknown()
+}
+
+// unknown: 不认识的节点保留原始字段，其中认识的子节点照样检查：代码生成会遍历节点的所有字段
+func (o *object) unknown() *Unknown {
+	keys := make([]string, 0, len(o.m))
+	for k := range o.m {
+		if k != "_type" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		o.d.child(o.m[k], o.at(k))
+	}
+	return &Unknown{base: o.base(), Fields: o.m}
+}
+
+// child: Unknown 的字段值：认识的语句、表达式与模式按种类检查，其他节点检查它们的字段，列表逐个检查
+func (d *decoder) child(v interface{}, s site) {
+	switch v := v.(type) {
+	case []interface{}:
+		for i, e := range v {
+			d.child(e, site{path: fmt.Sprintf("%s[%d]", s.path, i), field: s.field, owner: s.owner, element: true, at: s.at})
+		}
+	case map[string]interface{}:
+		typ, _ := v["_type"].(string)
+		switch {
+		case stmtTypes[typ]:
+			d.stmt(v, s)
+		case exprTypes[typ]:
+			d.expr(v, s)
+		case patternTypes[typ]:
+			d.pattern(v, s)
+		case typ != "":
+			if o := d.object(v, s, ""); o != nil {
+				o.unknown()
+			}
+		}
+	}
+}
+
+// constant: Constant 的值；py2ast.py 把 ... 写成 {"_type": "Ellipsis"}
+func (d *decoder) constant(v interface{}) interface{} {
+	if m, ok := v.(map[string]interface{}); ok && m["_type"] == "Ellipsis" {
+		return Ellipsis{}
+	}
+	return v
+}
+
+// newerFields: 较新的 Python 版本才有的列表字段，旧版本输出的 JSON 中可以没有
+var newerFields = map[string]bool{"posonlyargs": true, "type_ignores": true, "type_params": true}
+
+var stmtTypes = map[string]bool{
+	"FunctionDef": true, "AsyncFunctionDef": true, "ClassDef": true, "Return": true, "Delete": true, "Assign": true,
+	"AugAssign": true, "AnnAssign": true, "For": true, "AsyncFor": true, "While": true, "If": true, "With": true,
+	"AsyncWith": true, "Match": true, "Raise": true, "Try": true, "TryStar": true, "Assert": true, "Import": true,
+	"ImportFrom": true, "Global": true, "Nonlocal": true, "Expr": true, "Pass": true, "Break": true, "Continue": true,
+}
+
+var exprTypes = map[string]bool{
+	"BoolOp": true, "NamedExpr": true, "BinOp": true, "UnaryOp": true, "Lambda": true, "IfExp": true, "Dict": true,
+	"Set": true, "ListComp": true, "SetComp": true, "DictComp": true, "GeneratorExp": true, "Await": true, "Yield": true,
+	"YieldFrom": true, "Compare": true, "Call": true, "FormattedValue": true, "JoinedStr": true, "Constant": true,
+	"Attribute": true, "Subscript": true, "Starred": true, "Name": true, "List": true, "Tuple": true, "Slice": true,
+}
+
+var patternTypes = map[string]bool{
+	"MatchValue": true, "MatchSingleton": true, "MatchSequence": true, "MatchMapping": true, "MatchClass": true,
+	"MatchStar": true, "MatchAs": true, "MatchOr": true,
+}
+
+// kindOf: 错误信息中 JSON 值的种类
+func kindOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("the string %q", v)
+	case bool:
+		return "a boolean"
+	case json.Number, float64:
+		return "a number"
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}:
+		if t, ok := v["_type"].(string); ok {
+			return t
+		}
+		return "an object without _type"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// nodeKind: 错误信息中期望的节点："node"、"arguments node"
+func nodeKind(typ string) string {
+	if typ == "" {
+		return "node"
+	}
+	return typ + " node"
+}
@@ -0,0 +1,343 @@
+package pyast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseExample(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn, ok := m.Body[0].(*FunctionDef)
+	if !ok || fn.Name != "add" || len(fn.Args.Args) != 2 || fn.Position().Line != 1 {
+		t.Fatalf("first statement: %#v", m.Body[0])
+	}
+	ret := fn.Body[0].(*Return).Value.(*BinOp)
+	if ret.Op != "Add" || ret.Left.(*Name).ID != "x" || ret.Left.(*Name).Ctx != "Load" {
+		t.Errorf("return value: %#v", ret)
+	}
+	// 每个节点都访问到，且访问完子节点后有一次 Visit(nil)
+	nodes, ends := 0, 0
+	Inspect(m, func(n Node) bool {
+		if n == nil {
+			ends++
+		} else {
+			nodes++
+		}
+		return true
+	})
+	if nodes < 50 || nodes != ends {
+		t.Errorf("Inspect visited %d nodes and %d ends", nodes, ends)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, c := range []struct{ json, want string }{
+		{`[1]`, "expected a JSON object, got a list"},
+		{`{"_type": "Expr"}`, "module: expected Module node, got Expr"},
+		{`{"_type": "Module"}`, "body: expected 'body' list at Module"},
+		{`{"_type": "Module", "body": [{"_type": "Assign", "targets": [{"_type": "Name", "id": "x"}], "value": [1], "lineno": 3}]}`,
+			"body[0].value (line 3): expected 'value' expression at Assign, got a list"},
+		{`{"_type": "Module", "body": [{"_type": "Expr", "lineno": 2, "value": {"_type": "Call", "func": {"_type": "Pass"}, "args": [], "keywords": []}}]}`,
+			"body[0].value.func (line 2): expected 'func' expression at Call, got Pass"},
+		{`{"_type": "Module", "body": [{"_type": "Name", "id": "x", "lineno": 4}]}`,
+			"body[0] (line 4): expected statement in 'body' at Module, got Name"},
+		{`{"_type": "Module", "body": [{"_type": "Expr", "value": {"_type": "Name", "id": 7}, "lineno": 5}]}`,
+			"body[0].value.id (line 5): expected 'id' string at Name, got a number"},
+		{`{"_type": "Module", "body": [{"_type": "ImportFrom", "module": "m", "names": [], "level": -1, "lineno": 1}]}`,
+			"body[0].level (line 1): expected 'level' non-negative integer at ImportFrom, got -1"},
+		// 不认识的节点中认识的子节点照样检查
+		{`{"_type": "Module", "body": [{"_type": "TypeAlias", "value": {"_type": "Name", "id": ["T"]}, "lineno": 6}]}`,
+			"body[0].value.id (line 6): expected 'id' string at Name, got a list"},
+	} {
+		_, err := Parse([]byte(c.json))
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got error %v, want %q", c.json, err, c.want)
+		}
+	}
+}
+
+// 不认识的节点类型（更新的 Python 版本）保留为 Unknown，而不是报错
+func TestParseUnknown(t *testing.T) {
+	var m Module
+	err := json.Unmarshal([]byte(`{"_type": "Module", "body": [{"_type": "TypeAlias", "name": {"_type": "Name", "id": "T"}, "lineno": 1}]}`), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, ok := m.Body[0].(*Unknown); !ok || u.Type() != "TypeAlias" || u.Position().Line != 1 {
+		t.Errorf("got %#v", m.Body[0])
+	}
+}
+
+// DecodeMap 的结果与 encoding/json 加 UseNumber 相同
+func TestDecodeMap(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, []byte(`{"_type": "Module", "body": [], "s": "tab\there \"q\" \u00e9 \ud83d\ude00", "n": [-1.5e3, 0, true, false, null]}`)...)
+	for _, doc := range bytes.SplitAfter(data, []byte("\n}")) {
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		var want map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(doc))
+		dec.UseNumber()
+		if err := dec.Decode(&want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := DecodeMap(bytes.NewReader(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("DecodeMap differs from encoding/json for %.60s", doc)
+		}
+	}
+	for _, c := range []struct{ json, want string }{
+		{`[1]`, "expected a JSON object, got a list"},
+		{`{"a": 1`, "unexpected end of input in an object"},
+		{`{"a": 1} x`, "unexpected 'x' after the top-level value"},
+		{`{"a": [1 2]}`, "offset 10: unexpected '2' after array element"},
+		{`{"a": "\x"}`, "invalid escape \\x in a string"},
+	} {
+		if _, err := DecodeMap(strings.NewReader(c.json)); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got error %v, want %q", c.json, err, c.want)
+		}
+	}
+}
+
+// Decode 的结果与先解析为 map 再 FromMap 相同，包括要转换旧写法的 AST
+func TestDecode(t *testing.T) {
+	files, _ := filepath.Glob("../testdata/*.json")
+	versions, _ := filepath.Glob("../testdata/versions/*.json")
+	for _, name := range append(files, versions...) {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var raw map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&raw); err != nil {
+			t.Fatal(err)
+		}
+		want, err := FromMap(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Decode differs from FromMap", name)
+		}
+	}
+	// 旧写法在第二条语句：之后的语句等 python_version 确定版本后再转换
+	const late = `{"_type": "Module", "body": [{"_type": "Pass", "lineno": 1}, {"_type": "Expr", "lineno": 2, "value": {"_type": "Num", "n": 1}}]%s}`
+	m, err := Decode(strings.NewReader(fmt.Sprintf(late, "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Body[1].(*ExprStmt).Value.(*Constant); !ok || m.Version != (Version{3, 7}) {
+		t.Errorf("got %#v, version %v", m.Body[1].(*ExprStmt).Value, m.Version)
+	}
+	m, err = Decode(strings.NewReader(fmt.Sprintf(late, `, "python_version": "3.12.1"`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, ok := m.Body[1].(*ExprStmt).Value.(*Unknown); !ok || u.Type() != "Num" {
+		t.Errorf("3.12: got %#v", m.Body[1].(*ExprStmt).Value)
+	}
+}
+
+// largeJSON: testdata/example.json 的语句重复 n 遍，与 py2ast.py 一样缩进两格
+func largeJSON(tb testing.TB, n int) []byte {
+	data, err := ioutil.ReadFile("../testdata/example.json")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var root map[string]interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		tb.Fatal(err)
+	}
+	body := []interface{}{}
+	for i := 0; i < n; i++ {
+		body = append(body, root["body"].([]interface{})...)
+	}
+	root["body"] = body
+	out, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return out
+}
+
+// retained: decode 的结果在垃圾回收之后还占用的堆内存
+func retained(tb testing.TB, decode func() (interface{}, error)) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	v, err := decode()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(v)
+	if after.HeapAlloc < before.HeapAlloc {
+		return 0
+	}
+	return after.HeapAlloc - before.HeapAlloc
+}
+
+// 读整个文件再用 encoding/json 解析为 map 时，文件与 map 同时在内存中；Decode 只留下类型化的 AST，
+// 同样的 JSON 至少少用四倍（实测约六倍）的内存
+func TestDecodeMemory(t *testing.T) {
+	data := largeJSON(t, 100)
+	maps := retained(t, func() (interface{}, error) {
+		var raw map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err := dec.Decode(&raw)
+		return raw, err
+	})
+	typed := retained(t, func() (interface{}, error) { return Decode(bytes.NewReader(data)) })
+	runtime.KeepAlive(data) // data 在两次测量中都要活着
+	old := uint64(len(data)) + maps
+	t.Logf("%d KB of JSON: encoding/json maps %d KB, Decode %d KB", len(data)>>10, maps>>10, typed>>10)
+	if typed == 0 || old < 4*typed {
+		t.Errorf("Decode keeps %d KB, not a quarter of the %d KB of the file and its maps", typed>>10, old>>10)
+	}
+}
+
+// 各种解析方式的用时与解析结果占用的内存（live-MB）：go test -bench Decode ./py2c/pyast
+func BenchmarkDecode(b *testing.B) {
+	data := largeJSON(b, 100)
+	for _, c := range []struct {
+		name   string
+		decode func() (interface{}, error)
+	}{
+		{"encoding/json", func() (interface{}, error) {
+			var raw map[string]interface{}
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.UseNumber()
+			err := dec.Decode(&raw)
+			return raw, err
+		}},
+		{"DecodeMap", func() (interface{}, error) { return DecodeMap(bytes.NewReader(data)) }},
+		{"Decode", func() (interface{}, error) { return Decode(bytes.NewReader(data)) }},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.decode(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(retained(b, c.decode))/(1<<20), "live-MB")
+		})
+	}
+	runtime.KeepAlive(data)
+}
+
+func TestDetectVersion(t *testing.T) {
+	for _, c := range []struct {
+		json     string
+		want     Version
+		explicit bool
+	}{
+		{`{"_type": "Module", "body": [], "python_version": "3.11.7"}`, Version{3, 11}, true},
+		{`{"_type": "Module", "body": [{"_type": "Expr", "value": {"_type": "Num", "n": 1, "lineno": 1}, "lineno": 1}]}`, Version{3, 7}, false},
+		{`{"_type": "Module", "body": [{"_type": "Expr", "value": {"_type": "Subscript", "value": {"_type": "Name", "id": "a"},
+			"slice": {"_type": "Index", "value": {"_type": "Constant", "value": 0}}}, "lineno": 1, "end_lineno": 1}]}`, Version{3, 8}, false},
+		{`{"_type": "Module", "body": [{"_type": "Expr", "value": {"_type": "Subscript", "value": {"_type": "Name", "id": "a"},
+			"slice": {"_type": "Name", "id": "i"}}}]}`, Version{3, 9}, false},
+		{`{"_type": "Module", "body": [{"_type": "TryStar", "body": [], "handlers": [], "orelse": [], "finalbody": []}]}`, Version{3, 11}, false},
+		{`{"_type": "Module", "body": [{"_type": "Pass"}]}`, MinVersion, false},
+	} {
+		var raw map[string]interface{}
+		if err := json.Unmarshal([]byte(c.json), &raw); err != nil {
+			t.Fatal(err)
+		}
+		if v, explicit := DetectVersion(raw); v != c.want || explicit != c.explicit {
+			t.Errorf("%s: got %v (explicit %v), want %v (explicit %v)", c.json, v, explicit, c.want, c.explicit)
+		}
+	}
+}
+
+// 旧的写法换成现在的形式；python_version 写着 3.9 之后的版本时不再转换
+func TestNormalize(t *testing.T) {
+	const sub = `{"_type": "Module", "body": [{"_type": "Expr", "lineno": 1, "value": {"_type": "Subscript", "value": {"_type": "Name", "id": "a"},
+		"slice": {"_type": "ExtSlice", "dims": [{"_type": "Slice"}, {"_type": "Index", "value": {"_type": "Num", "n": 1}}]}}}]%s}`
+	m, err := Parse([]byte(fmt.Sprintf(sub, "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := m.Body[0].(*ExprStmt).Value.(*Subscript)
+	if tup, ok := s.Slice.(*Tuple); !ok || len(tup.Elts) != 2 || tup.Elts[1].(*Constant).Value != json.Number("1") || m.Version != (Version{3, 7}) {
+		t.Errorf("got slice %#v, version %v", s.Slice, m.Version)
+	}
+	m, err = Parse([]byte(fmt.Sprintf(sub, `, "python_version": "3.12.1"`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, ok := m.Body[0].(*ExprStmt).Value.(*Subscript).Slice.(*Unknown); !ok || u.Type() != "ExtSlice" {
+		t.Errorf("3.12: got slice %#v", m.Body[0].(*ExprStmt).Value.(*Subscript).Slice)
+	}
+	if _, err := Parse([]byte(`{"_type": "Module", "body": [], "python_version": "2.7.18"}`)); err == nil {
+		t.Error("Python 2.7: no error")
+	}
+}
+
+func TestDecodeDump(t *testing.T) {
+	// 3.13 的 ast.dump 省略空列表（orelse、keywords）
+	raw, err := DecodeDump(strings.NewReader(`Module(
+  body=[
+    If(test=Constant(value=True), body=[
+      Expr(value=Call(func=Name(id='print', ctx=Load()), args=[Constant(value='it\'s\n\xe9中'), Constant(value=b'\x00\xff'),
+        Constant(value=-2.5e-07), Constant(value=12345678901234567890), Constant(value=Ellipsis), Constant(value=None)]))])],
+  type_ignores=[])`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := FromMap(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := m.Body[0].(*If).Body[0].(*ExprStmt).Value.(*Call)
+	var got []interface{}
+	for _, a := range call.Args {
+		got = append(got, a.(*Constant).Value)
+	}
+	want := []interface{}{"it's\né中", "\x00ÿ", json.Number("-2.5e-07"), json.Number("12345678901234567890"), Ellipsis{}, nil}
+	if !reflect.DeepEqual(got, want) || len(call.Keywords) != 0 || len(m.Body[0].(*If).Orelse) != 0 {
+		t.Errorf("got %#v", got)
+	}
+	for _, c := range []struct{ text, want string }{
+		{`Module(body=[Pass()]`, "line 1, column 21: unexpected end of input"},
+		{`Module([Pass()])`, "expected field=value in Module(...); fields without names (annotate_fields=False) are not supported"},
+		{`Module(body=[Expr(value=Constant(value=1j))])`, "complex constants are not supported"},
+		{"Module(\n  body=[x])", "line 2, column 9: expected a node, got \"x\""},
+	} {
+		if _, err := DecodeDump(strings.NewReader(c.text)); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got error %v, want %q", c.text, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package pyast
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Python 的 ast.dump() 输出的文本：Module(body=[Expr(value=Call(func=Name(id='print', ctx=Load()), ...))], type_ignores=[])。
+// 与 py2ast.py 的 JSON 一样是整棵树，不需要另外的脚本：
+//
+//	python3 -c "import ast, sys; print(ast.dump(ast.parse(open(sys.argv[1]).read()), include_attributes=True))" foo.py | py2c -
+//
+// 字段必须带名字（缺省的 annotate_fields=True）；没有 include_attributes=True 时没有行号，诊断只有文件名。
+// 3.13 起 ast.dump 省略值为 None 与 [] 的字段，列表字段按 listFields 补上
+
+// DecodeDump: 解析 ast.dump() 的文本，结果与 DecodeMap 解析 py2ast.py 的 JSON 相同：节点是带 _type 的 map，
+// 数字是 json.Number，bytes 按 Latin-1 成为字符串，... 是 {"_type": "Ellipsis"}
+func DecodeDump(r io.Reader) (map[string]interface{}, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &dumpParser{src: string(data)}
+	v, err := p.value()
+	if err == nil {
+		if p.skip(); p.pos < len(p.src) {
+			err = p.errorf("unexpected %q after the module", p.src[p.pos])
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	root, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a node such as Module(...), got %s", kindOf(v))
+	}
+	return root, nil
+}
+
+// IsDump: data（去掉开头的空白）像 ast.dump() 的文本而不是 JSON：以节点名开始
+func IsDump(data []byte) bool {
+	s := strings.TrimLeft(string(data), " \t\r\n\ufeff")
+	return s != "" && isIdentStart(s[0])
+}
+
+// listFields: 节点的列表字段；3.13 的 ast.dump 省略空列表，解析时补上。
+// posonlyargs、type_ignores 与 type_params 是较新版本才有的字段（newerFields），不补
+var listFields = map[string][]string{
+	"Module": {"body"}, "Interactive": {"body"},
+	"FunctionDef": {"body", "decorator_list"}, "AsyncFunctionDef": {"body", "decorator_list"},
+	"ClassDef": {"bases", "keywords", "body", "decorator_list"},
+	"Delete":   {"targets"}, "Assign": {"targets"},
+	"For": {"body", "orelse"}, "AsyncFor": {"body", "orelse"}, "While": {"body", "orelse"}, "If": {"body", "orelse"},
+	"With": {"items", "body"}, "AsyncWith": {"items", "body"}, "Match": {"cases"},
+	"Try": {"body", "handlers", "orelse", "finalbody"}, "TryStar": {"body", "handlers", "orelse", "finalbody"},
+	"Import": {"names"}, "ImportFrom": {"names"}, "Global": {"names"}, "Nonlocal": {"names"},
+	"BoolOp": {"values"}, "Dict": {"keys", "values"}, "Set": {"elts"},
+	"ListComp": {"generators"}, "SetComp": {"generators"}, "DictComp": {"generators"}, "GeneratorExp": {"generators"},
+	"Compare": {"ops", "comparators"}, "Call": {"args", "keywords"}, "JoinedStr": {"values"},
+	"List": {"elts"}, "Tuple": {"elts"},
+	"comprehension": {"ifs"}, "ExceptHandler": {"body"}, "match_case": {"body"},
+	"arguments":     {"args", "kwonlyargs", "kw_defaults", "defaults"},
+	"MatchSequence": {"patterns"}, "MatchMapping": {"keys", "patterns"}, "MatchClass": {"patterns", "kwd_attrs", "kwd_patterns"},
+	"MatchOr": {"patterns"},
+}
+
+// dumpParser: ast.dump() 文本的递归下降解析
+type dumpParser struct {
+	src string
+	pos int
+}
+
+// errorf: 错误信息中的位置是行与列（ast.dump 的 indent= 输出有多行）
+func (p *dumpParser) errorf(format string, args ...interface{}) error {
+	line := 1 + strings.Count(p.src[:p.pos], "\n")
+	col := p.pos - strings.LastIndex(p.src[:p.pos], "\n")
+	return fmt.Errorf("line %d, column %d: %s", line, col, fmt.Sprintf(format, args...))
+}
+
+func (p *dumpParser) skip() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	if strings.HasPrefix(p.src[p.pos:], "\ufeff") {
+		p.pos += len("\ufeff")
+		p.skip()
+	}
+}
+
+// accept: 跳过空白后是 c 时读掉它
+func (p *dumpParser) accept(c byte) bool {
+	p.skip()
+	if p.pos < len(p.src) && p.src[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func (p *dumpParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.src) && (isIdentStart(p.src[p.pos]) || '0' <= p.src[p.pos] && p.src[p.pos] <= '9') {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *dumpParser) value() (interface{}, error) {
+	p.skip()
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("unexpected end of input")
+	}
+	c := p.src[p.pos]
+	switch {
+	case c == '[':
+		p.pos++
+		return p.list()
+	case c == '\'' || c == '"':
+		return p.str(false)
+	case c == 'b' && p.pos+1 < len(p.src) && (p.src[p.pos+1] == '\'' || p.src[p.pos+1] == '"'):
+		p.pos++
+		return p.str(true)
+	case c == '-' || '0' <= c && c <= '9':
+		return p.number()
+	case isIdentStart(c):
+		start := p.pos
+		name := p.ident()
+		switch name {
+		case "None":
+			return nil, nil
+		case "True":
+			return true, nil
+		case "False":
+			return false, nil
+		case "Ellipsis":
+			return map[string]interface{}{"_type": "Ellipsis"}, nil
+		case "inf", "nan":
+			p.pos = start
+			return nil, p.errorf("the float %s has no JSON equivalent", name)
+		}
+		if !p.accept('(') {
+			p.pos = start
+			return nil, p.errorf("expected a node, got %q", name)
+		}
+		return p.node(name)
+	case c == '(':
+		return nil, p.errorf("tuple and complex constants are not supported")
+	}
+	return nil, p.errorf("unexpected %q", c)
+}
+
+// node: Name(id='x', ctx=Load()) 的括号中的字段
+func (p *dumpParser) node(typ string) (interface{}, error) {
+	n := map[string]interface{}{"_type": typ}
+	for !p.accept(')') {
+		if p.pos >= len(p.src) {
+			return nil, p.errorf("unexpected end of input")
+		}
+		if len(n) > 1 && !p.accept(',') {
+			return nil, p.errorf("expected ',' or ')' in %s(...)", typ)
+		}
+		if p.accept(')') { // 结尾的逗号
+			break
+		}
+		start := p.pos
+		field := p.ident()
+		if field == "" || !p.accept('=') {
+			p.pos = start
+			return nil, p.errorf("expected field=value in %s(...); fields without names (annotate_fields=False) are not supported", typ)
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		n[field] = v
+	}
+	for _, f := range listFields[typ] {
+		if _, ok := n[f]; !ok {
+			n[f] = []interface{}{}
+		}
+	}
+	return n, nil
+}
+
+func (p *dumpParser) list() (interface{}, error) {
+	l := []interface{}{}
+	for !p.accept(']') {
+		if p.pos >= len(p.src) {
+			return nil, p.errorf("unexpected end of input")
+		}
+		if len(l) > 0 && !p.accept(',') {
+			return nil, p.errorf("expected ',' or ']' in a list")
+		}
+		if p.accept(']') {
+			break
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, v)
+	}
+	return l, nil
+}
+
+// number: repr 写出的整数与浮点数（1、2.5、1e+16），保留原文
+func (p *dumpParser) number() (interface{}, error) {
+	start := p.pos
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) >= 0 {
+		if c := p.src[p.pos]; (c == '+' || c == '-') && p.src[p.pos-1] != 'e' && p.src[p.pos-1] != 'E' {
+			break
+		}
+		p.pos++
+	}
+	text := p.src[start:p.pos]
+	if p.pos < len(p.src) && (p.src[p.pos] == 'j' || p.src[p.pos] == 'J') {
+		return nil, p.errorf("complex constants are not supported")
+	}
+	if _, err := strconv.ParseFloat(text, 64); err != nil {
+		p.pos = start
+		return nil, p.errorf("invalid number %q", text)
+	}
+	return json.Number(text), nil
+}
+
+// str: repr 写出的字符串 '...' 或 "...", bytes 时是 b'...'（\xhh 是一个字节，按 Latin-1 成为字符）
+func (p *dumpParser) str(bytes bool) (interface{}, error) {
+	quote := p.src[p.pos]
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			return nil, p.errorf("unterminated string")
+		}
+		c := p.src[p.pos]
+		if c == quote {
+			p.pos++
+			return b.String(), nil
+		}
+		if c != '\\' {
+			r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+			b.WriteRune(r)
+			p.pos += size
+			continue
+		}
+		if p.pos+1 >= len(p.src) {
+			return nil, p.errorf("unterminated string")
+		}
+		e := p.src[p.pos+1]
+		p.pos += 2
+		switch e {
+		case '\\', '\'', '"':
+			b.WriteByte(e)
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'x', 'u', 'U':
+			digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+			if bytes && e != 'x' || p.pos+digits > len(p.src) {
+				return nil, p.errorf("invalid escape \\%c", e)
+			}
+			n, err := strconv.ParseUint(p.src[p.pos:p.pos+digits], 16, 32)
+			if err != nil || n > utf8.MaxRune {
+				return nil, p.errorf("invalid escape \\%c%s", e, p.src[p.pos:p.pos+digits])
+			}
+			b.WriteRune(rune(n))
+			p.pos += digits
+		default:
+			return nil, p.errorf("invalid escape \\%c", e)
+		}
+	}
+}
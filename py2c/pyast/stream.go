@@ -0,0 +1,464 @@
+package pyast
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// 大模块的 AST JSON 可以有几百 MB。encoding/json 要先把整个值读进缓冲区，再为每个键、每个字符串与数字分配内存；
+// DecodeMap 边读边构造，同样的键、名字与数字只保存一份，只有 _type 的节点（ctx、运算符）共用同一个 map。
+// Decode 不保留 map：模块的语句逐条解析为 map、立即转换为类型化的节点后丢掉，一个节点的 map 约 330 字节，
+// 对应的结构体只有几十字节
+
+// internMax: 不超过这个长度的字符串（键、名字、数字的原文）只保存一份；更长的（源码、文档字符串）很少重复
+const internMax = 64
+
+// DecodeMap: 从 r 流式解析 py2ast.py 输出的 JSON，结果与 encoding/json 加 UseNumber 解析为 map 相同。
+// 只有 _type 的节点是共用的，不能修改
+func DecodeMap(r io.Reader) (map[string]interface{}, error) {
+	p := newStreamParser(r)
+	v, err := p.value()
+	if err == nil {
+		err = p.end()
+	}
+	if err != nil {
+		return nil, err
+	}
+	root, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a JSON object, got %s", kindOf(v))
+	}
+	return root, nil
+}
+
+// Decode: 从 r 流式解析 py2ast.py 输出的 JSON 为类型化的 AST，结果与 FromMap 相同。
+// body 中的语句逐条解析、转换，只有正在转换的一条语句是 map。python_version 写在 body 之后，
+// 所以出现旧版本的写法（Num、Index ...）之后的语句先保留为 map，读完确定版本后再转换
+func Decode(r io.Reader) (*Module, error) {
+	p := newStreamParser(r)
+	if c, ok := p.next(); !ok || c != '{' {
+		if ok {
+			p.r.UnreadByte()
+			p.offset--
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("expected a JSON object, got %s", kindOf(v))
+	}
+	d := &decoder{}
+	header := map[string]interface{}{} // body 以外的字段
+	var body []Stmt
+	var pending []interface{} // 等版本确定后再转换的语句
+	scan := versionScan{newest: MinVersion}
+	err := p.members(func(key string) error {
+		if key != "body" {
+			v, err := p.value()
+			header[key] = v
+			return err
+		}
+		header["body"] = []interface{}{}
+		if typ, ok := header["_type"]; ok && typ != "Module" {
+			d.object(header, site{}, "Module")
+			return d.err
+		}
+		if c, ok := p.next(); !ok || c != '[' {
+			if ok {
+				p.r.UnreadByte()
+				p.offset--
+			}
+			v, err := p.value()
+			header["body"] = v
+			return err
+		}
+		body, pending = nil, nil
+		return p.elements(func() error {
+			v, err := p.value()
+			if err != nil {
+				return err
+			}
+			if scan.scan(v); scan.legacy() {
+				pending = append(pending, v)
+				return nil
+			}
+			body = append(body, d.stmt(v, moduleStmt(len(body))))
+			return d.err
+		})
+	})
+	if err == nil {
+		err = p.end()
+	}
+	if err != nil {
+		return nil, err
+	}
+	scan.scan(header)
+	version, explicit := explicitVersion(header)
+	if !explicit {
+		version = scan.version()
+	}
+	if err := checkVersion(version, explicit); err != nil {
+		return nil, err
+	}
+	o := d.object(header, site{}, "Module")
+	if o == nil {
+		return nil, d.err
+	}
+	if body == nil && pending == nil {
+		// body 不是列表或没有：按 FromMap 的方式报告
+		body = o.stmts("body")
+	}
+	u := upgraderFor(version)
+	for _, v := range pending {
+		if u.constants || u.index {
+			v = u.node(v)
+		}
+		body = append(body, d.stmt(v, moduleStmt(len(body))))
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	m := &Module{base: o.base(), Body: body, Version: version}
+	m.Source, _ = header["source"].(string)
+	return m, nil
+}
+
+// moduleStmt: 模块的第 i 条语句的位置，与 FromMap 中 Module 对象的 at("body", i) 相同
+func moduleStmt(i int) site {
+	return site{path: fmt.Sprintf("body[%d]", i), field: "body", owner: "Module", element: true}
+}
+
+// Check: 检查 raw 是 Module 的结构（并把旧版本 Python 的节点换成现在的形式），与 FromMap 的检查相同，
+// 但逐条语句转换、不保留类型化的 AST
+func Check(raw map[string]interface{}) error {
+	if _, err := Normalize(raw); err != nil {
+		return err
+	}
+	d := &decoder{}
+	o := d.object(raw, site{}, "Module")
+	if o == nil {
+		return d.err
+	}
+	for i, v := range o.list("body") {
+		d.stmt(v, o.at("body", i))
+	}
+	return d.err
+}
+
+// streamParser: JSON 的递归下降解析
+type streamParser struct {
+	r       *bufio.Reader
+	offset  int64 // 已读的字节数，用于错误信息
+	err     error // 读取的错误，io.EOF 为读完
+	buf     []byte
+	strs    map[string]string
+	boxed   map[string]interface{}            // 作为值的短字符串：interface{} 也只保存一份
+	numbers map[string]interface{}            // 数字的原文 -> json.Number 的 interface{}
+	singles map[string]map[string]interface{} // _type -> 只有 _type 的节点
+}
+
+func newStreamParser(r io.Reader) *streamParser {
+	return &streamParser{r: bufio.NewReaderSize(r, 64<<10), strs: map[string]string{}, boxed: map[string]interface{}{}, numbers: map[string]interface{}{}, singles: map[string]map[string]interface{}{}}
+}
+
+// end: 顶层的值之后只能有空白
+func (p *streamParser) end() error {
+	if c, ok := p.next(); ok {
+		return p.errorf("unexpected %q after the top-level value", c)
+	}
+	if p.err != nil && p.err != io.EOF {
+		return p.err
+	}
+	return nil
+}
+
+func (p *streamParser) errorf(format string, args ...interface{}) error {
+	if p.err != nil && p.err != io.EOF {
+		return p.err
+	}
+	return fmt.Errorf("offset %d: %s", p.offset, fmt.Sprintf(format, args...))
+}
+
+// read: 下一个字节；读完或出错时 ok 为 false
+func (p *streamParser) read() (byte, bool) {
+	c, err := p.r.ReadByte()
+	if err != nil {
+		p.err = err
+		return 0, false
+	}
+	p.offset++
+	return c, true
+}
+
+// next: 跳过空白后的下一个字节
+func (p *streamParser) next() (byte, bool) {
+	for {
+		c, ok := p.read()
+		if !ok || c != ' ' && c != '\n' && c != '\t' && c != '\r' {
+			return c, ok
+		}
+	}
+}
+
+// intern: 共用同样内容的字符串
+func (p *streamParser) intern(b []byte) string {
+	if len(b) > internMax {
+		return string(b)
+	}
+	if s, ok := p.strs[string(b)]; ok {
+		return s
+	}
+	s := string(b)
+	p.strs[s] = s
+	return s
+}
+
+func (p *streamParser) value() (interface{}, error) {
+	c, ok := p.next()
+	if !ok {
+		return nil, p.errorf("unexpected end of input")
+	}
+	switch {
+	case c == '{':
+		return p.object()
+	case c == '[':
+		return p.array()
+	case c == '"':
+		s, err := p.str()
+		if err != nil || len(s) > internMax {
+			return s, err
+		}
+		if v, ok := p.boxed[s]; ok {
+			return v, nil
+		}
+		p.boxed[s] = s
+		return p.boxed[s], nil
+	case c == '-' || c >= '0' && c <= '9':
+		return p.number(c)
+	case c == 't':
+		return true, p.literal("rue")
+	case c == 'f':
+		return false, p.literal("alse")
+	case c == 'n':
+		return nil, p.literal("ull")
+	}
+	return nil, p.errorf("unexpected %q looking for a value", c)
+}
+
+func (p *streamParser) literal(rest string) error {
+	for i := 0; i < len(rest); i++ {
+		if c, ok := p.read(); !ok || c != rest[i] {
+			return p.errorf("invalid literal")
+		}
+	}
+	return nil
+}
+
+// members: { 之后的键值对，对每个键调用 value 读入它的值
+func (p *streamParser) members(value func(key string) error) error {
+	c, ok := p.next()
+	for ok && c != '}' {
+		if c != '"' {
+			return p.errorf("unexpected %q looking for an object key", c)
+		}
+		key, err := p.str()
+		if err != nil {
+			return err
+		}
+		if c, ok = p.next(); !ok || c != ':' {
+			return p.errorf("expected ':' after object key %q", key)
+		}
+		if err := value(key); err != nil {
+			return err
+		}
+		if c, ok = p.next(); ok && c == ',' {
+			c, ok = p.next()
+		} else if ok && c != '}' {
+			return p.errorf("unexpected %q after object value", c)
+		}
+	}
+	if !ok {
+		return p.errorf("unexpected end of input in an object")
+	}
+	return nil
+}
+
+// elements: [ 之后的元素，对每个元素调用 value 读入它
+func (p *streamParser) elements(value func() error) error {
+	c, ok := p.next()
+	if ok && c == ']' {
+		return nil
+	}
+	for ok {
+		p.r.UnreadByte()
+		p.offset--
+		if err := value(); err != nil {
+			return err
+		}
+		if c, ok = p.next(); ok && c == ']' {
+			return nil
+		}
+		if ok && c != ',' {
+			return p.errorf("unexpected %q after array element", c)
+		}
+		c, ok = p.next()
+	}
+	return p.errorf("unexpected end of input in an array")
+}
+
+// object: { 之后的键值对；先收集再分配正好大小的 map
+func (p *streamParser) object() (interface{}, error) {
+	keys, vals := []string{}, []interface{}{}
+	err := p.members(func(key string) error {
+		v, err := p.value()
+		keys, vals = append(keys, key), append(vals, v)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 1 && keys[0] == "_type" {
+		if typ, ok := vals[0].(string); ok {
+			if m := p.singles[typ]; m != nil {
+				return m, nil
+			}
+			p.singles[typ] = map[string]interface{}{"_type": typ}
+			return p.singles[typ], nil
+		}
+	}
+	m := make(map[string]interface{}, len(keys))
+	for i, k := range keys {
+		m[k] = vals[i]
+	}
+	return m, nil
+}
+
+// array: [ 之后的元素，结果的容量正好是长度
+func (p *streamParser) array() (interface{}, error) {
+	elems := []interface{}{}
+	err := p.elements(func() error {
+		v, err := p.value()
+		elems = append(elems, v)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(elems) == 0 {
+		return elems, nil
+	}
+	return append([]interface{}(nil), elems...), nil
+}
+
+// str: " 之后的字符串
+func (p *streamParser) str() (string, error) {
+	p.buf = p.buf[:0]
+	for {
+		c, ok := p.read()
+		if !ok {
+			return "", p.errorf("unexpected end of input in a string")
+		}
+		switch {
+		case c == '"':
+			return p.intern(p.buf), nil
+		case c < ' ':
+			return "", p.errorf("control character %q in a string", c)
+		case c != '\\':
+			p.buf = append(p.buf, c)
+			continue
+		}
+		c, ok = p.read()
+		if !ok {
+			return "", p.errorf("unexpected end of input in a string")
+		}
+		switch c {
+		case '"', '\\', '/':
+			p.buf = append(p.buf, c)
+		case 'b':
+			p.buf = append(p.buf, '\b')
+		case 'f':
+			p.buf = append(p.buf, '\f')
+		case 'n':
+			p.buf = append(p.buf, '\n')
+		case 'r':
+			p.buf = append(p.buf, '\r')
+		case 't':
+			p.buf = append(p.buf, '\t')
+		case 'u':
+			r, err := p.hex4()
+			if err != nil {
+				return "", err
+			}
+			if utf16.IsSurrogate(r) {
+				// 代理对的后一半紧跟着 \u；单独的一半与 encoding/json 一样换成 U+FFFD
+				r1 := r
+				r = utf8.RuneError
+				if peek, _ := p.r.Peek(2); string(peek) == `\u` {
+					p.read()
+					p.read()
+					r2, err := p.hex4()
+					if err != nil {
+						return "", err
+					}
+					if r = utf16.DecodeRune(r1, r2); r == utf8.RuneError {
+						// 后一个 \u 不是代理对的后一半：前一半单独换成 U+FFFD，后一个照常解码
+						p.buf, r = utf8.AppendRune(p.buf, r), r2
+						if utf16.IsSurrogate(r) {
+							r = utf8.RuneError
+						}
+					}
+				}
+			}
+			p.buf = utf8.AppendRune(p.buf, r)
+		default:
+			return "", p.errorf("invalid escape \\%c in a string", c)
+		}
+	}
+}
+
+func (p *streamParser) hex4() (rune, error) {
+	digits := [4]byte{}
+	for i := range digits {
+		c, ok := p.read()
+		if !ok {
+			return 0, p.errorf("unexpected end of input in a string")
+		}
+		digits[i] = c
+	}
+	n, err := strconv.ParseUint(string(digits[:]), 16, 32)
+	if err != nil {
+		return 0, p.errorf("invalid escape \\u%s in a string", digits[:])
+	}
+	return rune(n), nil
+}
+
+// number: 数字保留原文（json.Number）
+func (p *streamParser) number(first byte) (interface{}, error) {
+	p.buf = append(p.buf[:0], first)
+	for {
+		peek, err := p.r.Peek(1)
+		if err != nil {
+			break
+		}
+		if c := peek[0]; c >= '0' && c <= '9' || c == '.' || c == 'e' || c == 'E' || c == '+' || c == '-' {
+			p.read()
+			p.buf = append(p.buf, c)
+			continue
+		}
+		break
+	}
+	if _, err := strconv.ParseFloat(string(p.buf), 64); err != nil && err.(*strconv.NumError).Err != strconv.ErrRange {
+		return nil, p.errorf("invalid number %q", p.buf)
+	}
+	if v, ok := p.numbers[string(p.buf)]; ok {
+		return v, nil
+	}
+	n := string(p.buf)
+	p.numbers[n] = json.Number(n)
+	return p.numbers[n], nil
+}
@@ -0,0 +1,225 @@
+package pyast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 不同版本的 Python 输出的 AST 写法不同：3.7 的常量是 Num、Str、Bytes、NameConstant、Ellipsis，3.8 起是 Constant；
+// 3.8 的下标包在 Index 中（多维的是 ExtSlice），3.9 起直接是表达式；位置的 end_lineno、posonlyargs 与 type_ignores
+// 从 3.8 起才有，type_params 从 3.12 起才有（见 decode.go 的 newerFields）。
+// Normalize 先确定 AST 的版本，再把旧的写法就地换成现在的形式，之后的检查与代码生成只需要认识一种写法
+
+// Version: 输出 AST 的 Python 版本（主、次版本号）
+type Version struct {
+	Major, Minor int
+}
+
+var (
+	MinVersion = Version{3, 7}  // 能读的最早版本
+	MaxVersion = Version{3, 13} // 检查过写法的最新版本；更新版本的 AST 也读，不认识的节点是 Unknown
+)
+
+func (v Version) String() string { return fmt.Sprintf("%d.%d", v.Major, v.Minor) }
+
+// Less: v 早于 o
+func (v Version) Less(o Version) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	return v.Minor < o.Minor
+}
+
+// ParseVersion: 解析 "3.8"、"3.11.7" 这样的版本号，只取主、次版本号
+func ParseVersion(s string) (Version, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return Version{}, fmt.Errorf("invalid Python version %q", s)
+	}
+	major, err1 := strconv.Atoi(parts[0])
+	minor, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || major < 0 || minor < 0 {
+		return Version{}, fmt.Errorf("invalid Python version %q", s)
+	}
+	return Version{major, minor}, nil
+}
+
+// DetectVersion: AST 的 Python 版本。py2ast.py 写入的 python_version 字段优先（explicit 为 true）；
+// 没有时按节点的写法推断：有 Num、Str 这样的常量时是 3.7，有 Index 时是 3.8，否则是用到的写法中最新的一种
+// 出现的版本（Constant 为 3.8，不包在 Index 中的下标为 3.9，match 为 3.10 ...），什么都看不出来时是 MinVersion
+func DetectVersion(raw map[string]interface{}) (v Version, explicit bool) {
+	if v, ok := explicitVersion(raw); ok {
+		return v, true
+	}
+	f := versionScan{newest: MinVersion}
+	f.scan(raw)
+	return f.version(), false
+}
+
+// explicitVersion: py2ast.py 写入的 python_version 字段
+func explicitVersion(raw map[string]interface{}) (Version, bool) {
+	if s, ok := raw["python_version"].(string); ok {
+		if v, err := ParseVersion(s); err == nil {
+			return v, true
+		}
+	}
+	return Version{}, false
+}
+
+// versionScan: 推断版本时在 AST 中看到的写法
+type versionScan struct {
+	constants bool    // 3.8 之前的常量节点
+	index     bool    // 3.9 之前的 Index、ExtSlice
+	newest    Version // 看到的写法中最新的那种出现的版本
+}
+
+// 节点类型与字段 -> 出现这种写法的最早版本
+var (
+	versionOfType = map[string]Version{
+		"Constant": {3, 8}, "NamedExpr": {3, 8}, "TypeIgnore": {3, 8},
+		"Match": {3, 10}, "MatchValue": {3, 10}, "MatchSingleton": {3, 10}, "MatchSequence": {3, 10}, "MatchMapping": {3, 10},
+		"MatchClass": {3, 10}, "MatchStar": {3, 10}, "MatchAs": {3, 10}, "MatchOr": {3, 10},
+		"TryStar":   {3, 11},
+		"TypeAlias": {3, 12}, "TypeVar": {3, 12}, "ParamSpec": {3, 12}, "TypeVarTuple": {3, 12},
+	}
+	versionOfField = map[string]Version{
+		"end_lineno": {3, 8}, "posonlyargs": {3, 8}, "type_ignores": {3, 8}, "type_comment": {3, 8},
+		"type_params": {3, 12}, "default_value": {3, 13},
+	}
+)
+
+// version: 按看到的写法推断的版本
+func (f *versionScan) version() Version {
+	switch {
+	case f.constants:
+		return Version{3, 7}
+	case f.index:
+		return Version{3, 8}
+	}
+	return f.newest
+}
+
+// legacy: 看到了要转换的旧写法
+func (f *versionScan) legacy() bool {
+	return f.constants || f.index
+}
+
+func (f *versionScan) saw(v Version) {
+	if f.newest.Less(v) {
+		f.newest = v
+	}
+}
+
+func (f *versionScan) scan(v interface{}) {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, c := range v {
+			f.scan(c)
+		}
+	case map[string]interface{}:
+		typ, _ := v["_type"].(string)
+		switch typ {
+		case "Num", "Str", "Bytes", "NameConstant":
+			f.constants = true
+		case "Ellipsis":
+			if _, expr := v["lineno"]; expr {
+				f.constants = true
+			}
+		case "Index", "ExtSlice":
+			f.index = true
+		case "Subscript":
+			if s, ok := v["slice"].(map[string]interface{}); ok && s["_type"] != "Index" && s["_type"] != "ExtSlice" && s["_type"] != "Slice" {
+				f.saw(Version{3, 9})
+			}
+		}
+		if ver, ok := versionOfType[typ]; ok {
+			f.saw(ver)
+		}
+		for k, c := range v {
+			if ver, ok := versionOfField[k]; ok {
+				f.saw(ver)
+			}
+			if k != "_type" {
+				f.scan(c)
+			}
+		}
+	}
+}
+
+// Normalize: 按 DetectVersion 的版本把旧版本 Python 的 AST 就地换成现在的形式，返回版本。
+// 明确写着早于 MinVersion 的版本（Python 2 的 AST 完全不同）返回错误
+func Normalize(raw map[string]interface{}) (Version, error) {
+	v, explicit := DetectVersion(raw)
+	if err := checkVersion(v, explicit); err != nil {
+		return v, err
+	}
+	if u := upgraderFor(v); u.constants || u.index {
+		u.node(raw)
+	}
+	return v, nil
+}
+
+// checkVersion: 明确写着的版本能不能读
+func checkVersion(v Version, explicit bool) error {
+	if explicit && v.Less(MinVersion) {
+		return fmt.Errorf("the AST was written by Python %s; py2c reads ASTs from Python %s to %s", v, MinVersion, MaxVersion)
+	}
+	return nil
+}
+
+// upgraderFor: 版本 v 的 AST 要做的转换
+func upgraderFor(v Version) upgrader {
+	return upgrader{constants: v.Less(Version{3, 8}), index: v.Less(Version{3, 9})}
+}
+
+// upgrader: 要做的转换：constants 把 Num、Str、Bytes、NameConstant、Ellipsis 换成 Constant（3.8 之前），
+// index 把下标中的 Index(value) 换成 value、ExtSlice(dims) 换成 Tuple（3.9 之前）
+type upgrader struct {
+	constants, index bool
+}
+
+func (u upgrader) node(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		for i := range v {
+			v[i] = u.node(v[i])
+		}
+	case map[string]interface{}:
+		switch v["_type"] {
+		case "Constant":
+			return v // 值可以是 {"_type": "Ellipsis"}
+		case "Index":
+			if value, ok := v["value"]; ok && u.index {
+				return u.node(value)
+			}
+		case "ExtSlice":
+			if u.index {
+				return u.node(map[string]interface{}{"_type": "Tuple", "elts": v["dims"], "ctx": map[string]interface{}{"_type": "Load"}})
+			}
+		case "Num", "Str", "Bytes":
+			if u.constants {
+				key := map[interface{}]string{"Num": "n", "Str": "s", "Bytes": "s"}[v["_type"]]
+				v["_type"], v["value"], v["kind"] = "Constant", v[key], nil
+				delete(v, key)
+				return v
+			}
+		case "NameConstant":
+			if u.constants {
+				v["_type"] = "Constant"
+				return v
+			}
+		case "Ellipsis":
+			if _, expr := v["lineno"]; expr && u.constants {
+				return map[string]interface{}{"_type": "Constant", "value": map[string]interface{}{"_type": "Ellipsis"}, "kind": nil,
+					"lineno": v["lineno"], "col_offset": v["col_offset"], "end_lineno": v["end_lineno"], "end_col_offset": v["end_col_offset"]}
+			}
+		}
+		for k, c := range v {
+			if k != "_type" {
+				v[k] = u.node(c)
+			}
+		}
+	}
+	return v
+}
@@ -0,0 +1,271 @@
+package pyast
+
+// Visitor: Walk 对每个节点调用 Visit；返回的 w 不为 nil 时用 w 访问子节点，之后再调用 w.Visit(nil)
+type Visitor interface {
+	Visit(n Node) (w Visitor)
+}
+
+// Walk: 按源码顺序深度优先遍历，与 go/ast.Walk 的约定相同
+func Walk(v Visitor, n Node) {
+	if v = v.Visit(n); v == nil {
+		return
+	}
+	for _, c := range Children(n) {
+		Walk(v, c)
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(n Node) Visitor {
+	if f(n) {
+		return f
+	}
+	return nil
+}
+
+// Inspect: 遍历 n，f 返回 false 时不进入子节点；子节点访问完后调用 f(nil)
+func Inspect(n Node, f func(Node) bool) {
+	Walk(inspector(f), n)
+}
+
+// Children: n 的直接子节点，按源码顺序（nil 的可选字段不在其中）
+func Children(n Node) []Node {
+	var out []Node
+	add := func(nodes ...Node) {
+		for _, c := range nodes {
+			if c != nil && !isNil(c) {
+				out = append(out, c)
+			}
+		}
+	}
+	switch n := n.(type) {
+	case *Module:
+		add(stmts(n.Body)...)
+	case *Arguments:
+		for _, a := range n.PosOnlyArgs {
+			add(a)
+		}
+		for _, a := range n.Args {
+			add(a)
+		}
+		add(n.Vararg)
+		for _, a := range n.KwOnlyArgs {
+			add(a)
+		}
+		add(exprs(n.KwDefaults)...)
+		add(n.Kwarg)
+		add(exprs(n.Defaults)...)
+	case *Arg:
+		add(n.Annotation)
+	case *Keyword:
+		add(n.Value)
+	case *Alias, *Unknown:
+	case *Comprehension:
+		add(n.Target, n.Iter)
+		add(exprs(n.Ifs)...)
+	case *ExceptHandler:
+		add(n.ExcType)
+		add(stmts(n.Body)...)
+	case *WithItem:
+		add(n.ContextExpr, n.OptionalVars)
+	case *MatchCase:
+		add(n.Pattern, n.Guard)
+		add(stmts(n.Body)...)
+
+	case *FunctionDef:
+		add(exprs(n.DecoratorList)...)
+		add(n.Args, n.Returns)
+		add(stmts(n.Body)...)
+	case *ClassDef:
+		add(exprs(n.DecoratorList)...)
+		add(exprs(n.Bases)...)
+		for _, k := range n.Keywords {
+			add(k)
+		}
+		add(stmts(n.Body)...)
+	case *Return:
+		add(n.Value)
+	case *Delete:
+		add(exprs(n.Targets)...)
+	case *Assign:
+		add(exprs(n.Targets)...)
+		add(n.Value)
+	case *AugAssign:
+		add(n.Target, n.Value)
+	case *AnnAssign:
+		add(n.Target, n.Annotation, n.Value)
+	case *For:
+		add(n.Target, n.Iter)
+		add(stmts(n.Body)...)
+		add(stmts(n.Orelse)...)
+	case *While:
+		add(n.Test)
+		add(stmts(n.Body)...)
+		add(stmts(n.Orelse)...)
+	case *If:
+		add(n.Test)
+		add(stmts(n.Body)...)
+		add(stmts(n.Orelse)...)
+	case *With:
+		for _, w := range n.Items {
+			add(w)
+		}
+		add(stmts(n.Body)...)
+	case *Match:
+		add(n.Subject)
+		for _, c := range n.Cases {
+			add(c)
+		}
+	case *Raise:
+		add(n.Exc, n.Cause)
+	case *Try:
+		add(stmts(n.Body)...)
+		for _, h := range n.Handlers {
+			add(h)
+		}
+		add(stmts(n.Orelse)...)
+		add(stmts(n.Finalbody)...)
+	case *Assert:
+		add(n.Test, n.Msg)
+	case *Import:
+		for _, a := range n.Names {
+			add(a)
+		}
+	case *ImportFrom:
+		for _, a := range n.Names {
+			add(a)
+		}
+	case *ExprStmt:
+		add(n.Value)
+	case *Global, *Nonlocal, *Pass, *Break, *Continue:
+
+	case *BoolOp:
+		add(exprs(n.Values)...)
+	case *NamedExpr:
+		add(n.Target, n.Value)
+	case *BinOp:
+		add(n.Left, n.Right)
+	case *UnaryOp:
+		add(n.Operand)
+	case *Lambda:
+		add(n.Args, n.Body)
+	case *IfExp:
+		add(n.Body, n.Test, n.Orelse)
+	case *Dict:
+		for i := range n.Values {
+			if i < len(n.Keys) {
+				add(n.Keys[i])
+			}
+			add(n.Values[i])
+		}
+	case *Set:
+		add(exprs(n.Elts)...)
+	case *ListComp:
+		add(n.Elt)
+		add(comprehensions(n.Generators)...)
+	case *SetComp:
+		add(n.Elt)
+		add(comprehensions(n.Generators)...)
+	case *DictComp:
+		add(n.Key, n.Value)
+		add(comprehensions(n.Generators)...)
+	case *GeneratorExp:
+		add(n.Elt)
+		add(comprehensions(n.Generators)...)
+	case *Await:
+		add(n.Value)
+	case *Yield:
+		add(n.Value)
+	case *YieldFrom:
+		add(n.Value)
+	case *Compare:
+		add(n.Left)
+		add(exprs(n.Comparators)...)
+	case *Call:
+		add(n.Func)
+		add(exprs(n.Args)...)
+		for _, k := range n.Keywords {
+			add(k)
+		}
+	case *FormattedValue:
+		add(n.Value, n.FormatSpec)
+	case *JoinedStr:
+		add(exprs(n.Values)...)
+	case *Constant, *Name:
+	case *Attribute:
+		add(n.Value)
+	case *Subscript:
+		add(n.Value, n.Slice)
+	case *Starred:
+		add(n.Value)
+	case *List:
+		add(exprs(n.Elts)...)
+	case *Tuple:
+		add(exprs(n.Elts)...)
+	case *Slice:
+		add(n.Lower, n.Upper, n.Step)
+
+	case *MatchValue:
+		add(n.Value)
+	case *MatchSingleton, *MatchStar:
+	case *MatchSequence:
+		add(patterns(n.Patterns)...)
+	case *MatchMapping:
+		add(exprs(n.Keys)...)
+		add(patterns(n.Patterns)...)
+	case *MatchClass:
+		add(n.Cls)
+		add(patterns(n.Patterns)...)
+		add(patterns(n.KwdPatterns)...)
+	case *MatchAs:
+		add(n.Pattern)
+	case *MatchOr:
+		add(patterns(n.Patterns)...)
+	}
+	return out
+}
+
+func stmts(l []Stmt) []Node {
+	out := make([]Node, len(l))
+	for i, s := range l {
+		out[i] = s
+	}
+	return out
+}
+
+func exprs(l []Expr) []Node {
+	out := make([]Node, len(l))
+	for i, e := range l {
+		out[i] = e
+	}
+	return out
+}
+
+func patterns(l []Pattern) []Node {
+	out := make([]Node, len(l))
+	for i, p := range l {
+		out[i] = p
+	}
+	return out
+}
+
+func comprehensions(l []*Comprehension) []Node {
+	out := make([]Node, len(l))
+	for i, c := range l {
+		out[i] = c
+	}
+	return out
+}
+
+// isNil: 接口中的 nil 指针（可选的 *Arg、*Arguments 字段）
+func isNil(n Node) bool {
+	switch n := n.(type) {
+	case *Arg:
+		return n == nil
+	case *Arguments:
+		return n == nil
+	}
+	return false
+}
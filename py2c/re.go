@@ -0,0 +1,769 @@
+package py2c
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// re 模块：re.match、re.search、re.fullmatch、re.findall 与 re.sub 的模式必须是字符串字面量，翻译时转换成
+// POSIX 扩展正则表达式（ERE），程序运行时第一次用到时 regcomp，之后用 regexec 匹配：
+//
+//	m = re.match(r"(\d+)-(\d+)", s)     PyMatch m = py_re_match(&py_re_0, s, 1);
+//	if m:                                if (m.ok) {
+//	    print(m.group(2))                    printf("%s\n", py_re_group(m, 2, NULL));
+//
+// \d \w \s 换成字符类，. 换成 [^\n]（re.S 时是 .），(?:...) 与 (?P<name>...) 成为 POSIX 的组，记下 Python 的组号对应的
+// POSIX 组号。POSIX 没有的写法（先行与后行断言、反向引用、\b、非贪婪的量词等）报告为错误，调用不翻译。
+// 匹配结果 PyMatch 是值：m.group() / m.start() / m.end() 读它记下的下标，它引用被搜索的字符串而不复制。
+// POSIX 取最左边的最长匹配，Python 按顺序取第一个能匹配的分支，所以 a|ab 匹配 "ab" 时结果不同
+
+// 模式的标志：re.I、re.M、re.S
+const (
+	reIgnoreCase = 1 << iota
+	reMultiline
+	reDotAll
+)
+
+// rePattern: 转换后的模式
+type rePattern struct {
+	name   string         // C 的变量名 py_re_N
+	source string         // Python 的模式
+	ere    string         // POSIX ERE
+	flags  int            // reIgnoreCase 等
+	groups []int          // Python 的第 i 组是 POSIX 的第 groups[i] 组
+	names  map[string]int // (?P<name>...) 的组号
+}
+
+// reFuncs: 翻译的 re 函数与它们的参数（按位置的顺序）
+var reFuncs = map[string][]string{
+	"match": {"pattern", "string", "flags"}, "search": {"pattern", "string", "flags"}, "fullmatch": {"pattern", "string", "flags"},
+	"findall": {"pattern", "string", "flags"}, "sub": {"pattern", "repl", "string", "count", "flags"},
+}
+
+// reMaxGroups: PyMatch 中的组数（POSIX 的组，包括第 0 组）
+const reMaxGroups = 10
+
+// reClasses: 字符类的转义在方括号外与方括号内的写法
+var reClasses = map[byte][2]string{
+	'd': {"[0-9]", "0-9"}, 'w': {"[[:alnum:]_]", "[:alnum:]_"}, 's': {"[[:space:]]", "[:space:]"},
+	'D': {"[^0-9]", ""}, 'W': {"[^[:alnum:]_]", ""}, 'S': {"[^[:space:]]", ""},
+}
+
+// reRepeat: {m}、{m,}、{,n}、{m,n}
+var reRepeat = regexp.MustCompile(`^\{(\d*)(,?)(\d*)\}`)
+
+// reCallType: re 函数与 PyMatch 的方法的结果类型，不认识时为 ""（类型推断在翻译 import 之前，按 importedName 识别）
+func (g *generator) reCallType(fn map[string]interface{}) string {
+	switch g.importedName(fn) {
+	case "re.match", "re.search", "re.fullmatch":
+		return "PyMatch"
+	case "re.findall":
+		return g.listType("char*")
+	case "re.sub":
+		return "char*"
+	}
+	if fn["_type"] == "Attribute" && g.getType(fn["value"]) == "PyMatch" {
+		switch fn["attr"] {
+		case "group":
+			return "char*"
+		case "start", "end":
+			return "int"
+		}
+	}
+	return ""
+}
+
+// reCall: re.match(p, s) 等；p 是字符串字面量
+func (g *generator) reCall(qname string, node ASTNode) string {
+	name := strings.TrimPrefix(qname, "re.")
+	params, ok := reFuncs[name]
+	if !ok {
+		return g.unsupportedExpr(node, fmt.Sprintf("call: %s (only match, search, fullmatch, findall and sub with a literal pattern are translated)", qname))
+	}
+	args, _ := node["args"].([]interface{})
+	if len(args) > len(params) {
+		return g.unsupportedExpr(node, fmt.Sprintf("call: %s with %d arguments", qname, len(args)))
+	}
+	vals := map[string]map[string]interface{}{}
+	for i, a := range args {
+		vals[params[i]], _ = a.(map[string]interface{})
+	}
+	keywords, _ := node["keywords"].([]interface{})
+	for _, k := range keywords {
+		km, _ := k.(map[string]interface{})
+		arg, _ := km["arg"].(string)
+		if !strings.Contains(" "+strings.Join(params, " ")+" ", " "+arg+" ") {
+			return g.unsupportedExpr(node, fmt.Sprintf("call: %s with the keyword argument %s", qname, arg))
+		}
+		vals[arg], _ = km["value"].(map[string]interface{})
+	}
+	for _, p := range params[:len(params)-1] {
+		if vals[p] == nil && p != "count" {
+			return g.unsupportedExpr(node, fmt.Sprintf("call: %s without the %s argument", qname, p))
+		}
+	}
+	source, ok := vals["pattern"]["value"].(string)
+	if vals["pattern"]["_type"] != "Constant" || !ok {
+		return g.unsupportedExpr(node, fmt.Sprintf("call: %s with a pattern that is not a string literal", qname))
+	}
+	flags, why := g.reFlags(vals["flags"])
+	if why != "" {
+		return g.unsupportedExpr(node, fmt.Sprintf("call: %s with %s", qname, why))
+	}
+	p, what := g.rePattern(source, flags)
+	if what != "" {
+		return g.unsupportedExpr(node, fmt.Sprintf("call: %s(%s): %s has no POSIX equivalent", qname, strconv.Quote(source), what))
+	}
+	if g.getType(vals["string"]) != "char*" {
+		return g.unsupportedExpr(node, fmt.Sprintf("call: %s of something other than a string", qname))
+	}
+	switch name {
+	case "findall":
+		if len(p.groups) > 2 {
+			return g.unsupportedExpr(node, fmt.Sprintf("call: re.findall with %d groups (the result is a list of tuples)", len(p.groups)-1))
+		}
+		g.reFindall()
+		return g.rcHold(g.listType("char*"), fmt.Sprintf("py_re_findall(&%s, %s)", p.name, g.toC(vals["string"], 0)))
+	case "sub":
+		repl := vals["repl"]
+		if text, ok := repl["value"].(string); ok && repl["_type"] == "Constant" {
+			conv, why := p.replacement(text)
+			if why != "" {
+				return g.unsupportedExpr(node, "call: re.sub with "+why)
+			}
+			repl = map[string]interface{}{"_type": "Constant", "value": conv}
+		} else if g.getType(repl) != "char*" {
+			return g.unsupportedExpr(node, "call: re.sub with a replacement that is not a string")
+		}
+		r := g.toC(repl, 0)
+		s := g.toC(vals["string"], 0)
+		count := "0"
+		if vals["count"] != nil {
+			count = g.toC(vals["count"], 0)
+		}
+		return fmt.Sprintf("py_re_sub(&%s, %s, %s, %s)", p.name, r, s, count)
+	}
+	anchor := map[string]int{"search": 0, "match": 1, "fullmatch": 2}[name]
+	return fmt.Sprintf("py_re_match(&%s, %s, %d)", p.name, g.toC(vals["string"], 0), anchor)
+}
+
+// reFlags: flags 实参（re.I | re.M 等）；不能翻译时返回原因
+func (g *generator) reFlags(node map[string]interface{}) (int, string) {
+	switch node["_type"] {
+	case nil:
+		return 0, ""
+	case "Constant":
+		if fmt.Sprint(node["value"]) == "0" {
+			return 0, ""
+		}
+	case "BinOp":
+		if op, _ := node["op"].(map[string]interface{}); op["_type"] == "BitOr" {
+			a, why := g.reFlags(node["left"].(map[string]interface{}))
+			b, why2 := g.reFlags(node["right"].(map[string]interface{}))
+			if why == "" {
+				why = why2
+			}
+			return a | b, why
+		}
+	}
+	switch g.importedName(node) {
+	case "re.I", "re.IGNORECASE":
+		return reIgnoreCase, ""
+	case "re.M", "re.MULTILINE":
+		return reMultiline, ""
+	case "re.S", "re.DOTALL":
+		return reDotAll, ""
+	}
+	return 0, "flags other than re.I, re.M and re.S"
+}
+
+// handleMatchMethodCall: m.group([i]) / m.start([i]) / m.end([i])；i 可以是组名
+func (g *generator) handleMatchMethodCall(fn, call map[string]interface{}) (string, bool) {
+	if g.getType(fn["value"]) != "PyMatch" {
+		return "", false
+	}
+	method, _ := fn["attr"].(string)
+	if method != "group" && method != "start" && method != "end" {
+		return g.unsupportedExpr(call, "call: re.Match method "+method), true
+	}
+	args, _ := call["args"].([]interface{})
+	if len(args) > 1 {
+		return g.unsupportedExpr(call, fmt.Sprintf("call: re.Match.%s with %d groups (the result is a tuple)", method, len(args))), true
+	}
+	m := g.toC(fn["value"].(map[string]interface{}), 0)
+	idx, name := "0", "NULL"
+	if len(args) == 1 {
+		a := args[0].(map[string]interface{})
+		if s, ok := a["value"].(string); ok && a["_type"] == "Constant" {
+			name = "\"" + cEscape(s) + "\""
+		} else if idx = g.toC(a, 0); !g.isIntExpr(a) && g.getType(a) != "int" {
+			idx = "(int)(" + idx + ")"
+		}
+	}
+	return fmt.Sprintf("py_re_%s(%s, %s, %s)", method, m, idx, name), true
+}
+
+// mayBeNone: char* 表达式可能是 None（NULL）：m.group(i) 在组没有参与匹配时为 None，以及保存了它的变量
+func (g *generator) mayBeNone(node interface{}) bool {
+	m, _ := node.(map[string]interface{})
+	switch m["_type"] {
+	case "Call":
+		fn, _ := m["func"].(map[string]interface{})
+		return fn["_type"] == "Attribute" && fn["attr"] == "group" && g.getType(fn["value"]) == "PyMatch"
+	case "Name":
+		id, _ := m["id"].(string)
+		sym := g.lookupVar(id)
+		return sym != nil && sym.none
+	}
+	return false
+}
+
+// markNone: 变量被赋予了可能为 None 的值
+func (g *generator) markNone(name string) {
+	if sym := g.lookupVar(name); sym != nil {
+		sym.none = true
+	}
+}
+
+// --- 模式的转换 ---
+
+// rePattern: 登记并返回转换后的模式（同样的模式与标志只生成一次）；不能转换时返回 POSIX 中没有的写法
+func (g *generator) rePattern(source string, flags int) (*rePattern, string) {
+	key := fmt.Sprintf("%d:%s", flags, source)
+	if p := g.rePatterns[key]; p != nil {
+		return p, ""
+	}
+	p, what := convertPattern(source, flags)
+	if what != "" {
+		return nil, what
+	}
+	p.name = fmt.Sprintf("py_re_%d", len(g.rePatterns))
+	g.rePatterns[key] = p
+	g.reRuntime()
+	var groups, names []string
+	for i, n := range p.groups {
+		groups = append(groups, strconv.Itoa(n))
+		names = append(names, "NULL")
+		for name, j := range p.names {
+			if j == i {
+				names[i] = "\"" + name + "\""
+			}
+		}
+	}
+	cflags := "REG_EXTENDED"
+	if p.flags&reIgnoreCase != 0 {
+		cflags += " | REG_ICASE"
+	}
+	if p.flags&reMultiline != 0 {
+		cflags += " | REG_NEWLINE"
+	}
+	code := fmt.Sprintf("// the pattern \"%s\"\nstatic const int %s_groups[] = {%s};\n", cEscape(source), p.name, join(groups, ", "))
+	namesRef := "NULL"
+	if len(p.names) > 0 {
+		code += fmt.Sprintf("static const char* %s_names[] = {%s};\n", p.name, join(names, ", "))
+		namesRef = p.name + "_names"
+	}
+	code += fmt.Sprintf("static PyRegex %s = {\"%s\", %s, %s_groups, %d, %s};\n", p.name, cEscape(p.ere), cflags, p.name, len(p.groups)-1, namesRef)
+	g.classStructs = append(g.classStructs, code)
+	return p, ""
+}
+
+// convertPattern: 把 Python 的模式转换成 POSIX ERE；不能转换时返回 POSIX 中没有的写法
+func convertPattern(source string, flags int) (*rePattern, string) {
+	p := &rePattern{source: source, groups: []int{0}, names: map[string]int{}}
+	pat := source
+	// 模式开头的 (?i)、(?ms) 等标志
+	if m := regexp.MustCompile(`^\(\?([a-zA-Z]+)\)`).FindStringSubmatch(pat); m != nil {
+		for _, f := range m[1] {
+			switch f {
+			case 'i':
+				flags |= reIgnoreCase
+			case 'm':
+				flags |= reMultiline
+			case 's':
+				flags |= reDotAll
+			default:
+				return nil, fmt.Sprintf("the inline flag (?%c)", f)
+			}
+		}
+		pat = pat[len(m[0]):]
+	}
+	p.flags = flags
+	var out strings.Builder
+	posix := 0 // POSIX 的组数
+	for i := 0; i < len(pat); {
+		c := pat[i]
+		switch {
+		case c == '\\':
+			if i+1 == len(pat) {
+				return nil, "a trailing backslash"
+			}
+			e := pat[i+1]
+			switch {
+			case reClasses[e][0] != "":
+				out.WriteString(reClasses[e][0])
+				i += 2
+				continue
+			case e == 'A' || e == 'Z':
+				out.WriteString(map[byte]string{'A': "^", 'Z': "$"}[e])
+				i += 2
+				continue
+			case e == 'b' || e == 'B':
+				return nil, "the word boundary \\" + string(e)
+			case e >= '1' && e <= '9':
+				return nil, "the backreference \\" + string(e)
+			}
+			lit, next, what := reLiteral(pat, i, false)
+			if what != "" {
+				return nil, what
+			}
+			for j := 0; j < len(lit); j++ {
+				if strings.IndexByte(`.[]()*+?{}|^$\`, lit[j]) >= 0 {
+					out.WriteByte('\\')
+				}
+				out.WriteByte(lit[j])
+			}
+			i = next
+			continue
+		case c == '.':
+			if flags&reDotAll != 0 {
+				out.WriteString(".")
+			} else {
+				out.WriteString("[^\n]")
+			}
+		case c == '[':
+			class, next, what := reClass(pat, i)
+			if what != "" {
+				return nil, what
+			}
+			out.WriteString(class)
+			i = next
+			continue
+		case c == '(':
+			rest := pat[i:]
+			switch {
+			case strings.HasPrefix(rest, "(?:"):
+				i += 3
+			case strings.HasPrefix(rest, "(?P<"):
+				end := strings.IndexByte(rest, '>')
+				if end < 0 {
+					return nil, "an unterminated group name"
+				}
+				p.names[rest[4:end]] = len(p.groups)
+				p.groups = append(p.groups, posix+1)
+				i += end + 1
+			case strings.HasPrefix(rest, "(?P="):
+				return nil, "the backreference (?P=name)"
+			case strings.HasPrefix(rest, "(?="), strings.HasPrefix(rest, "(?!"):
+				return nil, "the lookahead " + rest[:3] + "...)"
+			case strings.HasPrefix(rest, "(?<="), strings.HasPrefix(rest, "(?<!"):
+				return nil, "the lookbehind " + rest[:4] + "...)"
+			case strings.HasPrefix(rest, "(?#"):
+				end := strings.IndexByte(rest, ')')
+				if end < 0 {
+					return nil, "an unterminated comment"
+				}
+				i += end + 1
+				continue
+			case len(rest) > 2 && rest[1] == '?':
+				return nil, "the group " + rest[:3] + "...)"
+			default:
+				p.groups = append(p.groups, posix+1)
+				i++
+			}
+			posix++
+			out.WriteByte('(')
+			continue
+		case c == '*' || c == '+' || c == '?' || c == '{':
+			q := string(c)
+			if m := reRepeat.FindStringSubmatch(pat[i:]); c == '{' && m != nil && (m[1] != "" || m[3] != "") {
+				lo := m[1]
+				if lo == "" {
+					lo = "0"
+				}
+				q = "{" + lo + m[2] + m[3] + "}"
+				i += len(m[0]) - 1
+			} else if c == '{' {
+				out.WriteString("\\{") // 不是量词的 { 是普通字符
+				break
+			}
+			out.WriteString(q)
+			if i+1 < len(pat) && (pat[i+1] == '?' || pat[i+1] == '+') {
+				kind := map[byte]string{'?': "lazy", '+': "possessive"}[pat[i+1]]
+				return nil, fmt.Sprintf("the %s quantifier %s%c", kind, q, pat[i+1])
+			}
+		case c == '}':
+			out.WriteString("\\}")
+		default:
+			out.WriteByte(c)
+		}
+		i++
+	}
+	if posix >= reMaxGroups {
+		return nil, fmt.Sprintf("more than %d groups", reMaxGroups-1)
+	}
+	p.ere = out.String()
+	return p, ""
+}
+
+// reLiteral: pat[i] 的 \ 开始的转义表示的字符（\n、\x41、\. 等）与转义之后的下标；inClass 时 \b 是退格
+func reLiteral(pat string, i int, inClass bool) (string, int, string) {
+	e := pat[i+1]
+	if s, ok := map[byte]string{'n': "\n", 't': "\t", 'r': "\r", 'f': "\f", 'v': "\v", 'a': "\a"}[e]; ok {
+		return s, i + 2, ""
+	}
+	if e == 'b' && inClass {
+		return "\b", i + 2, ""
+	}
+	if digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]; digits > 0 {
+		if i+2+digits > len(pat) {
+			return "", 0, "an incomplete escape \\" + string(e)
+		}
+		n, err := strconv.ParseUint(pat[i+2:i+2+digits], 16, 32)
+		if err != nil || n == 0 {
+			return "", 0, "the escape \\" + pat[i+1:i+2+digits]
+		}
+		return string(rune(n)), i + 2 + digits, ""
+	}
+	if e < utf8.RuneSelf && (e >= '0' && e <= '9' || e >= 'a' && e <= 'z' || e >= 'A' && e <= 'Z') {
+		return "", 0, "the escape \\" + string(e)
+	}
+	_, size := utf8.DecodeRuneInString(pat[i+1:])
+	return pat[i+1 : i+1+size], i + 1 + size, ""
+}
+
+// reClass: pat[i] 的 [ 开始的字符类转换成 POSIX 的方括号表达式，返回 ] 之后的下标。
+// POSIX 的方括号中 \ 不是转义：] 要放在最前面，- 放在最后，^ 不能在最前面
+func reClass(pat string, i int) (string, int, string) {
+	j := i + 1
+	neg := false
+	if j < len(pat) && pat[j] == '^' {
+		neg = true
+		j++
+	}
+	var items []string
+	rbracket, caret, dash := false, false, false
+	// member: j 处的一个字符（或者转义的字符），返回它与之后的下标
+	member := func(j int) (string, int, string) {
+		switch c := pat[j]; {
+		case c == '\\' && j+1 < len(pat):
+			if reClasses[pat[j+1]][0] != "" {
+				return "", 0, "\\" + string(pat[j+1]) + " in a range of a character class"
+			}
+			return reLiteral(pat, j, true)
+		case c >= utf8.RuneSelf:
+			return "", 0, "a non-ASCII character in a character class"
+		default:
+			return string(c), j + 1, ""
+		}
+	}
+	for first := true; ; first = false {
+		if j >= len(pat) {
+			return "", 0, "an unterminated character class"
+		}
+		if pat[j] == ']' && !first {
+			j++
+			break
+		}
+		if pat[j] == '\\' && j+1 < len(pat) && reClasses[pat[j+1]][0] != "" {
+			in := reClasses[pat[j+1]][1]
+			if in == "" {
+				return "", 0, "\\" + string(pat[j+1]) + " inside a character class"
+			}
+			items = append(items, in)
+			j += 2
+			continue
+		}
+		lit, next, what := member(j)
+		if what != "" {
+			return "", 0, what
+		}
+		j = next
+		if j+1 < len(pat) && pat[j] == '-' && pat[j+1] != ']' {
+			hi, next, what := member(j + 1)
+			if what != "" {
+				return "", 0, what
+			}
+			items = append(items, lit+"-"+hi)
+			j = next
+			continue
+		}
+		switch lit {
+		case "]":
+			rbracket = true
+		case "^":
+			caret = true
+		case "-":
+			dash = true
+		default:
+			items = append(items, lit)
+		}
+	}
+	body := strings.Join(items, "")
+	if strings.ContainsRune(body, 0) {
+		return "", 0, "a NUL character"
+	}
+	switch {
+	case body == "" && !rbracket && caret && !neg && !dash:
+		return "\\^", j, ""
+	case body == "" && !rbracket && caret:
+		// [-^] / [^-^]：^ 不在最前面
+		body, caret, dash = "-", false, false
+		body += "^"
+	}
+	out := "["
+	if neg {
+		out += "^"
+	}
+	if rbracket {
+		out += "]"
+	}
+	out += body
+	if caret {
+		out += "^"
+	}
+	if dash {
+		out += "-"
+	}
+	return out + "]", j, ""
+}
+
+// replacement: re.sub 的替换字符串：\g<name> 换成组号，检查引用的组存在；运行时 py_re_expand 处理 \N 与 \g<N>
+func (p *rePattern) replacement(repl string) (string, string) {
+	var out strings.Builder
+	for i := 0; i < len(repl); i++ {
+		if repl[i] != '\\' || i+1 == len(repl) {
+			out.WriteByte(repl[i])
+			continue
+		}
+		group := -1
+		switch e := repl[i+1]; {
+		case e >= '1' && e <= '9':
+			group = int(e - '0')
+			out.WriteString(repl[i : i+2])
+			i++
+		case e == 'g':
+			end := strings.IndexByte(repl[i:], '>')
+			if !strings.HasPrefix(repl[i:], "\\g<") || end < 0 {
+				return "", "the malformed group reference in " + strconv.Quote(repl)
+			}
+			ref := repl[i+3 : i+end]
+			n, err := strconv.Atoi(ref)
+			if err != nil {
+				if j, ok := p.names[ref]; ok {
+					n = j
+				} else {
+					return "", "the unknown group name " + ref + " in " + strconv.Quote(repl)
+				}
+			}
+			group = n
+			out.WriteString(fmt.Sprintf("\\g<%d>", n))
+			i += end
+		default:
+			out.WriteString(repl[i : i+2])
+			i++
+		}
+		if group >= len(p.groups) {
+			return "", fmt.Sprintf("the invalid group reference %d in %s", group, strconv.Quote(repl))
+		}
+	}
+	return out.String(), ""
+}
+
+// --- 运行时 ---
+
+// reRuntime: PyRegex、PyMatch 与匹配、取组、替换的函数（放在 classStructs 中，在各个模式之前）
+func (g *generator) reRuntime() {
+	if g.copyFuncs["py_re"] {
+		return
+	}
+	g.copyFuncs["py_re"] = true
+	g.includes["regex.h"] = true
+	g.includes["stdio.h"] = true
+	g.includes["stdlib.h"] = true
+	g.strHelper("py_str_replace") // py_str_put
+	g.classStructs = append(g.classStructs, fmt.Sprintf(`// the re module: patterns converted to POSIX extended regular expressions, compiled on first use
+#define PY_RE_GROUPS %[1]d
+typedef struct {
+    const char* pattern;
+    int flags;
+    const int* groups; /* the POSIX group of each Python group: (?:...) is a group in POSIX too */
+    int ngroups; /* the Python groups, not counting group 0 */
+    const char** names; /* the name of each Python group, NULL without (?P<name>...) */
+    int ready;
+    regex_t re;
+} PyRegex;
+// the result of re.match / re.search / re.fullmatch: ok is 0 for None; s is the string that was searched, not a copy
+typedef struct {
+    int ok;
+    const char* s;
+    PyRegex* re;
+    regmatch_t m[PY_RE_GROUPS];
+} PyMatch;
+static regex_t* py_re_compile(PyRegex* r) {
+    if (!r->ready) {
+        int err = regcomp(&r->re, r->pattern, r->flags);
+        if (err != 0) {
+            char msg[256];
+            regerror(err, &r->re, msg, sizeof msg);
+            fprintf(stderr, "re.error: %%s in the pattern %%s\n", msg, r->pattern);
+            exit(1);
+        }
+        r->ready = 1;
+    }
+    return &r->re;
+}
+// search s from pos, where ^ does not match; the offsets in m count from the start of s
+static int py_re_exec(PyRegex* r, const char* s, size_t pos, regmatch_t* m) {
+    int i;
+    if (regexec(py_re_compile(r), s + pos, PY_RE_GROUPS, m, pos > 0 ? REG_NOTBOL : 0) != 0) {
+        return 0;
+    }
+    for (i = 0; i < PY_RE_GROUPS; i++) {
+        if (m[i].rm_so >= 0) {
+            m[i].rm_so += (regoff_t)pos;
+            m[i].rm_eo += (regoff_t)pos;
+        }
+    }
+    return 1;
+}
+// re.search (anchor 0), re.match (1: the match starts at the beginning) and re.fullmatch (2: it also ends at the end);
+// POSIX finds the leftmost match, so it starts at the beginning whenever a match there exists
+static PyMatch py_re_match(PyRegex* r, const char* s, int anchor) {
+    PyMatch m;
+    m.s = s;
+    m.re = r;
+    m.ok = py_re_exec(r, s, 0, m.m) && (anchor == 0 || m.m[0].rm_so == 0) && (anchor < 2 || s[m.m[0].rm_eo] == '\0');
+    return m;
+}
+// the Python group i of m, or the group called name when it is not NULL
+static regmatch_t py_re_span(PyMatch m, int i, const char* name) {
+    if (!m.ok) {
+        %[2]s
+    }
+    if (name) {
+        for (i = m.re->ngroups; i > 0 && !(m.re->names && m.re->names[i] && strcmp(m.re->names[i], name) == 0); i--) {
+        }
+        if (i == 0) {
+            %[3]s
+        }
+    }
+    if (i < 0 || i > m.re->ngroups) {
+        %[3]s
+    }
+    return m.m[m.re->groups[i]];
+}
+// m.group(i): the text in a scratch buffer, NULL (None) when the group did not take part in the match
+static char* py_re_group(PyMatch m, int i, const char* name) {
+    regmatch_t g = py_re_span(m, i, name);
+    char* buf;
+    if (g.rm_so < 0) {
+        return NULL;
+    }
+    buf = %[4]s;
+    snprintf(buf, PY_STRBUF_SIZE, "%%.*s", (int)(g.rm_eo - g.rm_so), m.s + g.rm_so);
+    return buf;
+}
+static int py_re_start(PyMatch m, int i, const char* name) {
+    return (int)py_re_span(m, i, name).rm_so;
+}
+static int py_re_end(PyMatch m, int i, const char* name) {
+    return (int)py_re_span(m, i, name).rm_eo;
+}
+// str(m): <re.Match object; span=(0, 3), match='abc'>, or None
+static char* py_re_repr(PyMatch m) {
+    char* buf = %[4]s;
+    if (!m.ok) {
+        snprintf(buf, PY_STRBUF_SIZE, "None");
+        return buf;
+    }
+    snprintf(buf, PY_STRBUF_SIZE, "<re.Match object; span=(%%d, %%d), match='%%.*s'>", (int)m.m[0].rm_so, (int)m.m[0].rm_eo,
+             (int)(m.m[0].rm_eo - m.m[0].rm_so), m.s + m.m[0].rm_so);
+    return buf;
+}
+// the replacement of one match: \N and \g<N> are group N (empty when it did not take part), \n \t \r \\ are characters
+static size_t py_re_expand(char* buf, size_t n, const char* repl, const char* s, PyRegex* r, regmatch_t* m) {
+    const char* p;
+    for (p = repl; *p; p++) {
+        int i = -1;
+        if (p[0] == '\\' && p[1] >= '1' && p[1] <= '9') {
+            i = *++p - '0';
+        } else if (p[0] == '\\' && p[1] == 'g' && p[2] == '<' && strchr(p, '>')) {
+            i = atoi(p + 3);
+            p = strchr(p, '>');
+        } else if (p[0] == '\\' && p[1] && strchr("ntr\\", p[1])) {
+            p++;
+            n = py_str_put(buf, n, *p == 'n' ? "\n" : *p == 't' ? "\t" : *p == 'r' ? "\r" : "\\", 1);
+            continue;
+        }
+        if (i < 0) {
+            n = py_str_put(buf, n, p, 1);
+        } else if (i <= r->ngroups && m[r->groups[i]].rm_so >= 0) {
+            n = py_str_put(buf, n, s + m[r->groups[i]].rm_so, (size_t)(m[r->groups[i]].rm_eo - m[r->groups[i]].rm_so));
+        }
+    }
+    return n;
+}
+// the next match at or after *pos, as Python 3.7 finds them: an empty match may follow the previous match,
+// but not another empty match at the same position
+static int py_re_next(PyRegex* r, const char* s, size_t* pos, int* advance, regmatch_t* m) {
+    size_t len = strlen(s);
+    while (*pos <= len && py_re_exec(r, s, *pos, m)) {
+        if (*advance && m[0].rm_so == m[0].rm_eo && (size_t)m[0].rm_so == *pos) {
+            *pos += 1;
+            *advance = 0;
+            continue;
+        }
+        *pos = (size_t)m[0].rm_eo;
+        *advance = m[0].rm_so == m[0].rm_eo;
+        return 1;
+    }
+    return 0;
+}
+// re.sub: the first count matches (all when count is 0) replaced by repl, in a scratch buffer
+static char* py_re_sub(PyRegex* r, const char* repl, const char* s, int count) {
+    char* buf = %[4]s;
+    size_t n = py_str_put(buf, 0, "", 0), pos = 0, last = 0;
+    regmatch_t m[PY_RE_GROUPS];
+    int advance = 0, done = 0;
+    while ((count == 0 || done < count) && py_re_next(r, s, &pos, &advance, m)) {
+        n = py_str_put(buf, n, s + last, (size_t)m[0].rm_so - last);
+        n = py_re_expand(buf, n, repl, s, r, m);
+        last = (size_t)m[0].rm_eo;
+        done++;
+    }
+    py_str_put(buf, n, s + last, strlen(s) - last);
+    return buf;
+}
+`, reMaxGroups, g.runtimeError("AttributeError", "'NoneType' object has no attribute 'group'"), g.runtimeError("IndexError", "no such group"), g.strBuf()))
+}
+
+// reFindall: re.findall 返回新的字符串列表，和列表类型一起输出在结构体之后
+func (g *generator) reFindall() {
+	lt := strings.TrimSuffix(g.listType("char*"), "*")
+	if g.copyFuncs["py_re_findall"] {
+		return
+	}
+	g.copyFuncs["py_re_findall"] = true
+	g.classStructs = append(g.classStructs, fmt.Sprintf(`// re.findall: the text of each match, or of group 1 when the pattern has a group ('' when it did not take part)
+static %[1]s* py_re_findall(PyRegex* r, const char* s) {
+    %[1]s* l = %[1]s_new();
+    char* piece = (char*)malloc(strlen(s) + 1);
+    size_t pos = 0;
+    regmatch_t m[PY_RE_GROUPS];
+    int advance = 0;
+    while (py_re_next(r, s, &pos, &advance, m)) {
+        regmatch_t g = m[r->groups[r->ngroups > 0 ? 1 : 0]];
+        size_t n = g.rm_so < 0 ? 0 : (size_t)(g.rm_eo - g.rm_so);
+        memcpy(piece, s + (g.rm_so < 0 ? 0 : g.rm_so), n);
+        piece[n] = '\0';
+        %[1]s_append(l, %[2]s(piece));
+    }
+    free(piece);
+    return l;
+}
+`, lt, g.strDup()))
+}
@@ -0,0 +1,710 @@
+package py2c
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NamedTuple 与 Enum。lowerRecords 在其他分析之前把顶层的 NamedTuple 类与 namedtuple() 改写为普通的类：
+//
+//	class Point(NamedTuple):        class Point:
+//	    x: float                        def __init__(self, x: float, y: float):
+//	    y: float = 0.0                      self.x = x
+//	                                        self.y = y
+//
+// 之后按类来翻译（结构体、按位置的构造函数、Point(x=..., y=...) 的输出）。构造调用中的关键字参数与默认值
+// 在改写时换成按位置的实参；p[0]、x, y = p 按字段的位置访问，p._replace(x=1) 是新的构造调用。
+// Enum / IntEnum / StrEnum 的类翻译为 C 的 enum：成员是 Color_RED 常量，.name、.value、Color(v)、
+// Color["RED"] 与 for c in Color 使用第一次用到时生成的辅助函数
+
+// record: NamedTuple 的字段
+type record struct {
+	fields   []string
+	defaults []interface{} // 对应字段的默认值，没有默认值时为 nil
+}
+
+// enumClass: Enum 类与它的成员
+type enumClass struct {
+	name    string
+	kind    string          // Enum、IntEnum 或 StrEnum
+	typ     string          // .value 的类型：int 或 char*
+	members []enumMember    // 按定义顺序
+	helpers map[string]bool // 已经生成的辅助函数
+	defined bool            // typedef 已经输出
+	pending []string        // typedef 之前（分析阶段）用到的辅助函数，跟在 typedef 之后输出
+}
+
+// enumMember: Enum 的成员
+type enumMember struct {
+	name  string
+	value string // int 的成员是 C 的整数常量，字符串的成员是 C 的字符串字面量
+	alias string // 与前面的成员同值时是那个成员的名字（Python 中是它的别名）
+}
+
+// lowerRecords: 顶层的 NamedTuple 类与 namedtuple() 赋值改写为普通的类，登记 Enum 类的成员
+func (g *generator) lowerRecords(root ASTNode) {
+	body, _ := root["body"].([]interface{})
+	for _, stmt := range body {
+		m, _ := stmt.(map[string]interface{})
+		switch m["_type"] {
+		case "ClassDef":
+			bases, _ := m["bases"].([]interface{})
+			if len(bases) != 1 {
+				continue
+			}
+			switch base := g.importedName(bases[0]); base {
+			case "typing.NamedTuple":
+				g.namedTupleClass(m)
+			case "enum.Enum", "enum.IntEnum", "enum.StrEnum":
+				g.collectEnum(m, strings.TrimPrefix(base, "enum."))
+			}
+		case "Assign":
+			g.namedTupleCall(m)
+		}
+	}
+	if len(g.records) > 0 {
+		g.recordCalls(root)
+	}
+}
+
+// importedName: import 绑定的名字（Name）或模块的属性（Attribute）的全名，如 typing.NamedTuple；不是时为空
+func (g *generator) importedName(node interface{}) string {
+	m, _ := node.(map[string]interface{})
+	switch m["_type"] {
+	case "Name":
+		return g.importNames[fmt.Sprint(m["id"])]
+	case "Attribute":
+		if recv, _ := m["value"].(map[string]interface{}); recv["_type"] == "Name" {
+			if module := g.importNames[fmt.Sprint(recv["id"])]; module != "" && !strings.Contains(module, ".") {
+				return fmt.Sprintf("%s.%v", module, m["attr"])
+			}
+		}
+	}
+	return ""
+}
+
+// --- NamedTuple ---
+
+// namedTupleClass: class P(NamedTuple) 的带注解的字段改为 __init__ 的参数，方法与类属性保留
+func (g *generator) namedTupleClass(cls map[string]interface{}) {
+	name, _ := cls["name"].(string)
+	r := &record{}
+	var params, kept []interface{}
+	for i, s := range cls["body"].([]interface{}) {
+		sm, _ := s.(map[string]interface{})
+		if _, ok := docstring([]interface{}{s}); ok && i == 0 {
+			kept = append(kept, s)
+			continue
+		}
+		switch sm["_type"] {
+		case "AnnAssign":
+			target, _ := sm["target"].(map[string]interface{})
+			field, _ := target["id"].(string)
+			if target["_type"] != "Name" {
+				g.report(logError, sm, "unsupported field of NamedTuple class %s (the target is not a name)", name)
+				continue
+			}
+			r.fields = append(r.fields, field)
+			r.defaults = append(r.defaults, g.recordDefault(sm["value"], name, field))
+			params = append(params, recordParam(field, sm["annotation"], sm))
+		case "Pass":
+		case "FunctionDef":
+			if fn := sm["name"]; fn == "__init__" || fn == "__new__" {
+				g.report(logError, sm, "unsupported %v in NamedTuple class %s: the fields are set by the generated constructor", fn, name)
+				continue
+			}
+			kept = append(kept, s)
+		default:
+			kept = append(kept, s)
+		}
+	}
+	init := recordInit(r.fields, params, cls)
+	if _, ok := docstring(kept); ok {
+		kept = append(kept[:1], append([]interface{}{init}, kept[1:]...)...)
+	} else {
+		kept = append([]interface{}{init}, kept...)
+	}
+	cls["bases"] = []interface{}{}
+	cls["body"] = kept
+	g.records[name] = r
+}
+
+// namedTupleCall: P = namedtuple("P", "x y") / namedtuple("P", ["x", "y"], defaults=[...])
+// 与 P = NamedTuple("P", [("x", int), ("y", float)]) 原地换成类定义
+func (g *generator) namedTupleCall(assign map[string]interface{}) {
+	call, _ := assign["value"].(map[string]interface{})
+	q := g.importedName(call["func"])
+	if call["_type"] != "Call" || q != "collections.namedtuple" && q != "typing.NamedTuple" {
+		return
+	}
+	fn := strings.SplitN(q, ".", 2)[1]
+	targets, _ := assign["targets"].([]interface{})
+	target, _ := targets[0].(map[string]interface{})
+	name, _ := target["id"].(string)
+	args, _ := call["args"].([]interface{})
+	if len(targets) != 1 || target["_type"] != "Name" || len(args) != 2 {
+		g.report(logError, call, "unsupported %s() that is not assigned to a name with the type name and the fields as its arguments", fn)
+		return
+	}
+	r := &record{}
+	var params []interface{}
+	var fields []interface{}
+	switch spec, _ := args[1].(map[string]interface{}); spec["_type"] {
+	case "Constant":
+		// "x y" 或 "x, y"
+		s, _ := spec["value"].(string)
+		for _, f := range strings.Fields(strings.ReplaceAll(s, ",", " ")) {
+			fields = append(fields, map[string]interface{}{"_type": "Constant", "value": f})
+		}
+	case "List", "Tuple":
+		fields, _ = spec["elts"].([]interface{})
+	}
+	for _, f := range fields {
+		fm, _ := f.(map[string]interface{})
+		var annot interface{}
+		if fm["_type"] == "Tuple" && fn == "NamedTuple" {
+			// ("x", int)
+			if elts, _ := fm["elts"].([]interface{}); len(elts) == 2 {
+				fm, _ = elts[0].(map[string]interface{})
+				annot = elts[1]
+			}
+		}
+		field, ok := fm["value"].(string)
+		if fm["_type"] != "Constant" || !ok {
+			g.report(logError, args[1], "unsupported %s() whose fields are not constant names", fn)
+			return
+		}
+		r.fields = append(r.fields, field)
+		params = append(params, recordParam(field, annot, call))
+	}
+	r.defaults = make([]interface{}, len(r.fields))
+	for _, kw := range call["keywords"].([]interface{}) {
+		km, _ := kw.(map[string]interface{})
+		value, _ := km["value"].(map[string]interface{})
+		if km["arg"] != "defaults" || fn != "namedtuple" {
+			g.report(logError, km, "unsupported keyword argument %v of %s()", km["arg"], fn)
+			continue
+		}
+		// defaults 对应最后的几个字段
+		values, _ := value["elts"].([]interface{})
+		if value["_type"] != "List" && value["_type"] != "Tuple" || len(values) > len(r.fields) {
+			g.report(logError, km, "unsupported defaults of namedtuple() that is not a list of at most %d values", len(r.fields))
+			continue
+		}
+		for i, v := range values {
+			at := len(r.fields) - len(values) + i
+			r.defaults[at] = g.recordDefault(v, name, r.fields[at])
+		}
+	}
+	replaceNode(assign, map[string]interface{}{
+		"_type": "ClassDef", "name": name, "bases": []interface{}{}, "keywords": []interface{}{},
+		"body": []interface{}{recordInit(r.fields, params, assign)}, "decorator_list": []interface{}{},
+	})
+	g.records[name] = r
+}
+
+// recordDefault: 字段的默认值；只支持常量（在每个调用点重新求值）
+func (g *generator) recordDefault(value interface{}, class, field string) interface{} {
+	v, _ := value.(map[string]interface{})
+	if v == nil {
+		return nil
+	}
+	if op, _ := v["op"].(map[string]interface{}); v["_type"] == "Constant" || v["_type"] == "UnaryOp" && op["_type"] == "USub" && v["operand"].(map[string]interface{})["_type"] == "Constant" {
+		return v
+	}
+	g.report(logError, v, "unsupported default value of %s.%s that is not a constant", class, field)
+	return nil
+}
+
+// recordParam: __init__ 的参数 field（注解可以为空），位置取 at 的位置
+func recordParam(field string, annot interface{}, at map[string]interface{}) interface{} {
+	return withPos(map[string]interface{}{"_type": "arg", "arg": field, "annotation": annot}, at)
+}
+
+// recordInit: 依次给字段赋值的 __init__；params 是除 self 之外的参数
+func recordInit(fields []string, params []interface{}, at map[string]interface{}) map[string]interface{} {
+	body := []interface{}{}
+	for i, f := range fields {
+		self := map[string]interface{}{"_type": "Attribute", "value": cName("self"), "attr": f, "ctx": map[string]interface{}{"_type": "Store"}}
+		body = append(body, withPos(map[string]interface{}{"_type": "Assign", "targets": []interface{}{self}, "value": cName(f)}, params[i].(map[string]interface{})))
+	}
+	if len(body) == 0 {
+		body = append(body, withPos(map[string]interface{}{"_type": "Pass"}, at))
+	}
+	self := withPos(map[string]interface{}{"_type": "arg", "arg": "self"}, at)
+	args := map[string]interface{}{
+		"_type": "arguments", "posonlyargs": []interface{}{}, "args": append([]interface{}{self}, params...),
+		"kwonlyargs": []interface{}{}, "kw_defaults": []interface{}{}, "defaults": []interface{}{},
+	}
+	return withPos(map[string]interface{}{"_type": "FunctionDef", "name": "__init__", "args": args, "body": body, "decorator_list": []interface{}{}}, at)
+}
+
+// withPos: 给生成的节点 n 加上 at 的源码位置
+func withPos(n, at map[string]interface{}) map[string]interface{} {
+	for _, k := range []string{"lineno", "col_offset", "end_lineno", "end_col_offset"} {
+		if v, ok := at[k]; ok {
+			n[k] = v
+		}
+	}
+	return n
+}
+
+// recordCalls: NamedTuple 的构造调用补上默认值，关键字参数按字段换到对应的位置
+func (g *generator) recordCalls(node interface{}) {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			g.recordCalls(e)
+		}
+	case ASTNode:
+		g.recordCalls(map[string]interface{}(n))
+	case map[string]interface{}:
+		for _, k := range sortedKeys(n) {
+			g.recordCalls(n[k])
+		}
+		fn, _ := n["func"].(map[string]interface{})
+		if r := g.records[fmt.Sprint(fn["id"])]; n["_type"] == "Call" && fn["_type"] == "Name" && r != nil {
+			g.recordCallArgs(n, fmt.Sprint(fn["id"]), r)
+		}
+	}
+}
+
+// recordCallArgs: 把 call 的实参换成按字段顺序的完整列表；参数不对时报告错误，不改动调用
+func (g *generator) recordCallArgs(call map[string]interface{}, name string, r *record) {
+	args, _ := call["args"].([]interface{})
+	keywords, _ := call["keywords"].([]interface{})
+	if len(keywords) == 0 && len(args) == len(r.fields) {
+		return
+	}
+	for _, a := range args {
+		if am, _ := a.(map[string]interface{}); am["_type"] == "Starred" {
+			return
+		}
+	}
+	if len(args) > len(r.fields) {
+		g.report(logError, call, "%s() takes %d arguments but %d were given", name, len(r.fields), len(args))
+		return
+	}
+	full := make([]interface{}, len(r.fields))
+	copy(full, args)
+	for _, kw := range keywords {
+		km, _ := kw.(map[string]interface{})
+		at := -1
+		for i, f := range r.fields {
+			if km["arg"] == f {
+				at = i
+			}
+		}
+		if at < 0 || full[at] != nil {
+			g.report(logError, km, "%s() got an unexpected or repeated keyword argument %v", name, km["arg"])
+			return
+		}
+		full[at] = km["value"]
+	}
+	for i, a := range full {
+		if a != nil {
+			continue
+		}
+		if r.defaults[i] == nil {
+			g.report(logError, call, "%s() is missing the argument %s", name, r.fields[i])
+			return
+		}
+		full[i] = deepCopyNode(r.defaults[i])
+	}
+	call["args"] = full
+	call["keywords"] = []interface{}{}
+}
+
+// recordOf: 类型 t（Point 或 Point*）是 NamedTuple 时返回它
+func (g *generator) recordOf(t string) *record {
+	return g.records[strings.TrimSuffix(t, "*")]
+}
+
+// recordField: p[0]、p[-1] 等常量下标对应的字段访问；p 不是 NamedTuple 时为 nil
+func (g *generator) recordField(value, slice interface{}) map[string]interface{} {
+	r := g.recordOf(g.getType(value))
+	if r == nil || !isIntConst(slice) {
+		return nil
+	}
+	i, _ := strconv.Atoi(g.toC(slice.(map[string]interface{}), 0))
+	if i < 0 {
+		i += len(r.fields)
+	}
+	if i < 0 || i >= len(r.fields) {
+		return nil
+	}
+	return map[string]interface{}{"_type": "Attribute", "value": value, "attr": r.fields[i], "ctx": map[string]interface{}{"_type": "Load"}}
+}
+
+// recordReplace: p._replace(x=1) 换成构造调用 Point(1, p.y)；p 必须是变量。不是时为 nil
+func (g *generator) recordReplace(call map[string]interface{}) (map[string]interface{}, string) {
+	fn, _ := call["func"].(map[string]interface{})
+	if call["_type"] != "Call" || fn["_type"] != "Attribute" || fn["attr"] != "_replace" {
+		return nil, ""
+	}
+	class := strings.TrimSuffix(g.getType(fn["value"]), "*")
+	r := g.records[class]
+	if r == nil {
+		return nil, ""
+	}
+	recv, _ := fn["value"].(map[string]interface{})
+	if args, _ := call["args"].([]interface{}); recv["_type"] != "Name" || len(args) > 0 {
+		return nil, "_replace() on an expression that is not a variable or with positional arguments"
+	}
+	values := make([]interface{}, len(r.fields))
+	for _, kw := range call["keywords"].([]interface{}) {
+		km, _ := kw.(map[string]interface{})
+		for i, f := range r.fields {
+			if km["arg"] == f {
+				values[i] = km["value"]
+			}
+		}
+	}
+	for i, f := range r.fields {
+		if values[i] == nil {
+			values[i] = map[string]interface{}{"_type": "Attribute", "value": recv, "attr": f, "ctx": map[string]interface{}{"_type": "Load"}}
+		}
+	}
+	return withPos(map[string]interface{}{"_type": "Call", "func": cName(class), "args": values, "keywords": []interface{}{}}, call), ""
+}
+
+// --- Enum ---
+
+// collectEnum: 登记 Enum 类的成员（NAME = 常量或 auto()），类体只留下文档字符串
+func (g *generator) collectEnum(cls map[string]interface{}, kind string) {
+	name, _ := cls["name"].(string)
+	e := &enumClass{name: name, kind: kind, helpers: map[string]bool{}}
+	kept := []interface{}{}
+	first := map[string]string{} // 值 -> 第一个有这个值的成员
+	next := 1                    // auto() 在 int 的成员中是上一个值加一
+	for i, s := range cls["body"].([]interface{}) {
+		sm, _ := s.(map[string]interface{})
+		if _, ok := docstring([]interface{}{s}); ok && i == 0 {
+			kept = append(kept, s)
+			continue
+		}
+		if sm["_type"] == "Pass" {
+			continue
+		}
+		targets, _ := sm["targets"].([]interface{})
+		var target map[string]interface{}
+		if len(targets) == 1 {
+			target, _ = targets[0].(map[string]interface{})
+		}
+		member, _ := target["id"].(string)
+		if sm["_type"] != "Assign" || target["_type"] != "Name" {
+			what := "statement"
+			if sm["_type"] == "FunctionDef" {
+				what = fmt.Sprintf("method %v()", sm["name"])
+			}
+			g.report(logError, sm, "unsupported %s in Enum class %s (only NAME = value members are translated)", what, name)
+			continue
+		}
+		value, typ := g.enumValue(sm["value"], member, kind, &next)
+		if value == "" || e.typ != "" && typ != e.typ {
+			g.report(logError, sm["value"], "unsupported value of %s.%s (%s)", name, member, enumValueKinds[kind])
+			continue
+		}
+		e.typ = typ
+		m := enumMember{name: member, value: value, alias: first[value]}
+		if m.alias == "" {
+			first[value] = member
+		}
+		e.members = append(e.members, m)
+	}
+	if len(e.members) == 0 {
+		g.report(logError, cls, "unsupported Enum class %s without members", name)
+		return
+	}
+	if len(kept) == 0 {
+		kept = append(kept, withPos(map[string]interface{}{"_type": "Pass"}, cls))
+	}
+	cls["bases"] = []interface{}{}
+	cls["body"] = kept
+	g.enums[name] = e
+}
+
+// enumValueKinds: 各种 Enum 的成员可以有的值
+var enumValueKinds = map[string]string{
+	"Enum":    "the values of Enum members are all int or all str, or auto()",
+	"IntEnum": "the values of IntEnum members are int or auto()",
+	"StrEnum": "the values of StrEnum members are str or auto()",
+}
+
+// enumValue: 成员 member 的值（C 的常量）与类型；不支持的值为空
+func (g *generator) enumValue(node interface{}, member, kind string, next *int) (string, string) {
+	m, _ := node.(map[string]interface{})
+	if m["_type"] == "Call" && g.importedName(m["func"]) == "enum.auto" {
+		if kind == "StrEnum" {
+			// StrEnum 的 auto() 是小写的成员名
+			return fmt.Sprintf("\"%s\"", cEscape(strings.ToLower(member))), "char*"
+		}
+		*next++
+		return fmt.Sprint(*next - 1), "int"
+	}
+	if s, ok := m["value"].(string); ok && m["_type"] == "Constant" && kind != "IntEnum" {
+		return fmt.Sprintf("\"%s\"", cEscape(s)), "char*"
+	}
+	if !isIntConst(m) || kind == "StrEnum" {
+		return "", ""
+	}
+	sign := ""
+	if m["_type"] == "UnaryOp" {
+		sign, m = "-", m["operand"].(map[string]interface{})
+	}
+	v := sign + m["value"].(json.Number).String()
+	fmt.Sscan(v, next)
+	*next++
+	return v, "int"
+}
+
+// enumOf: node 是 Enum 类的名字时返回这个类
+func (g *generator) enumOf(node interface{}) *enumClass {
+	m, _ := node.(map[string]interface{})
+	if id, _ := m["id"].(string); m["_type"] == "Name" && g.localVar(id) == nil {
+		return g.enums[id]
+	}
+	return nil
+}
+
+// enumDef: Enum 类的 typedef enum；别名与它的成员是同一个常量
+func (g *generator) enumDef(node ASTNode) string {
+	e := g.enums[node["name"].(string)]
+	var lines []string
+	for _, m := range e.members {
+		switch {
+		case m.alias != "":
+			lines = append(lines, fmt.Sprintf("    %s_%s = %s_%s", e.name, m.name, e.name, m.alias))
+		case e.typ == "int":
+			lines = append(lines, fmt.Sprintf("    %s_%s = %s", e.name, m.name, m.value))
+		default:
+			lines = append(lines, fmt.Sprintf("    %s_%s", e.name, m.name))
+		}
+	}
+	code := fmt.Sprintf("typedef enum {\n%s\n} %s;\n", join(lines, ",\n"), e.name)
+	g.classStructs = append(g.classStructs, g.annotation(node, 0)+g.docComment(node["body"], "")+code)
+	g.classStructs = append(g.classStructs, e.pending...)
+	e.defined, e.pending = true, nil
+	return ""
+}
+
+// enumHelper: Enum 的辅助函数 Color_name 等，第一次用到时生成；返回函数（或数组）名
+func (g *generator) enumHelper(e *enumClass, helper string) string {
+	fn := e.name + "_" + helper
+	if e.helpers[helper] {
+		return fn
+	}
+	e.helpers[helper] = true
+	var cases, names, members []string
+	strValues := e.typ == "char*"
+	for _, m := range e.members {
+		names = append(names, fmt.Sprintf("    if (strcmp(v, \"%s\") == 0) {\n        return %s_%s;\n    }\n", m.name, e.name, m.name))
+		if m.alias != "" {
+			continue
+		}
+		var result string
+		switch helper {
+		case "name":
+			result = fmt.Sprintf("\"%s\"", m.name)
+		case "str":
+			result = fmt.Sprintf("\"%s.%s\"", e.name, m.name)
+		case "repr":
+			value := m.value
+			if strValues {
+				value = "'" + strings.Trim(value, "\"") + "'"
+			}
+			result = fmt.Sprintf("\"<%s.%s: %s>\"", e.name, m.name, value)
+		case "value":
+			result = m.value
+		}
+		cases = append(cases, fmt.Sprintf("    case %s_%s:\n        return %s;\n", e.name, m.name, result))
+		members = append(members, e.name+"_"+m.name)
+		if helper == "of" && strValues {
+			cases[len(cases)-1] = fmt.Sprintf("    if (strcmp(v, %s) == 0) {\n        return %s_%s;\n    }\n", m.value, e.name, m.name)
+		} else if helper == "of" {
+			cases[len(cases)-1] = fmt.Sprintf("    case %s:\n        return %s_%s;\n", m.value, e.name, m.name)
+		}
+	}
+	fail := func(exc, msg string) string {
+		return "    " + strings.ReplaceAll(g.runtimeError(exc, msg), "\n        ", "\n    ") + "\n"
+	}
+	switcher := func(ret, param, doc string) string {
+		return fmt.Sprintf("// %s\nstatic %s %s(%s v) {\n    switch (v) {\n%s    }\n    return \"\";\n}\n", doc, ret, fn, param, strings.Join(cases, ""))
+	}
+	code := ""
+	switch helper {
+	case "name":
+		code = switcher("char*", e.name, e.name+".name of the member v")
+	case "str":
+		code = switcher("char*", e.name, "str() of the "+e.name+" member v")
+	case "repr":
+		code = switcher("char*", e.name, "repr() of the "+e.name+" member v (in lists and NamedTuples)")
+	case "value":
+		code = switcher("char*", e.name, e.name+".value of the member v")
+	case "of":
+		param, body := "int", "    switch (v) {\n"+strings.Join(cases, "")+"    }\n"
+		if strValues {
+			g.includes["string.h"] = true
+			param, body = "char*", strings.Join(cases, "")
+		}
+		code = fmt.Sprintf("// %s(v): the member whose value is v\nstatic %s %s(%s v) {\n%s%s    return %s;\n}\n",
+			e.name, e.name, fn, param, body, fail("ValueError", "value is not a valid "+e.name), members[0])
+	case "lookup":
+		g.includes["string.h"] = true
+		code = fmt.Sprintf("// %s[v]: the member named v\nstatic %s %s(char* v) {\n%s%s    return %s;\n}\n",
+			e.name, e.name, fn, strings.Join(names, ""), fail("KeyError", "name is not a member of "+e.name), members[0])
+	case "members":
+		code = fmt.Sprintf("// the members of %s in definition order (without aliases)\nstatic %s %s[] = {%s};\n", e.name, e.name, fn, join(members, ", "))
+	}
+	if !e.defined {
+		e.pending = append(e.pending, code)
+		return fn
+	}
+	g.classStructs = append(g.classStructs, code)
+	return fn
+}
+
+// memberNamed: 名字为 name 的成员常量；没有时为空
+func (e *enumClass) memberNamed(name string) string {
+	for _, m := range e.members {
+		if m.name == name {
+			return e.name + "_" + m.name
+		}
+	}
+	return ""
+}
+
+// memberOf: 值为常量 node 的成员常量；不是常量或没有时为空
+func (e *enumClass) memberOf(node interface{}) string {
+	m, _ := node.(map[string]interface{})
+	value := ""
+	switch v := m["value"].(type) {
+	case string:
+		value = fmt.Sprintf("\"%s\"", cEscape(v))
+	case json.Number:
+		value = v.String()
+	}
+	for _, mem := range e.members {
+		if m["_type"] == "Constant" && mem.value == value {
+			return e.name + "_" + mem.name
+		}
+	}
+	return ""
+}
+
+// enumExprType: Enum 的成员、.name、.value、Color(v) 与 Color["RED"] 的类型；不是时为空
+func (g *generator) enumExprType(m map[string]interface{}) string {
+	switch m["_type"] {
+	case "Attribute":
+		if e := g.enumOf(m["value"]); e != nil {
+			return e.name
+		}
+		if e := g.enums[g.getType(m["value"])]; e != nil {
+			switch m["attr"] {
+			case "name":
+				return "char*"
+			case "value":
+				return e.typ
+			}
+		}
+	case "Call":
+		if e := g.enumOf(m["func"]); e != nil {
+			return e.name
+		}
+	case "Subscript":
+		if e := g.enumOf(m["value"]); e != nil {
+			return e.name
+		}
+	}
+	return ""
+}
+
+// enumAttr: Color.RED、c.name 与 c.value；不是时为空
+func (g *generator) enumAttr(node ASTNode) string {
+	attr, _ := node["attr"].(string)
+	if e := g.enumOf(node["value"]); e != nil {
+		if c := e.memberNamed(attr); c != "" {
+			return c
+		}
+		return g.unsupportedExpr(node, fmt.Sprintf("attribute %s of Enum class %s", attr, e.name))
+	}
+	e := g.enums[g.getType(node["value"])]
+	if e == nil || attr != "name" && attr != "value" {
+		return ""
+	}
+	value := g.toC(node["value"].(map[string]interface{}), 0)
+	switch {
+	case attr == "name":
+		return fmt.Sprintf("%s(%s)", g.enumHelper(e, "name"), value)
+	case e.typ == "int":
+		return fmt.Sprintf("(int)%s", value)
+	}
+	return fmt.Sprintf("%s(%s)", g.enumHelper(e, "value"), value)
+}
+
+// enumCall: Color(v)：按值找成员，常量直接换成成员常量
+func (g *generator) enumCall(e *enumClass, node ASTNode) string {
+	args, _ := node["args"].([]interface{})
+	if len(args) != 1 {
+		return g.unsupportedExpr(node, fmt.Sprintf("call of Enum class %s with %d arguments", e.name, len(args)))
+	}
+	if c := e.memberOf(args[0]); c != "" {
+		return c
+	}
+	return fmt.Sprintf("%s(%s)", g.enumHelper(e, "of"), g.toC(args[0].(map[string]interface{}), 0))
+}
+
+// enumLookup: Color["RED"]：按名字找成员，常量直接换成成员常量
+func (g *generator) enumLookup(e *enumClass, node ASTNode) string {
+	if s, _ := node["slice"].(map[string]interface{}); s["_type"] == "Constant" {
+		if c := e.memberNamed(fmt.Sprint(s["value"])); c != "" {
+			return c
+		}
+	}
+	return fmt.Sprintf("%s(%s)", g.enumHelper(e, "lookup"), g.toC(node["slice"].(map[string]interface{}), 0))
+}
+
+// enumFormat: print / str() 中的成员：Enum 是 Color.RED，IntEnum 是值（Python 3.11 起），StrEnum 是值的字符串
+func (g *generator) enumFormat(e *enumClass, expr string) (string, string) {
+	switch e.kind {
+	case "IntEnum":
+		return "%d", expr
+	case "StrEnum":
+		return "%s", fmt.Sprintf("%s(%s)", g.enumHelper(e, "value"), expr)
+	}
+	return "%s", fmt.Sprintf("%s(%s)", g.enumHelper(e, "str"), expr)
+}
+
+// handleForEnum: for c in Color：按定义顺序遍历成员（不含别名）
+func (g *generator) handleForEnum(node ASTNode, e *enumClass, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	if tm, _ := node["target"].(map[string]interface{}); tm["_type"] != "Name" {
+		return pad + g.unsupportedExpr(node, fmt.Sprintf("for loop over %s with a target that is not a variable", e.name)) + "\n"
+	}
+	members := g.enumHelper(e, "members")
+	count := 0
+	for _, m := range e.members {
+		if m.alias == "" {
+			count++
+		}
+	}
+	counter, decl := g.loopTemp("_e", "int")
+	if g.curGen != nil {
+		g.declareTemp(counter, "int")
+	}
+	target := g.toC(node["target"].(map[string]interface{}), 0)
+	code := ""
+	if !g.isDeclared(target) {
+		g.declareVar(target, e.name)
+		code += fmt.Sprintf("%s%s %s;\n", pad, e.name, target)
+	}
+	g.pushScope(scopeBlock, "for")
+	defer g.popScope()
+	restore := g.enterLoop()
+	loop := g.stmtsToC(node["body"].([]interface{}), indent+1)
+	restore()
+	return fmt.Sprintf("%s%sfor (%s = 0; %s < %d; %s++) {\n%s    %s = %s[%s];\n%s%s}\n",
+		code, pad, decl, counter, count, counter, pad, target, members, counter, loop, pad)
+}
@@ -0,0 +1,54 @@
+package py2c
+
+import "fmt"
+
+// -only / -exclude：大模块逐步移植时只翻译选中的顶层函数，其他函数只输出 extern 原型，由手写的 C 代码提供。
+// 对它们的调用照常生成，参数与返回值的类型仍按调用点与函数体推断，原型上方的注释写明 C 函数要遵守的约定
+
+// selectFunctions: 给没有选中的顶层函数加上 _extern；Only、Exclude 中不是顶层函数的名字给出警告
+func (g *generator) selectFunctions(root ASTNode) {
+	if g.optOnly == nil && g.optExclude == nil {
+		return
+	}
+	found := map[string]bool{}
+	body, _ := root["body"].([]interface{})
+	for _, s := range body {
+		m, _ := s.(map[string]interface{})
+		if m["_type"] != "FunctionDef" {
+			continue
+		}
+		name, _ := m["name"].(string)
+		found[name] = true
+		if g.optOnly != nil && g.optOnly[name] || g.optOnly == nil && !g.optExclude[name] {
+			continue
+		}
+		if stmts, _ := m["body"].([]interface{}); funcHasReturn(stmts) && returnsTuple(stmts) {
+			// 元组的结构体由函数体中的变量类型决定
+			g.report(logWarn, m, "%s returns a tuple, which hand-written C cannot declare: it is translated", name)
+			continue
+		}
+		m["_extern"] = true
+	}
+	for _, opt := range []struct {
+		flag  string
+		names map[string]bool
+	}{{"only", g.optOnly}, {"exclude", g.optExclude}} {
+		for _, name := range sortedKeys(opt.names) {
+			if !found[name] {
+				g.report(logWarn, nil, "-%s: there is no top-level function %s", opt.flag, name)
+			}
+		}
+	}
+}
+
+// externFunc: 没有选中的函数 f 的原型，前面是 Python 的文档字符串和调用约定
+func (g *generator) externFunc(f *irFunc, node ASTNode, pad string) string {
+	note := "provided by hand-written C (left out by -only/-exclude)"
+	if f.hasResult() {
+		note += "; it stores the return value through result"
+	}
+	if f.ret == "int" {
+		note += "; it returns PY_OK or the code of the exception raised"
+	}
+	return g.docComment(node["body"], pad) + fmt.Sprintf("%s// %s: %s\n%sextern %s", pad, f.name, note, pad, g.emit.emitPrototype(f))
+}
@@ -0,0 +1,79 @@
+package py2c
+
+import (
+	"fmt"
+	"strings"
+)
+
+// -stub-unsupported：不能翻译的代码不再只留下注释，而是换成调用 py_not_implemented：运行到这里时
+// 输出 "NOT IMPLEMENTED: 写法 at foo.py:42" 后 abort。部分移植的程序仍然能编译，在没有翻译的地方失败。
+// 诊断照常报告（-strict 仍然失败）
+
+// notImplemented: 到达不能翻译的代码时输出的消息
+func (g *generator) notImplemented(node interface{}, what string) string {
+	where := g.pyFile
+	if where == "" {
+		where = "<input>"
+	}
+	// 与 addDiag 一样：节点没有行号时取所在语句的
+	if m := stubNode(node); m != nil && m["lineno"] != nil {
+		where += fmt.Sprintf(":%v", m["lineno"])
+	} else if g.diagStmt != nil && g.diagStmt["lineno"] != nil {
+		where += fmt.Sprintf(":%v", g.diagStmt["lineno"])
+	}
+	if g.optFreestanding {
+		g.runtimeHelpers["py_not_implemented"] = `// -stub-unsupported: code py2c could not translate; without a C library there is no abort, so stop here
+extern void putstr(const char* s);
+static void py_not_implemented(const char* msg) {
+    putstr(msg);
+    putstr("\n");
+    for (;;) {
+    }
+}
+`
+	} else {
+		g.includes["stdlib.h"] = true
+		g.runtimeHelpers["py_not_implemented"] = `// -stub-unsupported: code py2c could not translate, reached at run time
+static void py_not_implemented(const char* msg) {
+    fflush(stdout);
+    fprintf(stderr, "%s\n", msg);
+    abort();
+}
+`
+	}
+	return fmt.Sprintf("py_not_implemented(\"NOT IMPLEMENTED: %s at %s\")", cEscape(what), cEscape(where))
+}
+
+// stubExpr: 代替不能翻译的表达式：先调用 py_not_implemented，再给出节点类型的值，放在哪里都能编译
+func (g *generator) stubExpr(node interface{}, what string) string {
+	call := g.notImplemented(node, what)
+	typ := g.getType(stubNode(node))
+	switch {
+	case typ == "void":
+		return call
+	case strings.HasSuffix(typ, "*") || typ == "int" || typ == "double" || typ == "long long" || typ == "char" || typ == "bool":
+		return fmt.Sprintf("(%s, (%s)0)", call, typ)
+	}
+	// 结构体等不能由 0 转换的类型：不会执行到的解引用
+	return fmt.Sprintf("(%s, *(%s*)0)", call, typ)
+}
+
+// stubNode: node 作为 map，不是节点时为 nil
+func stubNode(node interface{}) map[string]interface{} {
+	switch m := node.(type) {
+	case ASTNode:
+		return m
+	case map[string]interface{}:
+		return m
+	}
+	return nil
+}
+
+// exprNodes: Python 的表达式节点；handleUnsupported 遇到它们时 stub 要是表达式
+var exprNodes = map[string]bool{
+	"BoolOp": true, "NamedExpr": true, "BinOp": true, "UnaryOp": true, "Lambda": true, "IfExp": true,
+	"Dict": true, "Set": true, "ListComp": true, "SetComp": true, "DictComp": true, "GeneratorExp": true,
+	"Await": true, "Yield": true, "YieldFrom": true, "Compare": true, "Call": true, "FormattedValue": true,
+	"JoinedStr": true, "Constant": true, "Attribute": true, "Subscript": true, "Starred": true, "Name": true,
+	"List": true, "Tuple": true, "Slice": true,
+}
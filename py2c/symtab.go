@@ -0,0 +1,235 @@
+package py2c
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// scopeKind: 符号表作用域的种类
+type scopeKind int
+
+const (
+	scopeModule        scopeKind = iota // 模块顶层：主模块在 main 中，其他模块在 模块名_module_init 中
+	scopeFunction                       // 函数、方法体
+	scopeClass                          // 类体：字段与类属性，方法体中不可见（和 Python 一样）
+	scopeBlock                          // if / for / while 生成的 C 块，块里的声明出了块就不可见
+	scopeComprehension                  // 生成器表达式的循环变量，只在表达式内可见
+)
+
+func (k scopeKind) String() string {
+	return [...]string{"module", "function", "class", "block", "comprehension"}[k]
+}
+
+// nested: 块与生成器表达式在所在函数的 C 代码里面，外层的声明在其中可见
+func (k scopeKind) nested() bool {
+	return k == scopeBlock || k == scopeComprehension
+}
+
+// symbol: 一个变量：C 类型、存储方式，以及首次赋值的位置
+type symbol struct {
+	typ       string
+	storage   string // local、param、field、temp（生成的临时变量）或 hoisted（声明提到了外层）
+	line, col int    // 首次赋值所在的 Python 语句，0 为未知
+	expired   bool   // 声明在已经结束的 C 块里：类型仍然有效，再次赋值时要重新声明
+	none      bool   // char* 变量可能是 None（NULL），如 m.group(i) 的结果：打印时输出 None
+}
+
+// symbolTable: 一个作用域中声明的变量，parent 为外层作用域
+type symbolTable struct {
+	kind   scopeKind
+	name   string
+	parent *symbolTable
+	vars   map[string]*symbol
+	locals map[string]bool // 函数体中赋值的名字：在 Python 中是局部变量，查找时不看外层的同名变量
+}
+
+func newSymbolTable(kind scopeKind, name string, parent *symbolTable) *symbolTable {
+	return &symbolTable{kind: kind, name: name, parent: parent, vars: map[string]*symbol{}}
+}
+
+// pushScope: 进入一个新的作用域
+func (g *generator) pushScope(kind scopeKind, name string) {
+	g.symtab = newSymbolTable(kind, name, g.symtab)
+}
+
+// popScope: 离开当前作用域。C 块里声明的变量在 Python 中活到函数结束：
+// 外层作用域留下它的类型（标为 expired），之后的读取还能推断类型，再次赋值时重新声明
+func (g *generator) popScope() {
+	s := g.symtab
+	if g.traceOut != nil {
+		g.tracef("leave %s scope %q: %s", s.kind, s.name, s.describe())
+	}
+	g.symtab = s.parent
+	if s.kind != scopeBlock || s.parent == nil {
+		return
+	}
+	for name, sym := range s.vars {
+		if _, ok := s.parent.vars[name]; !ok {
+			kept := *sym
+			kept.expired = true
+			s.parent.vars[name] = &kept
+		}
+	}
+}
+
+// describe: 调试信息中作用域的变量列表
+func (s *symbolTable) describe() string {
+	names := make([]string, 0, len(s.vars))
+	for name := range s.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := ""
+	for _, name := range names {
+		sym := s.vars[name]
+		out += fmt.Sprintf("%s %s (%s, line %d) ", sym.typ, name, sym.storage, sym.line)
+	}
+	return out
+}
+
+// lookupVar: 按 Python 的规则由内向外查找变量：函数中跳过外层的类作用域
+func (g *generator) lookupVar(name string) *symbol {
+	inFunc := false
+	for s := g.symtab; s != nil; s = s.parent {
+		if s.kind == scopeClass && inFunc {
+			continue
+		}
+		if sym, ok := s.vars[name]; ok {
+			return sym
+		}
+		if s.locals[name] {
+			return nil
+		}
+		if s.kind == scopeFunction {
+			inFunc = true
+		}
+	}
+	return nil
+}
+
+// varType: 变量的 C 类型，未声明时为空
+func (g *generator) varType(name string) string {
+	if sym := g.lookupVar(name); sym != nil {
+		return sym.typ
+	}
+	return ""
+}
+
+// localVar: 当前函数（或模块顶层）中在 C 里可见的声明；外层函数与模块的同名变量不算
+func (g *generator) localVar(name string) *symbol {
+	for s := g.symtab; s != nil; s = s.parent {
+		if sym, ok := s.vars[name]; ok {
+			if sym.expired {
+				return nil
+			}
+			return sym
+		}
+		if !s.kind.nested() {
+			break
+		}
+	}
+	return nil
+}
+
+// isDeclared: 变量在当前位置已经有 C 声明，赋值不需要再声明
+func (g *generator) isDeclared(name string) bool {
+	return g.localVar(name) != nil
+}
+
+// declareVar: 在当前作用域声明变量，已声明时只更新类型
+func (g *generator) declareVar(name, typ string) {
+	g.declareIn(g.symtab, name, typ, "local")
+}
+
+// declareParam: 函数参数
+func (g *generator) declareParam(name, typ string) {
+	g.declareIn(g.symtab, name, typ, "param")
+}
+
+// declareTemp: 生成的临时变量
+func (g *generator) declareTemp(name, typ string) {
+	g.declareIn(g.symtab, name, typ, "temp")
+}
+
+// declareHoisted: 声明提到了函数体开头的变量
+func (g *generator) declareHoisted(name, typ string) {
+	g.declareIn(g.funcScope(), name, typ, "hoisted")
+}
+
+// declareIn: 在 s 中声明变量；在 C 中仍然可见的同名声明只更新类型，保留首次赋值的位置
+func (g *generator) declareIn(s *symbolTable, name, typ, storage string) {
+	if sym := g.localVar(name); sym != nil {
+		sym.typ = typ
+		return
+	}
+	sym := &symbol{typ: typ, storage: storage}
+	if m := g.diagStmt; m != nil {
+		sym.line, _ = strconv.Atoi(fmt.Sprint(m["lineno"]))
+		sym.col, _ = strconv.Atoi(fmt.Sprint(m["col_offset"]))
+		sym.col++
+	}
+	s.vars[name] = sym
+}
+
+// funcScope: 当前所在的函数（或模块顶层）作用域
+func (g *generator) funcScope() *symbolTable {
+	s := g.symtab
+	for s.kind.nested() && s.parent != nil {
+		s = s.parent
+	}
+	return s
+}
+
+// moduleScope: 最外层的模块作用域
+func (g *generator) moduleScope() *symbolTable {
+	s := g.symtab
+	for s.parent != nil {
+		s = s.parent
+	}
+	return s
+}
+
+// localNames: 函数体中绑定的名字（赋值、循环变量、with ... as、except ... as），
+// 不含 global / nonlocal 声明的名字，也不进入嵌套的函数与类
+func localNames(body []interface{}) map[string]bool {
+	names, globals := map[string]bool{}, map[string]bool{}
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		switch n := node.(type) {
+		case []interface{}:
+			for _, e := range n {
+				walk(e)
+			}
+		case map[string]interface{}:
+			switch n["_type"] {
+			case "FunctionDef", "AsyncFunctionDef", "ClassDef", "Lambda":
+				return
+			case "Global", "Nonlocal":
+				ids, _ := n["names"].([]interface{})
+				for _, id := range ids {
+					if s, ok := id.(string); ok {
+						globals[s] = true
+					}
+				}
+			case "Name":
+				if ctx, _ := n["ctx"].(map[string]interface{}); ctx["_type"] == "Store" {
+					id, _ := n["id"].(string)
+					names[id] = true
+				}
+			case "ExceptHandler":
+				if id, ok := n["name"].(string); ok && id != "" {
+					names[id] = true
+				}
+			}
+			for _, v := range n {
+				walk(v)
+			}
+		}
+	}
+	walk(body)
+	for id := range globals {
+		delete(names, id)
+	}
+	return names
+}
@@ -0,0 +1,55 @@
+"""Rewrite a py2ast.py dump into the node spellings of an older Python.
+
+    python3 downgrade.py 3.8 current.json > py38.json
+
+3.8 wraps subscripts in Index (ExtSlice for several dimensions); 3.7 also spells
+constants as Num, Str, Bytes, NameConstant and Ellipsis and has no end positions,
+posonlyargs, type_comment or type_ignores.
+"""
+import json
+import sys
+
+
+def index(node):
+    if isinstance(node, dict) and node.get('_type') == 'Tuple' and any(e.get('_type') == 'Slice' for e in node['elts']):
+        return {'_type': 'ExtSlice', 'dims': [e if e.get('_type') == 'Slice' else {'_type': 'Index', 'value': e} for e in node['elts']]}
+    if isinstance(node, dict) and node.get('_type') == 'Slice':
+        return node
+    return {'_type': 'Index', 'value': node}
+
+
+def constant(node):
+    value = node['value']
+    pos = {k: node[k] for k in ('lineno', 'col_offset') if k in node}
+    if isinstance(value, dict):
+        return dict({'_type': 'Ellipsis'}, **pos)
+    if value is None or isinstance(value, bool):
+        return dict({'_type': 'NameConstant', 'value': value}, **pos)
+    if isinstance(value, str):
+        return dict({'_type': 'Str', 's': value}, **pos)
+    return dict({'_type': 'Num', 'n': value}, **pos)
+
+
+def downgrade(node, minor):
+    if isinstance(node, list):
+        return [downgrade(n, minor) for n in node]
+    if not isinstance(node, dict):
+        return node
+    node = {k: downgrade(v, minor) if k != 'value' or node.get('_type') != 'Constant' else v for k, v in node.items()}
+    if node.get('_type') == 'Subscript':
+        node['slice'] = index(node['slice'])
+    if minor < 8:
+        if node.get('_type') == 'Constant':
+            return constant(node)
+        for k in ('end_lineno', 'end_col_offset', 'posonlyargs', 'type_comment', 'type_ignores', 'kind'):
+            node.pop(k, None)
+    return node
+
+
+if __name__ == '__main__':
+    minor = int(sys.argv[1].split('.')[1])
+    with open(sys.argv[2], encoding='utf-8') as f:
+        tree = json.load(f)
+    tree = downgrade(tree, minor)
+    tree['python_version'] = sys.argv[1]
+    json.dump(tree, sys.stdout, indent=2, ensure_ascii=False)
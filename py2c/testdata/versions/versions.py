@@ -0,0 +1,28 @@
+def stub():
+    ...
+
+
+def describe(name, count, flag):
+    """Format one line of the report."""
+    if flag is None:
+        return f"{name}: {count!r:>4}"
+    if flag:
+        return name + " yes"
+    return name + " no"
+
+
+def middle(items):
+    return items[1:-1]
+
+
+def main():
+    values = [3, 1, 4, 1, 5]
+    print(describe("first", values[0], True))
+    print(describe("count", len(values), None))
+    print(describe("half", 2.5, False))
+    print(middle("abcdef"))
+    print(values[2], -7 * 2, 1e3)
+    stub()
+
+
+main()
@@ -0,0 +1,602 @@
+package py2c
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lixiasky/Py2c/py2c/pyast"
+)
+
+// Options: 翻译选项，对应命令行的同名参数
+type Options struct {
+	InlineGetters bool   // -inline-getters：简单 getter 调用直接替换为字段访问
+	LICM          bool   // -licm：把 range 循环中的不变表达式提到循环外
+	Heap          bool   // -heap：所有对象都用 malloc 分配
+	Refcount      bool   // -refcount：字符串、列表、对象带引用计数
+	OwnedStrings  bool   // -owned-strings：动态的字符串按实际长度分配，由持有它的变量在重新赋值或离开作用域时释放（Refcount 时总是如此）；列表、对象及存入其中的字符串不释放
+	Alloc         string // -alloc：运行时的内存分配，malloc（缺省）或 arena（从大块中依次分配，程序结束时一起释放）
+	Annotate      bool   // -annotate：C 代码前加上原 Python 语句的注释
+	Exceptions    string // -exceptions：setjmp、exit 或 status
+	LineMap       string // -line-map：none、directive 或 comment
+	Header        string // -header：头文件名；非空时 Output.Header 是头文件，顶层代码放到 名字_module_init()
+	CallGraph     string // 调用图的格式：dot 或 json，空为不生成
+	Freestanding  bool   // -freestanding：不包含头文件、不调用 C 库，print 交给使用者提供的 putstr
+	Profile       string // -profile：目标平台，arduino 输出 setup()/loop() 与 Output.Sketch，空为普通的 C 程序
+	Std           string // -std：生成代码的 C 方言 c89、c99 或 c11，空为 C99 加上运行时需要的 C11 关键字
+	StripDocs     bool   // -strip-docstrings：不把文档字符串输出为 /** */ 注释
+	Comments      bool   // -comments：把 Python 源码中的 # 注释按行号放回 C 代码，需要源码（AST 的 source 字段或 Source）
+	Strict        bool   // -strict：使用前可能没有赋值、没有定义的名字报告为错误而不是警告
+	Optimize      bool   // -O：折叠常量表达式，去掉不会执行的分支、不可达的语句与没有用到的 static 辅助函数
+	Style         Style  // -indent、-tabs、-braces、-max-line：生成代码的格式，零值为 4 空格缩进、大括号在行尾
+	Identifiers   string // -identifiers：非 ASCII 名字在 C 中的写法，escape（_uXXXX，缺省）或 utf8（原样，C99 编译器大多接受）
+
+	Only    []string // -only：只翻译这些顶层函数（Python 名），其他函数只输出 extern 原型，由手写的 C 代码提供
+	Exclude []string // -exclude：这些顶层函数只输出 extern 原型
+
+	NameMap map[string]string // Python 名 -> C 名，优先于自动改名（-name-map、-identifiers pinyin）；与关键字等冲突时也加上 _
+	Externs map[string]string // -extern-map：这些顶层函数（Python 名）由已有的 C 函数（值为 C 名）实现，同 @py2c.extern；见 extern.go
+
+	Calls map[string]CallMap // -map：项目中的函数调用（全名）翻译成的 C 代码，见 callmap.go
+
+	StubUnsupported bool // -stub-unsupported：不能翻译的代码换成输出 NOT IMPLEMENTED 后 abort 的调用，而不是注释
+
+	SourceFile string    // Python 源文件名，用于诊断与 #line（TranslateModules 用 Module.File）
+	Source     string    // 与 AST 对应的 Python 源码，用于 -annotate 与 -comments（Translate）；空时用 AST 中的 source 字段
+	CFile      string    // 生成的 C 文件名，用于 #line（Translate）
+	OutputDir  string    // 输出目录，#line 中的文件名相对于它（TranslateModules）
+	MainModule string    // 主模块名，空时为唯一没有被其他模块 import 的模块（TranslateModules）
+	BuildFiles []string  // 多模块时生成的构建文件：make（Makefile）、cmake（CMakeLists.txt）
+	CStd       string    // 构建文件中的 C 标准（如 c99、gnu11），空时取 Std，再按运行时的需要取 c99 或 c11
+	Trace      io.Writer // 分析过程的调试信息，nil 为不输出
+}
+
+// DefaultOptions: 与命令行默认值相同的选项
+func DefaultOptions() Options {
+	return Options{LICM: true, Exceptions: "setjmp", Alloc: "malloc", LineMap: "none", Style: Style{IndentWidth: 4, Braces: "attach"}, Identifiers: "escape"}
+}
+
+// Output: 翻译结果
+type Output struct {
+	C           string            // 生成的 C 代码（Translate）
+	Header      string            // Options.Header 对应的头文件
+	Files       map[string]string // 文件名 -> 内容：每个模块的 .c/.h、py2c_runtime.h 与构建文件（TranslateModules）
+	Main        string            // 主模块名，也是构建文件中可执行文件的名字（TranslateModules）
+	CallGraph   string            // Options.CallGraph 格式的调用图
+	Sketch      string            // Options.Profile 为 arduino 时与 C 文件放在一起的 .ino：Serial 输出
+	UsesMath    bool              // 用到 <math.h>，链接时需要 -lm
+	UsesThreads bool              // 用到 <pthread.h>，链接时需要 -pthread
+	Renames     []Rename          // 在 C 中改了名字的 Python 标识符（与关键字、C 库或生成代码冲突），按名字排序
+	Unresolved  []string          // import 的模块中既不是本地模块、py2c 也不翻译的，按名字排序（相对导入以 . 开头）
+	Libraries   []string          // ctypes 载入、链接时需要 -l 的库（foo 为 -lfoo），按名字排序
+	Coverage    Coverage          // 翻译了多少语句、哪些写法没有翻译，见 coverage.go
+}
+
+// Module: 多模块翻译的一个输入模块
+type Module struct {
+	Name   string // 模块名，必须是 C 标识符，输出为 名字.c / 名字.h
+	File   string // Python 源文件名，用于诊断与 #line
+	AST    []byte // py2ast.py 输出的 AST JSON
+	Source string // Python 源码，用于 -annotate 与 -comments；空时用 AST 中 py2ast.py 写入的 source
+}
+
+// Translator: 按固定的选项翻译。每次翻译都使用新的代码生成状态（generator），同一个 Translator 可以并发使用
+type Translator struct {
+	opts Options
+}
+
+// NewTranslator: 使用 opts 的 Translator
+func NewTranslator(opts Options) *Translator {
+	return &Translator{opts: opts}
+}
+
+// Translate: 把一个 AST JSON 翻译为 C
+func Translate(ast []byte, opts Options) (Output, []Diagnostic, error) {
+	return NewTranslator(opts).Translate(ast)
+}
+
+// TranslateModules: 一起翻译多个模块，对本地模块的 import 换成直接引用，每个模块输出 .c/.h
+func TranslateModules(modules []Module, opts Options) (Output, []Diagnostic, error) {
+	return NewTranslator(opts).TranslateModules(modules)
+}
+
+// TranslateReader: 从 r 流式读入 AST JSON 翻译为 C，不需要先把整个文件读进内存（代码生成仍要整棵 map 树）
+func TranslateReader(r io.Reader, opts Options) (Output, []Diagnostic, error) {
+	return NewTranslator(opts).TranslateReader(r)
+}
+
+// Translate: 把一个 AST JSON 翻译为 C
+func (t *Translator) Translate(ast []byte) (Output, []Diagnostic, error) {
+	return t.TranslateReader(bytes.NewReader(ast))
+}
+
+// TranslateReader: 从 r 流式读入 AST JSON 翻译为 C
+func (t *Translator) TranslateReader(r io.Reader) (Output, []Diagnostic, error) {
+	var out Output
+	diags, err := t.run(func(g *generator) error {
+		root, err := decodeAST(r)
+		if err != nil {
+			return err
+		}
+		if src, ok := root["source"].(string); ok {
+			g.pySource = strings.Split(src, "\n")
+		}
+		if t.opts.Source != "" {
+			g.pySource = strings.Split(t.opts.Source, "\n")
+		}
+		if t.opts.Comments {
+			if g.pySource == nil {
+				return fmt.Errorf("Comments needs the Python source: the AST has no source field and Options.Source is empty")
+			}
+			g.pyComments = collectComments(root, g.pySource)
+		}
+		out, err = g.translateProgram(root)
+		return err
+	})
+	return out, diags, err
+}
+
+// TranslateModules: 一起翻译多个模块
+func (t *Translator) TranslateModules(modules []Module) (Output, []Diagnostic, error) {
+	var out Output
+	diags, err := t.run(func(g *generator) error {
+		if t.opts.Profile != "" {
+			return fmt.Errorf("the %s profile needs a single module", t.opts.Profile)
+		}
+		if t.opts.Freestanding {
+			return fmt.Errorf("Freestanding needs a single module")
+		}
+		mods, err := parseModules(modules)
+		if err != nil {
+			return err
+		}
+		for _, m := range mods {
+			if t.opts.Comments && m.source == nil {
+				return fmt.Errorf("%s: Comments needs the Python source: the AST has no source field and Module.Source is empty", m.file)
+			}
+		}
+		out, err = g.translateModules(mods, t.opts.MainModule)
+		return err
+	})
+	return out, diags, err
+}
+
+// run: 检查选项，用新的 generator 执行 f，返回按源码位置排序的诊断
+func (t *Translator) run(f func(g *generator) error) (diags []Diagnostic, err error) {
+	o, err := checkOptions(t.opts)
+	if err != nil {
+		return nil, err
+	}
+	g := newGenerator(o)
+	defer func() {
+		// 检查过的 AST 仍可能有代码生成没有想到的形状：报告所在的语句，而不是让调用者崩溃
+		if r := recover(); r != nil {
+			stack := debug.Stack()
+			g.tracef("panic: %v\n%s", r, stack)
+			diags, err = g.diagnostics, &panicError{site: g.panicSite(), value: r, stack: stack}
+		}
+	}()
+	err = f(g)
+	sort.SliceStable(g.diagnostics, func(i, j int) bool { return diagLess(g.diagnostics[i], g.diagnostics[j]) })
+	return g.diagnostics, err
+}
+
+// panicError: 代码生成中的 panic 转成的错误；Fuzz 把它当作崩溃
+type panicError struct {
+	site  string
+	value interface{}
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("cannot translate %s: %v", e.site, e.value)
+}
+
+// diagLess: 诊断按文件、行、列排序
+func diagLess(a, b Diagnostic) bool {
+	if a.File != b.File {
+		return a.File < b.File
+	}
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Col < b.Col
+}
+
+// checkOptions: 检查选项，空的字段换成默认值
+func checkOptions(o Options) (Options, error) {
+	if o.Exceptions == "" {
+		o.Exceptions = "setjmp"
+	}
+	if o.Exceptions != "setjmp" && o.Exceptions != "exit" && o.Exceptions != "status" {
+		return o, fmt.Errorf("Exceptions must be setjmp, exit or status, got %q", o.Exceptions)
+	}
+	if o.LineMap == "" {
+		o.LineMap = "none"
+	}
+	if o.LineMap != "none" && o.LineMap != "directive" && o.LineMap != "comment" {
+		return o, fmt.Errorf("LineMap must be directive, comment or none, got %q", o.LineMap)
+	}
+	if o.CallGraph != "" && o.CallGraph != "dot" && o.CallGraph != "json" {
+		return o, fmt.Errorf("CallGraph must be dot or json, got %q", o.CallGraph)
+	}
+	if o.Std != "" && o.Std != "c89" && o.Std != "c99" && o.Std != "c11" {
+		return o, fmt.Errorf("Std must be c89, c99 or c11, got %q", o.Std)
+	}
+	if o.Profile != "" && o.Profile != "arduino" {
+		return o, fmt.Errorf("Profile must be arduino or empty, got %q", o.Profile)
+	}
+	if o.Alloc == "" {
+		o.Alloc = "malloc"
+	}
+	if o.Alloc != "malloc" && o.Alloc != "arena" {
+		return o, fmt.Errorf("Alloc must be malloc or arena, got %q", o.Alloc)
+	}
+	if o.Alloc == "arena" && (o.Refcount || o.OwnedStrings) {
+		return o, fmt.Errorf("Alloc arena cannot be combined with Refcount or OwnedStrings: the arena frees everything at exit")
+	}
+	if o.Freestanding && (o.Heap || o.Refcount || o.OwnedStrings || o.Alloc != "malloc" || o.Profile != "") {
+		return o, fmt.Errorf("Freestanding cannot be combined with Heap, Refcount, OwnedStrings, Alloc arena or a Profile")
+	}
+	if o.Profile == "arduino" && (o.Heap || o.Refcount || o.OwnedStrings || o.Alloc != "malloc" || o.Header != "") {
+		return o, fmt.Errorf("the arduino profile cannot be combined with Heap, Refcount, OwnedStrings, Alloc arena or Header")
+	}
+	if o.Identifiers == "" {
+		o.Identifiers = "escape"
+	}
+	if o.Identifiers != "escape" && o.Identifiers != "utf8" {
+		return o, fmt.Errorf("Identifiers must be escape or utf8, got %q", o.Identifiers)
+	}
+	if o.Identifiers == "utf8" && o.Std == "c89" {
+		return o, fmt.Errorf("Identifiers utf8 needs C99 or later: C89 identifiers are ASCII only")
+	}
+	for py, c := range o.NameMap {
+		if !cIdent.MatchString(c) {
+			return o, fmt.Errorf("NameMap: %q for %s is not a C identifier", c, py)
+		}
+	}
+	for py, c := range o.Externs {
+		if !cIdent.MatchString(c) {
+			return o, fmt.Errorf("Externs: %q for %s is not a C identifier", c, py)
+		}
+	}
+	if err := checkCallMaps(o.Calls); err != nil {
+		return o, err
+	}
+	style, err := checkStyle(o.Style)
+	if err != nil {
+		return o, err
+	}
+	o.Style = style
+	for _, kind := range o.BuildFiles {
+		if kind != "make" && kind != "cmake" {
+			return o, fmt.Errorf("BuildFiles must list make or cmake, got %q", kind)
+		}
+	}
+	if o.SourceFile == "" {
+		o.SourceFile = "<input>"
+	}
+	if o.CFile == "" {
+		o.CFile = "<output>"
+	}
+	return o, nil
+}
+
+// nameSet: names 的集合，没有名字时为 nil
+func nameSet(names []string) map[string]bool {
+	if len(names) == 0 {
+		return nil
+	}
+	set := map[string]bool{}
+	for _, n := range names {
+		set[n] = true
+	}
+	return set
+}
+
+// newGenerator: 按选项 o 创建一次翻译的代码生成状态
+func newGenerator(o Options) *generator {
+	g := &generator{
+		optInlineGetters: o.InlineGetters,
+		optLICM:          o.LICM,
+		optHeap:          o.Heap,
+		optRefcount:      o.Refcount,
+		optOwnedStrs:     o.OwnedStrings || o.Refcount,
+		optArena:         o.Alloc == "arena",
+		optAnnotate:      o.Annotate,
+		optExceptions:    o.Exceptions,
+		optLineMap:       o.LineMap,
+		optHeader:        o.Header,
+		optCallGraph:     o.CallGraph,
+		optCFile:         o.CFile,
+		optOutputDir:     o.OutputDir,
+		optBuildFiles:    o.BuildFiles,
+		optCStd:          o.CStd,
+		optProfile:       o.Profile,
+		optFreestanding:  o.Freestanding,
+		optStyle:         o.Style,
+		optOptimize:      o.Optimize,
+		optStripDocs:     o.StripDocs,
+		optComments:      o.Comments,
+		optStrict:        o.Strict,
+		optOnly:          nameSet(o.Only),
+		optExclude:       nameSet(o.Exclude),
+		optIdents:        o.Identifiers,
+		optNameMap:       o.NameMap,
+		optExterns:       o.Externs,
+		optCalls:         o.Calls,
+		optStubs:         o.StubUnsupported,
+		emit:             newEmitter(o.Std, o.Profile),
+		traceOut:         o.Trace,
+		pyFile:           o.SourceFile,
+
+		symtab:            newSymbolTable(scopeModule, "", nil),
+		funcDefs:          []string{},
+		classStructs:      []string{},
+		classStructsMap:   map[string]bool{},
+		funcArgTypes:      map[string][][]string{},
+		classInitArgTypes: map[string][][]string{},
+		includes:          map[string]bool{},
+		winIncludes:       map[string]bool{},
+		posixIncludes:     map[string]bool{},
+		userIncludes:      map[string]bool{},
+		funcResultTypes:   map[string]string{},
+		forwardCalls:      map[string]map[protoSlot]bool{},
+		objectVars:        map[string]map[string]string{},
+		escapeInfo:        map[string]map[string]string{},
+		classBases:        map[string]string{},
+		classFields:       map[string]map[string]string{},
+		classMethods:      map[string][]string{},
+		methodSigs:        map[string]methodSig{},
+		classFieldOrder:   map[string][]string{},
+		strFuncs:          map[string]bool{},
+		classAttrs:        map[string]map[string]string{},
+		staticMethods:     map[string]bool{},
+		properties:        map[string]bool{},
+		tupleTypes:        map[string][]string{},
+		annotParams:       map[string][]string{},
+		annotReturns:      map[string]string{},
+		typeAliases:       map[string]string{},
+		annotClasses:      map[string]bool{},
+		listTypes:         map[string]string{},
+		listLater:         map[string]bool{},
+		copyFuncs:         map[string]bool{},
+		listVars:          map[string]map[string]string{},
+		moduleAliases:     map[string]string{},
+		importedFuncs:     map[string]string{},
+		unresolved:        map[string]bool{},
+		runtimeHelpers:    map[string]string{},
+		getterFields:      map[string]string{},
+		classGlobals:      map[string]string{},
+		scopeIndent:       1,
+		freeFuncs:         map[string]bool{},
+		rcTemps:           map[string]bool{},
+		excClasses:        map[string]bool{},
+		statusFuncs:       map[string]bool{},
+		translatedFuncs:   map[string]string{"main": "<module>"},
+		externs:           map[string]*externSpec{},
+		ctypesLibs:        map[string]*ctypesLib{},
+		ctypesFuncs:       map[string]*ctypesFunc{},
+		ctypesLinks:       map[string]bool{},
+		funcParamTypes:    map[string][]string{},
+		preClassBases:     map[string]string{},
+		preClassMethods:   map[string][]string{},
+		virtualIntro:      map[string]string{},
+		vtableSlots:       map[string][]string{},
+		polyRoot:          map[string]string{},
+		funcPurity:        map[string]string{},
+		jsonFuncs:         map[string]bool{},
+		funcNodes:         map[string]map[string]interface{}{},
+		excBases:          map[string]string{},
+		diagnostics:       []Diagnostic{},
+		diagSeen:          map[Diagnostic]bool{},
+		covStmts:          map[string]bool{},
+		covDropped:        map[string]bool{},
+		memoFuncs:         map[string]*memoFunc{},
+		records:           map[string]*record{},
+		enums:             map[string]*enumClass{},
+		collections:       map[string]*collection{},
+		listFuncs:         map[string]bool{},
+		rePatterns:        map[string]*rePattern{},
+	}
+	for k, v := range builtinExcBases {
+		g.excBases[k] = v
+	}
+	g.nodeHandlers, g.callHandlers = pluginSnapshot()
+	return g
+}
+
+// decodeAST: 解析 py2ast.py 输出的 AST JSON，或者 ast.dump() 的文本（以节点名而不是 { 开始）
+func decodeAST(r io.Reader) (ASTNode, error) {
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(64); pyast.IsDump(head) {
+		root, err := pyast.DecodeDump(br)
+		if err != nil {
+			return nil, fmt.Errorf("parsing ast.dump text: %v", err)
+		}
+		return checkAST(root)
+	}
+	// 流式解析：节点是 map，数字保留原文（json.Number）区分 3 与 3.0，同样的键与名字只保存一份
+	root, err := pyast.DecodeMap(br)
+	if err != nil {
+		return nil, fmt.Errorf("parsing JSON: %v", err)
+	}
+	return checkAST(root)
+}
+
+// checkAST: 检查解析出的 AST
+func checkAST(root map[string]interface{}) (ASTNode, error) {
+	// 代码生成按 map 读取节点：先按类型化的 AST 检查结构（并把旧版本 Python 的节点换成现在的形式），格式不对的 JSON 在这里报错
+	if err := pyast.Check(root); err != nil {
+		return nil, fmt.Errorf("invalid AST: %v", err)
+	}
+	return root, nil
+}
+
+// parseModules: 解析各模块的 AST，检查模块名与顶层定义
+func parseModules(inputs []Module) ([]*pyModule, error) {
+	modules := []*pyModule{}
+	byName := map[string]*pyModule{}
+	defOwner := map[string]string{}
+	for _, in := range inputs {
+		root, err := decodeAST(bytes.NewReader(in.AST))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", in.File, err)
+		}
+		m := &pyModule{name: in.Name, file: in.File, root: root, defs: map[string]bool{}}
+		if !cIdent.MatchString(m.name) {
+			return nil, fmt.Errorf("%s: module name %q is not a C identifier", in.File, m.name)
+		}
+		if prev := byName[m.name]; prev != nil {
+			return nil, fmt.Errorf("module %s is given twice (%s and %s)", m.name, prev.file, in.File)
+		}
+		if src, ok := root["source"].(string); ok {
+			m.source = strings.Split(src, "\n")
+		}
+		if in.Source != "" {
+			m.source = strings.Split(in.Source, "\n")
+		}
+		// C 只有一个全局命名空间：不同模块的函数和类不能同名
+		body, _ := root["body"].([]interface{})
+		for _, s := range body {
+			sm, _ := s.(map[string]interface{})
+			switch sm["_type"] {
+			case "FunctionDef", "AsyncFunctionDef", "ClassDef":
+				name := fmt.Sprint(sm["name"])
+				if owner, ok := defOwner[name]; ok && owner != m.name {
+					return nil, fmt.Errorf("%s is defined in both %s and %s; names must be unique across modules", name, owner, m.name)
+				}
+				defOwner[name] = m.name
+				m.defs[name] = true
+			}
+		}
+		byName[m.name] = m
+		modules = append(modules, m)
+	}
+	if len(modules) == 0 {
+		return nil, fmt.Errorf("no modules to translate")
+	}
+	return modules, nil
+}
+
+// translateProgram: 翻译单个模块：整个程序在一个 C 文件中，-header 时另有头文件
+func (g *generator) translateProgram(root ASTNode) (Output, error) {
+	g.analyzeProgram(root)
+	body, _ := root["body"].([]interface{})
+	if globals := g.declareGlobals(body); globals != "" {
+		g.classStructs = append(g.classStructs, globals)
+	}
+	var loop ASTNode
+	if g.optProfile == "arduino" {
+		body, loop = arduinoLoop(body)
+	}
+	mainBody := g.stmtsToC(body, 1)
+	loopBody := ""
+	if loop != nil {
+		// while True: 的循环体是 loop()，每次调用执行一遍
+		g.pushScope(scopeBlock, "loop")
+		loopBody = g.stmtsToC(loop["body"], 1)
+		g.popScope()
+	}
+	mainBody = formatPre(g.rcLocals, 1) + mainBody + g.scopeExit(1)
+	if g.usesArgv {
+		if g.optProfile == "arduino" {
+			return Output{}, fmt.Errorf("sys.argv is not available with the arduino profile")
+		}
+		mainBody = g.sysArgvInit() + mainBody
+	}
+	var out Output
+	if g.optProfile == "arduino" {
+		out.C = g.arduinoOutput(mainBody, loopBody, loop != nil)
+		out.Sketch = fmt.Sprintf(arduinoSketch, filepath.Base(g.optCFile), arduinoBaud)
+	} else if g.optHeader != "" {
+		header, src, err := g.headerOutput(mainBody)
+		if err != nil {
+			return Output{}, err
+		}
+		if g.optFreestanding {
+			header, src = g.freestandingUnit(header), g.freestandingUnit(src)
+		}
+		files := map[string]string{"h": header, "c": src}
+		if err := g.arenaFiles(files, "c"); err != nil {
+			return Output{}, err
+		}
+		header, src = files["h"], files["c"]
+		if g.optOptimize {
+			src = pruneHelpers(src)
+		}
+		out.Header, out.C = formatUnit(g.emit.emitUnit(header), g.optStyle), src
+	} else {
+		// 运行时辅助函数
+		src := g.preamble() + g.runtimeCode()
+		// 先输出 struct，再输出方法，最后输出 main
+		src += join(g.classStructs, "") + join(g.funcDefs, "")
+		src += g.mainSignature() + " {\n" + mainBody + g.lineReset() + "    return 0;\n}\n"
+		out.C = src
+		if g.optFreestanding {
+			out.C = g.freestandingUnit(out.C)
+		}
+		files := map[string]string{"c": out.C}
+		if err := g.arenaFiles(files, "c"); err != nil {
+			return Output{}, err
+		}
+		out.C = files["c"]
+	}
+	if g.optOptimize && g.optHeader == "" {
+		out.C = pruneHelpers(out.C)
+	}
+	if g.optCallGraph != "" {
+		source := join(append(append(mapValues(g.runtimeHelpers), g.classStructs...), g.funcDefs...), "")
+		source += "int main() {\n" + mainBody + "    return 0;\n}\n"
+		graph, err := g.callGraph(g.optCallGraph, root, source)
+		if err != nil {
+			return Output{}, fmt.Errorf("call graph: %v", err)
+		}
+		out.CallGraph = graph
+	}
+	// 模块的文档字符串放在文件开头
+	lead, tail := g.fileComments()
+	out.C = lead + g.docComment(root["body"], "") + g.renameLegend(out.C) + out.C + tail
+	if out.Header != "" {
+		out.Header = g.docComment(root["body"], "") + out.Header
+	}
+	out.C = resolveLineResets(formatUnit(g.emit.emitUnit(out.C), g.optStyle), g.optCFile)
+	out.UsesMath, out.UsesThreads, out.Renames = g.usesPow, g.includes["pthread.h"], g.renames
+	out.Unresolved, out.Libraries = sortedKeys(g.unresolved), sortedKeys(g.ctypesLinks)
+	out.Coverage = g.coverage()
+	return out, nil
+}
+
+// panicSite: 出错时正在翻译的语句：文件:行:列 (类型)，不在语句中时只有文件名
+func (g *generator) panicSite() string {
+	m := g.panicNode
+	if m == nil {
+		m = g.diagStmt
+	}
+	if m == nil || m["lineno"] == nil {
+		return g.pyFile
+	}
+	col, _ := strconv.Atoi(fmt.Sprint(m["col_offset"]))
+	return fmt.Sprintf("%s:%v:%d (%v)", g.pyFile, m["lineno"], col+1, m["_type"])
+}
+
+// tracef: 输出一条调试信息到 Options.Trace（不设置时不格式化参数，调试信息里有整棵子树）
+func (g *generator) tracef(format string, args ...interface{}) {
+	if g.traceOut != nil {
+		fmt.Fprintf(g.traceOut, "[DEBUG] "+format+"\n", args...)
+	}
+}
+
+// SourceFileOf: 输入文件对应的 Python 源文件名（用于诊断与 #line）；AST JSON 取同目录下同名的 .py（mymod.ast.json -> mymod.py）
+func SourceFileOf(input string) string {
+	if strings.HasSuffix(input, ".py") {
+		return input
+	}
+	return filepath.Join(filepath.Dir(input), ModuleName(input)+".py")
+}
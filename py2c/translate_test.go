@@ -0,0 +1,1816 @@
+package py2c
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testOptions: 覆盖主要代码生成路径的几组选项
+func testOptions() map[string]Options {
+	variants := map[string]func(o *Options){
+		"default":   func(o *Options) {},
+		"refcount":  func(o *Options) { o.Refcount = true },
+		"heap":      func(o *Options) { o.Heap = true },
+		"status":    func(o *Options) { o.Exceptions = "status" },
+		"directive": func(o *Options) { o.LineMap = "directive"; o.Annotate = true },
+	}
+	opts := map[string]Options{}
+	for name, set := range variants {
+		o := DefaultOptions()
+		o.SourceFile = "example.py"
+		o.CallGraph = "json"
+		set(&o)
+		opts[name] = o
+	}
+	return opts
+}
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func testModules(t *testing.T) []Module {
+	mods := []Module{}
+	for _, name := range []string{"main", "shapes", "report"} {
+		mods = append(mods, Module{Name: name, File: name + ".py", AST: readTestdata(t, "modules/"+name+".json")})
+	}
+	return mods
+}
+
+// 先后两次翻译的结果相同：上一次翻译的状态不会留到下一次
+func TestTranslateRepeatable(t *testing.T) {
+	ast := readTestdata(t, "example.json")
+	for name, o := range testOptions() {
+		first, _, err := Translate(ast, o)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, _, err := TranslateModules(testModules(t), DefaultOptions()); err != nil {
+			t.Fatalf("%s: modules: %v", name, err)
+		}
+		second, _, err := Translate(ast, o)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(first, second) {
+			t.Errorf("%s: the second translation differs from the first", name)
+		}
+	}
+}
+
+// 不同选项的翻译同时进行，结果与单独翻译时相同
+func TestTranslateConcurrent(t *testing.T) {
+	ast := readTestdata(t, "example.json")
+	want := map[string]Output{}
+	for name, o := range testOptions() {
+		out, _, err := Translate(ast, o)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		want[name] = out
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		for name, o := range testOptions() {
+			wg.Add(1)
+			go func(name string, o Options) {
+				defer wg.Done()
+				out, _, err := Translate(ast, o)
+				if err != nil {
+					t.Errorf("%s: %v", name, err)
+					return
+				}
+				if !reflect.DeepEqual(out, want[name]) {
+					t.Errorf("%s: concurrent translation differs from the sequential one", name)
+				}
+			}(name, o)
+		}
+	}
+	wg.Wait()
+}
+
+// 多模块翻译与单文件翻译同时进行，诊断也各自独立
+func TestTranslateModulesConcurrent(t *testing.T) {
+	o := DefaultOptions()
+	o.BuildFiles = []string{"make", "cmake"}
+	want, wantDiags, err := TranslateModules(testModules(t), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want.Main != "main" || want.Files["main.c"] == "" || want.Files["shapes.h"] == "" || want.Files["Makefile"] == "" {
+		t.Fatalf("unexpected output: main %q, files %d", want.Main, len(want.Files))
+	}
+	ast := readTestdata(t, "example.json")
+	single, _, err := Translate(ast, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := NewTranslator(o)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			// 同一个 Translator 并发使用
+			out, diags, err := tr.TranslateModules(testModules(t))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !reflect.DeepEqual(out, want) || !reflect.DeepEqual(diags, wantDiags) {
+				t.Error("concurrent module translation differs from the sequential one")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			out, _, err := Translate(ast, DefaultOptions())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if out.C != single.C {
+				t.Error("single-file translation differs while modules are translated")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// 残缺的 AST 返回带位置的错误，不会 panic
+func TestTranslateMalformed(t *testing.T) {
+	cases := []struct{ ast, want string }{
+		{`{"_type": "Module"}`, "expected 'body' list at Module"},
+		{`{"_type": "Module", "body": [{"_type": "Expr", "lineno": 2, "value": {"_type": "BoolOp", "op": {"_type": "And"}, "values": []}}]}`,
+			"body[0].value.values (line 2)"},
+		{`{"_type": "Module", "body": [{"_type": "If", "lineno": 1, "test": {"_type": "Name", "id": "x"}, "body": [], "orelse": []}]}`,
+			"body[0].body (line 1)"},
+	}
+	for _, c := range cases {
+		_, _, err := Translate([]byte(c.ast), DefaultOptions())
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got %v, want an error containing %q", c.ast, err, c.want)
+		}
+	}
+	// 没有返回值的 return 曾经让代码生成崩溃
+	ast := `{"_type": "Module", "body": [{"_type": "FunctionDef", "name": "f", "lineno": 1, "decorator_list": [],
+		"args": {"_type": "arguments", "args": [], "kwonlyargs": [], "kw_defaults": [], "defaults": []},
+		"body": [{"_type": "Return", "lineno": 2, "value": null}]}]}`
+	if _, _, err := Translate([]byte(ast), DefaultOptions()); err != nil {
+		t.Errorf("bare return: %v", err)
+	}
+}
+
+// 函数、方法与模块顶层的同名变量各自声明，互不影响类型；相邻的 for 循环各自声明循环变量
+func TestTranslateScopes(t *testing.T) {
+	out, _, err := Translate(readTestdata(t, "scopes.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"int label = (self->start + 1);",
+		"int label = (a * 2);",
+		`char* label = "total";`,
+		"for (int i = 0; i < 3; i++)",
+		"for (int i = 0; i < 2; i++)",
+		`printf("%s\n", label);`,
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+}
+
+// 参数类型来自调用点的变量类型，返回类型来自 return；类型冲突成为诊断
+func TestTranslateInference(t *testing.T) {
+	out, diags, err := Translate(readTestdata(t, "infer.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"void show(char* s)", "void label(int n, char** result)", "char* name;",
+		// 递归调用在第一轮还没有类型，不算冲突；对象参数的方法调用按类的方法表取返回类型
+		"void fib(double n, double* result)", "void total(Rect* b, int* result)",
+		// 构造参数与函数参数一样按所有实例化推断，int 与 double 合并为 double，str 是冲突
+		"void Node___init__(Node* self, double v) {",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	lines := []int{}
+	for _, d := range diags {
+		if d.Severity == "warning" {
+			lines = append(lines, d.Line)
+		}
+	}
+	if !reflect.DeepEqual(lines, []int{13, 20, 22, 55}) {
+		t.Errorf("type conflicts reported at lines %v, want [13 20 22 55]: %+v", lines, diags)
+	}
+}
+
+// -std：C89 没有 // 注释与 for 中的声明，C89 / C99 都不用 C11 的关键字，构建文件使用同一个标准
+func TestTranslateStd(t *testing.T) {
+	for _, std := range []string{"c89", "c99"} {
+		o := DefaultOptions()
+		o.Std = std
+		o.BuildFiles = []string{"make", "cmake"}
+		out, _, err := TranslateModules(testModules(t), o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, src := range out.Files {
+			if strings.Contains(src, "_Thread_local") || strings.Contains(src, "_Noreturn") {
+				t.Errorf("%s: %s uses C11 keywords", std, name)
+			}
+			if std == "c89" && (lineComments(src) != src || strings.Contains(src, "for (int ")) {
+				t.Errorf("c89: %s has // comments or declarations in for:\n%s", name, src)
+			}
+		}
+		if !strings.Contains(out.Files["Makefile"], "-std="+std) {
+			t.Errorf("%s: Makefile does not use -std=%s:\n%s", std, std, out.Files["Makefile"])
+		}
+	}
+	if _, _, err := Translate(readTestdata(t, "example.json"), Options{Std: "c90"}); err == nil {
+		t.Error("Std c90 accepted")
+	}
+}
+
+// -profile arduino：setup() 与 while True: 成为的 loop()，顶层变量在两者之间共享，print 与 time.sleep 换成 Serial 与 delay
+func TestTranslateArduino(t *testing.T) {
+	o := DefaultOptions()
+	o.Profile = "arduino"
+	o.CFile = "blink.c"
+	out, _, err := Translate(readTestdata(t, "arduino.json"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"void setup(void) {\n    py_serial_begin();", "void loop(void) {", "static int count;", "    count = 0;", "delay((unsigned long)((0.5) * 1000));", "py_serial_printf(\"%s %s\\n\", \"start\", name);"} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if strings.Contains(out.C, "int main") || strings.Contains(out.C, "malloc(") {
+		t.Errorf("output has main or malloc:\n%s", out.C)
+	}
+	if !strings.Contains(out.Sketch, "Serial.begin(9600)") || !strings.Contains(out.Sketch, "blink.c") {
+		t.Errorf("unexpected sketch:\n%s", out.Sketch)
+	}
+	if _, _, err := TranslateModules(testModules(t), o); err == nil {
+		t.Error("arduino profile accepted several modules")
+	}
+}
+
+// -freestanding：没有 #include，print 经过 putstr，math 函数是生成的实现；需要 C 库的写法报告为错误
+func TestTranslateFreestanding(t *testing.T) {
+	o := DefaultOptions()
+	o.Freestanding = true
+	out, diags, err := Translate(readTestdata(t, "freestanding.json"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 0 {
+		t.Errorf("unexpected diagnostics: %+v", diags)
+	}
+	for _, want := range []string{"extern void putstr(const char* s);", "static double py_pow(double x, double y)", "py_put_double(3.14159, 2);", "putstr(\"hello \");"} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if strings.Contains(out.C, "#include") || strings.Contains(out.C, "printf(") || out.UsesMath {
+		t.Errorf("output depends on the C library:\n%s", out.C)
+	}
+	_, diags, err = Translate(readTestdata(t, "libc.json"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, d := range diags {
+		found = found || d.Severity == "error" && strings.Contains(d.Message, "malloc() needs the C library")
+	}
+	if !found {
+		t.Errorf("no diagnostic for malloc: %+v", diags)
+	}
+}
+
+func TestFormatUnit(t *testing.T) {
+	src := "int f(int a) {\n        if (a) {\n            return g(a, 1, 2);\n        }\n        else {\n            return 0;\n        }\n}\nstatic int t[] = {\n    1, 2,\n};\n"
+	got := formatUnit(src, Style{IndentWidth: 2, Braces: "allman", MaxLine: 16})
+	want := "int f(int a)\n{\n  if (a)\n  {\n    return g(a,\n        1, 2);\n  }\n  else\n  {\n    return 0;\n  }\n}\nstatic int t[] = {\n  1, 2,\n};\n"
+	if got != want {
+		t.Errorf("allman:\n%s\nwant:\n%s", got, want)
+	}
+	got = formatUnit(src, Style{IndentWidth: 4, UseTabs: true, Braces: "linux"})
+	want = "int f(int a)\n{\n\tif (a) {\n\t\treturn g(a, 1, 2);\n\t}\n\telse {\n\t\treturn 0;\n\t}\n}\nstatic int t[] = {\n\t1, 2,\n};\n"
+	if got != want {
+		t.Errorf("linux:\n%s\nwant:\n%s", got, want)
+	}
+	// 默认格式也重新缩进；结束块的 } 与块开始的那一行对齐
+	src = "    void f(void) {\n        switch (a) {\n        case 0:\n            while (b) {\n                g();\n            }\n        }\n    }\n"
+	got = formatUnit(src, Style{IndentWidth: 4, Braces: "attach"})
+	want = "void f(void) {\n    switch (a) {\n        case 0:\n            while (b) {\n                g();\n            }\n    }\n}\n"
+	if got != want {
+		t.Errorf("default:\n%s\nwant:\n%s", got, want)
+	}
+	if _, err := checkStyle(Style{Braces: "gnu"}); err == nil {
+		t.Errorf("Braces gnu accepted")
+	}
+	// 顶层函数在第 0 列，方法体缩进一层（代码生成中它们多缩进了一层）
+	out, _, err := Translate(readTestdata(t, "methods.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(out.C, "\n") {
+		if strings.HasPrefix(line, "    ") && strings.HasSuffix(line, ") {") && strings.Contains(line, "(Rect* self") {
+			t.Errorf("method definition indented: %q", line)
+		}
+	}
+	if !strings.Contains(out.C, "int Rect_sign(Rect* self) {\n    ") || strings.Contains(out.C, "int Rect_sign(Rect* self) {\n        ") {
+		t.Errorf("method body not at one level:\n%s", out.C)
+	}
+}
+
+func TestTranslateGlobals(t *testing.T) {
+	out, diags, err := Translate(readTestdata(t, "globals.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 0 {
+		t.Errorf("unexpected diagnostics: %+v", diags)
+	}
+	for _, want := range []string{"const double PI = 3.14159;\n", "int count = 0;\n", "double ratio;\n", "    count = (count + 1);\n", "    ratio = (PI / 2);\n"} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if strings.Contains(out.C, "    double PI") || strings.Contains(out.C, "double count = (count") {
+		t.Errorf("module-level variables redeclared locally:\n%s", out.C)
+	}
+	// 列表与对象：对象的定义在类的结构体之后；函数的返回类型按推断出的字段类型
+	for _, want := range []string{"PyList_charp* entries;\n", "} Tally;\n", "Tally tally;\n", "    entries = PyList_charp_new();", "void record(char* msg, char** result)", "    Tally_add(&tally);"} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if strings.Index(out.C, "Tally tally;") < strings.Index(out.C, "} Tally;") {
+		t.Errorf("module-level object defined before its struct:\n%s", out.C)
+	}
+	o := DefaultOptions()
+	o.Refcount = true
+	if out, _, _ = Translate(readTestdata(t, "globals.json"), o); !strings.Contains(out.C, "Tally* tally;\n") {
+		t.Errorf("-refcount: the module-level object is not a pointer:\n%s", out.C)
+	}
+}
+
+// 多个模块：函数中用到的模块变量是文件作用域变量（不是 模块名_module_init 的局部变量），不同模块中不能同名
+func TestTranslateModuleGlobals(t *testing.T) {
+	out, _, err := TranslateModules(testModules(t), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.Files[runtimeHeader], "extern PyList_charp* seen;\n") || !strings.Contains(out.Files["main.c"], "\nPyList_charp* seen;\n") {
+		t.Errorf("seen is not a file-scope variable:\n%s\n%s", out.Files[runtimeHeader], out.Files["main.c"])
+	}
+	if src := out.Files["report.c"]; !strings.Contains(src, "    seen = PyList_charp_new();") || strings.Contains(src, "PyList_charp* seen =") {
+		t.Errorf("report_module_init declares seen locally:\n%s", src)
+	}
+	o := DefaultOptions()
+	o.MainModule = "main"
+	mods := append(testModules(t), Module{Name: "counter", File: "counter.py", AST: readTestdata(t, "modules/counter.json")})
+	if _, _, err := TranslateModules(mods, o); err == nil || !strings.Contains(err.Error(), "names must be unique across modules") {
+		t.Errorf("seen in two modules: err = %v", err)
+	}
+}
+
+func TestTranslateOptimize(t *testing.T) {
+	o := DefaultOptions()
+	o.Optimize = true
+	out, diags, err := Translate(readTestdata(t, "optimize.json"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 0 {
+		t.Errorf("unexpected diagnostics: %+v", diags)
+	}
+	for _, want := range []string{"int DAY = 86400;\n", "-9.0);\n", "PyList_int_at(xs, 0)"} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	for _, dead := range []string{"never", "dead", "other", "PyList_double_pop", "pow("} {
+		if strings.Contains(out.C, dead) {
+			t.Errorf("output still contains %q:\n%s", dead, out.C)
+		}
+	}
+}
+
+func TestTranslateConditions(t *testing.T) {
+	src := readTestdata(t, "conditions.json")
+	o := DefaultOptions()
+	o.Std = "c89"
+	out, _, err := Translate(src, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"while (1) {\n        n = (n + 1);", "if (0) {", "else if (1) {", "int x = (1 ? 5 : 6);", "int ok = 0;"} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if strings.Contains(out.C, "true") || strings.Contains(out.C, "false") {
+		t.Errorf("C89 has no true / false:\n%s", out.C)
+	}
+	o.Optimize = true
+	if out, _, err = Translate(src, o); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.C, "never") || !strings.Contains(out.C, "while (1) {") {
+		t.Errorf("-O: if 1 > 2 should be gone, while True kept:\n%s", out.C)
+	}
+}
+
+// 整数字面量为 int；带小数点/指数的和超出 int 范围的整数为 double，输出时带 .0，与 %f 相符
+func TestTranslateLiterals(t *testing.T) {
+	out, _, err := Translate(readTestdata(t, "literals.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"    int a = 7;\n    int b = -3;\n    double c = 1e-09;\n    double d = 25000000000.0;\n",
+		"    double e = 3000000000.0;\n    double f = 12345678901234567890.0;\n    double g = 123456789012345678901234567890.0;\n    double h = 0.5;\n",
+		"    printf(\"%d %d %d %f %f %d %d %f\\n\", a, b, c > 0, d, e, f > 1e+19, g > 1e+29, h);\n",
+		"    printf(\"%d %f %d\\n\", (a + b), (e - 1), (-a));\n",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if strings.Contains(out.C, "LL") {
+		t.Errorf("large integers should be double literals:\n%s", out.C)
+	}
+}
+
+func TestTranslateElif(t *testing.T) {
+	o := DefaultOptions()
+	o.Comments = true
+	out, _, err := Translate(readTestdata(t, "elif.json"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"        }\n        else if (s > 80) {\n            // eighty\n",
+		"            }\n            else if (i == 1) {\n",
+		"    }\n    else {\n        char* _t0;\n        grade(x, &_t0);\n        if (_t0 == \"C\") {\n",
+		"    }\n    // two?\n    // trailing\n    else if (x == 2) {\n",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if strings.Contains(out.C, "else  ") {
+		t.Errorf("else followed by padding:\n%s", out.C)
+	}
+}
+
+func TestTranslateMethodCalls(t *testing.T) {
+	out, diags, err := Translate(readTestdata(t, "methods.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"int Rect_sign(Rect* self) {",
+		"int Rect_bigger(Rect* self, Rect* other) {",
+		"double total = (Rect_area(&r) + 1);",
+		"(Rect_sign(&r) + 1)",
+		"if (Rect_area(&r) > 5) {",
+		"show(Rect_area(&r));",
+		"Rect_area(Rect_grow(&r, 2))",
+		"Rect_bigger(&s, &r)",
+		"(int)strlen(Rect_name(&r))",
+		"Rect_name(Rect_grow(Rect_grow(&r, 1), 1))",
+		"while (Rect_area(&r) < 100) {",
+		"Rect* Rect_scaled(Rect* self, double k) {",
+		"printf(\"%f\\n\", Rect_area(Rect_scaled(&r, 2)));",
+		"Rect* t = Rect_scaled(&s, 3);",
+		"Rect_scaled(t, 2)->h",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if len(diags) != 0 {
+		t.Errorf("unexpected diagnostics: %+v", diags)
+	}
+}
+
+// 类及其祖先都没有 __init__ 时不调用构造函数（也不会生成它）；继承来的 __init__ 照常调用
+func TestTranslateNoInit(t *testing.T) {
+	out, _, err := Translate(readTestdata(t, "noinit.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{"Shape___init__", "Tag___init__"} {
+		if strings.Contains(out.C, bad) {
+			t.Errorf("output calls the undefined %s:\n%s", bad, out.C)
+		}
+	}
+	for _, want := range []string{
+		"    Big___init__(&b, 3);\n",
+		"    Tag* _o0 = (Tag*)malloc(sizeof(Tag));\n    _o0->base.vtbl = &Tag_vtbl;\n    Sq* _o1",
+		"    Sq___init__(_o1, 2);\n",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+}
+
+func TestTranslateAttributeChains(t *testing.T) {
+	out, _, err := Translate(readTestdata(t, "chains.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"    Server* server;\n",
+		"void App___init__(App* self, Config* config) {",
+		"Server_bump(self->config->server);",
+		"printf(\"%d\\n\", self->config->server->port);",
+		"Config___init__(config, s);",
+		"printf(\"%d\\n\", app.config->server->port);",
+		"app.config->server->port = 1;",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+}
+
+func TestTranslateComposition(t *testing.T) {
+	src := readTestdata(t, "composition.json")
+	out, _, err := Translate(src, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"    Engine engine;\n    Wheel wheel;\n",
+		"    Engine___init__(&self->engine, hp);\n",
+		"    Engine_start(&self->engine);\n",
+		"Engine___init__(&self->engine, (self->engine.hp + 50));",
+		"printf(\"%d\\n\", Engine_power(&c.engine));",
+		"    Wheel___init__(&c.wheel, 18);\n",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	o := DefaultOptions()
+	o.Refcount = true
+	if out, _, err = Translate(src, o); err != nil {
+		t.Fatal(err)
+	}
+	if want := "    py_decref(self->name);\n    Engine__drop(&self->engine);\n    Wheel__drop(&self->wheel);\n"; !strings.Contains(out.C, want) {
+		t.Errorf("refcount output lacks %q:\n%s", want, out.C)
+	}
+}
+
+func TestTranslateObjectLists(t *testing.T) {
+	out, _, err := Translate(readTestdata(t, "objlists.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"    Sq* _o1 = (Sq*)malloc(sizeof(Sq));\n    _o1->base.vtbl = &Sq_vtbl;\n    Sq___init__(_o1, 2.0);\n",
+		"    PyList_Shapep* shapes = PyList_Shapep_new();\n    PyList_Shapep_append(shapes, (Shape*)_o1);\n",
+		"void total_area(PyList_Shapep* shapes, double* result) {",
+		"        Shape* s = shapes->items[",
+		"printf(\"%f\\n\", Sq_area(_o",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if i, j := strings.Index(out.C, "} Shape;"), strings.Index(out.C, "} PyList_Shapep;"); i < 0 || j < i {
+		t.Errorf("list of Shape defined before Shape:\n%s", out.C)
+	}
+}
+
+func TestTranslateForwardCalls(t *testing.T) {
+	out, _, err := Translate(readTestdata(t, "forward.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"void g(int n, int* result);\n// impure: performs I/O (print)\nvoid f(",
+		"    int y;\n    g(n, &y);\n",
+		"    double r;\n    fact((n - 1), &r);\n",
+		"void add2(int a, int b) {",
+		"    add2(3, 4);\n",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if strings.Count(out.C, "void g(") != 2 || strings.Count(out.C, "void fact(") != 1 {
+		t.Errorf("want exactly one prototype, for g only:\n%s", out.C)
+	}
+}
+
+// 重复的定义只保留最后一个，说明生效的定义在哪一行；给函数名、类名的赋值是错误
+func TestTranslateRedefinitions(t *testing.T) {
+	out, diags, err := Translate(readTestdata(t, "redefine.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 和 Python 一样最后一个定义生效：之前的同类定义之间没有用到名字时只是警告
+	want := []string{
+		"warning 1 function area is redefined at line 16; it is left out",
+		"warning 9 method Point.show is redefined at line 12; it is left out",
+		"error 20 class Shape: the name is redefined as a function at line 24; it is left out",
+		"error 28 function greet is used at line 32 before it is redefined at line 35: C has only the last definition; it is left out",
+		"error 41 assignment to Point, the class defined at line 5: in C a name cannot be both; it is left out",
+		"error 43 function log is defined again at line 46 inside a block: C has no conditional definitions, only the last one is kept; it is left out",
+	}
+	got := []string{}
+	for _, d := range diags {
+		got = append(got, fmt.Sprintf("%s %d %s", d.Severity, d.Line, d.Message))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diagnostics %q, want %q", got, want)
+	}
+	if strings.Count(out.C, "void area(") != 1 || strings.Count(out.C, "void Point_show(") != 1 || strings.Count(out.C, "void log_(") != 1 || strings.Count(out.C, "void greet(") != 1 {
+		t.Errorf("duplicate C definitions:\n%s", out.C)
+	}
+	for _, s := range []string{"// left out: function area is redefined at line 16\n", "*result = ((3 * r) * r);", "printf(\"%s %d\\n\", \"again\", self->x);", "printf(\"%s\\n\", m);"} {
+		if !strings.Contains(out.C, s) {
+			t.Errorf("output lacks %q:\n%s", s, out.C)
+		}
+	}
+}
+
+func TestTranslateUnassigned(t *testing.T) {
+	src := readTestdata(t, "uninit.json")
+	want := []string{
+		"5 total is used before it is assigned: bump assigns it, so it is local there (declare global total to use the outer variable)",
+		"12 label may be used before it is assigned: not every path to this use assigns it",
+		"33 last may be used before it is assigned: not every path to this use assigns it",
+		"34 count is used before it is assigned",
+		"36 undefined_name is not defined",
+	}
+	for _, strict := range []bool{false, true} {
+		o := DefaultOptions()
+		o.Strict = strict
+		_, diags, err := Translate(src, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		severity := map[bool]string{false: "warning", true: "error"}[strict]
+		got := []string{}
+		for _, d := range diags {
+			if d.Severity != severity {
+				t.Errorf("strict=%v: %s diagnostic %q", strict, d.Severity, d.Message)
+			}
+			got = append(got, fmt.Sprintf("%d %s", d.Line, d.Message))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("strict=%v: diagnostics %q, want %q", strict, got, want)
+		}
+	}
+}
+
+func TestTranslateDocstrings(t *testing.T) {
+	src := readTestdata(t, "docstrings.json")
+	out, _, err := Translate(src, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"/** Module docstring. */\n", "/**\n     * Return the area of a circle.\n     *\n     * r is the radius.\n     */\n", "/** Create a box. */\n", "* / tricky */"} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if strings.Contains(out.C, "\"Create a box.\"") {
+		t.Errorf("docstring emitted as a statement:\n%s", out.C)
+	}
+	o := DefaultOptions()
+	o.StripDocs = true
+	out, _, err = Translate(src, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.C, "/**") {
+		t.Errorf("-strip-docstrings output still has doc comments:\n%s", out.C)
+	}
+}
+
+func TestTranslateComments(t *testing.T) {
+	src := readTestdata(t, "comments.json")
+	o := DefaultOptions()
+	o.Comments = true
+	out, _, err := Translate(src, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.C, "// Example header.\n\n") || !strings.HasSuffix(out.C, "}\n\n// done\n") {
+		t.Errorf("file comments are not at the start and end:\n%s", out.C)
+	}
+	for _, want := range []string{"// divides by two\n", "    // integer-safe\n    *result", "    // second item\n    PyList"} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	// 没有 source 字段的 AST：源码由 Options.Source 给出
+	var root map[string]interface{}
+	if err := json.Unmarshal(src, &root); err != nil {
+		t.Fatal(err)
+	}
+	source := root["source"].(string)
+	delete(root, "source")
+	bare, _ := json.Marshal(root)
+	if _, _, err := Translate(bare, o); err == nil {
+		t.Error("Comments without the source: no error")
+	}
+	o.Source = source
+	withSource, _, err := Translate(bare, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withSource.C != out.C {
+		t.Errorf("Options.Source output differs:\n%s", withSource.C)
+	}
+}
+
+func TestTranslateNames(t *testing.T) {
+	out, _, err := Translate(readTestdata(t, "names.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Rename{
+		{"café", "caf_u00E9", "non-ASCII"},
+		{"default", "default_", "C keyword"},
+		{"div", "div_", "C library name"},
+		{"index", "index_", "C library name"},
+		{"int", "int_", "C keyword"},
+		{"read", "read_", "C library name"},
+		{"register", "register_", "C keyword"},
+		{"result", "result_", "generated name"},
+		{"select", "select_", "C library name"},
+		{"switch", "switch_", "C keyword"},
+	}
+	if !reflect.DeepEqual(out.Renames, want) {
+		t.Errorf("Renames = %+v, want %+v", out.Renames, want)
+	}
+	for _, s := range []string{"double int_;\n", "self->int_ = v;", "void scale(double default_, double register_, double* result)", "int switch_ = (int)(caf_u00E9.int_);", "void index_(char* s, char* c, int* result)"} {
+		if !strings.Contains(out.C, s) {
+			t.Errorf("output lacks %q:\n%s", s, out.C)
+		}
+	}
+}
+
+func TestTranslateIdentifiers(t *testing.T) {
+	src := readTestdata(t, "names.json")
+	out, _, err := Translate(src, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.C, "// Python names renamed for C:\n//   café -> caf_u00E9\n\n") {
+		t.Errorf("no legend of the renamed non-ASCII names:\n%s", out.C)
+	}
+	o := DefaultOptions()
+	o.Identifiers = "utf8"
+	out, _, err = Translate(src, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.C, "P café;") || strings.Contains(out.C, "renamed for C") {
+		t.Errorf("utf8: the name is not kept:\n%s", out.C)
+	}
+	o.Std = "c89"
+	if _, _, err := Translate(src, o); err == nil {
+		t.Error("utf8 identifiers with C89: no error")
+	}
+	o = DefaultOptions()
+	o.NameMap = map[string]string{"café": "cafe", "switch": "int"}
+	out, _, err = Translate(src, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.C, "P cafe;") || !strings.Contains(out.C, "int int_1 = (int)(cafe.int_);") {
+		t.Errorf("NameMap not applied:\n%s", out.C)
+	}
+}
+
+// -owned-strings：拼接、f-string、join 与 input 的结果按实际长度分配，变量离开作用域或重新赋值时释放
+func TestTranslateOwnedStrings(t *testing.T) {
+	src := readTestdata(t, "strings.json")
+	out, _, err := Translate(src, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.C, "PyStr") || !strings.Contains(out.C, "py_input(\"Name: \")") {
+		t.Errorf("default: strings should use the scratch buffers:\n%s", out.C)
+	}
+	o := DefaultOptions()
+	o.OwnedStrings = true
+	out, _, err = Translate(src, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"typedef struct {\n    char* data;\n    size_t len;\n    int owned;\n} PyStr;",
+		"char* _s0 = py_str_format(\"%s=\", line).data;\n        char* _o1 = line;\n        line = _s0;\n        free(_o1);\n",
+		"*result = _s2;\n    free(line);\n",
+		"name = py_str_dup(name);\n",
+		"_p8 = py_str_concat(_p8, py_str_borrow(words->items[_i5]));",
+		"free(_t9);\n",
+		"free(joined);\n    free(who);\n    return 0;",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("owned strings: missing %q:\n%s", want, out.C)
+		}
+	}
+	o.Freestanding = true
+	if _, _, err := Translate(src, o); err == nil {
+		t.Error("OwnedStrings with Freestanding: no error")
+	}
+}
+
+func TestTranslateArena(t *testing.T) {
+	src := readTestdata(t, "strings.json")
+	o := DefaultOptions()
+	o.Alloc = "arena"
+	out, _, err := Translate(src, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"static void* py_arena_malloc(size_t size) {",
+		"char* c = (char*)py_arena_malloc(n);",
+		"*buf = (char*)py_arena_realloc(*buf, *cap);",
+		"py_arena_free(buf);",
+		"    if (size && n > (size_t)-1 / size) {\n        return NULL;\n    }\n",
+		"    h = (PyArenaHead*)p - 1;\n",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("arena: missing %q:\n%s", want, out.C)
+		}
+	}
+	if n := strings.Count(out.C, ")malloc("); n != 2 {
+		t.Errorf("arena: %d malloc calls, want the 2 of the arena itself:\n%s", n, out.C)
+	}
+	mods, _, err := TranslateModules(testModules(t), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt := mods.Files[runtimeHeader]; strings.Contains(join(mapValues(mods.Files), ""), "py_arena_") && !strings.Contains(rt, "static void* py_arena_malloc") {
+		t.Errorf("modules: the arena should be in %s:\n%s", runtimeHeader, rt)
+	}
+	o.Refcount = true
+	if _, _, err := Translate(src, o); err == nil {
+		t.Error("Alloc arena with Refcount: no error")
+	}
+}
+
+// largeModule: 把 testdata/large.json 的函数和调用重复 n 遍（work、result 加上序号），作为大模块的输入
+func largeModule(b *testing.B, n int) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "large.json"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var rename func(v interface{}, suffix string)
+	rename = func(v interface{}, suffix string) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for _, key := range []string{"id", "name"} {
+				if s, ok := v[key].(string); ok && (s == "work" || s == "result") {
+					v[key] = s + suffix
+				}
+			}
+			for _, x := range v {
+				rename(x, suffix)
+			}
+		case []interface{}:
+			for _, x := range v {
+				rename(x, suffix)
+			}
+		}
+	}
+	var root map[string]interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		b.Fatal(err)
+	}
+	delete(root, "source")
+	body := []interface{}{}
+	for i := 0; i < n; i++ {
+		var copy map[string]interface{}
+		if err := json.Unmarshal(data, &copy); err != nil {
+			b.Fatal(err)
+		}
+		rename(copy["body"], fmt.Sprint("_", i))
+		body = append(body, copy["body"].([]interface{})...)
+	}
+	root["body"] = body
+	out, err := json.Marshal(root)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return out
+}
+
+// longFunction: 把 testdata/large.json 中 work 的 for 循环在同一个函数体中重复 n 遍，作为长函数的输入
+func longFunction(b *testing.B, n int) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "large.json"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var root map[string]interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		b.Fatal(err)
+	}
+	delete(root, "source")
+	work := root["body"].([]interface{})[0].(map[string]interface{})
+	stmts := work["body"].([]interface{})
+	body := []interface{}{stmts[0]}
+	for i := 0; i < n; i++ {
+		body = append(body, stmts[1])
+	}
+	work["body"] = append(body, stmts[2])
+	out, err := json.Marshal(root)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return out
+}
+
+// 翻译时间随模块大小线性增长：每个规模的 ns/op 除以 n 应大致相同；
+// 模块由许多短函数或一个很长的函数组成时都是如此
+func BenchmarkTranslateLarge(b *testing.B) {
+	for _, c := range []struct {
+		name  string
+		input func(*testing.B, int) []byte
+	}{{"module", largeModule}, {"function", longFunction}} {
+		for _, n := range []int{100, 400, 1600} {
+			ast := c.input(b, n)
+			b.Run(fmt.Sprint(c.name, "/", n), func(b *testing.B) {
+				b.SetBytes(int64(len(ast)))
+				for i := 0; i < b.N; i++ {
+					if _, _, err := Translate(ast, DefaultOptions()); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// 没有翻译的内置函数报告为不支持，而不是输出成调用不存在的 C 函数；程序定义的同名函数照常调用
+func TestTranslateUntranslatedBuiltins(t *testing.T) {
+	out, diags, err := Translate(readTestdata(t, "builtins.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range diags {
+		got = append(got, fmt.Sprint(d.Line, " ", d.Message))
+	}
+	if want := []string{"10 unsupported call: builtin sorted()", "11 unsupported call: builtin list()"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("diagnostics %q, want %q", got, want)
+	}
+	for _, want := range []string{"    reversed(xs, &_t1);\n", "    exit(2);\n"} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if strings.Contains(out.C, "sorted(xs)") || strings.Contains(out.C, "list(dq)") {
+		t.Errorf("builtins emitted as C calls:\n%s", out.C)
+	}
+}
+
+// 既不是本地模块、py2c 也不翻译的 import 在 Output.Unresolved 中
+func TestTranslateUnresolvedImports(t *testing.T) {
+	out, _, err := Translate(readTestdata(t, "imports.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{".", ".util", "numpy", "requests"}; !reflect.DeepEqual(out.Unresolved, want) {
+		t.Errorf("unresolved %q, want %q", out.Unresolved, want)
+	}
+	mods, _, err := TranslateModules(testModules(t), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mods.Unresolved) != 0 {
+		t.Errorf("modules: imports of local modules are unresolved: %q", mods.Unresolved)
+	}
+}
+
+// Only / Exclude：没有选中的函数只有 extern 原型，函数体中不能翻译的代码也不再报告
+func TestTranslateSelected(t *testing.T) {
+	src := readTestdata(t, "select.json")
+	o := DefaultOptions()
+	o.Exclude = []string{"crc16"}
+	out, diags, err := Translate(src, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.C, "extern void crc16(char* data, int* result);\n") || strings.Contains(out.C, "void crc16(char* data, int* result) {") {
+		t.Errorf("exclude: crc16 should only be declared:\n%s", out.C)
+	}
+	if len(diags) != 0 {
+		t.Errorf("exclude: diagnostics of the excluded function: %v", diags)
+	}
+	o = DefaultOptions()
+	o.Only = []string{"show", "missing"}
+	o.Header = "select.h"
+	out, diags, err = Translate(src, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"crc16", "parse_header"} {
+		if !strings.Contains(out.Header, "extern void "+name+"(") {
+			t.Errorf("only: the header lacks the prototype of %s:\n%s", name, out.Header)
+		}
+	}
+	if !strings.Contains(out.C, "void show(char* name) {") {
+		t.Errorf("only: show is not translated:\n%s", out.C)
+	}
+	if len(diags) != 1 || diags[0].Message != "-only: there is no top-level function missing" {
+		t.Errorf("only: diagnostics %v, want the unknown name", diags)
+	}
+}
+
+func TestTranslateExtern(t *testing.T) {
+	src := readTestdata(t, "extern.json")
+	o := DefaultOptions()
+	o.Externs = map[string]string{"clamp": "clamp_f", "missing": "c_missing"}
+	out, diags, err := Translate(src, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"#include \"crc.h\"\n",
+		"/** Drive the LED on pin. */\n// led_set: implemented in C\nextern void led_set(int pin, int on);\n",
+		"extern double clamp_f(double v, double lo, double hi);\n",
+		"*result = (crc16_ccitt(s, 3) * 2);",
+		"led_set(13, 1);",
+		"clamp_f(1.5, 0.0, 1.0)",
+		"void mix(int a, int b, int* result) {",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if strings.Contains(out.C, "void crc16(") || strings.Contains(out.C, "fmax") {
+		t.Errorf("the bodies of functions implemented in C are translated:\n%s", out.C)
+	}
+	msgs := []string{}
+	for _, d := range diags {
+		msgs = append(msgs, d.Message)
+	}
+	want := []string{
+		"-extern-map: there is no top-level function missing",
+		"mix is implemented in C (c_mix): parameter a needs a type annotation (int, float, str, bool or a C type as a string), it is translated",
+	}
+	if !reflect.DeepEqual(msgs, want) {
+		t.Errorf("diagnostics %q, want %q", msgs, want)
+	}
+}
+
+func TestTranslateCtypes(t *testing.T) {
+	out, diags, err := Translate(readTestdata(t, "ctypes_calls.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"#include <stdint.h>\n",
+		"// scale: from ./libfoo.so, link with -lfoo\nextern double scale(int arg0, double arg1);\n",
+		"extern void reset();\n",
+		"extern int fill(int32_t* arg0);\n",
+		"extern int version();\n",
+		"double x = scale(3, 1.5);",
+		"fill(&count);",
+		"puts(\"hello\");",
+		"printf(\"%d\\n\", version());",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if strings.Contains(out.C, "extern int puts(") || strings.Contains(out.C, "CDLL") {
+		t.Errorf("the C library is declared again or the loading is left:\n%s", out.C)
+	}
+	if !reflect.DeepEqual(out.Libraries, []string{"foo"}) || len(out.Unresolved) != 0 {
+		t.Errorf("libraries %v and unresolved imports %v, want [foo] and none", out.Libraries, out.Unresolved)
+	}
+	if len(diags) != 0 || len(out.Unresolved) != 0 {
+		t.Errorf("diagnostics %v and unresolved imports %v, want none", diags, out.Unresolved)
+	}
+}
+
+func TestTranslateCallMap(t *testing.T) {
+	o := DefaultOptions()
+	o.Calls = map[string]CallMap{
+		"utils.log":     {C: `syslog({level}, "%s", {msg})`, Params: []string{"msg", "level=LOG_INFO"}, Includes: []string{"syslog.h"}},
+		"utils.now_ms":  {C: "millis()", Returns: "int", Includes: []string{`"board.h"`}},
+		"utils.clamp":   {C: "{0} < {1} ? {1} : {0} > {2} ? {2} : {0}", Returns: "int"},
+		"hw.gpio.write": {C: "digital_write({pin}, {level})", Params: []string{"pin", "level"}},
+		"utils.trace":   {C: "trace_printf({args})"},
+	}
+	out, diags, err := Translate(readTestdata(t, "callmap.json"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"#include <syslog.h>\n#include \"board.h\"\n",
+		"digital_write(pin, 1);\n",
+		"digital_write(pin, 0);\n",
+		"syslog(LOG_INFO, \"%s\", \"starting\");",
+		"syslog(\"LOG_ERR\", \"%s\", \"level\");",
+		"printf(\"%d\\n\", (5 < 0 ? 0 : 5 > 3 ? 3 : 5));",
+		"trace_printf(\"a\", 1, 2);",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if len(diags) != 0 || len(out.Unresolved) != 0 {
+		t.Errorf("diagnostics %v and unresolved imports %v, want none", diags, out.Unresolved)
+	}
+	o.Calls = map[string]CallMap{"utils.log": {C: "syslog({priority}, {msg})", Params: []string{"msg"}}}
+	if _, _, err := Translate(readTestdata(t, "callmap.json"), o); err == nil || !strings.Contains(err.Error(), "{priority}") {
+		t.Errorf("a placeholder without a parameter: err = %v", err)
+	}
+}
+
+func TestTranslatePlugins(t *testing.T) {
+	registry.Lock()
+	saved, savedCalls := registry.nodes, registry.calls
+	registry.nodes, registry.calls = nil, nil
+	registry.Unlock()
+	defer func() {
+		registry.Lock()
+		registry.nodes, registry.calls = saved, savedCalls
+		registry.Unlock()
+	}()
+	RegisterCallHandler("numpy.zeros", "double*", func(c *Context) (string, bool) {
+		args, _ := c.Node()["args"].([]interface{})
+		if len(args) != 1 {
+			return "", false
+		}
+		c.Include("stdlib.h")
+		return fmt.Sprintf("calloc(%s, sizeof(double))", c.Expr(args[0])), true
+	})
+	RegisterHandler("While", func(c *Context) (string, bool) {
+		return c.Pad() + "/* loop */\n" + c.Default(), true
+	})
+	if nodes, calls := Handlers(); !reflect.DeepEqual(nodes, []string{"While"}) || !reflect.DeepEqual(calls, []string{"numpy.zeros"}) {
+		t.Errorf("Handlers() = %v, %v", nodes, calls)
+	}
+	out, diags, err := Translate(readTestdata(t, "plugins.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"#include <stdlib.h>\n", "double* buf = calloc(n, sizeof(double));", "    /* loop */\n    while (i < n) {\n"} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if len(diags) != 0 || len(out.Unresolved) != 0 {
+		t.Errorf("diagnostics %v and unresolved imports %v, want none", diags, out.Unresolved)
+	}
+}
+
+func TestTranslateStubUnsupported(t *testing.T) {
+	src := readTestdata(t, "stub_unsupported.json")
+	o := DefaultOptions()
+	o.SourceFile = "stub_unsupported.py"
+	plain, _, err := Translate(src, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(plain.C, "py_not_implemented") {
+		t.Errorf("stubs without StubUnsupported:\n%s", plain.C)
+	}
+	o.StubUnsupported = true
+	out, diags, err := Translate(src, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"#include <stdlib.h>\n",
+		"static void py_not_implemented(const char* msg) {",
+		`char* f = (py_not_implemented("NOT IMPLEMENTED: node: Lambda at stub_unsupported.py:2"), (char*)0);`,
+		`py_not_implemented("NOT IMPLEMENTED: assign (attribute) at stub_unsupported.py:6"); // unsupported assign (attribute)`,
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	// 仍然报告为错误
+	if len(diags) != 2 || diags[0].Severity != "error" || diags[1].Severity != "error" {
+		t.Errorf("diagnostics %v, want the two unsupported nodes as errors", diags)
+	}
+}
+
+func TestTranslateCoverage(t *testing.T) {
+	o := DefaultOptions()
+	o.SourceFile = "stub_unsupported.py"
+	out, _, err := Translate(readTestdata(t, "stub_unsupported.json"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := out.Coverage
+	// 3 个函数定义、8 条语句；lambda 的赋值与 n.x = 1 没有翻译
+	if c.Statements != 11 || c.Translated != 9 || c.Percent != 81.8 {
+		t.Errorf("coverage %d of %d (%v%%), want 9 of 11 (81.8%%)", c.Translated, c.Statements, c.Percent)
+	}
+	if want := map[string]int{"Lambda": 1, "Assign": 1}; !reflect.DeepEqual(c.ByNode, want) {
+		t.Errorf("by node %v, want %v", c.ByNode, want)
+	}
+	if len(c.Dropped) != 2 || c.Dropped[0].Line != 2 || c.Dropped[1].Line != 6 {
+		t.Errorf("dropped %v", c.Dropped)
+	}
+	total := Coverage{}
+	total.Add(c)
+	total.Add(Coverage{Statements: 9, Translated: 9})
+	if total.Statements != 20 || total.Translated != 18 || total.Percent != 90 || total.ByNode["Lambda"] != 1 {
+		t.Errorf("merged coverage %+v", total)
+	}
+}
+
+// 格式不对的 AST 得到错误或诊断而不是 panic（见 fuzz.go）。种子是 testdata 中的 AST（JSON 与 ast.dump 的文本）与 testdata/fuzz/FuzzTranslate
+// 的语料：其他 Python 版本输出的 AST、截断与改坏的 JSON；go test -fuzz=FuzzTranslate ./py2c 继续变异
+func FuzzTranslate(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range append(files, filepath.Join("testdata", "example.dump")) {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Fuzz(data)
+	})
+}
+
+// 同一个程序由不同版本的 Python 输出的 AST（py37、py38 由 testdata/versions/downgrade.py 从 py311 改写）
+// 翻译为同样的 C 代码；去掉 python_version 字段时按节点的写法推断版本，结果也一样
+func TestTranslateSchemaVersions(t *testing.T) {
+	o := DefaultOptions()
+	o.SourceFile = "versions.py"
+	want, wantDiags, err := Translate(readTestdata(t, "versions/py311.json"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"py37", "py38"} {
+		var raw map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(readTestdata(t, "versions/"+name+".json")))
+		dec.UseNumber() // 1000.0 仍然是浮点数
+		if err := dec.Decode(&raw); err != nil {
+			t.Fatal(err)
+		}
+		for _, explicit := range []bool{true, false} {
+			if !explicit {
+				delete(raw, "python_version")
+			}
+			data, _ := json.Marshal(raw)
+			out, diags, err := Translate(data, o)
+			if err != nil {
+				t.Errorf("%s (python_version %v): %v", name, explicit, err)
+				continue
+			}
+			if out.C != want.C {
+				t.Errorf("%s (python_version %v): C differs from py311:\n%s", name, explicit, out.C)
+			}
+			if !reflect.DeepEqual(diags, wantDiags) {
+				t.Errorf("%s (python_version %v): diagnostics %v, want %v", name, explicit, diags, wantDiags)
+			}
+		}
+	}
+	if _, _, err := Translate([]byte(`{"_type": "Module", "body": [], "python_version": "2.7.18"}`), o); err == nil ||
+		!strings.Contains(err.Error(), "written by Python 2.7; py2c reads ASTs from Python 3.7 to 3.13") {
+		t.Errorf("Python 2 AST: got error %v", err)
+	}
+}
+
+// ast.dump() 的文本（ast.dump(tree, include_attributes=True, indent=1)）与 py2ast.py 的 JSON 翻译结果相同
+func TestTranslateDump(t *testing.T) {
+	o := DefaultOptions()
+	o.SourceFile = "example.py"
+	want, wantDiags, err := Translate(readTestdata(t, "example.json"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, diags, err := TranslateReader(bytes.NewReader(readTestdata(t, "example.dump")), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.C != want.C {
+		t.Errorf("C from the ast.dump text differs from the JSON:\n%s", out.C)
+	}
+	if !reflect.DeepEqual(diags, wantDiags) {
+		t.Errorf("diagnostics %v, want %v", diags, wantDiags)
+	}
+	if _, _, err := Translate([]byte("Module(body=[Pass(lineno=1, col_offset=0)], type_ignores=[]"), o); err == nil ||
+		!strings.Contains(err.Error(), "parsing ast.dump text: line 1, column 60: unexpected end of input") {
+		t.Errorf("truncated dump: got error %v", err)
+	}
+}
+
+// 仓库中的 py2ast.py 与 py2c dump-script 写出的 DumpScript 相同（改了一个就要改另一个）
+func TestDumpScript(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("..", "py2ast.py"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != DumpScript {
+		t.Errorf("py2ast.py differs from DumpScript; update it with: go run ./cmd/py2c dump-script -o py2ast.py")
+	}
+}
+
+func TestTranslateGenerators(t *testing.T) {
+	o := DefaultOptions()
+	o.SourceFile = "generators.py"
+	out, diags, err := Translate(readTestdata(t, "generators.json"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"typedef struct {\n    int _state;\n    int n;\n} countdown_gen;\n",
+		"int countdown_next(countdown_gen* self, int* _value) {",
+		"    switch (self->_state) {\n        case 0:\n            while (self->n > 0) {\n" +
+			"                *_value = self->n;\n                self->_state = 1;\n                return 1;\n                case 1:;\n" +
+			"                self->n = (self->n - 1);\n            }\n    }\n",
+		// 局部变量 i 是状态结构的字段；yield 的是 int
+		"for (self->i = 0; self->i < self->limit; self->i++) {",
+		"int evens_next(evens_gen* self, int* _value) {",
+		"    countdown_gen _gen1 = countdown(3);\n    int x;\n    while (countdown_next(&_gen1, &x)) {\n",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	var msgs []string
+	for _, d := range diags {
+		msgs = append(msgs, d.Message)
+	}
+	want := []string{
+		"unsupported node: Yield (guarded() cannot be translated as a generator because of a yield inside try)",
+		"unsupported use of the generator countdown() outside a for loop",
+		"unsupported for loop",
+	}
+	if !reflect.DeepEqual(msgs, want) {
+		t.Errorf("diagnostics %q, want %q", msgs, want)
+	}
+}
+
+func TestTranslateItertools(t *testing.T) {
+	o := DefaultOptions()
+	o.SourceFile = "itertools.py"
+	out, diags, err := Translate(readTestdata(t, "itertools.json"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"for (int i = 1; ; i++) {",
+		// 生成器中的 count：循环变量是结构体的字段
+		"for (self->i = 0; ; self->i += 2) {",
+		"for (int _r0 = 0; _r0 < 2; _r0++) {\n        char* w = \"hi\";\n",
+		// chain：break 之后不再执行后面的循环
+		"            _brk1 = 1;\n            break;\n",
+		"    if ((!_brk1)) {\n        for (v = 5; v < 100; v++) {\n",
+		// islice：跳过 start 之前的元素，取到 stop 时不再取下一个
+		"    while (evens_next(&_gen3, &e)) {\n        if (_n2 >= 4) {\n            break;\n        }\n        if (_n2 < 1) {\n",
+		"        printf(\"%d\\n\", e);\n        if (_n2 >= 4) {\n            break;\n        }\n    }\n",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if len(diags) != 1 || diags[0].Message != "unsupported call: itertools.count() outside a for loop" {
+		t.Errorf("diagnostics %v, want only the count() outside a for loop", diags)
+	}
+}
+
+func TestTranslateFunctional(t *testing.T) {
+	o := DefaultOptions()
+	o.SourceFile = "functional.py"
+	out, diags, err := Translate(readTestdata(t, "functional.json"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		// list(map(f, xs))：循环中 append
+		"    PyList_double* _l0 = PyList_double_new();\n    for (int _i2 = 0; _i2 < xs->len; _i2++) {\n        double _x1 = xs->items[_i2];\n",
+		"        square(_x1, &_t3);\n        PyList_double_append(_l0, _t3);\n",
+		// lambda 提升为 static 函数，外层的局部变量 k 成为参数
+		"static int py_lambda7(double v, int k) {\n    return v > k;\n}\n",
+		"        if (py_lambda7(_x5, k)) {\n            PyList_double_append(_l4, _x5);\n",
+		"        _s8 = (_s8 + py_lambda11(_x9, k));\n",
+		"        char* s = py_float_str(_x12);\n",
+		"        if ((!e)) {\n            continue;\n        }\n",
+		"        add(_r15, _x16, &_r15);\n",
+		// 没有初值的 reduce：第一个元素是初值，空的时候是 TypeError
+		"        if (_n19) {\n            _r18 = _x20;\n            _n19 = 0;\n        }\n        else {\n            _r18 = py_lambda22(_r18, _x20);\n",
+		"    py_reduce_check(_n19);\n",
+		"    printf(\"%f\\n\", PyList_double_max(_l23));\n",
+		"    printf(\"%d\\n\", py_lambda27(k));\n",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if len(diags) != 1 || diags[0].Message != "unsupported call: map() outside list(), sum(), min(), max() or a for loop" {
+		t.Errorf("diagnostics %v, want only the map() outside list(), sum() and loops", diags)
+	}
+}
+
+func TestTranslateLruCache(t *testing.T) {
+	o := DefaultOptions()
+	o.SourceFile = "memo.py"
+	out, diags, err := Translate(readTestdata(t, "memo.json"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"typedef struct {\n    int py_used;\n    int r;\n    double c;\n    double py_value;\n} py_cache_paths_entry;\n",
+		"    c += 0.0; // -0.0 and 0.0 are one key\n    py_h = py_cache_hash(py_h, &c, sizeof c);\n",
+		"        if (py_cache_paths[py_i].r == r && py_cache_paths[py_i].c == c) {\n",
+		// 入口先查表，每个 return 把结果放进表中
+		"void fib(int n, int* result) {\n    if (py_cache_fib_get(n, result)) {\n        return;\n    }\n",
+		"        *result = py_cache_fib_put(n, n);\n        return;\n",
+		"    *result = py_cache_paths_put(r, c, (_t3 + _t4));\n",
+		// 不纯的函数与 maxsize=0 不带缓存
+		"void noisy(int n, int* result) {\n    printf(",
+		"void off(int n, int* result) {\n    *result = (n + 1);\n",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if strings.Contains(out.C, "py_cache_noisy") || strings.Contains(out.C, "py_cache_off") {
+		t.Errorf("noisy() and off() should have no table:\n%s", out.C)
+	}
+	want := "@cache on noisy() is not translated because it is not pure (performs I/O (print)); the function is called without a cache"
+	if len(diags) != 1 || diags[0].Message != want {
+		t.Errorf("diagnostics %v, want only %q", diags, want)
+	}
+}
+
+// Enum 类翻译为 C 的 enum，NamedTuple / namedtuple 改写为按位置构造的类
+func TestTranslateRecords(t *testing.T) {
+	o := DefaultOptions()
+	o.SourceFile = "records.py"
+	out, diags, err := Translate(readTestdata(t, "records.json"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"/** Colours of a traffic light. */\ntypedef enum {\n    Color_RED = 1,\n    Color_GREEN = 2,\n    Color_AMBER = 3,\n    Color_STOP = Color_RED\n} Color;\n",
+		"typedef enum {\n    Prio_LOW = 1,\n    Prio_HIGH = 2\n} Prio;\n",
+		"static Color Color_members[] = {Color_RED, Color_GREEN, Color_AMBER};\n",
+		"        case 2:\n            return Color_GREEN;\n",
+		"void next_color(Color c, Color* result) {\n    if (c == Color_RED) {\n",
+		"        c = Color_members[_e0];\n",
+		"printf(\"%s %s %d %s\\n\", Color_str(c), Color_name(c), (int)c, Color_name(_t1));\n",
+		// 常量的 Color(2) 与 Color["AMBER"] 直接是成员；IntEnum 输出值
+		"printf(\"%s %s %d\\n\", Color_str(Color_GREEN), Color_str(Color_AMBER), Prio_HIGH);\n",
+		"Color_name(Color_of(v))",
+		// 关键字参数与默认值换成按位置的实参
+		"void Point___init__(Point* self, double x, double y) {\n",
+		"    Point___init__(&p, 1.5, 2.0);\n",
+		"    Point___init__(&q, 3.0, 0.0);\n",
+		"    double x = p.x;\n    double y = p.y;\n",
+		"x, y, q.x, q.y, Point_norm2(&p));\n",
+		"Point___init__(_o2, p.x, 5.0);\n",
+		"    Pair___init__(&pr, 1, 10);\n",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	want := "unsupported method label() in Enum class Mode (only NAME = value members are translated)"
+	if len(diags) != 1 || diags[0].Message != want {
+		t.Errorf("diagnostics %v, want only %q", diags, want)
+	}
+}
+
+// deque 是环形缓冲区，Counter 与 defaultdict 是按插入顺序保存键的散列表；元素与键的类型由构造的实参或第一处用法推断
+func TestTranslateCollections(t *testing.T) {
+	out, diags, err := Translate(readTestdata(t, "collections.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"PyDeque_int* q = PyDeque_int_from(_l1, -1);\n",
+		"    PyDeque_int_appendleft(q, 0);\n",
+		"PyDeque_int_contains(q, 2));\n",
+		// maxlen 的 deque 满了时从另一端丢掉元素；空的 deque() 的元素类型来自 append
+		"PyDeque_int* window = PyDeque_int_new(3);\n",
+		"        int x = (*PyDeque_int_at(window, _i4));\n",
+		"    PyDeque_int* q = PyDeque_int_from(_l0, -1);\n",
+		"    while ((q->len != 0)) {\n        int x = PyDeque_int_popleft(q);\n",
+		"PyCounter_charp* c = PyCounter_charp_from(words);\n",
+		"PyCounter_charp_get(c, \"z\"), c->len);\n",
+		"    PyCounter_charp_sort(c);\n    int _end7 = 2;\n",
+		"        char* w = c->keys[c->order[_i6]];\n        int n = c->values[c->order[_i6]];\n",
+		"    (*PyCounter_charp_at(c, \"z\")) += 2;\n",
+		"PyList_int_append((*PyDefaultDict_charp_PyList_intp_at(groups, w)), (int)strlen(w));\n",
+		"(PyDefaultDict_charp_int_find(counts, \"q\") >= 0));\n",
+		"        char* k = counts->keys[_i11];\n        int v = counts->values[_i11];\n",
+		"    if ((!(window->len != 0))) {\n",
+		"\"defaultdict(<class 'int'>, {\"",
+		"\"deque([\"",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	want := "unsupported call: defaultdict() with a default factory other than int, float, str and list"
+	if len(diags) != 1 || diags[0].Message != want {
+		t.Errorf("diagnostics %v, want only %q", diags, want)
+	}
+}
+
+// heapq 把列表当作最小堆：元素是数、字符串或 NamedTuple（按字段依次比较），上浮与下沉与 CPython 相同
+func TestTranslateHeapq(t *testing.T) {
+	out, diags, err := Translate(readTestdata(t, "heapq.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"    PyList_int_heapify(h);\n",
+		"    PyList_int_heappush(h, 0);\n",
+		"        PyList_int_append(out, PyList_int_heappop(h));\n",
+		"    char* first = PyList_charp_heappop(words);\n",
+		"    return strcmp(a, b) < 0;\n",
+		"static int PyList_Edgep_lt(Edge* a, Edge* b) {\n    if (a->dist < b->dist) {\n        return 1;\n    }\n    if (b->dist < a->dist) {\n        return 0;\n    }\n    if (a->node < b->node) {\n",
+		"        Edge* e = PyList_Edgep_heappop(pq);\n",
+		"                PyList_Edgep_heappush(pq, _o5);\n",
+		"py_raise(&PyExc_IndexError, \"index out of range\", 0);",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	if strings.Count(out.C, "static void PyList_int_heapify(") != 1 {
+		t.Errorf("want the heap functions of PyList_int once:\n%s", out.C)
+	}
+	want := []string{
+		"unsupported call: heapq.heapify on a list of Box* (only numbers, strings, IntEnum members and NamedTuples are ordered)",
+		"unsupported call: heapq.nlargest (only heappush, heappop and heapify are translated)",
+	}
+	got := []string{}
+	for _, d := range diags {
+		got = append(got, d.Message)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diagnostics %q, want %q", got, want)
+	}
+}
+
+// bisect 的查找与插入是有序列表上的二分查找；lo / hi 按位置或关键字给出，默认是 0 与 -1（到末尾）
+func TestTranslateBisect(t *testing.T) {
+	out, diags, err := Translate(readTestdata(t, "bisect.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"    int _p0 = PyList_int_bisect_left(xs, 3, 0, -1);\n    int _p1 = PyList_int_bisect_right(xs, 3, 0, -1);\n    int _p2 = PyList_int_bisect_right(xs, 3, 0, -1);\n",
+		"    int _p4 = PyList_int_bisect_left(xs, 8, 1, 5);\n",
+		"    PyList_int_insort_right(xs, 4, 0, -1);\n    PyList_int_insort_left(xs, 0, 0, -1);\n    PyList_int_insort_right(xs, 10, 0, -1);\n",
+		"    PyList_charp_insort_right(names, \"bob\", 0, -1);\n",
+		"*result = (*PyList_charp_at(letters, PyList_int_bisect_right(cutoffs, score, 0, -1)));\n",
+		"    int i = PyList_int_bisect_left(xs, 5, 0, -1);\n",
+		"static int PyList_charp_lt(char* a, char* b) {\n    return strcmp(a, b) < 0;\n}\n",
+		"        if (PyList_int_lt(*PyList_int_at(l, mid), x)) {\n",
+		"py_raise(&PyExc_ValueError, \"lo must be non-negative\", 0);",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	want := "unsupported call: bisect.bisect_left with the keyword argument key"
+	if len(diags) != 1 || diags[0].Message != want {
+		t.Errorf("diagnostics %v, want only %q", diags, want)
+	}
+}
+
+func TestTranslateRe(t *testing.T) {
+	out, diags, err := Translate(readTestdata(t, "re.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"#include <regex.h>\n",
+		"static PyRegex py_re_0 = {\"([0-9]{4})-([0-9][0-9])-([0-9][0-9])\", REG_EXTENDED, py_re_0_groups, 3, NULL};\n",
+		"static const char* py_re_1_names[] = {NULL, \"key\", \"value\"};\n",
+		"static PyRegex py_re_4 = {\"[0-9a-f]+\", REG_EXTENDED | REG_ICASE, py_re_4_groups, 0, NULL};\n",
+		"    PyMatch m = py_re_match(&py_re_0, s, 1);\n    if ((m).ok) {\n        char* _p0 = py_str_or_none(py_re_group(m, 1, NULL));\n",
+		"        char* _p3 = py_str_or_none(py_re_group(m, 0, \"key\"));\n",
+		"PyList_charp_str(py_re_findall(&py_re_2, \"3kg 10kg 7g 250kg\"))",
+		"py_re_sub(&py_re_3, \"\\\\2 at \\\\1\", \"me@host you@there\", 0)",
+		"if ((!(py_re_match(&py_re_4, \"deadbeefz\", 2)).ok)) {\n",
+		// (a)?b 匹配 "b" 时组 1 没有参与匹配，是 None
+		"static char* py_str_or_none(char* s) {\n    return s ? s : (char*)\"None\";\n}\n",
+		"static PyRegex py_re_5 = {\"(a)?b\", REG_EXTENDED, py_re_5_groups, 1, NULL};\n",
+		"        printf(\"%s %s [%s] %s\\n\", _p5, py_str_or_none(g), py_str_or_none(g), _s6);\n",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	want := "unsupported call: re.search(\"(?<=foo)bar\"): the lookbehind (?<=...) has no POSIX equivalent"
+	if len(diags) != 1 || diags[0].Message != want {
+		t.Errorf("diagnostics %v, want only %q", diags, want)
+	}
+}
+
+func TestTranslateArgparse(t *testing.T) {
+	out, diags, err := Translate(readTestdata(t, "argparse.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"#include <getopt.h>\n",
+		"typedef struct {\n    char* path;\n    int lines;\n    int verbose;\n    char* mode;\n} PyArgs;\n",
+		"        \"  -n LINES, --lines LINES\\n\"\n        \"                        how many lines (default: 10)\\n\"\n",
+		"        {\"lines\", required_argument, NULL, 'n'},\n",
+		"        switch (c = getopt_long(n, args, \"+:hn:v\", longopts, NULL)) {\n",
+		"            a.lines = py_args_int(optarg, \"-n/--lines\");\n",
+		"py_args_error(\"argument %s: invalid choice: '%s' (choose from 'text', 'hex')\", \"--mode\", optarg);",
+		"        py_args_join(required, \", \", \"path\");\n",
+		"    PyArgs args = py_args_parse(py_sys_argv, NULL);\n    if (args.verbose) {\n",
+		"    printf(\"%d\\n\", args.lines);\n",
+		"int main(int argc, char** argv) {\n",
+	} {
+		if !strings.Contains(out.C, want) {
+			t.Errorf("output lacks %q:\n%s", want, out.C)
+		}
+	}
+	want := "argparse: parser.add_argument(\"files\"): the keyword argument nargs"
+	if len(diags) != 1 || diags[0].Message != want {
+		t.Errorf("diagnostics %v, want only %q", diags, want)
+	}
+}
+
+// wantAll: out 中含有 wants 中的每一段
+func wantAll(t *testing.T, what, out string, wants ...string) {
+	t.Helper()
+	for _, want := range wants {
+		if !strings.Contains(out, want) {
+			t.Errorf("%s: output lacks %q:\n%s", what, want, out)
+		}
+	}
+}
+
+// try/except/finally、raise 与重新抛出：setjmp、status 与 exit 三种实现
+func TestTranslateExceptions(t *testing.T) {
+	src := readTestdata(t, "exceptions.json")
+	out, diags, err := Translate(src, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 0 {
+		t.Errorf("unexpected diagnostics: %+v", diags)
+	}
+	wantAll(t, "setjmp", out.C,
+		"#include <setjmp.h>\n",
+		"        py_raise(&PyExc_ConfigError, \"empty\", 11);\n",
+		"                PyExcFrame _e1;\n                py_try_push(&_e1);\n                if (setjmp(_e1.env) == 0) {\n                    parse(text, &n);\n",
+		"                } else if (py_exc_matches(_e1.exc.type, &PyExc_ConfigError)) {\n                    PyException* e = &_e1.exc;\n",
+		"            py_reraise(&_e1.exc);\n",
+		"        } else if (py_exc_matches(_e1.exc.type, &PyExc_KeyError) || py_exc_matches(_e1.exc.type, &PyExc_ValueError)) {\n",
+		"        printf(\"%s %s\\n\", \"done\", text);\n        if (_e0.exc.type) {\n            py_reraise(&_e0.exc); // re-raise after finally\n",
+		"printf(\"%s %s %s\\n\", \"app error:\", e->type->name, e->msg);",
+	)
+	o := DefaultOptions()
+	o.Exceptions = "status"
+	if out, _, err = Translate(src, o); err != nil {
+		t.Fatal(err)
+	}
+	wantAll(t, "status", out.C,
+		"int parse(char* text, int* result) {\n",
+		"        return py_err_set(PY_ERR_ConfigError, \"empty\", 11);\n",
+		"        if ((_e0 = parse(text, &n))) {\n            goto _e0_except;\n        }\n",
+		"                goto _e0_finally;\n",
+		"                _e0 = PY_OK; // handled\n",
+		"        _e0_finally: ;\n        printf(\"%s %s\\n\", \"done\", text);\n        if (_e0) {\n            return _e0;\n        }\n",
+		"printf(\"%s %s %s\\n\", \"app error:\", py_err_name[e->type], e->msg);",
+		"                py_err_exit(_e3);\n",
+	)
+	if strings.Contains(out.C, "setjmp") {
+		t.Errorf("status: setjmp in the output:\n%s", out.C)
+	}
+	o.Exceptions = "exit"
+	if out, diags, err = Translate(src, o); err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 0 {
+		t.Errorf("exit: unexpected diagnostics: %+v", diags)
+	}
+	wantAll(t, "exit", out.C,
+		"    // except ConfigError: not reachable, raise exits with -exceptions=exit\n",
+		"    // except KeyError, ValueError: not reachable, raise exits with -exceptions=exit\n    printf(\"%s %s\\n\", \"done\", text);\n",
+	)
+}
+
+// with open(...) as f：文件在离开 with 时关闭，return 与异常也不例外
+func TestTranslateWith(t *testing.T) {
+	out, diags, err := Translate(readTestdata(t, "with.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 0 {
+		t.Errorf("unexpected diagnostics: %+v", diags)
+	}
+	wantAll(t, "with", out.C,
+		"static void py_fclose(FILE** f) {\n",
+		"    FILE* f = fopen(path, \"r\");\n    if (!f) {\n        py_raise(&PyExc_FileNotFoundError, strerror(errno), 2);\n    }\n",
+		"                free(_lb2);\n                py_try_pop(&_e1);\n                py_fclose(&f);\n                return;\n",
+		"    FILE* out = fopen(\"py2c_with.txt\", \"w\");\n",
+		"            fputs(\"two\\n\", out);\n            py_try_pop(&_e5);\n        }\n        py_fclose(&out);\n",
+		// 两个 with 项：第二个文件在第一个的保护下打开
+		"            dst = fopen(\"py2c_with2.txt\", \"w\");\n",
+		"                py_fclose(&dst);\n",
+		"        py_fclose(&src);\n",
+		// 异常离开 with 时先关闭文件再继续抛出
+		"                    py_raise(&PyExc_ValueError, \"inside with\", 17);\n                }\n                py_fclose(&f);\n                if (_e13.exc.type) {\n                    py_reraise(&_e13.exc);",
+	)
+}
+
+// open() 的 r / w / a 模式与 read、readlines、write、close
+func TestTranslateFileIO(t *testing.T) {
+	out, diags, err := Translate(readTestdata(t, "files.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 0 {
+		t.Errorf("unexpected diagnostics: %+v", diags)
+	}
+	wantAll(t, "files", out.C,
+		"    FILE* f = fopen(path, \"w\");\n    if (!f) {\n        py_raise(&PyExc_OSError, strerror(errno), 2);\n    }\n",
+		"        fputs(_s1, f);\n    }\n    py_fclose(&f);\n",
+		"    int n = py_file_readlines(f)->len;\n",
+		"    FILE* f = fopen(\"py2c_files.txt\", \"a\");\n",
+		"    f = fopen(\"py2c_files.txt\", \"r\");\n",
+		"    char* text = py_file_read(f, -1);\n    py_fclose(&f);\n",
+		"static char* py_file_read(FILE* f, long n) {",
+		"static PyList_charp* py_file_readlines(FILE* f) {",
+	)
+}
+
+// json.loads / dumps / load / dump 与 PyJson 的取值
+func TestTranslateJSON(t *testing.T) {
+	out, diags, err := Translate(readTestdata(t, "jsonmod.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 0 {
+		t.Errorf("unexpected diagnostics: %+v", diags)
+	}
+	wantAll(t, "json", out.C,
+		"    PyJson* doc = py_json_loads(\"{\\\"name\\\": \\\"py2c\\\", ",
+		"py_json_str(py_json_get(doc, \"name\"))",
+		"py_json_len(py_json_get(doc, \"tags\"))",
+		"    if ((py_json_has(doc, \"tags\") && !py_json_has(doc, \"missing\"))) {\n",
+		"    printf(\"%s\\n\", py_json_dumps(py_json_get(doc, \"tags\"), -1));\n",
+		"    fputs(py_json_dumps(doc, -1), f);\n",
+		"    PyJson* back = py_json_loads(py_file_read(f, -1));\n",
+		"py_json_str(py_json_at(py_json_get(back, \"tags\"), 1))",
+	)
+}
+
+// property 的 getter/setter、__str__、warnings.warn、os.environ 与 datetime.now
+func TestTranslateStdlibBasics(t *testing.T) {
+	out, diags, err := Translate(readTestdata(t, "stdlib.json"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 0 {
+		t.Errorf("unexpected diagnostics: %+v", diags)
+	}
+	wantAll(t, "stdlib", out.C,
+		"    Temp_set_celsius(&t, 25);\n    printf(\"%f %s\\n\", Temp_get_celsius(&t), Temp_str(&t));\n",
+		"char* Temp_str(Temp* self) {\n    return Temp___str__(self);\n}\n",
+		"        static int _warned0 = 0;\n        py_warn(&_warned0, \"UserWarning\", \"below absolute zero\", 17);\n",
+		"    char* home = py_getenv_or(\"PY2C_TEST_UNSET\", \"none\");\n",
+		"(getenv(\"PY2C_TEST_UNSET\") != NULL)",
+		"} PyDateTime;\n",
+		"    PyDateTime d = py_datetime_now();\n    char* stamp = py_datetime_strftime(d, \"%Y-%m-%d\");\n",
+	)
+}
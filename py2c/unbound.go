@@ -0,0 +1,553 @@
+package py2c
+
+import "strings"
+
+// --- 使用前未赋值的变量 ---
+// declaredVars 是平坦的、全程序的，读一个还没有赋值的变量时生成的 C 名字可能根本没有声明（或是别处的同名变量）。
+// 代码生成之前按语句顺序检查每个作用域（模块顶层、每个函数与方法）：局部变量在每条路径上都赋值之后才能读，
+// 否则报告（Python 中是 UnboundLocalError / NameError）；既不是局部变量、也不是外层或内置名字的报告为没有定义。
+// 默认是警告，Options.Strict（-strict）时是错误
+
+// flowState: 按语句顺序走到某一点时的赋值情况
+type flowState struct {
+	def   map[string]bool // 每条路径上都已赋值
+	maybe map[string]bool // 至少一条路径上已赋值
+}
+
+// flowExit: 一段语句执行完的结果
+type flowExit struct {
+	st     flowState
+	term   bool        // 每条路径都以 return / raise / break / continue / sys.exit() 结束，不会走到后面
+	breaks []flowState // break 时的赋值情况，交给所在的循环
+}
+
+// unboundCheck: 一个作用域的检查
+type unboundCheck struct {
+	g        *generator
+	fn       string          // 函数名，模块顶层为空
+	locals   map[string]bool // 作用域内赋值的名字
+	parent   *unboundCheck   // 外层作用域（模块、外层函数），模块顶层为 nil
+	star     bool            // 有 from m import *：不报告没有定义的名字
+	reported map[string]bool
+}
+
+// pyBuiltinNames: Python 的内置名字
+var pyBuiltinNames = map[string]bool{}
+
+func init() {
+	for _, id := range strings.Fields(`abs aiter all anext any ascii bin bool breakpoint bytearray bytes callable chr
+		classmethod compile complex delattr dict dir divmod enumerate eval exec exit filter float format frozenset
+		getattr globals hasattr hash help hex id input int isinstance issubclass iter len list locals map max
+		memoryview min next object oct open ord pow print property quit range repr reversed round set setattr slice
+		sorted staticmethod str sum super tuple type vars zip __import__ __name__ __file__ __doc__ __debug__
+		__builtins__ __spec__ __package__ __loader__ Ellipsis NotImplemented None True False
+		BaseException BaseExceptionGroup Exception ExceptionGroup ArithmeticError AssertionError AttributeError
+		BlockingIOError BrokenPipeError BufferError ChildProcessError ConnectionAbortedError ConnectionError
+		ConnectionRefusedError ConnectionResetError EOFError EnvironmentError FileExistsError FileNotFoundError
+		FloatingPointError GeneratorExit IOError ImportError IndentationError IndexError InterruptedError
+		IsADirectoryError KeyError KeyboardInterrupt LookupError MemoryError ModuleNotFoundError NameError
+		NotADirectoryError NotImplementedError OSError OverflowError PermissionError ProcessLookupError
+		RecursionError ReferenceError RuntimeError StopAsyncIteration StopIteration SyntaxError SystemError
+		SystemExit TabError TimeoutError TypeError UnboundLocalError UnicodeDecodeError UnicodeEncodeError
+		UnicodeError UnicodeTranslateError ValueError ZeroDivisionError Warning BytesWarning DeprecationWarning
+		EncodingWarning FutureWarning ImportWarning PendingDeprecationWarning ResourceWarning RuntimeWarning
+		SyntaxWarning UnicodeWarning UserWarning`) {
+		pyBuiltinNames[id] = true
+	}
+}
+
+// checkUnbound: 检查模块顶层与其中所有函数、方法
+func (g *generator) checkUnbound(root ASTNode) {
+	body, _ := root["body"].([]interface{})
+	c := &unboundCheck{g: g, locals: boundNames(body), reported: map[string]bool{}}
+	c.block(body, flowState{map[string]bool{}, map[string]bool{}})
+}
+
+// boundNames: body 中（不含嵌套的函数与类体）赋值、定义或 import 的名字，不含 global / nonlocal 声明的
+func boundNames(body []interface{}) map[string]bool {
+	names := localNames(body)
+	globals := map[string]bool{}
+	var walk func(stmts []interface{})
+	walk = func(stmts []interface{}) {
+		for _, stmt := range stmts {
+			m, _ := stmt.(map[string]interface{})
+			switch m["_type"] {
+			case "FunctionDef", "AsyncFunctionDef", "ClassDef":
+				id, _ := m["name"].(string)
+				names[id] = true
+				continue
+			case "Import", "ImportFrom":
+				for _, id := range importedNames(m) {
+					names[id] = true
+				}
+			case "Global", "Nonlocal":
+				ids, _ := m["names"].([]interface{})
+				for _, id := range ids {
+					if s, ok := id.(string); ok {
+						globals[s] = true
+					}
+				}
+			}
+			for _, key := range []string{"body", "orelse", "finalbody", "handlers", "cases"} {
+				if b, ok := m[key].([]interface{}); ok {
+					walk(b)
+				}
+			}
+		}
+	}
+	walk(body)
+	for id := range globals {
+		delete(names, id)
+	}
+	return names
+}
+
+// importedNames: import 语句绑定的名字（import a.b 绑定 a）
+func importedNames(m map[string]interface{}) []string {
+	ids := []string{}
+	aliases, _ := m["names"].([]interface{})
+	for _, a := range aliases {
+		am, _ := a.(map[string]interface{})
+		id, _ := am["asname"].(string)
+		if id == "" {
+			id, _ = am["name"].(string)
+			if m["_type"] == "Import" {
+				id = strings.Split(id, ".")[0]
+			}
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// copy: 可以单独修改的副本
+func (s flowState) copy() flowState {
+	out := flowState{map[string]bool{}, map[string]bool{}}
+	for id := range s.def {
+		out.def[id] = true
+	}
+	for id := range s.maybe {
+		out.maybe[id] = true
+	}
+	return out
+}
+
+// assign: 这一点之后 id 已赋值
+func (s flowState) assign(id string) {
+	s.def[id], s.maybe[id] = true, true
+}
+
+// mergeFlows: 几条路径汇合：每条路径上都赋值的才算已赋值；没有路径时 ok 为 false
+func mergeFlows(states []flowState) (flowState, bool) {
+	if len(states) == 0 {
+		return flowState{}, false
+	}
+	out := states[0].copy()
+	for _, s := range states[1:] {
+		for id := range out.def {
+			if !s.def[id] {
+				delete(out.def, id)
+			}
+		}
+		for id := range s.maybe {
+			out.maybe[id] = true
+		}
+	}
+	return out, true
+}
+
+// joinExits: 汇合 exits 中会走到后面的路径；break 交给调用者（所在的循环）
+func joinExits(exits ...flowExit) flowExit {
+	states, breaks := []flowState{}, []flowState{}
+	for _, e := range exits {
+		if !e.term {
+			states = append(states, e.st)
+		}
+		breaks = append(breaks, e.breaks...)
+	}
+	st, ok := mergeFlows(states)
+	return flowExit{st: st, term: !ok, breaks: breaks}
+}
+
+// block: 按顺序检查语句
+func (c *unboundCheck) block(stmts []interface{}, in flowState) flowExit {
+	st := in.copy()
+	var breaks []flowState
+	for _, stmt := range stmts {
+		m, _ := stmt.(map[string]interface{})
+		e := c.stmt(m, st)
+		breaks = append(breaks, e.breaks...)
+		if e.term {
+			return flowExit{st: e.st, term: true, breaks: breaks}
+		}
+		st = e.st
+	}
+	return flowExit{st: st, breaks: breaks}
+}
+
+// stmt: 检查一条语句；st 可以就地修改
+func (c *unboundCheck) stmt(m map[string]interface{}, st flowState) flowExit {
+	body, _ := m["body"].([]interface{})
+	orelse, _ := m["orelse"].([]interface{})
+	switch m["_type"] {
+	case "Expr", "Assert":
+		c.expr(m["value"], st)
+		c.expr(m["test"], st)
+		c.expr(m["msg"], st)
+		if c.exits(m["value"]) {
+			return flowExit{st: st, term: true}
+		}
+	case "Assign":
+		c.expr(m["value"], st)
+		targets, _ := m["targets"].([]interface{})
+		for _, t := range targets {
+			c.assignTarget(t, st)
+		}
+	case "AnnAssign":
+		if m["value"] != nil {
+			c.expr(m["value"], st)
+			c.assignTarget(m["target"], st)
+		}
+	case "AugAssign":
+		c.expr(m["value"], st)
+		t, _ := m["target"].(map[string]interface{})
+		if id, ok := t["id"].(string); ok && t["_type"] == "Name" {
+			c.use(t, id, st)
+			st.assign(id)
+		} else {
+			c.assignTarget(t, st)
+		}
+	case "Delete":
+		targets, _ := m["targets"].([]interface{})
+		for _, t := range targets {
+			tm, _ := t.(map[string]interface{})
+			if id, ok := tm["id"].(string); ok && tm["_type"] == "Name" {
+				c.use(tm, id, st)
+				delete(st.def, id)
+			} else {
+				c.assignTarget(t, st)
+			}
+		}
+	case "Return":
+		c.expr(m["value"], st)
+		return flowExit{st: st, term: true}
+	case "Raise":
+		c.expr(m["exc"], st)
+		c.expr(m["cause"], st)
+		return flowExit{st: st, term: true}
+	case "Break":
+		return flowExit{st: st, term: true, breaks: []flowState{st}}
+	case "Continue":
+		return flowExit{st: st, term: true}
+	case "If":
+		c.expr(m["test"], st)
+		return joinExits(c.block(body, st), c.block(orelse, st))
+	case "For", "AsyncFor", "While":
+		return c.loop(m, body, orelse, st)
+	case "Try", "TryStar":
+		return c.try(m, body, orelse, st)
+	case "With", "AsyncWith":
+		items, _ := m["items"].([]interface{})
+		for _, it := range items {
+			im, _ := it.(map[string]interface{})
+			c.expr(im["context_expr"], st)
+			if im["optional_vars"] != nil {
+				c.assignTarget(im["optional_vars"], st)
+			}
+		}
+		return c.block(body, st)
+	case "Match":
+		c.expr(m["subject"], st)
+		cases, _ := m["cases"].([]interface{})
+		exits, irrefutable := []flowExit{}, false
+		for _, cs := range cases {
+			cm, _ := cs.(map[string]interface{})
+			in := st.copy()
+			collectPatternNames(cm["pattern"], in)
+			c.expr(cm["guard"], in)
+			b, _ := cm["body"].([]interface{})
+			exits = append(exits, c.block(b, in))
+			p, _ := cm["pattern"].(map[string]interface{})
+			irrefutable = irrefutable || p["_type"] == "MatchAs" && p["pattern"] == nil && cm["guard"] == nil
+		}
+		if !irrefutable {
+			exits = append(exits, flowExit{st: st})
+		}
+		return joinExits(exits...)
+	case "FunctionDef", "AsyncFunctionDef":
+		c.expr(m["decorator_list"], st)
+		if args, ok := m["args"].(map[string]interface{}); ok {
+			c.expr(args["defaults"], st)
+			c.expr(args["kw_defaults"], st)
+		}
+		c.function(m)
+		id, _ := m["name"].(string)
+		st.assign(id)
+	case "ClassDef":
+		c.expr(m["decorator_list"], st)
+		c.expr(m["bases"], st)
+		c.expr(m["keywords"], st)
+		for _, s := range body {
+			if sm, ok := s.(map[string]interface{}); ok && (sm["_type"] == "FunctionDef" || sm["_type"] == "AsyncFunctionDef") {
+				c.function(sm)
+			}
+		}
+		id, _ := m["name"].(string)
+		st.assign(id)
+	case "Import", "ImportFrom":
+		for _, id := range importedNames(m) {
+			if id == "*" {
+				c.star = true
+				continue
+			}
+			st.assign(id)
+		}
+	}
+	return flowExit{st: st}
+}
+
+// loop: for / while。循环体可能一次也不执行，后面还会再执行：进入循环体时，循环体中赋值的名字可能已赋值。
+// while True 只能经 break 离开
+func (c *unboundCheck) loop(m map[string]interface{}, body, orelse []interface{}, st flowState) flowExit {
+	c.expr(m["iter"], st)
+	c.expr(m["test"], st)
+	again := st.copy()
+	for id := range boundNames(body) {
+		again.maybe[id] = true
+	}
+	in := again.copy()
+	if m["target"] != nil {
+		c.assignTarget(m["target"], in)
+		collectNames(m["target"], func(id string) { again.maybe[id] = true })
+	}
+	b := c.block(body, in)
+	if t, ok := m["test"].(map[string]interface{}); ok && t["_type"] == "Constant" && t["value"] == true {
+		st, ok := mergeFlows(b.breaks)
+		return flowExit{st: st, term: !ok}
+	}
+	e := c.block(orelse, again)
+	exits := []flowExit{e}
+	for _, s := range b.breaks {
+		exits = append(exits, flowExit{st: s})
+	}
+	return joinExits(exits...)
+}
+
+// try: except 可能从 try 块的任何一点进入，finally 在每条路径（包括异常）之后执行
+func (c *unboundCheck) try(m map[string]interface{}, body, orelse []interface{}, st flowState) flowExit {
+	anywhere := st.copy()
+	for id := range boundNames(body) {
+		anywhere.maybe[id] = true
+	}
+	b := c.block(body, st)
+	exits := []flowExit{b}
+	if !b.term {
+		exits[0] = c.block(orelse, b.st)
+		exits[0].breaks = append(b.breaks, exits[0].breaks...)
+	}
+	handlers, _ := m["handlers"].([]interface{})
+	for _, h := range handlers {
+		hm, _ := h.(map[string]interface{})
+		in := anywhere.copy()
+		c.expr(hm["type"], in)
+		if id, ok := hm["name"].(string); ok && id != "" {
+			in.assign(id)
+		}
+		hb, _ := hm["body"].([]interface{})
+		exits = append(exits, c.block(hb, in))
+	}
+	out := joinExits(exits...)
+	finalbody, _ := m["finalbody"].([]interface{})
+	if len(finalbody) == 0 {
+		return out
+	}
+	all := anywhere.copy()
+	for _, e := range exits {
+		for id := range e.st.maybe {
+			all.maybe[id] = true
+		}
+	}
+	f := c.block(finalbody, all)
+	if f.term {
+		return flowExit{st: f.st, term: true, breaks: f.breaks}
+	}
+	if out.term {
+		return flowExit{st: out.st, term: true, breaks: append(out.breaks, f.breaks...)}
+	}
+	for id := range f.st.def {
+		out.st.assign(id)
+	}
+	out.breaks = append(out.breaks, f.breaks...)
+	return out
+}
+
+// function: 函数或方法是单独的作用域；参数已赋值，外层的名字都可以读（调用时才读）
+func (c *unboundCheck) function(m map[string]interface{}) {
+	body, _ := m["body"].([]interface{})
+	name, _ := m["name"].(string)
+	fc := &unboundCheck{g: c.g, fn: name, locals: boundNames(body), parent: c, star: c.star, reported: map[string]bool{}}
+	st := flowState{map[string]bool{}, map[string]bool{}}
+	for _, p := range funcParams(m) {
+		fc.locals[p] = true
+		st.assign(p)
+	}
+	fc.block(body, st)
+}
+
+// funcParams: 函数的全部参数名
+func funcParams(m map[string]interface{}) []string {
+	ids := []string{}
+	args, _ := m["args"].(map[string]interface{})
+	for _, key := range []string{"posonlyargs", "args", "vararg", "kwonlyargs", "kwarg"} {
+		list, ok := args[key].([]interface{})
+		if !ok {
+			list = []interface{}{args[key]}
+		}
+		for _, a := range list {
+			if am, ok := a.(map[string]interface{}); ok {
+				if id, ok := am["arg"].(string); ok {
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+	return ids
+}
+
+// collectPatternNames: match 模式绑定的名字
+func collectPatternNames(node interface{}, st flowState) {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			collectPatternNames(e, st)
+		}
+	case map[string]interface{}:
+		for _, key := range []string{"name", "rest"} {
+			if id, ok := n[key].(string); ok && id != "" {
+				st.assign(id)
+			}
+		}
+		for _, key := range []string{"pattern", "patterns", "kwd_patterns"} {
+			collectPatternNames(n[key], st)
+		}
+	}
+}
+
+// assignTarget: 赋值目标中的名字已赋值；下标与属性中的表达式是读
+func (c *unboundCheck) assignTarget(node interface{}, st flowState) {
+	m, _ := node.(map[string]interface{})
+	switch m["_type"] {
+	case "Name":
+		id, _ := m["id"].(string)
+		st.assign(id)
+	case "Tuple", "List":
+		elts, _ := m["elts"].([]interface{})
+		for _, e := range elts {
+			c.assignTarget(e, st)
+		}
+	case "Starred":
+		c.assignTarget(m["value"], st)
+	default:
+		c.expr(m["value"], st)
+		c.expr(m["slice"], st)
+	}
+}
+
+// expr: 检查表达式中读的名字；推导式的变量只在推导式里，lambda 的函数体在调用时才读
+func (c *unboundCheck) expr(node interface{}, st flowState) {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			c.expr(e, st)
+		}
+	case map[string]interface{}:
+		switch n["_type"] {
+		case "Name":
+			if ctx, _ := n["ctx"].(map[string]interface{}); ctx["_type"] == "Load" {
+				id, _ := n["id"].(string)
+				c.use(n, id, st)
+			}
+			return
+		case "Lambda":
+			if args, ok := n["args"].(map[string]interface{}); ok {
+				c.expr(args["defaults"], st)
+				c.expr(args["kw_defaults"], st)
+			}
+			return
+		case "ListComp", "SetComp", "GeneratorExp", "DictComp":
+			inner := st.copy()
+			gens, _ := n["generators"].([]interface{})
+			for i, gen := range gens {
+				gm, _ := gen.(map[string]interface{})
+				if i == 0 {
+					c.expr(gm["iter"], st)
+				} else {
+					c.expr(gm["iter"], inner)
+				}
+				c.assignTarget(gm["target"], inner)
+				c.expr(gm["ifs"], inner)
+			}
+			c.expr(n["elt"], inner)
+			c.expr(n["key"], inner)
+			c.expr(n["value"], inner)
+			return
+		case "NamedExpr":
+			c.expr(n["value"], st)
+			c.assignTarget(n["target"], st)
+			return
+		}
+		for _, v := range childValues(n) {
+			c.expr(v, st)
+		}
+	}
+}
+
+// exitCalls: 结束进程、不会返回的调用
+var exitCalls = map[string]bool{"sys.exit": true, "os._exit": true, "os.abort": true}
+
+// exits: 表达式语句是 sys.exit() / os._exit() / os.abort()，或没有被程序重新定义的 exit() / quit()
+func (c *unboundCheck) exits(node interface{}) bool {
+	call, _ := node.(map[string]interface{})
+	fn, _ := call["func"].(map[string]interface{})
+	if call["_type"] != "Call" || fn == nil {
+		return false
+	}
+	if id, ok := fn["id"].(string); ok && fn["_type"] == "Name" && (id == "exit" || id == "quit") && !c.defines(id) {
+		return true
+	}
+	return exitCalls[c.g.importedName(fn)]
+}
+
+// defines: id 是这个作用域或外层作用域的名字
+func (c *unboundCheck) defines(id string) bool {
+	for ; c != nil; c = c.parent {
+		if c.locals[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// use: 读 id；每个名字只报告第一处
+func (c *unboundCheck) use(node map[string]interface{}, id string, st flowState) {
+	if st.def[id] || c.reported[id] {
+		return
+	}
+	level := logWarn
+	if c.g.optStrict {
+		level = logError
+	}
+	switch {
+	case c.locals[id] && c.fn != "" && c.parent.defines(id) && !st.maybe[id]:
+		c.g.report(level, node, "%s is used before it is assigned: %s assigns it, so it is local there (declare global %s to use the outer variable)", id, c.fn, id)
+	case c.locals[id] && !st.maybe[id]:
+		c.g.report(level, node, "%s is used before it is assigned", id)
+	case c.locals[id]:
+		c.g.report(level, node, "%s may be used before it is assigned: not every path to this use assigns it", id)
+	case c.parent.defines(id) || pyBuiltinNames[id] || c.star:
+		return
+	default:
+		c.g.report(level, node, "%s is not defined", id)
+	}
+	c.reported[id] = true
+}
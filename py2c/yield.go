@@ -0,0 +1,372 @@
+package py2c
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 生成器函数（函数体中有 yield 的顶层函数）翻译为状态机。参数与局部变量放在结构体 NAME_gen 中，
+// _state 记下从哪一个 yield 继续；NAME(...) 只初始化结构体，NAME_next(&gen, &x) 从上次停下的地方继续执行，
+// 把下一个值写入 *_value 并返回 1，函数体执行完时返回 0：
+//
+//	def countdown(n):           int countdown_next(countdown_gen* self, int* _value) {
+//	    while n > 0:                switch (self->_state) {
+//	        yield n                 case 0:
+//	        n = n - 1                   while (self->n > 0) {
+//	                                        *_value = self->n;
+//	for x in countdown(3):                  self->_state = 1;
+//	    print(x)                            return 1;
+//	                                        case 1:;
+//	                                        self->n = (self->n - 1);
+//	                                    ...
+//
+// 每个 yield 之后是 switch 的一个 case 标号（可以在循环里面）；局部变量都在结构体中，跨过 yield 仍然有效。
+// 只支持 for x in gen(...) 需要的情形：yield 是单独的语句且有值，不在 try、with 中，没有嵌套的函数与 lambda，
+// return 不带值，局部变量与 yield 的值的类型都能推断出来且不是对象；生成器只能由 for 循环使用。
+// 其他生成器函数照常翻译，yield 报告为不能翻译并给出原因
+
+// genFunc: 一个生成器函数
+type genFunc struct {
+	name   string
+	node   map[string]interface{}
+	reason string    // 不能翻译为状态机的原因，空为可以
+	elem   string    // yield 的值的 C 类型
+	fields []irParam // 结构体中 _state 之后的字段：参数、局部变量，以及生成函数体时加入的跨过 yield 的循环临时变量
+	states int       // 已经生成的 yield 的个数，也是最后一个 case 标号
+}
+
+// collectGenerators: 登记有 yield 的顶层函数，记下语句结构上的限制。在类型推断之前运行：
+// for x in gen(...) 的循环变量的类型是 yield 的值的类型
+func (g *generator) collectGenerators(root ASTNode) {
+	g.genFuncs = map[string]*genFunc{}
+	body, _ := root["body"].([]interface{})
+	for _, s := range body {
+		fn, _ := s.(map[string]interface{})
+		name, _ := fn["name"].(string)
+		if fn["_type"] != "FunctionDef" || fn["_extern"] == true || fn["_cextern"] == true || !hasYield(fn["body"]) {
+			continue
+		}
+		gen := &genFunc{name: name, node: fn}
+		if decos, _ := fn["decorator_list"].([]interface{}); len(decos) > 0 {
+			gen.reason = "a decorator"
+		} else {
+			gen.reason = genStmtRestriction(fn["body"].([]interface{}))
+		}
+		g.genFuncs[name] = gen
+	}
+}
+
+// hasYield: node 中（不进入嵌套的函数、类与 lambda）有 yield 或 yield from
+func hasYield(node interface{}) bool {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			if hasYield(e) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		switch n["_type"] {
+		case "Yield", "YieldFrom":
+			return true
+		case "FunctionDef", "AsyncFunctionDef", "ClassDef", "Lambda":
+			return false
+		}
+		for _, k := range sortedNodeKeys(n) {
+			if hasYield(n[k]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// genStmtRestriction: 生成器的语句中不能翻译为状态机的写法，空为没有
+func genStmtRestriction(stmts []interface{}) string {
+	for _, s := range stmts {
+		m, _ := s.(map[string]interface{})
+		switch m["_type"] {
+		case "FunctionDef", "AsyncFunctionDef", "ClassDef":
+			return "a nested function or class"
+		case "Return":
+			if m["value"] != nil {
+				return "return with a value"
+			}
+		case "Try", "TryStar", "With":
+			if hasYield(m) {
+				return fmt.Sprintf("a yield inside %s", strings.ToLower(strings.TrimSuffix(m["_type"].(string), "Star")))
+			}
+		}
+		if v, _ := m["value"].(map[string]interface{}); m["_type"] == "Expr" && v["_type"] == "Yield" {
+			if v["value"] == nil {
+				return "a yield without a value"
+			}
+			m = v // yield 的值中不能再有 yield
+		}
+		for _, k := range sortedNodeKeys(m) {
+			if inner, ok := m[k].([]interface{}); ok && (k == "body" || k == "orelse" || k == "finalbody") {
+				if r := genStmtRestriction(inner); r != "" {
+					return r
+				}
+				continue
+			}
+			if k == "handlers" {
+				for _, h := range m[k].([]interface{}) {
+					hb, _ := h.(map[string]interface{})["body"].([]interface{})
+					if r := genStmtRestriction(hb); r != "" {
+						return r
+					}
+				}
+				continue
+			}
+			if r := genExprRestriction(m[k]); r != "" {
+				return r
+			}
+		}
+	}
+	return ""
+}
+
+// genExprRestriction: 表达式中的 yield（x = yield v 等）、yield from 与 lambda
+func genExprRestriction(node interface{}) string {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, e := range n {
+			if r := genExprRestriction(e); r != "" {
+				return r
+			}
+		}
+	case map[string]interface{}:
+		switch n["_type"] {
+		case "Yield":
+			return "a yield inside an expression"
+		case "YieldFrom":
+			return "yield from"
+		case "Lambda":
+			return "a lambda"
+		}
+		for _, k := range sortedNodeKeys(n) {
+			if r := genExprRestriction(n[k]); r != "" {
+				return r
+			}
+		}
+	}
+	return ""
+}
+
+// checkGenerators: 类型推断之后，决定 yield 的值的类型，检查局部变量与循环
+func (g *generator) checkGenerators() {
+	for _, name := range sortedKeys(g.genFuncs) {
+		gen := g.genFuncs[name]
+		if gen.reason != "" {
+			continue
+		}
+		gen.elem, gen.reason = g.yieldType(gen)
+		if gen.reason == "" {
+			gen.reason = g.genLocalsRestriction(gen)
+		}
+		if gen.reason == "" && g.statusFuncs[name] {
+			gen.reason = "an exception that may be raised (-exceptions=status)"
+		}
+		g.tracef("generator %s: yields %s, reason=%q", name, gen.elem, gen.reason)
+	}
+}
+
+// yieldType: 各个 yield 的值的类型合并为一个；空时返回不能翻译的原因
+func (g *generator) yieldType(gen *genFunc) (string, string) {
+	var types []string
+	walkInferStmts(gen.node["body"].([]interface{}), func(m map[string]interface{}) {
+		if v, _ := m["value"].(map[string]interface{}); m["_type"] == "Expr" && v["_type"] == "Yield" {
+			types = append(types, g.typeIn(gen.name, v["value"]))
+		}
+	})
+	t, a, b := g.unifyTypes(types)
+	_, list := g.listElemType(t)
+	switch {
+	case a != "":
+		return "", fmt.Sprintf("values of types %s and %s", a, b)
+	case t == "int" || t == "double" || t == "char*" || list:
+	default:
+		return "", "values that are objects or of an unknown type"
+	}
+	if g.optRefcount && g.isRcType(t) {
+		return "", "reference-counted values (-refcount)"
+	}
+	return t, ""
+}
+
+// genLocalsRestriction: 局部变量的类型要能推断出来（它们是结构体的字段），含有 yield 的 for 循环只能是
+// range、列表或者另一个生成器（其他循环的 C 局部变量在 yield 之后继续时没有值）
+func (g *generator) genLocalsRestriction(gen *genFunc) string {
+	params := map[string]bool{}
+	args, _ := gen.node["args"].(map[string]interface{})
+	list, _ := args["args"].([]interface{})
+	for _, a := range list {
+		id, _ := a.(map[string]interface{})["arg"].(string)
+		params[id] = true
+	}
+	body := gen.node["body"].([]interface{})
+	for _, id := range sortedKeys(localNames(body)) {
+		t := g.inferVars[gen.name][id]
+		_, isList := g.listElemType(t)
+		switch {
+		case params[id]:
+		case t == "":
+			return fmt.Sprintf("the local variable %s, whose type is not known", id)
+		case g.isClassType(t) || g.classStructsMap[strings.TrimSuffix(t, "*")]:
+			return fmt.Sprintf("the local variable %s, which holds an object", id)
+		case g.optRefcount && (g.isRcType(t) || isList):
+			return fmt.Sprintf("the reference-counted local variable %s (-refcount)", id)
+		}
+	}
+	reason := ""
+	walkInferStmts(body, func(m map[string]interface{}) {
+		if m["_type"] != "For" || reason != "" || !hasYield(m["body"]) {
+			return
+		}
+		if iter, _ := m["iter"].(map[string]interface{}); !g.genLoopIter(gen.name, iter) {
+			reason = "a yield inside a for loop that is not over range(), a list, a generator or itertools over them"
+		}
+	})
+	return reason
+}
+
+// genLoopIter: 循环变量与循环状态都能放进生成器结构体的迭代对象：range()、列表、生成器与其上的 itertools
+func (g *generator) genLoopIter(scope string, iter map[string]interface{}) bool {
+	args, _ := iter["args"].([]interface{})
+	switch g.itertoolsCall(iter) {
+	case "itertools.count", "itertools.repeat":
+		return true
+	case "itertools.chain", "itertools.islice":
+		for i, a := range args {
+			if am, _ := a.(map[string]interface{}); (i == 0 || g.itertoolsCall(iter) == "itertools.chain") && !g.genLoopIter(scope, am) {
+				return false
+			}
+		}
+		return len(args) > 0
+	}
+	_, isList := g.listElemType(g.typeIn(scope, iter))
+	return isRangeCall(iter) || isList || g.genCall(iter) != nil
+}
+
+// genCall: iter 是对可以翻译的生成器函数的调用时返回它
+func (g *generator) genCall(iter interface{}) *genFunc {
+	m, _ := iter.(map[string]interface{})
+	fn, _ := m["func"].(map[string]interface{})
+	name, _ := fn["id"].(string)
+	if gen := g.genFuncs[name]; m["_type"] == "Call" && fn["_type"] == "Name" && gen != nil && gen.reason == "" {
+		return gen
+	}
+	return nil
+}
+
+// loopTemp: 循环用的临时变量，返回名字与第一次赋值时的写法（类型 名字）。生成器的函数体中它是
+// 状态结构体的字段（self->名字），从循环中的 yield 继续时仍然有效
+func (g *generator) loopTemp(prefix, typ string) (name, decl string) {
+	name = g.newTemp(prefix)
+	if gen := g.curGen; gen != nil {
+		gen.fields = append(gen.fields, irParam{name, typ})
+		return "self->" + name, "self->" + name
+	}
+	return name, typ + " " + name
+}
+
+// generatorDef: 生成器函数 f（参数已经确定）的结构体 NAME_gen、初始化函数 NAME 与 NAME_next
+func (g *generator) generatorDef(node ASTNode, f *irFunc, gen *genFunc) string {
+	name, indent := f.name, f.indent
+	pad := strings.Repeat(" ", indent*4)
+	// 函数体中的参数与局部变量改为结构体的字段
+	body := deepCopyNode(node["body"]).([]interface{})
+	locals := localNames(node["body"].([]interface{}))
+	gen.fields, gen.states = nil, 0
+	for _, p := range f.params {
+		gen.fields = append(gen.fields, p)
+		delete(locals, p.name)
+	}
+	for _, id := range sortedKeys(locals) {
+		gen.fields = append(gen.fields, irParam{id, g.inferVars[name][id]})
+	}
+	for _, fd := range gen.fields {
+		renameNames(body, fd.name, "self->"+fd.name)
+		g.declareIn(g.symtab, "self->"+fd.name, fd.typ, "field")
+	}
+	g.symtab.locals = localNames(body)
+	prevScope, prevLICM := g.currentScope, g.optLICM
+	g.currentScope, g.curGen, g.optLICM = name, gen, false // 提到循环外的不变量是 C 的局部变量
+	defer func() { g.currentScope, g.curGen, g.optLICM = prevScope, nil, prevLICM }()
+	g.scopeIndent = indent + 2
+	g.translatedFuncs[name] = name
+	code := g.stmtsToC(body, indent+2)
+
+	typ := name + "_gen"
+	ctor := &irFunc{name: name, ret: typ, params: f.params, indent: indent}
+	ctor.head = g.annotation(node, indent) + g.docComment(node["body"], pad) + g.lineMark(node, indent)
+	ctor.body = []irStmt{irCode(fmt.Sprintf("%s    %s self = {0};\n", pad, typ))}
+	for _, p := range f.params {
+		ctor.body = append(ctor.body, irCode(fmt.Sprintf("%s    self.%s = %s;\n", pad, p.name, p.name)))
+	}
+	ctor.body = append(ctor.body, &irReturn{irExpr{"self", typ}})
+	next := &irFunc{name: name + "_next", ret: "int", params: []irParam{{"self", typ + "*"}, {"_value", gen.elem + "*"}}, indent: indent}
+	next.head = fmt.Sprintf("%s// runs %s() up to its next yield: stores the value in *_value and returns 1, or returns 0 when %s() has finished\n", pad, name, name)
+	next.body = []irStmt{
+		irCode(fmt.Sprintf("%s    switch (self->_state) {\n%s    case 0:\n%s%s    }\n%s    self->_state = -1;\n", pad, pad, code, pad, pad)),
+		&irReturn{irExpr{"0", "int"}},
+	}
+	fields := append([]irParam{{"_state", "int"}}, gen.fields...)
+	g.classStructs = append(g.classStructs, fmt.Sprintf("// generator %s(): its parameters and local variables, and the yield to resume after (_state)\n", name)+
+		g.emit.emitStruct(typ, fields)+g.emit.emitPrototype(ctor)+g.emit.emitPrototype(next))
+	g.irFuncs = append(g.irFuncs, ctor, next)
+	g.funcDefs = append(g.funcDefs, g.emit.emitFunction(ctor, g.lineReset())+g.emit.emitFunction(next, g.lineReset()))
+	return ""
+}
+
+// yieldStmt: yield value：写入 *_value，记下从下一个 case 标号继续，返回 1
+func (g *generator) yieldStmt(val map[string]interface{}, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	gen := g.curGen
+	gen.states++
+	mark := len(g.pendingPost)
+	value := g.toC(val["value"].(map[string]interface{}), 0)
+	note := ""
+	if g.takePost(mark, indent) != "" {
+		// 语句之后释放的临时值（-owned-strings 构造的字符串等）可能就是 yield 的值，for 循环在 yield 之后还要用它
+		note = " // not released: the loop over the generator uses the value"
+	}
+	return fmt.Sprintf("%s*_value = %s;%s\n%sself->_state = %d;\n%sreturn 1;\n%scase %d:;\n", pad, value, note, pad, gen.states, pad, pad, gen.states)
+}
+
+// handleForGenerator: for x in gen(...)：初始化状态结构体，每一轮由 gen_next 取得下一个值
+func (g *generator) handleForGenerator(node ASTNode, gen *genFunc, indent int) string {
+	pad := strings.Repeat(" ", indent*4)
+	tm, _ := node["target"].(map[string]interface{})
+	if tm["_type"] != "Name" {
+		return g.unsupportedStmt(node, pad, "for loop over a generator (the target must be a name)")
+	}
+	target := g.toC(tm, 0)
+	call := node["iter"].(map[string]interface{})
+	args, _ := call["args"].([]interface{})
+	state, decl := g.loopTemp("_gen", gen.name+"_gen")
+	code := fmt.Sprintf("%s%s = %s(%s);\n", pad, decl, gen.name, join(g.objectArgs(gen.name, args, g.splitCallArgs(args)), ", "))
+	value, assign := target, ""
+	if !g.isDeclared(target) {
+		g.declareVar(target, gen.elem)
+		code += fmt.Sprintf("%s%s %s;\n", pad, gen.elem, target)
+	} else if t := g.varType(target); t != gen.elem {
+		if !isNumericType(t) || !isNumericType(gen.elem) {
+			return g.unsupportedStmt(node, pad, fmt.Sprintf("for loop over a generator of %s (%s is %s)", gen.elem, target, t))
+		}
+		// 循环变量原来是另一种数值类型：值先取到临时变量
+		var tdecl string
+		value, tdecl = g.loopTemp("_v", gen.elem)
+		if g.curGen == nil {
+			code += fmt.Sprintf("%s%s;\n", pad, tdecl)
+		}
+		assign = fmt.Sprintf("%s    %s = %s;\n", pad, target, value)
+	}
+	restore := g.enterLoop()
+	g.pushScope(scopeBlock, "for")
+	body := g.stmtsToC(node["body"], indent+1)
+	g.popScope()
+	restore()
+	return code + fmt.Sprintf("%swhile (%s_next(&%s, &%s)) {\n%s%s%s}\n", pad, gen.name, state, value, assign, body, pad)
+}